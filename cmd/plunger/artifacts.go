@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+	"time"
+)
+
+var artifactsCmd = &cobra.Command{
+	Use:   "artifacts",
+	Short: "Attach files such as screenshots or core dumps to sessions and entries",
+}
+
+var artifactsAddCmd = &cobra.Command{
+	Use:   "add <file>",
+	Short: "Attach a file to a session or an entry",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		session, _ := cmd.Flags().GetString("session")
+		entry, _ := cmd.Flags().GetInt("entry")
+		name, _ := cmd.Flags().GetString("name")
+		contentType, _ := cmd.Flags().GetString("content-type")
+		reference, _ := cmd.Flags().GetBool("reference")
+		if session == "" && entry == 0 {
+			cobra.CheckErr(errors.New("artifacts need a --session or an --entry"))
+		}
+
+		artifact := &pkg.Artifact{Name: name, ContentType: contentType}
+		if session != "" {
+			artifact.SessionID = &session
+		}
+		if entry != 0 {
+			artifact.LogEntryID = &entry
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx := context.Background()
+		if reference {
+			err = logWriter.AddArtifactPath(ctx, artifact, args[0])
+		} else {
+			var data []byte
+			data, err = os.ReadFile(args[0])
+			cobra.CheckErr(err)
+			if artifact.Name == "" {
+				artifact.Name = filepath.Base(args[0])
+			}
+			err = logWriter.AddArtifact(ctx, artifact, data)
+		}
+		cobra.CheckErr(err)
+		fmt.Println(artifact.ID)
+	},
+}
+
+var artifactsGetCmd = &cobra.Command{
+	Use:   "get <id>",
+	Short: "Write the content of an artifact to stdout or a file",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		ids, err := parseIDs(args)
+		cobra.CheckErr(err)
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		_, data, err := logWriter.ReadArtifact(context.Background(), ids[0])
+		cobra.CheckErr(err)
+		if out == "" || out == "-" {
+			_, err = os.Stdout.Write(data)
+		} else {
+			err = os.WriteFile(out, data, 0o644)
+		}
+		cobra.CheckErr(err)
+	},
+}
+
+var artifactsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the artifacts of a session, of an entry, or of the whole database",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		filter := pkg.ArtifactFilter{}
+		filter.SessionID, _ = cmd.Flags().GetString("session")
+		filter.LogEntryID, _ = cmd.Flags().GetInt("entry")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		artifacts, err := logWriter.ListArtifacts(context.Background(), filter)
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(artifacts)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "id\tsession\tentry\tname\ttype\tsize\tcreated")
+			for _, a := range artifacts {
+				session, entry := "", ""
+				if a.SessionID != nil {
+					session = *a.SessionID
+				}
+				if a.LogEntryID != nil {
+					entry = fmt.Sprintf("%d", *a.LogEntryID)
+				}
+				name := a.Name
+				if a.Path != nil {
+					name += " -> " + *a.Path
+				}
+				_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%d\t%s\n",
+					a.ID, session, entry, name, a.ContentType, a.Size, a.CreatedAt.Format(time.RFC3339))
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+func init() {
+	artifactsAddCmd.Flags().String("session", "", "Session the file is attached to")
+	artifactsAddCmd.Flags().Int("entry", 0, "Entry the file is attached to")
+	artifactsAddCmd.Flags().String("name", "", "Name of the artifact (default the file name)")
+	artifactsAddCmd.Flags().String("content-type", "", "Content type of the file (default detected from its content)")
+	artifactsAddCmd.Flags().Bool("reference", false, "Only store the path of the file instead of copying it into the database")
+	artifactsGetCmd.Flags().StringP("out", "o", "", "Output file (default stdout)")
+	artifactsListCmd.Flags().String("session", "", "Only list the artifacts of this session and its entries")
+	artifactsListCmd.Flags().Int("entry", 0, "Only list the artifacts of this entry")
+	artifactsListCmd.Flags().String("output", "table", "Output format (table, json)")
+
+	artifactsCmd.AddCommand(artifactsAddCmd)
+	artifactsCmd.AddCommand(artifactsGetCmd)
+	artifactsCmd.AddCommand(artifactsListCmd)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Write a consistent snapshot of the database",
+	Long: `Write a consistent snapshot of the sqlite database to --out, using the
+online backup API of sqlite, so that it can be taken while entries keep being
+written. Offloaded values are copied next to the snapshot.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		out, _ := cmd.Flags().GetString("out")
+		if out == "" {
+			cobra.CheckErr(errors.New("no --out given"))
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.Backup(context.Background(), out)
+		cobra.CheckErr(err)
+		fmt.Printf("Wrote snapshot to %s\n", out)
+	},
+}
+
+func init() {
+	backupCmd.Flags().String("out", "", "Path of the snapshot, replaced if it exists")
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/retention"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+var collectCmd = &cobra.Command{
+	Use:   "collect",
+	Short: "Collect logs from other systems",
+}
+
+var collectDockerCmd = &cobra.Command{
+	Use:   "docker",
+	Short: "Collect the logs of Docker containers",
+	Long: `Follow the logs of the running Docker containers, and of the containers
+started later on, until interrupted. Lines are parsed with --format, lines that
+can't be parsed are stored as messages. Entries are stored with the name, id
+and image of their container, and their stream (stdout or stderr).
+
+The daemon is reached at --host, which defaults to DOCKER_HOST or
+` + pkg.DefaultDockerHost + `.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		host, _ := cmd.Flags().GetString("host")
+		if host == "" {
+			host = os.Getenv("DOCKER_HOST")
+		}
+		if host == "" {
+			host = pkg.DefaultDockerHost
+		}
+		containers, _ := cmd.Flags().GetStringSlice("container")
+		format, _ := cmd.Flags().GetString("format")
+		since, _ := cmd.Flags().GetString("since")
+		pollInterval, _ := cmd.Flags().GetDuration("poll-interval")
+
+		parser, err := pkg.LineParserForFormat(format)
+		cobra.CheckErr(err)
+		client, err := pkg.NewDockerClient(host)
+		cobra.CheckErr(err)
+
+		opts := []pkg.DockerCollectOption{
+			pkg.WithDockerContainers(containers...),
+			pkg.WithDockerParser(parser),
+			pkg.WithDockerPollInterval(pollInterval),
+			pkg.WithDockerOnError(func(container *pkg.DockerContainer, err error) {
+				if container != nil {
+					_, _ = fmt.Fprintf(os.Stderr, "could not collect the logs of %s: %v\n", container.Name, err)
+				} else {
+					_, _ = fmt.Fprintf(os.Stderr, "could not list the containers: %v\n", err)
+				}
+			}),
+		}
+		if since != "" {
+			d, err := retention.ParseDuration(since)
+			cobra.CheckErr(err)
+			opts = append(opts, pkg.WithDockerSince(time.Now().Add(-d)))
+		}
+
+		logWriter, err := openLogWriter(pkg.WithOnError(func(err error, payload []byte) {
+			_, _ = fmt.Fprintf(os.Stderr, "could not store %q: %v\n", payload, err)
+		}))
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		err = logWriter.CollectDocker(ctx, client, opts...)
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	collectDockerCmd.Flags().String("host", "", "Address of the Docker daemon, such as unix:///var/run/docker.sock or tcp://localhost:2375")
+	collectDockerCmd.Flags().StringSlice("container", []string{}, "Names or ids of the containers to collect (default: all)")
+	collectDockerCmd.Flags().String("format", "json", "Format of the logged lines ("+strings.Join(pkg.LineParserFormats(), ", ")+")")
+	collectDockerCmd.Flags().String("since", "", "Also collect the logs the running containers wrote in this period (e.g. 1h, 2d)")
+	collectDockerCmd.Flags().Duration("poll-interval", pkg.DefaultDockerPollInterval, "Interval at which new containers are looked for")
+
+	collectCmd.AddCommand(collectDockerCmd)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var compactCmd = &cobra.Command{
+	Use:   "compact",
+	Short: "Compress the large values of an existing database",
+	Long: "Compress the existing blob and JSON values larger than --compression-threshold,\n" +
+		"using --compression (zstd if not set).",
+	Run: func(cmd *cobra.Command, args []string) {
+		vacuum, _ := cmd.Flags().GetBool("vacuum")
+
+		opts := []pkg.LogWriterOption{}
+		if !cmd.Flags().Changed("compression") {
+			threshold, _ := cmd.Flags().GetInt("compression-threshold")
+			opts = append(opts, pkg.WithCompression(pkg.CompressionZstd, threshold))
+		}
+		logWriter, err := openLogWriter(opts...)
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		res, err := logWriter.Compact(context.Background())
+		cobra.CheckErr(err)
+		_, _ = fmt.Fprintf(os.Stderr, "compressed %d values, %d bytes to %d bytes\n", res.Values, res.BytesBefore, res.BytesAfter)
+
+		if vacuum {
+			err = logWriter.Vacuum()
+			cobra.CheckErr(err)
+		}
+	},
+}
+
+func init() {
+	compactCmd.Flags().Bool("vacuum", false, "Run VACUUM afterwards to release the freed space")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var deleteCmd = &cobra.Command{
+	Use:   "delete [expression]",
+	Short: "Delete the log entries matching the filter flags and expression",
+	Long: "Delete the log entries matching the filter flags and an optional expression, as\n" +
+		"accepted by the query command. Use --dry-run to list the entries first.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		if len(args) > 0 {
+			filter.Query = args[0]
+			cobra.CheckErr(filter.Validate())
+		}
+
+		all, _ := cmd.Flags().GetBool("all")
+		if !all && len(args) == 0 && isEmptyFilter(filter) {
+			cobra.CheckErr(errors.New("no filter given, use --all to delete every entry"))
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if dryRun {
+			output, _ := cmd.Flags().GetString("output")
+			entries, err := logWriter.GetEntries(filter)
+			cobra.CheckErr(err)
+			err = printEntries(os.Stdout, entries, output)
+			cobra.CheckErr(err)
+			_, _ = fmt.Fprintf(os.Stderr, "Would delete %d entries\n", len(entries))
+			return
+		}
+
+		n, err := logWriter.DeleteEntries(filter)
+		cobra.CheckErr(err)
+		fmt.Printf("Deleted %d entries\n", n)
+	},
+}
+
+var sessionDeleteCmd = &cobra.Command{
+	Use:   "delete <id>",
+	Short: "Delete a session along with its entries",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		if dryRun {
+			entries, err := logWriter.GetEntries(pkg.NewGetEntriesFilter(pkg.WithSession(args[0])))
+			cobra.CheckErr(err)
+			if _, err := logWriter.Sessions().GetSession(args[0]); err != nil && len(entries) == 0 {
+				cobra.CheckErr(err)
+			}
+			fmt.Printf("Would delete session %s and %d entries\n", args[0], len(entries))
+			return
+		}
+
+		n, err := logWriter.DeleteSession(args[0])
+		cobra.CheckErr(err)
+		fmt.Printf("Deleted session %s and %d entries\n", args[0], n)
+	},
+}
+
+// isEmptyFilter returns true if filter, as parsed by filterFromFlags,
+// matches every entry.
+func isEmptyFilter(filter *pkg.GetEntriesFilter) bool {
+	return len(filter.Levels) == 0 && filter.MinLevel == "" &&
+		filter.Session == "" && filter.SessionTree == "" && filter.Group == "" &&
+		filter.From.IsZero() && filter.To.IsZero() && len(filter.MetaFilters) == 0 &&
+		filter.Caller == "" && filter.ErrorContains == "" && filter.TraceID == "" &&
+		filter.Stream == ""
+}
+
+func init() {
+	addFilterFlags(deleteCmd)
+	deleteCmd.Flags().Bool("all", false, "Allow deleting every entry when no filter is given")
+	deleteCmd.Flags().Bool("dry-run", false, "Only print the entries that would be deleted")
+	deleteCmd.Flags().String("output", "table", "Output format of --dry-run (table, json, console)")
+
+	sessionDeleteCmd.Flags().Bool("dry-run", false, "Only print what would be deleted")
+}
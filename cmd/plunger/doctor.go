@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+var doctorCmd = &cobra.Command{
+	Use:   "doctor",
+	Short: "Check the consistency of the database",
+	Long: "Run the integrity check of the database, and look for meta values referencing unknown\n" +
+		"keys or missing entries, values stored in the wrong column and JSON values that can't\n" +
+		"be parsed. With --fix, the issues that can be fixed are. Exits with status 1 if issues remain.",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		fix, _ := cmd.Flags().GetBool("fix")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		issues, err := logWriter.Doctor(context.Background(), pkg.WithDoctorFix(fix))
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(issues)
+			cobra.CheckErr(err)
+		case "table":
+			if len(issues) == 0 {
+				fmt.Println("No issues found")
+				break
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "check\ttable\tdescription\tcount\tfixed")
+			for _, issue := range issues {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%t\n",
+					issue.Check, issue.Table, issue.Description, issue.Count, issue.Fixed)
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+
+		for _, issue := range issues {
+			if !issue.Fixed {
+				_ = logWriter.Close()
+				os.Exit(1)
+			}
+		}
+	},
+}
+
+func init() {
+	doctorCmd.Flags().Bool("fix", false, "Fix the issues that can be fixed")
+	doctorCmd.Flags().String("output", "table", "Output format (table, json)")
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export log entries to cleartext files",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		cobra.CheckErr(paginationFromFlags(cmd, filter))
+
+		format, _ := cmd.Flags().GetString("format")
+		out, _ := cmd.Flags().GetString("out")
+		extractDir, _ := cmd.Flags().GetString("extract-dir")
+		extractBlobs, _ := cmd.Flags().GetBool("extract-blobs")
+		extractJSON, _ := cmd.Flags().GetBool("extract-json")
+		extractArtifacts, _ := cmd.Flags().GetBool("extract-artifacts")
+		columns, _ := cmd.Flags().GetStringSlice("columns")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		if extractArtifacts {
+			_, err = logWriter.ExtractArtifacts(cmd.Context(), filter, filepath.Join(extractDir, "artifacts"))
+			cobra.CheckErr(err)
+		}
+
+		it, err := logWriter.IterEntries(cmd.Context(), filter)
+		cobra.CheckErr(err)
+		defer func(it pkg.EntryIterator) {
+			_ = it.Close()
+		}(it)
+
+		exporter := export.NewExporter(
+			export.WithFormat(export.Format(format)),
+			export.WithExtractDir(extractDir),
+			export.WithExtractBlobs(extractBlobs),
+			export.WithExtractJSON(extractJSON),
+			export.WithColumns(columns...),
+		)
+
+		if export.Format(format) == export.FormatDuckDB {
+			if out == "" || out == "-" {
+				cobra.CheckErr(errors.New("duckdb exports need an output file (--out)"))
+			}
+			err = exporter.ExportDuckDB(cmd.Context(), out, it)
+			cobra.CheckErr(err)
+			return
+		}
+
+		var w io.Writer = os.Stdout
+		if out != "" && out != "-" {
+			f, err := os.Create(out)
+			cobra.CheckErr(err)
+			defer func(f *os.File) {
+				_ = f.Close()
+			}(f)
+			w = f
+		}
+
+		err = exporter.ExportIterator(w, it)
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	addFilterFlags(exportCmd)
+	addPaginationFlags(exportCmd)
+	exportCmd.Flags().String("format", "jsonl", "Export format (jsonl, csv, parquet, duckdb, text)")
+	exportCmd.Flags().StringSlice("columns", []string{}, "Columns of csv, parquet and duckdb exports, among id, date, level, session, message and meta keys (default all)")
+	exportCmd.Flags().StringP("out", "o", "", "Output file (default stdout)")
+	exportCmd.Flags().String("extract-dir", ".", "Directory extracted values are written to")
+	exportCmd.Flags().Bool("extract-blobs", false, "Write blob values to separate files")
+	exportCmd.Flags().Bool("extract-json", false, "Write JSON values to separate files")
+	exportCmd.Flags().Bool("extract-artifacts", false, "Write the artifacts of the exported entries and their sessions to the artifacts directory of --extract-dir")
+}
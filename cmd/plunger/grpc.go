@@ -0,0 +1,38 @@
+package main
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/rpc"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"google.golang.org/grpc"
+	"net"
+)
+
+var grpcServeCmd = &cobra.Command{
+	Use:   "grpc-serve",
+	Short: "Serve the log database over gRPC, to write and query logs remotely",
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		listener, err := net.Listen("tcp", addr)
+		cobra.CheckErr(err)
+
+		server := grpc.NewServer()
+		rpc.RegisterServer(server, rpc.NewServer(logWriter))
+
+		log.Info().Str("addr", addr).Msg("serving gRPC")
+		err = server.Serve(listener)
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	grpcServeCmd.Flags().String("addr", "localhost:9090", "Address to listen on")
+}
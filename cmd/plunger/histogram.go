@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+var histogramCmd = &cobra.Command{
+	Use:   "histogram",
+	Short: "Show the number of entries over time",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		bucket, _ := cmd.Flags().GetDuration("bucket")
+		byLevel, _ := cmd.Flags().GetBool("by-level")
+		output, _ := cmd.Flags().GetString("output")
+		width, _ := cmd.Flags().GetInt("width")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		buckets, err := logWriter.Histogram(filter, bucket, pkg.WithHistogramByLevel(byLevel))
+		cobra.CheckErr(err)
+
+		switch output {
+		case "bars":
+			printHistogramBars(os.Stdout, buckets, width)
+		case "sparkline":
+			_, _ = fmt.Fprintln(os.Stdout, sparkline(buckets))
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(buckets)
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+var sparkTicks = []rune("▁▂▃▄▅▆▇█")
+
+// sparkline renders one character per bucket, scaled to the largest bucket.
+func sparkline(buckets []*pkg.HistogramBucket) string {
+	highest := maxCount(buckets)
+	b := &strings.Builder{}
+	for _, bucket := range buckets {
+		if bucket.Count == 0 {
+			b.WriteRune(' ')
+			continue
+		}
+		i := int(bucket.Count * int64(len(sparkTicks)-1) / highest)
+		b.WriteRune(sparkTicks[i])
+	}
+	return b.String()
+}
+
+// printHistogramBars prints one bar per bucket, scaled to width characters.
+func printHistogramBars(w io.Writer, buckets []*pkg.HistogramBucket, width int) {
+	highest := maxCount(buckets)
+	countWidth := len(fmt.Sprintf("%d", highest))
+	for _, bucket := range buckets {
+		n := 0
+		if highest > 0 {
+			n = int(bucket.Count * int64(width) / highest)
+		}
+		if n == 0 && bucket.Count > 0 {
+			n = 1
+		}
+		line := fmt.Sprintf("%s %*d %s",
+			bucket.Start.Local().Format("2006-01-02 15:04:05"), countWidth, bucket.Count, strings.Repeat("█", n))
+		if len(bucket.Levels) > 0 {
+			levels := []string{}
+			for level := range bucket.Levels {
+				levels = append(levels, level)
+			}
+			sort.Strings(levels)
+			parts := []string{}
+			for _, level := range levels {
+				parts = append(parts, fmt.Sprintf("%s=%d", level, bucket.Levels[level]))
+			}
+			line += "  " + strings.Join(parts, " ")
+		}
+		_, _ = fmt.Fprintln(w, line)
+	}
+}
+
+func maxCount(buckets []*pkg.HistogramBucket) int64 {
+	var highest int64
+	for _, bucket := range buckets {
+		if bucket.Count > highest {
+			highest = bucket.Count
+		}
+	}
+	return highest
+}
+
+func init() {
+	addFilterFlags(histogramCmd)
+	histogramCmd.Flags().Duration("bucket", time.Hour, "Size of the time buckets")
+	histogramCmd.Flags().Bool("by-level", false, "Split the counts by level")
+	histogramCmd.Flags().String("output", "bars", "Output format (bars, sparkline, json)")
+	histogramCmd.Flags().Int("width", 50, "Width of the longest bar")
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/alert"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var importCmd = &cobra.Command{
+	Use:   "import <file>...",
+	Short: "Import log files",
+	Long: "Import log files, such as zerolog output (one JSON entry per line) or logfmt.\n\n" +
+		"System logs can be imported with --format journald, from the output of\n" +
+		"journalctl -o json or journalctl -o export. Other formats can be parsed with\n" +
+		"--format regex:<pattern>, whose named groups become the fields of the entries.\n\n" +
+		"With --multiline, indented lines and the lines of Java and Python stack traces\n" +
+		"are appended to the stack field of the entry they follow, instead of being\n" +
+		"imported as entries. --continuation-pattern selects these lines with a regexp.\n\n" +
+		"Use - to read from stdin.",
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		parser, err := pkg.LineParserForFormat(format)
+		cobra.CheckErr(err)
+
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		timestampField, _ := cmd.Flags().GetString("timestamp-field")
+		timestampFormat, _ := cmd.Flags().GetString("timestamp-format")
+		levelField, _ := cmd.Flags().GetString("level-field")
+		messageField, _ := cmd.Flags().GetString("message-field")
+		skipInvalid, _ := cmd.Flags().GetBool("skip-invalid")
+		session, _ := cmd.Flags().GetString("session")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+		rules, _ := cmd.Flags().GetString("rules")
+		multiline, _ := cmd.Flags().GetBool("multiline")
+		continuationPattern, _ := cmd.Flags().GetString("continuation-pattern")
+
+		lwOpts := []pkg.LogWriterOption{}
+		if session != "" {
+			lwOpts = append(lwOpts, pkg.WithDefaultSession(session))
+		}
+		var engine *alert.Engine
+		if rules != "" {
+			config, err := alert.LoadConfig(rules)
+			cobra.CheckErr(err)
+			engine = alert.NewEngine(config)
+			lwOpts = append(lwOpts, pkg.WithMiddleware(engine.Middleware))
+		}
+		logWriter, err := openLogWriter(lwOpts...)
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+		if engine != nil {
+			alert.WithLogWriter(logWriter)(engine)
+			// wait for the actions before closing the database
+			defer engine.Close()
+		}
+
+		opts := []pkg.ImportOption{
+			pkg.WithImportParser(parser),
+			pkg.WithImportBatchSize(batchSize),
+			pkg.WithImportSkipInvalid(skipInvalid),
+		}
+		if timestampField != "" {
+			opts = append(opts, pkg.WithImportTimestampField(timestampField))
+		}
+		if timestampFormat != "" {
+			opts = append(opts, pkg.WithImportTimestampFormat(timestampFormat))
+		}
+		if levelField != "" {
+			opts = append(opts, pkg.WithImportLevelField(levelField))
+		}
+		if messageField != "" {
+			opts = append(opts, pkg.WithImportMessageField(messageField))
+		}
+		if continuationPattern != "" {
+			re, err := regexp.Compile(continuationPattern)
+			cobra.CheckErr(err)
+			opts = append(opts, pkg.WithImportMultiline(pkg.ContinuationPattern(re)))
+		} else if multiline {
+			opts = append(opts, pkg.WithImportMultiline(pkg.IndentedContinuation))
+		}
+
+		for _, file := range args {
+			fileOpts := opts
+			if !quiet {
+				fileOpts = append(fileOpts, pkg.WithImportProgress(func(p pkg.ImportProgress) {
+					_, _ = fmt.Fprintf(os.Stderr, "\r%s: %d lines, %d imported, %d skipped", file, p.Lines, p.Imported, p.Skipped)
+				}))
+			}
+
+			var r io.Reader = os.Stdin
+			if file != "-" {
+				f, err := os.Open(file)
+				cobra.CheckErr(err)
+				defer func(f *os.File) {
+					_ = f.Close()
+				}(f)
+				r = f
+			}
+
+			res, err := logWriter.Import(r, fileOpts...)
+			if !quiet {
+				_, _ = fmt.Fprintln(os.Stderr)
+			}
+			cobra.CheckErr(err)
+			if !quiet {
+				_, _ = fmt.Fprintf(os.Stderr, "%s: imported %d entries (%d skipped)\n", file, res.Imported, res.Skipped)
+			}
+		}
+	},
+}
+
+func init() {
+	importCmd.Flags().String("format", "json", "Format of the log lines ("+strings.Join(pkg.LineParserFormats(), ", ")+
+		"), regex taking a pattern with named groups, e.g. regex:(?P<level>\\w+) (?P<message>.*)")
+	importCmd.Flags().Int("batch-size", pkg.DefaultImportBatchSize, "Number of entries written per transaction")
+	importCmd.Flags().String("timestamp-field", "", "Field containing the timestamp (default: zerolog's time field)")
+	importCmd.Flags().String("timestamp-format", "", "Format of the timestamp, a Go time layout or UNIX, UNIXMS, UNIXMICRO, UNIXNANO")
+	importCmd.Flags().String("level-field", "", "Field containing the level (default: level)")
+	importCmd.Flags().String("message-field", "", "Field containing the message (default: zerolog's message field)")
+	importCmd.Flags().Bool("skip-invalid", false, "Skip lines that can't be parsed")
+	importCmd.Flags().String("session", "", "Session of imported entries that don't have one")
+	importCmd.Flags().BoolP("quiet", "q", false, "Don't report progress")
+	importCmd.Flags().Bool("multiline", false, "Append indented lines and stack traces to the stack field of the previous entry")
+	importCmd.Flags().String("continuation-pattern", "", "Regexp matching the lines that continue the previous entry, e.g. ^\\s (implies --multiline)")
+	importCmd.Flags().String("rules", "", "YAML file with alerting rules evaluated on the imported entries")
+}
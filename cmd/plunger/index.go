@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var indexCmd = &cobra.Command{
+	Use:   "index",
+	Short: "Manage the indexes on the values of meta keys",
+	Long: `Create partial indexes on the values of the meta keys queried the most, such as
+user_id or request_path, to speed up the queries filtering on them.`,
+}
+
+var indexListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the indexes on meta keys",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		indexes, err := logWriter.Indexes(cmd.Context())
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(indexes)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "key\ttype\tname\tcreated")
+			for _, index := range indexes {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+					index.Key, index.Type, index.Name, index.CreatedAt.Format(time.RFC3339))
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+var indexAddCmd = &cobra.Command{
+	Use:   "add <key>",
+	Short: "Index the values of a meta key",
+	Long: `Index the values of a meta key. The type defaults to number for the keys declared
+as int or real in the schema, and to text otherwise. Run add again after
+declaring the key in the schema, so that the index matches how it is stored.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := []pkg.IndexOption{}
+		if cmd.Flags().Changed("type") {
+			s, _ := cmd.Flags().GetString("type")
+			indexType, err := pkg.ParseIndexType(s)
+			cobra.CheckErr(err)
+			opts = append(opts, pkg.WithIndexType(indexType))
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		index, err := logWriter.EnsureIndex(cmd.Context(), args[0], opts...)
+		cobra.CheckErr(err)
+		fmt.Println(index.Name)
+	},
+}
+
+var indexDropCmd = &cobra.Command{
+	Use:   "drop <key>",
+	Short: "Drop the indexes on a meta key",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.DropIndex(cmd.Context(), args[0])
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	indexListCmd.Flags().String("output", "table", "Output format (table, json)")
+	indexAddCmd.Flags().String("type", "", "Type of the values indexed (text, number)")
+
+	indexCmd.AddCommand(indexListCmd)
+	indexCmd.AddCommand(indexAddCmd)
+	indexCmd.AddCommand(indexDropCmd)
+}
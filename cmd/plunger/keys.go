@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+var keysCmd = &cobra.Command{
+	Use:   "keys",
+	Short: "List, register, rename and merge the keys of the database",
+}
+
+var keysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the meta keys and ad-hoc keys with their number of values",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		keys, err := logWriter.ListKeys(context.Background())
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(keys)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "key\tid\tvalues")
+			for _, key := range keys {
+				id := "-"
+				if key.MetaKey {
+					id = fmt.Sprintf("%d", key.ID)
+					if key.Wide {
+						id += " (wide)"
+					}
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%d\n", key.Name, id, key.Count)
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+var keysAddCmd = &cobra.Command{
+	Use:   "add <key>...",
+	Short: "Register meta keys, rewriting the values already stored for them",
+	Args:  cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		n, err := logWriter.PromoteMetaKeys(context.Background(), args...)
+		cobra.CheckErr(err)
+		fmt.Printf("Registered %d keys, rewrote %d values\n", len(args), n)
+	},
+}
+
+var keysRenameCmd = &cobra.Command{
+	Use:   "rename <key> <new-name>",
+	Short: "Rename a key",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		_, err = logWriter.RenameKey(context.Background(), args[0], args[1])
+		cobra.CheckErr(err)
+		fmt.Printf("Renamed %s to %s\n", args[0], args[1])
+	},
+}
+
+var keysMergeCmd = &cobra.Command{
+	Use:   "merge <key> <into>",
+	Short: "Move the values of a key to another key representing the same field",
+	Long: "Move the values of a key to another key and remove it. Entries that have values\n" +
+		"for both keys keep the value of the key merged into.",
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		n, err := logWriter.MergeKeys(context.Background(), args[0], args[1])
+		cobra.CheckErr(err)
+		fmt.Printf("Merged %s into %s, moved %d values\n", args[0], args[1], n)
+	},
+}
+
+var keysStatsCmd = &cobra.Command{
+	Use:   "stats <key>",
+	Short: "Show the number of values of a key, its range and its most frequent values",
+	Long: "Show the number of entries and distinct values of a key, the range of its numeric values,\n" +
+		"and its most frequent values. The filter flags only restrict the listed values.",
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		top, _ := cmd.Flags().GetInt("top")
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx := context.Background()
+		stats, err := logWriter.KeyStatsContext(ctx, args[0])
+		cobra.CheckErr(err)
+		values, err := logWriter.DistinctValuesContext(ctx, args[0], filter)
+		cobra.CheckErr(err)
+		if top > 0 && len(values) > top {
+			values = values[:top]
+		}
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(struct {
+				*pkg.KeyStats
+				Values []pkg.ValueCount `json:"values"`
+			}{stats, values})
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintf(tw, "entries\t%d\n", stats.Count)
+			_, _ = fmt.Fprintf(tw, "distinct values\t%d\n", stats.DistinctCount)
+			if stats.Min != nil {
+				_, _ = fmt.Fprintf(tw, "min\t%s\n", export.FormatValue(stats.Min))
+				_, _ = fmt.Fprintf(tw, "max\t%s\n", export.FormatValue(stats.Max))
+			}
+			_, _ = fmt.Fprintln(tw)
+			_, _ = fmt.Fprintln(tw, "value\tcount")
+			for _, v := range values {
+				_, _ = fmt.Fprintf(tw, "%s\t%d\n", export.FormatValue(v.Value), v.Count)
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+func init() {
+	keysListCmd.Flags().String("output", "table", "Output format (table, json)")
+	keysStatsCmd.Flags().String("output", "table", "Output format (table, json)")
+	keysStatsCmd.Flags().Int("top", 10, "Number of most frequent values to show, 0 for all")
+	addFilterFlags(keysStatsCmd)
+
+	keysCmd.AddCommand(keysListCmd)
+	keysCmd.AddCommand(keysAddCmd)
+	keysCmd.AddCommand(keysRenameCmd)
+	keysCmd.AddCommand(keysMergeCmd)
+	keysCmd.AddCommand(keysStatsCmd)
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+)
+
+var levelCmd = &cobra.Command{
+	Use:   "level",
+	Short: "Change the level of running loggers",
+	Long: `Store the global level of the loggers writing to the database. Loggers
+started with --watch-level pick it up without restarting.`,
+}
+
+var levelSetCmd = &cobra.Command{
+	Use:   "set <level>",
+	Short: "Set the level of running loggers",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.SetLevel(context.Background(), args[0])
+		cobra.CheckErr(err)
+	},
+}
+
+var levelGetCmd = &cobra.Command{
+	Use:   "get",
+	Short: "Print the level set for running loggers, if any",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		level, err := logWriter.GetLevel(context.Background())
+		cobra.CheckErr(err)
+		if level != "" {
+			fmt.Println(level)
+		}
+	},
+}
+
+var levelClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Let running loggers go back to the level they were started with",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.ClearLevel(context.Background())
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	levelCmd.AddCommand(levelSetCmd)
+	levelCmd.AddCommand(levelGetCmd)
+	levelCmd.AddCommand(levelClearCmd)
+}
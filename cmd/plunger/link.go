@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"strconv"
+)
+
+var linkCmd = &cobra.Command{
+	Use:   "link <from-id> <to-id>",
+	Short: "Record that an entry caused or relates to another entry",
+	Args:  cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		kind, _ := cmd.Flags().GetString("kind")
+		ids, err := parseIDs(args)
+		cobra.CheckErr(err)
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.Link(ids[0], ids[1], kind)
+		cobra.CheckErr(err)
+	},
+}
+
+var linksCmd = &cobra.Command{
+	Use:   "links <id>",
+	Short: "Show an entry along with the entries linked to it",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		depth, _ := cmd.Flags().GetInt("depth")
+		ids, err := parseIDs(args)
+		cobra.CheckErr(err)
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		graph, err := logWriter.GetEntryGraph(context.Background(), ids[0], depth)
+		cobra.CheckErr(err)
+
+		if output == "json" {
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			cobra.CheckErr(encoder.Encode(graph))
+			return
+		}
+		err = printEntries(os.Stdout, graph.Entries, output)
+		cobra.CheckErr(err)
+		_, _ = fmt.Fprintln(os.Stdout)
+		for _, link := range graph.Links {
+			_, _ = fmt.Fprintf(os.Stdout, "%d %s %d\n", link.FromID, link.Kind, link.ToID)
+		}
+	},
+}
+
+func parseIDs(args []string) ([]int, error) {
+	ret := []int{}
+	for _, arg := range args {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, errors.Errorf("invalid id %q", arg)
+		}
+		ret = append(ret, id)
+	}
+	return ret, nil
+}
+
+func init() {
+	linkCmd.Flags().String("kind", pkg.LinkRelates, "Kind of the link, such as causes, retries or relates")
+	linksCmd.Flags().Int("depth", 0, "Only follow this many links away from the entry, 0 for all")
+	linksCmd.Flags().String("output", "table", "Output format (table, json, console)")
+}
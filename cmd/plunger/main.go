@@ -5,6 +5,7 @@ import (
 	clay "github.com/go-go-golems/clay/pkg"
 	"github.com/go-go-golems/plunger/pkg"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog/log"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -20,7 +21,8 @@ var logCmd = &cobra.Command{
 
 		metaKeys, _ := cmd.Flags().GetStringSlice("meta-keys")
 
-		schema := pkg.NewSchema()
+		schema, err := loadSchema()
+		cobra.CheckErr(err)
 
 		for _, metaKey := range metaKeys {
 			schema.MetaKeys.Add(metaKey)
@@ -56,11 +58,19 @@ func initConfigAndLogging(deleteFile bool, schema *pkg.Schema) (*pkg.LogWriter,
 		logLevel = "debug"
 	}
 
-	config := &pkg.LoggerConfig{
-		WithCaller: viper.GetBool("with-caller"),
-		Level:      logLevel,
-		DBFile:     viper.GetString("db"),
-		Schema:     schema,
+	config, err := loggerConfigFromFlags(viper.GetString("db"), schema)
+	cobra.CheckErr(err)
+	config.WithCaller = viper.GetBool("with-caller")
+	config.Level = logLevel
+	config.SessionStrategy, err = pkg.ParseSessionStrategy(viper.GetString("session-strategy"))
+	cobra.CheckErr(err)
+	config.SessionEnvVar = viper.GetString("session-env")
+	config.RecordBuildInfo = viper.GetBool("record-build-info")
+	config.WatchLevel = viper.GetBool("watch-level")
+	config.LevelPollInterval = viper.GetDuration("level-poll-interval")
+	config.DeadLetterFile = viper.GetString("dead-letter-file")
+	config.OnError = func(err error, payload []byte) {
+		_, _ = fmt.Fprintf(os.Stderr, "could not write log entry: %v\n", err)
 	}
 
 	if deleteFile {
@@ -76,14 +86,249 @@ func initConfigAndLogging(deleteFile bool, schema *pkg.Schema) (*pkg.LogWriter,
 	return logWriter, err
 }
 
+// openLogWriter opens the database passed with --db for reading, without
+// redirecting the global logger into it.
+func openLogWriter(opts ...pkg.LogWriterOption) (*pkg.LogWriter, error) {
+	err := clay.InitViper("plunger", rootCmd)
+	if err != nil {
+		return nil, err
+	}
+	return openDBFile(viper.GetString("db"), opts...)
+}
+
+// loadSchema returns the schema passed with --schema, or an empty schema.
+func loadSchema() (*pkg.Schema, error) {
+	path := viper.GetString("schema")
+	if path == "" {
+		return pkg.NewSchema(), nil
+	}
+	return pkg.LoadSchemaFromFile(path)
+}
+
+// loggerConfigFromFlags returns the configuration of the write path set by
+// the flags, for dbFile.
+func loggerConfigFromFlags(dbFile string, schema *pkg.Schema) (*pkg.LoggerConfig, error) {
+	redactMode, err := pkg.ParseRedactMode(viper.GetString("redact-mode"))
+	if err != nil {
+		return nil, err
+	}
+	compression, err := pkg.ParseCompression(viper.GetString("compression"))
+	if err != nil {
+		return nil, err
+	}
+	schemaValidation, err := pkg.ParseSchemaValidation(viper.GetString("schema-validation"))
+	if err != nil {
+		return nil, err
+	}
+	metrics, err := metricsFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	encryptedKeys, err := encryptedKeysFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	normalizeLevels, levelMapping, err := levelMappingFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	enrichFields, err := pkg.ParseEnrichFields(viper.GetStringSlice("enrich-field"))
+	if err != nil {
+		return nil, err
+	}
+	levelRoutes, err := levelRoutesFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	scripts, err := scriptsFromFlags()
+	if err != nil {
+		return nil, err
+	}
+
+	config := &pkg.LoggerConfig{
+		DBFile:               dbFile,
+		Schema:               schema,
+		Enrich:               viper.GetBool("enrich"),
+		EnrichFields:         enrichFields,
+		RedactKeys:           viper.GetStringSlice("redact"),
+		RedactMode:           redactMode,
+		RedactCreditCards:    viper.GetBool("redact-credit-cards"),
+		ConcurrentWrites:     viper.GetBool("concurrent-writes"),
+		BlobThreshold:        viper.GetInt("blob-threshold"),
+		Compression:          compression,
+		CompressionThreshold: viper.GetInt("compression-threshold"),
+		GroupKey:             viper.GetString("group-key"),
+		SchemaValidation:     schemaValidation,
+		Metrics:              metrics,
+		LevelRoutes:          levelRoutes,
+		NormalizeLevels:      normalizeLevels,
+		LevelMapping:         levelMapping,
+		EncryptionKey:        os.Getenv(pkg.EncryptionKeyEnvVar),
+		EncryptedKeys:        encryptedKeys,
+		FieldEncryptionKey:   os.Getenv(pkg.FieldEncryptionKeyEnvVar),
+	}
+	config.WithMiddleware(scripts...)
+	return config, nil
+}
+
+// openDBFile is openLogWriter for the given database rather than --db. The
+// entries written through it, by import or the web ingest endpoint, go
+// through the same write path as the entries logged with the flags.
+func openDBFile(dbFile string, opts ...pkg.LogWriterOption) (*pkg.LogWriter, error) {
+	schema, err := loadSchema()
+	if err != nil {
+		return nil, err
+	}
+	config, err := loggerConfigFromFlags(dbFile, schema)
+	if err != nil {
+		return nil, err
+	}
+	if len(schema.Fields) > 0 {
+		// the ids of the schema file don't have to match an existing database
+		opts = append(opts, pkg.WithSchemaReconciliation(pkg.SchemaReconcileUseDatabase))
+	}
+	return config.OpenLogWriter(opts...)
+}
+
+// metricsFromFlags parses the metrics passed with --metric.
+func metricsFromFlags() ([]pkg.MetricDefinition, error) {
+	ret := []pkg.MetricDefinition{}
+	for _, s := range viper.GetStringSlice("metric") {
+		d, err := pkg.ParseMetricDefinition(s)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, d)
+	}
+	return ret, nil
+}
+
+func levelRoutesFromFlags() ([]pkg.LevelRoute, error) {
+	ret := []pkg.LevelRoute{}
+	for _, s := range viper.GetStringSlice("level-route") {
+		route, err := pkg.ParseLevelRoute(s)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, route)
+	}
+	return ret, nil
+}
+
+// scriptsFromFlags loads the transform scripts passed with --script, followed
+// by the computed fields passed with --script-field.
+func scriptsFromFlags() ([]pkg.Middleware, error) {
+	ret := []pkg.Middleware{}
+	for _, path := range viper.GetStringSlice("script") {
+		script, err := pkg.LoadScript(path)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, pkg.ScriptMiddleware(script))
+	}
+	for _, pair := range viper.GetStringSlice("script-field") {
+		key, script, err := pkg.ParseScriptField(pair)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, pkg.ScriptFieldMiddleware(key, script))
+	}
+	return ret, nil
+}
+
+// levelMappingFromFlags parses the mapping passed with --level-map, which
+// enables level normalization like --normalize-levels.
+func levelMappingFromFlags() (bool, pkg.LevelMapping, error) {
+	pairs := viper.GetStringSlice("level-map")
+	mapping, err := pkg.ParseLevelMapping(pairs)
+	if err != nil {
+		return false, nil, err
+	}
+	return viper.GetBool("normalize-levels") || len(pairs) > 0, mapping, nil
+}
+
+// encryptedKeysFromFlags returns the keys passed with --encrypt-key, which
+// can't be stored without a key to encrypt them with.
+func encryptedKeysFromFlags() ([]string, error) {
+	keys := viper.GetStringSlice("encrypt-key")
+	if len(keys) > 0 && os.Getenv(pkg.FieldEncryptionKeyEnvVar) == "" {
+		return nil, errors.Errorf("--encrypt-key requires %s to be set", pkg.FieldEncryptionKeyEnvVar)
+	}
+	return keys, nil
+}
+
 var rootCmd = &cobra.Command{
 	Use: "plunger",
 }
 
 func init() {
-	rootCmd.PersistentFlags().String("db", "", "Database file")
+	rootCmd.PersistentFlags().String("db", "", "Database file, or postgres:// URL")
+	rootCmd.PersistentFlags().Bool("concurrent-writes", false, "Allow other processes to write to the sqlite file at the same time")
+	rootCmd.PersistentFlags().StringSlice("metric", []string{}, "Roll up the values of a key per minute as they are written (key:counter or key:gauge, optionally :name)")
+	rootCmd.PersistentFlags().Bool("normalize-levels", false, "Normalize levels such as WARNING, ERR or syslog severities to zerolog levels")
+	rootCmd.PersistentFlags().StringSlice("level-map", []string{}, "Additional level normalizations, as from=to (implies --normalize-levels)")
+	rootCmd.PersistentFlags().Bool("enrich", false, "Stamp entries with the hostname, pid and executable of the process")
+	rootCmd.PersistentFlags().StringSlice("enrich-field", []string{}, "Static fields stamped on entries, as key=value (e.g. service=api)")
+	rootCmd.PersistentFlags().StringSlice("level-route", []string{}, "Least severe level stored per component, as component=level, caller:prefix=level or *=level (e.g. db=debug)")
+	rootCmd.PersistentFlags().StringSlice("script", []string{}, "Starlark files transforming entries before they are stored, dropping the entries their main function returns None for")
+	rootCmd.PersistentFlags().StringSlice("script-field", []string{}, "Fields computed by the main function of Starlark files, as key=path (e.g. duration_ms=duration.star)")
+	rootCmd.PersistentFlags().StringSlice("redact", []string{}, "Keys to redact before entries are stored")
+	rootCmd.PersistentFlags().StringSlice("encrypt-key", []string{}, "Keys whose values are encrypted with the key in "+pkg.FieldEncryptionKeyEnvVar)
+	rootCmd.PersistentFlags().String("redact-mode", "redact", "How redacted values are stored (redact, hash, drop)")
+	rootCmd.PersistentFlags().Bool("redact-credit-cards", false, "Redact credit card numbers in string values")
+	rootCmd.PersistentFlags().String("compression", "none", "Compress large blob and JSON values (none, gzip, zstd)")
+	rootCmd.PersistentFlags().Int("compression-threshold", pkg.DefaultCompressionThreshold, "Size in bytes above which values get compressed")
+	rootCmd.PersistentFlags().String("session-strategy", "active", "Session of logged entries (active, ulid, env, host-pid, none)")
+	rootCmd.PersistentFlags().String("session-env", pkg.DefaultSessionEnvVar, "Environment variable holding the session for --session-strategy env")
+	rootCmd.PersistentFlags().String("group-key", "", "Field grouping the entries instead of sessions, such as request_id, stored in an indexed column (see query --group)")
+	rootCmd.PersistentFlags().Bool("record-build-info", false, "Record the go version, module version and git revision of the binary on the session")
+	rootCmd.PersistentFlags().Bool("watch-level", false, "Apply the level set with 'plunger level set' while logging")
+	rootCmd.PersistentFlags().Duration("level-poll-interval", pkg.DefaultLevelPollInterval, "Interval at which --watch-level reads the level")
+	rootCmd.PersistentFlags().String("dead-letter-file", "", "JSONL file collecting the log entries that can't be written, for later import")
+	rootCmd.PersistentFlags().String("schema", "", "YAML or JSON file declaring the meta keys, their types and required fields")
+	rootCmd.PersistentFlags().String("schema-validation", "flag", "What to do with entries violating --schema (none, flag, reject)")
+	rootCmd.PersistentFlags().Int("blob-threshold", 0, "Store blob and JSON values larger than this many bytes in a directory next to the database (0 disables)")
 
 	rootCmd.AddCommand(logCmd)
+	rootCmd.AddCommand(queryCmd)
+	rootCmd.AddCommand(tailCmd)
+	rootCmd.AddCommand(sessionCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(searchCmd)
+	rootCmd.AddCommand(pruneCmd)
+	rootCmd.AddCommand(rollupCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(doctorCmd)
+	rootCmd.AddCommand(webCmd)
+	rootCmd.AddCommand(tuiCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(pipeCmd)
+	rootCmd.AddCommand(runCmd)
+	rootCmd.AddCommand(statsCmd)
+	rootCmd.AddCommand(summarizeCmd)
+	rootCmd.AddCommand(patternsCmd)
+	rootCmd.AddCommand(histogramCmd)
+	rootCmd.AddCommand(migrateCmd)
+	rootCmd.AddCommand(grpcServeCmd)
+	rootCmd.AddCommand(syslogServeCmd)
+	rootCmd.AddCommand(collectCmd)
+	rootCmd.AddCommand(otlpExportCmd)
+	rootCmd.AddCommand(watchCmd)
+	rootCmd.AddCommand(sqlCmd)
+	rootCmd.AddCommand(compactCmd)
+	rootCmd.AddCommand(rotateCmd)
+	rootCmd.AddCommand(mergeCmd)
+	rootCmd.AddCommand(deleteCmd)
+	rootCmd.AddCommand(schemaCmd)
+	rootCmd.AddCommand(keysCmd)
+	rootCmd.AddCommand(traceCmd)
+	rootCmd.AddCommand(linkCmd)
+	rootCmd.AddCommand(linksCmd)
+	rootCmd.AddCommand(artifactsCmd)
+	rootCmd.AddCommand(metricsCmd)
+	rootCmd.AddCommand(spansCmd)
+	rootCmd.AddCommand(levelCmd)
+	rootCmd.AddCommand(indexCmd)
 	logCmd.Flags().Bool("force", false, "Delete the log file before starting")
 	logCmd.Flags().StringSlice("meta-keys", []string{}, "Meta keys")
 }
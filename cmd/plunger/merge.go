@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	clay "github.com/go-go-golems/clay/pkg"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var mergeCmd = &cobra.Command{
+	Use:   "merge <out> <in>...",
+	Short: "Copy the entries and sessions of several databases into one",
+	Long: "Copy the entries and sessions of the input databases into out, which is created\n" +
+		"if needed, for example to collect the logs of several machines.",
+	Args: cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		err := clay.InitViper("plunger", rootCmd)
+		cobra.CheckErr(err)
+
+		out, err := openDBFile(args[0])
+		cobra.CheckErr(err)
+		defer func(out *pkg.LogWriter) {
+			_ = out.Close()
+		}(out)
+
+		for _, dbFile := range args[1:] {
+			in, err := openDBFile(dbFile)
+			cobra.CheckErr(err)
+
+			res, err := out.Merge(context.Background(), in)
+			_ = in.Close()
+			cobra.CheckErr(err)
+			_, _ = fmt.Fprintf(os.Stderr, "%s: merged %d entries, %d new sessions\n", dbFile, res.Entries, res.Sessions)
+		}
+	},
+}
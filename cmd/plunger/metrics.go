@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var metricsCmd = &cobra.Command{
+	Use:   "metrics [name]",
+	Short: "Show the counters and gauges rolled up from the entries",
+	Long: "Show the counters and gauges rolled up per minute from the keys passed with --metric\n" +
+		"as entries were written. Without --step, each metric is summed up over the whole range.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		step, _ := cmd.Flags().GetDuration("step")
+		from, _ := cmd.Flags().GetString("from")
+		to, _ := cmd.Flags().GetString("to")
+
+		query := pkg.MetricsQuery{Step: step}
+		if len(args) > 0 {
+			query.Name = args[0]
+		}
+		now := time.Now()
+		var err error
+		if from != "" {
+			query.From, err = pkg.ParseTime(from, now)
+			cobra.CheckErr(err)
+		}
+		if to != "" {
+			query.To, err = pkg.ParseTime(to, now)
+			cobra.CheckErr(err)
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		points, err := logWriter.GetMetrics(context.Background(), query)
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(points)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "name\tkind\ttime\tcount\tsum\tmin\tavg\tmax\tlast")
+			for _, p := range points {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%g\t%g\t%g\t%g\t%g\n",
+					p.Name, p.Kind, p.Time.Format(time.RFC3339), p.Count, p.Sum, p.Min, p.Avg(), p.Max, p.Last)
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+func init() {
+	metricsCmd.Flags().Duration("step", 0, "Sum the rollups up per step, such as 1m or 1h (default the whole range)")
+	metricsCmd.Flags().String("from", "", "Only show rollups after this time (RFC3339, date, or relative like -1h)")
+	metricsCmd.Flags().String("to", "", "Only show rollups before this time (RFC3339, date, or relative like -1h)")
+	metricsCmd.Flags().String("output", "table", "Output format (table, json)")
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	clay "github.com/go-go-golems/clay/pkg"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var migrateCmd = &cobra.Command{
+	Use:   "migrate",
+	Short: "Upgrade the database schema to the current version",
+	Run: func(cmd *cobra.Command, args []string) {
+		err := clay.InitViper("plunger", rootCmd)
+		cobra.CheckErr(err)
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		// don't use openLogWriter, which would already migrate in Init
+		dbFile := viper.GetString("db")
+		if dbFile == "" {
+			cobra.CheckErr(&pkg.MissingDBFileError{})
+		}
+		store, err := pkg.OpenStore(dbFile)
+		cobra.CheckErr(err)
+		logWriter := pkg.NewLogWriterWithStore(store, pkg.NewSchema())
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx := context.Background()
+		version, err := logWriter.SchemaVersion(ctx)
+		cobra.CheckErr(err)
+		fmt.Printf("Schema version %d (latest %d)\n", version, pkg.LatestSchemaVersion())
+
+		migrations, err := logWriter.Migrate(ctx, pkg.WithDryRun(dryRun))
+		cobra.CheckErr(err)
+		if len(migrations) == 0 {
+			fmt.Println("Up to date")
+			return
+		}
+		verb := "Applied"
+		if dryRun {
+			verb = "Pending"
+		}
+		for _, m := range migrations {
+			fmt.Printf("%s %d: %s\n", verb, m.Version, m.Name)
+		}
+	},
+}
+
+func init() {
+	migrateCmd.Flags().Bool("dry-run", false, "Only list the migrations that would be applied")
+}
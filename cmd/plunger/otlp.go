@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/otlp"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+var otlpExportCmd = &cobra.Command{
+	Use:   "otlp-export",
+	Short: "Push log entries to an OpenTelemetry (OTLP) endpoint",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+
+		endpoint, _ := cmd.Flags().GetString("endpoint")
+		protocol, _ := cmd.Flags().GetString("protocol")
+		headerFlags, _ := cmd.Flags().GetStringArray("header")
+		serviceName, _ := cmd.Flags().GetString("service-name")
+		batchSize, _ := cmd.Flags().GetInt("batch-size")
+		follow, _ := cmd.Flags().GetBool("follow")
+		spans, _ := cmd.Flags().GetBool("spans")
+
+		headers := map[string]string{}
+		for _, h := range headerFlags {
+			k, v, ok := strings.Cut(h, "=")
+			if !ok {
+				cobra.CheckErr(errors.Errorf("invalid --header %q, expected key=value", h))
+			}
+			headers[k] = v
+		}
+
+		exporter, err := otlp.NewExporter(endpoint,
+			otlp.WithProtocol(otlp.Protocol(protocol)),
+			otlp.WithHeaders(headers),
+			otlp.WithServiceName(serviceName),
+			otlp.WithBatchSize(batchSize))
+		cobra.CheckErr(err)
+		defer func(exporter *otlp.Exporter) {
+			_ = exporter.Close()
+		}(exporter)
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		if spans {
+			opts := []pkg.SpanFilterOption{}
+			if filter.Session != "" {
+				opts = append(opts, pkg.WithSpanSession(filter.Session))
+			}
+			records, err := logWriter.GetSpans(ctx, opts...)
+			cobra.CheckErr(err)
+			err = exporter.ExportSpans(ctx, records)
+			cobra.CheckErr(err)
+			exported := 0
+			for _, r := range records {
+				// open spans aren't exported
+				if r.Duration != nil {
+					exported++
+				}
+			}
+			_, _ = fmt.Fprintf(os.Stderr, "exported %d spans\n", exported)
+			return
+		}
+
+		if follow {
+			err = exporter.Follow(ctx, logWriter, filter)
+			cobra.CheckErr(err)
+			return
+		}
+
+		n, err := exporter.ExportEntries(ctx, logWriter, filter)
+		cobra.CheckErr(err)
+		_, _ = fmt.Fprintf(os.Stderr, "exported %d entries\n", n)
+	},
+}
+
+func init() {
+	addFilterFlags(otlpExportCmd)
+	otlpExportCmd.Flags().String("endpoint", "http://localhost:4318", "OTLP endpoint (URL for http/protobuf, host:port for grpc)")
+	otlpExportCmd.Flags().String("protocol", string(otlp.ProtocolHTTP), "OTLP protocol (http/protobuf, grpc)")
+	otlpExportCmd.Flags().StringArray("header", []string{}, "Header sent with each request, as key=value (can be repeated)")
+	otlpExportCmd.Flags().String("service-name", "plunger", "service.name resource attribute")
+	otlpExportCmd.Flags().Int("batch-size", otlp.DefaultBatchSize, "Maximum number of entries per request")
+	otlpExportCmd.Flags().Bool("follow", false, "Keep exporting new entries as they are written")
+	otlpExportCmd.Flags().Bool("spans", false, "Export the timed spans of --session as traces instead of the entries")
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+var patternsCmd = &cobra.Command{
+	Use:   "patterns",
+	Short: "List the most frequent message patterns",
+	Long: "Group the entries matching the filter by the fingerprint of their message, which\n" +
+		"replaces numbers, UUIDs and hex strings with placeholders, and list the patterns\n" +
+		"logged the most, to find the noisiest log lines. Use query 'fingerprint=\"...\"' to\n" +
+		"show the entries of a pattern.",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		output, _ := cmd.Flags().GetString("output")
+		top, _ := cmd.Flags().GetInt("top")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		patterns, err := logWriter.Patterns(cmd.Context(), filter, pkg.WithPatternLimit(top))
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(patterns)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "count\tfirst\tlast\tpattern")
+			for _, p := range patterns {
+				_, _ = fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n",
+					p.Count, p.First.Format(time.RFC3339), p.Last.Format(time.RFC3339), p.Fingerprint)
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+func init() {
+	addFilterFlags(patternsCmd)
+	patternsCmd.Flags().String("output", "table", "Output format (table, json)")
+	patternsCmd.Flags().Int("top", pkg.DefaultPatterns, "Number of patterns listed (0 lists all)")
+}
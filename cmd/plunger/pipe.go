@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"strings"
+)
+
+var pipeCmd = &cobra.Command{
+	Use:   "pipe",
+	Short: "Store the lines piped to stdin",
+	Long: `Store the output of a program piped to plunger, as in
+
+	./server 2>&1 | plunger pipe --db run.db --session mysession --tee
+
+Lines are parsed with --format, lines that can't be parsed are stored as
+messages. Each line is stored as soon as it is read. Once stdin is closed, the
+number of lines, the highest level logged, the end time and whether the pipe
+was interrupted are recorded on the session.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		session, _ := cmd.Flags().GetString("session")
+		tee, _ := cmd.Flags().GetBool("tee")
+		stream, _ := cmd.Flags().GetString("stream")
+
+		parser, err := pkg.LineParserForFormat(format)
+		cobra.CheckErr(err)
+
+		lwOpts := []pkg.LogWriterOption{
+			pkg.WithOnError(func(err error, payload []byte) {
+				_, _ = fmt.Fprintf(os.Stderr, "could not store %q: %v\n", payload, err)
+			}),
+		}
+		if session != "" {
+			lwOpts = append(lwOpts, pkg.WithDefaultSession(session))
+		}
+		logWriter, err := openLogWriter(lwOpts...)
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		opts := []pkg.PipeOption{pkg.WithPipeParser(parser), pkg.WithPipeStream(stream)}
+		if tee {
+			opts = append(opts, pkg.WithPipeTee(os.Stdout))
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		_, err = logWriter.Pipe(ctx, os.Stdin, opts...)
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	pipeCmd.Flags().String("format", "json", "Format of the piped lines ("+strings.Join(pkg.LineParserFormats(), ", ")+")")
+	pipeCmd.Flags().String("session", "", "Session of the stored entries")
+	pipeCmd.Flags().String("stream", pkg.StreamStdout, "Stream stored on the entries, such as stderr when piping 2>&1 >/dev/null, empty for none")
+	pipeCmd.Flags().Bool("tee", false, "Copy stdin to stdout")
+}
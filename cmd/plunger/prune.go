@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/retention"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"strings"
+)
+
+var pruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete log entries according to a retention policy",
+	Run: func(cmd *cobra.Command, args []string) {
+		policy, err := policyFromFlags(cmd)
+		cobra.CheckErr(err)
+		vacuum, _ := cmd.Flags().GetBool("vacuum")
+		if policy.IsEmpty() && !vacuum {
+			cobra.CheckErr(errors.New("no retention limit given"))
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		res, err := logWriter.Prune(policy)
+		cobra.CheckErr(err)
+		fmt.Printf("Deleted %d entries\n", res.DeletedEntries)
+
+		if vacuum {
+			err = logWriter.Vacuum()
+			cobra.CheckErr(err)
+		}
+	},
+}
+
+func policyFromFlags(cmd *cobra.Command) (*retention.Policy, error) {
+	opts := []retention.PolicyOption{}
+
+	if s, _ := cmd.Flags().GetString("max-age"); s != "" {
+		d, err := retention.ParseDuration(s)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, retention.WithMaxAge(d))
+	}
+	if n, _ := cmd.Flags().GetInt("max-entries"); n > 0 {
+		opts = append(opts, retention.WithMaxEntries(n))
+	}
+	if s, _ := cmd.Flags().GetString("max-size"); s != "" {
+		size, err := retention.ParseSize(s)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, retention.WithMaxSize(size))
+	}
+
+	levelMaxAges, _ := cmd.Flags().GetStringArray("level-max-age")
+	for _, s := range levelMaxAges {
+		level, age, ok := strings.Cut(s, "=")
+		if !ok {
+			return nil, errors.Errorf("invalid --level-max-age %q, expected level=duration", s)
+		}
+		d, err := retention.ParseDuration(age)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, retention.WithLevelMaxAge(level, d))
+	}
+
+	return retention.NewPolicy(opts...), nil
+}
+
+func init() {
+	pruneCmd.Flags().String("max-age", "", "Delete entries older than this (e.g. 72h, 30d, 2w)")
+	pruneCmd.Flags().Int("max-entries", 0, "Keep only the most recent entries")
+	pruneCmd.Flags().String("max-size", "", "Delete the oldest entries until the database is smaller than this (e.g. 100MB)")
+	pruneCmd.Flags().StringArray("level-max-age", []string{}, "Per-level maximum age, as level=duration (can be repeated)")
+	pruneCmd.Flags().Bool("vacuum", false, "Run VACUUM afterwards to release the freed space")
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	clay "github.com/go-go-golems/clay/pkg"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var queryCmd = &cobra.Command{
+	Use:   "query [expression]",
+	Short: "Query log entries",
+	Long: "Query log entries, matching the filter flags and an optional expression such as\n\n" +
+		"  plunger query 'level>=warn AND foo=\"bar\" AND baz>10 AND msg~\"timeout\"'\n\n" +
+		"Comparisons (=, !=, <, <=, >, >=, ~ for contains, !~) can be combined with AND, OR,\n" +
+		"NOT and parentheses. level, message, session, id and date refer to the entry columns,\n" +
+		"other keys to meta values.\n\n" +
+		"--db can be repeated to search several databases, such as rotated files, as one.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		if len(args) > 0 {
+			filter.Query = args[0]
+			cobra.CheckErr(filter.Validate())
+		}
+		cobra.CheckErr(paginationFromFlags(cmd, filter))
+		contextLines, _ := cmd.Flags().GetInt("context")
+		filter.ContextBefore, filter.ContextAfter = contextLines, contextLines
+		if cmd.Flags().Changed("before-context") {
+			filter.ContextBefore, _ = cmd.Flags().GetInt("before-context")
+		}
+		if cmd.Flags().Changed("after-context") {
+			filter.ContextAfter, _ = cmd.Flags().GetInt("after-context")
+		}
+		cobra.CheckErr(filter.Validate())
+
+		output, _ := cmd.Flags().GetString("output")
+
+		dbFiles, err := queryDBFiles(cmd)
+		cobra.CheckErr(err)
+		if len(dbFiles) == 1 {
+			logWriter, err := openDBFile(dbFiles[0])
+			cobra.CheckErr(err)
+			defer func(logWriter *pkg.LogWriter) {
+				_ = logWriter.Close()
+			}(logWriter)
+
+			err = printQuery(logWriter, filter, output)
+			cobra.CheckErr(err)
+			return
+		}
+
+		m := pkg.NewMultiReader()
+		defer func(m *pkg.MultiReader) {
+			_ = m.Close()
+		}(m)
+		for _, dbFile := range dbFiles {
+			logWriter, err := openDBFile(dbFile)
+			cobra.CheckErr(err)
+			m.Add(dbFile, logWriter)
+		}
+
+		entries, err := m.GetEntries(filter)
+		cobra.CheckErr(err)
+		err = printEntries(os.Stdout, entries, output)
+		cobra.CheckErr(err)
+	},
+}
+
+// queryDBFiles returns the databases passed to the query command with --db,
+// defaulting to the configured database, along with their rotated files if
+// --rotated is set.
+func queryDBFiles(cmd *cobra.Command) ([]string, error) {
+	if err := clay.InitViper("plunger", rootCmd); err != nil {
+		return nil, err
+	}
+	dbFiles, _ := cmd.Flags().GetStringArray("db")
+	if len(dbFiles) == 0 {
+		dbFiles = []string{viper.GetString("db")}
+	}
+
+	rotated, _ := cmd.Flags().GetBool("rotated")
+	if !rotated {
+		return dbFiles, nil
+	}
+	ret := []string{}
+	for _, dbFile := range dbFiles {
+		if strings.HasPrefix(dbFile, "postgres") {
+			ret = append(ret, dbFile)
+			continue
+		}
+		files, err := pkg.RotationFiles(dbFile)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, files...)
+	}
+	return ret, nil
+}
+
+// printQuery prints the entries matching filter, paginated if filter.Limit is set.
+func printQuery(logWriter *pkg.LogWriter, filter *pkg.GetEntriesFilter, output string) error {
+	if filter.Limit <= 0 {
+		entries, err := logWriter.GetEntries(filter)
+		if err != nil {
+			return err
+		}
+		return printEntries(os.Stdout, entries, output)
+	}
+
+	page, err := logWriter.GetEntriesPage(filter)
+	if err != nil {
+		return err
+	}
+	if err := printEntries(os.Stdout, page.Entries, output); err != nil {
+		return err
+	}
+	if page.NextCursor != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "next page: --cursor %s\n", page.NextCursor)
+	}
+	return nil
+}
+
+// addFilterFlags registers the flags parsed by filterFromFlags.
+func addFilterFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSlice("level", []string{}, "Only show entries with one of these levels")
+	cmd.Flags().String("min-level", "", "Only show entries at least as severe as this level")
+	cmd.Flags().String("session", "", "Only show entries of this session")
+	cmd.Flags().String("session-tree", "", "Only show entries of this session and its child sessions")
+	cmd.Flags().String("group", "", "Only show entries of this group, see --group-key")
+	cmd.Flags().String("from", "", "Only show entries after this time (RFC3339, date, or relative like -1h)")
+	cmd.Flags().String("to", "", "Only show entries before this time (RFC3339, date, or relative like -1h)")
+	cmd.Flags().StringArray("where", []string{}, "Only show entries where meta key=value")
+	cmd.Flags().StringSlice("select", []string{}, "Only show these meta keys")
+	cmd.Flags().String("caller", "", "Only show entries logged from files matching this path (optionally file:line)")
+	cmd.Flags().String("error-contains", "", "Only show entries whose error message contains this text")
+	cmd.Flags().String("trace-id", "", "Only show entries of this trace")
+	cmd.Flags().String("stream", "", "Only show entries captured from this stream (stdout, stderr), or log for the logged entries")
+}
+
+// addPaginationFlags registers the pagination flags parsed by paginationFromFlags.
+func addPaginationFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("limit", 0, "Maximum number of entries to return")
+	cmd.Flags().Int("offset", 0, "Number of matching entries to skip")
+	cmd.Flags().Int("after-id", 0, "Only show entries with an id greater than this")
+	cmd.Flags().String("cursor", "", "Cursor of the next page, as returned by a previous query")
+	cmd.Flags().StringSlice("order-by", []string{}, "Sort entries on these keys (key, key:asc or key:desc), by id by default")
+	cmd.Flags().Int("last", 0, "Only show the last N matching entries written")
+}
+
+func paginationFromFlags(cmd *cobra.Command, filter *pkg.GetEntriesFilter) error {
+	filter.Limit, _ = cmd.Flags().GetInt("limit")
+	filter.Offset, _ = cmd.Flags().GetInt("offset")
+	filter.AfterID, _ = cmd.Flags().GetInt("after-id")
+	filter.Cursor, _ = cmd.Flags().GetString("cursor")
+	filter.Last, _ = cmd.Flags().GetInt("last")
+	orderBy, _ := cmd.Flags().GetStringSlice("order-by")
+	for _, s := range orderBy {
+		o, err := pkg.ParseOrderBy(s)
+		if err != nil {
+			return err
+		}
+		filter.OrderBy = append(filter.OrderBy, o)
+	}
+	return filter.Validate()
+}
+
+func filterFromFlags(cmd *cobra.Command) (*pkg.GetEntriesFilter, error) {
+	spec, err := querySpecFromFlags(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return spec.Filter(time.Now())
+}
+
+// querySpecFromFlags parses the filter flags, keeping relative times as is.
+func querySpecFromFlags(cmd *cobra.Command) (*pkg.QuerySpec, error) {
+	spec := &pkg.QuerySpec{}
+	spec.Levels, _ = cmd.Flags().GetStringSlice("level")
+	spec.MinLevel, _ = cmd.Flags().GetString("min-level")
+	spec.Session, _ = cmd.Flags().GetString("session")
+	spec.SessionTree, _ = cmd.Flags().GetString("session-tree")
+	spec.Group, _ = cmd.Flags().GetString("group")
+	spec.From, _ = cmd.Flags().GetString("from")
+	spec.To, _ = cmd.Flags().GetString("to")
+	spec.SelectedMetaKeys, _ = cmd.Flags().GetStringSlice("select")
+	spec.Caller, _ = cmd.Flags().GetString("caller")
+	spec.ErrorContains, _ = cmd.Flags().GetString("error-contains")
+	spec.TraceID, _ = cmd.Flags().GetString("trace-id")
+	spec.Stream, _ = cmd.Flags().GetString("stream")
+
+	// validate the times now rather than when the query is run
+	for _, s := range []string{spec.From, spec.To} {
+		if s != "" {
+			if _, err := pkg.ParseTime(s, time.Now()); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	wheres, _ := cmd.Flags().GetStringArray("where")
+	if len(wheres) > 0 {
+		spec.MetaFilters = map[string]interface{}{}
+		for _, where := range wheres {
+			k, v, ok := strings.Cut(where, "=")
+			if !ok {
+				return nil, errors.Errorf("invalid --where %q, expected key=value", where)
+			}
+			spec.MetaFilters[k] = parseValueFlag(v)
+		}
+	}
+
+	return spec, nil
+}
+
+// parseValueFlag interprets value as JSON if possible, so that numbers and
+// booleans compare against the right column, and falls back to a string.
+//
+// Numbers are kept as json.Number so that integers compare exactly.
+func parseValueFlag(value string) interface{} {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err == nil && !decoder.More() {
+		return v
+	}
+	return value
+}
+
+func printEntries(w io.Writer, entries []*pkg.LogEntry, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	case "table":
+		return printEntriesTable(w, entries)
+	case "console":
+		f := consoleFormatter(w)
+		for _, entry := range entries {
+			if err := f.Write(w, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return errors.Errorf("unknown output format %q", output)
+	}
+}
+
+// consoleFormatter returns the formatter of the console output format, which
+// only uses colors when writing to a terminal and NO_COLOR is unset.
+func consoleFormatter(w io.Writer) *export.ConsoleFormatter {
+	color := false
+	if f, ok := w.(*os.File); ok && os.Getenv("NO_COLOR") == "" {
+		if fi, err := f.Stat(); err == nil {
+			color = fi.Mode()&os.ModeCharDevice != 0
+		}
+	}
+	return export.NewConsoleFormatter(export.WithConsoleNoColor(!color))
+}
+
+func printEntriesTable(w io.Writer, entries []*pkg.LogEntry) error {
+	columns := export.Columns(entries)
+
+	// entries read from several databases, ids are only unique per database
+	hasSource := false
+	for _, entry := range entries {
+		hasSource = hasSource || entry.Source != ""
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	headers := columns
+	if hasSource {
+		headers = append([]string{"source"}, headers...)
+	}
+	_, _ = fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	for _, entry := range entries {
+		row := []string{}
+		if hasSource {
+			row = append(row, entry.Source)
+		}
+		for _, column := range columns {
+			switch column {
+			case "id":
+				row = append(row, fmt.Sprintf("%d", entry.ID))
+			case "date":
+				row = append(row, entry.Date.Format(time.RFC3339))
+			default:
+				v := export.ColumnValue(entry, column)
+				if v == nil {
+					row = append(row, "")
+					continue
+				}
+				row = append(row, export.FormatValue(v))
+			}
+		}
+		_, _ = fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+
+	return tw.Flush()
+}
+
+func init() {
+	addFilterFlags(queryCmd)
+	addPaginationFlags(queryCmd)
+	queryCmd.Flags().String("output", "table", "Output format (table, json, console)")
+	queryCmd.Flags().IntP("context", "C", 0, "Also show this many entries of the same session around each matching entry")
+	queryCmd.Flags().IntP("before-context", "B", 0, "Also show this many entries of the same session before each matching entry")
+	queryCmd.Flags().IntP("after-context", "A", 0, "Also show this many entries of the same session after each matching entry")
+	// shadows the global --db, so that several databases can be searched as one
+	queryCmd.Flags().StringArray("db", []string{}, "Database files to query, merged by date (can be repeated)")
+	queryCmd.Flags().Bool("rotated", false, "Also query the files rotated from each database")
+
+	queryCmd.AddCommand(querySaveCmd)
+	queryCmd.AddCommand(queryRunCmd)
+	queryCmd.AddCommand(queryListCmd)
+	queryCmd.AddCommand(queryDeleteCmd)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/retention"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+)
+
+var rollupCmd = &cobra.Command{
+	Use:   "rollup",
+	Short: "Replace old log entries with per-hour summaries",
+	Long: `Replace the entries older than --older-than with a summary entry per
+session, level, message and bucket, recording the number of entries it
+replaces in rollup_count. The other meta values of the entries are lost.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		s, _ := cmd.Flags().GetString("older-than")
+		if s == "" {
+			cobra.CheckErr(errors.New("no --older-than given"))
+		}
+		olderThan, err := retention.ParseDuration(s)
+		cobra.CheckErr(err)
+		bucket, _ := cmd.Flags().GetDuration("bucket")
+		level, _ := cmd.Flags().GetString("level")
+		every, _ := cmd.Flags().GetDuration("every")
+		rule := pkg.RollupRule{OlderThan: olderThan, Bucket: bucket, Level: level}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		if every <= 0 {
+			res, err := logWriter.Rollup(rule)
+			cobra.CheckErr(err)
+			fmt.Printf("Rolled up %d entries into %d summaries\n", res.RolledUpEntries, res.SummaryEntries)
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		logWriter.RunRollups(ctx, rule, every, func(err error) {
+			fmt.Fprintf(os.Stderr, "rollup failed: %v\n", err)
+		})
+	},
+}
+
+func init() {
+	rollupCmd.Flags().String("older-than", "", "Roll up entries older than this (e.g. 72h, 30d, 2w)")
+	rollupCmd.Flags().Duration("bucket", pkg.DefaultRollupBucket, "Period summarized by each summary entry")
+	rollupCmd.Flags().String("level", "", "Only roll up entries of this level")
+	rollupCmd.Flags().Duration("every", 0, "Keep running, rolling up entries at this interval")
+}
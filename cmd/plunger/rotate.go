@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	clay "github.com/go-go-golems/clay/pkg"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var rotateCmd = &cobra.Command{
+	Use:   "rotate",
+	Short: "Rotate the sqlite database now",
+	Long: "Rename the database passed with --db after the day its first entry was logged\n" +
+		"(app.db becomes app-2024-05-01.db), and start a fresh one in its place.\n" +
+		"The rotated files are listed in a manifest next to the database.",
+	Run: func(cmd *cobra.Command, args []string) {
+		dbFile, err := rotateDBFile()
+		cobra.CheckErr(err)
+
+		w, err := pkg.NewRotatingWriter(dbFile, pkg.NewSchema(),
+			pkg.WithRotateLogWriterOptions(pkg.WithBlobOffloading(pkg.DefaultBlobDir(dbFile), 0)),
+			pkg.WithOnRotate(func(path string) {
+				_, _ = fmt.Fprintf(os.Stderr, "rotated to %s\n", path)
+			}),
+		)
+		cobra.CheckErr(err)
+		defer func(w *pkg.RotatingWriter) {
+			_ = w.Close()
+		}(w)
+
+		err = w.Rotate()
+		cobra.CheckErr(err)
+	},
+}
+
+var rotateListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the rotated files of the database",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		dbFile, err := rotateDBFile()
+		cobra.CheckErr(err)
+		files, err := pkg.ReadManifest(dbFile)
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(files)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "path\tfrom\tto")
+			for _, f := range files {
+				_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", f.Path, f.From.Format(time.RFC3339), f.To.Format(time.RFC3339))
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+func rotateDBFile() (string, error) {
+	if err := clay.InitViper("plunger", rootCmd); err != nil {
+		return "", err
+	}
+	dbFile := viper.GetString("db")
+	if dbFile == "" {
+		return "", &pkg.MissingDBFileError{}
+	}
+	if strings.HasPrefix(dbFile, "postgres") {
+		return "", errors.New("only sqlite databases can be rotated")
+	}
+	return dbFile, nil
+}
+
+func init() {
+	rotateListCmd.Flags().String("output", "table", "Output format (table, json)")
+
+	rotateCmd.AddCommand(rotateListCmd)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+)
+
+var runCmd = &cobra.Command{
+	Use:   "run -- <command> [args]...",
+	Short: "Run a command and store its output",
+	Long: `Run a command and store the lines it writes to stdout and stderr, as in
+
+	plunger run --db runs.db -- ./flaky-test -v
+
+The output is stored in a new session named after the command, unless
+--session is given, with the stream of each line. The command line, working
+directory and exit code are recorded on the session. Lines are parsed with
+--format, lines that can't be parsed are stored as messages.
+
+The output of the command is still written to stdout and stderr, unless --quiet
+is given, and plunger exits with the exit code of the command.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		format, _ := cmd.Flags().GetString("format")
+		session, _ := cmd.Flags().GetString("session")
+		quiet, _ := cmd.Flags().GetBool("quiet")
+
+		parser, err := pkg.LineParserForFormat(format)
+		cobra.CheckErr(err)
+
+		logWriter, err := openLogWriter(pkg.WithOnError(func(err error, payload []byte) {
+			_, _ = fmt.Fprintf(os.Stderr, "could not store %q: %v\n", payload, err)
+		}))
+		cobra.CheckErr(err)
+
+		opts := []pkg.RunOption{
+			pkg.WithRunParser(parser),
+			pkg.WithRunSession(session),
+		}
+		if !quiet {
+			opts = append(opts, pkg.WithRunStdout(os.Stdout), pkg.WithRunStderr(os.Stderr))
+		}
+
+		// interrupts are handled by the command, whose output is stored until it exits
+		signal.Notify(make(chan os.Signal, 1), os.Interrupt)
+
+		child := exec.Command(args[0], args[1:]...)
+		child.Stdin = os.Stdin
+		res, err := logWriter.Run(context.Background(), child, opts...)
+		_ = logWriter.Close()
+		cobra.CheckErr(err)
+
+		if !quiet {
+			_, _ = fmt.Fprintf(os.Stderr, "output stored in session %s\n", res.Session)
+		}
+		os.Exit(res.ExitCode)
+	},
+}
+
+func init() {
+	runCmd.Flags().String("format", "json", "Format of the output lines ("+strings.Join(pkg.LineParserFormats(), ", ")+")")
+	runCmd.Flags().String("session", "", "Session of the stored output (default: a new session)")
+	runCmd.Flags().BoolP("quiet", "q", false, "Don't copy the output of the command to stdout and stderr")
+}
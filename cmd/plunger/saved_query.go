@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var querySaveCmd = &cobra.Command{
+	Use:   "save <name> [expression]",
+	Short: "Save the given filters as a named query",
+	Long: "Save the given filters and query expression as a named query, stored in the database.\n\n" +
+		"Relative times such as --from -1h are resolved when the query is run.",
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		spec, err := querySpecFromFlags(cmd)
+		cobra.CheckErr(err)
+		if len(args) > 1 {
+			_, err = pkg.ParseQuery(args[1])
+			cobra.CheckErr(err)
+			spec.Query = args[1]
+		}
+		description, _ := cmd.Flags().GetString("description")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.SaveQuery(context.Background(), &pkg.SavedQuery{
+			Name:        args[0],
+			Description: description,
+			Spec:        spec,
+		})
+		cobra.CheckErr(err)
+	},
+}
+
+var queryRunCmd = &cobra.Command{
+	Use:   "run <name>",
+	Short: "Run a saved query",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		query, err := logWriter.GetSavedQuery(context.Background(), args[0])
+		cobra.CheckErr(err)
+		filter, err := query.Spec.Filter(time.Now())
+		cobra.CheckErr(err)
+		cobra.CheckErr(paginationFromFlags(cmd, filter))
+
+		err = printQuery(logWriter, filter, output)
+		cobra.CheckErr(err)
+	},
+}
+
+var queryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List saved queries",
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		queries, err := logWriter.ListSavedQueries(context.Background())
+		cobra.CheckErr(err)
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, "name\tdescription\tfilters")
+		for _, query := range queries {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", query.Name, query.Description, describeQuerySpec(query.Spec))
+		}
+		cobra.CheckErr(tw.Flush())
+	},
+}
+
+var queryDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a saved query",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.DeleteSavedQuery(context.Background(), args[0])
+		cobra.CheckErr(err)
+	},
+}
+
+// describeQuerySpec formats spec as the flags that would recreate it.
+func describeQuerySpec(spec *pkg.QuerySpec) string {
+	flags := []string{}
+	if len(spec.Levels) > 0 {
+		flags = append(flags, "--level "+strings.Join(spec.Levels, ","))
+	}
+	if spec.MinLevel != "" {
+		flags = append(flags, "--min-level "+spec.MinLevel)
+	}
+	if spec.Session != "" {
+		flags = append(flags, "--session "+spec.Session)
+	}
+	if spec.SessionTree != "" {
+		flags = append(flags, "--session-tree "+spec.SessionTree)
+	}
+	if spec.From != "" {
+		flags = append(flags, "--from "+spec.From)
+	}
+	if spec.To != "" {
+		flags = append(flags, "--to "+spec.To)
+	}
+	keys := []string{}
+	for k := range spec.MetaFilters {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		flags = append(flags, fmt.Sprintf("--where %s=%v", k, spec.MetaFilters[k]))
+	}
+	if len(spec.SelectedMetaKeys) > 0 {
+		flags = append(flags, "--select "+strings.Join(spec.SelectedMetaKeys, ","))
+	}
+	if spec.Query != "" {
+		flags = append(flags, strconv.Quote(spec.Query))
+	}
+	return strings.Join(flags, " ")
+}
+
+func init() {
+	addFilterFlags(querySaveCmd)
+	querySaveCmd.Flags().String("description", "", "Description of the query")
+
+	addPaginationFlags(queryRunCmd)
+	queryRunCmd.Flags().String("output", "table", "Output format (table, json, console)")
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"text/tabwriter"
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Inspect and manage the meta keys of the database",
+}
+
+var schemaSuggestCmd = &cobra.Command{
+	Use:   "suggest",
+	Short: "List the most frequent ad-hoc keys, which could be promoted to meta keys",
+	Long: "List the keys that aren't meta keys, by number of stored values. With --promote,\n" +
+		"the listed keys are registered as meta keys and the existing values rewritten.",
+	Run: func(cmd *cobra.Command, args []string) {
+		top, _ := cmd.Flags().GetInt("top")
+		minCount, _ := cmd.Flags().GetInt("min-count")
+		promote, _ := cmd.Flags().GetBool("promote")
+		output, _ := cmd.Flags().GetString("output")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx := context.Background()
+		suggestions, err := logWriter.SuggestMetaKeys(ctx, top, minCount)
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(suggestions)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "key\tvalues")
+			for _, s := range suggestions {
+				_, _ = fmt.Fprintf(tw, "%s\t%d\n", s.Name, s.Count)
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+
+		if promote && len(suggestions) > 0 {
+			names := []string{}
+			for _, s := range suggestions {
+				names = append(names, s.Name)
+			}
+			n, err := logWriter.PromoteMetaKeys(ctx, names...)
+			cobra.CheckErr(err)
+			_, _ = fmt.Fprintf(os.Stderr, "promoted %d keys, rewrote %d values\n", len(names), n)
+		}
+	},
+}
+
+func init() {
+	schemaSuggestCmd.Flags().Int("top", 10, "Number of keys to list (0 for all)")
+	schemaSuggestCmd.Flags().Int("min-count", 1, "Only list keys with at least this many values")
+	schemaSuggestCmd.Flags().Bool("promote", false, "Promote the listed keys to meta keys")
+	schemaSuggestCmd.Flags().String("output", "table", "Output format (table, json)")
+
+	schemaCmd.AddCommand(schemaSuggestCmd)
+}
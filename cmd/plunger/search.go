@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+)
+
+var searchCmd = &cobra.Command{
+	Use:   "search <terms>...",
+	Short: "Search log entries using the full-text index",
+	Long: "Search log entries using the full-text index.\n\n" +
+		"The index is created on first use, and requires plunger to be built with -tags sqlite_fts5.",
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		cobra.CheckErr(paginationFromFlags(cmd, filter))
+		filter.Search = strings.Join(args, " ")
+
+		output, _ := cmd.Flags().GetString("output")
+		rebuild, _ := cmd.Flags().GetBool("rebuild-index")
+
+		logWriter, err := openLogWriter(pkg.WithFullTextSearch(true))
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		if rebuild {
+			err = logWriter.RebuildSearchIndex()
+			cobra.CheckErr(err)
+		}
+
+		entries, err := logWriter.GetEntries(filter)
+		cobra.CheckErr(err)
+
+		err = printEntries(os.Stdout, entries, output)
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	addFilterFlags(searchCmd)
+	addPaginationFlags(searchCmd)
+	searchCmd.Flags().String("output", "table", "Output format (table, json, console)")
+	searchCmd.Flags().Bool("rebuild-index", false, "Rebuild the full-text index before searching")
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var sessionCmd = &cobra.Command{
+	Use:   "session",
+	Short: "Manage logging sessions",
+}
+
+var sessionNewCmd = &cobra.Command{
+	Use:   "new [name]",
+	Short: "Create a new session",
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		name := ""
+		if len(args) > 0 {
+			name = args[0]
+		}
+
+		metaFlags, _ := cmd.Flags().GetStringArray("meta")
+		metadata := map[string]interface{}{}
+		for _, meta := range metaFlags {
+			k, v, ok := strings.Cut(meta, "=")
+			if !ok {
+				cobra.CheckErr(errors.Errorf("invalid --meta %q, expected key=value", meta))
+			}
+			metadata[k] = parseValueFlag(v)
+		}
+
+		activate, _ := cmd.Flags().GetBool("activate")
+		parent, _ := cmd.Flags().GetString("parent")
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		sessions := logWriter.Sessions()
+		var session *pkg.Session
+		if parent != "" {
+			session, err = sessions.NewChildSession(parent, name, metadata, pkg.WithSessionTags(tags...))
+		} else {
+			session, err = sessions.NewSession(name, metadata, pkg.WithSessionTags(tags...))
+		}
+		cobra.CheckErr(err)
+
+		if activate {
+			err = sessions.SetActive(session.ID)
+			cobra.CheckErr(err)
+		}
+
+		fmt.Println(session.ID)
+	},
+}
+
+var sessionSetActiveCmd = &cobra.Command{
+	Use:   "set-active <id>",
+	Short: "Mark a session as active, so that it gets continued by the next logger",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.Sessions().SetActive(args[0])
+		cobra.CheckErr(err)
+	},
+}
+
+var sessionStartCmd = &cobra.Command{
+	Use:   "start <id>",
+	Short: "Record that a new run of a session starts now",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.Sessions().StartSession(args[0])
+		cobra.CheckErr(err)
+	},
+}
+
+var sessionEndCmd = &cobra.Command{
+	Use:   "end <id>",
+	Short: "Record that the run of a session ended now",
+	Long: `Record that the run of a session ended now, along with its exit code, as in
+
+	plunger session end "$SESSION" --exit-code $?`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := []pkg.SessionEndOption{}
+		if cmd.Flags().Changed("exit-code") {
+			exitCode, _ := cmd.Flags().GetInt("exit-code")
+			opts = append(opts, pkg.WithExitCode(exitCode))
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		err = logWriter.Sessions().EndSession(args[0], opts...)
+		cobra.CheckErr(err)
+	},
+}
+
+var sessionListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List sessions with their entry counts and time ranges",
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		tags, _ := cmd.Flags().GetStringSlice("tag")
+		filterOpts := []pkg.SessionFilterOption{pkg.WithSessionFilterTags(tags...)}
+		wheres, _ := cmd.Flags().GetStringArray("where")
+		for _, where := range wheres {
+			k, v, ok := strings.Cut(where, "=")
+			if !ok {
+				cobra.CheckErr(errors.Errorf("invalid --where %q, expected key=value", where))
+			}
+			filterOpts = append(filterOpts, pkg.WithSessionFilterMetadata(k, parseValueFlag(v)))
+		}
+		if failed, _ := cmd.Flags().GetBool("failed"); failed {
+			filterOpts = append(filterOpts, pkg.WithSessionFilterFailed())
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		summaries, err := logWriter.Sessions().ListSessions(filterOpts...)
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(summaries)
+			cobra.CheckErr(err)
+		case "table", "tree":
+			depths := map[string]int{}
+			if output == "tree" {
+				summaries, depths = sessionTree(summaries)
+			}
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			_, _ = fmt.Fprintln(tw, "active\tid\tname\ttags\tentries\tfrom\tto\texit\tduration")
+			for _, summary := range summaries {
+				active := ""
+				if summary.Active {
+					active = "*"
+				}
+				exitCode, duration := "", ""
+				if summary.ExitCode != nil {
+					exitCode = fmt.Sprint(*summary.ExitCode)
+				}
+				if summary.Duration != nil {
+					duration = summary.Duration.Round(time.Millisecond).String()
+				}
+				_, _ = fmt.Fprintf(tw, "%s\t%s%s\t%s\t%s\t%d\t%s\t%s\t%s\t%s\n",
+					active, strings.Repeat("  ", depths[summary.ID]), summary.ID, summary.Name,
+					strings.Join(summary.Tags, ","), summary.EntryCount,
+					formatTimePtr(summary.From), formatTimePtr(summary.To), exitCode, duration)
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+var sessionTagCmd = &cobra.Command{
+	Use:   "tag <id> <tag>...",
+	Short: "Add tags to a session",
+	Args:  cobra.MinimumNArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		remove, _ := cmd.Flags().GetBool("remove")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		if remove {
+			err = logWriter.Sessions().RemoveTags(args[0], args[1:]...)
+		} else {
+			err = logWriter.Sessions().AddTags(args[0], args[1:]...)
+		}
+		cobra.CheckErr(err)
+	},
+}
+
+// sessionTree orders summaries depth-first, children following their parent,
+// and returns the depth of each session. Sessions whose parent is unknown are
+// listed as roots.
+func sessionTree(summaries []*pkg.SessionSummary) ([]*pkg.SessionSummary, map[string]int) {
+	known := map[string]bool{}
+	for _, summary := range summaries {
+		known[summary.ID] = true
+	}
+	roots := []*pkg.SessionSummary{}
+	children := map[string][]*pkg.SessionSummary{}
+	for _, summary := range summaries {
+		if summary.ParentID != "" && known[summary.ParentID] {
+			children[summary.ParentID] = append(children[summary.ParentID], summary)
+		} else {
+			roots = append(roots, summary)
+		}
+	}
+
+	ret := []*pkg.SessionSummary{}
+	depths := map[string]int{}
+	var walk func(summary *pkg.SessionSummary, depth int)
+	walk = func(summary *pkg.SessionSummary, depth int) {
+		ret = append(ret, summary)
+		depths[summary.ID] = depth
+		for _, child := range children[summary.ID] {
+			walk(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		walk(root, 0)
+	}
+	return ret, depths
+}
+
+var sessionDiffCmd = &cobra.Command{
+	Use:   "diff <a> <b>",
+	Short: "Compare two sessions, such as a passing and a failing run",
+	Long: `Compare the sessions a and b: the number of entries of each level, the error
+messages only logged in one of them, the messages whose time relative to the
+start of the session differs the most, and the metadata that differs.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		timings, _ := cmd.Flags().GetInt("timings")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		diff, err := logWriter.DiffSessions(cmd.Context(), args[0], args[1], pkg.WithDiffTimings(timings))
+		cobra.CheckErr(err)
+
+		switch output {
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(diff)
+		case "text":
+			err = printSessionDiff(diff)
+		default:
+			err = errors.Errorf("unknown output format %q", output)
+		}
+		cobra.CheckErr(err)
+	},
+}
+
+// printSessionDiff renders diff as a report.
+func printSessionDiff(diff *pkg.SessionDiff) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintf(tw, "a:\t%s\t%s\n", diff.A.ID, diff.A.Name)
+	_, _ = fmt.Fprintf(tw, "b:\t%s\t%s\n", diff.B.ID, diff.B.Name)
+
+	_, _ = fmt.Fprintln(tw, "\nlevel\ta\tb\tdelta")
+	for _, level := range diff.Levels {
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%+d\n", level.Level, level.A, level.B, level.B-level.A)
+	}
+
+	for _, section := range []struct {
+		title    string
+		messages []pkg.MessageCount
+	}{
+		{"new errors in b", diff.NewErrors},
+		{"errors only in a", diff.ResolvedErrors},
+	} {
+		if len(section.messages) == 0 {
+			continue
+		}
+		_, _ = fmt.Fprintf(tw, "\n%s\tcount\n", section.title)
+		for _, m := range section.messages {
+			_, _ = fmt.Fprintf(tw, "%s\t%d\n", m.Message, m.Count)
+		}
+	}
+
+	if len(diff.Timings) > 0 {
+		_, _ = fmt.Fprintln(tw, "\nfirst logged\ta\tb\tdelta")
+		for _, timing := range diff.Timings {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", timing.Message,
+				timing.A.Round(time.Millisecond), timing.B.Round(time.Millisecond), formatDelta(timing.Delta))
+		}
+	}
+
+	if len(diff.Metadata) > 0 {
+		_, _ = fmt.Fprintln(tw, "\nmetadata\ta\tb")
+		for _, m := range diff.Metadata {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\n", m.Key, formatDiffValue(m.A), formatDiffValue(m.B))
+		}
+	}
+	return tw.Flush()
+}
+
+func formatDelta(d time.Duration) string {
+	d = d.Round(time.Millisecond)
+	if d >= 0 {
+		return "+" + d.String()
+	}
+	return d.String()
+}
+
+func formatDiffValue(v interface{}) string {
+	if v == nil {
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
+
+func formatTimePtr(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func init() {
+	sessionNewCmd.Flags().StringArray("meta", []string{}, "Session metadata as key=value")
+	sessionNewCmd.Flags().Bool("activate", false, "Mark the new session as active")
+	sessionNewCmd.Flags().String("parent", "", "Create the session as a child of this session")
+	sessionNewCmd.Flags().StringSlice("tag", []string{}, "Tags of the session")
+	sessionListCmd.Flags().String("output", "table", "Output format (table, tree, json)")
+	sessionListCmd.Flags().StringSlice("tag", []string{}, "Only list sessions with all of these tags")
+	sessionListCmd.Flags().StringArray("where", []string{}, "Only list sessions where metadata key=value")
+	sessionListCmd.Flags().Bool("failed", false, "Only list sessions whose last run exited with a non-zero code")
+	sessionDiffCmd.Flags().String("output", "text", "Output format (text, json)")
+	sessionDiffCmd.Flags().Int("timings", pkg.DefaultDiffTimings, "Number of timing differences to show")
+	sessionEndCmd.Flags().Int("exit-code", 0, "Exit code of the run (default: unknown)")
+	sessionTagCmd.Flags().Bool("remove", false, "Remove the tags instead")
+
+	sessionCmd.AddCommand(sessionNewCmd)
+	sessionCmd.AddCommand(sessionSetActiveCmd)
+	sessionCmd.AddCommand(sessionStartCmd)
+	sessionCmd.AddCommand(sessionEndCmd)
+	sessionCmd.AddCommand(sessionListCmd)
+	sessionCmd.AddCommand(sessionTagCmd)
+	sessionCmd.AddCommand(sessionDiffCmd)
+	sessionCmd.AddCommand(sessionDeleteCmd)
+}
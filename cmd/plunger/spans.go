@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var spansCmd = &cobra.Command{
+	Use:   "spans [session]",
+	Short: "Show the durations of the timed spans",
+	Long: "Sum up the durations of the spans started and ended by the " + pkg.SpanStartKey + " and " +
+		pkg.SpanEndKey + "\nfields of the entries, per name, the longest total first. With --list, each span is\n" +
+		"listed in the order it started, nested in its parent span.\n\n" +
+		"--output chrome writes the spans as a Chrome trace, to open in Perfetto\n" +
+		"(https://ui.perfetto.dev) or chrome://tracing. Use otlp-export --spans to send them to\n" +
+		"an OpenTelemetry collector or Jaeger instead.",
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		name, _ := cmd.Flags().GetString("name")
+		list, _ := cmd.Flags().GetBool("list")
+
+		opts := []pkg.SpanFilterOption{pkg.WithSpanName(name)}
+		if len(args) > 0 {
+			opts = append(opts, pkg.WithSpanSession(args[0]))
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		var result interface{}
+		if list || output == "chrome" {
+			result, err = logWriter.GetSpans(context.Background(), opts...)
+		} else {
+			result, err = logWriter.GetSpanStats(context.Background(), opts...)
+		}
+		cobra.CheckErr(err)
+
+		switch output {
+		case "chrome":
+			err = pkg.WriteChromeTrace(os.Stdout, result.([]*pkg.SpanRecord))
+			cobra.CheckErr(err)
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(result)
+			cobra.CheckErr(err)
+		case "table":
+			tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			switch result := result.(type) {
+			case []*pkg.SpanRecord:
+				printSpans(tw, result)
+			case []*pkg.SpanStats:
+				_, _ = fmt.Fprintln(tw, "name\tcount\topen\ttotal\tmin\tavg\tmax")
+				for _, s := range result {
+					_, _ = fmt.Fprintf(tw, "%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+						s.Name, s.Count, s.Open, formatSpanDuration(s.Total), formatSpanDuration(s.Min),
+						formatSpanDuration(s.Avg()), formatSpanDuration(s.Max))
+				}
+			}
+			err = tw.Flush()
+			cobra.CheckErr(err)
+		default:
+			cobra.CheckErr(errors.Errorf("unknown output format %q", output))
+		}
+	},
+}
+
+// printSpans lists spans indented by their depth below their parent spans.
+func printSpans(tw *tabwriter.Writer, spans []*pkg.SpanRecord) {
+	depths := map[int]int{}
+	_, _ = fmt.Fprintln(tw, "name\tsession\tstarted\tduration")
+	for _, s := range spans {
+		depth := 0
+		if s.ParentID != nil {
+			if d, ok := depths[*s.ParentID]; ok {
+				depth = d + 1
+			}
+		}
+		depths[s.ID] = depth
+
+		session := ""
+		if s.SessionID != nil {
+			session = *s.SessionID
+		}
+		duration := "open"
+		if s.Duration != nil {
+			duration = formatSpanDuration(*s.Duration)
+		}
+		_, _ = fmt.Fprintf(tw, "%s%s\t%s\t%s\t%s\n",
+			strings.Repeat("  ", depth), s.Name, session, s.StartedAt.Format(time.RFC3339Nano), duration)
+	}
+}
+
+func formatSpanDuration(d time.Duration) string {
+	switch {
+	case d >= time.Second:
+		return d.Round(time.Millisecond).String()
+	case d >= time.Millisecond:
+		return d.Round(time.Microsecond).String()
+	default:
+		return d.String()
+	}
+}
+
+func init() {
+	spansCmd.Flags().String("name", "", "Only show the spans of this name")
+	spansCmd.Flags().Bool("list", false, "List the spans instead of summing up their durations")
+	spansCmd.Flags().String("output", "table", "Output format (table, json, chrome)")
+}
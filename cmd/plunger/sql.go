@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+var sqlCmd = &cobra.Command{
+	Use:   "sql <query> [arg]...",
+	Short: "Run a SQL query against the database",
+	Long: "Run a SQL query against the database, binding the remaining arguments to its ? placeholders.\n\n" +
+		"With --entries, the query has to return rows of log_entries (at least their id), which are\n" +
+		"printed like the output of plunger query, along with their meta values.\n\n" +
+		"Changes made by the query are rolled back.",
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		asEntries, _ := cmd.Flags().GetBool("entries")
+
+		queryArgs := []interface{}{}
+		for _, arg := range args[1:] {
+			v := parseValueFlag(arg)
+			if n, ok := v.(json.Number); ok {
+				if i, err := n.Int64(); err == nil {
+					v = i
+				} else if f, err := n.Float64(); err == nil {
+					v = f
+				}
+			}
+			queryArgs = append(queryArgs, v)
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx := context.Background()
+		if asEntries {
+			entries, err := logWriter.QueryEntriesSQLContext(ctx, args[0], queryArgs...)
+			cobra.CheckErr(err)
+			err = printEntries(os.Stdout, entries, output)
+			cobra.CheckErr(err)
+			return
+		}
+
+		res, err := logWriter.QuerySQL(ctx, args[0], queryArgs...)
+		cobra.CheckErr(err)
+		err = printSQLResult(os.Stdout, res, output)
+		cobra.CheckErr(err)
+	},
+}
+
+func printSQLResult(w io.Writer, res *pkg.SQLResult, output string) error {
+	switch output {
+	case "json":
+		rows := []map[string]interface{}{}
+		for _, row := range res.Rows {
+			m := map[string]interface{}{}
+			for i, column := range res.Columns {
+				m[column] = row[i]
+			}
+			rows = append(rows, m)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(rows)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		_, _ = fmt.Fprintln(tw, strings.Join(res.Columns, "\t"))
+		for _, row := range res.Rows {
+			values := []string{}
+			for _, v := range row {
+				values = append(values, export.FormatValue(v))
+			}
+			_, _ = fmt.Fprintln(tw, strings.Join(values, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return errors.Errorf("unknown output format %q", output)
+	}
+}
+
+func init() {
+	sqlCmd.Flags().String("output", "table", "Output format (table, json)")
+	sqlCmd.Flags().Bool("entries", false, "Map the returned rows to log entries")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+var statsCmd = &cobra.Command{
+	Use:   "stats",
+	Short: "Print entry counts per level, session and hour",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		output, _ := cmd.Flags().GetString("output")
+		keys, _ := cmd.Flags().GetStringSlice("key")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		sections, err := logWriter.Stats(filter, keys...)
+		cobra.CheckErr(err)
+
+		err = printStats(os.Stdout, sections, output)
+		cobra.CheckErr(err)
+	},
+}
+
+func printStats(w io.Writer, sections []*pkg.StatsSection, output string) error {
+	switch output {
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(sections)
+	case "table":
+	default:
+		return errors.Errorf("unknown output format %q", output)
+	}
+
+	for i, section := range sections {
+		if i > 0 {
+			_, _ = fmt.Fprintln(w)
+		}
+		_, _ = fmt.Fprintln(w, section.Title)
+
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		for _, row := range section.Rows {
+			cells := []string{}
+			for _, key := range section.Keys {
+				cells = append(cells, formatStatsValue(row.Group[key]))
+			}
+			if len(section.Keys) > 0 {
+				cell := fmt.Sprintf("%d", row.Count())
+				if sampled := row.Total() - row.Count(); sampled > 0 {
+					cell += fmt.Sprintf(" (+%d sampled out)", sampled)
+				}
+				cells = append(cells, cell)
+			} else {
+				for _, name := range sortedValueNames(row) {
+					cells = append(cells, name+"="+formatStatsValue(row.Values[name]))
+				}
+			}
+			_, _ = fmt.Fprintln(tw, "  "+strings.Join(cells, "\t"))
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sortedValueNames lists the count first, followed by the other values in alphabetical order.
+func sortedValueNames(row *pkg.AggregateRow) []string {
+	names := []string{}
+	for name := range row.Values {
+		if name != "count" && name != "total" {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{"count"}, names...)
+}
+
+func formatStatsValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "-"
+	case time.Time:
+		return v.Local().Format("2006-01-02 15:04")
+	case float64:
+		return fmt.Sprintf("%g", v)
+	default:
+		return export.FormatValue(v)
+	}
+}
+
+func init() {
+	addFilterFlags(statsCmd)
+	statsCmd.Flags().String("output", "table", "Output format (table, json)")
+	statsCmd.Flags().StringSlice("key", []string{}, "Numeric meta keys to compute min/max/avg/sum of")
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var summarizeCmd = &cobra.Command{
+	Use:   "summarize",
+	Short: "Sum up the errors and warnings of the entries, for CI",
+	Long: "Print a compact summary of the entries matching the filter: the error and warning\n" +
+		"counts, the most frequent error messages, and, with --session, the spans that didn't\n" +
+		"end or logged errors. The markdown format can be posted as a pull request comment or\n" +
+		"appended to $GITHUB_STEP_SUMMARY.",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		format, _ := cmd.Flags().GetString("format")
+		topErrors, _ := cmd.Flags().GetInt("top-errors")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		summary, err := logWriter.Summarize(cmd.Context(), filter, pkg.WithSummaryErrors(topErrors))
+		cobra.CheckErr(err)
+
+		switch format {
+		case "markdown":
+			err = summary.WriteMarkdown(os.Stdout)
+		case "json":
+			encoder := json.NewEncoder(os.Stdout)
+			encoder.SetIndent("", "  ")
+			err = encoder.Encode(summary)
+		default:
+			err = errors.Errorf("unknown format %q", format)
+		}
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	addFilterFlags(summarizeCmd)
+	summarizeCmd.Flags().String("format", "markdown", "Output format (markdown, json)")
+	summarizeCmd.Flags().Int("top-errors", pkg.DefaultSummaryErrors, "Number of error messages listed")
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"net"
+	"os"
+	"os/signal"
+)
+
+var syslogServeCmd = &cobra.Command{
+	Use:   "syslog-serve",
+	Short: "Receive syslog messages over UDP or TCP and store them",
+	Long: `Receive RFC5424 and RFC3164 syslog messages, so that network devices
+and daemons can log into the database. The severity is stored as the level,
+and the facility, hostname, app name, process id and message id as meta
+values. TCP messages are either prefixed with their length or terminated by a
+newline.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		udpAddr, _ := cmd.Flags().GetString("udp")
+		tcpAddr, _ := cmd.Flags().GetString("tcp")
+		if udpAddr == "" && tcpAddr == "" {
+			cobra.CheckErr(errors.New("no --udp or --tcp address given"))
+		}
+
+		logWriter, err := openLogWriter(pkg.WithOnError(func(err error, payload []byte) {
+			_, _ = fmt.Fprintf(os.Stderr, "could not store syslog message %q: %v\n", payload, err)
+		}))
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		errs := make(chan error, 2)
+		servers := 0
+		if udpAddr != "" {
+			conn, err := net.ListenPacket("udp", udpAddr)
+			cobra.CheckErr(err)
+			log.Info().Str("addr", udpAddr).Msg("receiving syslog over UDP")
+			servers++
+			go func() {
+				errs <- logWriter.ServeSyslogUDP(ctx, conn)
+			}()
+		}
+		if tcpAddr != "" {
+			listener, err := net.Listen("tcp", tcpAddr)
+			cobra.CheckErr(err)
+			log.Info().Str("addr", tcpAddr).Msg("receiving syslog over TCP")
+			servers++
+			go func() {
+				errs <- logWriter.ServeSyslogTCP(ctx, listener)
+			}()
+		}
+
+		for i := 0; i < servers; i++ {
+			if err := <-errs; err != nil {
+				stop()
+				cobra.CheckErr(err)
+			}
+		}
+	},
+}
+
+func init() {
+	syslogServeCmd.Flags().String("udp", "localhost:5514", "UDP address to listen on, empty to disable")
+	syslogServeCmd.Flags().String("tcp", "", "TCP address to listen on, empty to disable")
+}
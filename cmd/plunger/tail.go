@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"io"
+	"os"
+	"os/signal"
+)
+
+var tailCmd = &cobra.Command{
+	Use:   "tail",
+	Short: "Show the last log entries, optionally following new ones",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+
+		follow, _ := cmd.Flags().GetBool("follow")
+		lines, _ := cmd.Flags().GetInt("lines")
+		output, _ := cmd.Flags().GetString("output")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		// Remember where the database was before querying, so that following
+		// starts right after what we printed.
+		lastID, err := logWriter.LastEntryID()
+		cobra.CheckErr(err)
+
+		entries := []*pkg.LogEntry{}
+		if lines != 0 {
+			backlog := *filter
+			if lines > 0 {
+				backlog.Last = lines
+			}
+			entries, err = logWriter.GetEntries(&backlog)
+			cobra.CheckErr(err)
+		}
+		for _, entry := range entries {
+			err = printEntryLine(os.Stdout, entry, output)
+			cobra.CheckErr(err)
+			if entry.ID > lastID {
+				lastID = entry.ID
+			}
+		}
+
+		if !follow {
+			return
+		}
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		filter.AfterID = lastID
+		ch, err := logWriter.Follow(ctx, filter)
+		cobra.CheckErr(err)
+
+		for entry := range ch {
+			err = printEntryLine(os.Stdout, entry, output)
+			cobra.CheckErr(err)
+		}
+	},
+}
+
+// printEntryLine prints a single entry on one line, which is suitable for streaming.
+func printEntryLine(w io.Writer, entry *pkg.LogEntry, output string) error {
+	switch output {
+	case "json":
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(w, string(b))
+		return err
+	case "text":
+		_, err := fmt.Fprintln(w, export.FormatEntryLine(entry))
+		return err
+	case "console":
+		return consoleFormatter(w).Write(w, entry)
+	default:
+		return errors.Errorf("unknown output format %q", output)
+	}
+}
+
+func init() {
+	addFilterFlags(tailCmd)
+	tailCmd.Flags().BoolP("follow", "f", false, "Keep streaming new entries as they are written")
+	tailCmd.Flags().IntP("lines", "n", 10, "Number of entries to show initially (-1 for all)")
+	tailCmd.Flags().String("output", "text", "Output format (text, json, console)")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/spf13/cobra"
+	"os"
+)
+
+var traceCmd = &cobra.Command{
+	Use:   "trace <id>",
+	Short: "Show the entries of a trace across all sessions, ordered by date",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		entries, err := logWriter.GetTrace(context.Background(), args[0])
+		cobra.CheckErr(err)
+
+		err = printEntries(os.Stdout, entries, output)
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	traceCmd.Flags().String("output", "table", "Output format (table, json, console)")
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/tui"
+	"github.com/spf13/cobra"
+)
+
+var tuiCmd = &cobra.Command{
+	Use:   "tui",
+	Short: "Browse log entries interactively",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+		maxEntries, _ := cmd.Flags().GetInt("max-entries")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		model := tui.NewModel(logWriter, tui.WithFilter(filter), tui.WithMaxEntries(maxEntries))
+		_, err = tea.NewProgram(model, tea.WithAltScreen()).Run()
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	addFilterFlags(tuiCmd)
+	tuiCmd.Flags().Int("max-entries", tui.DefaultMaxEntries, "Number of most recent entries to load")
+}
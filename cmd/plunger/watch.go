@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/alert"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"os"
+	"os/signal"
+	"time"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Evaluate alerting rules on new log entries",
+	Long: "Evaluate the alerting rules of a YAML file on the entries written to the database,\n" +
+		"running their actions (exec, webhook, table) when they trigger.\n\n" +
+		"With --stall-after, the sessions that stop logging heartbeats (entries with one of the\n" +
+		"--heartbeat-key keys) for that long before their run ended are reported as stalled.",
+	Run: func(cmd *cobra.Command, args []string) {
+		filter, err := filterFromFlags(cmd)
+		cobra.CheckErr(err)
+
+		rules, _ := cmd.Flags().GetString("rules")
+		stallAfter, _ := cmd.Flags().GetDuration("stall-after")
+		heartbeatKeys, _ := cmd.Flags().GetStringSlice("heartbeat-key")
+		if rules == "" && stallAfter <= 0 {
+			cobra.CheckErr(errors.New("--rules or --stall-after is required"))
+		}
+		var config *alert.Config
+		if rules != "" {
+			config, err = alert.LoadConfig(rules)
+			cobra.CheckErr(err)
+		}
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+
+		stalls := make(chan error, 1)
+		if stallAfter > 0 {
+			go func() {
+				stalls <- logWriter.WatchStalls(ctx, filter, func(hb *pkg.SessionHeartbeat) {
+					fmt.Printf("session %s stalled: last heartbeat at %s (%s ago)\n",
+						hb.Session, hb.Last.Format(time.RFC3339), time.Since(hb.Last).Round(time.Second))
+				}, pkg.WithStallAfter(stallAfter), pkg.WithHeartbeatKeys(heartbeatKeys...))
+				stop()
+			}()
+		} else {
+			close(stalls)
+		}
+
+		if config != nil {
+			engine := alert.NewEngine(config, alert.WithLogWriter(logWriter))
+			err = engine.Watch(ctx, logWriter, filter)
+			cobra.CheckErr(err)
+		}
+		err = <-stalls
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	addFilterFlags(watchCmd)
+	watchCmd.Flags().String("rules", "", "YAML file with the alerting rules")
+	watchCmd.Flags().Duration("stall-after", 0, "Report the sessions that logged no heartbeat for this long, such as 5m")
+	watchCmd.Flags().StringSlice("heartbeat-key", pkg.DefaultHeartbeatKeys, "Keys of the heartbeat entries")
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/web"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"net/http"
+)
+
+var webCmd = &cobra.Command{
+	Use:   "web",
+	Short: "Serve a web UI to browse the log database",
+	Long: "Serve a web UI to browse the log database, along with the JSON API it uses.\n\n" +
+		"The API can be queried by dashboards and scripts as well:\n\n" +
+		"  GET /api/entries?level=error&from=-1h  entries matching the filter parameters\n" +
+		"  GET /api/entries/<id>                  a single entry with all its meta values\n" +
+		"  GET /api/sessions                      the sessions\n" +
+		"  GET /api/stats?key=duration            entry counts per level, session and hour",
+	Run: func(cmd *cobra.Command, args []string) {
+		addr, _ := cmd.Flags().GetString("addr")
+
+		logWriter, err := openLogWriter()
+		cobra.CheckErr(err)
+		defer func(logWriter *pkg.LogWriter) {
+			_ = logWriter.Close()
+		}(logWriter)
+
+		log.Info().Str("addr", addr).Msg("serving web UI")
+		err = http.ListenAndServe(addr, web.NewServer(logWriter))
+		cobra.CheckErr(err)
+	},
+}
+
+func init() {
+	webCmd.Flags().String("addr", "localhost:8080", "Address to listen on")
+}
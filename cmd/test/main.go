@@ -4,7 +4,7 @@ import (
 	"fmt"
 	"github.com/go-go-golems/plunger/pkg"
 	"github.com/jmoiron/sqlx"
-	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"io"
 	"os"
 )
@@ -19,6 +19,8 @@ func main() {
 		Level:      "info",
 		DBFile:     "/tmp/test.db",
 		Schema:     schema,
+		// entries are printed as well as stored
+		AdditionalWriters: []io.Writer{os.Stdout},
 	})
 	if err != nil {
 		panic(err)
@@ -33,10 +35,8 @@ func main() {
 		panic(err)
 	}
 
-	multi := io.MultiWriter(logger, os.Stdout)
-
-	// use logger as zerolog.Logger
-	logger_ := zerolog.New(multi).With().Timestamp().Logger()
+	// InitLogging redirects the global logger
+	logger_ := log.Logger
 
 	logger_.Info().Msg("hello world")
 	logger_.Info().Str("foo", "foo").Msg("hello world")
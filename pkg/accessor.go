@@ -0,0 +1,200 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"time"
+)
+
+// MissingMetaKeyError is returned by the LogEntry accessors if the entry has no value for the key.
+type MissingMetaKeyError struct {
+	Key string
+}
+
+func (e *MissingMetaKeyError) Error() string {
+	return fmt.Sprintf("entry has no value for %s", e.Key)
+}
+
+// MetaTypeError is returned by the LogEntry accessors if the value can't be
+// converted to the requested type.
+type MetaTypeError struct {
+	Key   string
+	Value interface{}
+	Type  string
+}
+
+func (e *MetaTypeError) Error() string {
+	return fmt.Sprintf("value %v of %s (%T) is not a %s", e.Value, e.Key, e.Value, e.Type)
+}
+
+func (e *LogEntry) get(key string) (interface{}, error) {
+	v, ok := e.Meta[key]
+	if !ok || v == nil {
+		return nil, &MissingMetaKeyError{Key: key}
+	}
+	return v, nil
+}
+
+// GetString returns a text or blob value.
+func (e *LogEntry) GetString(key string) (string, error) {
+	v, err := e.get(key)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	}
+	return "", &MetaTypeError{Key: key, Value: v, Type: "string"}
+}
+
+// GetInt64 returns an integer value. Real values are accepted if they don't
+// have a fractional part, since JSON values decode numbers as float64.
+func (e *LogEntry) GetInt64(key string) (int64, error) {
+	v, err := e.get(key)
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case int:
+		return int64(v), nil
+	case float64:
+		if v == math.Trunc(v) && v >= math.MinInt64 && v < math.MaxInt64 {
+			return int64(v), nil
+		}
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+	}
+	return 0, &MetaTypeError{Key: key, Value: v, Type: "int64"}
+}
+
+// GetFloat returns a real or integer value.
+func (e *LogEntry) GetFloat(key string) (float64, error) {
+	v, err := e.get(key)
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case float64:
+		return v, nil
+	case int64:
+		return float64(v), nil
+	case int:
+		return float64(v), nil
+	case json.Number:
+		if f, err := v.Float64(); err == nil {
+			return f, nil
+		}
+	}
+	return 0, &MetaTypeError{Key: key, Value: v, Type: "float64"}
+}
+
+// GetBool returns a boolean value.
+func (e *LogEntry) GetBool(key string) (bool, error) {
+	v, err := e.get(key)
+	if err != nil {
+		return false, err
+	}
+	if b, ok := v.(bool); ok {
+		return b, nil
+	}
+	return false, &MetaTypeError{Key: key, Value: v, Type: "bool"}
+}
+
+// GetTime returns a timestamp, stored either as RFC3339 string (as written by
+// zerolog's Time) or as UNIX seconds.
+func (e *LogEntry) GetTime(key string) (time.Time, error) {
+	v, err := e.get(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t, err := parseTimestamp(v, time.RFC3339Nano)
+	if err != nil {
+		return time.Time{}, &MetaTypeError{Key: key, Value: v, Type: "time.Time"}
+	}
+	return t, nil
+}
+
+// GetDuration returns a duration value, see LogEntryTypeDuration. Duration
+// strings such as "1.5s" are parsed as well.
+func (e *LogEntry) GetDuration(key string) (time.Duration, error) {
+	v, err := e.get(key)
+	if err != nil {
+		return 0, err
+	}
+	switch v := v.(type) {
+	case time.Duration:
+		return v, nil
+	case string:
+		if d, err := time.ParseDuration(v); err == nil {
+			return d, nil
+		}
+	}
+	return 0, &MetaTypeError{Key: key, Value: v, Type: "time.Duration"}
+}
+
+// GetJSON unmarshals the value into target, which is useful for JSON values
+// that get decoded into generic maps and slices.
+func (e *LogEntry) GetJSON(key string, target interface{}) error {
+	v, err := e.get(key)
+	if err != nil {
+		return err
+	}
+	b, ok := v.([]byte)
+	if !ok {
+		b, err = json.Marshal(v)
+		if err != nil {
+			return errors.Wrapf(err, "could not marshal %s", key)
+		}
+	}
+	if err := json.Unmarshal(b, target); err != nil {
+		return errors.Wrapf(err, "could not unmarshal %s", key)
+	}
+	return nil
+}
+
+// Get returns the value of key as T, using the typed accessor for string,
+// int64, int, float64, bool, time.Time and time.Duration, and GetJSON for any other type.
+func Get[T any](e *LogEntry, key string) (T, error) {
+	var zero T
+	var v interface{}
+	var err error
+
+	switch any(zero).(type) {
+	case string:
+		v, err = e.GetString(key)
+	case int64:
+		v, err = e.GetInt64(key)
+	case int:
+		var i int64
+		i, err = e.GetInt64(key)
+		v = int(i)
+	case float64:
+		v, err = e.GetFloat(key)
+	case bool:
+		v, err = e.GetBool(key)
+	case time.Time:
+		v, err = e.GetTime(key)
+	case time.Duration:
+		v, err = e.GetDuration(key)
+	default:
+		var target T
+		if err := e.GetJSON(key, &target); err != nil {
+			return zero, err
+		}
+		return target, nil
+	}
+
+	if err != nil {
+		return zero, err
+	}
+	return v.(T), nil
+}
@@ -0,0 +1,71 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLogEntryAccessors(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	require.NoError(t, lw.Init())
+
+	_, err := lw.Write([]byte(`{"level": "info", "name": "foo", "count": 3, "ratio": 0.5, "ok": true,
+		"at": "2023-01-02T03:04:05Z", "user": {"id": 7, "roles": ["admin"]}}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	entry := entries[0]
+
+	s, err := entry.GetString("name")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", s)
+
+	i, err := entry.GetInt64("count")
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), i)
+
+	f, err := entry.GetFloat("count")
+	require.NoError(t, err)
+	assert.Equal(t, 3.0, f)
+
+	ts, err := entry.GetTime("at")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC), ts)
+
+	type user struct {
+		ID    int      `json:"id"`
+		Roles []string `json:"roles"`
+	}
+	var u user
+	require.NoError(t, entry.GetJSON("user", &u))
+	assert.Equal(t, user{ID: 7, Roles: []string{"admin"}}, u)
+
+	ok, err := Get[bool](entry, "ok")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	n, err := Get[int](entry, "count")
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+	u2, err := Get[user](entry, "user")
+	require.NoError(t, err)
+	assert.Equal(t, u, u2)
+
+	_, err = entry.GetInt64("ratio")
+	var typeErr *MetaTypeError
+	assert.ErrorAs(t, err, &typeErr)
+
+	_, err = Get[string](entry, "missing")
+	var missingErr *MissingMetaKeyError
+	assert.ErrorAs(t, err, &missingErr)
+}
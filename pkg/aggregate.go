@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Time buckets that can be used with GroupBy, next to the level, session and
+// message columns and meta keys.
+const (
+	GroupByMinute = "minute"
+	GroupByHour   = "hour"
+	GroupByDay    = "day"
+)
+
+var timeBuckets = map[string]int64{
+	GroupByMinute: 60,
+	GroupByHour:   3600,
+	GroupByDay:    86400,
+}
+
+// Aggregation is a value computed for each group of entries by Aggregate.
+type Aggregation struct {
+	// Function is the SQL aggregate function (COUNT, MIN, MAX, AVG, SUM), or
+	// TOTAL, see Total.
+	Function string
+	// Key is the numeric meta key the function is computed over, empty for COUNT and TOTAL.
+	Key string
+}
+
+// Name is the key of the aggregation in AggregateRow.Values, for example "count" or "avg(duration)".
+func (a Aggregation) Name() string {
+	if a.Function == "TOTAL" {
+		return "total"
+	}
+	if a.Key == "" {
+		return "count"
+	}
+	return fmt.Sprintf("%s(%s)", strings.ToLower(a.Function), a.Key)
+}
+
+type aggregateQuery struct {
+	groupBy      []string
+	aggregations []Aggregation
+}
+
+type AggregateOption func(*aggregateQuery)
+
+// GroupBy groups entries by level, session, message, a time bucket
+// (GroupByMinute, GroupByHour, GroupByDay) or the value of a meta key.
+func GroupBy(keys ...string) AggregateOption {
+	return func(q *aggregateQuery) {
+		q.groupBy = append(q.groupBy, keys...)
+	}
+}
+
+func Count() AggregateOption {
+	return aggregation("COUNT", "")
+}
+
+// Total counts the entries along with the entries dropped by sampling before
+// them, see SampledDroppedKey, and the entries replaced by Rollup.
+func Total() AggregateOption {
+	return aggregation("TOTAL", "")
+}
+
+// Min computes the minimum of the numeric meta key.
+func Min(key string) AggregateOption {
+	return aggregation("MIN", key)
+}
+
+// Max computes the maximum of the numeric meta key.
+func Max(key string) AggregateOption {
+	return aggregation("MAX", key)
+}
+
+// Avg computes the average of the numeric meta key.
+func Avg(key string) AggregateOption {
+	return aggregation("AVG", key)
+}
+
+// Sum computes the sum of the numeric meta key.
+func Sum(key string) AggregateOption {
+	return aggregation("SUM", key)
+}
+
+func aggregation(function string, key string) AggregateOption {
+	return func(q *aggregateQuery) {
+		q.aggregations = append(q.aggregations, Aggregation{Function: function, Key: key})
+	}
+}
+
+// AggregateRow holds the aggregated values of a group of entries.
+type AggregateRow struct {
+	// Group maps the GroupBy keys to the values of the group. Time buckets are
+	// time.Time values, meta values are strings.
+	Group map[string]interface{} `json:"group"`
+	// Values maps the aggregation names to their values. Counts are int64,
+	// other aggregations float64, or nil if the key is absent from the group.
+	Values map[string]interface{} `json:"values"`
+}
+
+// Count returns the number of entries of the group, if Count() was requested.
+func (r *AggregateRow) Count() int64 {
+	n, _ := r.Values["count"].(int64)
+	return n
+}
+
+// Total returns the number of entries of the group including the sampled out
+// ones, if Total() was requested.
+func (r *AggregateRow) Total() int64 {
+	n, _ := r.Values["total"].(int64)
+	return n
+}
+
+// Aggregate groups the entries matching filter and computes the requested
+// aggregations for each group, for example:
+//
+//	lw.Aggregate(filter, GroupBy("level", "session"), Count(), Avg("duration"))
+//
+// Rows are ordered by group.
+func (l *LogWriter) Aggregate(filter *GetEntriesFilter, opts ...AggregateOption) ([]*AggregateRow, error) {
+	return l.AggregateContext(context.Background(), filter, opts...)
+}
+
+func (l *LogWriter) AggregateContext(ctx context.Context, filter *GetEntriesFilter, opts ...AggregateOption) ([]*AggregateRow, error) {
+	q := &aggregateQuery{}
+	for _, opt := range opts {
+		opt(q)
+	}
+	if len(q.aggregations) == 0 {
+		q.aggregations = []Aggregation{{Function: "COUNT"}}
+	}
+
+	ids, err := l.filteredIDs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlbuilder.NewSelectBuilder()
+	columns := []string{}
+	groupAliases := []string{}
+	for i, key := range q.groupBy {
+		alias := fmt.Sprintf("g%d", i)
+		columns = append(columns, l.groupExpression(sb, key)+" AS "+alias)
+		groupAliases = append(groupAliases, alias)
+	}
+	for _, a := range q.aggregations {
+		if a.Function == "TOTAL" {
+			columns = append(columns, "COUNT(*) + COALESCE(SUM(e.sampled_dropped), 0)")
+			continue
+		}
+		if a.Key == "" {
+			columns = append(columns, a.Function+"(*)")
+			continue
+		}
+		// integers and reals are aggregated together, see metaValueExpression
+		columns = append(columns, fmt.Sprintf("%s(%s)", a.Function,
+			l.metaValueExpression(sb, a.Key, "COALESCE(lem.int_value, lem.real_value)")))
+	}
+
+	sb.Select(columns...).From("log_entries e")
+	sb.Where(sb.In("e.id", ids))
+	if len(groupAliases) > 0 {
+		sb.GroupBy(groupAliases...).OrderBy(groupAliases...)
+	}
+
+	s, args := sb.Build()
+	rows, err := l.db.QueryxContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	ret := []*AggregateRow{}
+	for rows.Next() {
+		values := make([]interface{}, len(q.groupBy)+len(q.aggregations))
+		ptrs := make([]interface{}, len(values))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			return nil, err
+		}
+
+		row := &AggregateRow{
+			Group:  map[string]interface{}{},
+			Values: map[string]interface{}{},
+		}
+		for i, key := range q.groupBy {
+			row.Group[key] = groupValue(key, values[i])
+		}
+		for i, a := range q.aggregations {
+			row.Values[a.Name()] = aggregateValue(a, values[len(q.groupBy)+i])
+		}
+		ret = append(ret, row)
+	}
+
+	return ret, rows.Err()
+}
+
+// filteredIDs returns a query selecting the ids of the entries matching filter.
+func (l *LogWriter) filteredIDs(filter *GetEntriesFilter) (*sqlbuilder.SelectBuilder, error) {
+	if filter == nil {
+		filter = NewGetEntriesFilter()
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	filter, err := filter.resolveCursor()
+	if err != nil {
+		return nil, err
+	}
+	filter = l.resolveGroupKey(filter)
+
+	ids := sqlbuilder.Select("id").From("log_entries")
+	filter.Apply(l.schema.MetaKeys, ids)
+	return ids, nil
+}
+
+func (l *LogWriter) groupExpression(sb *sqlbuilder.SelectBuilder, key string) string {
+	switch key {
+	case "level", "session", "message":
+		return "e." + key
+	case "error":
+		return "e.error_message"
+	}
+	if seconds, ok := timeBuckets[key]; ok {
+		return fmt.Sprintf("(%s / %d) * %d", l.store.UnixTime("e.date"), seconds, seconds)
+	}
+	// booleans group as true and false rather than as their int_value
+	return l.metaValueExpression(sb, key, fmt.Sprintf(
+		"CASE WHEN lem.type = %d THEN (CASE WHEN lem.int_value = 0 THEN 'false' ELSE 'true' END) "+
+			"ELSE COALESCE(lem.text_value, CAST(lem.int_value AS TEXT), CAST(lem.real_value AS TEXT), lem.blob_value) END",
+		LogEntryTypeBool))
+}
+
+// metaValueExpression returns a scalar subquery selecting value from the meta
+// row of key for the current entry e.
+func (l *LogWriter) metaValueExpression(sb *sqlbuilder.SelectBuilder, key string, value string) string {
+	sub := sqlbuilder.Select(value).From("log_entries_meta lem")
+	// exploded arrays have a row per element, their first one is used
+	sub.Where("lem.log_entry_id = e.id", metaKeyCondition(l.schema.MetaKeys, key),
+		"COALESCE(lem.array_index, 0) = 0")
+	if metaKey, ok := l.schema.MetaKeys.Get(key); ok && metaKey.Wide {
+		wide := sqlbuilder.Select(wideExpression(metaKey, value)).From(wideTable + " lem")
+		wide.Where("lem.log_entry_id = e.id")
+		return "COALESCE((" + sb.Var(sub) + "), (" + sb.Var(wide) + "))"
+	}
+	return "(" + sb.Var(sub) + ")"
+}
+
+func groupValue(key string, v interface{}) interface{} {
+	if b, ok := v.([]byte); ok {
+		v = string(b)
+	}
+	if _, ok := timeBuckets[key]; ok {
+		if n, ok := v.(int64); ok {
+			return time.Unix(n, 0).UTC()
+		}
+	}
+	return v
+}
+
+func aggregateValue(a Aggregation, v interface{}) interface{} {
+	if a.Function == "TOTAL" {
+		switch v := aggregateValue(Aggregation{Function: "SUM", Key: SampledDroppedKey}, v).(type) {
+		case float64:
+			return int64(v)
+		case nil:
+			return int64(0)
+		}
+	}
+	switch v := v.(type) {
+	case nil:
+		return nil
+	case int64:
+		if a.Key == "" {
+			return v
+		}
+		return float64(v)
+	case float64:
+		return v
+	case []byte:
+		// postgres returns AVG and SUM as NUMERIC
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return f
+		}
+		return string(v)
+	default:
+		return v
+	}
+}
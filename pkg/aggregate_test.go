@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func writeAggregateEntries(t *testing.T, lw *LogWriter) {
+	for _, line := range []string{
+		`{"level": "info", "time": "2023-05-01T10:05:00Z", "session": "a", "duration": 10, "user": "alice"}`,
+		`{"level": "info", "time": "2023-05-01T10:45:00Z", "session": "a", "duration": 20.5, "user": "bob"}`,
+		`{"level": "error", "time": "2023-05-01T11:10:00Z", "session": "a", "user": "alice"}`,
+		`{"level": "info", "time": "2023-05-01T11:30:00Z", "session": "b", "duration": 30, "user": "alice"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+}
+
+func TestLogWriterAggregate(t *testing.T) {
+	lw := newImportLogWriter(t)
+	writeAggregateEntries(t, lw)
+
+	rows, err := lw.Aggregate(nil, GroupBy("level", "session"), Count(), Avg("duration"), Max("duration"))
+	require.NoError(t, err)
+	require.Len(t, rows, 3)
+	assert.Equal(t, map[string]interface{}{"level": "error", "session": "a"}, rows[0].Group)
+	assert.Equal(t, int64(1), rows[0].Count())
+	assert.Nil(t, rows[0].Values["avg(duration)"])
+	assert.Equal(t, map[string]interface{}{"level": "info", "session": "a"}, rows[1].Group)
+	assert.Equal(t, map[string]interface{}{
+		"count":         int64(2),
+		"avg(duration)": 15.25,
+		"max(duration)": 20.5,
+	}, rows[1].Values)
+	assert.Equal(t, int64(1), rows[2].Count())
+
+	rows, err = lw.Aggregate(NewGetEntriesFilter(WithLevel("info")), Sum("duration"), Min("duration"))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, map[string]interface{}{"sum(duration)": 60.5, "min(duration)": 10.0}, rows[0].Values)
+}
+
+func TestLogWriterAggregateBuckets(t *testing.T) {
+	lw := newImportLogWriter(t)
+	writeAggregateEntries(t, lw)
+
+	rows, err := lw.Aggregate(nil, GroupBy(GroupByHour))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC), rows[0].Group[GroupByHour])
+	assert.Equal(t, int64(2), rows[0].Count())
+	assert.Equal(t, time.Date(2023, 5, 1, 11, 0, 0, 0, time.UTC), rows[1].Group[GroupByHour])
+
+	// grouping by a meta key
+	rows, err = lw.Aggregate(nil, GroupBy("user"), Count())
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "alice", rows[0].Group["user"])
+	assert.Equal(t, int64(3), rows[0].Count())
+	assert.Equal(t, "bob", rows[1].Group["user"])
+}
@@ -0,0 +1,392 @@
+package alert
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseConfig(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(`
+rules:
+  - name: errors
+    min_level: error
+    match:
+      message: "^db"
+    min_count: 3
+    window: 1m
+    actions:
+      - type: table
+`))
+	require.NoError(t, err)
+	require.Len(t, config.Rules, 1)
+	rule := config.Rules[0]
+	assert.Equal(t, time.Minute, rule.window)
+
+	assert.True(t, rule.Matches(map[string]interface{}{"level": "error", "message": "db down"}))
+	assert.True(t, rule.Matches(map[string]interface{}{"level": "FATAL", "message": "db down"}))
+	assert.False(t, rule.Matches(map[string]interface{}{"level": "warn", "message": "db down"}))
+	assert.False(t, rule.Matches(map[string]interface{}{"level": "error", "message": "http down"}))
+	assert.False(t, rule.Matches(map[string]interface{}{"message": "db down"}))
+}
+
+func TestParseConfigInvalid(t *testing.T) {
+	for _, config := range []string{
+		"rules:\n  - name: a\n",
+		"rules:\n  - name: a\n    min_count: 2\n    actions: [{type: table}]\n",
+		"rules:\n  - name: a\n    match: {message: '('}\n    actions: [{type: table}]\n",
+		"rules:\n  - name: a\n    min_level: loud\n    actions: [{type: table}]\n",
+		"rules:\n  - name: a\n    actions: [{type: email}]\n",
+		"rules:\n  - name: a\n    actions: [{type: webhook}]\n",
+	} {
+		_, err := ParseConfig(strings.NewReader(config))
+		var ruleErr *RuleError
+		assert.ErrorAs(t, err, &ruleErr, config)
+	}
+}
+
+func TestMatchNonStringValues(t *testing.T) {
+	rule := &Rule{Name: "status", Match: map[string]string{"status": "^5"}, Actions: []Action{{Type: ActionTable}}}
+	require.NoError(t, rule.Compile())
+	assert.True(t, rule.Matches(map[string]interface{}{"status": float64(503)}))
+	assert.False(t, rule.Matches(map[string]interface{}{"status": float64(404)}))
+}
+
+func TestEvaluateCountWindow(t *testing.T) {
+	rule := &Rule{Name: "burst", MinCount: 3, Window: "10s", Actions: []Action{{Type: ActionTable}}}
+	require.NoError(t, rule.Compile())
+	e := NewEngine(&Config{Rules: []*Rule{rule}})
+
+	start := time.Unix(1000, 0)
+	entry := map[string]interface{}{"level": "info"}
+	evaluate := func(offset time.Duration) int {
+		alerts, err := e.Evaluate(entry, start.Add(offset))
+		require.NoError(t, err)
+		return len(alerts)
+	}
+
+	assert.Equal(t, 0, evaluate(0))
+	assert.Equal(t, 0, evaluate(5*time.Second))
+	// the first match is out of the window
+	assert.Equal(t, 0, evaluate(12*time.Second))
+	assert.Equal(t, 1, evaluate(13*time.Second))
+	// the count starts over after triggering
+	assert.Equal(t, 0, evaluate(14*time.Second))
+}
+
+func newTestLogWriter(t *testing.T, opts ...pkg.LogWriterOption) *pkg.LogWriter {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	lw := pkg.NewLogWriter(db, pkg.NewSchema(), opts...)
+	require.NoError(t, lw.Init())
+	return lw
+}
+
+func TestMiddlewareActions(t *testing.T) {
+	var mu sync.Mutex
+	received := []*pkg.Alert{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alert := &pkg.Alert{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(alert))
+		mu.Lock()
+		received = append(received, alert)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	rule := &Rule{
+		Name:     "errors",
+		MinLevel: "error",
+		Actions: []Action{
+			{Type: ActionWebhook, URL: server.URL},
+			{Type: ActionTable},
+			{Type: ActionExec, Command: []string{"sh", "-c", `cat > "` + dir + `/$PLUNGER_ALERT_RULE.json"`}},
+		},
+	}
+	require.NoError(t, rule.Compile())
+
+	errs := []error{}
+	e := NewEngine(&Config{Rules: []*Rule{rule}}, WithErrorHandler(func(err error) {
+		errs = append(errs, err)
+	}))
+	lw := newTestLogWriter(t, pkg.WithMiddleware(e.Middleware))
+	WithLogWriter(lw)(e)
+
+	_, err := lw.Write([]byte(`{"level": "info", "message": "fine"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "error", "message": "broken"}`))
+	require.NoError(t, err)
+	e.Close()
+	require.Empty(t, errs)
+
+	require.Len(t, received, 1)
+	assert.Equal(t, "errors", received[0].Rule)
+	assert.Equal(t, 1, received[0].Count)
+	assert.Contains(t, string(received[0].Entry), "broken")
+
+	alerts, err := lw.ListAlerts(context.Background(), time.Time{})
+	require.NoError(t, err)
+	require.Len(t, alerts, 1)
+	assert.Equal(t, "errors", alerts[0].Rule)
+	assert.Contains(t, string(alerts[0].Entry), "broken")
+
+	b, err := os.ReadFile(filepath.Join(dir, "errors.json"))
+	require.NoError(t, err)
+	assert.Contains(t, string(b), `"rule":"errors"`)
+}
+
+func TestWebhookError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	rule := &Rule{Name: "all", Actions: []Action{{Type: ActionWebhook, URL: server.URL}}}
+	require.NoError(t, rule.Compile())
+	e := NewEngine(&Config{Rules: []*Rule{rule}})
+	err := e.Process(context.Background(), map[string]interface{}{"level": "info"}, time.Now())
+	assert.ErrorContains(t, err, "status 500")
+}
+
+func TestWatch(t *testing.T) {
+	lw := newTestLogWriter(t)
+	rule := &Rule{Name: "timeouts", Match: map[string]string{"message": "timeout"}, Actions: []Action{{Type: ActionTable}}}
+	require.NoError(t, rule.Compile())
+	e := NewEngine(&Config{Rules: []*Rule{rule}}, WithLogWriter(lw))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- e.Watch(ctx, lw, nil)
+	}()
+
+	// Follow only picks up the entries written after it started
+	time.Sleep(100 * time.Millisecond)
+	_, err := lw.Write([]byte(`{"level": "warn", "message": "timeout"}`))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		alerts, err := lw.ListAlerts(context.Background(), time.Time{})
+		return err == nil && len(alerts) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-done)
+}
+
+func TestWatchStalls(t *testing.T) {
+	config, err := ParseConfig(strings.NewReader(`
+rules:
+  - name: stalled
+    stall_after: 200ms
+    heartbeat_keys: [progress]
+    actions:
+      - type: table
+`))
+	require.NoError(t, err)
+	assert.True(t, config.Rules[0].IsStall())
+	assert.False(t, config.Rules[0].Matches(map[string]interface{}{"progress": 1}))
+
+	lw := newTestLogWriter(t)
+	e := NewEngine(config, WithLogWriter(lw), WithStallPollInterval(50*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- e.Watch(ctx, lw, nil)
+	}()
+	_, err = lw.Write([]byte(`{"level": "info", "session": "s1", "progress": 0.5}`))
+	require.NoError(t, err)
+
+	var alerts []*pkg.Alert
+	assert.Eventually(t, func() bool {
+		alerts, err = lw.ListAlerts(context.Background(), time.Time{})
+		return err == nil && len(alerts) == 1
+	}, 5*time.Second, 50*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	hb := &pkg.SessionHeartbeat{}
+	require.NoError(t, json.Unmarshal(alerts[0].Entry, hb))
+	assert.Equal(t, "stalled", alerts[0].Rule)
+	assert.Equal(t, "s1", hb.Session)
+	assert.True(t, hb.Stalled)
+}
+
+func TestParseConfigInvalidStall(t *testing.T) {
+	_, err := ParseConfig(strings.NewReader(`
+rules:
+  - name: stalled
+    stall_after: 5m
+    min_level: error
+    actions:
+      - type: table
+`))
+	assert.ErrorContains(t, err, "stall rules can't match entries")
+}
+
+func TestNotifiers(t *testing.T) {
+	var mu sync.Mutex
+	bodies := map[string]string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+		mu.Lock()
+		bodies[r.URL.Path] = string(b)
+		mu.Unlock()
+		assert.Equal(t, "token", r.Header.Get("X-Token"))
+	}))
+	defer server.Close()
+
+	config, err := ParseConfig(strings.NewReader(`
+rules:
+  - name: errors
+    min_level: error
+    min_count: 2
+    window: 1m
+    actions:
+      - type: slack
+        url: ` + server.URL + `/slack
+        headers:
+          X-Token: token
+      - type: webhook
+        url: ` + server.URL + `/webhook
+        headers:
+          X-Token: token
+        template: '{"summary": {{json .Rule}}, "message": {{json (index .Entry "message")}}, "count": {{.Count}}}'
+      - type: email
+        smtp:
+          addr: localhost:2525
+          username: plunger
+          password_env: PLUNGER_TEST_SMTP_PASSWORD
+        from: plunger@example.com
+        to: [a@example.com, b@example.com]
+        subject: "{{.Count}} errors"
+`))
+	require.NoError(t, err)
+
+	type mail struct {
+		addr string
+		from string
+		to   []string
+		msg  string
+	}
+	mails := []mail{}
+	e := NewEngine(config)
+	e.sendMail = func(addr string, a smtp.Auth, from string, to []string, msg []byte) error {
+		assert.NotNil(t, a)
+		mails = append(mails, mail{addr, from, to, string(msg)})
+		return nil
+	}
+
+	at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, e.Process(context.Background(), map[string]interface{}{"level": "error", "message": "db down", "session": "s1"}, at))
+	require.NoError(t, e.Process(context.Background(), map[string]interface{}{"level": "fatal", "message": "exiting"}, at.Add(time.Second)))
+
+	expected := "errors triggered by 2 entries at 2023-05-01T12:00:01Z\n\n[error] s1 db down\n[fatal] exiting\n"
+	slack := map[string]string{}
+	require.NoError(t, json.Unmarshal([]byte(bodies["/slack"]), &slack))
+	assert.Equal(t, expected, slack["text"])
+	assert.JSONEq(t, `{"summary": "errors", "message": "exiting", "count": 2}`, bodies["/webhook"])
+
+	require.Len(t, mails, 1)
+	assert.Equal(t, "localhost:2525", mails[0].addr)
+	assert.Equal(t, []string{"a@example.com", "b@example.com"}, mails[0].to)
+	assert.Contains(t, mails[0].msg, "To: a@example.com, b@example.com\r\n")
+	assert.Contains(t, mails[0].msg, "Subject: 2 errors\r\n")
+	assert.True(t, strings.HasSuffix(mails[0].msg, "\r\n\r\n"+strings.ReplaceAll(expected, "\n", "\r\n")))
+}
+
+func TestParseConfigInvalidNotifiers(t *testing.T) {
+	for action, expected := range map[string]string{
+		`{type: slack}`: "slack action without url",
+		`{type: email, smtp: {addr: "localhost:25"}, to: [a@example.com]}`: "email action without from or to",
+		`{type: webhook, url: "http://localhost", template: "{{.Rule"}`:    "unclosed action",
+	} {
+		_, err := ParseConfig(strings.NewReader(`
+rules:
+  - name: invalid
+    actions:
+      - ` + action))
+		assert.ErrorContains(t, err, expected)
+	}
+}
+
+func TestExecStdin(t *testing.T) {
+	dir := t.TempDir()
+	config, err := ParseConfig(strings.NewReader(`
+rules:
+  - name: errors
+    min_level: error
+    min_count: 2
+    window: 1m
+    actions:
+      - type: exec
+        command: ["sh", "-c", "cat > ` + dir + `/entries.jsonl"]
+        stdin: entries
+      - type: exec
+        command: ["sh", "-c", "cat > ` + dir + `/entry.json; echo $PLUNGER_ALERT_DATE > ` + dir + `/date"]
+        stdin: entry
+`))
+	require.NoError(t, err)
+	e := NewEngine(config)
+
+	at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	require.NoError(t, e.Process(context.Background(), map[string]interface{}{"level": "error", "message": "a"}, at))
+	require.NoError(t, e.Process(context.Background(), map[string]interface{}{"level": "error", "message": "b"}, at))
+
+	b, err := os.ReadFile(filepath.Join(dir, "entries.jsonl"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"level":"error","message":"a"}`+"\n"+`{"level":"error","message":"b"}`+"\n", string(b))
+	b, err = os.ReadFile(filepath.Join(dir, "entry.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"level":"error","message":"b"}`+"\n", string(b))
+	b, err = os.ReadFile(filepath.Join(dir, "date"))
+	require.NoError(t, err)
+	assert.Equal(t, "2023-05-01T12:00:00Z\n", string(b))
+}
+
+func TestExecTimeout(t *testing.T) {
+	rule := &Rule{Name: "all", Actions: []Action{{Type: ActionExec, Command: []string{"sleep", "10"}, Timeout: "100ms"}}}
+	require.NoError(t, rule.Compile())
+	e := NewEngine(&Config{Rules: []*Rule{rule}})
+	err := e.Process(context.Background(), map[string]interface{}{"level": "info"}, time.Now())
+	assert.ErrorContains(t, err, "command timed out after 100ms")
+
+	rule = &Rule{Name: "all", Actions: []Action{{Type: ActionExec, Command: []string{"true"}, Stdin: "body"}}}
+	assert.ErrorContains(t, rule.Compile(), `unknown exec stdin "body"`)
+}
+
+func TestMatchScript(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "upstream.star")
+	require.NoError(t, os.WriteFile(path, []byte(`
+def main(entry):
+    return entry.get("component") == "proxy" and entry.get("status", 0) >= 500
+`), 0o600))
+	rule := &Rule{Name: "upstream", Script: path, Actions: []Action{{Type: ActionTable}}}
+	require.NoError(t, rule.Compile())
+	assert.True(t, rule.Matches(map[string]interface{}{"component": "proxy", "status": float64(502)}))
+	assert.False(t, rule.Matches(map[string]interface{}{"component": "proxy", "status": float64(404)}))
+	assert.False(t, rule.Matches(map[string]interface{}{"component": "db", "status": float64(502)}))
+
+	rule = &Rule{Name: "missing", Script: filepath.Join(t.TempDir(), "missing.star"), Actions: []Action{{Type: ActionTable}}}
+	var ruleErr *RuleError
+	assert.ErrorAs(t, rule.Compile(), &ruleErr)
+}
@@ -0,0 +1,376 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"net/http"
+	"net/smtp"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// match is an entry matched by a count-based rule.
+type match struct {
+	at    time.Time
+	entry json.RawMessage
+}
+
+// Engine evaluates rules and runs the actions of the triggered ones.
+type Engine struct {
+	rules      []*Rule
+	logWriter  *pkg.LogWriter
+	httpClient *http.Client
+	onError    func(error)
+	// sendMail sends the messages of email actions, smtp.SendMail.
+	sendMail func(addr string, a smtp.Auth, from string, to []string, msg []byte) error
+	// stallPollInterval is how often Watch looks for stalled sessions.
+	stallPollInterval time.Duration
+
+	mu sync.Mutex
+	// matches holds the recent matches of count-based rules.
+	matches map[string][]match
+
+	// wg tracks the actions started by Middleware.
+	wg sync.WaitGroup
+}
+
+type EngineOption func(*Engine)
+
+// WithLogWriter sets the database the table action records alerts in.
+func WithLogWriter(lw *pkg.LogWriter) EngineOption {
+	return func(e *Engine) {
+		e.logWriter = lw
+	}
+}
+
+// WithErrorHandler is called with the errors of actions run by Middleware,
+// which can't be returned to the writer. They are printed to stderr by default.
+//
+// Don't log them to the LogWriter the engine is evaluating, which could
+// trigger the failing rule again.
+func WithErrorHandler(onError func(error)) EngineOption {
+	return func(e *Engine) {
+		e.onError = onError
+	}
+}
+
+// WithStallPollInterval sets how often Watch looks for stalled sessions,
+// pkg.DefaultStallPollInterval by default.
+func WithStallPollInterval(interval time.Duration) EngineOption {
+	return func(e *Engine) {
+		e.stallPollInterval = interval
+	}
+}
+
+func WithHTTPClient(client *http.Client) EngineOption {
+	return func(e *Engine) {
+		e.httpClient = client
+	}
+}
+
+func NewEngine(config *Config, opts ...EngineOption) *Engine {
+	e := &Engine{
+		rules:      config.Rules,
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+		sendMail:   smtp.SendMail,
+		onError: func(err error) {
+			_, _ = fmt.Fprintf(os.Stderr, "alert: %s\n", err)
+		},
+		matches: map[string][]match{},
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Evaluate returns the alerts triggered by entry, a flat map of the level,
+// message, session and meta values, at the given time.
+func (e *Engine) Evaluate(entry map[string]interface{}, at time.Time) ([]*pkg.Alert, error) {
+	var alerts []*pkg.Alert
+	for _, rule := range e.rules {
+		if !rule.Matches(entry) {
+			continue
+		}
+
+		b, err := json.Marshal(entry)
+		if err != nil {
+			return nil, err
+		}
+		entries := e.count(rule, match{at: at, entry: b})
+		if len(entries) == 0 {
+			continue
+		}
+
+		alert := &pkg.Alert{
+			Rule:  rule.Name,
+			Date:  at.UTC(),
+			Count: len(entries),
+			Entry: b,
+		}
+		if rule.MinCount > 1 {
+			alert.Entries = entries
+		}
+		alerts = append(alerts, alert)
+	}
+	return alerts, nil
+}
+
+// count records the match m of rule, and returns the entries of the matches
+// that triggered the rule, or nil if it didn't trigger.
+func (e *Engine) count(rule *Rule, m match) []json.RawMessage {
+	if rule.MinCount <= 1 {
+		return []json.RawMessage{m.entry}
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	recent := []match{}
+	for _, r := range e.matches[rule.Name] {
+		if m.at.Sub(r.at) < rule.window {
+			recent = append(recent, r)
+		}
+	}
+	recent = append(recent, m)
+
+	if len(recent) < rule.MinCount {
+		e.matches[rule.Name] = recent
+		return nil
+	}
+	delete(e.matches, rule.Name)
+	ret := []json.RawMessage{}
+	for _, r := range recent {
+		ret = append(ret, r.entry)
+	}
+	return ret
+}
+
+// Process evaluates entry and runs the actions of the triggered rules.
+func (e *Engine) Process(ctx context.Context, entry map[string]interface{}, at time.Time) error {
+	alerts, err := e.Evaluate(entry, at)
+	if err != nil {
+		return err
+	}
+	for _, alert := range alerts {
+		if err := e.Run(ctx, alert); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Run executes the actions of the rule that triggered alert.
+func (e *Engine) Run(ctx context.Context, alert *pkg.Alert) error {
+	var rule *Rule
+	for _, r := range e.rules {
+		if r.Name == alert.Rule {
+			rule = r
+			break
+		}
+	}
+	if rule == nil {
+		return errors.Errorf("unknown rule %q", alert.Rule)
+	}
+
+	for _, action := range rule.Actions {
+		var err error
+		switch action.Type {
+		case ActionExec:
+			err = e.runExec(ctx, action, alert)
+		case ActionWebhook:
+			err = e.runWebhook(ctx, action, alert)
+		case ActionSlack:
+			err = e.runSlack(ctx, action, alert)
+		case ActionEmail:
+			err = e.runEmail(action, alert)
+		case ActionTable:
+			if e.logWriter == nil {
+				err = errors.New("table action requires a LogWriter")
+			} else {
+				err = e.logWriter.RecordAlert(ctx, alert)
+			}
+		}
+		if err != nil {
+			return errors.Wrapf(err, "%s action of rule %q failed", action.Type, rule.Name)
+		}
+	}
+	return nil
+}
+
+// runExec runs the command of action with the payload chosen by its stdin on
+// stdin, and the rule, count and date of the alert in the PLUNGER_ALERT_*
+// environment variables.
+func (e *Engine) runExec(ctx context.Context, action Action, alert *pkg.Alert) error {
+	stdin := &bytes.Buffer{}
+	switch action.Stdin {
+	case ExecStdinEntry:
+		stdin.Write(alert.Entry)
+		stdin.WriteByte('\n')
+	case ExecStdinEntries:
+		entries := alert.Entries
+		if len(entries) == 0 {
+			entries = []json.RawMessage{alert.Entry}
+		}
+		for _, entry := range entries {
+			stdin.Write(entry)
+			stdin.WriteByte('\n')
+		}
+	default:
+		if err := json.NewEncoder(stdin).Encode(alert); err != nil {
+			return err
+		}
+	}
+
+	if action.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, action.timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, action.Command[0], action.Command[1:]...)
+	cmd.Stdin = stdin
+	cmd.Env = append(os.Environ(),
+		"PLUNGER_ALERT_RULE="+alert.Rule,
+		"PLUNGER_ALERT_COUNT="+strconv.Itoa(alert.Count),
+		"PLUNGER_ALERT_DATE="+alert.Date.Format(time.RFC3339Nano))
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return errors.Errorf("command timed out after %s", action.timeout)
+		}
+		return errors.Wrapf(err, "%s", bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// runWebhook POSTs the alert as JSON, or the body rendered by the template
+// of the action.
+func (e *Engine) runWebhook(ctx context.Context, action Action, alert *pkg.Alert) error {
+	if action.template != nil {
+		body, err := render(action.template, alert)
+		if err != nil {
+			return err
+		}
+		return e.post(ctx, action, []byte(body))
+	}
+	b, err := json.Marshal(alert)
+	if err != nil {
+		return err
+	}
+	return e.post(ctx, action, b)
+}
+
+// Middleware evaluates the rules on the write path, once the entry has been
+// persisted. Actions run in the background, so that they don't slow down
+// logging; use Close to wait for them.
+func (e *Engine) Middleware(next pkg.EntryHandler) pkg.EntryHandler {
+	return func(entry map[string]interface{}) error {
+		if err := next(entry); err != nil {
+			return err
+		}
+
+		alerts, err := e.Evaluate(entry, time.Now())
+		if err != nil {
+			e.onError(err)
+			return nil
+		}
+		for _, alert := range alerts {
+			e.wg.Add(1)
+			go func(alert *pkg.Alert) {
+				defer e.wg.Done()
+				if err := e.Run(context.Background(), alert); err != nil {
+					e.onError(err)
+				}
+			}(alert)
+		}
+		return nil
+	}
+}
+
+// Close waits for the actions started by Middleware.
+func (e *Engine) Close() {
+	e.wg.Wait()
+}
+
+// Watch evaluates the rules on the entries written to lw after Watch was
+// called, and the stall rules on the sessions of these entries, until ctx is
+// done. Action errors are passed to the error handler.
+func (e *Engine) Watch(ctx context.Context, lw *pkg.LogWriter, filter *pkg.GetEntriesFilter) error {
+	entries, err := lw.Follow(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	for _, rule := range e.rules {
+		if !rule.IsStall() {
+			continue
+		}
+		wg.Add(1)
+		go func(rule *Rule) {
+			defer wg.Done()
+			if err := e.watchStalls(ctx, lw, filter, rule); err != nil {
+				e.onError(errors.Wrapf(err, "could not watch the stalls of rule %q", rule.Name))
+			}
+		}(rule)
+	}
+
+	for entry := range entries {
+		if err := e.Process(ctx, flattenEntry(entry), entry.Date); err != nil {
+			e.onError(err)
+		}
+	}
+	return nil
+}
+
+// watchStalls runs the actions of the stall rule for each stalled session,
+// with the pkg.SessionHeartbeat of the session as entry of the alert.
+func (e *Engine) watchStalls(ctx context.Context, lw *pkg.LogWriter, filter *pkg.GetEntriesFilter, rule *Rule) error {
+	opts := []pkg.HeartbeatOption{pkg.WithStallAfter(rule.stallAfter)}
+	if len(rule.HeartbeatKeys) > 0 {
+		opts = append(opts, pkg.WithHeartbeatKeys(rule.HeartbeatKeys...))
+	}
+	if e.stallPollInterval > 0 {
+		opts = append(opts, pkg.WithStallPollInterval(e.stallPollInterval))
+	}
+	return lw.WatchStalls(ctx, filter, func(hb *pkg.SessionHeartbeat) {
+		b, err := json.Marshal(hb)
+		if err != nil {
+			e.onError(err)
+			return
+		}
+		alert := &pkg.Alert{
+			Rule:  rule.Name,
+			Date:  time.Now().UTC(),
+			Count: 1,
+			Entry: b,
+		}
+		if err := e.Run(ctx, alert); err != nil {
+			e.onError(err)
+		}
+	}, opts...)
+}
+
+// flattenEntry returns the fields of a stored entry as rules see them on the write path.
+func flattenEntry(entry *pkg.LogEntry) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range entry.Meta {
+		ret[k] = v
+	}
+	ret["level"] = entry.Level
+	if entry.Message != nil {
+		ret["message"] = *entry.Message
+	}
+	if entry.Session != nil {
+		ret["session"] = *entry.Session
+	}
+	return ret
+}
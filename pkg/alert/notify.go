@@ -0,0 +1,160 @@
+package alert
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"net"
+	"net/http"
+	"net/smtp"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// DefaultTemplate is the body of slack and email actions without template.
+const DefaultTemplate = `{{.Rule}} triggered{{if gt .Count 1}} by {{.Count}} entries{{end}} at {{.Date.Format "2006-01-02T15:04:05Z07:00"}}
+{{range .Entries}}
+[{{index . "level"}}]{{with index . "session"}} {{.}}{{end}} {{with index . "message"}}{{.}}{{end}}{{end}}
+`
+
+// DefaultSubject is the subject of email actions without subject.
+const DefaultSubject = `plunger: {{.Rule}} triggered`
+
+// TemplateData is what the templates of actions are executed with. Entry
+// and Entries are the flat maps of the level, message, session and meta
+// values the rules see. The json function formats a value as JSON, to
+// write the body of webhooks:
+//
+//	template: '{"summary": {{json .Rule}}, "message": {{json (index .Entry "message")}}}'
+type TemplateData struct {
+	Rule  string
+	Date  time.Time
+	Count int
+	// Entry is the entry that triggered the rule.
+	Entry map[string]interface{}
+	// Entries are the entries counted by a rule with a min_count, or only
+	// Entry for other rules.
+	Entries []map[string]interface{}
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func parseTemplate(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(templateFuncs).Parse(text)
+}
+
+func newTemplateData(alert *pkg.Alert) (*TemplateData, error) {
+	ret := &TemplateData{
+		Rule:    alert.Rule,
+		Date:    alert.Date,
+		Count:   alert.Count,
+		Entry:   map[string]interface{}{},
+		Entries: []map[string]interface{}{},
+	}
+	if len(alert.Entry) > 0 {
+		if err := json.Unmarshal(alert.Entry, &ret.Entry); err != nil {
+			return nil, err
+		}
+	}
+	if len(alert.Entries) == 0 {
+		ret.Entries = append(ret.Entries, ret.Entry)
+	}
+	for _, b := range alert.Entries {
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal(b, &entry); err != nil {
+			return nil, err
+		}
+		ret.Entries = append(ret.Entries, entry)
+	}
+	return ret, nil
+}
+
+func render(tmpl *template.Template, alert *pkg.Alert) (string, error) {
+	data, err := newTemplateData(alert)
+	if err != nil {
+		return "", err
+	}
+	buf := &bytes.Buffer{}
+	if err := tmpl.Execute(buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// post POSTs body as JSON to the URL of action.
+func (e *Engine) post(ctx context.Context, action Action, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, action.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range action.Headers {
+		req.Header.Set(k, v)
+	}
+	res, err := e.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return errors.Errorf("%s returned status %d", action.Type, res.StatusCode)
+	}
+	return nil
+}
+
+func (e *Engine) runSlack(ctx context.Context, action Action, alert *pkg.Alert) error {
+	text, err := render(action.template, alert)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+	return e.post(ctx, action, b)
+}
+
+func (e *Engine) runEmail(action Action, alert *pkg.Alert) error {
+	subject, err := render(action.subject, alert)
+	if err != nil {
+		return err
+	}
+	body, err := render(action.template, alert)
+	if err != nil {
+		return err
+	}
+
+	msg := &bytes.Buffer{}
+	for _, header := range [][2]string{
+		{"From", action.From},
+		{"To", strings.Join(action.To, ", ")},
+		{"Subject", strings.Join(strings.Fields(subject), " ")},
+		{"Date", alert.Date.Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+	} {
+		_, _ = fmt.Fprintf(msg, "%s: %s\r\n", header[0], header[1])
+	}
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+
+	var auth smtp.Auth
+	if action.SMTP.Username != "" {
+		host, _, err := net.SplitHostPort(action.SMTP.Addr)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", action.SMTP.Username, os.Getenv(action.SMTP.PasswordEnv), host)
+	}
+	return e.sendMail(action.SMTP.Addr, auth, action.From, action.To, msg.Bytes())
+}
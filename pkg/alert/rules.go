@@ -0,0 +1,373 @@
+// Package alert evaluates alerting rules against log entries, either inline
+// on the write path (see Engine.Middleware) or on a database that is being
+// written to (see Engine.Watch).
+//
+// Rules are configured in YAML:
+//
+//	rules:
+//	  - name: timeouts
+//	    min_level: error
+//	    match:
+//	      message: "timeout|deadline exceeded"
+//	    min_count: 5
+//	    window: 10m
+//	    script: upstream.star
+//	    actions:
+//	      - type: exec
+//	        command: ["notify-send", "plunger", "too many timeouts"]
+//	      - type: exec
+//	        command: ["./open-ticket.sh"]
+//	        stdin: entries
+//	        timeout: 30s
+//	      - type: webhook
+//	        url: http://localhost:9000/alerts
+//	      - type: table
+//	      - type: slack
+//	        url: https://hooks.slack.com/services/T000/B000/XXXX
+//	      - type: email
+//	        smtp:
+//	          addr: smtp.example.com:587
+//	          username: plunger
+//	          password_env: SMTP_PASSWORD
+//	        from: plunger@example.com
+//	        to: [oncall@example.com]
+//	  - name: stalled
+//	    stall_after: 5m
+//	    heartbeat_keys: [progress]
+//	    actions:
+//	      - type: webhook
+//	        url: http://localhost:9000/alerts
+//
+// The script of a rule is a Starlark program loaded from a file, such as
+// upstream.star defining
+//
+//	def main(entry):
+//	    return entry.get("component") == "proxy" and entry.get("status", 0) >= 500
+//
+// for the conditions that regular expressions can't express, see pkg.Script.
+//
+// The body of webhook, slack and email actions can be set with a
+// text/template, see TemplateData.
+//
+// Stall rules, with stall_after, trigger when a session that logs heartbeats
+// stops logging them before its run ended, see pkg.LogWriter.WatchStalls.
+// They are only evaluated by Engine.Watch.
+package alert
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/retention"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+)
+
+type ActionType string
+
+const (
+	// ActionExec runs a command, with the alert as JSON on stdin, or the
+	// entries that triggered it, see Action.Stdin.
+	ActionExec ActionType = "exec"
+	// ActionWebhook POSTs the alert as JSON to an URL.
+	ActionWebhook ActionType = "webhook"
+	// ActionTable records the alert in the alerts table of the database.
+	ActionTable ActionType = "table"
+	// ActionSlack POSTs a message to a Slack compatible incoming webhook.
+	ActionSlack ActionType = "slack"
+	// ActionEmail sends an email through an SMTP server.
+	ActionEmail ActionType = "email"
+)
+
+// ExecStdin is what exec actions write on the stdin of their command.
+type ExecStdin string
+
+const (
+	// ExecStdinAlert writes the alert as JSON, with the triggering entry in
+	// its entry field.
+	ExecStdinAlert ExecStdin = "alert"
+	// ExecStdinEntry writes the entry that triggered the rule as JSON.
+	ExecStdinEntry ExecStdin = "entry"
+	// ExecStdinEntries writes the entries counted by a rule with a
+	// min_count, or the triggering entry for other rules, as JSON lines.
+	ExecStdinEntries ExecStdin = "entries"
+)
+
+type Action struct {
+	Type    ActionType `yaml:"type"`
+	Command []string   `yaml:"command,omitempty"`
+	// Stdin is what exec actions write on the stdin of the command,
+	// ExecStdinAlert by default.
+	Stdin ExecStdin `yaml:"stdin,omitempty"`
+	// Timeout kills the command of exec actions once expired, a duration like
+	// Rule.Window. Commands aren't killed by default.
+	Timeout string `yaml:"timeout,omitempty"`
+	URL     string `yaml:"url,omitempty"`
+	// Headers are set on the requests of webhook and slack actions.
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Template renders the body of webhook (the alert as JSON by default),
+	// slack and email actions (DefaultTemplate by default).
+	Template string `yaml:"template,omitempty"`
+
+	// SMTP, From, To and Subject configure email actions. Subject is a
+	// template, DefaultSubject by default.
+	SMTP    *SMTPConfig `yaml:"smtp,omitempty"`
+	From    string      `yaml:"from,omitempty"`
+	To      []string    `yaml:"to,omitempty"`
+	Subject string      `yaml:"subject,omitempty"`
+
+	timeout  time.Duration
+	template *template.Template
+	subject  *template.Template
+}
+
+type SMTPConfig struct {
+	// Addr is the host:port of the server.
+	Addr     string `yaml:"addr"`
+	Username string `yaml:"username,omitempty"`
+	// PasswordEnv is the environment variable holding the password, so that
+	// it doesn't have to be written in the rules.
+	PasswordEnv string `yaml:"password_env,omitempty"`
+}
+
+// Rule triggers its actions when an entry matches all of its conditions.
+//
+// If MinCount is set, the rule only triggers once MinCount entries matched
+// within Window, after which the count starts over.
+type Rule struct {
+	Name string `yaml:"name"`
+	// MinLevel matches entries at least as severe as this zerolog level.
+	MinLevel string `yaml:"min_level,omitempty"`
+	// Match maps keys (level, message, session, or meta keys) to regular
+	// expressions their value has to match.
+	Match map[string]string `yaml:"match,omitempty"`
+	// Script is a Starlark file the entry is passed to, matching if its
+	// output is true, see pkg.Script.Test. Entries for which the
+	// script fails don't match.
+	Script   string `yaml:"script,omitempty"`
+	MinCount int    `yaml:"min_count,omitempty"`
+	// Window is a duration such as 30s, 5m or 1d, see retention.ParseDuration.
+	Window string `yaml:"window,omitempty"`
+	// StallAfter makes the rule a stall rule, a duration like Window.
+	StallAfter string `yaml:"stall_after,omitempty"`
+	// HeartbeatKeys are the keys of the heartbeat entries of a stall rule,
+	// pkg.DefaultHeartbeatKeys by default.
+	HeartbeatKeys []string `yaml:"heartbeat_keys,omitempty"`
+	Actions       []Action `yaml:"actions"`
+
+	minLevel   zerolog.Level
+	match      map[string]*regexp.Regexp
+	script     *pkg.Script
+	window     time.Duration
+	stallAfter time.Duration
+}
+
+type Config struct {
+	Rules []*Rule `yaml:"rules"`
+}
+
+// RuleError is returned for invalid rules.
+type RuleError struct {
+	Rule string
+	Err  error
+}
+
+func (e *RuleError) Error() string {
+	return fmt.Sprintf("invalid rule %q: %s", e.Rule, e.Err)
+}
+
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// Compile validates the rule and prepares it for evaluation.
+func (r *Rule) Compile() error {
+	fail := func(err error) error {
+		return &RuleError{Rule: r.Name, Err: err}
+	}
+
+	if r.Name == "" {
+		return fail(errors.New("missing name"))
+	}
+	if r.MinLevel != "" {
+		level, err := zerolog.ParseLevel(strings.ToLower(r.MinLevel))
+		if err != nil {
+			return fail(err)
+		}
+		r.minLevel = level
+	}
+	r.match = map[string]*regexp.Regexp{}
+	for key, expr := range r.Match {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fail(err)
+		}
+		r.match[key] = re
+	}
+	if r.Script != "" {
+		script, err := pkg.LoadScript(r.Script)
+		if err != nil {
+			return fail(err)
+		}
+		r.script = script
+	}
+	if r.Window != "" {
+		window, err := retention.ParseDuration(r.Window)
+		if err != nil {
+			return fail(err)
+		}
+		r.window = window
+	}
+	if r.MinCount > 1 && r.window <= 0 {
+		return fail(errors.New("min_count requires a window"))
+	}
+	if r.StallAfter != "" {
+		stallAfter, err := retention.ParseDuration(r.StallAfter)
+		if err != nil {
+			return fail(err)
+		}
+		if r.MinLevel != "" || len(r.Match) > 0 || r.Script != "" || r.MinCount > 0 {
+			return fail(errors.New("stall rules can't match entries"))
+		}
+		r.stallAfter = stallAfter
+	}
+	if len(r.Actions) == 0 {
+		return fail(errors.New("no actions"))
+	}
+	for i := range r.Actions {
+		if err := r.Actions[i].compile(); err != nil {
+			return fail(err)
+		}
+	}
+	return nil
+}
+
+func (a *Action) compile() error {
+	switch a.Type {
+	case ActionExec:
+		if len(a.Command) == 0 {
+			return errors.New("exec action without command")
+		}
+		switch a.Stdin {
+		case "", ExecStdinAlert, ExecStdinEntry, ExecStdinEntries:
+		default:
+			return errors.Errorf("unknown exec stdin %q", a.Stdin)
+		}
+		if a.Timeout != "" {
+			timeout, err := retention.ParseDuration(a.Timeout)
+			if err != nil {
+				return err
+			}
+			a.timeout = timeout
+		}
+	case ActionWebhook, ActionSlack:
+		if a.URL == "" {
+			return errors.Errorf("%s action without url", a.Type)
+		}
+	case ActionEmail:
+		if a.SMTP == nil || a.SMTP.Addr == "" {
+			return errors.New("email action without smtp addr")
+		}
+		if a.From == "" || len(a.To) == 0 {
+			return errors.New("email action without from or to")
+		}
+		subject := a.Subject
+		if subject == "" {
+			subject = DefaultSubject
+		}
+		tmpl, err := parseTemplate("subject", subject)
+		if err != nil {
+			return err
+		}
+		a.subject = tmpl
+	case ActionTable:
+	default:
+		return errors.Errorf("unknown action type %q", a.Type)
+	}
+
+	body := a.Template
+	if body == "" && a.Type != ActionWebhook {
+		body = DefaultTemplate
+	}
+	if body != "" {
+		tmpl, err := parseTemplate("template", body)
+		if err != nil {
+			return err
+		}
+		a.template = tmpl
+	}
+	return nil
+}
+
+// IsStall returns true for stall rules.
+func (r *Rule) IsStall() bool {
+	return r.stallAfter > 0
+}
+
+// Matches returns true if entry, a flat map of the level, message, session
+// and meta values, matches the conditions of the rule. The count condition
+// is evaluated by the Engine. Stall rules match no entry.
+func (r *Rule) Matches(entry map[string]interface{}) bool {
+	if r.IsStall() {
+		return false
+	}
+	if r.MinLevel != "" {
+		s, _ := entry["level"].(string)
+		level, err := zerolog.ParseLevel(strings.ToLower(s))
+		if err != nil || s == "" || level < r.minLevel {
+			return false
+		}
+	}
+	for key, re := range r.match {
+		v, ok := entry[key]
+		if !ok || v == nil {
+			return false
+		}
+		s, ok := v.(string)
+		if !ok {
+			s = fmt.Sprint(v)
+		}
+		if !re.MatchString(s) {
+			return false
+		}
+	}
+	if r.script != nil {
+		ok, err := r.script.Test(context.Background(), entry)
+		if err != nil || !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseConfig reads and compiles the rules of a YAML configuration.
+func ParseConfig(r io.Reader) (*Config, error) {
+	config := &Config{}
+	if err := yaml.NewDecoder(r).Decode(config); err != nil {
+		return nil, errors.Wrap(err, "could not parse alerting rules")
+	}
+	for _, rule := range config.Rules {
+		if err := rule.Compile(); err != nil {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+func LoadConfig(path string) (*Config, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return ParseConfig(f)
+}
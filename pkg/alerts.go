@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/huandu/go-sqlbuilder"
+	"time"
+)
+
+// Alert is a triggered alerting rule, as recorded in the alerts table.
+// The rules themselves are evaluated by the alert package.
+type Alert struct {
+	ID   int       `db:"id" json:"id"`
+	Rule string    `db:"rule" json:"rule"`
+	Date time.Time `db:"date" json:"date"`
+	// Count is the number of matching entries that triggered the rule.
+	Count int `db:"count" json:"count"`
+	// Entry is the JSON encoded entry that triggered the rule.
+	Entry json.RawMessage `db:"entry" json:"entry"`
+	// Entries are the JSON encoded entries counted by a rule with a
+	// min_count, the last of which is Entry. They are not stored in the
+	// alerts table.
+	Entries []json.RawMessage `db:"-" json:"entries,omitempty"`
+}
+
+func (l *LogWriter) createAlertsTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("alerts").
+		IfNotExists().
+		Define(l.columnDefinition("id", ColumnKindPrimaryKey)...).
+		Define("rule", "VARCHAR(255)", "NOT NULL").
+		Define("date", "TIMESTAMP", "NOT NULL").
+		Define("count", "INTEGER", "NOT NULL").
+		Define("entry", "TEXT")
+	_, err := l.db.ExecContext(ctx, ctb.String())
+	return err
+}
+
+// RecordAlert stores alert in the alerts table, and sets its ID.
+func (l *LogWriter) RecordAlert(ctx context.Context, alert *Alert) error {
+	q := sqlbuilder.NewInsertBuilder()
+	q.InsertInto("alerts").
+		Cols("rule", "date", "count", "entry").
+		Values(alert.Rule, alert.Date.UTC(), alert.Count, string(alert.Entry)).
+		SQL("RETURNING id")
+	s, args := q.Build()
+	return l.db.QueryRowxContext(ctx, l.db.Rebind(s), args...).Scan(&alert.ID)
+}
+
+// ListAlerts returns the alerts recorded since the given time (all of them if
+// since is zero), oldest first.
+func (l *LogWriter) ListAlerts(ctx context.Context, since time.Time) ([]*Alert, error) {
+	sb := sqlbuilder.Select("id", "rule", "date", "count", "entry").From("alerts").OrderBy("id ASC")
+	if !since.IsZero() {
+		sb.Where(sb.GE("date", since.UTC()))
+	}
+	s, args := sb.Build()
+
+	// entry is scanned as a string, as drivers return TEXT columns as such
+	rows := []struct {
+		Alert
+		Entry sql.NullString `db:"entry"`
+	}{}
+	if err := l.db.SelectContext(ctx, &rows, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+
+	ret := []*Alert{}
+	for _, row := range rows {
+		alert := row.Alert
+		if row.Entry.Valid {
+			alert.Entry = json.RawMessage(row.Entry.String)
+		}
+		ret = append(ret, &alert)
+	}
+	return ret, nil
+}
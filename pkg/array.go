@@ -0,0 +1,74 @@
+package pkg
+
+import "sort"
+
+// Arrays, such as the ones written by zerolog's Ints or Strs, are stored as
+// a single JSON value by default, which filters can only match as a whole.
+// With WithArrayExplosion, each element gets its own log_entries_meta row,
+// typed like any other value and numbered by the array_index column, so that
+// MetaFilters match the entries whose array contains a value:
+//
+//	lw.GetEntries(NewGetEntriesFilter(WithMetaContains("ids", 42)))
+//
+// GetEntries reassembles the elements into the array. Empty arrays and the
+// values of wide meta keys are still stored as JSON.
+
+// WithArrayExplosion stores the elements of array values as separate meta
+// rows. Entries written before keep their arrays as JSON.
+func WithArrayExplosion(enabled bool) LogWriterOption {
+	return func(l *LogWriter) {
+		l.explodeArrays = enabled
+	}
+}
+
+// explodeArray returns the values v is stored as, and whether they are the
+// elements of an exploded array.
+func (l *LogWriter) explodeArray(v interface{}, wide bool) ([]interface{}, bool) {
+	if a, ok := v.([]interface{}); ok && l.explodeArrays && !wide && len(a) > 0 {
+		return a, true
+	}
+	return []interface{}{v}, false
+}
+
+// WithMetaContains matches the entries whose array value for key contains v.
+// Arrays are only matched by element if they were exploded, see
+// WithArrayExplosion, otherwise this matches the entries whose value is v.
+func WithMetaContains(key string, v interface{}) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		if f.MetaFilters == nil {
+			f.MetaFilters = map[string]interface{}{}
+		}
+		f.MetaFilters[key] = v
+	}
+}
+
+type arrayElement struct {
+	index int
+	value interface{}
+}
+
+// explodedArrays collects the elements of exploded arrays read by loadMeta.
+type explodedArrays map[*LogEntry]map[string][]arrayElement
+
+func (a explodedArrays) add(entry *LogEntry, key string, index int, v interface{}) {
+	if a[entry] == nil {
+		a[entry] = map[string][]arrayElement{}
+	}
+	a[entry][key] = append(a[entry][key], arrayElement{index: index, value: v})
+}
+
+// assemble sets the arrays in the meta of their entries.
+func (a explodedArrays) assemble() {
+	for entry, keys := range a {
+		for key, elements := range keys {
+			sort.Slice(elements, func(i, j int) bool {
+				return elements[i].index < elements[j].index
+			})
+			values := make([]interface{}, elements[len(elements)-1].index+1)
+			for _, e := range elements {
+				values[e.index] = e.value
+			}
+			entry.Meta[key] = values
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestArrayExplosion(t *testing.T) {
+	lw := newImportLogWriter(t, WithArrayExplosion(true))
+
+	for _, line := range []string{
+		`{"level":"info","message":"first","ids":[1,42,3],"tags":["a",null,"b"]}`,
+		`{"level":"info","message":"second","ids":[4,5],"tags":[]}`,
+		`{"level":"info","message":"third","ids":42}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithMetaContains("ids", 42)))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, []interface{}{int64(1), int64(42), int64(3)}, entries[0].Meta["ids"])
+	assert.Equal(t, []interface{}{"a", nil, "b"}, entries[0].Meta["tags"])
+	assert.Equal(t, int64(42), entries[1].Meta["ids"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithQueryString(`tags="b"`)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "first", *entries[0].Message)
+
+	// empty arrays are stored as JSON
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaContains("ids", 5)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, []interface{}{}, entries[0].Meta["tags"])
+
+	rows, err := lw.Aggregate(nil, Count(), Sum("ids"))
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	// the first element of exploded arrays is aggregated
+	assert.Equal(t, 47.0, rows[0].Values["sum(ids)"])
+}
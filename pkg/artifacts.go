@@ -0,0 +1,281 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Artifacts are files attached to a session or to an entry, such as
+// screenshots, core dumps or rendered HTML. Their content is stored in the
+// data column of the artifacts table, offloaded to the blob directory like
+// large meta values (see WithBlobOffloading), or left in place, the artifact
+// then only referencing the path of the file.
+
+// Artifact describes a file attached to a session or an entry.
+type Artifact struct {
+	ID int `db:"id" json:"id"`
+	// SessionID is set for the artifacts of a session, and for the artifacts
+	// of entries that belong to a session.
+	SessionID  *string `db:"session_id" json:"session_id,omitempty"`
+	LogEntryID *int    `db:"log_entry_id" json:"log_entry_id,omitempty"`
+	Name       string  `db:"name" json:"name"`
+	// ContentType is detected from the content if not set.
+	ContentType string `db:"content_type" json:"content_type"`
+	Size        int64  `db:"size" json:"size"`
+	// Path is the file referenced by the artifact, see AddArtifactPath.
+	Path      *string   `db:"path" json:"path,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+type UnknownArtifactError struct {
+	ID int
+}
+
+func (e *UnknownArtifactError) Error() string {
+	return fmt.Sprintf("unknown artifact %d", e.ID)
+}
+
+// artifactColumns are the columns of Artifact, data being read separately.
+var artifactColumns = []string{"id", "session_id", "log_entry_id", "name", "content_type", "size", "path", "created_at"}
+
+func (l *LogWriter) createArtifactsTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("artifacts").
+		IfNotExists().
+		Define(l.columnDefinition("id", ColumnKindPrimaryKey)...).
+		Define("session_id", "VARCHAR(255)").
+		Define(l.columnDefinition("log_entry_id", ColumnKindInteger)...).
+		Define("name", "TEXT", "NOT NULL").
+		Define("content_type", "VARCHAR(255)", "NOT NULL").
+		Define(l.columnDefinition("size", ColumnKindInteger, "NOT NULL")...).
+		Define(l.columnDefinition("data", ColumnKindBlob)...).
+		Define("path", "TEXT").
+		Define("created_at", "TIMESTAMP", "NOT NULL")
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
+		return err
+	}
+	for _, col := range []string{"session_id", "log_entry_id"} {
+		query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS artifacts_%s_idx ON artifacts (%s)", col, col)
+		if _, err := l.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddArtifact stores data as an artifact of the session or the entry set in
+// artifact, and sets its ID, Size and CreatedAt. Data larger than the blob
+// threshold is offloaded to the blob directory, and encrypted first if
+// encryption is enabled.
+func (l *LogWriter) AddArtifact(ctx context.Context, artifact *Artifact, data []byte) error {
+	if artifact.ContentType == "" {
+		artifact.ContentType = http.DetectContentType(data)
+	}
+	artifact.Size = int64(len(data))
+	artifact.Path = nil
+
+	value := &metaValue{Type: LogEntryTypeBlob, Blob: sql.NullString{String: string(data), Valid: true}}
+	if err := l.encryptMetaValue(value); err != nil {
+		return errors.Wrap(err, "could not encrypt artifact")
+	}
+	if err := l.offloadBlob(value); err != nil {
+		return errors.Wrap(err, "could not offload artifact")
+	}
+	if value.Blob.String != string(data) {
+		// references and encrypted values are text, like those of meta values, see referencedBlobs
+		return l.insertArtifact(ctx, artifact, value.Blob.String)
+	}
+	return l.insertArtifact(ctx, artifact, data)
+}
+
+// AddArtifactPath attaches the file at path to the session or the entry set
+// in artifact, without copying it: reading the artifact reads the file.
+func (l *LogWriter) AddArtifactPath(ctx context.Context, artifact *Artifact, path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		return errors.Errorf("%s is a directory", path)
+	}
+	if artifact.Name == "" {
+		artifact.Name = filepath.Base(path)
+	}
+	if artifact.ContentType == "" {
+		artifact.ContentType = "application/octet-stream"
+	}
+	artifact.Size = fi.Size()
+	artifact.Path = &path
+	return l.insertArtifact(ctx, artifact, nil)
+}
+
+func (l *LogWriter) insertArtifact(ctx context.Context, artifact *Artifact, data interface{}) error {
+	if artifact.Name == "" {
+		return errors.New("artifacts need a name")
+	}
+	if artifact.LogEntryID != nil {
+		entry, err := l.GetEntryContext(ctx, *artifact.LogEntryID)
+		if err != nil {
+			return err
+		}
+		if artifact.SessionID == nil {
+			artifact.SessionID = entry.Session
+		}
+	} else if artifact.SessionID == nil {
+		return errors.New("artifacts need a session or an entry")
+	}
+
+	artifact.CreatedAt = time.Now().UTC()
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("artifacts").
+		Cols("session_id", "log_entry_id", "name", "content_type", "size", "data", "path", "created_at").
+		Values(artifact.SessionID, artifact.LogEntryID, artifact.Name, artifact.ContentType, artifact.Size,
+			data, artifact.Path, artifact.CreatedAt).
+		SQL("RETURNING id")
+	s, args := ib.Build()
+	return l.retryBusy(ctx, func() error {
+		return l.db.QueryRowxContext(ctx, l.db.Rebind(s), args...).Scan(&artifact.ID)
+	})
+}
+
+// ArtifactFilter selects artifacts for ListArtifacts. Empty fields match all artifacts.
+type ArtifactFilter struct {
+	SessionID  string
+	LogEntryID int
+}
+
+// ListArtifacts returns the artifacts matching filter, ordered by id. The
+// artifacts of a session include the artifacts of its entries.
+func (l *LogWriter) ListArtifacts(ctx context.Context, filter ArtifactFilter) ([]*Artifact, error) {
+	sb := sqlbuilder.Select(artifactColumns...).From("artifacts").OrderBy("id ASC")
+	if filter.SessionID != "" {
+		sb.Where(sb.E("session_id", filter.SessionID))
+	}
+	if filter.LogEntryID != 0 {
+		sb.Where(sb.E("log_entry_id", filter.LogEntryID))
+	}
+	return l.selectArtifacts(ctx, sb)
+}
+
+func (l *LogWriter) selectArtifacts(ctx context.Context, sb *sqlbuilder.SelectBuilder) ([]*Artifact, error) {
+	s, args := sb.Build()
+	ret := []*Artifact{}
+	if err := l.db.SelectContext(ctx, &ret, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetArtifact returns the artifact with the given id, or an UnknownArtifactError.
+func (l *LogWriter) GetArtifact(ctx context.Context, id int) (*Artifact, error) {
+	sb := sqlbuilder.Select(artifactColumns...).From("artifacts")
+	sb.Where(sb.E("id", id))
+	artifacts, err := l.selectArtifacts(ctx, sb)
+	if err != nil {
+		return nil, err
+	}
+	if len(artifacts) == 0 {
+		return nil, &UnknownArtifactError{ID: id}
+	}
+	return artifacts[0], nil
+}
+
+// ReadArtifact returns the artifact with the given id along with its content.
+func (l *LogWriter) ReadArtifact(ctx context.Context, id int) (*Artifact, []byte, error) {
+	artifact, err := l.GetArtifact(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if artifact.Path != nil {
+		b, err := os.ReadFile(*artifact.Path)
+		return artifact, b, err
+	}
+
+	sb := sqlbuilder.Select("data").From("artifacts")
+	sb.Where(sb.E("id", id))
+	s, args := sb.Build()
+	var data []byte
+	if err := l.db.GetContext(ctx, &data, l.db.Rebind(s), args...); err != nil {
+		return nil, nil, err
+	}
+	data, err = readBlob(l.blobDir, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	data, err = decryptValue(l.cipher, data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return artifact, data, nil
+}
+
+// ArtifactFileName returns the name of the file an artifact gets extracted to.
+func ArtifactFileName(artifact *Artifact) string {
+	return fmt.Sprintf("%d-%s", artifact.ID, filepath.Base(artifact.Name))
+}
+
+// ExtractArtifacts writes the artifacts of the entries matching filter and of
+// their sessions to dir, see ArtifactFileName, and returns them.
+func (l *LogWriter) ExtractArtifacts(ctx context.Context, filter *GetEntriesFilter, dir string) ([]*Artifact, error) {
+	ids, err := l.filteredIDs(filter)
+	if err != nil {
+		return nil, err
+	}
+	sessions := sqlbuilder.Select("session").From("log_entries")
+	sessions.Where(sessions.In("id", ids))
+
+	sb := sqlbuilder.Select(artifactColumns...).From("artifacts").OrderBy("id ASC")
+	sb.Where(sb.Or(
+		sb.In("log_entry_id", ids),
+		sb.And(sb.IsNull("log_entry_id"), sb.In("session_id", sessions)),
+	))
+	artifacts, err := l.selectArtifacts(ctx, sb)
+	if err != nil {
+		return nil, err
+	}
+	if len(artifacts) == 0 {
+		return artifacts, nil
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	for _, artifact := range artifacts {
+		_, data, err := l.ReadArtifact(ctx, artifact.ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read artifact %d", artifact.ID)
+		}
+		if err := os.WriteFile(filepath.Join(dir, ArtifactFileName(artifact)), data, 0o644); err != nil {
+			return nil, err
+		}
+	}
+	return artifacts, nil
+}
+
+// sessionArtifactBlobs returns the offloaded values referenced by the
+// artifacts of a session, see referencedBlobs.
+func (l *LogWriter) sessionArtifactBlobs(ctx context.Context, tx *sqlx.Tx, id string) ([]string, error) {
+	if l.blobDir == "" {
+		return nil, nil
+	}
+	sb := sqlbuilder.Select("data").From("artifacts")
+	sb.Where(sb.E("session_id", id), sb.Like("data", BlobRefPrefix+"%"))
+	s, args := sb.Build()
+	ret := []string{}
+	if err := tx.SelectContext(ctx, &ret, tx.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
@@ -0,0 +1,95 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArtifacts(t *testing.T) {
+	blobDir := filepath.Join(t.TempDir(), "blobs")
+	lw := newImportLogWriter(t, WithBlobOffloading(blobDir, 16))
+	ctx := context.Background()
+
+	for _, line := range []string{
+		`{"level":"info","session":"s1","message":"render"}`,
+		`{"level":"error","session":"s2","message":"crash"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	s1 := "s1"
+	entry := 2
+	small := &Artifact{SessionID: &s1, Name: "page.html"}
+	require.NoError(t, lw.AddArtifact(ctx, small, []byte("<html></html>")))
+	assert.Equal(t, "text/html; charset=utf-8", small.ContentType)
+	large := &Artifact{LogEntryID: &entry, Name: "core"}
+	content := []byte("a core dump larger than the blob threshold")
+	require.NoError(t, lw.AddArtifact(ctx, large, content))
+	require.NotNil(t, large.SessionID)
+	assert.Equal(t, "s2", *large.SessionID)
+
+	dumpPath := filepath.Join(t.TempDir(), "screenshot.png")
+	require.NoError(t, os.WriteFile(dumpPath, []byte("png"), 0o644))
+	referenced := &Artifact{SessionID: &s1}
+	require.NoError(t, lw.AddArtifactPath(ctx, referenced, dumpPath))
+	assert.Equal(t, "screenshot.png", referenced.Name)
+	assert.Equal(t, int64(3), referenced.Size)
+
+	assert.Error(t, lw.AddArtifact(ctx, &Artifact{Name: "orphan"}, []byte("x")))
+	missing := 10
+	var unknownEntry *UnknownEntryError
+	assert.ErrorAs(t, lw.AddArtifact(ctx, &Artifact{LogEntryID: &missing, Name: "x"}, []byte("x")), &unknownEntry)
+
+	artifacts, err := lw.ListArtifacts(ctx, ArtifactFilter{SessionID: "s1"})
+	require.NoError(t, err)
+	require.Len(t, artifacts, 2)
+	assert.Equal(t, "page.html", artifacts[0].Name)
+
+	for _, tc := range []struct {
+		id       int
+		expected []byte
+	}{
+		{small.ID, []byte("<html></html>")},
+		{large.ID, content},
+		{referenced.ID, []byte("png")},
+	} {
+		_, data, err := lw.ReadArtifact(ctx, tc.id)
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, data)
+	}
+	_, err = lw.GetArtifact(ctx, 42)
+	var unknown *UnknownArtifactError
+	assert.ErrorAs(t, err, &unknown)
+
+	dir := t.TempDir()
+	extracted, err := lw.ExtractArtifacts(ctx, NewGetEntriesFilter(WithLevel("error")), dir)
+	require.NoError(t, err)
+	require.Len(t, extracted, 1)
+	b, err := os.ReadFile(filepath.Join(dir, ArtifactFileName(large)))
+	require.NoError(t, err)
+	assert.Equal(t, content, b)
+
+	// the offloaded content is removed along with the entry
+	files, err := filepath.Glob(filepath.Join(blobDir, "*", "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, 1)
+	_, err = lw.DeleteEntries(NewGetEntriesFilter(WithLevel("error")))
+	require.NoError(t, err)
+	files, err = filepath.Glob(filepath.Join(blobDir, "*", "*"))
+	require.NoError(t, err)
+	assert.Empty(t, files)
+	artifacts, err = lw.ListArtifacts(ctx, ArtifactFilter{})
+	require.NoError(t, err)
+	assert.Len(t, artifacts, 2)
+
+	_, err = lw.DeleteSession("s1")
+	require.NoError(t, err)
+	artifacts, err = lw.ListArtifacts(ctx, ArtifactFilter{})
+	require.NoError(t, err)
+	assert.Empty(t, artifacts)
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Backup writes a consistent snapshot of the database to path while entries
+// keep being written, along with the offloaded values, which are copied to
+// DefaultBlobDir(path). An existing file at path is replaced. Only sqlite
+// databases can be backed up.
+//
+// Offloaded values removed by Prune or DeleteEntries while the backup runs
+// can be missing from the snapshot.
+func (l *LogWriter) Backup(ctx context.Context, path string) error {
+	if err := l.store.Backup(ctx, path); err != nil {
+		return err
+	}
+	if l.blobDir == "" {
+		return nil
+	}
+	// the snapshot is taken first, so that it can only reference values copied afterwards
+	return copyBlobDir(l.blobDir, DefaultBlobDir(path))
+}
+
+// copyBlobDir copies the offloaded values of src missing from dest.
+func copyBlobDir(src string, dest string) error {
+	if _, err := os.Stat(src); os.IsNotExist(err) {
+		return nil
+	}
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			// values can be removed while walking
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dest, rel)
+		if info.IsDir() {
+			return os.MkdirAll(target, 0o755)
+		}
+		// values being offloaded are written to temporary files first
+		if strings.Contains(info.Name(), ".tmp") {
+			return nil
+		}
+		// values are named after their content, an existing file is the same value
+		if _, err := os.Stat(target); err == nil {
+			return nil
+		}
+		err = copyFile(path, target)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	})
+}
+
+func copyFile(src string, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func(in *os.File) {
+		_ = in.Close()
+	}(in)
+
+	tmp := dest + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := out.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dest)
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogWriterBackup(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "live.db")
+	lw, err := OpenLogWriter(dbFile, nil, WithBlobOffloading(DefaultBlobDir(dbFile), 10))
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	large := strings.Repeat("x", 100)
+	_, err = lw.Write([]byte(`{"level": "info", "message": "first", "payload": {"data": "` + large + `"}}`))
+	require.NoError(t, err)
+
+	snapshot := filepath.Join(dir, "snapshot.db")
+	require.NoError(t, lw.Backup(context.Background(), snapshot))
+
+	// entries written afterwards aren't part of the snapshot
+	_, err = lw.Write([]byte(`{"level": "info", "message": "second"}`))
+	require.NoError(t, err)
+
+	backup, err := OpenLogWriter(snapshot, nil, WithBlobOffloading(DefaultBlobDir(snapshot), 0))
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(backup)
+	entries, err := backup.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "first", *entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"data": large}, entries[0].Meta["payload"])
+
+	// backups can be taken again over the previous one
+	require.NoError(t, lw.Backup(context.Background(), snapshot))
+	assert.NoFileExists(t, snapshot+".tmp")
+}
@@ -0,0 +1,208 @@
+package pkg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Large blob and JSON values can be offloaded to a content-addressed
+// directory, instead of being stored in the blob_value column. The column
+// then holds a reference (BlobRefPrefix followed by the sha256 of the value),
+// and the value is stored in <dir>/<first 2 hex digits>/<hash>.
+//
+// LogEntryMeta.Value reads offloaded values back transparently. Offloaded
+// values can't be matched by meta filters or the query language. Files are
+// removed along with the last entry referencing them, by Prune and
+// DeleteEntries.
+
+// BlobRefPrefix starts the blob_value of offloaded values.
+const BlobRefPrefix = "plunger-blob:sha256:"
+
+// DefaultBlobThreshold is the size in bytes above which values get offloaded
+// when offloading is enabled without a threshold.
+const DefaultBlobThreshold = 64 * 1024
+
+// DefaultBlobDir is the directory next to a sqlite file that offloaded
+// values are stored in.
+func DefaultBlobDir(dbFile string) string {
+	return sqlitePath(dbFile) + ".blobs"
+}
+
+// sqlitePath strips the parameters of sqlite DSNs, see ConcurrentSQLiteDSN.
+func sqlitePath(dsn string) string {
+	path, _, _ := strings.Cut(dsn, "?")
+	return strings.TrimPrefix(path, "file:")
+}
+
+// OffloadedBlobError is returned when an offloaded value can't be read back.
+type OffloadedBlobError struct {
+	Ref string
+	Err error
+}
+
+func (e *OffloadedBlobError) Error() string {
+	return fmt.Sprintf("could not read offloaded value %s: %s", e.Ref, e.Err)
+}
+
+func (e *OffloadedBlobError) Unwrap() error {
+	return e.Err
+}
+
+// WithBlobOffloading stores blob and JSON values larger than threshold bytes
+// in dir. Offloaded values are read from dir, so readers of a database with
+// offloaded values need this option as well; a threshold <= 0 only reads them.
+func WithBlobOffloading(dir string, threshold int) LogWriterOption {
+	return func(l *LogWriter) {
+		l.blobDir = dir
+		l.blobThreshold = threshold
+	}
+}
+
+func blobPath(dir string, hash string) string {
+	return filepath.Join(dir, hash[:2], hash)
+}
+
+// offloadBlob replaces the blob of value by a reference, after writing it to
+// the blob directory, if it exceeds the threshold.
+func (l *LogWriter) offloadBlob(value *metaValue) error {
+	if l.blobDir == "" || l.blobThreshold <= 0 || !value.Blob.Valid || len(value.Blob.String) <= l.blobThreshold {
+		return nil
+	}
+
+	sum := sha256.Sum256([]byte(value.Blob.String))
+	hash := hex.EncodeToString(sum[:])
+	path := blobPath(l.blobDir, hash)
+
+	// the file name is its content hash, so an existing file is the same value
+	if _, err := os.Stat(path); err != nil {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return err
+		}
+		// write to a temporary file first, so that readers never see a partial value
+		f, err := os.CreateTemp(filepath.Dir(path), hash+".tmp*")
+		if err != nil {
+			return err
+		}
+		if _, err := f.WriteString(value.Blob.String); err != nil {
+			_ = f.Close()
+			_ = os.Remove(f.Name())
+			return err
+		}
+		if err := f.Close(); err != nil {
+			_ = os.Remove(f.Name())
+			return err
+		}
+		if err := os.Rename(f.Name(), path); err != nil {
+			_ = os.Remove(f.Name())
+			return err
+		}
+	}
+
+	value.Blob.String = BlobRefPrefix + hash
+	return nil
+}
+
+// readBlob returns the value referenced by blob if it was offloaded, else blob itself.
+func readBlob(dir string, blob []byte) ([]byte, error) {
+	if len(blob) != len(BlobRefPrefix)+sha256.Size*2 || !strings.HasPrefix(string(blob), BlobRefPrefix) {
+		return blob, nil
+	}
+
+	ref := string(blob)
+	if dir == "" {
+		return nil, &OffloadedBlobError{Ref: ref, Err: errors.New("no blob directory configured")}
+	}
+	b, err := os.ReadFile(blobPath(dir, strings.TrimPrefix(ref, BlobRefPrefix)))
+	if err != nil {
+		return nil, &OffloadedBlobError{Ref: ref, Err: err}
+	}
+	return b, nil
+}
+
+type blobColumn struct {
+	table    string
+	column   string
+	idColumn string
+}
+
+// blobColumns returns the columns offloaded values can be referenced from.
+func (l *LogWriter) blobColumns() []blobColumn {
+	ret := []blobColumn{
+		{table: "log_entries_meta", column: "blob_value", idColumn: "log_entry_id"},
+		{table: "artifacts", column: "data", idColumn: "log_entry_id"},
+	}
+	for _, key := range l.schema.MetaKeys.Keys {
+		if key.Wide {
+			ret = append(ret, blobColumn{table: wideTable, column: wideColumn(key, "blob_value"), idColumn: "log_entry_id"})
+		}
+	}
+	return ret
+}
+
+// referencedBlobs returns the offloaded values referenced by the entries ids.
+func (l *LogWriter) referencedBlobs(ctx context.Context, tx *sqlx.Tx, ids []interface{}) ([]string, error) {
+	if l.blobDir == "" {
+		return nil, nil
+	}
+
+	refs := map[string]bool{}
+	for _, c := range l.blobColumns() {
+		sb := sqlbuilder.Select(c.column).From(c.table)
+		sb.Where(sb.In(c.idColumn, ids...), sb.Like(c.column, BlobRefPrefix+"%"))
+		s, args := sb.Build()
+		values := []string{}
+		if err := tx.SelectContext(ctx, &values, tx.Rebind(s), args...); err != nil {
+			return nil, err
+		}
+		for _, v := range values {
+			refs[v] = true
+		}
+	}
+
+	ret := []string{}
+	for ref := range refs {
+		ret = append(ret, ref)
+	}
+	return ret, nil
+}
+
+// removeUnreferencedBlobs removes the files of the offloaded values refs that
+// are not referenced by any entry anymore.
+//
+// A value offloaded concurrently by another writer reuses an existing file,
+// so deleting entries while other processes write the same values can lose them.
+func (l *LogWriter) removeUnreferencedBlobs(ctx context.Context, refs []string) error {
+	for _, ref := range refs {
+		referenced := false
+		for _, c := range l.blobColumns() {
+			sb := sqlbuilder.Select("1").From(c.table)
+			sb.Where(sb.E(c.column, ref)).Limit(1)
+			s, args := sb.Build()
+			values := []int{}
+			if err := l.db.SelectContext(ctx, &values, l.db.Rebind(s), args...); err != nil {
+				return err
+			}
+			if len(values) > 0 {
+				referenced = true
+				break
+			}
+		}
+		if referenced {
+			continue
+		}
+
+		path := blobPath(l.blobDir, strings.TrimPrefix(ref, BlobRefPrefix))
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
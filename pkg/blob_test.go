@@ -0,0 +1,66 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBlobOffloading(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "test.db")
+	blobDir := DefaultBlobDir(dbFile)
+	assert.Equal(t, dbFile+".blobs", DefaultBlobDir(ConcurrentSQLiteDSN(dbFile)))
+
+	db := sqlx.MustOpen("sqlite3", dbFile)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	schema := NewSchema()
+	schema.MetaKeys.Add("payload").Wide = true
+	lw := NewLogWriter(db, schema, WithBlobOffloading(blobDir, 100), WithWideTable(true))
+	require.NoError(t, lw.Init())
+
+	large := strings.Repeat("x", 200)
+	for _, line := range []string{
+		`{"level": "info", "small": {"a": 1}, "large": {"text": "` + large + `"}}`,
+		`{"level": "info", "large": {"text": "` + large + `"}, "payload": ["` + large + `"]}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	var refs []string
+	require.NoError(t, db.Select(&refs, "SELECT blob_value FROM log_entries_meta WHERE name = 'large'"))
+	require.Len(t, refs, 2)
+	assert.True(t, strings.HasPrefix(refs[0], BlobRefPrefix))
+	// identical values are stored once
+	assert.Equal(t, refs[0], refs[1])
+	files, err := filepath.Glob(filepath.Join(blobDir, "*", "*"))
+	require.NoError(t, err)
+	assert.Len(t, files, 2)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, map[string]interface{}{"a": float64(1)}, entries[0].Meta["small"])
+	assert.Equal(t, map[string]interface{}{"text": large}, entries[0].Meta["large"])
+	assert.Equal(t, []interface{}{large}, entries[1].Meta["payload"])
+
+	// readers without the blob directory can't read the values back
+	reader := NewLogWriter(db, NewSchema())
+	require.NoError(t, reader.Init())
+	_, err = reader.GetEntries(nil)
+	var blobErr *OffloadedBlobError
+	assert.ErrorAs(t, err, &blobErr)
+
+	require.NoError(t, os.RemoveAll(blobDir))
+	_, err = lw.GetEntries(nil)
+	assert.ErrorAs(t, err, &blobErr)
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,64 @@
+package pkg
+
+import (
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// Keys of the build information recorded on sessions by RecordBuildInfo, so
+// that sessions can be listed by the build that produced them with
+// WithSessionFilterMetadata(GitSHAKey, sha).
+const (
+	GoVersionKey     = "go_version"
+	ModulePathKey    = "module_path"
+	ModuleVersionKey = "module_version"
+	GitSHAKey        = "git_sha"
+	GitDirtyKey      = "git_dirty"
+	GitTimeKey       = "git_time"
+)
+
+// BuildInfo returns the build information of the running binary: the go
+// version, the path and version of the main module and, for binaries built
+// from a git checkout, the revision, the commit time and whether the working
+// tree had uncommitted changes.
+func BuildInfo() map[string]interface{} {
+	ret := map[string]interface{}{
+		GoVersionKey: runtime.Version(),
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ret
+	}
+	if info.Main.Path != "" {
+		ret[ModulePathKey] = info.Main.Path
+	}
+	if info.Main.Version != "" {
+		ret[ModuleVersionKey] = info.Main.Version
+	}
+	for _, setting := range info.Settings {
+		switch setting.Key {
+		case "vcs.revision":
+			ret[GitSHAKey] = setting.Value
+		case "vcs.modified":
+			ret[GitDirtyKey] = setting.Value == "true"
+		case "vcs.time":
+			ret[GitTimeKey] = setting.Value
+		}
+	}
+	return ret
+}
+
+// RecordBuildInfo stores BuildInfo in the metadata of the session entries are
+// written to, creating the session if it doesn't exist yet. It does nothing if
+// entries aren't written to a session.
+func (l *LogWriter) RecordBuildInfo() error {
+	if l.session == "" {
+		return nil
+	}
+	sm := l.Sessions()
+	if err := sm.ensureSession(&Session{ID: l.session, CreatedAt: time.Now().UTC()}); err != nil {
+		return err
+	}
+	return sm.SetMetadata(l.session, BuildInfo())
+}
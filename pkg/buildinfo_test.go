@@ -0,0 +1,37 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestRecordBuildInfo(t *testing.T) {
+	lw, _, err := InitLogging(&LoggerConfig{
+		DBFile:          filepath.Join(t.TempDir(), "test.db"),
+		Session:         "build",
+		RecordBuildInfo: true,
+	})
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	sm := lw.Sessions()
+	session, err := sm.GetSession("build")
+	require.NoError(t, err)
+	assert.Equal(t, runtime.Version(), session.Metadata[GoVersionKey])
+
+	// recording again keeps the other metadata of the session
+	require.NoError(t, sm.SetMetadata("build", map[string]interface{}{"host": "ci"}))
+	require.NoError(t, lw.RecordBuildInfo())
+	summaries, err := sm.ListSessions(WithSessionFilterMetadata(GoVersionKey, runtime.Version()), WithSessionFilterMetadata("host", "ci"))
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, "build", summaries[0].ID)
+
+	lw.session = ""
+	assert.NoError(t, lw.RecordBuildInfo())
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"database/sql"
+	"encoding/json"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/rs/zerolog"
+	"strconv"
+	"strings"
+)
+
+// The caller field added by zerolog's Caller() is stored in the caller_file
+// and caller_line columns of log_entries rather than as meta, so that entries
+// can be filtered by file with WithCaller. The stack added by Stack() is kept
+// as a JSON meta value.
+
+// entryCaller holds the caller columns of a log entry.
+type entryCaller struct {
+	File sql.NullString
+	Line sql.NullInt64
+}
+
+// parseCaller splits a zerolog caller, file:line, into its columns.
+func parseCaller(v interface{}) (entryCaller, bool) {
+	s, ok := v.(string)
+	if !ok || s == "" {
+		return entryCaller{}, false
+	}
+	ret := entryCaller{File: sql.NullString{String: s, Valid: true}}
+	if i := strings.LastIndex(s, ":"); i > 0 {
+		if line, err := strconv.ParseInt(s[i+1:], 10, 64); err == nil {
+			ret.File.String = s[:i]
+			ret.Line = sql.NullInt64{Int64: line, Valid: true}
+		}
+	}
+	return ret, true
+}
+
+// Caller returns the caller of the entry as file:line, empty if it has none.
+func (e *LogEntry) Caller() string {
+	if e.CallerFile == nil {
+		return ""
+	}
+	if e.CallerLine == nil {
+		return *e.CallerFile
+	}
+	return *e.CallerFile + ":" + strconv.Itoa(*e.CallerLine)
+}
+
+func (e *LogEntry) caller() entryCaller {
+	ret := entryCaller{}
+	if e.CallerFile != nil {
+		ret.File = sql.NullString{String: *e.CallerFile, Valid: true}
+	}
+	if e.CallerLine != nil {
+		ret.Line = sql.NullInt64{Int64: int64(*e.CallerLine), Valid: true}
+	}
+	return ret
+}
+
+// decodeStack decodes a stack logged as a JSON string, so that it is stored
+// as a JSON value like the stacks marshaled by zerolog.ErrorStackMarshaler.
+func decodeStack(log map[string]interface{}) {
+	s, ok := log[zerolog.ErrorStackFieldName].(string)
+	if !ok || !(strings.HasPrefix(s, "[") || strings.HasPrefix(s, "{")) {
+		return
+	}
+	var stack interface{}
+	if err := json.Unmarshal([]byte(s), &stack); err == nil {
+		log[zerolog.ErrorStackFieldName] = stack
+	}
+}
+
+// WithCaller matches the entries logged from a file whose path contains
+// caller, for example "pkg/foo" or "pkg/foo/bar.go". A line can be given as
+// well, as in "bar.go:42".
+func WithCaller(caller string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Caller = caller
+	}
+}
+
+func callerCondition(c *sqlbuilder.Cond, caller string) string {
+	if i := strings.LastIndex(caller, ":"); i > 0 {
+		if line, err := strconv.Atoi(caller[i+1:]); err == nil {
+			return c.And(
+				c.Like("caller_file", "%"+caller[:i]),
+				c.E("caller_line", line),
+			)
+		}
+	}
+	return c.Like("caller_file", "%"+caller+"%")
+}
@@ -0,0 +1,41 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCallerColumns(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	_, err := lw.Write([]byte(`{"level":"error","message":"failed","caller":"/src/pkg/foo/bar.go:42",` +
+		`"stack":"[{\"func\":\"run\",\"line\":\"42\"}]"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level":"info","message":"started","caller":"/src/cmd/main.go:10"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level":"info","message":"no caller"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "/src/pkg/foo/bar.go:42", entries[0].Caller())
+	assert.NotContains(t, entries[0].Meta, "caller")
+	assert.Equal(t, []interface{}{map[string]interface{}{"func": "run", "line": "42"}}, entries[0].Meta["stack"])
+	assert.Equal(t, "", entries[2].Caller())
+
+	messages := func(filter *GetEntriesFilter) []string {
+		entries, err := lw.GetEntries(filter)
+		require.NoError(t, err)
+		ret := []string{}
+		for _, entry := range entries {
+			ret = append(ret, *entry.Message)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"failed"}, messages(NewGetEntriesFilter(WithCaller("pkg/foo"))))
+	assert.Equal(t, []string{"failed"}, messages(NewGetEntriesFilter(WithCaller("bar.go:42"))))
+	assert.Empty(t, messages(NewGetEntriesFilter(WithCaller("bar.go:43"))))
+	assert.Equal(t, []string{"started"}, messages(NewGetEntriesFilter(WithQueryString(`caller~"cmd"`))))
+}
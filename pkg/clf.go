@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CLFTimeFormat is the format of the timestamps of the Common Log Format.
+const CLFTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// clfPattern matches the Common Log Format of web servers, and the Combined
+// Log Format, which adds the referer and user agent.
+var clfPattern = regexp.MustCompile(`^(\S+) (\S+) (\S+) \[([^\]]+)\] "([^"\\]*(?:\\.[^"\\]*)*)" (\d{3}|-) (\d+|-)` +
+	`(?: "([^"\\]*(?:\\.[^"\\]*)*)" "([^"\\]*(?:\\.[^"\\]*)*)")?`)
+
+// CLFLineParser parses the access logs of web servers, see ParseCLF.
+var CLFLineParser LineParser = LineParserFunc(ParseCLF)
+
+// ParseCLF parses a line of the Common or Combined Log Format, such as
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /index.html HTTP/1.0" 200 2326 "-" "curl/8.0"
+//
+// The request line is stored as the message, and split into method, path and
+// protocol. The level is error for 5xx statuses, warn for 4xx statuses and
+// info otherwise. Fields logged as - are left out.
+func ParseCLF(line []byte) (map[string]interface{}, error) {
+	match := clfPattern.FindStringSubmatch(string(line))
+	if match == nil {
+		return nil, errors.New("line isn't in the common log format")
+	}
+	t, err := time.Parse(CLFTimeFormat, match[4])
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid timestamp %q", match[4])
+	}
+
+	entry := map[string]interface{}{
+		zerolog.TimestampFieldName: t.UTC(),
+		zerolog.MessageFieldName:   match[5],
+		"level":                    "info",
+	}
+	for key, v := range map[string]string{
+		"remote_host": match[1],
+		"ident":       match[2],
+		"user":        match[3],
+		"referer":     match[8],
+		"user_agent":  match[9],
+	} {
+		if v != "" && v != "-" {
+			entry[key] = v
+		}
+	}
+	if method, rest, ok := strings.Cut(match[5], " "); ok {
+		entry["method"] = method
+		if path, protocol, ok := strings.Cut(rest, " "); ok {
+			entry["path"], entry["protocol"] = path, protocol
+		} else {
+			entry["path"] = rest
+		}
+	}
+	if status, err := strconv.ParseInt(match[6], 10, 64); err == nil {
+		entry["status"] = status
+		switch {
+		case status >= 500:
+			entry["level"] = "error"
+		case status >= 400:
+			entry["level"] = "warn"
+		}
+	}
+	if size, err := strconv.ParseInt(match[7], 10, 64); err == nil {
+		entry["bytes"] = size
+	}
+	return entry, nil
+}
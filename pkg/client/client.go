@@ -0,0 +1,268 @@
+// Package client talks to a remote plunger server, either the JSON API of
+// plunger web or the gRPC service of plunger grpc-serve.
+//
+// Both clients implement pkg.LogReadWriter, like pkg.LogWriter, so that tools
+// written against that interface run the same locally and remotely:
+//
+//	lrw, err := client.Open("http://localhost:8080")
+//	...
+//	defer lrw.Close()
+//	entries, err := lrw.GetEntries(pkg.NewGetEntriesFilter(pkg.WithLevel("error")))
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/rpc"
+	"github.com/go-go-golems/plunger/pkg/web"
+	"github.com/pkg/errors"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// UnsupportedTargetError is returned by Open for targets that are neither
+// http(s):// nor grpc:// URLs.
+type UnsupportedTargetError struct {
+	Target string
+}
+
+func (e *UnsupportedTargetError) Error() string {
+	return fmt.Sprintf("unsupported target %q, expected an http://, https:// or grpc:// URL", e.Target)
+}
+
+// ServerError is returned when the server answers a request with an error.
+type ServerError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *ServerError) Error() string {
+	return fmt.Sprintf("server error %d: %s", e.StatusCode, e.Message)
+}
+
+// Open connects to the server at target: http:// and https:// URLs use the
+// JSON API, grpc://host:port URLs the gRPC service.
+func Open(target string) (pkg.LogReadWriter, error) {
+	switch {
+	case strings.HasPrefix(target, "http://"), strings.HasPrefix(target, "https://"):
+		return New(target), nil
+	case strings.HasPrefix(target, "grpc://"):
+		return rpc.Dial(strings.TrimPrefix(target, "grpc://"))
+	default:
+		return nil, &UnsupportedTargetError{Target: target}
+	}
+}
+
+// Client talks to the JSON API served by plunger web, see web.Server.
+//
+// It implements io.Writer, so that it can be used as zerolog output. Each
+// line is sent in its own request, use the gRPC client for higher volumes.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+}
+
+var _ pkg.LogReadWriter = (*Client)(nil)
+
+type Option func(*Client)
+
+// WithHTTPClient sets the client requests are sent with, http.DefaultClient by default.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+// New returns a client of the server at baseURL, such as http://localhost:8080.
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Close() error {
+	c.httpClient.CloseIdleConnections()
+	return nil
+}
+
+// Write sends a single log line.
+func (c *Client) Write(p []byte) (int, error) {
+	return c.WriteContext(context.Background(), p)
+}
+
+func (c *Client) WriteContext(ctx context.Context, p []byte) (int, error) {
+	// zerolog reuses its buffers once Write returns, which the transport may
+	// still be reading from
+	line := make([]byte, len(p))
+	copy(line, p)
+	progress := &pkg.ImportProgress{}
+	if err := c.do(ctx, http.MethodPost, "/api/ingest?format=json", bytes.NewReader(line), progress); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (c *Client) GetEntries(filter *pkg.GetEntriesFilter) ([]*pkg.LogEntry, error) {
+	return c.GetEntriesContext(context.Background(), filter)
+}
+
+// GetEntriesContext returns all the entries matching filter, fetching them a
+// page at a time.
+func (c *Client) GetEntriesContext(ctx context.Context, filter *pkg.GetEntriesFilter) ([]*pkg.LogEntry, error) {
+	return pkg.CollectPages(ctx, filter, c.GetEntriesPageContext)
+}
+
+// GetEntriesPageContext returns a page of the entries matching filter, see pkg.LogWriter.GetEntriesPage.
+func (c *Client) GetEntriesPageContext(ctx context.Context, filter *pkg.GetEntriesFilter) (*pkg.EntriesPage, error) {
+	q, err := web.FilterToQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	page := &pkg.EntriesPage{}
+	if err := c.do(ctx, http.MethodGet, "/api/entries?"+q.Encode(), nil, page); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// GetEntry returns a single entry, see pkg.LogWriter.GetEntry.
+func (c *Client) GetEntry(ctx context.Context, id int) (*pkg.LogEntry, error) {
+	entry := &pkg.LogEntry{}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/entries/%d", id), nil, entry); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// GetEntryGraph returns an entry along with the entries linked to it, see pkg.LogWriter.GetEntryGraph.
+func (c *Client) GetEntryGraph(ctx context.Context, id int, depth int) (*pkg.EntryGraph, error) {
+	graph := &pkg.EntryGraph{}
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/api/entries/%d/graph?depth=%d", id, depth), nil, graph); err != nil {
+		return nil, err
+	}
+	return graph, nil
+}
+
+// Sessions lists the sessions of the database.
+func (c *Client) Sessions(ctx context.Context) ([]*pkg.SessionSummary, error) {
+	sessions := []*pkg.SessionSummary{}
+	if err := c.do(ctx, http.MethodGet, "/api/sessions", nil, &sessions); err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+// Stats returns the overview computed by pkg.LogWriter.Stats.
+func (c *Client) Stats(ctx context.Context, filter *pkg.GetEntriesFilter, valueKeys ...string) ([]*pkg.StatsSection, error) {
+	q, err := web.FilterToQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range valueKeys {
+		q.Add("key", key)
+	}
+	sections := []*pkg.StatsSection{}
+	if err := c.do(ctx, http.MethodGet, "/api/stats?"+q.Encode(), nil, &sections); err != nil {
+		return nil, err
+	}
+	return sections, nil
+}
+
+// Follow streams the entries matching filter as they get written, see
+// pkg.LogWriter.Follow. The channel is closed once ctx is done or the stream
+// fails.
+func (c *Client) Follow(ctx context.Context, filter *pkg.GetEntriesFilter) (<-chan *pkg.LogEntry, error) {
+	q, err := web.FilterToQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/api/tail?"+q.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer func() {
+			_ = res.Body.Close()
+		}()
+		return nil, readServerError(res)
+	}
+
+	ch := make(chan *pkg.LogEntry)
+	go func() {
+		defer close(ch)
+		defer func() {
+			_ = res.Body.Close()
+		}()
+
+		scanner := bufio.NewScanner(res.Body)
+		// entries can be larger than the default token size
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			// events are a single data line, ids and keep-alive comments are skipped
+			line := scanner.Text()
+			if !strings.HasPrefix(line, "data: ") {
+				continue
+			}
+			entry := &pkg.LogEntry{}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), entry); err != nil {
+				return
+			}
+			select {
+			case ch <- entry:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// do sends a request and decodes its JSON response into v.
+func (c *Client) do(ctx context.Context, method string, path string, body io.Reader, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return readServerError(res)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return errors.Wrapf(err, "could not decode the response of %s", path)
+	}
+	return nil
+}
+
+// readServerError reads the error written by the server, see web.writeError.
+func readServerError(res *http.Response) error {
+	ret := &ServerError{StatusCode: res.StatusCode, Message: res.Status}
+	body := struct {
+		Error string `json:"error"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&body); err == nil && body.Error != "" {
+		ret.Message = body.Error
+	}
+	return ret
+}
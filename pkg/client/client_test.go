@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/rpc"
+	"github.com/go-go-golems/plunger/pkg/web"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"net"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestLogWriter(t *testing.T) *pkg.LogWriter {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	lw := pkg.NewLogWriter(db, pkg.NewSchema(), pkg.WithFollowInterval(10*time.Millisecond))
+	require.NoError(t, lw.Init())
+	return lw
+}
+
+// testLogReadWriter runs the same checks against a local and a remote LogReadWriter.
+func testLogReadWriter(t *testing.T, lrw pkg.LogReadWriter) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	logger := zerolog.New(lrw)
+	logger.Info().Str("user", "alice").Int("n", 1).Msg("first")
+	logger.Error().Str("user", "bob").Str("code", "1").Int("n", 7).Msg("second")
+
+	entries, err := lrw.GetEntries(pkg.NewGetEntriesFilter(
+		pkg.WithMetaFilters(map[string]interface{}{"code": "1"}),
+	))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", *entries[0].Message)
+	assert.Equal(t, "bob", entries[0].Meta["user"])
+
+	entries, err = lrw.GetEntriesContext(ctx, pkg.NewGetEntriesFilter(pkg.WithQueryString(`user="alice"`)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "first", *entries[0].Message)
+
+	entries, err = lrw.GetEntriesContext(ctx, pkg.NewGetEntriesFilter(pkg.WithMetaBetween("n", 5, nil)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", *entries[0].Message)
+
+	ch, err := lrw.Follow(ctx, pkg.NewGetEntriesFilter(pkg.WithLevel("warn")))
+	require.NoError(t, err)
+	logger.Info().Msg("skipped")
+	logger.Warn().Msg("followed")
+	select {
+	case entry := <-ch:
+		require.NotNil(t, entry)
+		assert.Equal(t, "followed", *entry.Message)
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for entry")
+	}
+}
+
+func TestLocalLogReadWriter(t *testing.T) {
+	testLogReadWriter(t, newTestLogWriter(t))
+}
+
+func TestClient(t *testing.T) {
+	lw := newTestLogWriter(t)
+	server := httptest.NewServer(web.NewServer(lw))
+	t.Cleanup(server.Close)
+
+	lrw, err := Open(server.URL + "/")
+	require.NoError(t, err)
+	defer func() {
+		_ = lrw.Close()
+	}()
+	testLogReadWriter(t, lrw)
+
+	c := lrw.(*Client)
+	ctx := context.Background()
+	entry, err := c.GetEntry(ctx, 1)
+	require.NoError(t, err)
+	assert.Equal(t, "first", *entry.Message)
+
+	_, err = c.GetEntry(ctx, 100)
+	serverErr, ok := err.(*ServerError)
+	require.True(t, ok)
+	assert.Equal(t, 404, serverErr.StatusCode)
+	assert.Equal(t, "unknown entry 100", serverErr.Message)
+
+	_, err = c.Write([]byte("not json"))
+	assert.Error(t, err)
+
+	_, err = Open("ftp://localhost")
+	assert.IsType(t, &UnsupportedTargetError{}, err)
+}
+
+func TestGRPCClient(t *testing.T) {
+	lw := newTestLogWriter(t)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	server := grpc.NewServer()
+	rpc.RegisterServer(server, rpc.NewServer(lw))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	lrw, err := Open("grpc://" + listener.Addr().String())
+	require.NoError(t, err)
+	defer func() {
+		_ = lrw.Close()
+	}()
+	testLogReadWriter(t, lrw)
+}
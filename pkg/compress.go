@@ -0,0 +1,215 @@
+package pkg
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/klauspost/compress/zstd"
+	"github.com/pkg/errors"
+	"io"
+)
+
+// Blob and JSON values larger than a threshold can be compressed. The
+// algorithm is recorded in the compression column of log_entries_meta, and
+// LogEntryMeta.Value decompresses transparently.
+//
+// Compressed values can't be matched by meta filters, and values of wide
+// meta keys are never compressed.
+
+type Compression string
+
+const (
+	CompressionNone Compression = ""
+	CompressionGzip Compression = "gzip"
+	CompressionZstd Compression = "zstd"
+)
+
+// DefaultCompressionThreshold is the size in bytes above which values get
+// compressed when compression is enabled without a threshold.
+const DefaultCompressionThreshold = 1024
+
+type InvalidCompressionError struct {
+	Compression string
+}
+
+func (e *InvalidCompressionError) Error() string {
+	return "invalid compression " + e.Compression + " (expected none, gzip or zstd)"
+}
+
+func ParseCompression(s string) (Compression, error) {
+	switch s {
+	case "", "none":
+		return CompressionNone, nil
+	case string(CompressionGzip), string(CompressionZstd):
+		return Compression(s), nil
+	}
+	return "", &InvalidCompressionError{Compression: s}
+}
+
+// WithCompression compresses blob and JSON values larger than threshold bytes
+// (DefaultCompressionThreshold if threshold <= 0).
+func WithCompression(compression Compression, threshold int) LogWriterOption {
+	return func(l *LogWriter) {
+		if threshold <= 0 {
+			threshold = DefaultCompressionThreshold
+		}
+		l.compression = compression
+		l.compressionThreshold = threshold
+	}
+}
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+func compress(compression Compression, b []byte) ([]byte, error) {
+	switch compression {
+	case CompressionZstd:
+		return zstdEncoder.EncodeAll(b, nil), nil
+	case CompressionGzip:
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(b); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CompressionNone:
+		return b, nil
+	}
+	return nil, &InvalidCompressionError{Compression: string(compression)}
+}
+
+func decompress(compression Compression, b []byte) ([]byte, error) {
+	switch compression {
+	case CompressionZstd:
+		return zstdDecoder.DecodeAll(b, nil)
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(b))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	case CompressionNone:
+		return b, nil
+	}
+	return nil, &InvalidCompressionError{Compression: string(compression)}
+}
+
+// compressBlob compresses the blob of value if it exceeds the threshold, and
+// the compressed value is actually smaller.
+func (l *LogWriter) compressBlob(value *metaValue) error {
+	if l.compression == CompressionNone || !value.Blob.Valid || len(value.Blob.String) <= l.compressionThreshold {
+		return nil
+	}
+
+	b, err := compress(l.compression, []byte(value.Blob.String))
+	if err != nil {
+		return err
+	}
+	if len(b) >= len(value.Blob.String) {
+		return nil
+	}
+	value.Blob.String = string(b)
+	value.Compression = sql.NullString{String: string(l.compression), Valid: true}
+	return nil
+}
+
+// CompactResult is returned by Compact.
+type CompactResult struct {
+	// Values is the number of values that got compressed.
+	Values int `json:"values"`
+	// BytesBefore and BytesAfter are the total size of these values.
+	BytesBefore int64 `json:"bytes_before"`
+	BytesAfter  int64 `json:"bytes_after"`
+}
+
+// compactBatchSize is the number of values compressed per transaction by Compact.
+const compactBatchSize = 500
+
+// Compact compresses the existing values that exceed the compression
+// threshold of the LogWriter, see WithCompression. The space is only given
+// back to the filesystem once the database is vacuumed.
+func (l *LogWriter) Compact(ctx context.Context) (*CompactResult, error) {
+	if l.compression == CompressionNone {
+		return nil, errors.New("compact requires a compression, see WithCompression")
+	}
+
+	ret := &CompactResult{}
+	lastID := 0
+	for {
+		sb := sqlbuilder.Select("id", "blob_value").From("log_entries_meta")
+		sb.Where(
+			sb.G("id", lastID),
+			sb.IsNull("compression"),
+			sb.In("type", LogEntryTypeBlob, LogEntryTypeJSON),
+			sb.IsNotNull("blob_value"),
+			// encrypted values are decrypted before being decompressed
+			sb.NotLike("blob_value", EncryptedValuePrefix+"%"),
+			sb.NotLike("blob_value", EncryptedFieldPrefix+"%"),
+		).OrderBy("id ASC").Limit(compactBatchSize)
+		s, args := sb.Build()
+
+		rows := []struct {
+			ID   int    `db:"id"`
+			Blob []byte `db:"blob_value"`
+		}{}
+		if err := l.db.SelectContext(ctx, &rows, l.db.Rebind(s), args...); err != nil {
+			return ret, err
+		}
+		if len(rows) == 0 {
+			return ret, nil
+		}
+		lastID = rows[len(rows)-1].ID
+
+		err := l.retryBusy(ctx, func() error {
+			tx, err := l.db.BeginTxx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			res := *ret
+			for _, row := range rows {
+				value := &metaValue{Blob: sql.NullString{String: string(row.Blob), Valid: true}}
+				if err := l.compressBlob(value); err != nil {
+					_ = tx.Rollback()
+					return err
+				}
+				if !value.Compression.Valid {
+					continue
+				}
+				if err := updateCompressedBlob(ctx, tx, row.ID, value); err != nil {
+					_ = tx.Rollback()
+					return err
+				}
+				res.Values++
+				res.BytesBefore += int64(len(row.Blob))
+				res.BytesAfter += int64(len(value.Blob.String))
+			}
+			if err := tx.Commit(); err != nil {
+				return err
+			}
+			*ret = res
+			return nil
+		})
+		if err != nil {
+			return ret, err
+		}
+	}
+}
+
+func updateCompressedBlob(ctx context.Context, tx *sqlx.Tx, id int, value *metaValue) error {
+	ub := sqlbuilder.Update("log_entries_meta")
+	ub.Set(
+		ub.Assign("blob_value", value.blobArg()),
+		ub.Assign("compression", value.Compression),
+	).Where(ub.E("id", id))
+	s, args := ub.Build()
+	_, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+	return err
+}
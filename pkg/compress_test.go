@@ -0,0 +1,82 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestCompression(t *testing.T) {
+	for _, compression := range []Compression{CompressionGzip, CompressionZstd} {
+		t.Run(string(compression), func(t *testing.T) {
+			lw := newImportLogWriter(t, WithCompression(compression, 100))
+
+			large := strings.Repeat("abc", 100)
+			_, err := lw.Write([]byte(`{"level": "info", "small": {"a": 1}, "large": {"text": "` + large + `"}}`))
+			require.NoError(t, err)
+
+			var stored []struct {
+				Name        string  `db:"name"`
+				Compression *string `db:"compression"`
+				Size        int     `db:"size"`
+			}
+			require.NoError(t, lw.db.Select(&stored,
+				"SELECT name, compression, LENGTH(CAST(blob_value AS BLOB)) AS size FROM log_entries_meta ORDER BY name"))
+			require.Len(t, stored, 2)
+			assert.Equal(t, "large", stored[0].Name)
+			require.NotNil(t, stored[0].Compression)
+			assert.Equal(t, string(compression), *stored[0].Compression)
+			assert.Less(t, stored[0].Size, 100)
+			assert.Nil(t, stored[1].Compression)
+
+			entries, err := lw.GetEntries(nil)
+			require.NoError(t, err)
+			require.Len(t, entries, 1)
+			assert.Equal(t, map[string]interface{}{"text": large}, entries[0].Meta["large"])
+			assert.Equal(t, map[string]interface{}{"a": float64(1)}, entries[0].Meta["small"])
+		})
+	}
+}
+
+func TestCompact(t *testing.T) {
+	lw := newImportLogWriter(t)
+	large := strings.Repeat("abc", 1000)
+	for i := 0; i < 3; i++ {
+		_, err := lw.Write([]byte(`{"level": "info", "large": "` + large + `", "blob": {"text": "` + large + `"}}`))
+		require.NoError(t, err)
+	}
+
+	_, err := lw.Compact(context.Background())
+	assert.Error(t, err)
+
+	WithCompression(CompressionZstd, 0)(lw)
+	res, err := lw.Compact(context.Background())
+	require.NoError(t, err)
+	// text values are left alone
+	assert.Equal(t, 3, res.Values)
+	assert.Less(t, res.BytesAfter, res.BytesBefore)
+
+	res, err = lw.Compact(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Values)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, map[string]interface{}{"text": large}, entries[2].Meta["blob"])
+	assert.Equal(t, large, entries[2].Meta["large"])
+}
+
+func TestParseCompression(t *testing.T) {
+	c, err := ParseCompression("none")
+	require.NoError(t, err)
+	assert.Equal(t, CompressionNone, c)
+	c, err = ParseCompression("zstd")
+	require.NoError(t, err)
+	assert.Equal(t, CompressionZstd, c)
+	_, err = ParseCompression("lz4")
+	var compressionErr *InvalidCompressionError
+	assert.ErrorAs(t, err, &compressionErr)
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// Several processes can write to the same sqlite file, for example a service
+// and a CLI tool importing logs next to it. sqlite serializes writers with a
+// database-wide lock, and fails with SQLITE_BUSY if the lock can't be
+// acquired. Writing concurrently requires:
+//
+//   - opening the database with ConcurrentSQLiteDSN, which enables WAL mode
+//     (readers don't block the writer), a busy timeout, and immediate
+//     transactions (so that the lock is taken at BEGIN, and not upgraded
+//     in the middle of a transaction, which sqlite can't wait for);
+//   - WithBusyRetry, which retries the transactions that still fail with
+//     SQLITE_BUSY, with exponential backoff.
+//
+// LoggerConfig.ConcurrentWrites enables both.
+
+// DefaultBusyTimeout is how long a connection opened with ConcurrentSQLiteDSN
+// waits for the lock of another writer.
+const DefaultBusyTimeout = 5 * time.Second
+
+// DefaultBusyRetries and DefaultBusyBackoff are the WithBusyRetry settings
+// used by LoggerConfig.ConcurrentWrites.
+const (
+	DefaultBusyRetries = 5
+	DefaultBusyBackoff = 50 * time.Millisecond
+)
+
+// ConcurrentSQLiteDSN adds the connection parameters needed to safely share
+// the sqlite file path with other writer processes.
+func ConcurrentSQLiteDSN(path string) string {
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+	return fmt.Sprintf("%s%s_journal_mode=WAL&_txlock=immediate&_busy_timeout=%d",
+		path, sep, DefaultBusyTimeout.Milliseconds())
+}
+
+// WithBusyRetry retries writes failing because the database is locked by
+// another process up to attempts times, waiting backoff before the first
+// retry and doubling it for each subsequent one.
+func WithBusyRetry(attempts int, backoff time.Duration) LogWriterOption {
+	return func(l *LogWriter) {
+		l.busyRetries = attempts
+		l.busyBackoff = backoff
+	}
+}
+
+func isBusyError(err error) bool {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked
+	}
+	return false
+}
+
+// retryBusy runs f, retrying as configured by WithBusyRetry while it fails
+// with a busy error. f must run a complete transaction.
+func (l *LogWriter) retryBusy(ctx context.Context, f func() error) error {
+	backoff := l.busyBackoff
+	for attempt := 0; ; attempt++ {
+		err := f()
+		if err == nil || attempt >= l.busyRetries || !isBusyError(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentSQLiteDSN(t *testing.T) {
+	assert.Equal(t, "logs.db?_journal_mode=WAL&_txlock=immediate&_busy_timeout=5000", ConcurrentSQLiteDSN("logs.db"))
+	assert.Equal(t, "file:logs.db?cache=shared&_journal_mode=WAL&_txlock=immediate&_busy_timeout=5000",
+		ConcurrentSQLiteDSN("file:logs.db?cache=shared"))
+}
+
+func TestIsBusyError(t *testing.T) {
+	assert.True(t, isBusyError(sqlite3.Error{Code: sqlite3.ErrBusy}))
+	assert.False(t, isBusyError(sqlite3.Error{Code: sqlite3.ErrConstraint}))
+	assert.False(t, isBusyError(fmt.Errorf("busy")))
+}
+
+// TestLogWriterConcurrentWrites simulates two processes by using two
+// connection pools on the same file.
+func TestLogWriterConcurrentWrites(t *testing.T) {
+	dsn := ConcurrentSQLiteDSN(filepath.Join(t.TempDir(), "logs.db"))
+
+	writers := []*LogWriter{}
+	for i := 0; i < 2; i++ {
+		db := sqlx.MustOpen("sqlite3", dsn)
+		defer func(db *sqlx.DB) {
+			_ = db.Close()
+		}(db)
+		lw := NewLogWriter(db, NewSchema(), WithBusyRetry(DefaultBusyRetries, DefaultBusyBackoff))
+		require.NoError(t, lw.Init())
+		writers = append(writers, lw)
+	}
+
+	const n = 50
+	var wg sync.WaitGroup
+	errs := make(chan error, 2*n)
+	for i, lw := range writers {
+		wg.Add(1)
+		go func(i int, lw *LogWriter) {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				_, err := lw.Write([]byte(fmt.Sprintf(`{"level": "info", "writer": %d, "n": %d}`, i, j)))
+				if err != nil {
+					errs <- err
+				}
+			}
+		}(i, lw)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	entries, err := writers[0].GetEntries(nil)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2*n)
+	for _, entry := range entries {
+		assert.Len(t, entry.Meta, 2)
+	}
+}
@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"os"
+	"sync"
+)
+
+// zerolog ignores the errors returned by its writer, so entries that can't be
+// written (invalid JSON, locked database, full disk) would be lost silently.
+// WithOnError reports them, and WithDeadLetterFile appends their payload to a
+// JSONL file, which can be imported back once the problem is fixed:
+//
+//	plunger import --db logs.db dead-letter.jsonl
+
+// ErrorHandler is called with the error and the payload of a failed Write.
+type ErrorHandler func(err error, payload []byte)
+
+// WithOnError calls f for each payload Write fails to store.
+func WithOnError(f ErrorHandler) LogWriterOption {
+	return func(l *LogWriter) {
+		l.onError = f
+	}
+}
+
+// OnError calls f for each payload Write fails to store, see WithOnError.
+func (l *LogWriter) OnError(f ErrorHandler) {
+	l.onError = f
+}
+
+// WithDeadLetterFile appends the payloads Write fails to store to the file at
+// path, one per line. Errors writing the file are reported to the OnError hook.
+func WithDeadLetterFile(path string) LogWriterOption {
+	// shared by the LogWriters created with the option, e.g. by a RotatingWriter
+	d := &deadLetterFile{path: path}
+	return func(l *LogWriter) {
+		l.deadLetter = d
+	}
+}
+
+type deadLetterFile struct {
+	path string
+	mu   sync.Mutex
+}
+
+func (d *deadLetterFile) append(payload []byte) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, err := os.OpenFile(d.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return errors.Wrap(err, "could not open dead-letter file")
+	}
+	line := payload
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(append([]byte{}, payload...), '\n')
+	}
+	if _, err := f.Write(line); err != nil {
+		_ = f.Close()
+		return errors.Wrap(err, "could not write to dead-letter file")
+	}
+	return f.Close()
+}
+
+// handleWriteError reports the failure to write payload to the OnError hook
+// and the dead-letter file, if configured.
+func (l *LogWriter) handleWriteError(err error, payload []byte) {
+	if l.onError != nil {
+		l.onError(err, payload)
+	}
+	if l.deadLetter != nil {
+		if dlErr := l.deadLetter.append(payload); dlErr != nil && l.onError != nil {
+			l.onError(dlErr, payload)
+		}
+	}
+}
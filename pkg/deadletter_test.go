@@ -0,0 +1,56 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogWriterDeadLetter(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead-letter.jsonl")
+	failed := [][]byte{}
+	rejectMiddleware := func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			if entry["reject"] == true {
+				return errors.New("rejected")
+			}
+			return next(entry)
+		}
+	}
+	lw := newImportLogWriter(t,
+		WithMiddleware(rejectMiddleware),
+		WithDeadLetterFile(path),
+		WithOnError(func(err error, payload []byte) {
+			failed = append(failed, payload)
+		}))
+
+	_, err := lw.Write([]byte(`{"level": "info", "message": "ok"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "info", "message": "truncated`))
+	assert.Error(t, err)
+	_, err = lw.Write([]byte(`{"level": "warn", "message": "retry me", "reject": true}` + "\n"))
+	assert.EqualError(t, err, "rejected")
+
+	require.Len(t, failed, 2)
+	assert.Equal(t, `{"level": "info", "message": "truncated`, string(failed[0]))
+
+	b, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, `{"level": "info", "message": "truncated`+"\n"+
+		`{"level": "warn", "message": "retry me", "reject": true}`+"\n", string(b))
+
+	// the dead-letter file can be imported back
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer func(f *os.File) {
+		_ = f.Close()
+	}(f)
+	other := newImportLogWriter(t)
+	progress, err := other.Import(f, WithImportSkipInvalid(true))
+	require.NoError(t, err)
+	assert.Equal(t, 1, progress.Imported)
+	assert.Equal(t, 1, progress.Skipped)
+}
@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// DeleteEntries deletes the entries matching filter in a single transaction,
+// along with their meta values, and returns the number of deleted entries.
+// Offloaded values are removed once no entry references them anymore.
+//
+// Use GetEntries with the same filter to preview the deleted entries.
+func (l *LogWriter) DeleteEntries(filter *GetEntriesFilter) (int64, error) {
+	return l.DeleteEntriesContext(context.Background(), filter)
+}
+
+func (l *LogWriter) DeleteEntriesContext(ctx context.Context, filter *GetEntriesFilter) (int64, error) {
+	if filter == nil {
+		filter = NewGetEntriesFilter()
+	}
+	if err := filter.Validate(); err != nil {
+		return 0, err
+	}
+
+	filter, err := filter.resolveCursor()
+	if err != nil {
+		return 0, err
+	}
+	filter = l.resolveGroupKey(filter)
+
+	sb := sqlbuilder.Select("id").From("log_entries").OrderBy("id ASC")
+	filter.Apply(l.schema.MetaKeys, sb)
+
+	var deleted int64
+	err = l.retryBusy(ctx, func() error {
+		var err error
+		deleted, err = l.deleteEntries(ctx, sb)
+		return err
+	})
+	return deleted, err
+}
+
+// DeleteSession deletes the session with the given id in a single
+// transaction, along with its entries, metadata, tags, artifacts and spans, and returns the
+// number of deleted entries. Child sessions are kept.
+func (l *LogWriter) DeleteSession(id string) (int64, error) {
+	return l.DeleteSessionContext(context.Background(), id)
+}
+
+func (l *LogWriter) DeleteSessionContext(ctx context.Context, id string) (int64, error) {
+	sb := sqlbuilder.Select("id").From("log_entries")
+	sb.Where(sb.E("session", id))
+
+	tables, err := l.entryTables()
+	if err != nil {
+		return 0, err
+	}
+
+	var deleted int64
+	var refs []string
+	err = l.retryBusy(ctx, func() error {
+		tx, err := l.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		deleted, refs, err = l.deleteEntriesTx(ctx, tx, tables, sb)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		artifactRefs, err := l.sessionArtifactBlobs(ctx, tx, id)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		refs = append(refs, artifactRefs...)
+
+		var sessionRows int64
+		for _, table := range []string{"session_metadata", "session_tags", "artifacts", "spans", "sessions"} {
+			column := "session_id"
+			if table == "sessions" {
+				column = "id"
+			}
+			db := sqlbuilder.DeleteFrom(table)
+			db.Where(db.E(column, id))
+			s, args := db.Build()
+			res, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+			if err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+			if table == "sessions" {
+				if sessionRows, err = res.RowsAffected(); err != nil {
+					_ = tx.Rollback()
+					return err
+				}
+			}
+		}
+
+		// entries can reference sessions that were never stored in sessions
+		if sessionRows == 0 && deleted == 0 {
+			_ = tx.Rollback()
+			return &UnknownSessionError{ID: id}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, l.removeUnreferencedBlobs(ctx, refs)
+}
@@ -0,0 +1,130 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDeleteEntries(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+	blobDir := DefaultBlobDir(dbFile)
+	db := sqlx.MustOpen("sqlite3", dbFile)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	schema := NewSchema()
+	schema.MetaKeys.Add("payload").Wide = true
+	lw := NewLogWriter(db, schema, WithBlobOffloading(blobDir, 100), WithWideTable(true))
+	require.NoError(t, lw.Init())
+
+	large := strings.Repeat("x", 200)
+	other := strings.Repeat("y", 200)
+	for _, line := range []string{
+		`{"level": "debug", "message": "first", "large": {"text": "` + large + `"}, "payload": 1}`,
+		`{"level": "info", "message": "second", "large": {"text": "` + large + `"}}`,
+		`{"level": "debug", "message": "third", "large": {"text": "` + other + `"}, "payload": 2}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	blobs := func() []string {
+		files, err := filepath.Glob(filepath.Join(blobDir, "*", "*"))
+		require.NoError(t, err)
+		return files
+	}
+	require.Len(t, blobs(), 2)
+
+	n, err := lw.DeleteEntries(NewGetEntriesFilter(WithLevel("debug")))
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", *entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"text": large}, entries[0].Meta["large"])
+
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM log_entries_meta"))
+	assert.Equal(t, 1, count)
+	// only the deleted entries had a payload
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM "+wideTable))
+	assert.Equal(t, 0, count)
+	// the value still referenced by the remaining entry is kept
+	assert.Len(t, blobs(), 1)
+
+	n, err = lw.DeleteEntries(nil)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	assert.Empty(t, blobs())
+}
+
+func TestDeleteSession(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	sm := lw.Sessions()
+
+	doomed, err := sm.NewSession("doomed", map[string]interface{}{"host": "foo"}, WithSessionTags("ci"))
+	require.NoError(t, err)
+	kept, err := sm.NewSession("kept", nil, WithSessionTags("ci"))
+	require.NoError(t, err)
+	for _, session := range []*Session{doomed, doomed, kept} {
+		_, err := lw.Write([]byte(`{"level": "info", "session": "` + session.ID + `", "message": "` + session.Name + `"}`))
+		require.NoError(t, err)
+	}
+	_, err = lw.Write([]byte(`{"level": "info", "session": "adhoc", "message": "adhoc"}`))
+	require.NoError(t, err)
+
+	n, err := lw.DeleteSession(doomed.ID)
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+
+	_, err = sm.GetSession(doomed.ID)
+	assert.IsType(t, &UnknownSessionError{}, err)
+	var count int
+	require.NoError(t, lw.db.Get(&count, "SELECT COUNT(*) FROM session_metadata"))
+	assert.Equal(t, 0, count)
+	summaries, err := sm.ListSessions(WithSessionFilterTags("ci"))
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, kept.ID, summaries[0].ID)
+
+	// sessions only referenced by entries can be deleted too
+	n, err = lw.DeleteSession("adhoc")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = lw.DeleteSession("unknown")
+	assert.IsType(t, &UnknownSessionError{}, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "kept", *entries[0].Message)
+}
+
+func TestDeleteManyEntries(t *testing.T) {
+	lw := newImportLogWriter(t)
+	writeManyEntries(t, lw, 33000, 0)
+	_, err := lw.Write([]byte(`{"level": "info", "session": "kept", "message": "kept"}`))
+	require.NoError(t, err)
+
+	deleted, err := lw.DeleteSession("bulk")
+	require.NoError(t, err)
+	assert.Equal(t, int64(33000), deleted)
+	assert.Equal(t, []string{"kept"}, messages(t, lw))
+
+	writeManyEntries(t, lw, 33000, 0)
+	deleted, err = lw.DeleteEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	assert.Equal(t, int64(33001), deleted)
+	assert.Empty(t, messages(t, lw))
+}
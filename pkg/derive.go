@@ -0,0 +1,181 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Fields of the schema file can be derived from the other fields of the
+// entries when they are written, so that queries and dashboards can group by
+// a stored value instead of computing it:
+//
+//	fields:
+//	  - name: latency_bucket
+//	    type: string
+//	    derive:
+//	      - when: elapsed_ms<100
+//	        value: fast
+//	      - when: elapsed_ms<1000
+//	        value: ok
+//	      - value: slow
+//
+// The value of the first case whose condition matches is stored, the last
+// case can omit its condition to provide a default. Conditions are written
+// in the query language, see ParseQuery, and compare the fields of the entry
+// as logged: numbers numerically, levels by severity, and other values as
+// strings. Fields missing from the entry match no comparison.
+//
+// Fields are derived in the order they are declared, so a derived field can
+// depend on the fields declared before it. A derived value replaces the
+// value the entry may already have.
+
+// DerivedCase is a case of a derived field, see FieldDefinition.Derive.
+type DerivedCase struct {
+	// When is a condition in the query language. A case without condition
+	// always matches.
+	When  string      `yaml:"when,omitempty" json:"when,omitempty"`
+	Value interface{} `yaml:"value" json:"value"`
+
+	when QueryExpr
+}
+
+// compileDerive parses the conditions of the cases of field.
+func (f *FieldDefinition) compileDerive() error {
+	for i, c := range f.Derive {
+		if c.When == "" {
+			if i != len(f.Derive)-1 {
+				return errors.Errorf("schema field %s has a derive case without when before its last case", f.Name)
+			}
+			continue
+		}
+		expr, err := ParseQuery(c.When)
+		if err != nil {
+			return errors.Wrapf(err, "schema field %s", f.Name)
+		}
+		c.when = expr
+	}
+	return nil
+}
+
+// derive returns the value of the first case of f matching entry.
+func (f *FieldDefinition) derive(entry map[string]interface{}) (interface{}, bool) {
+	for _, c := range f.Derive {
+		if c.when == nil || matchEntry(c.when, entry) {
+			return c.Value, true
+		}
+	}
+	return nil, false
+}
+
+// HasDerivedFields returns true if the schema declares derived fields.
+func (s *Schema) HasDerivedFields() bool {
+	for _, field := range s.Fields {
+		if len(field.Derive) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// DerivedFieldsMiddleware sets the derived fields declared in schema on the
+// entries.
+func DerivedFieldsMiddleware(schema *Schema) Middleware {
+	return func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			for _, field := range schema.Fields {
+				if v, ok := field.derive(entry); ok {
+					entry[field.Name] = v
+				}
+			}
+			return next(entry)
+		}
+	}
+}
+
+// matchEntry evaluates expr against the fields of an entry that hasn't been
+// stored yet.
+func matchEntry(expr QueryExpr, entry map[string]interface{}) bool {
+	switch e := expr.(type) {
+	case *AndExpr:
+		return matchEntry(e.Left, entry) && matchEntry(e.Right, entry)
+	case *OrExpr:
+		return matchEntry(e.Left, entry) || matchEntry(e.Right, entry)
+	case *NotExpr:
+		return !matchEntry(e.Expr, entry)
+	case *Comparison:
+		return e.matchEntry(entry)
+	}
+	return false
+}
+
+func (e *Comparison) matchEntry(entry map[string]interface{}) bool {
+	key := e.Key
+	if key == "msg" {
+		key = "message"
+	}
+	v, ok := entry[key]
+	if !ok || v == nil {
+		return false
+	}
+
+	var cmp int
+	switch value := e.Value.(type) {
+	case bool:
+		b, ok := v.(bool)
+		if !ok {
+			return false
+		}
+		switch e.Op {
+		case "=":
+			return b == value
+		case "!=":
+			return b != value
+		}
+		return false
+	case json.Number:
+		f, err := value.Float64()
+		n, ok := numericValue(v)
+		if err != nil || !ok {
+			return false
+		}
+		switch {
+		case n < f:
+			cmp = -1
+		case n > f:
+			cmp = 1
+		}
+	default:
+		s, expected := fmt.Sprint(v), fmt.Sprint(value)
+		if key == "level" {
+			s, expected = strings.ToLower(s), strings.ToLower(expected)
+		}
+		switch e.Op {
+		case "~":
+			return strings.Contains(s, expected)
+		case "!~":
+			return !strings.Contains(s, expected)
+		}
+		cmp = strings.Compare(s, expected)
+		if key == "level" && e.Op != "=" && e.Op != "!=" {
+			cmp = levelSeverity(s) - levelSeverity(expected)
+		}
+	}
+
+	switch e.Op {
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "=":
+		return cmp == 0
+	}
+	return false
+}
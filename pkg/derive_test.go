@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestDerivedFieldsMiddleware(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(`
+fields:
+  - name: latency_bucket
+    type: string
+    derive:
+      - when: elapsed_ms<100
+        value: fast
+      - when: elapsed_ms<1000
+        value: ok
+      - value: slow
+  - name: page
+    type: bool
+    derive:
+      - when: level>=error AND latency_bucket=slow
+        value: true
+  - name: component
+    derive:
+      - when: msg~"db"
+        value: database
+`))
+	require.NoError(t, err)
+	assert.True(t, schema.HasDerivedFields())
+
+	lw := newImportLogWriter(t, WithMiddleware(DerivedFieldsMiddleware(schema)))
+	for _, line := range []string{
+		`{"level": "info", "message": "db query", "elapsed_ms": 12}`,
+		`{"level": "warn", "message": "request", "elapsed_ms": 250.5}`,
+		`{"level": "error", "message": "request", "elapsed_ms": 3000, "latency_bucket": "fast"}`,
+		`{"level": "error", "message": "no latency"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 4)
+	assert.Equal(t, "fast", entries[0].Meta["latency_bucket"])
+	assert.Equal(t, "database", entries[0].Meta["component"])
+	assert.NotContains(t, entries[0].Meta, "page")
+	assert.Equal(t, "ok", entries[1].Meta["latency_bucket"])
+	// derived values replace the logged ones
+	assert.Equal(t, "slow", entries[2].Meta["latency_bucket"])
+	assert.Equal(t, true, entries[2].Meta["page"])
+	// the default case matches entries missing the compared field
+	assert.Equal(t, "slow", entries[3].Meta["latency_bucket"])
+
+	// derived fields can be queried like any meta value
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithQueryString(`latency_bucket=slow`)))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
+
+func TestParseSchemaInvalidDerive(t *testing.T) {
+	for _, schema := range []string{
+		"fields:\n  - name: a\n    derive:\n      - value: x\n      - when: b=1\n        value: y\n",
+		"fields:\n  - name: a\n    derive:\n      - when: b=\n        value: x\n",
+	} {
+		_, err := ParseSchema(strings.NewReader(schema))
+		assert.Error(t, err, schema)
+	}
+}
+
+func TestMatchEntry(t *testing.T) {
+	entry := map[string]interface{}{"level": "WARN", "status": int64(503), "path": "/api/users", "cached": false}
+	for query, expected := range map[string]bool{
+		`level>=warn`:                true,
+		`level>warn`:                 false,
+		`level=warn`:                 true,
+		`status>=500 AND status<600`: true,
+		`status=503.0`:               true,
+		`path~"/api"`:                true,
+		`path!~"/api"`:               false,
+		`NOT cached=true`:            true,
+		`missing!=1`:                 false,
+		`path>"/api" OR status<0`:    true,
+	} {
+		expr, err := ParseQuery(query)
+		require.NoError(t, err)
+		assert.Equal(t, expected, matchEntry(expr, entry), query)
+	}
+}
@@ -0,0 +1,420 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of the container metadata stored on the entries collected by CollectDocker.
+const (
+	ContainerNameKey  = "container_name"
+	ContainerIDKey    = "container_id"
+	ContainerImageKey = "container_image"
+)
+
+// DefaultDockerHost is the address of the Docker daemon used when DOCKER_HOST isn't set.
+const DefaultDockerHost = "unix:///var/run/docker.sock"
+
+// DefaultDockerPollInterval is the interval at which CollectDocker looks for
+// new containers.
+const DefaultDockerPollInterval = 5 * time.Second
+
+// DockerClient talks to the Docker Engine API, over a unix socket or TCP.
+type DockerClient struct {
+	client  *http.Client
+	baseURL string
+}
+
+// NewDockerClient returns a client for the daemon at host, such as
+// unix:///var/run/docker.sock or tcp://localhost:2375.
+func NewDockerClient(host string) (*DockerClient, error) {
+	u, err := url.Parse(host)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid docker host %s", host)
+	}
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		transport := &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		}
+		return &DockerClient{client: &http.Client{Transport: transport}, baseURL: "http://docker"}, nil
+	case "tcp", "http":
+		return &DockerClient{client: &http.Client{}, baseURL: "http://" + u.Host}, nil
+	default:
+		return nil, errors.Errorf("unsupported docker host %s", host)
+	}
+}
+
+// DockerContainer is a container listed by the Docker daemon.
+type DockerContainer struct {
+	ID    string
+	Name  string
+	Image string
+}
+
+func (c *DockerClient) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer func(body io.ReadCloser) {
+			_ = body.Close()
+		}(res.Body)
+		msg := struct {
+			Message string `json:"message"`
+		}{}
+		_ = json.NewDecoder(res.Body).Decode(&msg)
+		return nil, errors.Errorf("docker %s: %s %s", path, res.Status, msg.Message)
+	}
+	return res, nil
+}
+
+// ListContainers returns the running containers.
+func (c *DockerClient) ListContainers(ctx context.Context) ([]*DockerContainer, error) {
+	res, err := c.get(ctx, "/containers/json", url.Values{})
+	if err != nil {
+		return nil, err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(res.Body)
+
+	containers := []struct {
+		ID    string   `json:"Id"`
+		Names []string `json:"Names"`
+		Image string   `json:"Image"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&containers); err != nil {
+		return nil, errors.Wrap(err, "could not decode the containers")
+	}
+	ret := []*DockerContainer{}
+	for _, container := range containers {
+		name := ""
+		if len(container.Names) > 0 {
+			name = strings.TrimPrefix(container.Names[0], "/")
+		}
+		ret = append(ret, &DockerContainer{ID: container.ID, Name: name, Image: container.Image})
+	}
+	return ret, nil
+}
+
+// isTTY tells whether the container has a TTY, in which case its logs aren't
+// multiplexed.
+func (c *DockerClient) isTTY(ctx context.Context, id string) (bool, error) {
+	res, err := c.get(ctx, "/containers/"+id+"/json", url.Values{})
+	if err != nil {
+		return false, err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(res.Body)
+
+	inspect := struct {
+		Config struct {
+			Tty bool `json:"Tty"`
+		} `json:"Config"`
+	}{}
+	if err := json.NewDecoder(res.Body).Decode(&inspect); err != nil {
+		return false, errors.Wrapf(err, "could not inspect container %s", id)
+	}
+	return inspect.Config.Tty, nil
+}
+
+// streamLogs calls fn with each line logged by the container since since,
+// along with its stream and timestamp, following the logs until ctx is done
+// or the container stops.
+func (c *DockerClient) streamLogs(ctx context.Context, id string, since time.Time,
+	fn func(stream string, date time.Time, line []byte) error) error {
+	tty, err := c.isTTY(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	query := url.Values{
+		"follow":     {"1"},
+		"stdout":     {"1"},
+		"stderr":     {"1"},
+		"timestamps": {"1"},
+	}
+	if !since.IsZero() {
+		query.Set("since", fmt.Sprintf("%d.%09d", since.Unix(), since.Nanosecond()))
+	}
+	res, err := c.get(ctx, "/containers/"+id+"/logs", query)
+	if err != nil {
+		return err
+	}
+	defer func(body io.ReadCloser) {
+		_ = body.Close()
+	}(res.Body)
+
+	handleLine := func(stream string, line []byte) error {
+		// lines are prefixed with their RFC3339 timestamp
+		date := time.Time{}
+		if prefix, rest, ok := strings.Cut(string(line), " "); ok {
+			if t, err := time.Parse(time.RFC3339Nano, prefix); err == nil {
+				date, line = t.UTC(), []byte(rest)
+			}
+		}
+		return fn(stream, date, line)
+	}
+
+	if tty {
+		scanner := bufio.NewScanner(res.Body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			if err := handleLine(StreamStdout, scanner.Bytes()); err != nil {
+				return err
+			}
+		}
+		return scanner.Err()
+	}
+	return demuxDockerLogs(res.Body, handleLine)
+}
+
+// demuxDockerLogs splits the multiplexed stdout and stderr of a container
+// into lines. Each frame starts with a header holding the stream (1 for
+// stdout, 2 for stderr) and the size of the frame, as 32 bit big endian.
+func demuxDockerLogs(r io.Reader, fn func(stream string, line []byte) error) error {
+	pending := map[string][]byte{}
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+		stream := StreamStdout
+		if header[0] == 2 {
+			stream = StreamStderr
+		}
+		frame := make([]byte, binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.ReadFull(r, frame); err != nil {
+			return err
+		}
+
+		buf := append(pending[stream], frame...)
+		for {
+			i := strings.IndexByte(string(buf), '\n')
+			if i < 0 {
+				break
+			}
+			if err := fn(stream, []byte(strings.TrimSuffix(string(buf[:i]), "\r"))); err != nil {
+				return err
+			}
+			buf = buf[i+1:]
+		}
+		pending[stream] = buf
+	}
+	for _, stream := range []string{StreamStdout, StreamStderr} {
+		if len(pending[stream]) > 0 {
+			if err := fn(stream, pending[stream]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type dockerCollectOptions struct {
+	containers   []string
+	parser       LineParser
+	since        time.Time
+	pollInterval time.Duration
+	onError      func(container *DockerContainer, err error)
+}
+
+type DockerCollectOption func(*dockerCollectOptions)
+
+// WithDockerContainers only collects the logs of the containers with these
+// names or ids, or id prefixes. All containers are collected by default.
+func WithDockerContainers(containers ...string) DockerCollectOption {
+	return func(o *dockerCollectOptions) {
+		o.containers = append(o.containers, containers...)
+	}
+}
+
+// WithDockerParser sets the parser of the logged lines, JSONLineParser by
+// default. Lines that can't be parsed are stored as messages.
+func WithDockerParser(parser LineParser) DockerCollectOption {
+	return func(o *dockerCollectOptions) {
+		o.parser = parser
+	}
+}
+
+// WithDockerSince collects the logs of the running containers since since,
+// instead of the logs written from then on.
+func WithDockerSince(since time.Time) DockerCollectOption {
+	return func(o *dockerCollectOptions) {
+		o.since = since
+	}
+}
+
+// WithDockerPollInterval sets the interval at which new containers are
+// looked for, DefaultDockerPollInterval by default.
+func WithDockerPollInterval(interval time.Duration) DockerCollectOption {
+	return func(o *dockerCollectOptions) {
+		o.pollInterval = interval
+	}
+}
+
+// WithDockerOnError is called when the logs of a container can't be
+// collected or stored. container is nil if the containers can't be listed.
+func WithDockerOnError(onError func(container *DockerContainer, err error)) DockerCollectOption {
+	return func(o *dockerCollectOptions) {
+		o.onError = onError
+	}
+}
+
+func (o *dockerCollectOptions) matches(container *DockerContainer) bool {
+	if len(o.containers) == 0 {
+		return true
+	}
+	for _, c := range o.containers {
+		if c == container.Name || strings.HasPrefix(container.ID, c) {
+			return true
+		}
+	}
+	return false
+}
+
+// CollectDocker stores the logs of the running containers of the Docker
+// daemon, and of the containers started later on, until ctx is done. Lines
+// are stored with the name, id and image of their container and their
+// stream. Plain lines are stored as messages, with level info.
+func (l *LogWriter) CollectDocker(ctx context.Context, client *DockerClient, opts ...DockerCollectOption) error {
+	o := &dockerCollectOptions{
+		parser:       JSONLineParser,
+		since:        time.Now(),
+		pollInterval: DefaultDockerPollInterval,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	onError := func(container *DockerContainer, err error) {
+		if o.onError != nil && ctx.Err() == nil {
+			o.onError(container, err)
+		}
+	}
+	i := &importer{
+		timestampField:  l.timestampFieldName,
+		timestampFormat: l.timestampFormat,
+		levelField:      "level",
+		messageField:    l.messageFieldName,
+	}
+
+	containers, err := client.ListContainers(ctx)
+	if err != nil {
+		return err
+	}
+
+	type finished struct {
+		id string
+		at time.Time
+	}
+	done := make(chan finished)
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+
+	// the containers found at startup are collected from since, the ones
+	// started later on from their start, and the restarted ones from where
+	// their logs were left
+	since := o.since
+	collected := map[string]bool{}
+	resume := map[string]time.Time{}
+	for {
+		for _, container := range containers {
+			if collected[container.ID] || !o.matches(container) {
+				continue
+			}
+			collected[container.ID] = true
+			from, ok := resume[container.ID]
+			if !ok {
+				from = since
+			}
+			wg.Add(1)
+			go func(container *DockerContainer, from time.Time) {
+				defer wg.Done()
+				if err := l.collectContainer(ctx, client, container, from, o.parser, i); err != nil {
+					onError(container, err)
+				}
+				select {
+				case done <- finished{id: container.ID, at: time.Now()}:
+				case <-ctx.Done():
+				}
+			}(container, from)
+		}
+		since = time.Time{}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case f := <-done:
+			delete(collected, f.id)
+			resume[f.id] = f.at
+			// the container gets collected again once it is listed as running
+			containers = nil
+		case <-ticker.C:
+			if containers, err = client.ListContainers(ctx); err != nil {
+				onError(nil, err)
+			}
+		}
+	}
+}
+
+func (l *LogWriter) collectContainer(ctx context.Context, client *DockerClient, container *DockerContainer,
+	since time.Time, parser LineParser, i *importer) error {
+	return client.streamLogs(ctx, container.ID, since, func(stream string, date time.Time, line []byte) error {
+		if strings.TrimSpace(string(line)) == "" {
+			return nil
+		}
+		entry, err := parser.ParseLine(line)
+		if err != nil || entry == nil {
+			entry = map[string]interface{}{
+				"level":            "info",
+				l.messageFieldName: string(line),
+			}
+		}
+		entry = l.mapImportedFields(i, entry)
+		if _, ok := entry[l.timestampFieldName]; !ok && !date.IsZero() {
+			entry[l.timestampFieldName] = date
+		}
+		entry[ContainerNameKey] = container.Name
+		entry[ContainerIDKey] = container.ID
+		entry[ContainerImageKey] = container.Image
+		entry[StreamKey] = stream
+
+		if _, err := l.writeBatch(ctx, []map[string]interface{}{entry}); err != nil {
+			if ctx.Err() != nil {
+				return err
+			}
+			l.handleWriteError(err, line)
+		}
+		return nil
+	})
+}
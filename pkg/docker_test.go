@@ -0,0 +1,113 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// dockerFrame multiplexes payload on stream, 1 for stdout and 2 for stderr.
+func dockerFrame(stream byte, payload string) []byte {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(payload)))
+	return append(header, payload...)
+}
+
+func TestDemuxDockerLogs(t *testing.T) {
+	input := &bytes.Buffer{}
+	input.Write(dockerFrame(1, "first li"))
+	input.Write(dockerFrame(2, "oops\n"))
+	input.Write(dockerFrame(1, "ne\r\nsecond line\nunterminated"))
+
+	lines := []string{}
+	err := demuxDockerLogs(input, func(stream string, line []byte) error {
+		lines = append(lines, stream+": "+string(line))
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"stderr: oops",
+		"stdout: first line",
+		"stdout: second line",
+		"stdout: unterminated",
+	}, lines)
+}
+
+func TestCollectDocker(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"Id": "abc123def456", "Names": []string{"/api"}, "Image": "api:1.2"},
+			{"Id": "fff000", "Names": []string{"/db"}, "Image": "postgres:16"},
+		})
+	})
+	mux.HandleFunc("/containers/abc123def456/json", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"Config": {"Tty": false}}`))
+	})
+	mux.HandleFunc("/containers/abc123def456/logs", func(w http.ResponseWriter, r *http.Request) {
+		// the logs are only sent once, resuming them sends nothing
+		if r.URL.Query().Get("since") != "" {
+			return
+		}
+		_, _ = w.Write(dockerFrame(1, "2023-05-01T10:00:00.5Z plain line\n"))
+		_, _ = w.Write(dockerFrame(1, `2023-05-01T10:00:01Z {"level": "warn", "message": "json line", "user": 7}`+"\n"))
+		_, _ = w.Write(dockerFrame(2, "2023-05-01T10:00:02Z failed\n"))
+	})
+	mux.HandleFunc("/containers/fff000/logs", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the db container shouldn't be collected")
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	client, err := NewDockerClient("tcp://" + server.Listener.Addr().String())
+	require.NoError(t, err)
+
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errs := make(chan error, 1)
+	go func() {
+		errs <- lw.CollectDocker(ctx, client,
+			WithDockerContainers("api"),
+			WithDockerSince(time.Time{}),
+			WithDockerPollInterval(10*time.Millisecond),
+			WithDockerOnError(func(container *DockerContainer, err error) {
+				t.Error(err)
+			}))
+	}()
+
+	var entries []*LogEntry
+	assert.Eventually(t, func() bool {
+		entries, err = lw.GetEntries(NewGetEntriesFilter(WithOrderBy("date", Asc)))
+		return err == nil && len(entries) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-errs)
+
+	require.Len(t, entries, 3)
+	assert.Equal(t, "plain line", *entries[0].Message)
+	assert.Equal(t, "info", entries[0].Level)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 500000000, time.UTC), entries[0].Date.UTC())
+	assert.Equal(t, "api", entries[0].Meta[ContainerNameKey])
+	assert.Equal(t, "abc123def456", entries[0].Meta[ContainerIDKey])
+	assert.Equal(t, "api:1.2", entries[0].Meta[ContainerImageKey])
+	assert.Equal(t, "stdout", entries[0].Meta[StreamKey])
+	assert.Equal(t, "json line", *entries[1].Message)
+	assert.Equal(t, "warn", entries[1].Level)
+	assert.EqualValues(t, 7, entries[1].Meta["user"])
+	assert.Equal(t, "stderr", entries[2].Meta[StreamKey])
+}
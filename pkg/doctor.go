@@ -0,0 +1,334 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+)
+
+// DoctorCheck identifies the checks run by Doctor.
+type DoctorCheck string
+
+const (
+	// DoctorIntegrity reports the problems found by the database itself, such
+	// as PRAGMA integrity_check for sqlite. They can't be fixed by Doctor.
+	DoctorIntegrity DoctorCheck = "integrity"
+	// DoctorUnknownMetaKeys reports meta rows whose meta_key_id isn't in
+	// meta_keys. Fixing them adds the missing keys, named after their id.
+	DoctorUnknownMetaKeys DoctorCheck = "unknown_meta_keys"
+	// DoctorOrphanedRows reports the rows of entries that don't exist anymore,
+	// such as meta rows or links. Fixing them deletes them.
+	DoctorOrphanedRows DoctorCheck = "orphaned_rows"
+	// DoctorTypeMismatches reports meta rows whose value isn't stored in the
+	// column of their type. Fixing them deletes them.
+	DoctorTypeMismatches DoctorCheck = "type_mismatches"
+	// DoctorInvalidJSON reports JSON values that can't be parsed. Fixing them
+	// stores them as blobs.
+	DoctorInvalidJSON DoctorCheck = "invalid_json"
+	// DoctorUnreadableValues reports values that can't be read back, because
+	// their offloaded file is missing or they can't be decompressed or
+	// decrypted. They can't be fixed by Doctor.
+	DoctorUnreadableValues DoctorCheck = "unreadable_values"
+)
+
+// DoctorIssue is a problem found by Doctor.
+type DoctorIssue struct {
+	Check       DoctorCheck `json:"check"`
+	Table       string      `json:"table,omitempty"`
+	Description string      `json:"description"`
+	// Count is the number of affected rows.
+	Count int64 `json:"count"`
+	// Fixed is set if the issue was fixed, see WithDoctorFix.
+	Fixed bool `json:"fixed"`
+}
+
+type doctorOptions struct {
+	fix bool
+}
+
+type DoctorOption func(*doctorOptions)
+
+// WithDoctorFix fixes the issues that can be fixed, see DoctorCheck.
+func WithDoctorFix(fix bool) DoctorOption {
+	return func(o *doctorOptions) {
+		o.fix = fix
+	}
+}
+
+// doctorBatchSize is the number of JSON values read at once by Doctor.
+const doctorBatchSize = 500
+
+// Doctor checks the consistency of the database and returns the issues it
+// found, an empty list if it is healthy. The values of wide meta keys aren't
+// checked.
+func (l *LogWriter) Doctor(ctx context.Context, opts ...DoctorOption) ([]*DoctorIssue, error) {
+	o := &doctorOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ret := []*DoctorIssue{}
+	problems, err := l.store.IntegrityCheck(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, problem := range problems {
+		ret = append(ret, &DoctorIssue{Check: DoctorIntegrity, Description: problem, Count: 1})
+	}
+
+	checks := []func(context.Context, bool) ([]*DoctorIssue, error){
+		l.checkUnknownMetaKeys,
+		l.checkOrphanedRows,
+		l.checkTypeMismatches,
+		l.checkJSONValues,
+	}
+	for _, check := range checks {
+		issues, err := check(ctx, o.fix)
+		if err != nil {
+			return ret, err
+		}
+		ret = append(ret, issues...)
+	}
+	return ret, nil
+}
+
+// countRows returns the number of rows of sb, selecting COUNT(*).
+func (l *LogWriter) countRows(ctx context.Context, sb *sqlbuilder.SelectBuilder) (int64, error) {
+	s, args := sb.Build()
+	var n int64
+	err := l.db.GetContext(ctx, &n, l.db.Rebind(s), args...)
+	return n, err
+}
+
+func (l *LogWriter) exec(ctx context.Context, b sqlbuilder.Builder) error {
+	s, args := b.Build()
+	return l.retryBusy(ctx, func() error {
+		_, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...)
+		return err
+	})
+}
+
+func (l *LogWriter) checkUnknownMetaKeys(ctx context.Context, fix bool) ([]*DoctorIssue, error) {
+	known := sqlbuilder.Select("id").From("meta_keys")
+	sb := sqlbuilder.Select("DISTINCT meta_key_id").From("log_entries_meta")
+	sb.Where(sb.IsNotNull("meta_key_id"), sb.NotIn("meta_key_id", known))
+	s, args := sb.Build()
+	ids := []int{}
+	if err := l.db.SelectContext(ctx, &ids, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+
+	ret := []*DoctorIssue{}
+	for _, id := range ids {
+		count := sqlbuilder.Select("COUNT(*)").From("log_entries_meta")
+		count.Where(count.E("meta_key_id", id))
+		n, err := l.countRows(ctx, count)
+		if err != nil {
+			return nil, err
+		}
+		issue := &DoctorIssue{
+			Check:       DoctorUnknownMetaKeys,
+			Table:       "log_entries_meta",
+			Description: fmt.Sprintf("meta key %d doesn't exist", id),
+			Count:       n,
+		}
+		if fix {
+			ib := sqlbuilder.NewInsertBuilder()
+			ib.InsertInto("meta_keys").Cols("id", "key").Values(id, fmt.Sprintf("unknown_key_%d", id))
+			if err := l.exec(ctx, ib); err != nil {
+				return nil, errors.Wrapf(err, "could not add meta key %d", id)
+			}
+			issue.Fixed = true
+		}
+		ret = append(ret, issue)
+	}
+	return ret, nil
+}
+
+func (l *LogWriter) checkOrphanedRows(ctx context.Context, fix bool) ([]*DoctorIssue, error) {
+	tables, err := l.entryTables()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*DoctorIssue{}
+	refs := []string{}
+	for _, t := range tables {
+		table, idColumn := t[0], t[1]
+		if table == "log_entries" {
+			continue
+		}
+		entries := sqlbuilder.Select("id").From("log_entries")
+		count := sqlbuilder.Select("COUNT(*)").From(table)
+		count.Where(count.NotIn(idColumn, entries))
+		n, err := l.countRows(ctx, count)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			continue
+		}
+		issue := &DoctorIssue{
+			Check:       DoctorOrphanedRows,
+			Table:       table,
+			Description: fmt.Sprintf("%s references missing entries", idColumn),
+			Count:       n,
+		}
+		if fix {
+			for _, c := range l.blobColumns() {
+				if c.table != table || c.idColumn != idColumn || l.blobDir == "" {
+					continue
+				}
+				sb := sqlbuilder.Select(c.column).From(table)
+				sb.Where(sb.NotIn(idColumn, entries), sb.Like(c.column, BlobRefPrefix+"%"))
+				s, args := sb.Build()
+				values := []string{}
+				if err := l.db.SelectContext(ctx, &values, l.db.Rebind(s), args...); err != nil {
+					return nil, err
+				}
+				refs = append(refs, values...)
+			}
+			db := sqlbuilder.NewDeleteBuilder()
+			db.DeleteFrom(table).Where(db.NotIn(idColumn, entries))
+			if err := l.exec(ctx, db); err != nil {
+				return nil, errors.Wrapf(err, "could not delete the orphaned rows of %s", table)
+			}
+			issue.Fixed = true
+		}
+		ret = append(ret, issue)
+	}
+	if err := l.removeUnreferencedBlobs(ctx, refs); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// typeColumns are the columns holding the values of each type.
+var typeColumns = map[LogEntryType]string{
+	LogEntryTypeReal:     "real_value",
+	LogEntryTypeText:     "text_value",
+	LogEntryTypeBlob:     "blob_value",
+	LogEntryTypeJSON:     "blob_value",
+	LogEntryTypeInt:      "int_value",
+	LogEntryTypeDuration: "int_value",
+	LogEntryTypeTime:     "int_value",
+	LogEntryTypeBool:     "int_value",
+}
+
+// typeMismatchConditions returns the conditions matching the meta rows
+// whose value isn't stored in the column of their type, added to cond.
+func typeMismatchConditions(cond *sqlbuilder.Cond) string {
+	conditions := []string{}
+	types := []interface{}{}
+	for t, column := range typeColumns {
+		types = append(types, t)
+		c := cond.And(cond.E("type", t), cond.IsNull(column))
+		if column == "int_value" || column == "real_value" {
+			// the numbers of encrypted keys are stored in text_value, see encryptField
+			c = cond.And(c, cond.Or(cond.IsNull("text_value"), cond.NotLike("text_value", EncryptedFieldPrefix+"%")))
+		}
+		conditions = append(conditions, c)
+	}
+	conditions = append(conditions, cond.NotIn("type", types...))
+	return cond.Or(conditions...)
+}
+
+func (l *LogWriter) checkTypeMismatches(ctx context.Context, fix bool) ([]*DoctorIssue, error) {
+	sb := sqlbuilder.Select("type", "COUNT(*) AS count").From("log_entries_meta")
+	sb.Where(typeMismatchConditions(&sb.Cond)).GroupBy("type").OrderBy("type")
+	s, args := sb.Build()
+	rows := []struct {
+		Type  LogEntryType `db:"type"`
+		Count int64        `db:"count"`
+	}{}
+	if err := l.db.SelectContext(ctx, &rows, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+
+	ret := []*DoctorIssue{}
+	for _, row := range rows {
+		description := fmt.Sprintf("unknown type %d", row.Type)
+		if column, ok := typeColumns[row.Type]; ok {
+			description = fmt.Sprintf("%s values without %s", row.Type, column)
+		}
+		ret = append(ret, &DoctorIssue{
+			Check:       DoctorTypeMismatches,
+			Table:       "log_entries_meta",
+			Description: description,
+			Count:       row.Count,
+		})
+	}
+	if fix && len(ret) > 0 {
+		db := sqlbuilder.NewDeleteBuilder()
+		db.DeleteFrom("log_entries_meta").Where(typeMismatchConditions(&db.Cond))
+		if err := l.exec(ctx, db); err != nil {
+			return nil, errors.Wrap(err, "could not delete the mismatched values")
+		}
+		for _, issue := range ret {
+			issue.Fixed = true
+		}
+	}
+	return ret, nil
+}
+
+func (l *LogWriter) checkJSONValues(ctx context.Context, fix bool) ([]*DoctorIssue, error) {
+	invalid, unreadable := []interface{}{}, int64(0)
+	lastID := 0
+	for {
+		sb := sqlbuilder.Select("id", "type", "blob_value", "compression").From("log_entries_meta")
+		sb.Where(sb.G("id", lastID), sb.E("type", LogEntryTypeJSON), sb.IsNotNull("blob_value")).
+			OrderBy("id ASC").Limit(doctorBatchSize)
+		s, args := sb.Build()
+		rows := []*LogEntryMeta{}
+		if err := l.db.SelectContext(ctx, &rows, l.db.Rebind(s), args...); err != nil {
+			return nil, err
+		}
+		if len(rows) == 0 {
+			break
+		}
+		lastID = rows[len(rows)-1].ID
+
+		for _, row := range rows {
+			row.BlobDir, row.Cipher, row.FieldCipher = l.blobDir, l.cipher, l.fieldCipher
+			if _, err := row.Value(); err == nil {
+				continue
+			}
+			// values that can be read back but not parsed are invalid
+			if b, err := row.blob(); err == nil && !json.Valid(b) {
+				invalid = append(invalid, row.ID)
+			} else {
+				unreadable++
+			}
+		}
+	}
+
+	ret := []*DoctorIssue{}
+	if len(invalid) > 0 {
+		issue := &DoctorIssue{
+			Check:       DoctorInvalidJSON,
+			Table:       "log_entries_meta",
+			Description: "JSON values that can't be parsed",
+			Count:       int64(len(invalid)),
+		}
+		if fix {
+			ub := sqlbuilder.Update("log_entries_meta")
+			ub.Set(ub.Assign("type", LogEntryTypeBlob)).Where(ub.In("id", invalid...))
+			if err := l.exec(ctx, ub); err != nil {
+				return nil, errors.Wrap(err, "could not store the invalid JSON values as blobs")
+			}
+			issue.Fixed = true
+		}
+		ret = append(ret, issue)
+	}
+	if unreadable > 0 {
+		ret = append(ret, &DoctorIssue{
+			Check:       DoctorUnreadableValues,
+			Table:       "log_entries_meta",
+			Description: "values that can't be read back",
+			Count:       unreadable,
+		})
+	}
+	return ret, nil
+}
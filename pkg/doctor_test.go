@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterDoctor(t *testing.T) {
+	lw := newImportLogWriter(t)
+	ctx := context.Background()
+
+	_, err := lw.Write([]byte(`{"level": "info", "message": "healthy", "n": 1, "obj": {"a": 1}}`))
+	require.NoError(t, err)
+	issues, err := lw.Doctor(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+
+	for _, query := range []string{
+		"INSERT INTO log_entries_meta (log_entry_id, type, meta_key_id, text_value) VALUES (1, 1, 42, 'lost')",
+		"INSERT INTO log_entries_meta (log_entry_id, type, name, text_value) VALUES (99, 1, 'orphan', 'x')",
+		"INSERT INTO log_entries_meta (log_entry_id, type, name) VALUES (1, 4, 'empty')",
+		"INSERT INTO log_entries_meta (log_entry_id, type, name, blob_value) VALUES (1, 3, 'broken', '{\"a\":')",
+	} {
+		_, err := lw.db.Exec(query)
+		require.NoError(t, err)
+	}
+
+	issues, err = lw.Doctor(ctx)
+	require.NoError(t, err)
+	checks := map[DoctorCheck]int64{}
+	for _, issue := range issues {
+		checks[issue.Check] += issue.Count
+		assert.False(t, issue.Fixed)
+	}
+	assert.Equal(t, map[DoctorCheck]int64{
+		DoctorUnknownMetaKeys: 1,
+		DoctorOrphanedRows:    1,
+		DoctorTypeMismatches:  1,
+		DoctorInvalidJSON:     1,
+	}, checks)
+
+	issues, err = lw.Doctor(ctx, WithDoctorFix(true))
+	require.NoError(t, err)
+	assert.Len(t, issues, 4)
+	for _, issue := range issues {
+		assert.True(t, issue.Fixed)
+	}
+
+	issues, err = lw.Doctor(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, issues)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "lost", entries[0].Meta["unknown_key_42"])
+	assert.Equal(t, []byte(`{"a":`), entries[0].Meta["broken"])
+	assert.NotContains(t, entries[0].Meta, "empty")
+}
@@ -0,0 +1,100 @@
+package pkg
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Durations and times are stored in the int_value column of
+// log_entries_meta, as nanoseconds and UNIX nanoseconds, with their type
+// recorded so that they are read back as time.Duration and time.Time.
+//
+// zerolog's Dur writes a number of zerolog.DurationFieldUnit and Time a
+// string in zerolog.TimeFieldFormat, which can't be told apart from other
+// numbers and strings. The values of a key are only parsed as durations or
+// times if the key is declared with that type:
+//
+//	schema.MetaKeys.AddTyped("elapsed", LogEntryTypeDuration, "")
+//
+// or with the duration and time field types of a schema file. Values set
+// by middlewares that already are a time.Duration or time.Time are stored
+// as such whatever their key.
+
+// WithDurationUnit sets the unit of the numbers logged for duration keys,
+// zerolog.DurationFieldUnit by default.
+func WithDurationUnit(unit time.Duration) LogWriterOption {
+	return func(l *LogWriter) {
+		l.durationUnit = unit
+	}
+}
+
+// parseTimeValue converts a value logged for a key of type t to a
+// time.Duration or time.Time. It returns false for other types, and for
+// values that can't be parsed.
+func (l *LogWriter) parseTimeValue(t LogEntryType, v interface{}) (interface{}, bool) {
+	if n, ok := v.(json.Number); ok {
+		v = normalizeNumber(n)
+	}
+	switch t {
+	case LogEntryTypeDuration:
+		switch v := v.(type) {
+		case time.Duration:
+			return v, true
+		case int64:
+			return time.Duration(v) * l.durationUnit, true
+		case float64:
+			// zerolog writes fractional units unless DurationFieldInteger is set
+			return time.Duration(v * float64(l.durationUnit)), true
+		case string:
+			d, err := time.ParseDuration(v)
+			return d, err == nil
+		}
+	case LogEntryTypeTime:
+		if ts, err := parseTimestamp(v, l.timestampFormat); err == nil {
+			return ts, true
+		}
+		if s, ok := v.(string); ok {
+			ts, err := time.Parse(time.RFC3339Nano, s)
+			return ts.UTC(), err == nil
+		}
+	}
+	return nil, false
+}
+
+// parseFilterTimeValue parses the strings compared to a duration or time
+// key, such as "100ms" or "2023-05-01T12:00:00Z". Other values are
+// returned as is.
+func parseFilterTimeValue(t LogEntryType, v interface{}) interface{} {
+	s, ok := v.(string)
+	if !ok {
+		return v
+	}
+	switch t {
+	case LogEntryTypeDuration:
+		if d, err := time.ParseDuration(s); err == nil {
+			return d
+		}
+	case LogEntryTypeTime:
+		if ts, err := time.Parse(time.RFC3339Nano, s); err == nil {
+			return ts
+		}
+	}
+	return v
+}
+
+// MetaRange matches the entries whose value for Key is between From and To,
+// inclusive. A nil bound leaves that side of the range open.
+type MetaRange struct {
+	Key  string
+	From interface{}
+	To   interface{}
+}
+
+// WithMetaBetween matches the entries whose value for key is between from and
+// to, for example WithMetaBetween("elapsed", 100*time.Millisecond, time.Second)
+// for a duration key.
+func WithMetaBetween(key string, from interface{}, to interface{}) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.MetaRanges = append(f.MetaRanges, MetaRange{Key: key, From: from, To: to})
+	}
+}
@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestDurationAndTimeValues(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func() {
+		_ = db.Close()
+	}()
+	db.SetMaxOpenConns(1)
+
+	schema := NewSchema()
+	schema.MetaKeys.AddTyped("elapsed", LogEntryTypeDuration, "")
+	schema.MetaKeys.AddTyped("started", LogEntryTypeTime, "")
+	lw := NewLogWriter(db, schema)
+	require.NoError(t, lw.Init())
+
+	started := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	logger := zerolog.New(lw)
+	for _, d := range []time.Duration{50 * time.Millisecond, 250 * time.Millisecond, 1500 * time.Millisecond} {
+		logger.Info().Dur("elapsed", d).Time("started", started.Add(d)).Msg("request")
+	}
+	// untyped keys are left alone
+	logger.Info().Int("other", 250).Msg("other")
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithMetaBetween("elapsed", 100*time.Millisecond, time.Second)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 250*time.Millisecond, entries[0].Meta["elapsed"])
+	assert.Equal(t, started, entries[0].Meta["started"])
+	d, err := Get[time.Duration](entries[0], "elapsed")
+	require.NoError(t, err)
+	assert.Equal(t, 250*time.Millisecond, d)
+
+	// open ranges and time bounds
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaBetween("started", started.Add(time.Second), nil)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1500*time.Millisecond, entries[0].Meta["elapsed"])
+
+	// strings compared to duration keys are parsed
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithQueryString(`elapsed < "100ms"`)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 50*time.Millisecond, entries[0].Meta["elapsed"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"other": 250})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(250), entries[0].Meta["other"])
+}
+
+func TestParseTimeValue(t *testing.T) {
+	lw := &LogWriter{durationUnit: time.Second, timestampFormat: zerolog.TimeFormatUnixMs}
+
+	v, ok := lw.parseTimeValue(LogEntryTypeDuration, 1.5)
+	require.True(t, ok)
+	assert.Equal(t, 1500*time.Millisecond, v)
+	v, ok = lw.parseTimeValue(LogEntryTypeDuration, "2m")
+	require.True(t, ok)
+	assert.Equal(t, 2*time.Minute, v)
+	_, ok = lw.parseTimeValue(LogEntryTypeDuration, "soon")
+	assert.False(t, ok)
+
+	v, ok = lw.parseTimeValue(LogEntryTypeTime, int64(1682942400000))
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC), v)
+	v, ok = lw.parseTimeValue(LogEntryTypeTime, "2023-05-01T12:00:00.5Z")
+	require.True(t, ok)
+	assert.Equal(t, time.Date(2023, 5, 1, 12, 0, 0, 500000000, time.UTC), v)
+
+	_, ok = lw.parseTimeValue(LogEntryTypeInt, int64(1))
+	assert.False(t, ok)
+}
@@ -0,0 +1,173 @@
+package pkg
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// ValueEncoder converts a meta value before it gets stored, so that it ends
+// up in one of the typed columns rather than as JSON: the returned value
+// should be an integer, a float, a string or a []byte.
+type ValueEncoder func(v interface{}) (interface{}, error)
+
+// ValueEncodingError is returned when a ValueEncoder fails, the entry isn't
+// written.
+type ValueEncodingError struct {
+	Key string
+	Err error
+}
+
+func (e *ValueEncodingError) Error() string {
+	return fmt.Sprintf("could not encode the value of %s: %v", e.Key, e.Err)
+}
+
+func (e *ValueEncodingError) Unwrap() error {
+	return e.Err
+}
+
+// Encoders maps meta keys and Go types to the ValueEncoder converting their
+// values. An encoder registered for a key takes precedence over the one of
+// the value's type.
+//
+// Values decoded from JSON are strings, numbers, booleans, maps and slices,
+// type encoders are meant for the values set by middlewares. Only the top
+// level values of an entry are encoded.
+type Encoders struct {
+	keys  map[string]ValueEncoder
+	types map[reflect.Type]ValueEncoder
+}
+
+func NewEncoders() *Encoders {
+	return &Encoders{
+		keys:  map[string]ValueEncoder{},
+		types: map[reflect.Type]ValueEncoder{},
+	}
+}
+
+// RegisterKey encodes the values of key with encoder.
+func (e *Encoders) RegisterKey(key string, encoder ValueEncoder) *Encoders {
+	e.keys[key] = encoder
+	return e
+}
+
+// RegisterType encodes the values with the same type as example with encoder,
+// for example RegisterType(time.Duration(0), DurationEncoder(time.Millisecond)).
+func (e *Encoders) RegisterType(example interface{}, encoder ValueEncoder) *Encoders {
+	e.types[reflect.TypeOf(example)] = encoder
+	return e
+}
+
+// encode returns v converted by the encoder registered for key or its type,
+// or v itself if there is none.
+func (e *Encoders) encode(key string, v interface{}) (interface{}, error) {
+	encoder, ok := e.keys[key]
+	if !ok {
+		encoder, ok = e.types[reflect.TypeOf(v)]
+	}
+	if !ok || v == nil {
+		return v, nil
+	}
+	ret, err := encoder(v)
+	if err != nil {
+		return nil, &ValueEncodingError{Key: key, Err: err}
+	}
+	return ret, nil
+}
+
+// WithEncoders converts the meta values with encoders before they get stored.
+func WithEncoders(encoders *Encoders) LogWriterOption {
+	return func(l *LogWriter) {
+		l.encoders = encoders
+	}
+}
+
+// encodeMeta replaces the values of meta by their encoded value.
+func (l *LogWriter) encodeMeta(meta map[string]interface{}) error {
+	if l.encoders == nil {
+		return nil
+	}
+	for k, v := range meta {
+		encoded, err := l.encoders.encode(k, v)
+		if err != nil {
+			return err
+		}
+		meta[k] = encoded
+	}
+	return nil
+}
+
+// TextEncoder stores values implementing encoding.TextMarshaler or
+// fmt.Stringer, such as UUIDs or IP addresses, as text.
+func TextEncoder(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case encoding.TextMarshaler:
+		b, err := v.MarshalText()
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	case fmt.Stringer:
+		return v.String(), nil
+	default:
+		return nil, errors.Errorf("%T is neither a TextMarshaler nor a Stringer", v)
+	}
+}
+
+// FloatEncoder stores numbers and numeric strings, such as decimal amounts
+// logged as "12.50", as floats.
+func FloatEncoder(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case string:
+		return strconv.ParseFloat(v, 64)
+	case json.Number:
+		return v.Float64()
+	case fmt.Stringer:
+		// decimal types usually print as a plain number
+		return strconv.ParseFloat(v.String(), 64)
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(rv.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), nil
+	default:
+		return nil, errors.Errorf("%T is not a number", v)
+	}
+}
+
+// DurationEncoder stores time.Duration values and duration strings such as
+// "1.5s" as a number of unit, a float if the duration isn't a whole number
+// of units. Numbers are assumed to already be in unit.
+func DurationEncoder(unit time.Duration) ValueEncoder {
+	return func(v interface{}) (interface{}, error) {
+		var d time.Duration
+		switch v := v.(type) {
+		case time.Duration:
+			d = v
+		case string:
+			var err error
+			d, err = time.ParseDuration(v)
+			if err != nil {
+				return nil, err
+			}
+		case int64, float64:
+			return v, nil
+		default:
+			return nil, errors.Errorf("%T is not a duration", v)
+		}
+		if d%unit == 0 {
+			return int64(d / unit), nil
+		}
+		return float64(d) / float64(unit), nil
+	}
+}
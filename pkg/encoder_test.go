@@ -0,0 +1,43 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestEncoders(t *testing.T) {
+	encoders := NewEncoders().
+		RegisterKey("amount", FloatEncoder).
+		RegisterKey("elapsed", DurationEncoder(time.Millisecond)).
+		RegisterType(time.Duration(0), DurationEncoder(time.Millisecond)).
+		RegisterType(net.IP{}, TextEncoder)
+	lw := newImportLogWriter(t, WithEncoders(encoders), WithMiddleware(func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			entry["timeout"] = 1500 * time.Microsecond
+			entry["ip"] = net.ParseIP("10.0.0.1")
+			return next(entry)
+		}
+	}))
+
+	_, err := lw.Write([]byte(`{"level":"info","amount":"12.50","elapsed":"2s","other":"2s"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{
+		"amount":  12.5,
+		"elapsed": int64(2000),
+		"other":   "2s",
+		"timeout": 1.5,
+		"ip":      "10.0.0.1",
+	}, entries[0].Meta)
+
+	_, err = lw.Write([]byte(`{"level":"info","amount":"twelve"}`))
+	encodingErr, ok := err.(*ValueEncodingError)
+	require.True(t, ok)
+	assert.Equal(t, "amount", encodingErr.Key)
+}
@@ -0,0 +1,319 @@
+package pkg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Messages, error messages and chains, text, blob and JSON meta values and
+// the content of artifacts can be encrypted with AES-256-GCM, so that
+// sensitive logs can be stored on shared machines. Encrypted values are
+// stored as EncryptedValuePrefix followed by the base64 of the nonce and the
+// ciphertext, and GetEntries decrypts them transparently given the same key.
+//
+// Dates, levels, sessions, groups, callers and trace ids are stored in clear,
+// as are the values of wide meta keys. Encrypted values can't be matched by
+// filters (meta filters, search, WithErrorContains, and queries on message
+// or error), and are left out of the full-text index. Fingerprints are
+// encrypted with a nonce derived from their text, so that Patterns still
+// groups the entries by fingerprint, but they can't be queried either.
+
+// EncryptedValuePrefix starts the text or blob of encrypted values.
+const EncryptedValuePrefix = "plunger-enc:aes-gcm:"
+
+// EncryptionKeyEnvVar is the environment variable the command line reads the
+// encryption key from.
+const EncryptionKeyEnvVar = "PLUNGER_ENCRYPTION_KEY"
+
+// EncryptedValueError is returned when an encrypted value can't be decrypted,
+// because no key or the wrong key is configured.
+type EncryptedValueError struct {
+	Err error
+}
+
+func (e *EncryptedValueError) Error() string {
+	return fmt.Sprintf("could not decrypt value: %s", e.Err)
+}
+
+func (e *EncryptedValueError) Unwrap() error {
+	return e.Err
+}
+
+// WithEncryption encrypts the messages, errors and values written from then
+// on with a key derived from secret, and decrypts them when read back.
+// Readers of a database with encrypted values need this option as well.
+// Callers, sessions and trace ids stay in clear, see encrypt.go.
+func WithEncryption(secret string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.cipher = newEncryptionCipher(secret)
+		nonceKey := sha256.Sum256([]byte("fingerprint:" + secret))
+		l.nonceKey = nonceKey[:]
+	}
+}
+
+func newEncryptionCipher(secret string) cipher.AEAD {
+	key := sha256.Sum256([]byte(secret))
+	// a 32 bytes key can't be rejected
+	block, _ := aes.NewCipher(key[:])
+	aead, _ := cipher.NewGCM(block)
+	return aead
+}
+
+func encryptValue(aead cipher.AEAD, prefix string, b []byte) (string, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	return sealValue(aead, prefix, nonce, b), nil
+}
+
+func sealValue(aead cipher.AEAD, prefix string, nonce []byte, b []byte) string {
+	return prefix + base64.StdEncoding.EncodeToString(aead.Seal(nonce, nonce, b, nil))
+}
+
+func isEncrypted(b []byte) bool {
+	return strings.HasPrefix(string(b), EncryptedValuePrefix)
+}
+
+// decryptValue returns the plaintext of b if it was encrypted, else b itself.
+func decryptValue(aead cipher.AEAD, b []byte) ([]byte, error) {
+	if !isEncrypted(b) {
+		return b, nil
+	}
+	if aead == nil {
+		return nil, &EncryptedValueError{Err: errors.New("no encryption key configured")}
+	}
+	return openValue(aead, EncryptedValuePrefix, b)
+}
+
+func openValue(aead cipher.AEAD, prefix string, b []byte) ([]byte, error) {
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(string(b), prefix))
+	if err != nil {
+		return nil, &EncryptedValueError{Err: err}
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, &EncryptedValueError{Err: errors.New("truncated value")}
+	}
+	ret, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return nil, &EncryptedValueError{Err: err}
+	}
+	return ret, nil
+}
+
+// encryptMetaValue encrypts the text or blob of value, if encryption is enabled.
+// Blobs are encrypted after being compressed and before being offloaded.
+func (l *LogWriter) encryptMetaValue(value *metaValue) error {
+	if l.cipher == nil {
+		return nil
+	}
+	if value.Text.Valid {
+		s, err := encryptValue(l.cipher, EncryptedValuePrefix, []byte(value.Text.String))
+		if err != nil {
+			return err
+		}
+		value.Text.String = s
+	}
+	if value.Blob.Valid {
+		s, err := encryptValue(l.cipher, EncryptedValuePrefix, []byte(value.Blob.String))
+		if err != nil {
+			return err
+		}
+		value.Blob.String = s
+	}
+	return nil
+}
+
+// encryptedColumns are the columns of log_entries encrypted by encryptColumns.
+type encryptedColumns struct {
+	message     sql.NullString
+	fingerprint sql.NullString
+	err         entryError
+}
+
+// encryptColumns fingerprints message, and encrypts the text columns of an
+// entry if encryption is enabled.
+func (l *LogWriter) encryptColumns(message sql.NullString, errorValue entryError) (*encryptedColumns, error) {
+	ret := &encryptedColumns{message: message, fingerprint: fingerprintColumn(message), err: errorValue}
+	if l.cipher == nil {
+		return ret, nil
+	}
+
+	var err error
+	if ret.message, err = l.encryptColumn(message); err != nil {
+		return nil, err
+	}
+	if ret.err.Message, err = l.encryptColumn(errorValue.Message); err != nil {
+		return nil, err
+	}
+	if errorValue.Chain != nil {
+		ret.err.Chain = ErrorChain{}
+		for _, e := range errorValue.Chain {
+			s, err := encryptValue(l.cipher, EncryptedValuePrefix, []byte(e))
+			if err != nil {
+				return nil, err
+			}
+			ret.err.Chain = append(ret.err.Chain, s)
+		}
+	}
+	if ret.fingerprint.Valid {
+		ret.fingerprint.String = l.encryptFingerprint(ret.fingerprint.String)
+	}
+	return ret, nil
+}
+
+func (l *LogWriter) encryptColumn(s sql.NullString) (sql.NullString, error) {
+	if !s.Valid {
+		return s, nil
+	}
+	encrypted, err := encryptValue(l.cipher, EncryptedValuePrefix, []byte(s.String))
+	if err != nil {
+		return s, err
+	}
+	return sql.NullString{String: encrypted, Valid: true}, nil
+}
+
+// encryptFingerprint encrypts fingerprint with a nonce derived from it, so
+// that the entries of a pattern share the same encrypted fingerprint.
+func (l *LogWriter) encryptFingerprint(fingerprint string) string {
+	mac := hmac.New(sha256.New, l.nonceKey)
+	_, _ = mac.Write([]byte(fingerprint))
+	nonce := mac.Sum(nil)[:l.cipher.NonceSize()]
+	return sealValue(l.cipher, EncryptedValuePrefix, nonce, []byte(fingerprint))
+}
+
+// decryptColumns decrypts the text columns of entry encrypted by encryptColumns.
+func (l *LogWriter) decryptColumns(entry *LogEntry) error {
+	for _, s := range []*string{entry.Message, entry.Fingerprint, entry.Error} {
+		if err := l.decryptString(s); err != nil {
+			return err
+		}
+	}
+	for i := range entry.ErrorChain {
+		if err := l.decryptString(&entry.ErrorChain[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptString decrypts *s in place, if it is set and encrypted.
+func (l *LogWriter) decryptString(s *string) error {
+	if s == nil {
+		return nil
+	}
+	b, err := decryptValue(l.cipher, []byte(*s))
+	if err != nil {
+		return err
+	}
+	*s = string(b)
+	return nil
+}
+
+// The values of selected keys can be encrypted on their own, whatever their
+// type, see WithEncryptedKeys. Their type is kept, and their value is stored
+// encrypted in text_value, or in blob_value for blob and JSON values, starting
+// with EncryptedFieldPrefix. Readers without the key get RedactedValue
+// instead of these values.
+
+// EncryptedFieldPrefix starts the values of the keys encrypted by WithEncryptedKeys.
+const EncryptedFieldPrefix = "plunger-enc:field:aes-gcm:"
+
+// FieldEncryptionKeyEnvVar is the environment variable the command line reads
+// the key of encrypted keys from.
+const FieldEncryptionKeyEnvVar = "PLUNGER_FIELD_ENCRYPTION_KEY"
+
+// errMissingFieldKey is returned when reading an encrypted key without its key.
+var errMissingFieldKey = errors.New("no field encryption key configured")
+
+// WithEncryptedKeys encrypts the values of keys with a key derived from
+// secret, and decrypts the values of encrypted keys read back. Readers only
+// need the secret, without keys. Values of wide meta keys are stored in clear.
+func WithEncryptedKeys(secret string, keys ...string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.fieldCipher = newEncryptionCipher(secret)
+		if l.encryptedKeys == nil {
+			l.encryptedKeys = map[string]bool{}
+		}
+		for _, key := range keys {
+			l.encryptedKeys[key] = true
+		}
+	}
+}
+
+func isEncryptedField(b []byte) bool {
+	return strings.HasPrefix(string(b), EncryptedFieldPrefix)
+}
+
+// decryptField returns the plaintext of b if it is the value of an encrypted
+// key, else b itself.
+func decryptField(aead cipher.AEAD, b []byte) ([]byte, error) {
+	if !isEncryptedField(b) {
+		return b, nil
+	}
+	if aead == nil {
+		return nil, errMissingFieldKey
+	}
+	return openValue(aead, EncryptedFieldPrefix, b)
+}
+
+// encryptField stores the value of an encrypted key in its text or blob.
+func (l *LogWriter) encryptField(value *metaValue) error {
+	var err error
+	switch {
+	case value.Int.Valid:
+		value.Text.String, err = encryptValue(l.fieldCipher, EncryptedFieldPrefix, []byte(strconv.FormatInt(value.Int.Int64, 10)))
+		value.Text.Valid = true
+		value.Int = sql.NullInt64{}
+	case value.Real.Valid:
+		value.Text.String, err = encryptValue(l.fieldCipher, EncryptedFieldPrefix,
+			[]byte(strconv.FormatFloat(value.Real.Float64, 'g', -1, 64)))
+		value.Text.Valid = true
+		value.Real = sql.NullFloat64{}
+	case value.Text.Valid:
+		value.Text.String, err = encryptValue(l.fieldCipher, EncryptedFieldPrefix, []byte(value.Text.String))
+	case value.Blob.Valid:
+		value.Blob.String, err = encryptValue(l.fieldCipher, EncryptedFieldPrefix, []byte(value.Blob.String))
+	}
+	return err
+}
+
+// decryptFieldValue restores the int or real value of an encrypted key from
+// its text, see encryptField.
+func (lem *LogEntryMeta) decryptFieldValue() error {
+	if lem.TextValue == nil || !isEncryptedField([]byte(*lem.TextValue)) {
+		return nil
+	}
+	b, err := decryptField(lem.FieldCipher, []byte(*lem.TextValue))
+	if err != nil {
+		return err
+	}
+	s := string(b)
+	switch lem.Type {
+	case LogEntryTypeInt, LogEntryTypeDuration, LogEntryTypeTime, LogEntryTypeBool:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return &EncryptedValueError{Err: err}
+		}
+		lem.IntValue, lem.TextValue = &n, nil
+	case LogEntryTypeReal:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return &EncryptedValueError{Err: err}
+		}
+		lem.RealValue, lem.TextValue = &f, nil
+	default:
+		lem.TextValue = &s
+	}
+	return nil
+}
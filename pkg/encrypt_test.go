@@ -0,0 +1,147 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestEncryption(t *testing.T) {
+	lw := newImportLogWriter(t, WithEncryption("secret"), WithCompression(CompressionZstd, 100))
+
+	large := strings.Repeat("abc", 100)
+	_, err := lw.Write([]byte(`{"level": "info", "message": "login", "password": "hunter2", "n": 3, "large": {"text": "` + large + `"}}`))
+	require.NoError(t, err)
+
+	var stored []string
+	require.NoError(t, lw.db.Select(&stored,
+		"SELECT CAST(COALESCE(text_value, blob_value) AS TEXT) FROM log_entries_meta WHERE name IN ('password', 'large')"))
+	require.Len(t, stored, 2)
+	for _, v := range stored {
+		assert.True(t, strings.HasPrefix(v, EncryptedValuePrefix))
+		assert.NotContains(t, v, "hunter2")
+	}
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "hunter2", entries[0].Meta["password"])
+	assert.Equal(t, int64(3), entries[0].Meta["n"])
+	assert.Equal(t, map[string]interface{}{"text": large}, entries[0].Meta["large"])
+
+	// encrypted values aren't compacted twice
+	res, err := lw.Compact(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, 0, res.Values)
+
+	WithEncryption("wrong")(lw)
+	_, err = lw.GetEntries(nil)
+	var encryptedErr *EncryptedValueError
+	assert.ErrorAs(t, err, &encryptedErr)
+
+	lw.cipher = nil
+	_, err = lw.GetEntries(nil)
+	assert.ErrorAs(t, err, &encryptedErr)
+}
+
+func TestEncryptedColumns(t *testing.T) {
+	lw := newImportLogWriter(t, WithEncryption("secret"))
+	for _, line := range []string{
+		`{"level": "error", "message": "login failed for 42", "error": "bad password hunter2"}`,
+		`{"level": "error", "message": "login failed for 7"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	var stored []struct {
+		Message     string  `db:"message"`
+		Fingerprint string  `db:"fingerprint"`
+		Error       *string `db:"error_message"`
+	}
+	require.NoError(t, lw.db.Select(&stored, "SELECT message, fingerprint, error_message FROM log_entries ORDER BY id"))
+	require.Len(t, stored, 2)
+	for _, v := range []string{stored[0].Message, stored[0].Fingerprint, *stored[0].Error} {
+		assert.True(t, strings.HasPrefix(v, EncryptedValuePrefix))
+		assert.NotContains(t, v, "login")
+		assert.NotContains(t, v, "hunter2")
+	}
+	// the messages of a pattern share their encrypted fingerprint
+	assert.Equal(t, stored[0].Fingerprint, stored[1].Fingerprint)
+	assert.NotEqual(t, stored[0].Message, stored[1].Message)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "login failed for 42", *entries[0].Message)
+	assert.Equal(t, "login failed for <num>", *entries[0].Fingerprint)
+	assert.Equal(t, "bad password hunter2", *entries[0].Error)
+
+	patterns, err := lw.Patterns(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, patterns, 1)
+	assert.Equal(t, "login failed for <num>", patterns[0].Fingerprint)
+	assert.Equal(t, 2, patterns[0].Count)
+	assert.True(t, strings.HasPrefix(patterns[0].Example, "login failed for "))
+}
+
+func TestEncryptedArtifact(t *testing.T) {
+	lw := newImportLogWriter(t, WithEncryption("secret"))
+	ctx := context.Background()
+
+	session := "s1"
+	artifact := &Artifact{SessionID: &session, Name: "notes.txt"}
+	require.NoError(t, lw.AddArtifact(ctx, artifact, []byte("top secret")))
+
+	var stored string
+	require.NoError(t, lw.db.Get(&stored, "SELECT CAST(data AS TEXT) FROM artifacts"))
+	assert.NotContains(t, stored, "top secret")
+
+	_, data, err := lw.ReadArtifact(ctx, artifact.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "top secret", string(data))
+}
+
+func TestEncryptedKeys(t *testing.T) {
+	lw := newImportLogWriter(t, WithEncryptedKeys("secret", "ssn", "score", "amount", "card"))
+
+	_, err := lw.Write([]byte(`{"level": "info", "message": "payment", "ssn": "078-05-1120", "score": 0.5, "amount": 42, "card": {"last4": "4242"}, "user": "bob"}`))
+	require.NoError(t, err)
+
+	var stored []string
+	require.NoError(t, lw.db.Select(&stored,
+		"SELECT CAST(COALESCE(text_value, blob_value) AS TEXT) FROM log_entries_meta WHERE name <> 'user' ORDER BY name"))
+	require.Len(t, stored, 4)
+	for _, v := range stored {
+		assert.True(t, strings.HasPrefix(v, EncryptedFieldPrefix))
+	}
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{
+		"ssn":    "078-05-1120",
+		"score":  0.5,
+		"amount": int64(42),
+		"card":   map[string]interface{}{"last4": "4242"},
+		"user":   "bob",
+	}, entries[0].Meta)
+
+	lw.fieldCipher = nil
+	entries, err = lw.GetEntries(nil)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"ssn":    RedactedValue,
+		"score":  RedactedValue,
+		"amount": RedactedValue,
+		"card":   RedactedValue,
+		"user":   "bob",
+	}, entries[0].Meta)
+
+	WithEncryptedKeys("wrong")(lw)
+	_, err = lw.GetEntries(nil)
+	var encryptedErr *EncryptedValueError
+	assert.ErrorAs(t, err, &encryptedErr)
+}
@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Keys of the process metadata stamped on entries by an Enricher.
+const (
+	HostnameKey   = "hostname"
+	PIDKey        = "pid"
+	ExecutableKey = "executable"
+)
+
+// Enricher stamps every entry with the metadata of the writing process and
+// static fields such as the service name and version, so that the entries of
+// several processes sharing a database can be told apart. Fields already set
+// on an entry are kept.
+type Enricher struct {
+	fields map[string]interface{}
+}
+
+type EnrichOption func(*enrichOptions)
+
+type enrichOptions struct {
+	process bool
+	fields  map[string]interface{}
+}
+
+// WithEnrichProcess stamps the hostname, pid and executable name of the
+// process (HostnameKey, PIDKey, ExecutableKey). Enabled by default.
+func WithEnrichProcess(process bool) EnrichOption {
+	return func(o *enrichOptions) {
+		o.process = process
+	}
+}
+
+// WithEnrichFields stamps static fields, such as service and version.
+func WithEnrichFields(fields map[string]interface{}) EnrichOption {
+	return func(o *enrichOptions) {
+		for k, v := range fields {
+			o.fields[k] = v
+		}
+	}
+}
+
+// ParseEnrichFields parses key=value pairs, such as service=api.
+func ParseEnrichFields(pairs []string) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	for _, pair := range pairs {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || k == "" {
+			return nil, &InvalidEnrichFieldError{Field: pair}
+		}
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+type InvalidEnrichFieldError struct {
+	Field string
+}
+
+func (e *InvalidEnrichFieldError) Error() string {
+	return "invalid field " + e.Field + ", expected key=value"
+}
+
+func NewEnricher(opts ...EnrichOption) *Enricher {
+	o := &enrichOptions{process: true, fields: map[string]interface{}{}}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	e := &Enricher{fields: map[string]interface{}{}}
+	if o.process {
+		e.fields[PIDKey] = int64(os.Getpid())
+		if hostname, err := os.Hostname(); err == nil {
+			e.fields[HostnameKey] = hostname
+		}
+		e.fields[ExecutableKey] = executableName()
+	}
+	for k, v := range o.fields {
+		e.fields[k] = v
+	}
+	return e
+}
+
+func executableName() string {
+	if path, err := os.Executable(); err == nil {
+		return filepath.Base(path)
+	}
+	return filepath.Base(os.Args[0])
+}
+
+// Enrich adds the fields of the Enricher missing from entry.
+func (e *Enricher) Enrich(entry map[string]interface{}) {
+	for k, v := range e.fields {
+		if _, ok := entry[k]; !ok {
+			entry[k] = v
+		}
+	}
+}
+
+// AddMetaKeys declares the keys of the Enricher in metaKeys, typed after
+// their values (PIDKey as an int), so that the values logged by other call
+// sites are coerced to the same type. Keys declared already are kept as is.
+func (e *Enricher) AddMetaKeys(metaKeys *MetaKeys) {
+	for k, v := range e.fields {
+		if _, ok := metaKeys.Get(k); !ok {
+			metaKeys.AddTyped(k, ToLogEntryType(v), TypeValidationCoerce)
+		}
+	}
+}
+
+// EnrichMiddleware returns a Middleware enriching entries with an Enricher
+// configured by opts. Its keys aren't declared in the schema, see WithEnrichment.
+func EnrichMiddleware(opts ...EnrichOption) Middleware {
+	return NewEnricher(opts...).Middleware
+}
+
+// WithEnrichment enriches the entries with an Enricher configured by opts,
+// and declares its keys in the schema of the LogWriter, see AddMetaKeys.
+func WithEnrichment(opts ...EnrichOption) LogWriterOption {
+	return func(l *LogWriter) {
+		e := NewEnricher(opts...)
+		e.AddMetaKeys(l.schema.MetaKeys)
+		l.middlewares = append(l.middlewares, e.Middleware)
+	}
+}
+
+func (e *Enricher) Middleware(next EntryHandler) EntryHandler {
+	return func(entry map[string]interface{}) error {
+		e.Enrich(entry)
+		return next(entry)
+	}
+}
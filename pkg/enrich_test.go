@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestEnrichMiddleware(t *testing.T) {
+	lw := newImportLogWriter(t, WithEnrichment(
+		WithEnrichFields(map[string]interface{}{"service": "api", "version": "1.2.0"}),
+	))
+
+	for name, typ := range map[string]LogEntryType{
+		PIDKey:        LogEntryTypeInt,
+		HostnameKey:   LogEntryTypeText,
+		ExecutableKey: LogEntryTypeText,
+		"service":     LogEntryTypeText,
+		"version":     LogEntryTypeText,
+	} {
+		key, ok := lw.schema.MetaKeys.Get(name)
+		require.True(t, ok, name)
+		assert.Equal(t, typ, key.Type, name)
+		assert.Equal(t, TypeValidationCoerce, key.TypeValidation, name)
+	}
+
+	_, err := lw.Write([]byte(`{"level": "info", "message": "hello", "version": "override"}`))
+	require.NoError(t, err)
+	// values logged by other call sites are coerced to the declared type
+	_, err = lw.Write([]byte(`{"level": "info", "message": "forked", "pid": "42"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(42), entries[1].Meta[PIDKey])
+	meta := entries[0].Meta
+	assert.Equal(t, int64(os.Getpid()), meta[PIDKey])
+	assert.NotEmpty(t, meta[ExecutableKey])
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+	assert.Equal(t, hostname, meta[HostnameKey])
+	assert.Equal(t, "api", meta["service"])
+	// fields of the entry win
+	assert.Equal(t, "override", meta["version"])
+}
+
+func TestEnricherWithoutProcess(t *testing.T) {
+	fields, err := ParseEnrichFields([]string{"service=api"})
+	require.NoError(t, err)
+	entry := map[string]interface{}{}
+	NewEnricher(WithEnrichProcess(false), WithEnrichFields(fields)).Enrich(entry)
+	assert.Equal(t, map[string]interface{}{"service": "api"}, entry)
+
+	_, err = ParseEnrichFields([]string{"service"})
+	assert.Error(t, err)
+}
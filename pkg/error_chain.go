@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"encoding/json"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"strings"
+)
+
+// The error field added by zerolog's Err() is stored in the error_message
+// column of log_entries rather than as meta, so that entries can be filtered
+// by error with WithErrorContains.
+//
+// When the stack marshaler is active, zerolog.ErrorStackMarshaler set to
+// pkgerrors.MarshalStack for example, the chain of wrapped errors is stored
+// as well, in the error_chain column. zerolog only logs the text of the
+// error, so the chain is recovered from the ": " separating the messages of
+// errors.Wrap and fmt.Errorf("...: %w").
+
+// ErrorChain is the messages of an error and of the errors it wraps, from
+// the outermost to the innermost one.
+type ErrorChain []string
+
+func (c ErrorChain) Value() (driver.Value, error) {
+	if c == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal([]string(c))
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+func (c *ErrorChain) Scan(src interface{}) error {
+	var b []byte
+	switch src := src.(type) {
+	case nil:
+		*c = nil
+		return nil
+	case string:
+		b = []byte(src)
+	case []byte:
+		b = src
+	default:
+		return errors.Errorf("cannot scan %T into an error chain", src)
+	}
+	var ret []string
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return errors.Wrap(err, "could not decode error chain")
+	}
+	*c = ret
+	return nil
+}
+
+// entryError holds the error columns of a log entry.
+type entryError struct {
+	Message sql.NullString
+	Chain   ErrorChain
+}
+
+// parseError extracts the error columns from the error field of log. Errors
+// logged with Errs are arrays, their first element is used as the message.
+func parseError(log map[string]interface{}) (entryError, bool) {
+	ret := entryError{}
+	switch v := log[zerolog.ErrorFieldName].(type) {
+	case string:
+		ret.Message = sql.NullString{String: v, Valid: true}
+		if _, ok := log[zerolog.ErrorStackFieldName]; ok {
+			ret.Chain = unwrapErrorMessage(v)
+		}
+	case []interface{}:
+		chain := ErrorChain{}
+		for _, e := range v {
+			s, ok := e.(string)
+			if !ok {
+				return entryError{}, false
+			}
+			chain = append(chain, s)
+		}
+		if len(chain) == 0 {
+			return entryError{}, false
+		}
+		ret.Message = sql.NullString{String: chain[0], Valid: true}
+		ret.Chain = chain
+	default:
+		return entryError{}, false
+	}
+	return ret, true
+}
+
+// unwrapErrorMessage returns the messages of the errors wrapped in message,
+// assuming each one was wrapped as "context: cause".
+func unwrapErrorMessage(message string) ErrorChain {
+	ret := ErrorChain{message}
+	for {
+		i := strings.Index(message, ": ")
+		if i < 0 {
+			return ret
+		}
+		message = message[i+2:]
+		ret = append(ret, message)
+	}
+}
+
+func (e *LogEntry) errorColumns() entryError {
+	ret := entryError{Chain: e.ErrorChain}
+	if e.Error != nil {
+		ret.Message = sql.NullString{String: *e.Error, Valid: true}
+	}
+	return ret
+}
+
+// WithErrorContains matches the entries whose error message contains s.
+func WithErrorContains(s string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.ErrorContains = s
+	}
+}
+
+func errorCondition(c *sqlbuilder.Cond, s string) string {
+	return c.Like("error_message", "%"+s+"%")
+}
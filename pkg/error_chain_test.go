@@ -0,0 +1,61 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestErrorColumns(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	_, err := lw.Write([]byte(`{"level":"error","message":"failed","error":"open db: open /tmp/x.db: permission denied",` +
+		`"stack":[{"func":"open","line":"12"}]}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level":"warn","message":"retrying","error":"connection refused"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level":"info","message":"started"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.NotNil(t, entries[0].Error)
+	assert.Equal(t, "open db: open /tmp/x.db: permission denied", *entries[0].Error)
+	assert.Equal(t, ErrorChain{
+		"open db: open /tmp/x.db: permission denied",
+		"open /tmp/x.db: permission denied",
+		"permission denied",
+	}, entries[0].ErrorChain)
+	assert.NotContains(t, entries[0].Meta, "error")
+	assert.Contains(t, entries[0].Meta, "stack")
+
+	// without a stack the chain isn't recorded
+	require.NotNil(t, entries[1].Error)
+	assert.Equal(t, "connection refused", *entries[1].Error)
+	assert.Nil(t, entries[1].ErrorChain)
+	assert.Nil(t, entries[2].Error)
+
+	messages := func(filter *GetEntriesFilter) []string {
+		entries, err := lw.GetEntries(filter)
+		require.NoError(t, err)
+		ret := []string{}
+		for _, entry := range entries {
+			ret = append(ret, *entry.Message)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"failed"}, messages(NewGetEntriesFilter(WithErrorContains("permission"))))
+	assert.Equal(t, []string{"retrying"}, messages(NewGetEntriesFilter(WithQueryString(`error~"refused"`))))
+	assert.Empty(t, messages(NewGetEntriesFilter(WithErrorContains("timeout"))))
+}
+
+func TestParseErrorArray(t *testing.T) {
+	e, ok := parseError(map[string]interface{}{"error": []interface{}{"outer", "inner"}})
+	require.True(t, ok)
+	assert.Equal(t, "outer", e.Message.String)
+	assert.Equal(t, ErrorChain{"outer", "inner"}, e.Chain)
+
+	_, ok = parseError(map[string]interface{}{"error": map[string]interface{}{"code": 1}})
+	assert.False(t, ok)
+}
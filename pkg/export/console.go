@@ -0,0 +1,197 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The console format mimics zerolog's ConsoleWriter, so that entries read
+// back from the database look like what the application printed:
+//
+//	2023-08-19T10:00:00Z INF main.go:42 > hello error="connection refused" foo=bar session=s1
+//
+// The error comes first, followed by the other meta values, the session and
+// the trace ids, sorted by key.
+
+const (
+	colorRed      = 31
+	colorGreen    = 32
+	colorYellow   = 33
+	colorMagenta  = 35
+	colorCyan     = 36
+	colorBold     = 1
+	colorDarkGray = 90
+)
+
+var consoleLevels = map[string]struct {
+	name  string
+	color int
+	bold  bool
+}{
+	"trace":   {"TRC", colorMagenta, false},
+	"debug":   {"DBG", colorYellow, false},
+	"info":    {"INF", colorGreen, false},
+	"warn":    {"WRN", colorRed, false},
+	"warning": {"WRN", colorRed, false},
+	"error":   {"ERR", colorRed, true},
+	"fatal":   {"FTL", colorRed, true},
+	"panic":   {"PNC", colorRed, true},
+}
+
+// consoleErrorKey is the meta key printed first and in red, as zerolog does
+// for its error field.
+const consoleErrorKey = "error"
+
+type ConsoleFormatter struct {
+	noColor    bool
+	timeFormat string
+}
+
+type ConsoleOption func(*ConsoleFormatter)
+
+// WithConsoleNoColor disables the ANSI colors, for output that isn't a terminal.
+func WithConsoleNoColor(noColor bool) ConsoleOption {
+	return func(f *ConsoleFormatter) {
+		f.noColor = noColor
+	}
+}
+
+// WithConsoleTimeFormat sets the layout of the timestamps, time.RFC3339 by default.
+func WithConsoleTimeFormat(layout string) ConsoleOption {
+	return func(f *ConsoleFormatter) {
+		f.timeFormat = layout
+	}
+}
+
+func NewConsoleFormatter(opts ...ConsoleOption) *ConsoleFormatter {
+	f := &ConsoleFormatter{
+		timeFormat: time.RFC3339,
+	}
+	for _, opt := range opts {
+		opt(f)
+	}
+	return f
+}
+
+// Write writes entry to w on a single line.
+func (f *ConsoleFormatter) Write(w io.Writer, entry *pkg.LogEntry) error {
+	_, err := fmt.Fprintln(w, f.Format(entry))
+	return err
+}
+
+// Format renders entry on a single line, without a trailing newline.
+func (f *ConsoleFormatter) Format(entry *pkg.LogEntry) string {
+	parts := []string{
+		f.colorize(entry.Date.Format(f.timeFormat), colorDarkGray),
+		f.formatLevel(entry.Level),
+	}
+	if caller := entry.Caller(); caller != "" {
+		parts = append(parts, f.colorize(caller, colorBold)+f.colorize(" >", colorCyan))
+	}
+	if entry.Message != nil && *entry.Message != "" {
+		parts = append(parts, *entry.Message)
+	}
+
+	fields := map[string]interface{}{}
+	for k, v := range entry.Meta {
+		fields[k] = v
+	}
+	if entry.Session != nil {
+		fields["session"] = *entry.Session
+	}
+	if entry.Error != nil {
+		fields[consoleErrorKey] = *entry.Error
+	}
+	if entry.TraceID != nil {
+		fields[TraceIDColumn] = *entry.TraceID
+	}
+	if entry.SpanID != nil {
+		fields[SpanIDColumn] = *entry.SpanID
+	}
+	keys := []string{}
+	for k := range fields {
+		if k != consoleErrorKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	if _, ok := fields[consoleErrorKey]; ok {
+		keys = append([]string{consoleErrorKey}, keys...)
+	}
+
+	for _, k := range keys {
+		value := formatConsoleValue(fields[k])
+		if k == consoleErrorKey {
+			parts = append(parts, f.colorize(k+"=", colorRed)+f.colorize(value, colorRed))
+		} else {
+			parts = append(parts, f.colorize(k+"=", colorCyan)+value)
+		}
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func (f *ConsoleFormatter) formatLevel(level string) string {
+	l, ok := consoleLevels[strings.ToLower(level)]
+	if !ok {
+		name := "???"
+		if level != "" {
+			name = strings.ToUpper(level)
+			if len(name) > 3 {
+				name = name[:3]
+			}
+		}
+		return f.colorize(name, colorBold)
+	}
+	if l.bold {
+		return f.colorize(f.colorize(l.name, l.color), colorBold)
+	}
+	return f.colorize(l.name, l.color)
+}
+
+func (f *ConsoleFormatter) colorize(s string, color int) string {
+	if f.noColor {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
+
+// formatConsoleValue renders a meta value like zerolog does: strings are
+// quoted if they contain spaces or special characters, other values are
+// rendered as JSON.
+func formatConsoleValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		if needsQuote(v) {
+			return strconv.Quote(v)
+		}
+		return v
+	case []byte:
+		s := string(v)
+		if needsQuote(s) {
+			return strconv.Quote(s)
+		}
+		return s
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	}
+}
+
+func needsQuote(s string) bool {
+	for _, c := range s {
+		if c < 0x21 || c == '"' || c == '\\' {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+//go:build duckdb
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/marcboeker/go-duckdb"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// ExportDuckDB copies the entries returned by it into the log_entries table
+// of the DuckDB database at path, replacing the table if it exists.
+//
+// The table has one typed column per exported column, as for Parquet
+// exports, which makes aggregations over many entries fast:
+//
+//	duckdb logs.duckdb "SELECT level, count(*) FROM log_entries GROUP BY level"
+func (e *Exporter) ExportDuckDB(ctx context.Context, path string, it pkg.EntryIterator) error {
+	entries, err := e.collect(it)
+	if err != nil {
+		return err
+	}
+	columns := e.columns
+	if len(columns) == 0 {
+		columns = Columns(entries)
+	}
+
+	kinds := map[string]columnKind{}
+	definitions := []string{}
+	for _, column := range columns {
+		typ := "VARCHAR"
+		switch column {
+		case "id":
+			typ = "BIGINT"
+		case "date":
+			typ = "TIMESTAMP"
+		case "level", "session", "message", CallerColumn, ErrorColumn, TraceIDColumn, SpanIDColumn:
+		default:
+			kinds[column] = inferColumnKind(entries, column)
+			switch kinds[column] {
+			case kindBool:
+				typ = "BOOLEAN"
+			case kindInt:
+				typ = "BIGINT"
+			case kindDouble:
+				typ = "DOUBLE"
+			}
+		}
+		definitions = append(definitions, quoteDuckDBIdentifier(column)+" "+typ)
+	}
+
+	connector, err := duckdb.NewConnector(path, nil)
+	if err != nil {
+		return errors.Wrapf(err, "could not open %s", path)
+	}
+	db := sql.OpenDB(connector)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	_, err = db.ExecContext(ctx, "CREATE OR REPLACE TABLE "+duckDBTable+" ("+strings.Join(definitions, ", ")+")")
+	if err != nil {
+		return err
+	}
+
+	conn, err := connector.Connect(ctx)
+	if err != nil {
+		return err
+	}
+	defer func(conn driver.Conn) {
+		_ = conn.Close()
+	}(conn)
+	appender, err := duckdb.NewAppenderFromConn(conn, "", duckDBTable)
+	if err != nil {
+		return err
+	}
+
+	row := make([]driver.Value, len(columns))
+	for _, entry := range entries {
+		for i, column := range columns {
+			switch column {
+			case "id":
+				row[i] = int64(entry.ID)
+			case "date":
+				row[i] = entry.Date
+			case "level", "session", "message", CallerColumn, ErrorColumn, TraceIDColumn, SpanIDColumn:
+				row[i] = ColumnValue(entry, column)
+			default:
+				row[i] = typedValue(entry.Meta[column], kinds[column])
+			}
+		}
+		if err := appender.AppendRowArray(row); err != nil {
+			_ = appender.Close()
+			return err
+		}
+	}
+
+	return appender.Close()
+}
+
+const duckDBTable = "log_entries"
+
+func quoteDuckDBIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
@@ -0,0 +1,13 @@
+//go:build !duckdb
+
+package export
+
+import (
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+)
+
+// ExportDuckDB requires plunger to be built with the duckdb build tag.
+func (e *Exporter) ExportDuckDB(ctx context.Context, path string, it pkg.EntryIterator) error {
+	return &MissingDuckDBError{}
+}
@@ -0,0 +1,81 @@
+//go:build duckdb
+
+package export
+
+import (
+	"context"
+	"database/sql"
+	"github.com/go-go-golems/plunger/pkg"
+	_ "github.com/marcboeker/go-duckdb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestExportDuckDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.duckdb")
+	entries := testEntries()
+	entries[0].Meta["count"] = float64(3)
+	message := "second"
+	entries = append(entries, &pkg.LogEntry{
+		ID:      2,
+		Date:    time.Date(2023, 8, 19, 10, 0, 1, 0, time.UTC),
+		Level:   "warn",
+		Message: &message,
+		Meta:    map[string]interface{}{"count": float64(4), "foo": true},
+	})
+
+	e := NewExporter()
+	require.NoError(t, e.ExportDuckDB(context.Background(), path, pkg.NewSliceIterator(entries)))
+	// exporting again replaces the table
+	require.NoError(t, e.ExportDuckDB(context.Background(), path, pkg.NewSliceIterator(entries)))
+
+	db, err := sql.Open("duckdb", path)
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+
+	var total int64
+	var first time.Time
+	require.NoError(t, db.QueryRow(`SELECT sum(count), min(date) FROM log_entries`).Scan(&total, &first))
+	assert.Equal(t, int64(7), total)
+	assert.True(t, entries[0].Date.Equal(first))
+
+	types := map[string]string{}
+	rows, err := db.Query(`SELECT column_name, data_type FROM information_schema.columns WHERE table_name = 'log_entries'`)
+	require.NoError(t, err)
+	for rows.Next() {
+		var name, typ string
+		require.NoError(t, rows.Scan(&name, &typ))
+		types[name] = typ
+	}
+	require.NoError(t, rows.Err())
+	assert.Equal(t, "BIGINT", types["id"])
+	assert.Equal(t, "TIMESTAMP", types["date"])
+	assert.Equal(t, "BIGINT", types["count"])
+	// mixed values are stored as strings
+	assert.Equal(t, "VARCHAR", types["foo"])
+	assert.Equal(t, "VARCHAR", types["obj"])
+
+	var session sql.NullString
+	require.NoError(t, db.QueryRow(`SELECT session FROM log_entries WHERE id = 2`).Scan(&session))
+	assert.False(t, session.Valid)
+}
+
+func TestExportDuckDBColumns(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs.duckdb")
+	e := NewExporter(WithColumns("id", "foo"))
+	require.NoError(t, e.ExportDuckDB(context.Background(), path, pkg.NewSliceIterator(testEntries())))
+
+	db, err := sql.Open("duckdb", path)
+	require.NoError(t, err)
+	defer func(db *sql.DB) {
+		_ = db.Close()
+	}(db)
+	var foo string
+	require.NoError(t, db.QueryRow(`SELECT foo FROM log_entries`).Scan(&foo))
+	assert.Equal(t, "bar", foo)
+}
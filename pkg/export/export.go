@@ -0,0 +1,427 @@
+// Package export dumps plunger log entries into cleartext formats, and into
+// CSV and Parquet files for analysis with tools such as pandas or DuckDB.
+//
+// Blob and JSON meta values can optionally be extracted into separate files,
+// which makes the exported entries easier to grep and to archive.
+package export
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatJSONL Format = "jsonl"
+	FormatCSV   Format = "csv"
+	FormatText  Format = "text"
+	// FormatParquet writes a Parquet file, see writeParquet.
+	FormatParquet Format = "parquet"
+	// FormatDuckDB creates a DuckDB database, see ExportDuckDB.
+	FormatDuckDB Format = "duckdb"
+)
+
+// MissingDuckDBError is returned by ExportDuckDB if plunger isn't built with
+// the duckdb build tag, which links the DuckDB library.
+type MissingDuckDBError struct{}
+
+func (e *MissingDuckDBError) Error() string {
+	return "duckdb exports require plunger to be built with DuckDB (use -tags duckdb)"
+}
+
+// StandardColumns are the columns of the entries themselves. Any other column
+// of a CSV or Parquet export is a meta key.
+var StandardColumns = []string{"id", "date", "level", "session", "message"}
+
+// The optional columns are stored in log_entries, but only set for some
+// entries. Columns only includes them if some entries have a value.
+const (
+	// CallerColumn is the file:line the entry was logged from.
+	CallerColumn = "caller"
+	// ErrorColumn is the error message of the entry.
+	ErrorColumn = "error"
+	// TraceIDColumn and SpanIDColumn correlate the entry with a trace.
+	TraceIDColumn = "trace_id"
+	SpanIDColumn  = "span_id"
+)
+
+// OptionalColumns follow StandardColumns in the columns of an export. They
+// are strings, entries stored before the columns existed have them as meta.
+var OptionalColumns = []string{CallerColumn, ErrorColumn, TraceIDColumn, SpanIDColumn}
+
+type Exporter struct {
+	format Format
+	// extractDir is the directory extracted values are written to.
+	extractDir   string
+	extractBlobs bool
+	extractJSON  bool
+	// columns are the columns of CSV and Parquet exports.
+	columns []string
+}
+
+type Option func(*Exporter)
+
+func WithFormat(format Format) Option {
+	return func(e *Exporter) {
+		e.format = format
+	}
+}
+
+// WithExtractDir sets the directory blob and JSON values are extracted to.
+func WithExtractDir(dir string) Option {
+	return func(e *Exporter) {
+		e.extractDir = dir
+	}
+}
+
+// WithExtractBlobs writes blob values to separate files, named after the entry id and key.
+func WithExtractBlobs(extract bool) Option {
+	return func(e *Exporter) {
+		e.extractBlobs = extract
+	}
+}
+
+// WithExtractJSON writes JSON values to separate files, named after the entry id and key.
+func WithExtractJSON(extract bool) Option {
+	return func(e *Exporter) {
+		e.extractJSON = extract
+	}
+}
+
+// WithColumns sets the columns of CSV, Parquet and DuckDB exports, among
+// StandardColumns and meta keys. By default, the standard columns are
+// followed by every meta key of the exported entries, which requires reading
+// all of them before writing the CSV header.
+func WithColumns(columns ...string) Option {
+	return func(e *Exporter) {
+		e.columns = columns
+	}
+}
+
+func NewExporter(opts ...Option) *Exporter {
+	e := &Exporter{
+		format:     FormatJSONL,
+		extractDir: ".",
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e
+}
+
+// Export writes entries to w. Extracted values are replaced by the path of
+// the file they were written to.
+func (e *Exporter) Export(w io.Writer, entries []*pkg.LogEntry) error {
+	return e.ExportIterator(w, pkg.NewSliceIterator(entries))
+}
+
+// ExportIterator writes the entries returned by it to w, one at a time.
+func (e *Exporter) ExportIterator(w io.Writer, it pkg.EntryIterator) error {
+	if e.extractBlobs || e.extractJSON {
+		if err := os.MkdirAll(e.extractDir, 0755); err != nil {
+			return err
+		}
+	}
+
+	columns := e.columns
+	// entries are read beforehand when they are needed to decide on the
+	// columns, and for Parquet, whose columns are typed after their values
+	var entries []*pkg.LogEntry
+	buffered := e.format == FormatParquet || (e.format == FormatCSV && len(columns) == 0)
+	if buffered {
+		var err error
+		entries, err = e.collect(it)
+		if err != nil {
+			return err
+		}
+		if len(columns) == 0 {
+			columns = Columns(entries)
+		}
+	}
+
+	var writeEntry func(entry *pkg.LogEntry) error
+	var flush func() error
+
+	switch e.format {
+	case FormatJSONL:
+		encoder := json.NewEncoder(w)
+		writeEntry = func(entry *pkg.LogEntry) error {
+			return encoder.Encode(entry)
+		}
+
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return err
+		}
+		record := make([]string, len(columns))
+		writeEntry = func(entry *pkg.LogEntry) error {
+			for i, column := range columns {
+				record[i] = ""
+				switch v := ColumnValue(entry, column).(type) {
+				case nil:
+				case time.Time:
+					record[i] = v.Format(time.RFC3339Nano)
+				default:
+					record[i] = FormatValue(v)
+				}
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+
+	case FormatParquet:
+		return writeParquet(w, columns, entries)
+
+	case FormatDuckDB:
+		return errors.New("duckdb exports are written to a database file, use ExportDuckDB")
+
+	case FormatText:
+		writeEntry = func(entry *pkg.LogEntry) error {
+			_, err := fmt.Fprintln(w, FormatEntryLine(entry))
+			return err
+		}
+
+	default:
+		return errors.Errorf("unknown export format %q", e.format)
+	}
+
+	if buffered {
+		for _, entry := range entries {
+			if err := writeEntry(entry); err != nil {
+				return err
+			}
+		}
+	} else {
+		for it.Next() {
+			entry, err := e.extract(it.Entry())
+			if err != nil {
+				return err
+			}
+			if err := writeEntry(entry); err != nil {
+				return err
+			}
+		}
+		if err := it.Err(); err != nil {
+			return err
+		}
+	}
+
+	if flush != nil {
+		return flush()
+	}
+	return nil
+}
+
+// collect reads all the entries of it, with their values extracted.
+func (e *Exporter) collect(it pkg.EntryIterator) ([]*pkg.LogEntry, error) {
+	ret := []*pkg.LogEntry{}
+	for it.Next() {
+		entry, err := e.extract(it.Entry())
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, entry)
+	}
+	return ret, it.Err()
+}
+
+// Columns returns StandardColumns followed by the OptionalColumns that are
+// needed and the sorted meta keys of entries.
+func Columns(entries []*pkg.LogEntry) []string {
+	keySet := map[string]bool{}
+	optional := map[string]bool{}
+	for _, entry := range entries {
+		for k := range entry.Meta {
+			keySet[k] = true
+		}
+		for _, column := range OptionalColumns {
+			optional[column] = optional[column] || ColumnValue(entry, column) != nil
+		}
+	}
+	for _, column := range append(append([]string{}, StandardColumns...), OptionalColumns...) {
+		delete(keySet, column)
+	}
+	keys := []string{}
+	for k := range keySet {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := append([]string{}, StandardColumns...)
+	for _, column := range OptionalColumns {
+		if optional[column] {
+			ret = append(ret, column)
+		}
+	}
+	return append(ret, keys...)
+}
+
+// ColumnValue returns the value of column for entry, nil if entry has none.
+func ColumnValue(entry *pkg.LogEntry, column string) interface{} {
+	switch column {
+	case "id":
+		return entry.ID
+	case "date":
+		return entry.Date
+	case "level":
+		return entry.Level
+	case "session":
+		if entry.Session == nil {
+			return nil
+		}
+		return *entry.Session
+	case "message":
+		if entry.Message == nil {
+			return nil
+		}
+		return *entry.Message
+	case CallerColumn:
+		if entry.CallerFile != nil {
+			return entry.Caller()
+		}
+		return optionalMetaValue(entry, column)
+	case ErrorColumn:
+		if entry.Error != nil {
+			return *entry.Error
+		}
+		return optionalMetaValue(entry, column)
+	case TraceIDColumn:
+		if entry.TraceID != nil {
+			return *entry.TraceID
+		}
+		return optionalMetaValue(entry, column)
+	case SpanIDColumn:
+		if entry.SpanID != nil {
+			return *entry.SpanID
+		}
+		return optionalMetaValue(entry, column)
+	default:
+		return entry.Meta[column]
+	}
+}
+
+// optionalMetaValue returns the meta value of an optional column, for the
+// entries stored before the column existed.
+func optionalMetaValue(entry *pkg.LogEntry, column string) interface{} {
+	v, ok := entry.Meta[column]
+	if !ok {
+		return nil
+	}
+	return FormatValue(v)
+}
+
+// extract writes the blob and JSON values of entry to disk, and returns a
+// copy of entry where those values are replaced by their file path.
+func (e *Exporter) extract(entry *pkg.LogEntry) (*pkg.LogEntry, error) {
+	if !e.extractBlobs && !e.extractJSON {
+		return entry, nil
+	}
+
+	ret := *entry
+	ret.Meta = map[string]interface{}{}
+	for k, v := range entry.Meta {
+		ret.Meta[k] = v
+
+		var data []byte
+		var ext string
+		switch v_ := v.(type) {
+		case []byte:
+			if !e.extractBlobs {
+				continue
+			}
+			data, ext = v_, ".bin"
+		case map[string]interface{}, []interface{}:
+			if !e.extractJSON {
+				continue
+			}
+			b, err := json.MarshalIndent(v_, "", "  ")
+			if err != nil {
+				return nil, err
+			}
+			data, ext = b, ".json"
+		default:
+			continue
+		}
+
+		path := filepath.Join(e.extractDir, ExtractedFileName(entry.ID, k, ext))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			return nil, err
+		}
+		ret.Meta[k] = path
+	}
+
+	return &ret, nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+// ExtractedFileName returns the name of the file the value of key in entry id gets extracted to.
+func ExtractedFileName(id int, key string, ext string) string {
+	return fmt.Sprintf("%d-%s%s", id, unsafeFileNameChars.ReplaceAllString(key, "_"), ext)
+}
+
+// FormatEntryLine renders entry on a single line, with its meta values as sorted key=value pairs.
+func FormatEntryLine(entry *pkg.LogEntry) string {
+	parts := []string{
+		entry.Date.Format(time.RFC3339),
+		strings.ToUpper(entry.Level),
+	}
+	if entry.Session != nil {
+		parts = append(parts, fmt.Sprintf("[%s]", *entry.Session))
+	}
+	if entry.Message != nil {
+		parts = append(parts, *entry.Message)
+	}
+
+	keys := []string{}
+	for k := range entry.Meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		parts = append(parts, fmt.Sprintf("%s=%s", k, FormatValue(entry.Meta[k])))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// FormatValue renders a meta value as text, using JSON for anything that isn't a string.
+func FormatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprintf("%v", v)
+		}
+		return string(b)
+	}
+}
+
+func stringOrEmpty(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,163 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xitongsys/parquet-go-source/buffer"
+	"github.com/xitongsys/parquet-go/reader"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testEntries() []*pkg.LogEntry {
+	session := "s1"
+	message := "hello"
+	return []*pkg.LogEntry{
+		{
+			ID:      1,
+			Date:    time.Date(2023, 8, 19, 10, 0, 0, 0, time.UTC),
+			Level:   "info",
+			Session: &session,
+			Message: &message,
+			Meta: map[string]interface{}{
+				"foo":  "bar",
+				"obj":  map[string]interface{}{"a": float64(1)},
+				"data": []byte("raw"),
+			},
+		},
+	}
+}
+
+func TestExportJSONLWithExtraction(t *testing.T) {
+	dir := t.TempDir()
+	buf := &bytes.Buffer{}
+	e := NewExporter(WithExtractDir(dir), WithExtractBlobs(true), WithExtractJSON(true))
+	err := e.Export(buf, testEntries())
+	require.NoError(t, err)
+
+	var entry map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &entry)
+	require.NoError(t, err)
+	meta := entry["meta"].(map[string]interface{})
+	assert.Equal(t, "bar", meta["foo"])
+	assert.Equal(t, filepath.Join(dir, "1-obj.json"), meta["obj"])
+	assert.Equal(t, filepath.Join(dir, "1-data.bin"), meta["data"])
+
+	b, err := os.ReadFile(filepath.Join(dir, "1-data.bin"))
+	require.NoError(t, err)
+	assert.Equal(t, "raw", string(b))
+
+	b, err = os.ReadFile(filepath.Join(dir, "1-obj.json"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"a": 1}`, string(b))
+}
+
+func TestExportCSVAndText(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := NewExporter(WithFormat(FormatCSV)).Export(buf, testEntries())
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+	assert.Equal(t, "id,date,level,session,message,data,foo,obj", lines[0])
+	assert.Equal(t, `1,2023-08-19T10:00:00Z,info,s1,hello,raw,bar,"{""a"":1}"`, lines[1])
+
+	buf.Reset()
+	err = NewExporter(WithFormat(FormatCSV), WithColumns("date", "foo", "missing")).Export(buf, testEntries())
+	require.NoError(t, err)
+	assert.Equal(t, "date,foo,missing\n2023-08-19T10:00:00Z,bar,\n", buf.String())
+
+	buf.Reset()
+	err = NewExporter(WithFormat(FormatText)).Export(buf, testEntries())
+	require.NoError(t, err)
+	assert.Equal(t, "2023-08-19T10:00:00Z INFO [s1] hello data=raw foo=bar obj={\"a\":1}\n", buf.String())
+}
+
+func TestExportParquet(t *testing.T) {
+	entries := testEntries()
+	message := "second"
+	entries = append(entries, &pkg.LogEntry{
+		ID:      2,
+		Date:    time.Date(2023, 8, 19, 10, 0, 1, 0, time.UTC),
+		Level:   "warn",
+		Message: &message,
+		Meta: map[string]interface{}{
+			"foo":   float64(12),
+			"count": float64(3),
+			"ratio": float64(0.5),
+			"ok":    true,
+		},
+	})
+	entries[0].Meta["count"] = float64(1)
+	entries[0].Meta["ratio"] = float64(2)
+
+	buf := &bytes.Buffer{}
+	err := NewExporter(WithFormat(FormatParquet)).Export(buf, entries)
+	require.NoError(t, err)
+
+	type row struct {
+		ID      int64    `parquet:"name=id, type=INT64"`
+		Date    int64    `parquet:"name=date, type=INT64, convertedtype=TIMESTAMP_MICROS"`
+		Level   string   `parquet:"name=level, type=BYTE_ARRAY, convertedtype=UTF8"`
+		Session *string  `parquet:"name=session, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+		Message *string  `parquet:"name=message, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+		Count   *int64   `parquet:"name=count, type=INT64, repetitiontype=OPTIONAL"`
+		Foo     *string  `parquet:"name=foo, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+		Obj     *string  `parquet:"name=obj, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+		Ok      *bool    `parquet:"name=ok, type=BOOLEAN, repetitiontype=OPTIONAL"`
+		Ratio   *float64 `parquet:"name=ratio, type=DOUBLE, repetitiontype=OPTIONAL"`
+	}
+	pf, err := buffer.NewBufferFile(buf.Bytes())
+	require.NoError(t, err)
+	pr, err := reader.NewParquetReader(pf, new(row), 1)
+	require.NoError(t, err)
+	rows := make([]row, pr.GetNumRows())
+	require.NoError(t, pr.Read(&rows))
+	pr.ReadStop()
+	require.Len(t, rows, 2)
+
+	assert.Equal(t, int64(1), rows[0].ID)
+	assert.Equal(t, entries[0].Date.UnixMicro(), rows[0].Date)
+	assert.Equal(t, "s1", *rows[0].Session)
+	assert.Equal(t, int64(1), *rows[0].Count)
+	assert.Equal(t, float64(2), *rows[0].Ratio)
+	assert.Nil(t, rows[0].Ok)
+	// mixed values are stored as strings
+	assert.Equal(t, "bar", *rows[0].Foo)
+	assert.Equal(t, `{"a":1}`, *rows[0].Obj)
+
+	assert.Equal(t, "warn", rows[1].Level)
+	assert.Nil(t, rows[1].Session)
+	assert.Equal(t, "second", *rows[1].Message)
+	assert.Equal(t, 0.5, *rows[1].Ratio)
+	assert.True(t, *rows[1].Ok)
+	assert.Equal(t, "12", *rows[1].Foo)
+	assert.Nil(t, rows[1].Obj)
+}
+
+func TestConsoleFormatter(t *testing.T) {
+	entry := testEntries()[0]
+	entry.Meta["error"] = "connection refused"
+
+	f := NewConsoleFormatter(WithConsoleNoColor(true))
+	assert.Equal(t,
+		`2023-08-19T10:00:00Z INF hello error="connection refused" data=raw foo=bar obj={"a":1} session=s1`,
+		f.Format(entry))
+
+	entry.Level = "WARNING"
+	entry.Meta = nil
+	entry.Message = nil
+	assert.Equal(t, "10:00AM WRN session=s1", NewConsoleFormatter(WithConsoleNoColor(true), WithConsoleTimeFormat(time.Kitchen)).Format(entry))
+	entry.Level = "notice"
+	assert.Equal(t, "10:00AM NOT session=s1", NewConsoleFormatter(WithConsoleNoColor(true), WithConsoleTimeFormat(time.Kitchen)).Format(entry))
+
+	entry.Level = "error"
+	buf := &bytes.Buffer{}
+	require.NoError(t, NewConsoleFormatter().Write(buf, entry))
+	assert.Equal(t, "\x1b[90m2023-08-19T10:00:00Z\x1b[0m \x1b[1m\x1b[31mERR\x1b[0m\x1b[0m \x1b[36msession=\x1b[0ms1\n", buf.String())
+}
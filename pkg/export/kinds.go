@@ -0,0 +1,98 @@
+package export
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/plunger/pkg"
+	"math"
+	"time"
+)
+
+// columnKind is the type of a meta column in typed exports such as Parquet,
+// inferred from its values.
+type columnKind int
+
+const (
+	kindNone columnKind = iota
+	kindBool
+	kindInt
+	kindDouble
+	kindString
+)
+
+// inferColumnKind returns the kind of all the values of column in entries:
+// integers and doubles make doubles, other mixes make strings.
+func inferColumnKind(entries []*pkg.LogEntry, column string) columnKind {
+	ret := kindNone
+	for _, entry := range entries {
+		v, ok := entry.Meta[column]
+		if !ok || v == nil {
+			continue
+		}
+		kind := kindString
+		switch v := v.(type) {
+		case bool:
+			kind = kindBool
+		case int, int64:
+			kind = kindInt
+		case float64:
+			kind = kindDouble
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				kind = kindInt
+			}
+		case json.Number:
+			kind = kindDouble
+			if _, err := v.Int64(); err == nil {
+				kind = kindInt
+			}
+		}
+
+		switch {
+		case ret == kindNone || ret == kind:
+			ret = kind
+		case (ret == kindInt && kind == kindDouble) || (ret == kindDouble && kind == kindInt):
+			ret = kindDouble
+		default:
+			return kindString
+		}
+	}
+	return ret
+}
+
+// typedValue converts v to kind, returning nil if v is nil.
+func typedValue(v interface{}, kind columnKind) interface{} {
+	if v == nil {
+		return nil
+	}
+	switch kind {
+	case kindBool:
+		return v.(bool)
+	case kindInt:
+		switch v := v.(type) {
+		case int:
+			return int64(v)
+		case int64:
+			return v
+		case float64:
+			return int64(v)
+		case json.Number:
+			n, _ := v.Int64()
+			return n
+		}
+	case kindDouble:
+		switch v := v.(type) {
+		case int:
+			return float64(v)
+		case int64:
+			return float64(v)
+		case float64:
+			return v
+		case json.Number:
+			f, _ := v.Float64()
+			return f
+		}
+	}
+	if t, ok := v.(time.Time); ok {
+		return t.Format(time.RFC3339Nano)
+	}
+	return FormatValue(v)
+}
@@ -0,0 +1,77 @@
+package export
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"github.com/xitongsys/parquet-go/writer"
+	"io"
+	"strings"
+)
+
+// parquetNameReplacer removes the characters separating the column
+// definitions of parquet-go.
+var parquetNameReplacer = strings.NewReplacer(",", "_", "=", "_")
+
+// writeParquet writes entries as a Parquet file with one column per column.
+//
+// The standard columns are typed (id is an int64, date a timestamp). Meta
+// columns are booleans, int64 or doubles if all their values are, and strings
+// otherwise, with JSON for non-string values.
+func writeParquet(w io.Writer, columns []string, entries []*pkg.LogEntry) error {
+	kinds := map[string]columnKind{}
+	md := []string{}
+	for _, column := range columns {
+		name := "name=" + parquetNameReplacer.Replace(column)
+		switch column {
+		case "id":
+			md = append(md, name+", type=INT64")
+		case "date":
+			md = append(md, name+", type=INT64, convertedtype=TIMESTAMP_MICROS")
+		case "level":
+			md = append(md, name+", type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY")
+		case "session":
+			md = append(md, name+", type=BYTE_ARRAY, convertedtype=UTF8, encoding=PLAIN_DICTIONARY, repetitiontype=OPTIONAL")
+		case "message", CallerColumn, ErrorColumn, TraceIDColumn, SpanIDColumn:
+			md = append(md, name+", type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL")
+		default:
+			kind := inferColumnKind(entries, column)
+			kinds[column] = kind
+			switch kind {
+			case kindBool:
+				md = append(md, name+", type=BOOLEAN, repetitiontype=OPTIONAL")
+			case kindInt:
+				md = append(md, name+", type=INT64, repetitiontype=OPTIONAL")
+			case kindDouble:
+				md = append(md, name+", type=DOUBLE, repetitiontype=OPTIONAL")
+			default:
+				md = append(md, name+", type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL")
+			}
+		}
+	}
+
+	pw, err := writer.NewCSVWriterFromWriter(md, w, 1)
+	if err != nil {
+		return errors.Wrap(err, "could not create parquet writer")
+	}
+	for _, entry := range entries {
+		// rows are buffered until the row group is written
+		row := make([]interface{}, len(columns))
+		for i, column := range columns {
+			switch column {
+			case "id":
+				row[i] = int64(entry.ID)
+			case "date":
+				row[i] = entry.Date.UnixMicro()
+			case "level", "session", "message", CallerColumn, ErrorColumn, TraceIDColumn, SpanIDColumn:
+				row[i] = ColumnValue(entry, column)
+			default:
+				row[i] = typedValue(entry.Meta[column], kinds[column])
+			}
+		}
+		if err := pw.Write(row); err != nil {
+			return err
+		}
+	}
+
+	return pw.WriteStop()
+}
@@ -0,0 +1,158 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// DefaultFailoverRetryInterval is how long FailoverWriter waits before trying
+// the database again after it failed.
+const DefaultFailoverRetryInterval = 10 * time.Second
+
+// InvalidEntryError is returned by Write for payloads the LineParser can't
+// decode, as opposed to entries that couldn't be stored.
+type InvalidEntryError struct {
+	Err error
+}
+
+func (e *InvalidEntryError) Error() string {
+	return "invalid log entry: " + e.Err.Error()
+}
+
+func (e *InvalidEntryError) Unwrap() error {
+	return e.Err
+}
+
+// FailoverWriter is an io.Writer for zerolog that writes to a LogWriter, and
+// falls back to another writer (stderr, a file) while the database can't be
+// opened or written to, for example because another process holds its lock.
+//
+// After a failure, the payloads go to the fallback writer for the retry
+// interval, after which the database is opened or written to again.
+type FailoverWriter struct {
+	open          func() (*LogWriter, error)
+	fallback      io.Writer
+	retryInterval time.Duration
+	now           func() time.Time
+
+	mu sync.Mutex
+	lw *LogWriter
+	// retryAt is set while the database is unavailable.
+	retryAt time.Time
+	lastErr error
+	closed  bool
+}
+
+type FailoverOption func(*FailoverWriter)
+
+// WithFailoverRetryInterval sets how long the database is skipped after a failure.
+func WithFailoverRetryInterval(interval time.Duration) FailoverOption {
+	return func(w *FailoverWriter) {
+		w.retryInterval = interval
+	}
+}
+
+// NewFailoverWriter tries to open the database with open, and keeps retrying
+// on later writes if it fails.
+func NewFailoverWriter(open func() (*LogWriter, error), fallback io.Writer, opts ...FailoverOption) *FailoverWriter {
+	w := &FailoverWriter{
+		open:          open,
+		fallback:      fallback,
+		retryInterval: DefaultFailoverRetryInterval,
+		now:           time.Now,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.reopen()
+	return w
+}
+
+// LogWriter returns the LogWriter of the database, nil if it couldn't be opened yet.
+func (w *FailoverWriter) LogWriter() *LogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lw
+}
+
+// Err returns the error that made the writer fall back, nil while the
+// database is available.
+func (w *FailoverWriter) Err() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lastErr
+}
+
+func (w *FailoverWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, errors.New("failover writer is closed")
+	}
+	if !w.retryAt.IsZero() && w.now().Before(w.retryAt) {
+		return w.writeFallback(p)
+	}
+	if w.lw == nil && !w.reopen() {
+		return w.writeFallback(p)
+	}
+
+	n, err := w.lw.Write(p)
+	if err == nil {
+		w.retryAt = time.Time{}
+		w.lastErr = nil
+		return n, nil
+	}
+	// an invalid entry doesn't mean the database is unavailable
+	var invalidErr *InvalidEntryError
+	if !errors.As(err, &invalidErr) {
+		w.fail(err)
+	}
+	return w.writeFallback(p)
+}
+
+// reopen opens the database, and returns false if it is still unavailable.
+func (w *FailoverWriter) reopen() bool {
+	lw, err := w.open()
+	if err != nil {
+		w.fail(err)
+		return false
+	}
+	w.lw = lw
+	w.retryAt = time.Time{}
+	w.lastErr = nil
+	return true
+}
+
+func (w *FailoverWriter) fail(err error) {
+	w.lastErr = err
+	w.retryAt = w.now().Add(w.retryInterval)
+}
+
+func (w *FailoverWriter) writeFallback(p []byte) (int, error) {
+	line := p
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		line = append(append([]byte{}, p...), '\n')
+	}
+	if _, err := w.fallback.Write(line); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+func (w *FailoverWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.closed = true
+	if w.lw == nil {
+		return nil
+	}
+	err := w.lw.Close()
+	w.lw = nil
+	return err
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFailoverWriter(t *testing.T) {
+	reject := false
+	rejectMiddleware := func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			if reject {
+				return errors.New("database is locked")
+			}
+			return next(entry)
+		}
+	}
+	lw := newImportLogWriter(t, WithMiddleware(rejectMiddleware))
+
+	opened := 0
+	open := func() (*LogWriter, error) {
+		opened++
+		if opened == 1 {
+			return nil, errors.New("unable to open database file")
+		}
+		return lw, nil
+	}
+	fallback := &bytes.Buffer{}
+	w := NewFailoverWriter(open, fallback, WithFailoverRetryInterval(time.Minute))
+	// the first attempt to open the database happened in NewFailoverWriter
+	now := w.retryAt.Add(-time.Minute)
+	w.now = func() time.Time { return now }
+	assert.Nil(t, w.LogWriter())
+	assert.EqualError(t, w.Err(), "unable to open database file")
+
+	// the database isn't retried before the interval
+	_, err := w.Write([]byte(`{"level": "info", "message": "first"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 1, opened)
+
+	now = now.Add(time.Minute)
+	_, err = w.Write([]byte(`{"level": "info", "message": "second"}`))
+	require.NoError(t, err)
+	assert.Equal(t, 2, opened)
+	assert.NoError(t, w.Err())
+
+	reject = true
+	_, err = w.Write([]byte(`{"level": "info", "message": "third"}`))
+	require.NoError(t, err)
+	reject = false
+	_, err = w.Write([]byte(`{"level": "info", "message": "fourth"}`))
+	require.NoError(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = w.Write([]byte(`{"level": "info", "message": "fifth"}`))
+	require.NoError(t, err)
+	// invalid entries go to the fallback without disabling the database
+	_, err = w.Write([]byte(`not json`))
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`{"level": "info", "message": "sixth"}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, `{"level": "info", "message": "first"}`+"\n"+
+		`{"level": "info", "message": "third"}`+"\n"+
+		`{"level": "info", "message": "fourth"}`+"\n"+
+		"not json\n", fallback.String())
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	messages := []string{}
+	for _, entry := range entries {
+		messages = append(messages, *entry.Message)
+	}
+	assert.Equal(t, []string{"second", "fifth", "sixth"}, messages)
+
+	require.NoError(t, w.Close())
+	_, err = w.Write([]byte(`{"level": "info", "message": "closed"}`))
+	assert.Error(t, err)
+}
@@ -0,0 +1,187 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// The fingerprint of a message is the message with its variable parts
+// replaced by placeholders, so that the entries logged by the same line of
+// code share a fingerprint:
+//
+//	user 42 not found in 3.5ms -> user <num> not found in <num>ms
+//	request 0f8fad5b-d9cb-469f-a165-70867728950e failed -> request <uuid> failed
+//	commit 9fceb02d0ae598e95dc970b74767f19372d61af8 -> commit <hex>
+//
+// It is stored in the fingerprint column of log_entries when entries are
+// written, see Patterns.
+
+// Placeholders of the variable parts of fingerprints.
+const (
+	FingerprintUUID   = "<uuid>"
+	FingerprintHex    = "<hex>"
+	FingerprintNumber = "<num>"
+)
+
+// DefaultPatterns is the number of patterns returned by Patterns.
+const DefaultPatterns = 20
+
+var (
+	fingerprintUUIDRegexp   = regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`)
+	fingerprintHexRegexp    = regexp.MustCompile(`(?i)\b(?:0x[0-9a-f]+|[0-9a-f]{8,})\b`)
+	fingerprintNumberRegexp = regexp.MustCompile(`\b\d+(?:\.\d+)?`)
+)
+
+// Fingerprint returns the fingerprint of message. Hex strings are words of
+// at least 8 hex digits, or prefixed with 0x, and numbers are the digits
+// starting a word, so that identifiers such as s3 or v2 are kept.
+func Fingerprint(message string) string {
+	ret := fingerprintUUIDRegexp.ReplaceAllString(message, FingerprintUUID)
+	ret = fingerprintHexRegexp.ReplaceAllStringFunc(ret, func(s string) string {
+		// words made of letters, and long numbers
+		if !strings.HasPrefix(strings.ToLower(s), "0x") &&
+			(!strings.ContainsAny(s, "0123456789") || strings.Trim(s, "0123456789") == "") {
+			return s
+		}
+		return FingerprintHex
+	})
+	return fingerprintNumberRegexp.ReplaceAllString(ret, FingerprintNumber)
+}
+
+// fingerprintColumn returns the value of the fingerprint column of message.
+func fingerprintColumn(message sql.NullString) sql.NullString {
+	if !message.Valid {
+		return message
+	}
+	return sql.NullString{String: Fingerprint(message.String), Valid: true}
+}
+
+// addFingerprintColumn adds the fingerprint column, and fingerprints the
+// entries written before it existed.
+func (l *LogWriter) addFingerprintColumn(ctx context.Context) error {
+	if err := l.ensureColumn(ctx, "log_entries", "fingerprint", "TEXT"); err != nil {
+		return err
+	}
+	_, err := l.db.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS log_entries_fingerprint_idx ON log_entries (fingerprint)")
+	if err != nil {
+		return err
+	}
+
+	sb := sqlbuilder.Select("id", "message").From("log_entries")
+	sb.Where(sb.IsNotNull("message"), sb.IsNull("fingerprint"))
+	fingerprints := map[int]string{}
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		var id int
+		var message string
+		if err := rows.Scan(&id, &message); err != nil {
+			return err
+		}
+		fingerprints[id] = Fingerprint(message)
+		return nil
+	})
+	if err != nil || len(fingerprints) == 0 {
+		return err
+	}
+
+	tx, err := l.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	for id, fingerprint := range fingerprints {
+		ub := sqlbuilder.Update("log_entries")
+		ub.Set(ub.Assign("fingerprint", fingerprint)).Where(ub.E("id", id))
+		q, args := ub.Build()
+		if _, err := tx.ExecContext(ctx, tx.Rebind(q), args...); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Pattern is a message fingerprint along with the entries logging it, see
+// Patterns.
+type Pattern struct {
+	Fingerprint string `json:"fingerprint"`
+	Count       int    `json:"count"`
+	// Example is one of the messages of the pattern.
+	Example string    `json:"example"`
+	First   time.Time `json:"first"`
+	Last    time.Time `json:"last"`
+}
+
+type patternOptions struct {
+	limit int
+}
+
+type PatternOption func(*patternOptions)
+
+// WithPatternLimit sets the number of patterns returned, DefaultPatterns by
+// default. 0 returns all patterns.
+func WithPatternLimit(n int) PatternOption {
+	return func(o *patternOptions) {
+		o.limit = n
+	}
+}
+
+// Patterns returns the fingerprints of the messages of the entries matching
+// filter, the most frequent first, to find the noisiest log lines.
+func (l *LogWriter) Patterns(ctx context.Context, filter *GetEntriesFilter, opts ...PatternOption) ([]*Pattern, error) {
+	o := &patternOptions{
+		limit: DefaultPatterns,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ids, err := l.filteredIDs(filter)
+	if err != nil {
+		return nil, err
+	}
+	sb := sqlbuilder.Select("fingerprint", "COUNT(*) AS n", "MIN(message)", "MIN(date)", "MAX(date)").
+		From("log_entries").GroupBy("fingerprint").OrderBy("n DESC", "fingerprint")
+	sb.Where(sb.In("id", ids), sb.IsNotNull("fingerprint"))
+	if o.limit > 0 {
+		sb.Limit(o.limit)
+	}
+
+	ret := []*Pattern{}
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		p := &Pattern{}
+		var first, last interface{}
+		if err := rows.Scan(&p.Fingerprint, &p.Count, &p.Example, &first, &last); err != nil {
+			return err
+		}
+		t, err := scanTime(first)
+		if err != nil {
+			return err
+		}
+		p.First = t
+		t, err = scanTime(last)
+		if err != nil {
+			return err
+		}
+		p.Last = t
+		ret = append(ret, p)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range ret {
+		if err := l.decryptString(&p.Fingerprint); err != nil {
+			return nil, err
+		}
+		if err := l.decryptString(&p.Example); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
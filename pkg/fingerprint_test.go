@@ -0,0 +1,81 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFingerprint(t *testing.T) {
+	for message, expected := range map[string]string{
+		"user 42 not found in 3.5ms":                             "user <num> not found in <num>ms",
+		"request 0f8fad5b-d9cb-469f-a165-70867728950E failed":    "request <uuid> failed",
+		"commit 9fceb02d0ae598e95dc970b74767f19372d61af8 pushed": "commit <hex> pushed",
+		"segfault at 0x7ffd3c2a":                                 "segfault at <hex>",
+		"uploaded to s3 with api v2":                             "uploaded to s3 with api v2",
+		"order 1234567890 of customer=77, accepted":              "order <num> of customer=<num>, accepted",
+		"decoded deadbeef and facade":                            "decoded deadbeef and facade",
+		"listening on 127.0.0.1:8080":                            "listening on <num>.<num>:<num>",
+		"no variable parts":                                      "no variable parts",
+	} {
+		assert.Equal(t, expected, Fingerprint(message), message)
+	}
+}
+
+func TestPatterns(t *testing.T) {
+	lw := newImportLogWriter(t)
+	for _, line := range []string{
+		`{"level": "info", "message": "user 1 logged in", "time": "2023-05-01T10:00:00Z"}`,
+		`{"level": "info", "message": "user 2 logged in", "time": "2023-05-01T11:00:00Z"}`,
+		`{"level": "info", "message": "user 3 logged in", "time": "2023-05-01T12:00:00Z"}`,
+		`{"level": "error", "message": "job 0x1f failed", "time": "2023-05-01T10:30:00Z"}`,
+		`{"level": "error", "message": "job 0x2a failed", "time": "2023-05-01T10:45:00Z"}`,
+		`{"level": "info", "message": "started", "time": "2023-05-01T09:00:00Z"}`,
+		`{"level": "info"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.NotNil(t, entries[0].Fingerprint)
+	assert.Equal(t, "user <num> logged in", *entries[0].Fingerprint)
+	assert.Nil(t, entries[6].Fingerprint)
+
+	patterns, err := lw.Patterns(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, patterns, 3)
+	assert.Equal(t, "user <num> logged in", patterns[0].Fingerprint)
+	assert.Equal(t, 3, patterns[0].Count)
+	assert.Equal(t, "user 1 logged in", patterns[0].Example)
+	assert.Equal(t, "2023-05-01T10:00:00Z", patterns[0].First.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, "2023-05-01T12:00:00Z", patterns[0].Last.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, "job <hex> failed", patterns[1].Fingerprint)
+	assert.Equal(t, 2, patterns[1].Count)
+	assert.Equal(t, "started", patterns[2].Fingerprint)
+
+	patterns, err = lw.Patterns(context.Background(), NewGetEntriesFilter(WithLevel("error")), WithPatternLimit(1))
+	require.NoError(t, err)
+	require.Len(t, patterns, 1)
+	assert.Equal(t, "job <hex> failed", patterns[0].Fingerprint)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithQueryString(`fingerprint="user <num> logged in"`)))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+}
+
+func TestAddFingerprintColumnBackfills(t *testing.T) {
+	lw := newImportLogWriter(t)
+	_, err := lw.Write([]byte(`{"level": "info", "message": "retry 3 of 5"}`))
+	require.NoError(t, err)
+	_, err = lw.db.Exec("UPDATE log_entries SET fingerprint = NULL")
+	require.NoError(t, err)
+
+	require.NoError(t, lw.addFingerprintColumn(context.Background()))
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.NotNil(t, entries[0].Fingerprint)
+	assert.Equal(t, "retry <num> of <num>", *entries[0].Fingerprint)
+}
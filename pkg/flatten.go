@@ -0,0 +1,71 @@
+package pkg
+
+import "sort"
+
+// Nested objects, such as the ones written by zerolog's Dict, are stored as
+// a single JSON value by default. With WithObjectFlattening, their fields
+// are stored as meta keys of their own, named by joining the keys of the
+// path with FlattenSeparator:
+//
+//	{"http": {"status": 200, "method": "GET"}}
+//
+// is stored as http.status and http.method, which MetaFilters and the query
+// language can match like any other key.
+
+// FlattenSeparator joins the keys of flattened objects.
+const FlattenSeparator = "."
+
+// WithObjectFlattening stores the fields of nested objects as dotted meta
+// keys, down to maxDepth levels of nesting, 0 meaning no limit. Objects
+// nested deeper are stored as JSON under their dotted key. If keepOriginal
+// is true, the object is stored as well.
+//
+// Fields are flattened before the encoders run, so that encoders can be
+// registered for dotted keys. A flattened key doesn't replace a top-level
+// field with the same name.
+func WithObjectFlattening(maxDepth int, keepOriginal bool) LogWriterOption {
+	return func(l *LogWriter) {
+		l.flattenObjects = true
+		l.flattenDepth = maxDepth
+		l.keepFlattenedObjects = keepOriginal
+	}
+}
+
+// flattenMeta replaces the objects of meta by their flattened fields.
+func (l *LogWriter) flattenMeta(meta map[string]interface{}) {
+	if !l.flattenObjects {
+		return
+	}
+
+	// keys are visited in order, so that collisions between flattened keys
+	// are resolved the same way for every entry
+	keys := []string{}
+	for k, v := range meta {
+		// empty objects have no fields to store them as
+		if obj, ok := v.(map[string]interface{}); ok && len(obj) > 0 {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		obj := meta[k].(map[string]interface{})
+		if !l.keepFlattenedObjects {
+			delete(meta, k)
+		}
+		l.flattenObject(meta, k, obj, 1)
+	}
+}
+
+func (l *LogWriter) flattenObject(meta map[string]interface{}, prefix string, obj map[string]interface{}, depth int) {
+	for k, v := range obj {
+		key := prefix + FlattenSeparator + k
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 && (l.flattenDepth == 0 || depth < l.flattenDepth) {
+			l.flattenObject(meta, key, nested, depth+1)
+			continue
+		}
+		if _, ok := meta[key]; !ok {
+			meta[key] = v
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFlattenMeta(t *testing.T) {
+	lw := &LogWriter{flattenObjects: true, flattenDepth: 2}
+	meta := map[string]interface{}{
+		"http": map[string]interface{}{
+			"status": int64(200),
+			"request": map[string]interface{}{
+				"method":  "GET",
+				"headers": map[string]interface{}{"accept": "*/*"},
+			},
+		},
+		"http.status": int64(500),
+		"empty":       map[string]interface{}{},
+	}
+	lw.flattenMeta(meta)
+	assert.Equal(t, map[string]interface{}{
+		"http.status":          int64(500),
+		"http.request.method":  "GET",
+		"http.request.headers": map[string]interface{}{"accept": "*/*"},
+		"empty":                map[string]interface{}{},
+	}, meta)
+}
+
+func TestObjectFlattening(t *testing.T) {
+	lw := newImportLogWriter(t, WithObjectFlattening(0, true))
+
+	for _, line := range []string{
+		`{"level":"info","message":"ok","http":{"status":200,"method":"GET"}}`,
+		`{"level":"info","message":"not found","http":{"status":404,"method":"POST"}}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithQueryString(`http.status>=400`)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "POST", entries[0].Meta["http.method"])
+	// the original object is kept
+	assert.Equal(t, map[string]interface{}{"status": 404.0, "method": "POST"}, entries[0].Meta["http"])
+}
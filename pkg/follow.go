@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+	"time"
+)
+
+// LastEntryID returns the id of the most recently written entry, or 0 if the
+// database is empty.
+func (l *LogWriter) LastEntryID() (int, error) {
+	return l.LastEntryIDContext(context.Background())
+}
+
+func (l *LogWriter) LastEntryIDContext(ctx context.Context) (int, error) {
+	q := sqlbuilder.Select("COALESCE(MAX(id), 0)").From("log_entries")
+	var id int
+	if err := l.db.QueryRowxContext(ctx, q.String()).Scan(&id); err != nil {
+		return 0, err
+	}
+	return id, nil
+}
+
+// Follow streams the entries matching filter as they get written to the database.
+//
+// If filter.AfterID is set, entries are streamed starting after that id,
+// otherwise only entries written after Follow was called are returned.
+// The database is polled every followInterval (see WithFollowInterval), which
+// also works when the entries are written by another process.
+//
+// Entries are streamed in the order they are written: the OrderBy, Offset and
+// Last of filter are ignored, and a cursor only sets the entry to start after.
+//
+// The returned channel is closed once ctx is done.
+func (l *LogWriter) Follow(ctx context.Context, filter *GetEntriesFilter) (<-chan *LogEntry, error) {
+	f := NewGetEntriesFilter()
+	if filter != nil {
+		resolved, err := filter.resolveCursor()
+		if err != nil {
+			return nil, err
+		}
+		f_ := *resolved
+		f = &f_
+	}
+	// polls select the entries after the last one streamed, by id
+	f.OrderBy, f.Offset, f.Last = nil, 0, 0
+
+	if f.AfterID == 0 {
+		lastID, err := l.LastEntryIDContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		f.AfterID = lastID
+	}
+
+	ch := make(chan *LogEntry)
+
+	go func() {
+		defer close(ch)
+
+		ticker := time.NewTicker(l.followInterval)
+		defer ticker.Stop()
+
+		for {
+			// errors are most likely transient (database locked by the writer),
+			// so we just try again on the next tick.
+			entries, err := l.GetEntriesContext(ctx, f)
+			if err == nil {
+				for _, entry := range entries {
+					select {
+					case ch <- entry:
+					case <-ctx.Done():
+						return
+					}
+					f.AfterID = entry.ID
+				}
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return ch, nil
+}
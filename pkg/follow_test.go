@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLogWriterFollow(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema(), WithFollowInterval(10*time.Millisecond))
+	err := lw.Init()
+	require.NoError(t, err)
+
+	// entries written before Follow is called are skipped
+	_, err = lw.Write([]byte(`{"level": "info", "message": "before"}`))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ch, err := lw.Follow(ctx, NewGetEntriesFilter(WithLevel("error")))
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "info", "message": "skipped"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "error", "message": "first"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "error", "message": "second"}`))
+	require.NoError(t, err)
+
+	for _, expected := range []string{"first", "second"} {
+		select {
+		case entry := <-ch:
+			require.NotNil(t, entry.Message)
+			assert.Equal(t, expected, *entry.Message)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for entry")
+		}
+	}
+
+	cancel()
+	for range ch {
+	}
+}
+
+func TestLogWriterFollowIgnoresOrder(t *testing.T) {
+	lw := newImportLogWriter(t, WithFollowInterval(10*time.Millisecond))
+	for _, message := range []string{"first", "second", "third"} {
+		_, err := lw.Write([]byte(`{"level": "info", "message": "` + message + `"}`))
+		require.NoError(t, err)
+	}
+	page, err := lw.GetEntriesPage(NewGetEntriesFilter(WithLimit(1)))
+	require.NoError(t, err)
+	require.NotEmpty(t, page.NextCursor)
+
+	for name, filter := range map[string]*GetEntriesFilter{
+		"desc":   NewGetEntriesFilter(WithAfterID(1), WithOrderBy("id", Desc), WithOffset(1), WithLast(1)),
+		"cursor": NewGetEntriesFilter(WithCursor(page.NextCursor)),
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ch, err := lw.Follow(ctx, filter)
+			require.NoError(t, err)
+
+			received := []string{}
+			timeout := time.After(200 * time.Millisecond)
+			for done := false; !done; {
+				select {
+				case entry := <-ch:
+					received = append(received, *entry.Message)
+				case <-timeout:
+					done = true
+				}
+			}
+			// the entries after the first one are streamed once, in order
+			assert.Equal(t, []string{"second", "third"}, received)
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Applications without sessions, such as servers, can group their entries by
+// a key such as request_id instead. The value of the grouping key, set with
+// WithGroupKey, is stored in the indexed group_id column of log_entries
+// rather than as a meta value, so that the entries of a group are looked up
+// as cheaply as the entries of a session, see WithGroup.
+
+// WithGroupKey stores the value of key in the group_id column of the entries,
+// for example WithGroupKey("request_id"). WithMetaFilters on key match the
+// group_id column, whereas ranges and queries on key match no entries: queries
+// select groups with group=value instead.
+func WithGroupKey(key string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.groupKey = key
+	}
+}
+
+// WithGroup matches the entries of a group, see WithGroupKey.
+func WithGroup(group string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Group = group
+	}
+}
+
+// parseGroup returns the value of the grouping key of log, which isn't
+// stored as meta value then.
+func (l *LogWriter) parseGroup(log map[string]interface{}, skippedKeys map[string]bool) sql.NullString {
+	if l.groupKey == "" {
+		return sql.NullString{}
+	}
+	v, ok := log[l.groupKey]
+	if !ok || v == nil {
+		return sql.NullString{}
+	}
+	skippedKeys[l.groupKey] = true
+	s, ok := v.(string)
+	if !ok {
+		s = fmt.Sprint(v)
+	}
+	return sql.NullString{String: s, Valid: true}
+}
+
+// resolveGroupKey returns filter with its meta filter on the grouping key
+// replaced by a group filter, since the values of the grouping key are stored
+// in the group_id column.
+func (l *LogWriter) resolveGroupKey(filter *GetEntriesFilter) *GetEntriesFilter {
+	v, ok := filter.MetaFilters[l.groupKey]
+	if l.groupKey == "" || !ok || v == nil {
+		return filter
+	}
+	group, ok := v.(string)
+	if !ok {
+		group = fmt.Sprint(v)
+	}
+	if filter.Group != "" && filter.Group != group {
+		// the meta filter matches no entries
+		return filter
+	}
+
+	f := *filter
+	f.Group = group
+	f.MetaFilters = map[string]interface{}{}
+	for k, v := range filter.MetaFilters {
+		if k != l.groupKey {
+			f.MetaFilters[k] = v
+		}
+	}
+	return &f
+}
+
+func (e *LogEntry) group() sql.NullString {
+	if e.Group == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: *e.Group, Valid: true}
+}
+
+func (l *LogWriter) addGroupColumn(ctx context.Context) error {
+	if err := l.ensureColumn(ctx, "log_entries", "group_id", "VARCHAR(255)"); err != nil {
+		return err
+	}
+	_, err := l.db.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS log_entries_group_id_idx ON log_entries (group_id)")
+	return err
+}
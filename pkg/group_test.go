@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGroupKey(t *testing.T) {
+	lw := newImportLogWriter(t, WithGroupKey("request_id"))
+	for _, line := range []string{
+		`{"level": "info", "message": "start", "request_id": "r1"}`,
+		`{"level": "info", "message": "start", "request_id": "r2"}`,
+		`{"level": "error", "message": "failed", "request_id": "r1"}`,
+		`{"level": "info", "message": "numeric", "request_id": 42}`,
+		`{"level": "info", "message": "no request"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithGroup("r1")))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	for _, entry := range entries {
+		require.NotNil(t, entry.Group)
+		assert.Equal(t, "r1", *entry.Group)
+		// the grouping key is stored in its column rather than as meta
+		assert.NotContains(t, entry.Meta, "request_id")
+	}
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithGroup("42")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "numeric", *entries[0].Message)
+
+	// meta filters on the grouping key match the group
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"request_id": "r1"})))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"request_id": 42})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "numeric", *entries[0].Message)
+	entries, err = lw.GetEntries(NewGetEntriesFilter(
+		WithGroup("r2"), WithMetaFilters(map[string]interface{}{"request_id": "r1"})))
+	require.NoError(t, err)
+	assert.Empty(t, entries)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithQueryString(`group=r1 AND level>=error`)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "failed", *entries[0].Message)
+
+	entries, err = lw.GetEntries(nil)
+	require.NoError(t, err)
+	assert.Nil(t, entries[4].Group)
+}
+
+func TestWithoutGroupKey(t *testing.T) {
+	lw := newImportLogWriter(t)
+	_, err := lw.Write([]byte(`{"level": "info", "request_id": "r1"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Nil(t, entries[0].Group)
+	assert.Equal(t, "r1", entries[0].Meta["request_id"])
+}
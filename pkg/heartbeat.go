@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"sort"
+	"time"
+)
+
+// Long running programs can log heartbeats, entries with a key such as
+// heartbeat or progress, to show they are making progress. A session whose
+// run hasn't ended and that hasn't logged a heartbeat for a while has
+// probably stalled.
+
+// DefaultHeartbeatKeys are the keys of the heartbeat entries, unless set with
+// WithHeartbeatKeys.
+var DefaultHeartbeatKeys = []string{"heartbeat", "progress"}
+
+// DefaultStallPollInterval is how often WatchStalls looks for stalled
+// sessions, unless set with WithStallPollInterval.
+const DefaultStallPollInterval = 10 * time.Second
+
+// SessionHeartbeat is the last heartbeat of a session, see Heartbeats.
+type SessionHeartbeat struct {
+	Session string `json:"session"`
+	// Count is the number of heartbeats of the session.
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+	// Ended is true if the run of the session ended after its last
+	// heartbeat, see SessionManager.EndSession.
+	Ended bool `json:"ended"`
+	// Stalled is true if the session hasn't ended, and its last heartbeat is
+	// older than the duration set with WithStallAfter.
+	Stalled bool `json:"stalled"`
+}
+
+type heartbeatOptions struct {
+	keys         []string
+	stallAfter   time.Duration
+	pollInterval time.Duration
+	now          func() time.Time
+}
+
+type HeartbeatOption func(*heartbeatOptions)
+
+// WithHeartbeatKeys sets the keys of the heartbeat entries, any of which
+// makes an entry a heartbeat, DefaultHeartbeatKeys by default.
+func WithHeartbeatKeys(keys ...string) HeartbeatOption {
+	return func(o *heartbeatOptions) {
+		o.keys = keys
+	}
+}
+
+// WithStallAfter flags the sessions whose last heartbeat is older than d as
+// stalled. Sessions are never stalled by default.
+func WithStallAfter(d time.Duration) HeartbeatOption {
+	return func(o *heartbeatOptions) {
+		o.stallAfter = d
+	}
+}
+
+// WithStallPollInterval sets how often WatchStalls looks for stalled
+// sessions, DefaultStallPollInterval by default.
+func WithStallPollInterval(d time.Duration) HeartbeatOption {
+	return func(o *heartbeatOptions) {
+		o.pollInterval = d
+	}
+}
+
+func newHeartbeatOptions(opts []HeartbeatOption) *heartbeatOptions {
+	o := &heartbeatOptions{
+		keys:         DefaultHeartbeatKeys,
+		pollInterval: DefaultStallPollInterval,
+		now:          time.Now,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func (l *LogWriter) Heartbeats(filter *GetEntriesFilter, opts ...HeartbeatOption) ([]*SessionHeartbeat, error) {
+	return l.HeartbeatsContext(context.Background(), filter, opts...)
+}
+
+// HeartbeatsContext returns the last heartbeat of the sessions that logged
+// heartbeats matching filter, the most recent first.
+func (l *LogWriter) HeartbeatsContext(ctx context.Context, filter *GetEntriesFilter, opts ...HeartbeatOption) ([]*SessionHeartbeat, error) {
+	return l.heartbeats(ctx, filter, newHeartbeatOptions(opts))
+}
+
+func (l *LogWriter) heartbeats(ctx context.Context, filter *GetEntriesFilter, o *heartbeatOptions) ([]*SessionHeartbeat, error) {
+	ret := []*SessionHeartbeat{}
+	if len(o.keys) == 0 {
+		return ret, nil
+	}
+	ids, err := l.filteredIDs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	heartbeats := sqlbuilder.Select("lem.log_entry_id").From("log_entries_meta lem")
+	keys := []string{}
+	for _, key := range o.keys {
+		keys = append(keys, metaKeyCondition(l.schema.MetaKeys, key))
+	}
+	heartbeats.Where(heartbeats.Or(keys...))
+
+	sb := sqlbuilder.Select("session", "COUNT(*)", "MAX(date)").From("log_entries").GroupBy("session")
+	sb.Where(sb.IsNotNull("session"), sb.In("id", heartbeats), sb.In("id", ids))
+	bySession := map[string]*SessionHeartbeat{}
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		hb := &SessionHeartbeat{}
+		var last interface{}
+		if err := rows.Scan(&hb.Session, &hb.Count, &last); err != nil {
+			return err
+		}
+		t, err := scanTime(last)
+		if err != nil {
+			return err
+		}
+		hb.Last = t
+		bySession[hb.Session] = hb
+		ret = append(ret, hb)
+		return nil
+	})
+	if err != nil || len(ret) == 0 {
+		return ret, err
+	}
+
+	sessions := []interface{}{}
+	for _, hb := range ret {
+		sessions = append(sessions, hb.Session)
+	}
+	sb = sqlbuilder.Select("id", "ended_at").From("sessions")
+	sb.Where(sb.In("id", sessions...), sb.IsNotNull("ended_at"))
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		var id string
+		var endedAt sql.NullTime
+		if err := rows.Scan(&id, &endedAt); err != nil {
+			return err
+		}
+		hb := bySession[id]
+		hb.Ended = endedAt.Valid && !endedAt.Time.Before(hb.Last)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := o.now()
+	for _, hb := range ret {
+		hb.Stalled = o.stallAfter > 0 && !hb.Ended && now.Sub(hb.Last) >= o.stallAfter
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if !ret[i].Last.Equal(ret[j].Last) {
+			return ret[i].Last.After(ret[j].Last)
+		}
+		return ret[i].Session < ret[j].Session
+	})
+	return ret, nil
+}
+
+// WatchStalls calls onStall for the sessions matching filter that stall
+// while it runs, until ctx is done. The stall duration is set with
+// WithStallAfter. A session is reported once per stall: it is reported again
+// if it logs a new heartbeat and stalls again.
+func (l *LogWriter) WatchStalls(ctx context.Context, filter *GetEntriesFilter,
+	onStall func(*SessionHeartbeat), opts ...HeartbeatOption) error {
+	o := newHeartbeatOptions(opts)
+	if o.stallAfter <= 0 {
+		return nil
+	}
+	// sessions that had already stalled are not reported
+	since := o.now().Add(-o.stallAfter)
+	reported := map[string]time.Time{}
+
+	ticker := time.NewTicker(o.pollInterval)
+	defer ticker.Stop()
+	for {
+		heartbeats, err := l.heartbeats(ctx, filter, o)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for _, hb := range heartbeats {
+			if !hb.Stalled || hb.Last.Before(since) {
+				continue
+			}
+			if last, ok := reported[hb.Session]; ok && last.Equal(hb.Last) {
+				continue
+			}
+			reported[hb.Session] = hb.Last
+			onStall(hb)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHeartbeats(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	now := time.Now().UTC().Truncate(time.Second)
+	for _, entry := range []string{
+		`{"level": "info", "session": "running", "heartbeat": true, "time": "` + now.Add(-time.Minute).Format(time.RFC3339) + `"}`,
+		`{"level": "info", "session": "stalled", "progress": 0.2, "time": "` + now.Add(-20*time.Minute).Format(time.RFC3339) + `"}`,
+		`{"level": "info", "session": "stalled", "progress": 0.4, "time": "` + now.Add(-10*time.Minute).Format(time.RFC3339) + `"}`,
+		`{"level": "info", "session": "stalled", "message": "no heartbeat", "time": "` + now.Format(time.RFC3339) + `"}`,
+		`{"level": "info", "session": "ended", "progress": 1, "time": "` + now.Add(-time.Hour).Format(time.RFC3339) + `"}`,
+		`{"level": "info", "session": "quiet", "time": "` + now.Format(time.RFC3339) + `"}`,
+	} {
+		_, err = lw.Write([]byte(entry))
+		require.NoError(t, err)
+	}
+	require.NoError(t, lw.Sessions().ensureSession(&Session{ID: "ended", CreatedAt: now}))
+	require.NoError(t, lw.Sessions().EndSession("ended"))
+
+	heartbeats, err := lw.Heartbeats(nil, WithStallAfter(5*time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []*SessionHeartbeat{
+		{Session: "running", Count: 1, Last: now.Add(-time.Minute)},
+		{Session: "stalled", Count: 2, Last: now.Add(-10 * time.Minute), Stalled: true},
+		{Session: "ended", Count: 1, Last: now.Add(-time.Hour), Ended: true},
+	}, heartbeats)
+
+	heartbeats, err = lw.Heartbeats(NewGetEntriesFilter(WithSession("stalled")), WithHeartbeatKeys("heartbeat"))
+	require.NoError(t, err)
+	assert.Empty(t, heartbeats)
+}
+
+func TestWatchStalls(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	// stalled before the watch started
+	_, err = lw.Write([]byte(`{"level": "info", "session": "old", "heartbeat": 1, "time": "2023-05-01T12:00:00Z"}`))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	mu := sync.Mutex{}
+	stalled := []string{}
+	done := make(chan error)
+	go func() {
+		done <- lw.WatchStalls(ctx, nil, func(hb *SessionHeartbeat) {
+			mu.Lock()
+			defer mu.Unlock()
+			stalled = append(stalled, hb.Session)
+		}, WithStallAfter(200*time.Millisecond), WithStallPollInterval(20*time.Millisecond))
+	}()
+	_, err = lw.Write([]byte(`{"level": "info", "session": "new", "heartbeat": 1}`))
+	require.NoError(t, err)
+
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(stalled) > 0
+	}, 5*time.Second, 20*time.Millisecond)
+	// reported once
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+	assert.Equal(t, []string{"new"}, stalled)
+}
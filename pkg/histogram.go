@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// MaxHistogramBuckets bounds the number of buckets returned by Histogram.
+const MaxHistogramBuckets = 100000
+
+// HistogramBucket is the number of entries in the time range [Start, Start+bucket).
+type HistogramBucket struct {
+	Start time.Time `json:"start"`
+	Count int64     `json:"count"`
+	// Levels splits Count by level, if requested with WithHistogramByLevel.
+	Levels map[string]int64 `json:"levels,omitempty"`
+}
+
+type histogramQuery struct {
+	byLevel bool
+}
+
+type HistogramOption func(*histogramQuery)
+
+// WithHistogramByLevel splits the count of each bucket by level.
+func WithHistogramByLevel(byLevel bool) HistogramOption {
+	return func(q *histogramQuery) {
+		q.byLevel = byLevel
+	}
+}
+
+// Histogram counts the entries matching filter per time bucket.
+//
+// Buckets are aligned on multiples of bucket since the UNIX epoch, and empty
+// buckets between the first and last entry are included, so that the result
+// can be plotted as is.
+func (l *LogWriter) Histogram(filter *GetEntriesFilter, bucket time.Duration, opts ...HistogramOption) ([]*HistogramBucket, error) {
+	return l.HistogramContext(context.Background(), filter, bucket, opts...)
+}
+
+func (l *LogWriter) HistogramContext(ctx context.Context, filter *GetEntriesFilter, bucket time.Duration, opts ...HistogramOption) ([]*HistogramBucket, error) {
+	q := &histogramQuery{}
+	for _, opt := range opts {
+		opt(q)
+	}
+
+	seconds := int64(bucket / time.Second)
+	if seconds <= 0 || bucket%time.Second != 0 {
+		return nil, errors.Errorf("histogram bucket must be a whole number of seconds, got %s", bucket)
+	}
+
+	ids, err := l.filteredIDs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	sb := sqlbuilder.NewSelectBuilder()
+	columns := []string{fmt.Sprintf("(%s / %d) * %d AS b", l.store.UnixTime("e.date"), seconds, seconds), "COUNT(*)"}
+	groupBy := []string{"b"}
+	if q.byLevel {
+		columns = append(columns, "e.level")
+		groupBy = append(groupBy, "e.level")
+	}
+	sb.Select(columns...).From("log_entries e")
+	sb.Where(sb.In("e.id", ids))
+	sb.GroupBy(groupBy...).OrderBy("b")
+
+	s, args := sb.Build()
+	rows, err := l.db.QueryxContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	counts := map[int64]*HistogramBucket{}
+	var first, last int64
+	for rows.Next() {
+		var start, count int64
+		var level string
+		dest := []interface{}{&start, &count}
+		if q.byLevel {
+			dest = append(dest, &level)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+
+		b, ok := counts[start]
+		if !ok {
+			b = &HistogramBucket{Start: time.Unix(start, 0).UTC()}
+			if q.byLevel {
+				b.Levels = map[string]int64{}
+			}
+			counts[start] = b
+			if len(counts) == 1 || start < first {
+				first = start
+			}
+			if len(counts) == 1 || start > last {
+				last = start
+			}
+		}
+		b.Count += count
+		if q.byLevel {
+			b.Levels[level] += count
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ret := []*HistogramBucket{}
+	if len(counts) == 0 {
+		return ret, nil
+	}
+	if (last-first)/seconds+1 > MaxHistogramBuckets {
+		return nil, errors.Errorf("histogram would have more than %d buckets, use a larger bucket", MaxHistogramBuckets)
+	}
+	for start := first; start <= last; start += seconds {
+		b, ok := counts[start]
+		if !ok {
+			b = &HistogramBucket{Start: time.Unix(start, 0).UTC()}
+			if q.byLevel {
+				b.Levels = map[string]int64{}
+			}
+		}
+		ret = append(ret, b)
+	}
+
+	return ret, nil
+}
@@ -0,0 +1,44 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLogWriterHistogram(t *testing.T) {
+	lw := newImportLogWriter(t)
+	for _, line := range []string{
+		`{"level": "info", "time": "2023-05-01T10:05:00Z"}`,
+		`{"level": "error", "time": "2023-05-01T10:45:00Z"}`,
+		`{"level": "error", "time": "2023-05-01T10:50:00Z"}`,
+		`{"level": "info", "time": "2023-05-01T13:10:00Z"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	buckets, err := lw.Histogram(nil, time.Hour, WithHistogramByLevel(true))
+	require.NoError(t, err)
+	require.Len(t, buckets, 4)
+	assert.Equal(t, &HistogramBucket{
+		Start:  time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC),
+		Count:  3,
+		Levels: map[string]int64{"info": 1, "error": 2},
+	}, buckets[0])
+	// empty buckets are filled in
+	assert.Equal(t, int64(0), buckets[1].Count)
+	assert.Equal(t, time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC), buckets[2].Start)
+	assert.Equal(t, int64(1), buckets[3].Count)
+
+	buckets, err = lw.Histogram(NewGetEntriesFilter(WithLevel("error")), 30*time.Minute)
+	require.NoError(t, err)
+	require.Len(t, buckets, 1)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 30, 0, 0, time.UTC), buckets[0].Start)
+	assert.Equal(t, int64(2), buckets[0].Count)
+	assert.Nil(t, buckets[0].Levels)
+
+	_, err = lw.Histogram(nil, 500*time.Millisecond)
+	assert.Error(t, err)
+}
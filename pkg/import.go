@@ -0,0 +1,300 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+)
+
+// DefaultImportBatchSize is the number of entries written per transaction by Import.
+const DefaultImportBatchSize = 1000
+
+// ImportProgress is reported after each batch written by Import.
+type ImportProgress struct {
+	// Lines is the number of lines read so far, including empty lines, or
+	// the number of records for a RecordParser.
+	Lines int `json:"lines"`
+	// Imported is the number of entries written to the database.
+	Imported int `json:"imported"`
+	// Skipped is the number of invalid lines, see WithImportSkipInvalid.
+	Skipped int `json:"skipped"`
+}
+
+// ImportLineError is returned when a line can't be imported.
+type ImportLineError struct {
+	Line int
+	Err  error
+}
+
+func (e *ImportLineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err.Error())
+}
+
+func (e *ImportLineError) Unwrap() error {
+	return e.Err
+}
+
+type importer struct {
+	parser          LineParser
+	batchSize       int
+	timestampField  string
+	timestampFormat string
+	levelField      string
+	messageField    string
+	skipInvalid     bool
+	continuation    ContinuationFunc
+	progress        func(ImportProgress)
+}
+
+type ImportOption func(*importer)
+
+// WithImportParser sets the parser used to decode the imported lines, which
+// defaults to the parser of the LogWriter.
+func WithImportParser(parser LineParser) ImportOption {
+	return func(i *importer) {
+		i.parser = parser
+	}
+}
+
+func WithImportBatchSize(n int) ImportOption {
+	return func(i *importer) {
+		i.batchSize = n
+	}
+}
+
+// WithImportTimestampField sets the field the timestamp is read from, which
+// defaults to the timestamp field of the LogWriter.
+func WithImportTimestampField(name string) ImportOption {
+	return func(i *importer) {
+		i.timestampField = name
+	}
+}
+
+// WithImportTimestampFormat sets the format of the imported timestamps, which
+// defaults to the timestamp format of the LogWriter.
+func WithImportTimestampFormat(format string) ImportOption {
+	return func(i *importer) {
+		i.timestampFormat = format
+	}
+}
+
+// WithImportLevelField sets the field the level is read from (default "level").
+func WithImportLevelField(name string) ImportOption {
+	return func(i *importer) {
+		i.levelField = name
+	}
+}
+
+// WithImportMessageField sets the field the message is read from, which
+// defaults to the message field of the LogWriter.
+func WithImportMessageField(name string) ImportOption {
+	return func(i *importer) {
+		i.messageField = name
+	}
+}
+
+// WithImportSkipInvalid skips lines that can't be parsed instead of aborting the import.
+func WithImportSkipInvalid(skip bool) ImportOption {
+	return func(i *importer) {
+		i.skipInvalid = skip
+	}
+}
+
+// WithImportProgress registers a callback called after each batch.
+func WithImportProgress(progress func(ImportProgress)) ImportOption {
+	return func(i *importer) {
+		i.progress = progress
+	}
+}
+
+// ImportJSONL backfills the database with newline-delimited JSON entries, for
+// example a file zerolog wrote to.
+func (l *LogWriter) ImportJSONL(r io.Reader, opts ...ImportOption) (*ImportProgress, error) {
+	return l.ImportContext(context.Background(), r, append([]ImportOption{WithImportParser(JSONLineParser)}, opts...)...)
+}
+
+// Import backfills the database with the lines read from r, which are decoded
+// using the configured LineParser, or split into records by a RecordParser.
+// Entries spanning several lines are reassembled with WithImportMultiline.
+//
+// Entries go through the middlewares of the LogWriter, and are written in
+// transactions of DefaultImportBatchSize entries. If a batch fails, the
+// entries of that batch are rolled back, while previous batches are kept.
+func (l *LogWriter) Import(r io.Reader, opts ...ImportOption) (*ImportProgress, error) {
+	return l.ImportContext(context.Background(), r, opts...)
+}
+
+// ImportContext is Import, stopping before the next batch once ctx is done.
+func (l *LogWriter) ImportContext(ctx context.Context, r io.Reader, opts ...ImportOption) (*ImportProgress, error) {
+	i := &importer{
+		parser:          l.parser,
+		batchSize:       DefaultImportBatchSize,
+		timestampField:  l.timestampFieldName,
+		timestampFormat: l.timestampFormat,
+		levelField:      "level",
+		messageField:    l.messageFieldName,
+	}
+	for _, opt := range opts {
+		opt(i)
+	}
+	if i.batchSize <= 0 {
+		i.batchSize = DefaultImportBatchSize
+	}
+
+	progress := &ImportProgress{}
+	scanner := bufio.NewScanner(r)
+	// zerolog entries can get long when they contain stack traces or payloads
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	if p, ok := i.parser.(RecordParser); ok {
+		scanner.Split(p.SplitRecord)
+		i.continuation = nil
+	}
+
+	batch := []map[string]interface{}{}
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, err := l.writeBatch(ctx, batch)
+		if err != nil {
+			return err
+		}
+		progress.Imported += n
+		batch = batch[:0]
+		if i.progress != nil {
+			i.progress(*progress)
+		}
+		return nil
+	}
+
+	// with WithImportMultiline, the entry of the last parsed line is kept
+	// pending until a line that doesn't continue it
+	var pending map[string]interface{}
+	var continued []string
+	pendingSkipped := false
+	emit := func() error {
+		if pending == nil {
+			return nil
+		}
+		if len(continued) > 0 {
+			appendContinuation(pending, continued)
+		}
+		batch = append(batch, l.mapImportedFields(i, pending))
+		pending, continued = nil, nil
+		if len(batch) >= i.batchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	for scanner.Scan() {
+		progress.Lines++
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		if i.continuation != nil && (pending != nil || pendingSkipped) && i.continuation(line) {
+			// the continuation lines of a skipped line are skipped along with it
+			if pending != nil {
+				continued = append(continued, string(line))
+			}
+			continue
+		}
+
+		if err := emit(); err != nil {
+			return progress, err
+		}
+		pendingSkipped = false
+		entry, err := i.parser.ParseLine(line)
+		if err != nil {
+			if i.skipInvalid {
+				progress.Skipped++
+				pendingSkipped = true
+				continue
+			}
+			return progress, &ImportLineError{Line: progress.Lines, Err: err}
+		}
+		pending = entry
+		if i.continuation == nil {
+			if err := emit(); err != nil {
+				return progress, err
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return progress, err
+	}
+
+	if err := emit(); err != nil {
+		return progress, err
+	}
+	if err := flush(); err != nil {
+		return progress, err
+	}
+	return progress, nil
+}
+
+// mapImportedFields renames the timestamp, level and message fields of an
+// imported entry to the fields the LogWriter expects, and normalizes its level.
+func (l *LogWriter) mapImportedFields(i *importer, entry map[string]interface{}) map[string]interface{} {
+	if v, ok := entry[i.timestampField]; ok {
+		// unparseable timestamps are kept as is, and stored as meta by insertEntry
+		if t, err := parseTimestamp(v, i.timestampFormat); err == nil {
+			delete(entry, i.timestampField)
+			entry[l.timestampFieldName] = t
+		}
+	}
+	if v, ok := entry[i.levelField]; ok && i.levelField != "level" {
+		delete(entry, i.levelField)
+		entry["level"] = v
+	}
+	if v, ok := entry[i.messageField]; ok && i.messageField != l.messageFieldName {
+		delete(entry, i.messageField)
+		entry[l.messageFieldName] = v
+	}
+	l.normalizeEntryLevel(entry)
+	return entry
+}
+
+// writeBatch writes entries through the middleware chain in a single
+// transaction, and returns the number of entries written, which excludes the
+// entries dropped by the middlewares.
+func (l *LogWriter) writeBatch(ctx context.Context, entries []map[string]interface{}) (int, error) {
+	// run the middlewares first, so that they don't see the entries again
+	// if the transaction gets retried
+	handled := []map[string]interface{}{}
+	handler := chainMiddlewares(func(entry map[string]interface{}) error {
+		handled = append(handled, entry)
+		return nil
+	}, l.middlewares...)
+	for _, entry := range entries {
+		if err := handler(entry); err != nil {
+			return 0, err
+		}
+	}
+
+	err := l.retryBusy(ctx, func() error {
+		tx, err := l.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range handled {
+			if err := l.insertEntry(ctx, tx, entry); err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+		}
+
+		return tx.Commit()
+	})
+	if err != nil {
+		return 0, err
+	}
+	return len(handled), nil
+}
@@ -0,0 +1,172 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newImportLogWriter(t *testing.T, opts ...LogWriterOption) *LogWriter {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	db.SetMaxOpenConns(1)
+
+	lw := NewLogWriter(db, NewSchema(), opts...)
+	require.NoError(t, lw.Init())
+	return lw
+}
+
+func TestLogWriterImportJSONL(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	input := `{"level": "info", "time": "2023-05-01T10:00:00Z", "message": "first", "n": 1}
+
+{"level": "error", "time": "2023-05-01T10:00:01Z", "message": "second"}
+{"level": "debug", "time": "2023-05-01T10:00:02Z", "message": "third"}
+`
+	progress := []ImportProgress{}
+	res, err := lw.ImportJSONL(strings.NewReader(input),
+		WithImportBatchSize(2),
+		WithImportProgress(func(p ImportProgress) {
+			progress = append(progress, p)
+		}))
+	require.NoError(t, err)
+	assert.Equal(t, &ImportProgress{Lines: 4, Imported: 3}, res)
+	assert.Equal(t, []ImportProgress{
+		{Lines: 3, Imported: 2},
+		{Lines: 4, Imported: 3},
+	}, progress)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "second", *entries[1].Message)
+	assert.Equal(t, "error", entries[1].Level)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 1, 0, time.UTC), entries[1].Date.UTC())
+	assert.Equal(t, map[string]interface{}{"n": int64(1)}, entries[0].Meta)
+}
+
+func TestLogWriterImportJSONLFieldMapping(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	input := `{"severity": "warn", "ts": 1682935200, "msg": "mapped", "other": "x"}`
+	_, err := lw.ImportJSONL(strings.NewReader(input),
+		WithImportLevelField("severity"),
+		WithImportTimestampField("ts"),
+		WithImportTimestampFormat(TimestampFormatUnix),
+		WithImportMessageField("msg"),
+	)
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "warn", entries[0].Level)
+	assert.Equal(t, "mapped", *entries[0].Message)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC), entries[0].Date.UTC())
+	assert.Equal(t, map[string]interface{}{"other": "x"}, entries[0].Meta)
+}
+
+func TestLogWriterImportJSONLInvalid(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	input := "{\"level\": \"info\"}\nnot json\n{\"level\": \"warn\"}\n"
+	_, err := lw.ImportJSONL(strings.NewReader(input))
+	require.Error(t, err)
+	lineErr, ok := err.(*ImportLineError)
+	require.True(t, ok)
+	assert.Equal(t, 2, lineErr.Line)
+
+	lw = newImportLogWriter(t)
+	res, err := lw.ImportJSONL(strings.NewReader(input), WithImportSkipInvalid(true))
+	require.NoError(t, err)
+	assert.Equal(t, &ImportProgress{Lines: 3, Imported: 2, Skipped: 1}, res)
+}
+
+func TestLogWriterImportDropped(t *testing.T) {
+	dropDebug := func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			if entry["level"] == "debug" {
+				return nil
+			}
+			return next(entry)
+		}
+	}
+	lw := newImportLogWriter(t, WithMiddleware(dropDebug))
+
+	input := "{\"level\": \"debug\"}\n{\"level\": \"info\"}\n{\"level\": \"debug\"}\n"
+	res, err := lw.ImportJSONL(strings.NewReader(input))
+	require.NoError(t, err)
+	// the entries dropped by the middlewares aren't imported
+	assert.Equal(t, &ImportProgress{Lines: 3, Imported: 1}, res)
+}
+
+func TestLogWriterImportMultiline(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	input := `level=error message="request failed"
+java.lang.IllegalStateException: closed
+	at com.example.Pool.get(Pool.java:42)
+	at com.example.Handler.run(Handler.java:7)
+Caused by: java.io.IOException: reset
+	... 2 more
+level=info message=recovered
+not=a "valid line
+  File "app.py", line 3, in <module>
+level=warn message=retrying
+Traceback (most recent call last):
+  File "app.py", line 3, in <module>
+ValueError: invalid literal
+`
+	res, err := lw.Import(strings.NewReader(input),
+		WithImportParser(LogfmtLineParser),
+		WithImportSkipInvalid(true),
+		WithImportMultiline(nil))
+	require.NoError(t, err)
+	assert.Equal(t, &ImportProgress{Lines: 13, Imported: 3, Skipped: 1}, res)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "request failed", *entries[0].Message)
+	assert.Equal(t, "java.lang.IllegalStateException: closed\n"+
+		"\tat com.example.Pool.get(Pool.java:42)\n"+
+		"\tat com.example.Handler.run(Handler.java:7)\n"+
+		"Caused by: java.io.IOException: reset\n"+
+		"\t... 2 more", entries[0].Meta["stack"])
+	assert.Equal(t, "recovered", *entries[1].Message)
+	assert.NotContains(t, entries[1].Meta, "stack")
+	assert.Equal(t, "Traceback (most recent call last):\n"+
+		"  File \"app.py\", line 3, in <module>\n"+
+		"ValueError: invalid literal", entries[2].Meta["stack"])
+}
+
+func TestLogWriterImportContinuationPattern(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	input := `[2023-05-01 10:00:00] ERROR boom
+details: first
+details: second
+[2023-05-01 10:00:01] INFO fine
+`
+	parser, err := NewRegexLineParser(`^\[(?P<time>[^\]]+)\] (?P<level>\w+) (?P<message>.*)$`)
+	require.NoError(t, err)
+	_, err = lw.Import(strings.NewReader(input),
+		WithImportParser(parser),
+		WithImportTimestampFormat("2006-01-02 15:04:05"),
+		WithImportMultiline(ContinuationPattern(regexp.MustCompile(`^[^\[]`))))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "boom", *entries[0].Message)
+	assert.Equal(t, "details: first\ndetails: second", entries[0].Meta["stack"])
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 1, 0, time.UTC), entries[1].Date.UTC())
+}
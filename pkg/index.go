@@ -0,0 +1,251 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"hash/fnv"
+	"regexp"
+	"sort"
+	"time"
+)
+
+// Meta values are stored in log_entries_meta, whose indexes cover the values
+// of all keys at once. The queries on a hot key, such as user_id or
+// request_path, are sped up by a partial index on the values of that key
+// only, created with EnsureIndex:
+//
+//	CREATE INDEX meta_user_id_text_1a2b3c4d_idx ON log_entries_meta (text_value, log_entry_id)
+//	WHERE (name = 'user_id' OR meta_key_id = 3)
+//
+// The indexes are recorded in the meta_indexes table, see Indexes.
+
+// IndexType is the kind of values a meta index covers.
+type IndexType string
+
+const (
+	// IndexTypeText indexes the string values of a key.
+	IndexTypeText IndexType = "text"
+	// IndexTypeNumber indexes the integer and real values of a key, which
+	// are compared with each other.
+	IndexTypeNumber IndexType = "number"
+)
+
+// ParseIndexType parses text or number.
+func ParseIndexType(s string) (IndexType, error) {
+	switch t := IndexType(s); t {
+	case IndexTypeText, IndexTypeNumber:
+		return t, nil
+	}
+	return "", errors.Errorf("unknown index type %q, expected text or number", s)
+}
+
+// expression returns the indexed expression, as compared by metaCondition.
+func (t IndexType) expression() string {
+	if t == IndexTypeNumber {
+		return "COALESCE(int_value, real_value)"
+	}
+	return "text_value"
+}
+
+// MetaIndex is a partial index on the values of a meta key, see EnsureIndex.
+type MetaIndex struct {
+	Name string    `db:"name" json:"name"`
+	Key  string    `db:"key" json:"key"`
+	Type IndexType `db:"type" json:"type"`
+	// Condition is the WHERE clause of the index, which selects the rows
+	// of the key.
+	Condition string    `db:"condition" json:"condition"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// UnknownIndexError is returned by DropIndex for keys without index.
+type UnknownIndexError struct {
+	Key string
+}
+
+func (e *UnknownIndexError) Error() string {
+	return "no index on " + e.Key
+}
+
+type indexOptions struct {
+	indexType IndexType
+}
+
+type IndexOption func(*indexOptions)
+
+// WithIndexType sets the kind of values indexed. It defaults to
+// IndexTypeNumber for the keys declared as int or real with AddTyped, and to
+// IndexTypeText otherwise.
+func WithIndexType(t IndexType) IndexOption {
+	return func(o *indexOptions) {
+		o.indexType = t
+	}
+}
+
+func (l *LogWriter) createMetaIndexesTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("meta_indexes").
+		IfNotExists().
+		Define("name", "VARCHAR(255)", "PRIMARY KEY").
+		Define("key", "VARCHAR(255)", "NOT NULL").
+		Define("type", "VARCHAR(16)", "NOT NULL").
+		Define("condition", "TEXT", "NOT NULL").
+		Define("created_at", "TIMESTAMP", "NOT NULL")
+	_, err := l.db.ExecContext(ctx, ctb.String())
+	return err
+}
+
+var indexNameRegexp = regexp.MustCompile(`[^a-z0-9_]+`)
+
+// metaIndexName returns a name valid in sqlite and postgres, the hash telling
+// apart the keys that only differ by the characters replaced.
+func metaIndexName(key string, t IndexType) string {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(key))
+	name := indexNameRegexp.ReplaceAllString(key, "_")
+	if len(name) > 32 {
+		name = name[:32]
+	}
+	return fmt.Sprintf("meta_%s_%s_%08x_idx", name, t, h.Sum32())
+}
+
+// EnsureIndex creates a partial index on the values of key, if it doesn't
+// exist yet. The index only serves the queries on the key as it is stored
+// now: if the key gets registered in the schema later on, EnsureIndex has to
+// be called again to update the index.
+func (l *LogWriter) EnsureIndex(ctx context.Context, key string, opts ...IndexOption) (*MetaIndex, error) {
+	o := &indexOptions{
+		indexType: IndexTypeText,
+	}
+	metaKey, ok := l.schema.MetaKeys.Get(key)
+	// the type of keys without TypeValidation is only a default
+	if ok && metaKey.TypeValidation != "" && (metaKey.Type == LogEntryTypeInt || metaKey.Type == LogEntryTypeReal) {
+		o.indexType = IndexTypeNumber
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if _, err := ParseIndexType(string(o.indexType)); err != nil {
+		return nil, err
+	}
+	if ok && metaKey.Wide && l.wideTable {
+		return nil, errors.Errorf("%s is stored in the wide table, whose columns are indexed already", key)
+	}
+
+	index := &MetaIndex{
+		Name:      metaIndexName(key, o.indexType),
+		Key:       key,
+		Type:      o.indexType,
+		Condition: metaKeyExpression(l.schema.MetaKeys, "", key),
+		CreatedAt: time.Now().UTC(),
+	}
+	existing, err := l.getIndex(ctx, index.Name)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil && existing.Condition == index.Condition {
+		return existing, nil
+	}
+
+	tx, err := l.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	if existing != nil {
+		if _, err := tx.ExecContext(ctx, "DROP INDEX IF EXISTS "+index.Name); err != nil {
+			return nil, err
+		}
+	}
+	q := fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s ON log_entries_meta (%s, log_entry_id) WHERE %s",
+		index.Name, index.Type.expression(), index.Condition)
+	if _, err := tx.ExecContext(ctx, q); err != nil {
+		return nil, err
+	}
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("meta_indexes").
+		Cols("name", "key", "type", "condition", "created_at").
+		Values(index.Name, index.Key, index.Type, index.Condition, index.CreatedAt).
+		SQL("ON CONFLICT (name) DO UPDATE SET condition = excluded.condition, created_at = excluded.created_at")
+	s, args := ib.Build()
+	if _, err := tx.ExecContext(ctx, tx.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+func (l *LogWriter) getIndex(ctx context.Context, name string) (*MetaIndex, error) {
+	sb := sqlbuilder.Select("*").From("meta_indexes")
+	sb.Where(sb.E("name", name))
+	s, args := sb.Build()
+	ret := &MetaIndex{}
+	err := l.db.GetContext(ctx, ret, l.db.Rebind(s), args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// DropIndex drops the indexes created on key by EnsureIndex, or returns an
+// UnknownIndexError.
+func (l *LogWriter) DropIndex(ctx context.Context, key string) error {
+	indexes, err := l.Indexes(ctx)
+	if err != nil {
+		return err
+	}
+
+	tx, err := l.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+	dropped := false
+	for _, index := range indexes {
+		if index.Key != key {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "DROP INDEX IF EXISTS "+index.Name); err != nil {
+			return err
+		}
+		db := sqlbuilder.NewDeleteBuilder()
+		db.DeleteFrom("meta_indexes").Where(db.E("name", index.Name))
+		s, args := db.Build()
+		if _, err := tx.ExecContext(ctx, tx.Rebind(s), args...); err != nil {
+			return err
+		}
+		dropped = true
+	}
+	if !dropped {
+		return &UnknownIndexError{Key: key}
+	}
+	return tx.Commit()
+}
+
+// Indexes returns the indexes created by EnsureIndex, sorted by key.
+func (l *LogWriter) Indexes(ctx context.Context) ([]*MetaIndex, error) {
+	ret := []*MetaIndex{}
+	s, args := sqlbuilder.Select("*").From("meta_indexes").Build()
+	if err := l.db.SelectContext(ctx, &ret, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Key != ret[j].Key {
+			return ret[i].Key < ret[j].Key
+		}
+		return ret[i].Type < ret[j].Type
+	})
+	return ret, nil
+}
@@ -0,0 +1,97 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestEnsureIndex(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func() {
+		_ = db.Close()
+	}()
+	db.SetMaxOpenConns(1)
+
+	schema := NewSchema()
+	schema.MetaKeys.Add("user")
+	schema.MetaKeys.AddTyped("elapsed_ms", LogEntryTypeReal, TypeValidationCoerce)
+	lw := NewLogWriter(db, schema)
+	require.NoError(t, lw.Init())
+	ctx := context.Background()
+	for _, line := range []string{
+		`{"level": "info", "message": "a", "user": "bob", "elapsed_ms": 12}`,
+		`{"level": "info", "message": "b", "user": "alice", "elapsed_ms": 40.5}`,
+		`{"level": "info", "message": "c", "user": "o'brien"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	index, err := lw.EnsureIndex(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, IndexTypeText, index.Type)
+	again, err := lw.EnsureIndex(ctx, "user")
+	require.NoError(t, err)
+	assert.Equal(t, index.Name, again.Name)
+	_, err = lw.EnsureIndex(ctx, "elapsed_ms")
+	require.NoError(t, err)
+	_, err = lw.EnsureIndex(ctx, "o'brien")
+	require.NoError(t, err)
+
+	indexes, err := lw.Indexes(ctx)
+	require.NoError(t, err)
+	require.Len(t, indexes, 3)
+	assert.Equal(t, "elapsed_ms", indexes[0].Key)
+	assert.Equal(t, IndexTypeNumber, indexes[0].Type)
+	assert.Equal(t, "o'brien", indexes[1].Key)
+	assert.Equal(t, "user", indexes[2].Key)
+
+	// the meta filters of queries are served by the partial indexes
+	for key, v := range map[string]interface{}{"user": "bob", "elapsed_ms": 40.5} {
+		name := metaIndexName(key, IndexTypeText)
+		if key == "elapsed_ms" {
+			name = metaIndexName(key, IndexTypeNumber)
+		}
+		assert.Contains(t, explainMetaCondition(t, lw, key, v), name)
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"user": "bob"})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "a", *entries[0].Message)
+
+	require.NoError(t, lw.DropIndex(ctx, "user"))
+	assert.NotContains(t, explainMetaCondition(t, lw, "user", "bob"), index.Name)
+	indexes, err = lw.Indexes(ctx)
+	require.NoError(t, err)
+	assert.Len(t, indexes, 2)
+
+	err = lw.DropIndex(ctx, "user")
+	assert.ErrorAs(t, err, new(*UnknownIndexError))
+	_, err = lw.EnsureIndex(ctx, "user", WithIndexType("blob"))
+	assert.Error(t, err)
+}
+
+func explainMetaCondition(t *testing.T, lw *LogWriter, key string, v interface{}) string {
+	q := sqlbuilder.Select("id").From("log_entries")
+	q.Where(metaCondition(lw.schema.MetaKeys, q, key, "=", v))
+	s, args := q.Build()
+	rows, err := lw.db.Queryx("EXPLAIN QUERY PLAN "+lw.db.Rebind(s), args...)
+	require.NoError(t, err)
+	defer func() {
+		_ = rows.Close()
+	}()
+	plan := []string{}
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		require.NoError(t, err)
+		plan = append(plan, row[len(row)-1].(string))
+	}
+	require.NoError(t, rows.Err())
+	return strings.Join(plan, "\n")
+}
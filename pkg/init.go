@@ -1,16 +1,243 @@
 package pkg
 
 import (
+	"context"
 	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"io"
+	"os"
+	"time"
 )
 
 type LoggerConfig struct {
 	WithCaller bool
 	Level      string
-	DBFile     string
-	Schema     *Schema
+	// DBFile is the sqlite file to log to, or a postgres:// URL.
+	DBFile string
+	Schema *Schema
+
+	// TimestampFieldName is the field parsed into the date column. Defaults to zerolog.TimestampFieldName.
+	TimestampFieldName string
+	// TimestampFormat is the format of the timestamp field. Defaults to zerolog.TimeFieldFormat.
+	// Use TimestampFormatUnix for UNIX seconds.
+	TimestampFormat string
+	// MessageFieldName is the field stored in the message column. Defaults to zerolog.MessageFieldName.
+	MessageFieldName string
+	// TraceIDFieldName and SpanIDFieldName are the fields stored in the
+	// trace_id and span_id columns. Default to DefaultTraceIDFieldName and
+	// DefaultSpanIDFieldName.
+	TraceIDFieldName string
+	SpanIDFieldName  string
+	// GroupKey is the field stored in the group_id column, for applications
+	// grouping their entries by request rather than session, see WithGroupKey.
+	GroupKey string
+	// Session is stored for entries that don't have a session field.
+	// If empty, the session is chosen according to SessionStrategy.
+	Session string
+	// SessionStrategy defaults to SessionStrategyActive, which continues the
+	// active session of the database, if there is one.
+	SessionStrategy SessionStrategy
+	// SessionEnvVar is read by SessionStrategyEnv. Defaults to DefaultSessionEnvVar.
+	SessionEnvVar string
+	// RecordBuildInfo stores the go version, module version and git revision
+	// of the binary on the session, see LogWriter.RecordBuildInfo.
+	RecordBuildInfo bool
+	// Encoders convert meta values before they get stored, see WithEncoders.
+	Encoders *Encoders
+	// NormalizeLevels rewrites the levels of entries with LevelMapping and
+	// DefaultLevelMapping before they get stored, see WithLevelNormalization.
+	NormalizeLevels bool
+	LevelMapping    LevelMapping
+	// Middlewares are run on every entry before it gets persisted.
+	Middlewares []Middleware
+	// SchemaValidation validates the entries against the fields of Schema, see SchemaValidationMiddleware.
+	SchemaValidation SchemaValidation
+	// Metrics are rolled up from the stored entries, see WithMetrics.
+	Metrics []MetricDefinition
+	// LevelRoutes drop the entries less severe than the minimum level of
+	// their component before they get sampled, see LevelRouter.
+	LevelRoutes []LevelRoute
+	// SampleRules drop high-volume entries before the other middlewares run, see Sampler.
+	SampleRules []SampleRule
+	// Enrich stamps the entries with the hostname, pid and executable of the
+	// process, and EnrichFields with static fields, see Enricher.
+	Enrich       bool
+	EnrichFields map[string]interface{}
+	// RedactKeys are masked before entries get persisted, see Redactor.
+	// Redaction is enabled if RedactKeys is set or RedactCreditCards is true,
+	// in which case DefaultRedactKeys are used if RedactKeys is empty.
+	RedactKeys []string
+	// RedactMode defaults to RedactModeRedact.
+	RedactMode RedactMode
+	// RedactCreditCards also redacts string values containing credit card numbers.
+	RedactCreditCards bool
+	// ConcurrentWrites allows other processes to write to the same sqlite file, see ConcurrentSQLiteDSN.
+	ConcurrentWrites bool
+	// WideTable stores the values of the schema's meta keys as columns, see WithWideTable.
+	WideTable bool
+	// ExplodeArrays stores the elements of array values as separate meta rows, see WithArrayExplosion.
+	ExplodeArrays bool
+	// FlattenObjects stores the fields of nested objects as dotted meta keys,
+	// down to FlattenDepth levels (0 meaning no limit), see WithObjectFlattening.
+	// KeepFlattenedObjects stores the objects as well.
+	FlattenObjects       bool
+	FlattenDepth         int
+	KeepFlattenedObjects bool
+	// FullTextSearch maintains a full-text index of the entries. Requires the sqlite_fts5 build tag.
+	FullTextSearch bool
+	// BlobThreshold offloads blob and JSON values larger than this many bytes
+	// to BlobDir, see WithBlobOffloading. 0 disables offloading.
+	BlobThreshold int
+	// BlobDir defaults to DefaultBlobDir(DBFile) for sqlite databases.
+	BlobDir string
+	// Compression compresses blob and JSON values larger than CompressionThreshold, see WithCompression.
+	Compression          Compression
+	CompressionThreshold int
+	// EncryptionKey encrypts messages, errors, and text, blob and JSON values
+	// with a key derived from it, see WithEncryption.
+	EncryptionKey string
+	// EncryptedKeys are encrypted with a key derived from FieldEncryptionKey,
+	// which also decrypts them when reading, see WithEncryptedKeys.
+	EncryptedKeys      []string
+	FieldEncryptionKey string
+	// WatchLevel applies the level stored in the database by SetLevel while
+	// logging, reading it every LevelPollInterval (DefaultLevelPollInterval
+	// if 0). Requires InitLogging.
+	WatchLevel        bool
+	LevelPollInterval time.Duration
+	// RotateSize rotates the sqlite database once it exceeds this many bytes,
+	// and RotateDaily when the day changes. Both require InitRotatingLogging.
+	RotateSize  int64
+	RotateDaily bool
+	// OnError is called with the entries that can't be written, see WithOnError.
+	OnError ErrorHandler
+	// DeadLetterFile collects the entries that can't be written, see WithDeadLetterFile.
+	DeadLetterFile string
+	// Fallback receives the entries while the database is unavailable. Defaults
+	// to os.Stderr. Requires InitFailoverLogging.
+	Fallback io.Writer
+	// FailoverRetryInterval defaults to DefaultFailoverRetryInterval.
+	FailoverRetryInterval time.Duration
+	// AdditionalWriters receive the entries along with the database, for
+	// example a console or a file. See MinLevelWriter to route levels.
+	AdditionalWriters []io.Writer
+}
+
+// WithMiddleware adds middlewares to the write path of the configured logger.
+func (c *LoggerConfig) WithMiddleware(middlewares ...Middleware) *LoggerConfig {
+	c.Middlewares = append(c.Middlewares, middlewares...)
+	return c
+}
+
+func (c *LoggerConfig) logWriterOptions() []LogWriterOption {
+	opts := []LogWriterOption{}
+	if c.TimestampFieldName != "" {
+		opts = append(opts, WithTimestampFieldName(c.TimestampFieldName))
+	}
+	if c.TimestampFormat != "" {
+		opts = append(opts, WithTimestampFormat(c.TimestampFormat))
+	}
+	if c.MessageFieldName != "" {
+		opts = append(opts, WithMessageFieldName(c.MessageFieldName))
+	}
+	if c.GroupKey != "" {
+		opts = append(opts, WithGroupKey(c.GroupKey))
+	}
+	if c.TraceIDFieldName != "" || c.SpanIDFieldName != "" {
+		traceID, spanID := DefaultTraceIDFieldName, DefaultSpanIDFieldName
+		if c.TraceIDFieldName != "" {
+			traceID = c.TraceIDFieldName
+		}
+		if c.SpanIDFieldName != "" {
+			spanID = c.SpanIDFieldName
+		}
+		opts = append(opts, WithTraceFieldNames(traceID, spanID))
+	}
+	if c.Encoders != nil {
+		opts = append(opts, WithEncoders(c.Encoders))
+	}
+	if c.NormalizeLevels {
+		opts = append(opts, WithLevelNormalization(c.LevelMapping))
+	}
+	if c.OnError != nil {
+		opts = append(opts, WithOnError(c.OnError))
+	}
+	if c.DeadLetterFile != "" {
+		opts = append(opts, WithDeadLetterFile(c.DeadLetterFile))
+	}
+	if c.FullTextSearch {
+		opts = append(opts, WithFullTextSearch(true))
+	}
+	if c.WideTable {
+		opts = append(opts, WithWideTable(true))
+	}
+	if c.ExplodeArrays {
+		opts = append(opts, WithArrayExplosion(true))
+	}
+	if c.FlattenObjects {
+		opts = append(opts, WithObjectFlattening(c.FlattenDepth, c.KeepFlattenedObjects))
+	}
+	if c.ConcurrentWrites {
+		opts = append(opts, WithBusyRetry(DefaultBusyRetries, DefaultBusyBackoff))
+	}
+	if c.Compression != CompressionNone {
+		opts = append(opts, WithCompression(c.Compression, c.CompressionThreshold))
+	}
+	if c.EncryptionKey != "" {
+		opts = append(opts, WithEncryption(c.EncryptionKey))
+	}
+	if c.FieldEncryptionKey != "" {
+		opts = append(opts, WithEncryptedKeys(c.FieldEncryptionKey, c.EncryptedKeys...))
+	}
+	// values offloaded by previous runs are read back even if offloading is disabled
+	blobDir := c.BlobDir
+	if blobDir == "" && c.DBFile != "" && !isPostgresDSN(c.DBFile) {
+		blobDir = DefaultBlobDir(c.DBFile)
+	}
+	if blobDir != "" {
+		opts = append(opts, WithBlobOffloading(blobDir, c.BlobThreshold))
+	}
+	if len(c.Metrics) > 0 {
+		opts = append(opts, WithMetrics(c.Metrics...))
+	}
+	if len(c.LevelRoutes) > 0 {
+		opts = append(opts, WithMiddleware(LevelRouteMiddleware(WithLevelRoutes(c.LevelRoutes...))))
+	}
+	if len(c.SampleRules) > 0 {
+		sampleOpts := []SampleOption{WithSampleRules(c.SampleRules...)}
+		if c.MessageFieldName != "" {
+			sampleOpts = append(sampleOpts, WithSampleMessageFieldName(c.MessageFieldName))
+		}
+		opts = append(opts, WithMiddleware(SampleMiddleware(sampleOpts...)))
+	}
+	if len(c.Middlewares) > 0 {
+		opts = append(opts, WithMiddleware(c.Middlewares...))
+	}
+	if c.Schema != nil && c.Schema.HasDerivedFields() {
+		opts = append(opts, WithMiddleware(DerivedFieldsMiddleware(c.Schema)))
+	}
+	if c.Schema != nil && len(c.Schema.Fields) > 0 &&
+		c.SchemaValidation != "" && c.SchemaValidation != SchemaValidationNone {
+		opts = append(opts, WithMiddleware(SchemaValidationMiddleware(c.Schema, c.SchemaValidation)))
+	}
+	// enrichment runs after validation, which doesn't know about the added fields
+	if c.Enrich || len(c.EnrichFields) > 0 {
+		opts = append(opts, WithEnrichment(WithEnrichProcess(c.Enrich), WithEnrichFields(c.EnrichFields)))
+	}
+	// redaction runs last, so that it also covers fields added by the other middlewares
+	if len(c.RedactKeys) > 0 || c.RedactCreditCards {
+		redactOpts := []RedactOption{WithRedactCreditCards(c.RedactCreditCards)}
+		if len(c.RedactKeys) > 0 {
+			redactOpts = append(redactOpts, WithRedactKeys(c.RedactKeys...))
+		}
+		if c.RedactMode != "" {
+			redactOpts = append(redactOpts, WithRedactMode(c.RedactMode))
+		}
+		opts = append(opts, WithMiddleware(RedactMiddleware(redactOpts...)))
+	}
+	return opts
 }
 
 type MissingDBFileError struct {
@@ -21,28 +248,144 @@ func (e *MissingDBFileError) Error() string {
 }
 
 func InitLogging(config *LoggerConfig) (*LogWriter, *sqlx.DB, error) {
-	if config.WithCaller {
-		log.Logger = log.With().Caller().Logger()
-	}
-
 	if config.DBFile == "" {
 		return nil, nil, &MissingDBFileError{}
 	}
 
-	db, err := sqlx.Open("sqlite3", config.DBFile)
+	logWriter, err := OpenLogWriter(config.dsn(), config.Schema, config.logWriterOptions()...)
 	if err != nil {
 		return nil, nil, err
 	}
+	db := logWriter.db
 
-	logWriter := NewLogWriter(db, config.Schema)
-	err = logWriter.Init()
-	if err != nil {
-		_ = db.Close()
+	if err := config.initSession(logWriter); err != nil {
+		_ = logWriter.Close()
 		return nil, nil, err
 	}
-	log.Logger = log.Output(logWriter)
+	config.initLogger(logWriter)
+	if config.WatchLevel {
+		config.watchLevel(logWriter)
+	}
+
+	return logWriter, db, nil
+}
+
+// InitRotatingLogging is InitLogging for a sqlite database that gets rotated
+// according to RotateSize and RotateDaily, see RotatingWriter.
+func InitRotatingLogging(config *LoggerConfig) (*RotatingWriter, error) {
+	if config.DBFile == "" {
+		return nil, &MissingDBFileError{}
+	}
 
-	switch config.Level {
+	rotateOpts := []RotateOption{
+		WithRotateSize(config.RotateSize),
+		WithRotateDaily(config.RotateDaily),
+		WithRotateLogWriterOptions(config.logWriterOptions()...),
+	}
+	w, err := NewRotatingWriter(config.dsn(), config.Schema, rotateOpts...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := config.initSession(w.LogWriter()); err != nil {
+		_ = w.Close()
+		return nil, err
+	}
+	config.initLogger(w)
+
+	return w, nil
+}
+
+// InitFailoverLogging is InitLogging for applications that must not lose
+// their logs when the database is unavailable: instead of failing, entries go
+// to Fallback until the database can be opened and written to, see
+// FailoverWriter.
+func InitFailoverLogging(config *LoggerConfig) (*FailoverWriter, error) {
+	if config.DBFile == "" {
+		return nil, &MissingDBFileError{}
+	}
+
+	fallback := config.Fallback
+	if fallback == nil {
+		fallback = os.Stderr
+	}
+	failoverOpts := []FailoverOption{}
+	if config.FailoverRetryInterval > 0 {
+		failoverOpts = append(failoverOpts, WithFailoverRetryInterval(config.FailoverRetryInterval))
+	}
+	lwOpts := config.logWriterOptions()
+	w := NewFailoverWriter(func() (*LogWriter, error) {
+		logWriter, err := OpenLogWriter(config.dsn(), config.Schema, lwOpts...)
+		if err != nil {
+			return nil, err
+		}
+		if err := config.initSession(logWriter); err != nil {
+			_ = logWriter.Close()
+			return nil, err
+		}
+		return logWriter, nil
+	}, fallback, failoverOpts...)
+	config.initLogger(w)
+
+	return w, nil
+}
+
+// OpenLogWriter opens DBFile with the options InitLogging would use, followed
+// by opts, without touching the global logger or choosing a session. Tools
+// importing entries into a database use it to apply the same write path as
+// the loggers writing to it.
+func (c *LoggerConfig) OpenLogWriter(opts ...LogWriterOption) (*LogWriter, error) {
+	return OpenLogWriter(c.dsn(), c.Schema, append(c.logWriterOptions(), opts...)...)
+}
+
+func (c *LoggerConfig) dsn() string {
+	if c.ConcurrentWrites && c.DBFile != "" && !isPostgresDSN(c.DBFile) {
+		return ConcurrentSQLiteDSN(c.DBFile)
+	}
+	return c.DBFile
+}
+
+func (c *LoggerConfig) initSession(logWriter *LogWriter) error {
+	if c.Session != "" {
+		logWriter.session = c.Session
+	} else {
+		session, err := resolveSession(logWriter.Sessions(), c.SessionStrategy, c.SessionEnvVar)
+		if err != nil {
+			return err
+		}
+		logWriter.session = session
+	}
+	if c.RecordBuildInfo {
+		return logWriter.RecordBuildInfo()
+	}
+	return nil
+}
+
+// watchLevel runs WatchLevel in the background until logWriter gets closed.
+func (c *LoggerConfig) watchLevel(logWriter *LogWriter) {
+	interval := c.LevelPollInterval
+	if interval <= 0 {
+		interval = DefaultLevelPollInterval
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	logWriter.stopWatchingLevel = cancel
+	go logWriter.WatchLevel(ctx, interval, func(err error) {
+		if c.OnError != nil {
+			c.OnError(errors.Wrap(err, "could not read the level setting"), nil)
+		}
+	})
+}
+
+func (c *LoggerConfig) initLogger(w io.Writer) {
+	if c.WithCaller {
+		log.Logger = log.With().Caller().Logger()
+	}
+	if len(c.AdditionalWriters) > 0 {
+		w = newTeeWriter(append([]io.Writer{w}, c.AdditionalWriters...)...)
+	}
+	log.Logger = log.Output(w)
+
+	switch c.Level {
 	case "debug":
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	case "info":
@@ -54,6 +397,32 @@ func InitLogging(config *LoggerConfig) (*LogWriter, *sqlx.DB, error) {
 	case "fatal":
 		zerolog.SetGlobalLevel(zerolog.FatalLevel)
 	}
+}
+
+// OpenLogWriter opens (and initializes if necessary) the plunger database at dbFile,
+// which is either a sqlite file or a postgres:// URL.
+//
+// Contrary to InitLogging, it doesn't touch the global logger, which makes it
+// suitable for tools that read or post-process a log database.
+func OpenLogWriter(dbFile string, schema *Schema, opts ...LogWriterOption) (*LogWriter, error) {
+	if dbFile == "" {
+		return nil, &MissingDBFileError{}
+	}
+	if schema == nil {
+		schema = NewSchema()
+	}
 
-	return logWriter, db, nil
+	store, err := OpenStore(dbFile)
+	if err != nil {
+		return nil, err
+	}
+
+	logWriter := NewLogWriterWithStore(store, schema, opts...)
+	err = logWriter.Init()
+	if err != nil {
+		_ = store.DB().Close()
+		return nil, err
+	}
+
+	return logWriter, nil
 }
@@ -0,0 +1,182 @@
+package pkg
+
+import (
+	"context"
+)
+
+// EntryIterator iterates over log entries one at a time.
+//
+//	it, err := lw.IterEntries(ctx, filter)
+//	...
+//	defer it.Close()
+//	for it.Next() {
+//	    entry := it.Entry()
+//	}
+//	if err := it.Err(); err != nil {
+//	    ...
+//	}
+type EntryIterator interface {
+	// Next advances to the next entry, and returns false once iteration is
+	// over or an error occurred.
+	Next() bool
+	// Entry returns the current entry.
+	Entry() *LogEntry
+	// Err returns the error that stopped iteration, if any.
+	Err() error
+	Close() error
+}
+
+// DefaultIteratorBatchSize is the number of entries IterEntries loads at once.
+const DefaultIteratorBatchSize = 500
+
+// batchIterator loads entries in batches keyed on the entry id, so that only a
+// single batch of entries and their meta is held in memory at once.
+type batchIterator struct {
+	ctx       context.Context
+	lw        *LogWriter
+	filter    GetEntriesFilter
+	batchSize int
+	// remaining is the number of entries left to return, -1 if unlimited.
+	remaining int
+
+	batch   []*LogEntry
+	current *LogEntry
+	done    bool
+	err     error
+}
+
+// IterEntries returns an iterator over the entries matching filter.
+//
+// Contrary to GetEntries, entries are loaded in batches of
+// DefaultIteratorBatchSize, which makes it suitable for large databases.
+func (l *LogWriter) IterEntries(ctx context.Context, filter *GetEntriesFilter) (EntryIterator, error) {
+	f := NewGetEntriesFilter()
+	if filter != nil {
+		f_ := *filter
+		f = &f_
+	}
+
+	if f.Cursor != "" {
+		afterID, err := DecodeCursor(f.Cursor)
+		if err != nil {
+			return nil, err
+		}
+		f.Cursor = ""
+		if afterID > f.AfterID {
+			f.AfterID = afterID
+		}
+	}
+
+	remaining := -1
+	if f.Limit > 0 {
+		remaining = f.Limit
+	}
+
+	return &batchIterator{
+		ctx:       ctx,
+		lw:        l,
+		filter:    *f,
+		batchSize: DefaultIteratorBatchSize,
+		remaining: remaining,
+	}, nil
+}
+
+func (it *batchIterator) Next() bool {
+	if it.err != nil || it.remaining == 0 {
+		return false
+	}
+
+	if len(it.batch) == 0 {
+		if it.done {
+			return false
+		}
+		if err := it.ctx.Err(); err != nil {
+			it.err = err
+			return false
+		}
+		if err := it.loadBatch(); err != nil {
+			it.err = err
+			return false
+		}
+		if len(it.batch) == 0 {
+			return false
+		}
+	}
+
+	it.current = it.batch[0]
+	it.batch = it.batch[1:]
+	if it.remaining > 0 {
+		it.remaining--
+	}
+	return true
+}
+
+func (it *batchIterator) loadBatch() error {
+	limit := it.batchSize
+	if it.remaining > 0 && it.remaining < limit {
+		limit = it.remaining
+	}
+	it.filter.Limit = limit
+
+	entries, err := it.lw.GetEntriesContext(it.ctx, &it.filter)
+	if err != nil {
+		return err
+	}
+	if len(entries) < limit {
+		it.done = true
+	}
+	if len(entries) > 0 {
+		it.filter.AfterID = entries[len(entries)-1].ID
+	}
+	// the offset only applies to the first batch
+	it.filter.Offset = 0
+
+	it.batch = entries
+	return nil
+}
+
+func (it *batchIterator) Entry() *LogEntry {
+	return it.current
+}
+
+func (it *batchIterator) Err() error {
+	return it.err
+}
+
+func (it *batchIterator) Close() error {
+	it.batch = nil
+	it.done = true
+	return nil
+}
+
+type sliceIterator struct {
+	entries []*LogEntry
+	current *LogEntry
+}
+
+// NewSliceIterator returns an EntryIterator over already loaded entries.
+func NewSliceIterator(entries []*LogEntry) EntryIterator {
+	return &sliceIterator{entries: entries}
+}
+
+func (it *sliceIterator) Next() bool {
+	if len(it.entries) == 0 {
+		return false
+	}
+	it.current = it.entries[0]
+	it.entries = it.entries[1:]
+	return true
+}
+
+func (it *sliceIterator) Entry() *LogEntry {
+	return it.current
+}
+
+func (it *sliceIterator) Err() error {
+	return nil
+}
+
+func (it *sliceIterator) Close() error {
+	it.entries = nil
+	return nil
+}
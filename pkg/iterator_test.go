@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterIterEntries(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	for i := 0; i < 10; i++ {
+		level := "info"
+		if i%2 == 0 {
+			level = "error"
+		}
+		_, err = lw.Write([]byte(fmt.Sprintf(`{"level": "%s", "i": %d}`, level, i)))
+		require.NoError(t, err)
+	}
+
+	collect := func(filter *GetEntriesFilter, batchSize int) []int64 {
+		it, err := lw.IterEntries(context.Background(), filter)
+		require.NoError(t, err)
+		it.(*batchIterator).batchSize = batchSize
+		defer func(it EntryIterator) {
+			_ = it.Close()
+		}(it)
+
+		ret := []int64{}
+		for it.Next() {
+			ret = append(ret, it.Entry().Meta["i"].(int64))
+		}
+		require.NoError(t, it.Err())
+		return ret
+	}
+
+	assert.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6, 7, 8, 9}, collect(nil, 3))
+	assert.Equal(t, []int64{0, 2, 4, 6, 8}, collect(NewGetEntriesFilter(WithLevel("error")), 2))
+	assert.Equal(t, []int64{2, 3, 4, 5}, collect(NewGetEntriesFilter(WithOffset(2), WithLimit(4)), 3))
+	assert.Equal(t, []int64{}, collect(NewGetEntriesFilter(WithLevel("fatal")), 3))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	it, err := lw.IterEntries(ctx, nil)
+	require.NoError(t, err)
+	assert.False(t, it.Next())
+	assert.ErrorIs(t, it.Err(), context.Canceled)
+}
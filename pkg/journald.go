@@ -0,0 +1,227 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JournaldParser parses the entries of the systemd journal, either written
+// by journalctl -o json, one JSON object per line, or by journalctl -o
+// export, whose entries are separated by empty lines.
+//
+// The priority is stored as the level, mapped with DefaultLevelMapping, the
+// timestamp is read from _SOURCE_REALTIME_TIMESTAMP or __REALTIME_TIMESTAMP
+// and CODE_FILE and CODE_LINE are stored as the caller. The fields shared
+// with syslog messages are stored under the same keys as ParseSyslog,
+// see journaldKeys, and the other fields as lowercase keys without leading
+// underscores, such as systemd_unit for _SYSTEMD_UNIT. Address fields such
+// as __CURSOR are dropped.
+var JournaldParser RecordParser = journaldParser{}
+
+// journaldKeys are the meta keys of the journal fields stored under the keys
+// used by ParseSyslog and Enricher.
+var journaldKeys = map[string]string{
+	"PRIORITY":          SyslogSeverityKey,
+	"SYSLOG_FACILITY":   SyslogFacilityKey,
+	"SYSLOG_IDENTIFIER": SyslogAppNameKey,
+	"SYSLOG_PID":        SyslogProcIDKey,
+	"_HOSTNAME":         HostnameKey,
+	"_PID":              PIDKey,
+}
+
+// journaldIntFields are stored as integers.
+var journaldIntFields = map[string]bool{
+	"PRIORITY": true,
+	"_PID":     true,
+	"_UID":     true,
+	"_GID":     true,
+	"ERRNO":    true,
+}
+
+type journaldParser struct{}
+
+func (journaldParser) ParseLine(line []byte) (map[string]interface{}, error) {
+	var fields map[string]interface{}
+	var err error
+	if bytes.HasPrefix(bytes.TrimSpace(line), []byte("{")) {
+		fields, err = parseJournaldJSON(line)
+	} else {
+		fields, err = parseJournaldExport(line)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mapJournaldFields(fields)
+}
+
+// parseJournaldJSON decodes an entry of journalctl -o json, in which binary
+// values are arrays of bytes and repeated fields arrays of values.
+func parseJournaldJSON(line []byte) (map[string]interface{}, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return nil, err
+	}
+	ret := map[string]interface{}{}
+	for k, v := range raw {
+		// values too large for journalctl are null
+		if v == nil {
+			continue
+		}
+		values, ok := v.([]interface{})
+		if !ok {
+			ret[k] = v
+			continue
+		}
+		if b, ok := journaldBytes(values); ok {
+			ret[k] = string(b)
+		} else {
+			ret[k] = values
+		}
+	}
+	return ret, nil
+}
+
+func journaldBytes(values []interface{}) ([]byte, bool) {
+	ret := make([]byte, 0, len(values))
+	for _, v := range values {
+		f, ok := v.(float64)
+		if !ok || f < 0 || f > 255 {
+			return nil, false
+		}
+		ret = append(ret, byte(f))
+	}
+	return ret, true
+}
+
+// parseJournaldExport decodes an entry of journalctl -o export. Text fields
+// are written as NAME=value lines, binary fields as the name, a newline, the
+// size as 64 bit little endian, the data and a newline.
+func parseJournaldExport(record []byte) (map[string]interface{}, error) {
+	ret := map[string]interface{}{}
+	for len(record) > 0 {
+		line, rest, _ := bytes.Cut(record, []byte("\n"))
+		if name, value, ok := bytes.Cut(line, []byte("=")); ok {
+			ret[string(name)] = string(value)
+			record = rest
+			continue
+		}
+
+		if len(rest) < 8 {
+			return nil, errors.Errorf("truncated binary field %s", line)
+		}
+		size := binary.LittleEndian.Uint64(rest)
+		if uint64(len(rest)-8) < size {
+			return nil, errors.Errorf("truncated binary field %s", line)
+		}
+		ret[string(line)] = string(rest[8 : 8+size])
+		record = bytes.TrimPrefix(rest[8+size:], []byte("\n"))
+	}
+	return ret, nil
+}
+
+// SplitRecord splits JSON entries by lines, and export entries at the empty
+// lines separating them.
+func (journaldParser) SplitRecord(data []byte, atEOF bool) (int, []byte, error) {
+	if len(data) > 0 && data[0] == '{' {
+		return bufio.ScanLines(data, atEOF)
+	}
+	// the empty lines between entries are returned as empty tokens, skipped by Import
+	if len(data) > 0 && data[0] == '\n' {
+		return 1, data[:0], nil
+	}
+
+	pos := 0
+	for pos < len(data) {
+		if data[pos] == '\n' {
+			return pos + 1, data[:pos], nil
+		}
+		eol := bytes.IndexByte(data[pos:], '\n')
+		if eol < 0 {
+			break
+		}
+		eol += pos
+		if bytes.IndexByte(data[pos:eol], '=') >= 0 {
+			pos = eol + 1
+			continue
+		}
+		if len(data) < eol+1+8 {
+			break
+		}
+		size := binary.LittleEndian.Uint64(data[eol+1:])
+		end := uint64(eol+1+8) + size + 1
+		if uint64(len(data)) < end {
+			break
+		}
+		pos = int(end)
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil
+	}
+	return 0, nil, nil
+}
+
+// mapJournaldFields maps the fields of a journal entry to the fields of an
+// entry, see JournaldParser.
+func mapJournaldFields(fields map[string]interface{}) (map[string]interface{}, error) {
+	entry := map[string]interface{}{"level": "info"}
+	for _, name := range []string{"_SOURCE_REALTIME_TIMESTAMP", "__REALTIME_TIMESTAMP"} {
+		if v, ok := fields[name]; ok {
+			s, _ := v.(string)
+			us, err := strconv.ParseInt(s, 10, 64)
+			if err != nil {
+				return nil, errors.Errorf("invalid %s %v", name, v)
+			}
+			entry[zerolog.TimestampFieldName] = time.UnixMicro(us).UTC()
+			break
+		}
+	}
+	if file, ok := fields["CODE_FILE"].(string); ok {
+		caller := file
+		if line, ok := fields["CODE_LINE"].(string); ok {
+			caller += ":" + line
+		}
+		entry[zerolog.CallerFieldName] = caller
+	}
+
+	for name, v := range fields {
+		switch {
+		case name == "MESSAGE":
+			entry[zerolog.MessageFieldName] = v
+			continue
+		case name == "_SOURCE_REALTIME_TIMESTAMP", name == "CODE_FILE", name == "CODE_LINE",
+			strings.HasPrefix(name, "__"):
+			continue
+		}
+
+		s, isString := v.(string)
+		switch {
+		case name == "PRIORITY" && isString:
+			if level, ok := DefaultLevelMapping[s]; ok {
+				entry["level"] = level
+			}
+		case name == "SYSLOG_FACILITY" && isString:
+			if n, err := strconv.Atoi(s); err == nil && n >= 0 && n < len(syslogFacilities) {
+				v = syslogFacilities[n]
+			}
+		}
+		if journaldIntFields[name] && isString {
+			if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+				v = n
+			}
+		}
+
+		key, ok := journaldKeys[name]
+		if !ok {
+			key = strings.ToLower(strings.TrimLeft(name, "_"))
+		}
+		entry[key] = v
+	}
+	return entry, nil
+}
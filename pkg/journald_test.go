@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseJournaldJSON(t *testing.T) {
+	entry, err := JournaldParser.ParseLine([]byte(`{"__CURSOR": "s=1", "__REALTIME_TIMESTAMP": "1682935200000000",
+		"_SOURCE_REALTIME_TIMESTAMP": "1682935199500000", "PRIORITY": "3", "SYSLOG_FACILITY": "3",
+		"SYSLOG_IDENTIFIER": "nginx", "_PID": "812", "_HOSTNAME": "web1", "_SYSTEMD_UNIT": "nginx.service",
+		"CODE_FILE": "src/main.c", "CODE_LINE": "42", "MESSAGE": [104, 105], "TAG": ["a", "b"], "HUGE": null}`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		zerolog.TimestampFieldName: time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC).Add(-500 * time.Millisecond),
+		zerolog.CallerFieldName:    "src/main.c:42",
+		zerolog.MessageFieldName:   "hi",
+		"level":                    "error",
+		SyslogSeverityKey:          int64(3),
+		SyslogFacilityKey:          "daemon",
+		SyslogAppNameKey:           "nginx",
+		PIDKey:                     int64(812),
+		HostnameKey:                "web1",
+		"systemd_unit":             "nginx.service",
+		"tag":                      []interface{}{"a", "b"},
+	}, entry)
+
+	_, err = JournaldParser.ParseLine([]byte(`{"__REALTIME_TIMESTAMP": "yesterday"}`))
+	assert.Error(t, err)
+}
+
+// journaldExportRecord writes fields in the journal export format, binary
+// values being those containing a newline.
+func journaldExportRecord(fields ...string) []byte {
+	b := &bytes.Buffer{}
+	for i := 0; i < len(fields); i += 2 {
+		name, value := fields[i], fields[i+1]
+		if !bytes.ContainsRune([]byte(value), '\n') {
+			b.WriteString(name + "=" + value + "\n")
+			continue
+		}
+		b.WriteString(name + "\n")
+		_ = binary.Write(b, binary.LittleEndian, uint64(len(value)))
+		b.WriteString(value + "\n")
+	}
+	return b.Bytes()
+}
+
+func TestImportJournald(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	require.NoError(t, lw.Init())
+
+	input := &bytes.Buffer{}
+	input.Write(journaldExportRecord("__CURSOR", "s=1", "__REALTIME_TIMESTAMP", "1682935200000000",
+		"PRIORITY", "6", "_SYSTEMD_UNIT", "cron.service", "MESSAGE", "job started"))
+	input.WriteString("\n")
+	input.Write(journaldExportRecord("__REALTIME_TIMESTAMP", "1682935201000000",
+		"PRIORITY", "4", "MESSAGE", "line one\n\nline three"))
+	input.WriteString("\n")
+	input.Write(journaldExportRecord("__REALTIME_TIMESTAMP", "1682935202000000", "MESSAGE", "last"))
+
+	progress, err := lw.Import(input, WithImportParser(JournaldParser), WithImportBatchSize(2))
+	require.NoError(t, err)
+	assert.Equal(t, 3, progress.Imported)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithOrderBy("date", Asc)))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "job started", *entries[0].Message)
+	assert.Equal(t, "info", entries[0].Level)
+	assert.Equal(t, "cron.service", entries[0].Meta["systemd_unit"])
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC), entries[0].Date.UTC())
+	assert.Equal(t, "line one\n\nline three", *entries[1].Message)
+	assert.Equal(t, "warn", entries[1].Level)
+	assert.Equal(t, "last", *entries[2].Message)
+
+	progress, err = lw.Import(bytes.NewBufferString(`{"__REALTIME_TIMESTAMP": "1682935203000000", "MESSAGE": "from json"}`+"\n"),
+		WithImportParser(JournaldParser))
+	require.NoError(t, err)
+	assert.Equal(t, 1, progress.Imported)
+}
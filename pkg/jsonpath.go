@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"strings"
+)
+
+// JSONPathFilter matches the entries whose JSON value for Key has Value at
+// Path, a JSON path as understood by SQLite's json_extract, such as
+// $.user.id or $.items[0].
+type JSONPathFilter struct {
+	Key   string
+	Path  string
+	Value interface{}
+}
+
+// InvalidJSONPathError is returned by Validate for paths that don't start with $.
+type InvalidJSONPathError struct {
+	Path string
+}
+
+func (e *InvalidJSONPathError) Error() string {
+	return fmt.Sprintf("invalid JSON path %q, expected a path starting with $", e.Path)
+}
+
+// WithJSONPath matches the entries whose JSON value for key has v at path,
+// for example WithJSONPath("payload", "$.user.id", 42). This requires
+// sqlite, and doesn't match compressed or offloaded values.
+func WithJSONPath(key string, path string, v interface{}) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.JSONPaths = append(f.JSONPaths, JSONPathFilter{Key: key, Path: path, Value: v})
+	}
+}
+
+func (f JSONPathFilter) validate() error {
+	if !strings.HasPrefix(f.Path, "$") {
+		return &InvalidJSONPathError{Path: f.Path}
+	}
+	return nil
+}
+
+// jsonPathCondition matches the entries whose JSON value for f.Key has
+// f.Value at f.Path.
+func jsonPathCondition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder, f JSONPathFilter) string {
+	// json_extract returns booleans as integers, and objects and arrays as JSON
+	value := f.Value
+	switch v := value.(type) {
+	case json.Number:
+		value = normalizeNumber(v)
+	case bool:
+		value = boolToInt(v)
+	case string, int, int64, float64:
+	default:
+		if b, err := json.Marshal(v); err == nil {
+			value = string(b)
+		}
+	}
+
+	// compressed and offloaded values aren't JSON, which json_extract fails on
+	build := func(sb *sqlbuilder.SelectBuilder, expr func(string) string) string {
+		extract := fmt.Sprintf(
+			"CASE WHEN %s = %d AND %s IS NULL AND json_valid(%s) THEN json_extract(%s, %s) END",
+			expr("lem.type"), LogEntryTypeJSON, expr("lem.compression"),
+			expr("lem.blob_value"), expr("lem.blob_value"), sb.Var(f.Path))
+		// not sb.E, which would escape the placeholder of the path
+		return extract + " = " + sb.Var(value)
+	}
+
+	sb := sqlbuilder.Select("lem.log_entry_id").From("log_entries_meta lem")
+	sb.Where(
+		metaKeyCondition(metaKeys, f.Key),
+		build(sb, func(column string) string { return column }),
+	)
+	if metaKey, ok := metaKeys.Get(f.Key); ok && metaKey.Wide {
+		wsb := sqlbuilder.Select("lem.log_entry_id").From(wideTable + " lem")
+		wsb.Where(build(wsb, func(column string) string {
+			if column == "lem.compression" {
+				// the wide table has no compression column
+				return "NULL"
+			}
+			return wideExpression(metaKey, column)
+		}))
+		return q.Or(q.In("id", sb), q.In("id", wsb))
+	}
+	return q.In("id", sb)
+}
@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestJSONPathFilter(t *testing.T) {
+	lw := newImportLogWriter(t, WithCompression(CompressionGzip, 64))
+
+	for _, line := range []string{
+		`{"level":"info","message":"alice","payload":{"user":{"id":42,"admin":true},"tags":["a","b"]}}`,
+		`{"level":"info","message":"bob","payload":{"user":{"id":7,"admin":false}}}`,
+		`{"level":"info","message":"text","payload":"$.user.id"}`,
+		`{"level":"info","message":"compressed","payload":{"user":{"id":42},"padding":"` +
+			"xxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxxx" + `"}}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		path     string
+		value    interface{}
+		expected []string
+	}{
+		{"$.user.id", 42, []string{"alice"}},
+		{"$.user.admin", false, []string{"bob"}},
+		{"$.tags[1]", "b", []string{"alice"}},
+		{"$.tags", []string{"a", "b"}, []string{"alice"}},
+		{"$.missing", 1, []string{}},
+	} {
+		entries, err := lw.GetEntries(NewGetEntriesFilter(WithJSONPath("payload", tc.path, tc.value)))
+		require.NoError(t, err, tc.path)
+		messages := []string{}
+		for _, entry := range entries {
+			messages = append(messages, *entry.Message)
+		}
+		assert.Equal(t, tc.expected, messages, tc.path)
+	}
+
+	_, err := lw.GetEntries(NewGetEntriesFilter(WithJSONPath("payload", "user.id", 42)))
+	var pathErr *InvalidJSONPathError
+	assert.ErrorAs(t, err, &pathErr)
+}
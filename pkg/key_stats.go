@@ -0,0 +1,189 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"sort"
+	"time"
+)
+
+// ValueCount is a value of a meta key along with the number of entries
+// having it, see DistinctValues.
+type ValueCount struct {
+	Value interface{} `json:"value"`
+	Count int         `json:"count"`
+}
+
+// KeyStats summarizes the values of a meta key, see KeyStats.
+type KeyStats struct {
+	Key string `json:"key"`
+	// Count is the number of entries with a value for the key.
+	Count         int `json:"count"`
+	DistinctCount int `json:"distinct_count"`
+	// Min and Max are only set if the key has numeric or duration values,
+	// other values are ignored.
+	Min interface{} `json:"min,omitempty"`
+	Max interface{} `json:"max,omitempty"`
+}
+
+// DistinctValues returns the values of key in the entries matching filter,
+// most frequent first, for example to build facet filters. The elements of
+// exploded arrays are counted separately, see WithArrayExplosion.
+func (l *LogWriter) DistinctValues(key string, filter *GetEntriesFilter) ([]ValueCount, error) {
+	return l.DistinctValuesContext(context.Background(), key, filter)
+}
+
+func (l *LogWriter) DistinctValuesContext(ctx context.Context, key string, filter *GetEntriesFilter) ([]ValueCount, error) {
+	ids, err := l.filteredIDs(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	columns := []string{"lem.type", "lem.int_value", "lem.real_value", "lem.text_value", "lem.blob_value"}
+	sb := sqlbuilder.Select(append(columns, "lem.compression", "COUNT(DISTINCT lem.log_entry_id) AS count")...).
+		From("log_entries_meta lem")
+	sb.Where(metaKeyCondition(l.schema.MetaKeys, key), sb.In("lem.log_entry_id", ids))
+	sb.GroupBy(append(columns, "lem.compression")...)
+
+	counts := map[string]*ValueCount{}
+	if err := l.countValues(ctx, sb, counts); err != nil {
+		return nil, err
+	}
+
+	if metaKey, ok := l.schema.MetaKeys.Get(key); ok && metaKey.Wide {
+		// older entries may still store the key in log_entries_meta
+		wideColumns := []string{}
+		for _, column := range columns {
+			wideColumns = append(wideColumns, wideExpression(metaKey, column)+" AS "+column[len("lem."):])
+		}
+		wsb := sqlbuilder.Select(append(wideColumns, "COUNT(*) AS count")...).From(wideTable + " lem")
+		wsb.Where(wsb.IsNotNull(wideExpression(metaKey, "lem.type")), wsb.In("lem.log_entry_id", ids))
+		for _, column := range columns {
+			wsb.GroupBy(wideExpression(metaKey, column))
+		}
+		if err := l.countValues(ctx, wsb, counts); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := []ValueCount{}
+	for _, c := range counts {
+		ret = append(ret, *c)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return fmt.Sprint(ret[i].Value) < fmt.Sprint(ret[j].Value)
+	})
+	return ret, nil
+}
+
+// countValues adds the values and counts selected by sb to counts, keyed by
+// type and value so that both layouts of wide keys add up.
+func (l *LogWriter) countValues(ctx context.Context, sb *sqlbuilder.SelectBuilder, counts map[string]*ValueCount) error {
+	s, args := sb.Build()
+	rows, err := l.db.QueryxContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		row := struct {
+			LogEntryMeta
+			Count int `db:"count"`
+		}{LogEntryMeta: LogEntryMeta{BlobDir: l.blobDir, Cipher: l.cipher, FieldCipher: l.fieldCipher}}
+		if err := rows.StructScan(&row); err != nil {
+			return err
+		}
+		v, err := row.Value()
+		if err != nil {
+			return err
+		}
+		k := fmt.Sprintf("%T %v", v, v)
+		if c, ok := counts[k]; ok {
+			c.Count += row.Count
+		} else {
+			counts[k] = &ValueCount{Value: v, Count: row.Count}
+		}
+	}
+	return rows.Err()
+}
+
+// KeyStats counts the entries and distinct values of key, and computes the
+// range of its numeric values.
+func (l *LogWriter) KeyStats(key string) (*KeyStats, error) {
+	return l.KeyStatsContext(context.Background(), key)
+}
+
+func (l *LogWriter) KeyStatsContext(ctx context.Context, key string) (*KeyStats, error) {
+	values, err := l.DistinctValuesContext(ctx, key, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &KeyStats{Key: key, DistinctCount: len(values)}
+	var lo, hi float64
+	for _, v := range values {
+		n, ok := numericValue(v.Value)
+		if !ok {
+			continue
+		}
+		if ret.Min == nil || n < lo {
+			lo, ret.Min = n, v.Value
+		}
+		if ret.Max == nil || n > hi {
+			hi, ret.Max = n, v.Value
+		}
+	}
+
+	// the counts of the values don't add up to the number of entries when
+	// arrays are exploded
+	ret.Count, err = l.countEntriesWithKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// countEntriesWithKey returns the number of entries with a value for key.
+func (l *LogWriter) countEntriesWithKey(ctx context.Context, key string) (int, error) {
+	sb := sqlbuilder.Select("COUNT(DISTINCT lem.log_entry_id)").From("log_entries_meta lem")
+	sb.Where(metaKeyCondition(l.schema.MetaKeys, key))
+	s, args := sb.Build()
+	var ret int
+	if err := l.db.GetContext(ctx, &ret, l.db.Rebind(s), args...); err != nil {
+		return 0, err
+	}
+
+	if metaKey, ok := l.schema.MetaKeys.Get(key); ok && metaKey.Wide {
+		wsb := sqlbuilder.Select("COUNT(*)").From(wideTable)
+		wsb.Where(wsb.IsNotNull(wideColumn(metaKey, "type")))
+		s, args := wsb.Build()
+		var n int
+		if err := l.db.GetContext(ctx, &n, l.db.Rebind(s), args...); err != nil {
+			return 0, err
+		}
+		ret += n
+	}
+	return ret, nil
+}
+
+func numericValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case float64:
+		return v, true
+	case time.Duration:
+		return float64(v), true
+	}
+	return 0, false
+}
@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestDistinctValuesAndKeyStats(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func() {
+		_ = db.Close()
+	}()
+	db.SetMaxOpenConns(1)
+
+	schema := NewSchema()
+	schema.MetaKeys.Add("status")
+	lw := NewLogWriter(db, schema, WithWideTable(true))
+	require.NoError(t, lw.Init())
+
+	for _, line := range []string{
+		`{"level":"info","status":200,"method":"GET"}`,
+		`{"level":"info","status":200,"method":"GET"}`,
+		`{"level":"error","status":500,"method":"POST"}`,
+		`{"level":"info","status":"n/a","method":"GET"}`,
+		`{"level":"info"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	values, err := lw.DistinctValues("method", nil)
+	require.NoError(t, err)
+	assert.Equal(t, []ValueCount{{Value: "GET", Count: 3}, {Value: "POST", Count: 1}}, values)
+
+	values, err = lw.DistinctValues("status", NewGetEntriesFilter(WithLevel("info")))
+	require.NoError(t, err)
+	assert.Equal(t, []ValueCount{{Value: int64(200), Count: 2}, {Value: "n/a", Count: 1}}, values)
+
+	stats, err := lw.KeyStats("status")
+	require.NoError(t, err)
+	assert.Equal(t, &KeyStats{Key: "status", Count: 4, DistinctCount: 3, Min: int64(200), Max: int64(500)}, stats)
+
+	stats, err = lw.KeyStats("method")
+	require.NoError(t, err)
+	assert.Equal(t, &KeyStats{Key: "method", Count: 4, DistinctCount: 2}, stats)
+}
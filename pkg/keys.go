@@ -0,0 +1,266 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// KeyUsage describes a key stored in the database, see ListKeys.
+type KeyUsage struct {
+	Name string `json:"name"`
+	// MetaKey is true if the key is registered in meta_keys, in which case
+	// ID is its id. Other keys are stored by name with each value.
+	MetaKey bool `json:"meta_key"`
+	ID      int  `json:"id,omitempty"`
+	Wide    bool `json:"wide,omitempty"`
+	// Count is the number of stored values.
+	Count int `json:"count"`
+}
+
+// UnknownKeyError is returned when renaming or merging a key that isn't stored.
+type UnknownKeyError struct {
+	Name string
+}
+
+func (e *UnknownKeyError) Error() string {
+	return "unknown key " + e.Name
+}
+
+// KeyExistsError is returned when renaming a key to a name that is already used.
+type KeyExistsError struct {
+	Name string
+}
+
+func (e *KeyExistsError) Error() string {
+	return fmt.Sprintf("key %s already exists, merge the keys instead", e.Name)
+}
+
+// ListKeys returns the meta keys and the ad-hoc keys of the database, along
+// with their number of values, sorted by name.
+func (l *LogWriter) ListKeys(ctx context.Context) ([]KeyUsage, error) {
+	if err := l.loadSchema(ctx); err != nil {
+		return nil, err
+	}
+
+	sb := sqlbuilder.Select("meta_key_id", "COUNT(*) AS count").From("log_entries_meta")
+	sb.Where(sb.IsNotNull("meta_key_id")).GroupBy("meta_key_id")
+	s, args := sb.Build()
+	counts := []struct {
+		ID    int `db:"meta_key_id"`
+		Count int `db:"count"`
+	}{}
+	if err := l.db.SelectContext(ctx, &counts, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	countsByID := map[int]int{}
+	for _, c := range counts {
+		countsByID[c.ID] = c.Count
+	}
+
+	ret := []KeyUsage{}
+	for _, key := range l.schema.MetaKeys.Keys {
+		usage := KeyUsage{Name: key.Name, MetaKey: true, ID: key.ID, Wide: key.Wide, Count: countsByID[key.ID]}
+		if key.Wide {
+			sb := sqlbuilder.Select("COUNT(*)").From(wideTable)
+			sb.Where(sb.IsNotNull(wideColumn(key, "type")))
+			s, args := sb.Build()
+			var n int
+			if err := l.db.GetContext(ctx, &n, l.db.Rebind(s), args...); err != nil {
+				return nil, err
+			}
+			usage.Count += n
+		}
+		ret = append(ret, usage)
+	}
+
+	adHoc, err := l.SuggestMetaKeys(ctx, 0, 0)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range adHoc {
+		ret = append(ret, KeyUsage{Name: key.Name, Count: key.Count})
+	}
+
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Name != ret[j].Name {
+			return ret[i].Name < ret[j].Name
+		}
+		return ret[i].MetaKey
+	})
+	return ret, nil
+}
+
+// storedKey returns the meta key name, or nil if name is only stored as an
+// ad-hoc key. It returns an UnknownKeyError if name isn't stored at all.
+func (l *LogWriter) storedKey(ctx context.Context, tx *sqlx.Tx, name string) (*MetaKey, error) {
+	if key, ok := l.schema.MetaKeys.Get(name); ok {
+		return key, nil
+	}
+	sb := sqlbuilder.Select("COUNT(*)").From("log_entries_meta")
+	sb.Where(sb.Equal("name", name))
+	s, args := sb.Build()
+	var n int
+	if err := tx.GetContext(ctx, &n, tx.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.WithStack(&UnknownKeyError{Name: name})
+	}
+	return nil, nil
+}
+
+// RenameKey renames the key from to to, rewriting the values stored by name.
+// It returns a KeyExistsError if to is already used, see MergeKeys.
+//
+// Other writers keep using the old name until they are restarted.
+func (l *LogWriter) RenameKey(ctx context.Context, from string, to string) (int64, error) {
+	if err := l.loadSchema(ctx); err != nil {
+		return 0, err
+	}
+
+	var ret int64
+	var renamed *MetaKey
+	err := l.inTx(ctx, func(tx *sqlx.Tx) error {
+		key, err := l.storedKey(ctx, tx, from)
+		if err != nil {
+			return err
+		}
+		if _, err := l.storedKey(ctx, tx, to); err == nil {
+			return errors.WithStack(&KeyExistsError{Name: to})
+		} else if !errors.As(err, new(*UnknownKeyError)) {
+			return err
+		}
+
+		if key != nil {
+			ub := sqlbuilder.NewUpdateBuilder()
+			ub.Update("meta_keys").Set(ub.Assign("key", to)).Where(ub.Equal("id", key.ID))
+			s, args := ub.Build()
+			_, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+			renamed = key
+			return err
+		}
+
+		ub := sqlbuilder.NewUpdateBuilder()
+		ub.Update("log_entries_meta").Set(ub.Assign("name", to)).Where(ub.Equal("name", from))
+		s, args := ub.Build()
+		res, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+		if err != nil {
+			return err
+		}
+		ret, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if renamed != nil {
+		// the values reference the key by id, only the name changes
+		return 0, l.loadSchema(ctx)
+	}
+	return ret, nil
+}
+
+// MergeKeys moves the values of the key from to the key into, and removes
+// from. Entries that have values for both keys keep the value of into.
+// Keys stored in the wide table can't be merged.
+//
+// Other writers keep using the old key until they are restarted.
+func (l *LogWriter) MergeKeys(ctx context.Context, from string, into string) (int64, error) {
+	if from == into {
+		return 0, errors.New("can't merge a key into itself")
+	}
+	if err := l.loadSchema(ctx); err != nil {
+		return 0, err
+	}
+
+	var ret int64
+	err := l.inTx(ctx, func(tx *sqlx.Tx) error {
+		fromKey, err := l.storedKey(ctx, tx, from)
+		if err != nil {
+			return err
+		}
+		intoKey, err := l.storedKey(ctx, tx, into)
+		if err != nil {
+			return err
+		}
+		for _, key := range []*MetaKey{fromKey, intoKey} {
+			if key != nil && key.Wide {
+				return errors.Errorf("key %s is stored in the wide table and can't be merged", key.Name)
+			}
+		}
+
+		fromCond := func(cond *sqlbuilder.Cond) string {
+			if fromKey != nil {
+				return cond.Equal("meta_key_id", fromKey.ID)
+			}
+			return cond.Equal("name", from)
+		}
+		intoCond := func(cond *sqlbuilder.Cond) string {
+			if intoKey != nil {
+				return cond.Equal("meta_key_id", intoKey.ID)
+			}
+			return cond.Equal("name", into)
+		}
+
+		// drop the values of entries that already have a value for into
+		sub := sqlbuilder.Select("log_entry_id").From("log_entries_meta")
+		sub.Where(intoCond(&sub.Cond))
+		db := sqlbuilder.NewDeleteBuilder()
+		db.DeleteFrom("log_entries_meta").Where(fromCond(&db.Cond), db.In("log_entry_id", sub))
+		s, args := db.Build()
+		if _, err := tx.ExecContext(ctx, tx.Rebind(s), args...); err != nil {
+			return err
+		}
+
+		ub := sqlbuilder.NewUpdateBuilder()
+		ub.Update("log_entries_meta")
+		if intoKey != nil {
+			ub.Set(ub.Assign("meta_key_id", intoKey.ID), "name = NULL")
+		} else {
+			ub.Set(ub.Assign("name", into), "meta_key_id = NULL")
+		}
+		ub.Where(fromCond(&ub.Cond))
+		s, args = ub.Build()
+		res, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+		if err != nil {
+			return err
+		}
+		if ret, err = res.RowsAffected(); err != nil {
+			return err
+		}
+
+		if fromKey != nil {
+			db := sqlbuilder.NewDeleteBuilder()
+			db.DeleteFrom("meta_keys").Where(db.Equal("id", fromKey.ID))
+			s, args := db.Build()
+			if _, err := tx.ExecContext(ctx, tx.Rebind(s), args...); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return ret, l.loadSchema(ctx)
+}
+
+// inTx runs f in a transaction, which is committed if f succeeds.
+func (l *LogWriter) inTx(ctx context.Context, f func(tx *sqlx.Tx) error) error {
+	return l.retryBusy(ctx, func() error {
+		tx, err := l.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		if err := f(tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
@@ -0,0 +1,77 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterKeys(t *testing.T) {
+	schema := NewSchema()
+	schema.MetaKeys.Add("user")
+	lw := newImportLogWriter(t)
+	lw.schema = schema
+	require.NoError(t, lw.Init())
+
+	for _, line := range []string{
+		`{"level": "info", "user": "alice", "username": "alice", "reqid": "r1"}`,
+		`{"level": "info", "username": "bob", "reqid": "r2"}`,
+		`{"level": "info", "user_name": "carol"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	keys, err := lw.ListKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []KeyUsage{
+		{Name: "reqid", Count: 2},
+		{Name: "user", MetaKey: true, ID: 0, Count: 1},
+		{Name: "user_name", Count: 1},
+		{Name: "username", Count: 2},
+	}, keys)
+
+	n, err := lw.RenameKey(ctx, "reqid", "request_id")
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), n)
+	_, err = lw.RenameKey(ctx, "user_name", "username")
+	var existsErr *KeyExistsError
+	assert.ErrorAs(t, err, &existsErr)
+	_, err = lw.RenameKey(ctx, "missing", "other")
+	var unknownErr *UnknownKeyError
+	assert.ErrorAs(t, err, &unknownErr)
+	_, err = lw.RenameKey(ctx, "user", "login")
+	require.NoError(t, err)
+	_, ok := lw.schema.MetaKeys.Get("login")
+	assert.True(t, ok)
+
+	// the first entry keeps its login value
+	n, err = lw.MergeKeys(ctx, "username", "login")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+	n, err = lw.MergeKeys(ctx, "user_name", "login")
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	keys, err = lw.ListKeys(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []KeyUsage{
+		{Name: "login", MetaKey: true, ID: 0, Count: 3},
+		{Name: "request_id", Count: 2},
+	}, keys)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, map[string]interface{}{"login": "alice", "request_id": "r1"}, entries[0].Meta)
+	assert.Equal(t, "bob", entries[1].Meta["login"])
+	assert.Equal(t, "carol", entries[2].Meta["login"])
+
+	// merging a meta key into an ad-hoc key removes the meta key
+	_, err = lw.MergeKeys(ctx, "login", "request_id")
+	require.NoError(t, err)
+	_, ok = lw.schema.MetaKeys.Get("login")
+	assert.False(t, ok)
+}
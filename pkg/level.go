@@ -0,0 +1,162 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"strings"
+)
+
+// levels lists the zerolog levels, whose numeric value gives their ordering
+// in the level_enum table.
+var levels = []zerolog.Level{
+	zerolog.TraceLevel,
+	zerolog.DebugLevel,
+	zerolog.InfoLevel,
+	zerolog.WarnLevel,
+	zerolog.ErrorLevel,
+	zerolog.FatalLevel,
+	zerolog.PanicLevel,
+}
+
+// createLevelEnumTable stores the ordering of levels, so that level ranges
+// can be queried in SQL.
+func (l *LogWriter) createLevelEnumTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("level_enum").
+		IfNotExists().
+		Define("level", "VARCHAR(255)", "PRIMARY KEY").
+		Define("seq", "INTEGER", "NOT NULL")
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
+		return err
+	}
+
+	q := sqlbuilder.NewInsertBuilder()
+	q.InsertInto("level_enum").
+		Cols("level", "seq")
+	for _, level := range levels {
+		q.Values(level.String(), int(level))
+	}
+	q.SQL("ON CONFLICT (level) DO NOTHING")
+	s, args := q.Build()
+	if _, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// minLevelCondition matches entries whose level is at least as severe as
+// level. Levels are compared case-insensitively, and entries with unknown
+// levels never match.
+func minLevelCondition(q *sqlbuilder.SelectBuilder, level string) string {
+	return levelCondition(q, ">=", level)
+}
+
+// levelCondition compares the severity of the entries' level to level, op
+// being one of <, <=, > and >=.
+func levelCondition(q *sqlbuilder.SelectBuilder, op string, level string) string {
+	seq := sqlbuilder.Select("seq").From("level_enum")
+	seq.Where("level = LOWER(" + seq.Var(level) + ")")
+
+	sb := sqlbuilder.Select("level").From("level_enum")
+	sb.Where("seq " + op + " (" + sb.Var(seq) + ")")
+
+	return q.In("LOWER(level)", sb)
+}
+
+// LevelMapping maps the levels written by other loggers, lowercased, to the
+// levels stored in the database, see WithLevelNormalization.
+type LevelMapping map[string]string
+
+// DefaultLevelMapping maps common spellings of levels and the numeric syslog
+// severities to zerolog levels.
+var DefaultLevelMapping = LevelMapping{
+	"trc":           "trace",
+	"dbg":           "debug",
+	"information":   "info",
+	"informational": "info",
+	"inf":           "info",
+	"notice":        "info",
+	"warning":       "warn",
+	"wrn":           "warn",
+	"err":           "error",
+	"eror":          "error",
+	"crit":          "fatal",
+	"critical":      "fatal",
+	"alert":         "fatal",
+	"emerg":         "panic",
+	"emergency":     "panic",
+	// syslog severities
+	"0": "panic",
+	"1": "fatal",
+	"2": "fatal",
+	"3": "error",
+	"4": "warn",
+	"5": "info",
+	"6": "info",
+	"7": "debug",
+}
+
+// ParseLevelMapping parses from=to pairs, such as WARNING=warn.
+func ParseLevelMapping(pairs []string) (LevelMapping, error) {
+	ret := LevelMapping{}
+	for _, pair := range pairs {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || from == "" || to == "" {
+			return nil, errors.Errorf("invalid level mapping %q, expected from=to", pair)
+		}
+		ret[strings.ToLower(from)] = to
+	}
+	return ret, nil
+}
+
+// WithLevelNormalization rewrites the levels of the written and imported
+// entries before the middlewares see them, so that level filters match
+// entries whatever logger wrote them. Levels are lowercased and looked up in
+// mapping, then in DefaultLevelMapping; unknown levels are only lowercased.
+func WithLevelNormalization(mapping LevelMapping) LogWriterOption {
+	return func(l *LogWriter) {
+		l.levelMapping = LevelMapping{}
+		for from, to := range DefaultLevelMapping {
+			l.levelMapping[from] = to
+		}
+		for from, to := range mapping {
+			l.levelMapping[strings.ToLower(from)] = to
+		}
+	}
+}
+
+// NormalizeLevel returns the level stored for level according to mapping,
+// see WithLevelNormalization. level can be a string or a number.
+func (mapping LevelMapping) NormalizeLevel(level interface{}) interface{} {
+	var s string
+	switch v := level.(type) {
+	case string:
+		s = v
+	case json.Number:
+		s = v.String()
+	case int64, int, float64:
+		s = fmt.Sprint(v)
+	default:
+		return level
+	}
+	s = strings.ToLower(strings.TrimSpace(s))
+	if to, ok := mapping[s]; ok {
+		return to
+	}
+	return s
+}
+
+// normalizeEntryLevel normalizes the level of entry, if enabled.
+func (l *LogWriter) normalizeEntryLevel(entry map[string]interface{}) {
+	if l.levelMapping == nil {
+		return
+	}
+	if v, ok := entry["level"]; ok {
+		entry["level"] = l.levelMapping.NormalizeLevel(v)
+	}
+}
@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLevelNormalization(t *testing.T) {
+	lw := newImportLogWriter(t, WithLevelNormalization(LevelMapping{"SEVERE": "error"}))
+
+	for _, line := range []string{
+		`{"level": "WARNING", "message": "warning"}`,
+		`{"level": "ERR", "message": "err"}`,
+		`{"level": 3, "message": "syslog"}`,
+		`{"level": "severe", "message": "custom"}`,
+		`{"level": "Verbose", "message": "unknown"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	_, err := lw.Import(bytes.NewBufferString(`{"severity": "Critical", "message": "imported"}`),
+		WithImportLevelField("severity"))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithOrderBy("id", Asc)))
+	require.NoError(t, err)
+	levels := []string{}
+	for _, entry := range entries {
+		levels = append(levels, entry.Level)
+	}
+	assert.Equal(t, []string{"warn", "error", "error", "error", "verbose", "fatal"}, levels)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMinLevel("error")))
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestParseLevelMapping(t *testing.T) {
+	mapping, err := ParseLevelMapping([]string{"SEVERE=error", "fine=debug"})
+	require.NoError(t, err)
+	assert.Equal(t, LevelMapping{"severe": "error", "fine": "debug"}, mapping)
+
+	_, err = ParseLevelMapping([]string{"severe"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,193 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"sort"
+	"time"
+)
+
+// Common kinds of links between entries, see Link. Any other kind can be used.
+const (
+	LinkCauses  = "causes"
+	LinkRetries = "retries"
+	LinkRelates = "relates"
+)
+
+// EntryLink records that the entry FromID relates to the entry ToID, for
+// example that a request causes a retry which causes a failure.
+type EntryLink struct {
+	FromID    int       `db:"from_id" json:"from_id"`
+	ToID      int       `db:"to_id" json:"to_id"`
+	Kind      string    `db:"kind" json:"kind"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// EntryGraph is an entry along with the entries linked to it, see GetEntryGraph.
+type EntryGraph struct {
+	Root int `json:"root"`
+	// Entries are ordered by id and include the root.
+	Entries []*LogEntry  `json:"entries"`
+	Links   []*EntryLink `json:"links"`
+}
+
+func (l *LogWriter) createEntryLinksTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("entry_links").
+		IfNotExists().
+		Define("from_id", "INTEGER", "NOT NULL").
+		Define("to_id", "INTEGER", "NOT NULL").
+		Define("kind", "VARCHAR(64)", "NOT NULL").
+		Define("created_at", "TIMESTAMP", "NOT NULL").
+		Define("PRIMARY KEY (from_id, to_id, kind)")
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
+		return err
+	}
+	_, err := l.db.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS entry_links_to_id_idx ON entry_links (to_id)")
+	return err
+}
+
+// Link records that the entry fromID relates to the entry toID with the
+// given kind, such as LinkCauses. Linking the same entries with the same kind
+// twice has no effect. Links are deleted along with their entries.
+func (l *LogWriter) Link(fromID int, toID int, kind string) error {
+	return l.LinkContext(context.Background(), fromID, toID, kind)
+}
+
+func (l *LogWriter) LinkContext(ctx context.Context, fromID int, toID int, kind string) error {
+	if kind == "" {
+		return errors.New("links need a kind")
+	}
+	if fromID == toID {
+		return errors.Errorf("can't link entry %d to itself", fromID)
+	}
+	for _, id := range []int{fromID, toID} {
+		sb := sqlbuilder.Select("COUNT(*)").From("log_entries")
+		sb.Where(sb.E("id", id))
+		s, args := sb.Build()
+		var n int
+		if err := l.db.GetContext(ctx, &n, l.db.Rebind(s), args...); err != nil {
+			return err
+		}
+		if n == 0 {
+			return &UnknownEntryError{ID: id}
+		}
+	}
+
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("entry_links").
+		Cols("from_id", "to_id", "kind", "created_at").
+		Values(fromID, toID, kind, time.Now().UTC()).
+		SQL("ON CONFLICT (from_id, to_id, kind) DO NOTHING")
+	s, args := ib.Build()
+	return l.retryBusy(ctx, func() error {
+		_, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...)
+		return err
+	})
+}
+
+// Links returns the links from and to the entry with the given id.
+func (l *LogWriter) Links(ctx context.Context, id int) ([]*EntryLink, error) {
+	return l.linksOf(ctx, []interface{}{id})
+}
+
+func (l *LogWriter) linksOf(ctx context.Context, ids []interface{}) ([]*EntryLink, error) {
+	sb := sqlbuilder.Select("*").From("entry_links")
+	sb.Where(sb.Or(sb.In("from_id", ids...), sb.In("to_id", ids...))).
+		OrderBy("from_id", "to_id", "kind")
+	s, args := sb.Build()
+	ret := []*EntryLink{}
+	if err := l.db.SelectContext(ctx, &ret, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetEntryGraph returns the entry with the given id along with the entries
+// linked to it, following links in both directions up to depth links away,
+// or all the reachable entries if depth is 0.
+func (l *LogWriter) GetEntryGraph(ctx context.Context, id int, depth int) (*EntryGraph, error) {
+	if _, err := l.GetEntryContext(ctx, id); err != nil {
+		return nil, err
+	}
+
+	seen := map[int]bool{id: true}
+	links := map[EntryLink]*EntryLink{}
+	frontier := []interface{}{id}
+	for d := 0; len(frontier) > 0 && (depth <= 0 || d < depth); d++ {
+		found, err := l.linksOf(ctx, frontier)
+		if err != nil {
+			return nil, err
+		}
+		frontier = []interface{}{}
+		for _, link := range found {
+			links[EntryLink{FromID: link.FromID, ToID: link.ToID, Kind: link.Kind}] = link
+			for _, linked := range []int{link.FromID, link.ToID} {
+				if !seen[linked] {
+					seen[linked] = true
+					frontier = append(frontier, linked)
+				}
+			}
+		}
+	}
+
+	ids := []interface{}{}
+	for linked := range seen {
+		ids = append(ids, linked)
+	}
+	entries, err := l.getEntriesByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &EntryGraph{Root: id, Entries: entries, Links: []*EntryLink{}}
+	for _, link := range links {
+		ret.Links = append(ret.Links, link)
+	}
+	sort.Slice(ret.Links, func(i, j int) bool {
+		a, b := ret.Links[i], ret.Links[j]
+		if a.FromID != b.FromID {
+			return a.FromID < b.FromID
+		}
+		if a.ToID != b.ToID {
+			return a.ToID < b.ToID
+		}
+		return a.Kind < b.Kind
+	})
+	return ret, nil
+}
+
+// getEntriesByID returns the entries with the given ids and all their meta
+// values, ordered by id.
+func (l *LogWriter) getEntriesByID(ctx context.Context, ids []interface{}) ([]*LogEntry, error) {
+	sb := sqlbuilder.Select("*").From("log_entries")
+	sb.Where(sb.In("id", ids...)).OrderBy("id ASC")
+	s, args := sb.Build()
+	rows, err := l.db.QueryxContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	ret := []*LogEntry{}
+	entries := map[int]*LogEntry{}
+	for rows.Next() {
+		entry := &LogEntry{}
+		if err := rows.StructScan(entry); err != nil {
+			return nil, err
+		}
+		entries[entry.ID] = entry
+		ret = append(ret, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ret) == 0 {
+		return ret, nil
+	}
+	return ret, l.loadMeta(ctx, NewGetEntriesFilter(), entries, ids)
+}
@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestEntryLinks(t *testing.T) {
+	lw := newImportLogWriter(t)
+	ctx := context.Background()
+
+	for _, line := range []string{
+		`{"level":"info","message":"request"}`,
+		`{"level":"warn","message":"retry"}`,
+		`{"level":"error","message":"failure"}`,
+		`{"level":"info","message":"unrelated"}`,
+		`{"level":"info","message":"alert"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, lw.Link(1, 2, LinkCauses))
+	require.NoError(t, lw.Link(2, 3, LinkRetries))
+	require.NoError(t, lw.Link(2, 3, LinkRetries))
+	require.NoError(t, lw.Link(5, 3, LinkRelates))
+
+	var unknown *UnknownEntryError
+	assert.ErrorAs(t, lw.Link(1, 10, LinkCauses), &unknown)
+	assert.Error(t, lw.Link(1, 1, LinkCauses))
+	assert.Error(t, lw.Link(1, 2, ""))
+
+	links, err := lw.Links(ctx, 2)
+	require.NoError(t, err)
+	require.Len(t, links, 2)
+	assert.Equal(t, 1, links[0].FromID)
+	assert.Equal(t, LinkRetries, links[1].Kind)
+
+	graph, err := lw.GetEntryGraph(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"request", "retry", "failure", "alert"}, entryMessages(graph.Entries))
+	assert.Len(t, graph.Links, 3)
+
+	graph, err = lw.GetEntryGraph(ctx, 1, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"request", "retry"}, entryMessages(graph.Entries))
+	assert.Len(t, graph.Links, 1)
+
+	// deleting an entry deletes its links
+	_, err = lw.DeleteEntries(NewGetEntriesFilter(WithAfterID(1), WithLimit(1)))
+	require.NoError(t, err)
+	graph, err = lw.GetEntryGraph(ctx, 3, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"failure", "alert"}, entryMessages(graph.Entries))
+}
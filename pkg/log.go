@@ -1,6 +1,8 @@
 package pkg
 
 import (
+	"context"
+	"crypto/cipher"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -8,7 +10,7 @@ import (
 	"github.com/jmoiron/sqlx"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pkg/errors"
-	"sort"
+	"github.com/rs/zerolog"
 	"strings"
 	"time"
 )
@@ -21,6 +23,13 @@ const (
 	LogEntryTypeText
 	LogEntryTypeBlob
 	LogEntryTypeJSON
+	LogEntryTypeInt
+	// LogEntryTypeDuration values are stored in int_value as nanoseconds, see duration.go.
+	LogEntryTypeDuration
+	// LogEntryTypeTime values are stored in int_value as UNIX nanoseconds, see duration.go.
+	LogEntryTypeTime
+	// LogEntryTypeBool values are stored in int_value as 0 or 1.
+	LogEntryTypeBool
 )
 
 func (t LogEntryType) String() string {
@@ -33,10 +42,33 @@ func (t LogEntryType) String() string {
 		return "blob"
 	case LogEntryTypeJSON:
 		return "json"
+	case LogEntryTypeInt:
+		return "int"
+	case LogEntryTypeDuration:
+		return "duration"
+	case LogEntryTypeTime:
+		return "time"
+	case LogEntryTypeBool:
+		return "bool"
 	}
 	return "unknown"
 }
 
+// ValueColumn returns the log_entries_meta column values of type t are stored in.
+func (t LogEntryType) ValueColumn() string {
+	switch t {
+	case LogEntryTypeReal:
+		return "real_value"
+	case LogEntryTypeText:
+		return "text_value"
+	case LogEntryTypeBlob, LogEntryTypeJSON:
+		return "blob_value"
+	case LogEntryTypeInt, LogEntryTypeDuration, LogEntryTypeTime, LogEntryTypeBool:
+		return "int_value"
+	}
+	return "blob_value"
+}
+
 type Row struct {
 	Name string
 	Type LogEntryType
@@ -47,6 +79,12 @@ type Row struct {
 type MetaKey struct {
 	Name string
 	ID   int
+	// Wide is true if the key has columns in log_entries_wide, see WithWideTable.
+	Wide bool
+	// Type is the type of the values of the key. It is only enforced if
+	// TypeValidation is set, see AddTyped.
+	Type           LogEntryType
+	TypeValidation TypeValidation
 }
 
 // MetaKeys is a collection of MetaKey. It is used to quickly manage
@@ -127,6 +165,8 @@ func (m *MetaKeys) AddWithID(name string, id int) (*MetaKey, error) {
 // Schema is a set of MetaKeys
 type Schema struct {
 	MetaKeys *MetaKeys
+	// Fields are the definitions of the keys declared in a schema file, see LoadSchemaFromFile.
+	Fields []*FieldDefinition
 }
 
 func NewSchema() *Schema {
@@ -140,19 +180,161 @@ func NewSchema() *Schema {
 // It deserializes the JSON binaries handed over by zerolog, and decomposes
 // the message into the database schema specified at creation time.
 type LogWriter struct {
+	store Store
+	// db is the connection of store.
 	db *sqlx.DB
 
 	schema *Schema
+
+	// timestampFieldName is the zerolog field that gets stored in the date column.
+	timestampFieldName string
+	// timestampFormat is the format used to parse the timestamp field.
+	timestampFormat string
+	// durationUnit is the unit of the numbers stored for duration keys, see WithDurationUnit.
+	durationUnit time.Duration
+	// messageFieldName is the zerolog field that gets stored in the message column.
+	messageFieldName string
+	// traceIDFieldName and spanIDFieldName are the zerolog fields that get
+	// stored in the trace_id and span_id columns, see WithTraceFieldNames.
+	traceIDFieldName string
+	spanIDFieldName  string
+	// groupKey is the field that gets stored in the group_id column, see WithGroupKey.
+	groupKey string
+
+	// followInterval is how often Follow polls the database for new entries.
+	followInterval time.Duration
+
+	// session is used for entries that don't specify a session themselves.
+	session string
+
+	// fullTextSearch keeps the log_entries_fts index up to date, see search.go.
+	fullTextSearch bool
+
+	// wideTable stores the values of the schema's meta keys in log_entries_wide, see wide.go.
+	wideTable bool
+
+	// busyRetries and busyBackoff configure retrying writes on SQLITE_BUSY, see concurrent.go.
+	busyRetries int
+	busyBackoff time.Duration
+
+	// parser decodes the entries handed to Write, see WithLineParser.
+	parser LineParser
+
+	// schemaReconciliation decides how Init handles conflicting meta keys.
+	schemaReconciliation SchemaReconciliation
+
+	// middlewares are chained in front of writeEntry, see WithMiddleware.
+	middlewares []Middleware
+	// metrics are rolled up from the inserted entries, see WithMetrics.
+	metrics []MetricDefinition
+
+	// levelMapping normalizes the levels of the entries, see WithLevelNormalization.
+	levelMapping LevelMapping
+
+	// blobDir and blobThreshold configure offloading large values, see blob.go.
+	blobDir       string
+	blobThreshold int
+
+	// compression and compressionThreshold configure compressing large values, see compress.go.
+	compression          Compression
+	compressionThreshold int
+
+	// cipher encrypts and decrypts values, see encrypt.go.
+	cipher cipher.AEAD
+	// nonceKey derives the nonces of the fingerprints, see encryptFingerprint.
+	nonceKey []byte
+	// fieldCipher encrypts the values of encryptedKeys, see WithEncryptedKeys.
+	fieldCipher   cipher.AEAD
+	encryptedKeys map[string]bool
+
+	// onError and deadLetter handle the payloads Write fails to store, see deadletter.go.
+	onError    ErrorHandler
+	deadLetter *deadLetterFile
+
+	// encoders convert meta values before they get stored, see WithEncoders.
+	encoders *Encoders
+
+	// explodeArrays stores the elements of array values as separate rows, see WithArrayExplosion.
+	explodeArrays bool
+
+	// flattenObjects, flattenDepth and keepFlattenedObjects store nested
+	// objects as dotted keys, see WithObjectFlattening.
+	flattenObjects       bool
+	flattenDepth         int
+	keepFlattenedObjects bool
+
+	// stopWatchingLevel stops the WatchLevel loop started by InitLogging.
+	stopWatchingLevel context.CancelFunc
+}
+
+type LogWriterOption func(*LogWriter)
+
+func WithTimestampFieldName(name string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.timestampFieldName = name
+	}
+}
+
+func WithTimestampFormat(format string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.timestampFormat = format
+	}
+}
+
+func WithMessageFieldName(name string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.messageFieldName = name
+	}
+}
+
+func WithFollowInterval(interval time.Duration) LogWriterOption {
+	return func(l *LogWriter) {
+		l.followInterval = interval
+	}
 }
 
-func NewLogWriter(db *sqlx.DB, schema *Schema) *LogWriter {
-	return &LogWriter{
-		db:     db,
-		schema: schema,
+// WithDefaultSession sets the session stored for entries that don't have a session field.
+func WithDefaultSession(session string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.session = session
 	}
 }
 
+// NewLogWriter creates a LogWriter writing to db, using the Store matching the
+// driver db was opened with.
+func NewLogWriter(db *sqlx.DB, schema *Schema, opts ...LogWriterOption) *LogWriter {
+	return NewLogWriterWithStore(NewStore(db), schema, opts...)
+}
+
+func NewLogWriterWithStore(store Store, schema *Schema, opts ...LogWriterOption) *LogWriter {
+	l := &LogWriter{
+		store:              store,
+		db:                 store.DB(),
+		schema:             schema,
+		timestampFieldName: zerolog.TimestampFieldName,
+		timestampFormat:    zerolog.TimeFieldFormat,
+		durationUnit:       zerolog.DurationFieldUnit,
+		messageFieldName:   zerolog.MessageFieldName,
+		traceIDFieldName:   DefaultTraceIDFieldName,
+		spanIDFieldName:    DefaultSpanIDFieldName,
+		followInterval:     500 * time.Millisecond,
+		parser:             JSONLineParser,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Sessions returns a SessionManager for the database the LogWriter writes to.
+func (l *LogWriter) Sessions() *SessionManager {
+	return NewSessionManager(l.db)
+}
+
 func (l *LogWriter) Close() error {
+	if l.stopWatchingLevel != nil {
+		l.stopWatchingLevel()
+	}
 	if l.db != nil {
 		return l.db.Close()
 	} else {
@@ -167,25 +349,33 @@ func ToLogEntryType(v interface{}) LogEntryType {
 	case float64:
 		return LogEntryTypeReal
 	case int:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case int8:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case int16:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case int32:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case int64:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case uint:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case uint8:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case uint16:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case uint32:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
 	case uint64:
-		return LogEntryTypeReal
+		return LogEntryTypeInt
+	case json.Number:
+		return ToLogEntryType(normalizeNumber(v.(json.Number)))
+	case time.Duration:
+		return LogEntryTypeDuration
+	case time.Time:
+		return LogEntryTypeTime
+	case bool:
+		return LogEntryTypeBool
 
 	case string:
 		return LogEntryTypeText
@@ -198,92 +388,280 @@ func ToLogEntryType(v interface{}) LogEntryType {
 }
 
 func (l *LogWriter) Write(p []byte) (int, error) {
-	var log map[string]interface{}
-	if err := json.Unmarshal(p, &log); err != nil {
+	return l.WriteContext(context.Background(), p)
+}
+
+// WriteContext parses and stores a log entry, aborting if ctx is done before
+// the entry is committed.
+func (l *LogWriter) WriteContext(ctx context.Context, p []byte) (int, error) {
+	if err := l.write(ctx, p); err != nil {
+		l.handleWriteError(err, p)
 		return 0, err
 	}
+	return len(p), nil
+}
 
-	tx, err := l.db.Beginx()
+func (l *LogWriter) write(ctx context.Context, p []byte) error {
+	log, err := l.parser.ParseLine(p)
 	if err != nil {
-		return 0, err
+		return &InvalidEntryError{Err: err}
 	}
-	defer func() {
+	l.normalizeEntryLevel(log)
+
+	handler := chainMiddlewares(func(entry map[string]interface{}) error {
+		return l.writeEntry(ctx, entry)
+	}, l.middlewares...)
+	return handler(log)
+}
+
+// writeEntry is the last EntryHandler of the middleware chain, and persists
+// the entry to the database.
+func (l *LogWriter) writeEntry(ctx context.Context, log map[string]interface{}) error {
+	return l.retryBusy(ctx, func() error {
+		tx, err := l.db.BeginTxx(ctx, nil)
 		if err != nil {
-			err = tx.Rollback()
-			return
+			return err
+		}
+
+		if err := l.insertEntry(ctx, tx, log); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+
+		return tx.Commit()
+	})
+}
+
+// insertEntry inserts the entry along with its meta values as part of tx.
+// The caller is responsible for rolling back tx on error.
+func (l *LogWriter) insertEntry(ctx context.Context, tx *sqlx.Tx, log map[string]interface{}) error {
+	skippedKeys := map[string]bool{
+		"level":   true,
+		"session": true,
+	}
+
+	// Use the timestamp provided by zerolog if we can parse it, else fall back
+	// to the time of insertion and keep the original value as meta.
+	date := time.Now().UTC()
+	if v, ok := log[l.timestampFieldName]; ok {
+		if t, err := parseTimestamp(v, l.timestampFormat); err == nil {
+			date = t
+			skippedKeys[l.timestampFieldName] = true
 		}
-		err = tx.Commit()
-	}()
+	}
+
+	session := log["session"]
+	if session == nil && l.session != "" {
+		session = l.session
+	}
+
+	var message sql.NullString
+	if v, ok := log[l.messageFieldName].(string); ok {
+		message = sql.NullString{String: v, Valid: true}
+		skippedKeys[l.messageFieldName] = true
+	}
+
+	caller, ok := parseCaller(log[zerolog.CallerFieldName])
+	if ok {
+		skippedKeys[zerolog.CallerFieldName] = true
+	}
+	errorValue, ok := parseError(log)
+	if ok {
+		skippedKeys[zerolog.ErrorFieldName] = true
+	}
+	trace := l.parseTrace(log, skippedKeys)
+	group := l.parseGroup(log, skippedKeys)
+	sampledDropped := parseSampledDropped(log, skippedKeys)
+	decodeStack(log)
+
+	meta := map[string]interface{}{}
+	for k, v := range log {
+		if !skippedKeys[k] {
+			meta[k] = v
+		}
+	}
+	l.flattenMeta(meta)
+	if err := l.encodeMeta(meta); err != nil {
+		return err
+	}
+
+	if err := l.recordSpan(ctx, tx, log, date, session); err != nil {
+		return err
+	}
+	err := l.insertParsedEntry(ctx, tx, date, log["level"], session, group, sampledDropped, message, caller, errorValue, trace, meta)
+	if err != nil {
+		return err
+	}
+	return l.recordMetrics(ctx, tx, log, date)
+}
+
+// insertParsedEntry is insertEntry once the columns of log_entries have been
+// extracted from the entry.
+func (l *LogWriter) insertParsedEntry(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	date time.Time,
+	level interface{},
+	session interface{},
+	group sql.NullString,
+	sampledDropped sql.NullInt64,
+	message sql.NullString,
+	caller entryCaller,
+	errorValue entryError,
+	trace entryTrace,
+	meta map[string]interface{},
+) error {
+	if err := l.checkMetaTypes(meta); err != nil {
+		return err
+	}
+	columns, err := l.encryptColumns(message, errorValue)
+	if err != nil {
+		return err
+	}
 
 	// Insert the log entry
 	logEntryID := 0
 	q := sqlbuilder.NewInsertBuilder()
 	q.InsertInto("log_entries").
-		Cols("date", "level", "session").
-		Values(time.Now().UTC(), log["level"], log["session"]).
+		Cols("date", "level", "session", "group_id", "sampled_dropped", "message", "fingerprint", "caller_file", "caller_line",
+			"error_message", "error_chain", "trace_id", "span_id").
+		Values(date, level, session, group, sampledDropped, columns.message, columns.fingerprint, caller.File, caller.Line,
+			columns.err.Message, columns.err.Chain, trace.TraceID, trace.SpanID).
 		SQL("RETURNING id")
 	s, args := q.Build()
-	if err := tx.QueryRowx(s, args...).Scan(&logEntryID); err != nil {
-		return 0, err
+	if err := tx.QueryRowxContext(ctx, tx.Rebind(s), args...).Scan(&logEntryID); err != nil {
+		return err
 	}
 
-	// Serialize the log data as log entries meta
-	for k, v := range log {
-		if k == "level" || k == "session" {
-			continue
-		}
+	// Text that gets indexed for full-text search, encrypted text is left out
+	searchContent := []string{}
+	if message.Valid && l.cipher == nil {
+		searchContent = append(searchContent, message.String)
+	}
+	if errorValue.Message.Valid && l.cipher == nil {
+		searchContent = append(searchContent, errorValue.Message.String)
+	}
 
-		var intValue sql.NullInt64
-		var realValue sql.NullFloat64
-		var textValue, blobValue sql.NullString
-		var typeValue LogEntryType
+	// Values of wide meta keys are stored in a single log_entries_wide row
+	wideValues := map[*MetaKey]*metaValue{}
+
+	// Serialize the log data as log entries meta
+	for k, v := range meta {
 		var name sql.NullString
 		var meta_key_id sql.NullInt32
 
-		switch v := v.(type) {
-		case float64:
-			realValue = sql.NullFloat64{Float64: v, Valid: true}
-			typeValue = LogEntryTypeReal
-		case []byte:
-			blobValue = sql.NullString{String: string(v), Valid: true}
-			typeValue = LogEntryTypeBlob
-		case string:
-			textValue = sql.NullString{String: v, Valid: true}
-			typeValue = LogEntryTypeText
-		default:
-			b, err := json.Marshal(v)
-			if err != nil {
-				return 0, err
-			}
-			blobValue = sql.NullString{String: string(b), Valid: true}
-			typeValue = LogEntryTypeJSON
-		}
-
-		if metaKey, ok := l.schema.MetaKeys.Get(k); ok {
+		metaKey, isMetaKey := l.schema.MetaKeys.Get(k)
+		wide := isMetaKey && l.wideTable && metaKey.Wide
+		encryptedField := !wide && l.encryptedKeys[k]
+		if isMetaKey {
 			meta_key_id = sql.NullInt32{Int32: int32(metaKey.ID), Valid: true}
 		} else {
 			name = sql.NullString{String: k, Valid: true}
 		}
 
+		// exploded arrays get a row per element, see WithArrayExplosion
+		elements, exploded := l.explodeArray(v, wide)
+		for i, element := range elements {
+			value, err := toMetaValue(element)
+			if err != nil {
+				return err
+			}
+
+			// encrypted values are left out of the index, which would reveal them
+			indexed := wide || (l.cipher == nil && !encryptedField)
+			if value.Text.Valid && indexed {
+				searchContent = append(searchContent, value.Text.String)
+			} else if value.Blob.Valid && indexed {
+				searchContent = append(searchContent, value.Blob.String)
+			}
+
+			// the wide table has no compression column, and its values are stored in clear
+			if !wide {
+				if err := l.compressBlob(value); err != nil {
+					return err
+				}
+				if encryptedField {
+					err = l.encryptField(value)
+				} else {
+					err = l.encryptMetaValue(value)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if err := l.offloadBlob(value); err != nil {
+				return err
+			}
+
+			if wide {
+				wideValues[metaKey] = value
+				continue
+			}
+
+			var arrayIndex sql.NullInt64
+			if exploded {
+				arrayIndex = sql.NullInt64{Int64: int64(i), Valid: true}
+			}
+			q := sqlbuilder.NewInsertBuilder()
+			q.InsertInto("log_entries_meta").
+				Cols("log_entry_id", "type", "name", "meta_key_id", "int_value", "real_value", "text_value", "blob_value", "compression",
+					"array_index").
+				Values(logEntryID, value.Type, name, meta_key_id, value.Int, value.Real, value.Text, value.blobArg(), value.Compression,
+					arrayIndex)
+			s, args := q.Build()
+			if _, err := tx.ExecContext(ctx, tx.Rebind(s), args...); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := l.insertWideValues(ctx, tx, logEntryID, wideValues); err != nil {
+		return err
+	}
+
+	if l.fullTextSearch {
 		q := sqlbuilder.NewInsertBuilder()
-		q.InsertInto("log_entries_meta").
-			Cols("log_entry_id", "type", "name", "meta_key_id", "int_value", "real_value", "text_value", "blob_value").
-			Values(logEntryID, typeValue, name, meta_key_id, intValue, realValue, textValue, blobValue)
+		q.InsertInto("log_entries_fts").
+			Cols("rowid", "content").
+			Values(logEntryID, strings.Join(searchContent, " "))
 		s, args := q.Build()
-		if _, err := tx.Exec(s, args...); err != nil {
-			return 0, err
+		if _, err := tx.ExecContext(ctx, tx.Rebind(s), args...); err != nil {
+			return err
 		}
 	}
 
-	return len(p), nil
+	return nil
 }
 
 type LogEntry struct {
-	ID      int       `db:"id"`
-	Date    time.Time `db:"date"`
-	Level   string    `db:"level"`
-	Session *string   `db:"session"`
-	Meta    map[string]interface{}
+	ID      int       `db:"id" json:"id"`
+	Date    time.Time `db:"date" json:"date"`
+	Level   string    `db:"level" json:"level"`
+	Session *string   `db:"session" json:"session,omitempty"`
+	// Group is the value of the grouping key of the entry, see WithGroupKey.
+	Group *string `db:"group_id" json:"group,omitempty"`
+	// SampledDropped is the number of entries dropped by sampling before
+	// the entry, see SampledDroppedKey.
+	SampledDropped *int64                 `db:"sampled_dropped" json:"sampled_dropped,omitempty"`
+	Message        *string                `db:"message" json:"message,omitempty"`
+	Meta           map[string]interface{} `json:"meta,omitempty"`
+	// Fingerprint is the message with its numbers, UUIDs and hex strings
+	// replaced by placeholders, see Fingerprint.
+	Fingerprint *string `db:"fingerprint" json:"fingerprint,omitempty"`
+	// CallerFile and CallerLine are parsed from the zerolog caller field, see Caller.
+	CallerFile *string `db:"caller_file" json:"caller_file,omitempty"`
+	CallerLine *int    `db:"caller_line" json:"caller_line,omitempty"`
+	// Error is the zerolog error field, ErrorChain the errors it wraps if
+	// they could be recovered, see ErrorChain.
+	Error      *string    `db:"error_message" json:"error,omitempty"`
+	ErrorChain ErrorChain `db:"error_chain" json:"error_chain,omitempty"`
+	// TraceID and SpanID correlate the entry with a trace, see GetTrace.
+	TraceID *string `db:"trace_id" json:"trace_id,omitempty"`
+	SpanID  *string `db:"span_id" json:"span_id,omitempty"`
+	// Source is the database the entry was read from, set by MultiReader.
+	Source string `db:"-" json:"source,omitempty"`
+	// Context is set on the entries returned around the matching entries, see WithContext.
+	Context bool `db:"-" json:"context,omitempty"`
 }
 
 type LogEntryMeta struct {
@@ -297,26 +675,80 @@ type LogEntryMeta struct {
 	TextValue  *string      `db:"text_value"`
 	BlobValue  *[]byte      `db:"blob_value"`
 	MetaKey    *string      `db:"meta_key"`
+	// Compression is the algorithm BlobValue is compressed with, if any.
+	Compression *string `db:"compression"`
+	// ArrayIndex is the position of the value in its array, if the array was
+	// exploded, see WithArrayExplosion.
+	ArrayIndex *int `db:"array_index"`
+	// BlobDir is where offloaded values are read from, see WithBlobOffloading.
+	BlobDir string `db:"-"`
+	// Cipher decrypts encrypted values, see WithEncryption.
+	Cipher cipher.AEAD `db:"-"`
+	// FieldCipher decrypts the values of encrypted keys, see WithEncryptedKeys.
+	FieldCipher cipher.AEAD `db:"-"`
 }
 
+// Value returns the value of the row, or RedactedValue for the values of
+// encrypted keys if their key isn't configured, see WithEncryptedKeys.
 func (lem *LogEntryMeta) Value() (interface{}, error) {
+	// the values of encrypted keys are decrypted in a copy
+	m := *lem
+	v, err := m.value()
+	if errors.Is(err, errMissingFieldKey) {
+		return RedactedValue, nil
+	}
+	return v, err
+}
+
+func (lem *LogEntryMeta) value() (interface{}, error) {
+	if err := lem.decryptFieldValue(); err != nil {
+		return nil, err
+	}
 	switch lem.Type {
+	case LogEntryTypeInt:
+		if lem.IntValue == nil {
+			return nil, errors.New("int value is nil")
+		}
+		return *lem.IntValue, nil
 	case LogEntryTypeReal:
 		if lem.RealValue == nil {
 			return nil, errors.New("real value is nil")
 		}
 		return *lem.RealValue, nil
+	case LogEntryTypeDuration:
+		if lem.IntValue == nil {
+			return nil, errors.New("duration value is nil")
+		}
+		return time.Duration(*lem.IntValue), nil
+	case LogEntryTypeTime:
+		if lem.IntValue == nil {
+			return nil, errors.New("time value is nil")
+		}
+		return time.Unix(0, *lem.IntValue).UTC(), nil
+	case LogEntryTypeBool:
+		if lem.IntValue == nil {
+			return nil, errors.New("bool value is nil")
+		}
+		return *lem.IntValue != 0, nil
 	case LogEntryTypeText:
 		if lem.TextValue == nil {
 			return nil, errors.New("text value is nil")
 		}
-		return *lem.TextValue, nil
+		b, err := decryptValue(lem.Cipher, []byte(*lem.TextValue))
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
 	case LogEntryTypeJSON:
 		if lem.BlobValue == nil {
 			return nil, errors.New("blob value is nil")
 		}
+		b, err := lem.blob()
+		if err != nil {
+			return nil, err
+		}
 		var v interface{}
-		if err := json.Unmarshal(*lem.BlobValue, &v); err != nil {
+		if err := json.Unmarshal(b, &v); err != nil {
 			return nil, err
 		}
 		return v, nil
@@ -324,35 +756,125 @@ func (lem *LogEntryMeta) Value() (interface{}, error) {
 		if lem.BlobValue == nil {
 			return nil, errors.New("blob value is nil")
 		}
-		return *lem.BlobValue, nil
+		return lem.blob()
 	default:
 		return nil, errors.New("unknown type")
 	}
 }
 
+// blob returns BlobValue, read back from the blob directory if it was
+// offloaded, decrypted and decompressed.
+func (lem *LogEntryMeta) blob() ([]byte, error) {
+	b, err := readBlob(lem.BlobDir, *lem.BlobValue)
+	if err != nil {
+		return nil, err
+	}
+	b, err = decryptValue(lem.Cipher, b)
+	if err != nil {
+		return nil, err
+	}
+	b, err = decryptField(lem.FieldCipher, b)
+	if err != nil {
+		return nil, err
+	}
+	if lem.Compression == nil {
+		return b, nil
+	}
+	return decompress(Compression(*lem.Compression), b)
+}
+
 type GetEntriesFilter struct {
-	Level            string
-	Session          string
+	// AfterID only returns entries with an id strictly greater than AfterID.
+	AfterID int
+	Level   string
+	// Levels matches entries with any of the given levels.
+	Levels []string
+	// MinLevel matches entries with a level at least as severe as MinLevel,
+	// according to the level_enum table.
+	MinLevel string
+	Session  string
+	// SessionTree matches the entries of a session and its descendants, see WithSessionTree.
+	SessionTree string
+	// Group matches the entries of a group, see WithGroup.
+	Group            string
 	From             time.Time
 	To               time.Time
 	SelectedMetaKeys []string
 	MetaFilters      map[string]interface{}
+	// Search is matched against the full-text index, see WithSearch.
+	Search string
+	// Caller matches the file the entries were logged from, see WithCaller.
+	Caller string
+	// ErrorContains matches the error message of the entries, see WithErrorContains.
+	ErrorContains string
+	// TraceID matches the entries of a trace, see WithTraceID.
+	TraceID string
+	// Stream matches the entries captured from stdout or stderr, see WithStream.
+	Stream string
+	// MetaRanges match the entries whose meta values are within a range, see WithMetaBetween.
+	MetaRanges []MetaRange
+	// JSONPaths match values nested in JSON meta values, see WithJSONPath.
+	JSONPaths []JSONPathFilter
+
+	// OrderBy sorts the entries, by id if empty, see WithOrderBy.
+	OrderBy []OrderBy
+	// Last only returns the last Last entries written, see WithLast.
+	Last int
+	// ContextBefore and ContextAfter add the entries surrounding the
+	// matching entries, see WithContext.
+	ContextBefore int
+	ContextAfter  int
+
+	// Limit is the maximum number of entries returned, 0 meaning no limit.
+	Limit int
+	// Offset skips the first Offset matching entries.
+	Offset int
+	// Cursor is a token returned by GetEntriesPage, see WithCursor.
+	Cursor string
+	// Query is an expression in the query language, see ParseQuery.
+	Query string
 }
 
 type GetEntriesFilterOption func(*GetEntriesFilter)
 
+func WithAfterID(id int) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.AfterID = id
+	}
+}
+
 func WithLevel(level string) GetEntriesFilterOption {
 	return func(f *GetEntriesFilter) {
 		f.Level = level
 	}
 }
 
+func WithLevels(levels ...string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Levels = append(f.Levels, levels...)
+	}
+}
+
+func WithMinLevel(level string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.MinLevel = level
+	}
+}
+
 func WithSession(session string) GetEntriesFilterOption {
 	return func(f *GetEntriesFilter) {
 		f.Session = session
 	}
 }
 
+// WithSessionTree matches the entries of the session root and of all its
+// child sessions, recursively.
+func WithSessionTree(root string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.SessionTree = root
+	}
+}
+
 func WithFrom(from time.Time) GetEntriesFilterOption {
 	return func(f *GetEntriesFilter) {
 		f.From = from
@@ -394,67 +916,232 @@ func NewGetEntriesFilter(opts ...GetEntriesFilterOption) *GetEntriesFilter {
 }
 
 func (gef *GetEntriesFilter) Apply(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder) {
+	if gef.Last > 0 {
+		// the last entries are selected first, and then sorted by the caller
+		f := *gef
+		f.Last = 0
+		last := sqlbuilder.Select("id").From("log_entries")
+		f.Apply(metaKeys, last)
+		last.OrderBy("id DESC").Limit(gef.Last)
+		q.Where(q.In("id", last))
+		return
+	}
+	if gef.AfterID > 0 {
+		q.Where(q.G("id", gef.AfterID))
+	}
 	if gef.Level != "" {
 		q.Where(q.E("level", gef.Level))
 	}
+	if len(gef.Levels) > 0 {
+		levels := []interface{}{}
+		for _, level := range gef.Levels {
+			levels = append(levels, level)
+		}
+		q.Where(q.In("level", levels...))
+	}
+	if gef.MinLevel != "" {
+		q.Where(minLevelCondition(q, gef.MinLevel))
+	}
 	if gef.Session != "" {
 		q.Where(q.E("session", gef.Session))
 	}
+	if gef.SessionTree != "" {
+		q.Where(sessionTreeCondition(&q.Cond, "session", gef.SessionTree))
+	}
+	if gef.Group != "" {
+		q.Where(q.E("group_id", gef.Group))
+	}
+	// dates are bound as time.Time so that they get serialized the same way
+	// they were stored by the sqlite driver.
 	if !gef.From.IsZero() {
-		q.Where(q.GE("date", gef.From.Format(time.RFC3339)))
+		q.Where(q.GE("date", gef.From.UTC()))
 	}
 	if !gef.To.IsZero() {
-		q.Where(q.LE("date", gef.To.Format(time.RFC3339)))
-	}
-	if len(gef.SelectedMetaKeys) > 0 {
-		stringKeys := []string{}
-		intKeys := []int{}
-		for _, k := range gef.SelectedMetaKeys {
-			v, ok := metaKeys.Get(k)
-			if !ok {
-				stringKeys = append(stringKeys, k)
-			} else {
-				intKeys = append(intKeys, v.ID)
-			}
-		}
-		exprs := []string{}
-		for _, k := range stringKeys {
-			exprs = append(exprs, q.In("mk.name", k))
+		q.Where(q.LE("date", gef.To.UTC()))
+	}
+
+	if gef.Search != "" {
+		q.Where(searchCondition(q, gef.Search))
+	}
+	if gef.Caller != "" {
+		q.Where(callerCondition(&q.Cond, gef.Caller))
+	}
+	if gef.ErrorContains != "" {
+		q.Where(errorCondition(&q.Cond, gef.ErrorContains))
+	}
+	if gef.TraceID != "" {
+		q.Where(q.E("trace_id", gef.TraceID))
+	}
+
+	gef.applyPagination(q)
+
+	if gef.Stream != "" {
+		q.Where(streamCondition(metaKeys, q, gef.Stream))
+	}
+	for k, v := range gef.MetaFilters {
+		q.Where(metaCondition(metaKeys, q, k, "=", v))
+	}
+	for _, r := range gef.MetaRanges {
+		if r.From != nil {
+			q.Where(metaCondition(metaKeys, q, r.Key, ">=", r.From))
 		}
-		for _, k := range intKeys {
-			exprs = append(exprs, q.In("mk.meta_key_id", k))
+		if r.To != nil {
+			q.Where(metaCondition(metaKeys, q, r.Key, "<=", r.To))
 		}
-		if len(exprs) > 0 {
-			q.Where(q.Or(exprs...))
+	}
+	for _, f := range gef.JSONPaths {
+		q.Where(jsonPathCondition(metaKeys, q, f))
+	}
+
+	if gef.Query != "" {
+		expr, err := ParseQuery(gef.Query)
+		if err != nil {
+			// see Validate
+			q.Where("1 = 0")
+			return
 		}
+		q.Where(expr.condition(metaKeys, q))
 	}
+}
 
-	if len(gef.MetaFilters) > 0 {
-		for k, v := range gef.MetaFilters {
-			v_, ok := metaKeys.Get(k)
-			entryType := ToLogEntryType(v)
-			fieldName := entryType.String() + "_value"
-			exprs := []string{}
-			exprs = append(exprs, q.And(q.E("mk.name", k), q.E(fmt.Sprintf("lem.%s", fieldName), v)))
-			if ok {
-				exprs = append(exprs, q.And(q.E("mk.meta_key_id", v_.ID), q.E(fmt.Sprintf("lem.%s", fieldName), v)))
+// metaCondition matches the entries whose value for the meta key k compares
+// to v with op, see compareCondition.
+func metaCondition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder, k string, op string, v interface{}) string {
+	if n, ok := v.(json.Number); ok {
+		v = normalizeNumber(n)
+	}
+	if metaKey, ok := metaKeys.Get(k); ok {
+		v = parseFilterTimeValue(metaKey.Type, v)
+	}
+	sb := sqlbuilder.Select("lem.log_entry_id").From("log_entries_meta lem")
+	entryType := ToLogEntryType(v)
+	// blob values are stored as text, see Write
+	value := v
+	switch v_ := v.(type) {
+	case []byte:
+		value = string(v_)
+	case time.Duration:
+		value = int64(v_)
+	case time.Time:
+		value = v_.UnixNano()
+	case bool:
+		value = boolToInt(v_)
+	default:
+		if entryType == LogEntryTypeJSON {
+			if b, err := json.Marshal(v); err == nil {
+				value = string(b)
 			}
-			q.Where(q.Or(exprs...))
 		}
 	}
+	column := fmt.Sprintf("lem.%s", entryType.ValueColumn())
+	if entryType == LogEntryTypeInt || entryType == LogEntryTypeReal {
+		// integers and reals compare equal in sqlite, so 42 matches 42.0
+		column = "COALESCE(lem.int_value, lem.real_value)"
+	}
+	if op == "~" || op == "!~" {
+		column = "lem.text_value"
+		value = fmt.Sprint(v)
+	}
+	sb.Where(
+		metaKeyCondition(metaKeys, k),
+		compareCondition(&sb.Cond, column, op, value),
+	)
+	if metaKey, ok := metaKeys.Get(k); ok && metaKey.Wide {
+		// older entries may still store the key in log_entries_meta
+		wsb := sqlbuilder.Select("lem.log_entry_id").From(wideTable + " lem")
+		wsb.Where(compareCondition(&wsb.Cond, wideExpression(metaKey, column), op, value))
+		return q.Or(q.In("id", sb), q.In("id", wsb))
+	}
+	return q.In("id", sb)
+}
+
+// applyMetaSelection restricts the meta query to the SelectedMetaKeys, if any.
+func (gef *GetEntriesFilter) applyMetaSelection(metaKeys *MetaKeys, sb *sqlbuilder.SelectBuilder) {
+	if len(gef.SelectedMetaKeys) == 0 {
+		return
+	}
+
+	exprs := []string{}
+	for _, k := range gef.SelectedMetaKeys {
+		exprs = append(exprs, metaKeyCondition(metaKeys, k))
+	}
+	sb.Where(sb.Or(exprs...))
+}
+
+// metaKeyCondition matches the meta rows for key, whether the key was stored
+// by name or through its registered MetaKey.
+func metaKeyCondition(metaKeys *MetaKeys, key string) string {
+	return metaKeyExpression(metaKeys, "lem.", key)
+}
+
+// metaKeyExpression is metaKeyCondition for columns prefixed with prefix.
+// The key is written literally rather than bound, so that the partial
+// indexes created by EnsureIndex, whose condition is the same expression,
+// can be used by the queries.
+func metaKeyExpression(metaKeys *MetaKeys, prefix string, key string) string {
+	exprs := []string{prefix + "name = " + sqlString(key)}
+	if metaKey, ok := metaKeys.Get(key); ok {
+		exprs = append(exprs, fmt.Sprintf("%smeta_key_id = %d", prefix, metaKey.ID))
+	}
+	return "(" + strings.Join(exprs, " OR ") + ")"
+}
+
+// sqlString quotes s as an SQL string literal.
+func sqlString(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+type UnknownEntryError struct {
+	ID int
+}
+
+func (e *UnknownEntryError) Error() string {
+	return fmt.Sprintf("unknown entry %d", e.ID)
+}
+
+func (l *LogWriter) GetEntry(id int) (*LogEntry, error) {
+	return l.GetEntryContext(context.Background(), id)
+}
+
+// GetEntryContext returns the entry with the given id along with all its meta
+// values, or an UnknownEntryError.
+func (l *LogWriter) GetEntryContext(ctx context.Context, id int) (*LogEntry, error) {
+	entries, err := l.GetEntriesContext(ctx, NewGetEntriesFilter(WithAfterID(id-1), WithLimit(1)))
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 || entries[0].ID != id {
+		return nil, &UnknownEntryError{ID: id}
+	}
+	return entries[0], nil
 }
 
 func (l *LogWriter) GetEntries(filter *GetEntriesFilter) ([]*LogEntry, error) {
+	return l.GetEntriesContext(context.Background(), filter)
+}
+
+// GetEntriesContext returns the entries matching filter, ordered by id.
+func (l *LogWriter) GetEntriesContext(ctx context.Context, filter *GetEntriesFilter) ([]*LogEntry, error) {
 	if filter == nil {
 		filter = NewGetEntriesFilter()
 	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	filter, err := filter.resolveCursor()
+	if err != nil {
+		return nil, err
+	}
+	filter = l.resolveGroupKey(filter)
 
 	entries := map[int]*LogEntry{}
-	q := sqlbuilder.Select("*").From("log_entries").OrderBy("id ASC")
+	q := sqlbuilder.Select("*").From("log_entries")
 	filter.Apply(l.schema.MetaKeys, q)
+	filter.applyOrder(l.schema.MetaKeys, q)
 	s2, args := q.Build()
 	s2 = l.db.Rebind(s2)
-	rows, err := l.db.Queryx(s2, args...)
+	rows, err := l.db.QueryxContext(ctx, s2, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -473,26 +1160,54 @@ func (l *LogWriter) GetEntries(filter *GetEntriesFilter) ([]*LogEntry, error) {
 		ids = append(ids, entry.ID)
 	}
 
+	if len(ids) == 0 {
+		return []*LogEntry{}, nil
+	}
+
+	if err := l.loadMeta(ctx, filter, entries, ids); err != nil {
+		return nil, err
+	}
+
+	// keep the order of the query
+	ret := []*LogEntry{}
+	for _, id := range ids {
+		ret = append(ret, entries[id.(int)])
+	}
+
+	return l.addContext(ctx, filter, ret)
+}
+
+// loadMeta reads the meta values of the entries with the given ids, restricted
+// to the meta keys selected by filter.
+func (l *LogWriter) loadMeta(ctx context.Context, filter *GetEntriesFilter, entries map[int]*LogEntry, ids []interface{}) error {
 	sb := sqlbuilder.Select("lem.*, mk.key AS meta_key").
 		From("log_entries_meta lem")
 
 	sb = sb.Where(sb.In("lem.log_entry_id", ids...)).
 		JoinWithOption(sqlbuilder.LeftJoin, "meta_keys mk", "mk.id = lem.meta_key_id")
+	filter.applyMetaSelection(l.schema.MetaKeys, sb)
 
 	s, args := sb.Build()
 	s = l.db.Rebind(s)
-	rows, err = l.db.Queryx(s, args...)
+	rows, err := l.db.QueryxContext(ctx, s, args...)
 	if err != nil {
-		return nil, err
+		return err
 	}
 	defer func(rows *sqlx.Rows) {
 		_ = rows.Close()
 	}(rows)
 
+	for _, entry := range entries {
+		if err := l.decryptColumns(entry); err != nil {
+			return err
+		}
+	}
+
+	arrays := explodedArrays{}
 	for rows.Next() {
-		meta := &LogEntryMeta{}
+		meta := &LogEntryMeta{BlobDir: l.blobDir, Cipher: l.cipher, FieldCipher: l.fieldCipher}
 		if err := rows.StructScan(meta); err != nil {
-			return nil, err
+			return err
 		}
 		entry, ok := entries[meta.LogEntryID]
 		if !ok {
@@ -504,10 +1219,7 @@ func (l *LogWriter) GetEntries(filter *GetEntriesFilter) ([]*LogEntry, error) {
 		}
 		v, err := meta.Value()
 		if err != nil {
-			return nil, err
-		}
-		if v == nil {
-			continue
+			return err
 		}
 		name := ""
 		if meta.Name != nil {
@@ -517,48 +1229,82 @@ func (l *LogWriter) GetEntries(filter *GetEntriesFilter) ([]*LogEntry, error) {
 		} else {
 			continue
 		}
+		if meta.ArrayIndex != nil {
+			arrays.add(entry, name, *meta.ArrayIndex, v)
+			continue
+		}
+		if v == nil {
+			continue
+		}
 		entry.Meta[name] = v
 	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	arrays.assemble()
 
-	ret := []*LogEntry{}
-	for _, entry := range entries {
-		ret = append(ret, entry)
+	return l.readWideMeta(ctx, filter, entries, ids)
+}
+
+// Init creates the tables of the database if needed, stores the schema of
+// the LogWriter, and loads the meta keys already present.
+func (l *LogWriter) Init() error {
+	return l.InitContext(context.Background())
+}
+
+func (l *LogWriter) InitContext(ctx context.Context) error {
+	if _, err := l.Migrate(ctx); err != nil {
+		return err
 	}
 
-	// sort by id
-	sort.Slice(ret, func(i, j int) bool {
-		return ret[i].ID < ret[j].ID
-	})
+	if err := l.saveSchema(ctx); err != nil {
+		return err
+	}
+
+	if l.wideTable {
+		if err := l.createWideTable(ctx); err != nil {
+			return err
+		}
+	}
+
+	if l.fullTextSearch {
+		if err := l.createSearchTable(ctx); err != nil {
+			return err
+		}
+	}
 
-	return ret, nil
+	return l.loadSchema(ctx)
 }
 
-func (l *LogWriter) Init() error {
+// createLogTables creates the log_entries, log_entries_meta, meta_keys and
+// type_enum tables. This is the first migration.
+func (l *LogWriter) createLogTables(ctx context.Context) error {
 	ctb := sqlbuilder.NewCreateTableBuilder()
 	ctb.CreateTable("log_entries").
 		IfNotExists().
-		Define("id", "INTEGER", "PRIMARY KEY", "AUTOINCREMENT").
+		Define(l.columnDefinition("id", ColumnKindPrimaryKey)...).
 		Define("date", "TIMESTAMP", "NOT NULL").
 		Define("level", "VARCHAR(255)", "NOT NULL").
-		Define("session", "VARCHAR(255)")
-	if _, err := l.db.Exec(ctb.String()); err != nil {
+		Define("session", "VARCHAR(255)").
+		Define("message", "TEXT")
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
 		return err
 	}
 
 	ctb = sqlbuilder.NewCreateTableBuilder()
 	ctb.CreateTable("log_entries_meta").
 		IfNotExists().
-		Define("id", "INTEGER", "PRIMARY KEY", "AUTOINCREMENT").
-		Define("log_entry_id", "INTEGER", "NOT NULL").
+		Define(l.columnDefinition("id", ColumnKindPrimaryKey)...).
+		Define(l.columnDefinition("log_entry_id", ColumnKindInteger, "NOT NULL")...).
 		Define("type", "INTEGER", "NOT NULL").
 		Define("meta_key_id", "INTEGER").
 		Define("name", "VARCHAR(255)").
-		Define("int_value", "INTEGER").
-		Define("real_value", "REAL").
+		Define(l.columnDefinition("int_value", ColumnKindInteger)...).
+		Define(l.columnDefinition("real_value", ColumnKindReal)...).
 		Define("text_value", "TEXT").
-		Define("blob_value", "BLOB")
+		Define(l.columnDefinition("blob_value", ColumnKindBlob)...)
 
-	if _, err := l.db.Exec(ctb.String()); err != nil {
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
 		return err
 	}
 
@@ -570,7 +1316,7 @@ func (l *LogWriter) Init() error {
 	}
 	for _, col := range indexedColumns {
 		query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS log_entries_meta_%s_idx ON log_entries_meta (%s)", col, col)
-		_, err := l.db.Exec(query)
+		_, err := l.db.ExecContext(ctx, query)
 		if err != nil {
 			return err
 		}
@@ -581,68 +1327,83 @@ func (l *LogWriter) Init() error {
 		IfNotExists().
 		Define("id", "INTEGER", "PRIMARY KEY NOT NULL").
 		Define("key", "VARCHAR(255)")
-	if _, err := l.db.Exec(ctb.String()); err != nil {
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
 		return err
 	}
 
 	// add unique index on key
-	_, err := l.db.Exec("CREATE UNIQUE INDEX IF NOT EXISTS meta_keys_key_idx ON meta_keys (key)")
+	_, err := l.db.ExecContext(ctx, "CREATE UNIQUE INDEX IF NOT EXISTS meta_keys_key_idx ON meta_keys (key)")
 	if err != nil {
 		return err
 	}
 
-	err = l.saveSchema()
-	if err != nil {
-		return err
-	}
+	return l.createTypeEnumTable(ctx)
+}
 
-	err = l.createTypeEnumTable()
+// saveSchema stores the meta keys of the schema in the database.
+//
+// If they conflict with the keys already stored, a SchemaMismatchError is
+// returned, unless the LogWriter was configured to reconcile them.
+func (l *LogWriter) saveSchema(ctx context.Context) error {
+	stored, err := l.readMetaKeys(ctx)
 	if err != nil {
 		return err
 	}
 
-	err = l.loadSchema()
-	if err != nil {
-		return err
+	conflicts := metaKeyConflicts(l.schema.MetaKeys, stored)
+	if len(conflicts) > 0 {
+		if l.schemaReconciliation != SchemaReconcileUseDatabase {
+			return &SchemaMismatchError{Conflicts: conflicts}
+		}
+		l.schema.MetaKeys, err = reconcileMetaKeys(l.schema.MetaKeys, stored)
+		if err != nil {
+			return err
+		}
 	}
 
-	return nil
+	return l.saveMetaKeys(ctx)
 }
 
-// TODO(manuel, 2023-08-19) Add a function to upgrade previously non-meta keys to a meta key
-
-// TODO(manuel, 2023-08-19) Add a function to add column names straight to the log entries table
-
-// saveSchema stores the schema of the logwriter in the database.
-//
-// NOTE(manuel, 2023-02-06): This is a very naive implementation.
-// It currently blindly overwrites it, but in the future, it will warn
-// if there is a schema mismatch with what is already present.
-func (l *LogWriter) saveSchema() error {
-	err := l.saveMetaKeys()
+func (l *LogWriter) loadSchema(ctx context.Context) error {
+	err := l.loadMetaKeys(ctx)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return l.loadWideColumns(ctx)
 }
 
-func (l *LogWriter) loadSchema() error {
-	err := l.loadMetaKeys()
+// ensureColumn adds a column to an existing table if it is not present yet.
+//
+// This is used to upgrade databases created by older versions of plunger,
+// since CREATE TABLE IF NOT EXISTS leaves existing tables untouched.
+func (l *LogWriter) ensureColumn(ctx context.Context, table string, column string, definition string) error {
+	exists, err := l.store.HasColumn(table, column)
 	if err != nil {
 		return err
 	}
+	if exists {
+		return nil
+	}
 
-	return nil
+	_, err = l.db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	return err
+}
+
+// columnDefinition returns the arguments to sqlbuilder's Define for a column
+// of the given kind, followed by constraints.
+func (l *LogWriter) columnDefinition(name string, kind ColumnKind, constraints ...string) []string {
+	ret := append([]string{name}, l.store.ColumnType(kind)...)
+	return append(ret, constraints...)
 }
 
-func (l *LogWriter) createTypeEnumTable() error {
+func (l *LogWriter) createTypeEnumTable(ctx context.Context) error {
 	ctb := sqlbuilder.NewCreateTableBuilder()
 	ctb.CreateTable("type_enum").
 		IfNotExists().
 		Define("type", "VARCHAR(255)", "PRIMARY KEY").
 		Define("seq", "INTEGER", "NOT NULL")
-	if _, err := l.db.Exec(ctb.String()); err != nil {
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
 		return err
 	}
 
@@ -654,16 +1415,20 @@ func (l *LogWriter) createTypeEnumTable() error {
 		Values("text", LogEntryTypeText).
 		Values("blob", LogEntryTypeBlob).
 		Values("json", LogEntryTypeJSON).
+		Values("int", LogEntryTypeInt).
+		Values("duration", LogEntryTypeDuration).
+		Values("time", LogEntryTypeTime).
+		Values("bool", LogEntryTypeBool).
 		SQL("ON CONFLICT (type) DO NOTHING")
 	s, args := q.Build()
-	if _, err := l.db.Exec(s, args...); err != nil {
+	if _, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-func (l *LogWriter) saveMetaKeys() error {
+func (l *LogWriter) saveMetaKeys(ctx context.Context) error {
 	// Insert the keys using InsertBuilder
 	if len(l.schema.MetaKeys.Keys) > 0 {
 		q := sqlbuilder.NewInsertBuilder()
@@ -672,10 +1437,9 @@ func (l *LogWriter) saveMetaKeys() error {
 		for _, v := range l.schema.MetaKeys.Keys {
 			q.Values(v.ID, v.Name)
 		}
+		q.SQL("ON CONFLICT (id) DO NOTHING")
 		s, args := q.Build()
-		// replace INSERT with INSERT OR REPLACE
-		s = strings.Replace(s, "INSERT", "INSERT OR REPLACE", 1)
-		if _, err := l.db.Exec(s, args...); err != nil {
+		if _, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...); err != nil {
 			return err
 		}
 	}
@@ -683,30 +1447,18 @@ func (l *LogWriter) saveMetaKeys() error {
 	return nil
 }
 
-func (l *LogWriter) loadMetaKeys() error {
-	l.schema.MetaKeys = NewMetaKeys()
-
-	s := sqlbuilder.Select("*").From("meta_keys")
-	rows, err := l.db.Query(s.String())
+func (l *LogWriter) loadMetaKeys(ctx context.Context) error {
+	metaKeys, err := l.readMetaKeys(ctx)
 	if err != nil {
 		return err
 	}
-	defer func(rows *sql.Rows) {
-		_ = rows.Close()
-	}(rows)
-
-	for rows.Next() {
-		var id int
-		var key string
-		err = rows.Scan(&id, &key)
-		if err != nil {
-			return err
-		}
-		_, err = l.schema.MetaKeys.AddWithID(key, id)
-		if err != nil {
-			return err
+	// the types of the keys are only configured, not stored
+	for name, key := range l.schema.MetaKeys.Keys {
+		if loaded, ok := metaKeys.Get(name); ok {
+			loaded.Type = key.Type
+			loaded.TypeValidation = key.TypeValidation
 		}
 	}
-
+	l.schema.MetaKeys = metaKeys
 	return nil
 }
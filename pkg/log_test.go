@@ -1,8 +1,10 @@
 package pkg
 
 import (
+	"context"
 	"github.com/huandu/go-sqlbuilder"
 	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -119,7 +121,7 @@ func TestLogWriterInit(t *testing.T) {
 	lw.schema.MetaKeys.Add("bar")
 	lw.schema.MetaKeys.Add("baz")
 
-	err = lw.saveSchema()
+	err = lw.saveSchema(context.Background())
 	require.NoError(t, err)
 
 	lw = NewLogWriter(db, NewSchema())
@@ -143,7 +145,7 @@ func TestLogWriterInit(t *testing.T) {
 
 	lw.schema.MetaKeys.Add("qux")
 
-	err = lw.saveSchema()
+	err = lw.saveSchema(context.Background())
 	require.NoError(t, err)
 
 	lw = NewLogWriter(db, NewSchema())
@@ -180,7 +182,7 @@ func TestLogWriterWrite(t *testing.T) {
 	lw.schema.MetaKeys.Add("bar")
 	lw.schema.MetaKeys.Add("baz")
 
-	err = lw.saveSchema()
+	err = lw.saveSchema(context.Background())
 	require.NoError(t, err)
 
 	// Write a log entry with no meta data.
@@ -219,7 +221,7 @@ func TestLogWriterWrite(t *testing.T) {
 	assert.Equal(t, "123123", *entries[1].Session)
 	assert.Len(t, entries[1].Meta, 2)
 	assert.Equal(t, "bar", entries[1].Meta["foo"])
-	assert.Equal(t, float64(42), entries[1].Meta["baz"])
+	assert.Equal(t, int64(42), entries[1].Meta["baz"])
 	assert.Nil(t, entries[1].Meta["bar"])
 
 	// Check the third entry.
@@ -228,7 +230,7 @@ func TestLogWriterWrite(t *testing.T) {
 	assert.Equal(t, "123124", *entries[2].Session)
 	assert.Len(t, entries[2].Meta, 3)
 	assert.Equal(t, "bar", entries[2].Meta["foo"])
-	assert.Equal(t, float64(42), entries[2].Meta["baz"])
+	assert.Equal(t, int64(42), entries[2].Meta["baz"])
 	assert.Equal(t, "foo", entries[2].Meta["test"])
 
 	// Check the fourth entry.
@@ -237,7 +239,7 @@ func TestLogWriterWrite(t *testing.T) {
 	assert.Equal(t, "123124", *entries[3].Session)
 	assert.Len(t, entries[3].Meta, 3)
 	assert.Equal(t, "bar", entries[3].Meta["foo"])
-	assert.Equal(t, float64(42), entries[3].Meta["baz"])
+	assert.Equal(t, int64(42), entries[3].Meta["baz"])
 	v, ok := entries[3].Meta["test"].(map[string]interface{})
 	require.True(t, ok)
 	assert.Equal(t, "bar", v["foo"])
@@ -306,3 +308,222 @@ func TestLogWriterWrite(t *testing.T) {
 	//assert.Equal(t, "WARN", entries[1].Level)
 	//assert.Equal(t, "DEBUG", entries[2].Level)
 }
+
+func TestLogWriterWriteTimestampAndMessage(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "info", "time": "2023-08-19T10:00:00Z", "message": "hello world", "foo": "bar"}`))
+	require.NoError(t, err)
+
+	// unparseable timestamps are kept as meta
+	_, err = lw.Write([]byte(`{"level": "info", "time": "yesterday", "foo": "bar"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	assert.Equal(t, "2023-08-19T10:00:00Z", entries[0].Date.Format(time.RFC3339))
+	require.NotNil(t, entries[0].Message)
+	assert.Equal(t, "hello world", *entries[0].Message)
+	assert.Len(t, entries[0].Meta, 1)
+	assert.Equal(t, "bar", entries[0].Meta["foo"])
+
+	assert.Nil(t, entries[1].Message)
+	assert.Len(t, entries[1].Meta, 2)
+	assert.Equal(t, "yesterday", entries[1].Meta["time"])
+
+	lw = NewLogWriter(db, NewSchema(), WithTimestampFieldName("ts"), WithTimestampFormat(zerolog.TimeFormatUnixMs), WithMessageFieldName("msg"))
+	err = lw.Init()
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "info", "ts": 1692439200000, "msg": "unix"}`))
+	require.NoError(t, err)
+
+	entries, err = lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "2023-08-19T10:00:00Z", entries[2].Date.Format(time.RFC3339))
+	require.NotNil(t, entries[2].Message)
+	assert.Equal(t, "unix", *entries[2].Message)
+	assert.Len(t, entries[2].Meta, 0)
+}
+
+func TestLogWriterMetaFilters(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	schema := NewSchema()
+	schema.MetaKeys.Add("foo")
+	lw := NewLogWriter(db, schema)
+	err := lw.Init()
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "info", "foo": "bar", "baz": 42}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "info", "foo": "qux", "baz": 43, "obj": {"a": 1}}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"foo": "bar"})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(42), entries[0].Meta["baz"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"baz": float64(43)})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "qux", entries[0].Meta["foo"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"obj": map[string]interface{}{"a": 1}})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "qux", entries[0].Meta["foo"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithSelectedMetaKeys("foo")))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Len(t, entries[0].Meta, 1)
+	assert.Equal(t, "bar", entries[0].Meta["foo"])
+	assert.Len(t, entries[1].Meta, 1)
+}
+
+func TestLogWriterIntegers(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	// 2^53 + 1 can't be represented as a float64
+	_, err = lw.Write([]byte(`{"level": "info", "id": 9007199254740993, "ratio": 0.5, "exp": 1e3}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "info", "id": 9007199254740992, "ratio": 1.0}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(9007199254740993), entries[0].Meta["id"])
+	assert.Equal(t, 0.5, entries[0].Meta["ratio"])
+	assert.Equal(t, float64(1000), entries[0].Meta["exp"])
+	assert.Equal(t, float64(1), entries[1].Meta["ratio"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"id": int64(9007199254740993)})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 0.5, entries[0].Meta["ratio"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"ratio": 1})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(9007199254740992), entries[0].Meta["id"])
+}
+
+func TestLogWriterBooleans(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "info", "success": true, "n": 1}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "info", "success": false, "n": 0}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"success": false})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, false, entries[0].Meta["success"])
+	assert.Equal(t, int64(0), entries[0].Meta["n"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithQueryString("success=true")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, true, entries[0].Meta["success"])
+
+	rows, err := lw.Aggregate(nil, GroupBy("success"), Count())
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "false", rows[0].Group["success"])
+	assert.Equal(t, "true", rows[1].Group["success"])
+}
+
+func TestLogWriterLevels(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	for _, level := range []string{"debug", "info", "warn", "ERROR", "fatal", "custom"} {
+		_, err = lw.Write([]byte(`{"level": "` + level + `"}`))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithLevels("warn", "ERROR")))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "warn", entries[0].Level)
+	assert.Equal(t, "ERROR", entries[1].Level)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMinLevel("warn")))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "warn", entries[0].Level)
+	assert.Equal(t, "ERROR", entries[1].Level)
+	assert.Equal(t, "fatal", entries[2].Level)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMinLevel("warn"), WithLevels("warn", "fatal")))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+}
+
+func TestLogWriterContext(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	db.SetMaxOpenConns(1)
+
+	lw := NewLogWriter(db, NewSchema())
+	require.NoError(t, lw.InitContext(context.Background()))
+
+	_, err := lw.WriteContext(context.Background(), []byte(`{"level": "info"}`))
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err = lw.WriteContext(ctx, []byte(`{"level": "error"}`))
+	assert.ErrorIs(t, err, context.Canceled)
+	_, err = lw.GetEntriesContext(ctx, NewGetEntriesFilter())
+	assert.ErrorIs(t, err, context.Canceled)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
@@ -0,0 +1,121 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// ParseLogfmt parses a logfmt line such as
+//
+//	time=2023-05-01T10:00:00Z level=info msg="request done" duration_ms=12 cached
+//
+// Unquoted values that look like integers, floats or booleans are converted,
+// quoted values are always strings, and keys without a value are set to true.
+func ParseLogfmt(line []byte) (map[string]interface{}, error) {
+	s := string(line)
+	entry := map[string]interface{}{}
+
+	i := 0
+	for {
+		for i < len(s) && isLogfmtSpace(s[i]) {
+			i++
+		}
+		if i >= len(s) {
+			break
+		}
+
+		start := i
+		for i < len(s) && s[i] != '=' && !isLogfmtSpace(s[i]) {
+			if s[i] == '"' {
+				return nil, errors.Errorf("unexpected quote in key at offset %d", i)
+			}
+			i++
+		}
+		key := s[start:i]
+
+		if i >= len(s) || s[i] != '=' {
+			entry[key] = true
+			continue
+		}
+		if key == "" {
+			return nil, errors.Errorf("missing key at offset %d", i)
+		}
+		i++ // skip '='
+
+		if i < len(s) && s[i] == '"' {
+			value, n, err := unquoteLogfmt(s[i:])
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid value for key %s", key)
+			}
+			entry[key] = value
+			i += n
+			continue
+		}
+
+		start = i
+		for i < len(s) && !isLogfmtSpace(s[i]) {
+			i++
+		}
+		entry[key] = convertLogfmtValue(s[start:i])
+	}
+
+	if len(entry) == 0 {
+		return nil, errors.New("empty logfmt line")
+	}
+	return entry, nil
+}
+
+func isLogfmtSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n'
+}
+
+// unquoteLogfmt unquotes the quoted string s starts with, returning the
+// value and the number of bytes consumed.
+func unquoteLogfmt(s string) (string, int, error) {
+	b := &strings.Builder{}
+	for i := 1; i < len(s); {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 >= len(s) {
+				return "", 0, errors.New("unterminated escape")
+			}
+			switch s[i+1] {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			default:
+				b.WriteByte(s[i+1])
+			}
+			i += 2
+		default:
+			r, size := utf8.DecodeRuneInString(s[i:])
+			b.WriteRune(r)
+			i += size
+		}
+	}
+	return "", 0, errors.New("unterminated quoted value")
+}
+
+func convertLogfmtValue(s string) interface{} {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "xXnN") {
+		// exclude hex floats, NaN and Inf, which are more likely to be text
+		return f
+	}
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	}
+	return s
+}
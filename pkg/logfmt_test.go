@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func TestParseLogfmt(t *testing.T) {
+	entry, err := ParseLogfmt([]byte(`time=2023-05-01T10:00:00Z level=info msg="request \"done\"\n" n=12 ratio=0.5 ok=false cached empty= path=/a=b`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"time":   "2023-05-01T10:00:00Z",
+		"level":  "info",
+		"msg":    "request \"done\"\n",
+		"n":      int64(12),
+		"ratio":  0.5,
+		"ok":     false,
+		"cached": true,
+		"empty":  "",
+		"path":   "/a=b",
+	}, entry)
+
+	entry, err = ParseLogfmt([]byte(`id=0x1f user="zoë" nan=NaN`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": "0x1f", "user": "zoë", "nan": "NaN"}, entry)
+
+	for _, line := range []string{``, `  `, `msg="unterminated`, `=value`, `a"b=c`} {
+		_, err = ParseLogfmt([]byte(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestLogWriterLogfmt(t *testing.T) {
+	lw := newImportLogWriter(t, WithLineParser(LogfmtLineParser), WithMessageFieldName("msg"))
+
+	_, err := lw.Write([]byte(`level=warn msg="disk almost full" free_mb=120`))
+	require.NoError(t, err)
+
+	res, err := lw.Import(strings.NewReader("level=info msg=first\nlevel=error msg=second code=500\n"))
+	require.NoError(t, err)
+	assert.Equal(t, 2, res.Imported)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"code": 500})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", *entries[0].Message)
+	assert.Equal(t, "error", entries[0].Level)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithLevel("warn")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(120), entries[0].Meta["free_mb"])
+
+	_, err = LineParserForFormat("xml")
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"github.com/pkg/errors"
+)
+
+// MergeResult is returned by Merge.
+type MergeResult struct {
+	Entries int `json:"entries"`
+	// Sessions is the number of sessions that didn't exist in the target yet.
+	Sessions int `json:"sessions"`
+}
+
+// mergeBatchSize is the number of entries copied per transaction by Merge.
+const mergeBatchSize = 500
+
+// Merge copies the sessions and entries of src into the database of l, for
+// example to collect the logs of several machines into a single file.
+//
+// Meta keys are matched by name, keys unknown to l are added to its schema
+// with ids of its own. Entries are copied as is, without running the
+// middlewares of l, and merging the same database twice copies its entries
+// twice. Links between entries aren't copied, see Link.
+func (l *LogWriter) Merge(ctx context.Context, src *LogWriter) (*MergeResult, error) {
+	ret := &MergeResult{}
+
+	for name := range src.schema.MetaKeys.Keys {
+		l.schema.MetaKeys.Add(name)
+	}
+	if err := l.saveMetaKeys(ctx); err != nil {
+		return nil, errors.Wrap(err, "could not save meta keys")
+	}
+
+	summaries, err := src.Sessions().ListSessions()
+	if err != nil {
+		return nil, err
+	}
+	sessions := l.Sessions()
+	for _, summary := range summaries {
+		_, err := sessions.GetSession(summary.ID)
+		if err == nil {
+			continue
+		}
+		var unknown *UnknownSessionError
+		if !errors.As(err, &unknown) {
+			return nil, err
+		}
+		if err := sessions.insertSession(summary.Session); err != nil {
+			return nil, errors.Wrapf(err, "could not copy session %s", summary.ID)
+		}
+		ret.Sessions++
+	}
+
+	lastID := 0
+	for {
+		entries, err := src.GetEntriesContext(ctx, NewGetEntriesFilter(WithAfterID(lastID), WithLimit(mergeBatchSize)))
+		if err != nil {
+			return ret, err
+		}
+		if len(entries) == 0 {
+			return ret, nil
+		}
+		lastID = entries[len(entries)-1].ID
+
+		err = l.retryBusy(ctx, func() error {
+			tx, err := l.db.BeginTxx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			for _, entry := range entries {
+				var session interface{}
+				if entry.Session != nil {
+					session = *entry.Session
+				}
+				var message sql.NullString
+				if entry.Message != nil {
+					message = sql.NullString{String: *entry.Message, Valid: true}
+				}
+				if err := l.insertParsedEntry(ctx, tx, entry.Date, entry.Level, session, entry.group(), entry.sampledDropped(), message, entry.caller(), entry.errorColumns(), entry.trace(), entry.Meta); err != nil {
+					_ = tx.Rollback()
+					return err
+				}
+			}
+			return tx.Commit()
+		})
+		if err != nil {
+			return ret, err
+		}
+		ret.Entries += len(entries)
+	}
+}
@@ -0,0 +1,80 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	dir := t.TempDir()
+
+	open := func(name string, keys ...string) *LogWriter {
+		schema := NewSchema()
+		for _, k := range keys {
+			schema.MetaKeys.Add(k)
+		}
+		lw, err := OpenLogWriter(filepath.Join(dir, name), schema, WithCompression(CompressionZstd, 10))
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			_ = lw.Close()
+		})
+		return lw
+	}
+
+	// host has different ids in both databases, and service shares the id of host in a
+	a := open("a.db", "host", "request_id")
+	b := open("b.db", "service", "host")
+
+	session, err := a.Sessions().NewSession("machine-a", map[string]interface{}{"region": "eu"})
+	require.NoError(t, err)
+	a.session = session.ID
+	for _, line := range []string{
+		`{"level": "info", "time": "2024-05-01T10:00:00Z", "message": "a1", "host": "a", "request_id": 1}`,
+		`{"level": "error", "time": "2024-05-01T11:00:00Z", "message": "a2", "host": "a", "payload": {"text": "aaaaaaaaaaaaaaaaaaaaaaaaaaaa"}}`,
+	} {
+		_, err := a.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	_, err = b.Write([]byte(`{"level": "warn", "time": "2024-05-01T10:30:00Z", "service": "api", "host": "b"}`))
+	require.NoError(t, err)
+
+	out := open("out.db")
+	res, err := out.Merge(context.Background(), a)
+	require.NoError(t, err)
+	assert.Equal(t, &MergeResult{Entries: 2, Sessions: 1}, res)
+	res, err = out.Merge(context.Background(), b)
+	require.NoError(t, err)
+	assert.Equal(t, &MergeResult{Entries: 1}, res)
+
+	entries, err := out.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+
+	assert.Equal(t, "a1", *entries[0].Message)
+	assert.Equal(t, session.ID, *entries[0].Session)
+	assert.Equal(t, "2024-05-01T10:00:00Z", entries[0].Date.Format("2006-01-02T15:04:05Z07:00"))
+	assert.Equal(t, map[string]interface{}{"host": "a", "request_id": int64(1)}, entries[0].Meta)
+	assert.Equal(t, map[string]interface{}{"text": "aaaaaaaaaaaaaaaaaaaaaaaaaaaa"}, entries[1].Meta["payload"])
+
+	assert.Equal(t, "warn", entries[2].Level)
+	assert.Nil(t, entries[2].Session)
+	assert.Nil(t, entries[2].Message)
+	assert.Equal(t, map[string]interface{}{"service": "api", "host": "b"}, entries[2].Meta)
+
+	// meta keys of both databases are stored by id, and can be filtered on
+	for _, k := range []string{"host", "request_id", "service"} {
+		_, ok := out.schema.MetaKeys.Get(k)
+		assert.True(t, ok, k)
+	}
+	entries, err = out.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"host": "b"})))
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	copied, err := out.Sessions().GetSession(session.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "machine-a", copied.Name)
+	assert.Equal(t, map[string]interface{}{"region": "eu"}, copied.Metadata)
+}
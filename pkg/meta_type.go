@@ -0,0 +1,188 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// A meta key can be declared with the type its values are expected to have,
+// so that a key logged as an integer doesn't end up stored as text by some
+// other call site, which would make MetaFilters miss its values:
+//
+//	schema.MetaKeys.AddTyped("user_id", LogEntryTypeInt, TypeValidationCoerce)
+
+// TypeValidation selects what happens to meta values that don't have the
+// type of their MetaKey.
+type TypeValidation string
+
+const (
+	// TypeValidationWarn stores the value as is, and records the mismatch in
+	// the SchemaViolationsKey meta key of the entry.
+	TypeValidationWarn TypeValidation = "warn"
+	// TypeValidationCoerce converts the value to the type of the key, for
+	// example "42" to 42. Values that can't be converted are handled as in
+	// TypeValidationWarn.
+	TypeValidationCoerce TypeValidation = "coerce"
+	// TypeValidationReject fails the write with a TypeMismatchError.
+	TypeValidationReject TypeValidation = "reject"
+)
+
+type InvalidTypeValidationError struct {
+	Mode string
+}
+
+func (e *InvalidTypeValidationError) Error() string {
+	return "invalid type validation " + e.Mode + ", expected warn, coerce or reject"
+}
+
+// ParseTypeValidation parses the name of a TypeValidation. The empty string
+// disables type validation.
+func ParseTypeValidation(s string) (TypeValidation, error) {
+	switch TypeValidation(strings.ToLower(s)) {
+	case "":
+		return "", nil
+	case TypeValidationWarn:
+		return TypeValidationWarn, nil
+	case TypeValidationCoerce:
+		return TypeValidationCoerce, nil
+	case TypeValidationReject:
+		return TypeValidationReject, nil
+	}
+	return "", &InvalidTypeValidationError{Mode: s}
+}
+
+// TypeMismatchError is returned when writing a value of the wrong type for a
+// meta key declared with TypeValidationReject.
+type TypeMismatchError struct {
+	Key      string
+	Expected LogEntryType
+	Actual   LogEntryType
+}
+
+func (e *TypeMismatchError) Error() string {
+	return fmt.Sprintf("meta key %s expects %s values, got %s", e.Key, e.Expected, e.Actual)
+}
+
+// AddTyped adds a key whose values are expected to be of type t, see TypeValidation.
+func (m *MetaKeys) AddTyped(name string, t LogEntryType, validation TypeValidation) *MetaKey {
+	key := m.Add(name)
+	key.Type = t
+	key.TypeValidation = validation
+	return key
+}
+
+// checkMetaTypes validates the values of the typed meta keys, coercing them
+// in place if needed.
+func (l *LogWriter) checkMetaTypes(meta map[string]interface{}) error {
+	mismatches := []string{}
+	for k, v := range meta {
+		key, ok := l.schema.MetaKeys.Get(k)
+		if !ok || v == nil {
+			continue
+		}
+		// zerolog's Dur and Time are plain numbers and strings, only the
+		// declared type of their key tells them apart
+		if parsed, ok := l.parseTimeValue(key.Type, v); ok {
+			meta[k] = parsed
+			continue
+		}
+		if key.TypeValidation == "" {
+			continue
+		}
+		actual := ToLogEntryType(v)
+		if typeMatches(key.Type, actual) {
+			continue
+		}
+		// JSON doesn't distinguish 1.0 from 1, which zerolog writes for both
+		if key.Type == LogEntryTypeReal && actual == LogEntryTypeInt {
+			meta[k], _ = coerceMetaValue(v, LogEntryTypeReal)
+			continue
+		}
+
+		switch key.TypeValidation {
+		case TypeValidationReject:
+			return errors.WithStack(&TypeMismatchError{Key: k, Expected: key.Type, Actual: actual})
+		case TypeValidationCoerce:
+			if coerced, ok := coerceMetaValue(v, key.Type); ok {
+				meta[k] = coerced
+				continue
+			}
+		}
+		mismatches = append(mismatches, fmt.Sprintf("%s: expected %s, got %s", k, key.Type, actual))
+	}
+
+	if len(mismatches) > 0 {
+		if s, ok := meta[SchemaViolationsKey].(string); ok && s != "" {
+			mismatches = append([]string{s}, mismatches...)
+		}
+		meta[SchemaViolationsKey] = strings.Join(mismatches, "; ")
+	}
+	return nil
+}
+
+func typeMatches(expected LogEntryType, actual LogEntryType) bool {
+	if expected == actual {
+		return true
+	}
+	// blobs and JSON values share the blob_value column
+	return (expected == LogEntryTypeBlob || expected == LogEntryTypeJSON) &&
+		(actual == LogEntryTypeBlob || actual == LogEntryTypeJSON)
+}
+
+// coerceMetaValue converts v to a value of type t, if it can be done without
+// losing information. Values aren't coerced to blobs or JSON.
+func coerceMetaValue(v interface{}, t LogEntryType) (interface{}, bool) {
+	value, err := toMetaValue(v)
+	if err != nil {
+		return nil, false
+	}
+	switch t {
+	case LogEntryTypeInt:
+		switch value.Type {
+		case LogEntryTypeReal:
+			f := value.Real.Float64
+			if f == math.Trunc(f) && math.Abs(f) < math.MaxInt64 {
+				return int64(f), true
+			}
+		case LogEntryTypeText:
+			if i, err := strconv.ParseInt(strings.TrimSpace(value.Text.String), 10, 64); err == nil {
+				return i, true
+			}
+		}
+	case LogEntryTypeReal:
+		switch value.Type {
+		case LogEntryTypeInt:
+			return float64(value.Int.Int64), true
+		case LogEntryTypeText:
+			if f, err := strconv.ParseFloat(strings.TrimSpace(value.Text.String), 64); err == nil {
+				return f, true
+			}
+		}
+	case LogEntryTypeBool:
+		switch value.Type {
+		case LogEntryTypeInt:
+			if value.Int.Int64 == 0 || value.Int.Int64 == 1 {
+				return value.Int.Int64 == 1, true
+			}
+		case LogEntryTypeText:
+			if b, err := strconv.ParseBool(strings.TrimSpace(value.Text.String)); err == nil {
+				return b, true
+			}
+		}
+	case LogEntryTypeText:
+		switch value.Type {
+		case LogEntryTypeBool:
+			return strconv.FormatBool(value.Int.Int64 == 1), true
+		case LogEntryTypeInt:
+			return strconv.FormatInt(value.Int.Int64, 10), true
+		case LogEntryTypeReal:
+			return strconv.FormatFloat(value.Real.Float64, 'g', -1, 64), true
+		case LogEntryTypeBlob, LogEntryTypeJSON:
+			return value.Blob.String, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestCoerceMetaValue(t *testing.T) {
+	for _, tc := range []struct {
+		value    interface{}
+		t        LogEntryType
+		expected interface{}
+		ok       bool
+	}{
+		{"42", LogEntryTypeInt, int64(42), true},
+		{3.0, LogEntryTypeInt, int64(3), true},
+		{3.5, LogEntryTypeInt, nil, false},
+		{"fast", LogEntryTypeInt, nil, false},
+		{int64(2), LogEntryTypeReal, 2.0, true},
+		{" 2.5", LogEntryTypeReal, 2.5, true},
+		{int64(7), LogEntryTypeText, "7", true},
+		{map[string]interface{}{"a": int64(1)}, LogEntryTypeText, `{"a":1}`, true},
+		{"x", LogEntryTypeJSON, nil, false},
+		{"true", LogEntryTypeBool, true, true},
+		{int64(0), LogEntryTypeBool, false, true},
+		{int64(2), LogEntryTypeBool, nil, false},
+		{false, LogEntryTypeText, "false", true},
+	} {
+		v, ok := coerceMetaValue(tc.value, tc.t)
+		assert.Equal(t, tc.ok, ok, "%v to %s", tc.value, tc.t)
+		assert.Equal(t, tc.expected, v, "%v to %s", tc.value, tc.t)
+	}
+}
+
+func TestLogWriterTypedMetaKeys(t *testing.T) {
+	schema := NewSchema()
+	schema.MetaKeys.AddTyped("user_id", LogEntryTypeInt, TypeValidationCoerce)
+	schema.MetaKeys.AddTyped("duration", LogEntryTypeReal, TypeValidationReject)
+	schema.MetaKeys.AddTyped("status", LogEntryTypeInt, TypeValidationWarn)
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	lw := NewLogWriter(db, schema)
+	require.NoError(t, lw.Init())
+
+	for _, line := range []string{
+		`{"level": "info", "user_id": "12", "duration": 3, "status": "ok"}`,
+		`{"level": "info", "user_id": 12, "duration": 1.5, "status": 200}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	_, err := lw.Write([]byte(`{"level": "info", "duration": "slow"}`))
+	var mismatchErr *TypeMismatchError
+	require.ErrorAs(t, err, &mismatchErr)
+	assert.Equal(t, "meta key duration expects real values, got text", mismatchErr.Error())
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(12), entries[0].Meta["user_id"])
+	assert.Equal(t, 3.0, entries[0].Meta["duration"])
+	assert.Equal(t, "ok", entries[0].Meta["status"])
+	assert.Equal(t, "status: expected int, got text", entries[0].Meta[SchemaViolationsKey])
+	assert.Nil(t, entries[1].Meta[SchemaViolationsKey])
+
+	// the coerced values are found by meta filters
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"user_id": int64(12)})))
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+}
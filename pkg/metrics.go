@@ -0,0 +1,228 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// Metrics are counters and gauges derived from the values of configured keys
+// as entries get written, see WithMetrics. They are rolled up per minute in
+// the metrics table, so that they can be queried without scanning the
+// entries. Rollups are kept when entries are deleted or pruned.
+
+type MetricKind string
+
+const (
+	// MetricCounter adds up the numeric values of its key, or counts the
+	// entries having the key if its values aren't numbers.
+	MetricCounter MetricKind = "counter"
+	// MetricGauge records the count, sum, min, max and last numeric values of its key.
+	MetricGauge MetricKind = "gauge"
+)
+
+// MetricDefinition derives the metric Name, Key by default, from the values of Key.
+type MetricDefinition struct {
+	Key  string
+	Kind MetricKind
+	Name string
+}
+
+func (d MetricDefinition) name() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.Key
+}
+
+// ParseMetricDefinition parses key:kind or key:kind:name, such as bytes:counter.
+func ParseMetricDefinition(s string) (MetricDefinition, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) < 2 || parts[0] == "" {
+		return MetricDefinition{}, errors.Errorf("invalid metric %q, expected key:kind or key:kind:name", s)
+	}
+	d := MetricDefinition{Key: parts[0], Kind: MetricKind(parts[1])}
+	if len(parts) == 3 {
+		d.Name = parts[2]
+	}
+	if d.Kind != MetricCounter && d.Kind != MetricGauge {
+		return MetricDefinition{}, errors.Errorf("unknown metric kind %q, expected counter or gauge", parts[1])
+	}
+	return d, nil
+}
+
+// WithMetrics maintains the rollups of metrics at write time. They are
+// recorded in the transaction inserting the entry, once the middlewares ran,
+// so that the entries dropped by the middlewares or failing to be written
+// aren't counted.
+func WithMetrics(definitions ...MetricDefinition) LogWriterOption {
+	return func(l *LogWriter) {
+		l.metrics = append(l.metrics, definitions...)
+	}
+}
+
+func (l *LogWriter) createMetricsTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("metrics").
+		IfNotExists().
+		Define("name", "VARCHAR(255)", "NOT NULL").
+		// minute is the start of the rollup, in UNIX seconds
+		Define(l.columnDefinition("minute", ColumnKindInteger, "NOT NULL")...).
+		Define("kind", "VARCHAR(16)", "NOT NULL").
+		Define(l.columnDefinition("count", ColumnKindInteger, "NOT NULL")...).
+		Define(l.columnDefinition("sum", ColumnKindReal, "NOT NULL")...).
+		Define(l.columnDefinition("min", ColumnKindReal)...).
+		Define(l.columnDefinition("max", ColumnKindReal)...).
+		Define(l.columnDefinition("last", ColumnKindReal)...).
+		Define("PRIMARY KEY (name, minute)")
+	_, err := l.db.ExecContext(ctx, ctb.String())
+	return err
+}
+
+// recordMetrics records the metrics of the entry log, dated date, as part of
+// the transaction inserting it.
+func (l *LogWriter) recordMetrics(ctx context.Context, tx *sqlx.Tx, log map[string]interface{}, date time.Time) error {
+	for _, d := range l.metrics {
+		v, ok := log[d.Key]
+		if !ok || v == nil {
+			continue
+		}
+		n, ok := metricValue(v)
+		if !ok {
+			if d.Kind == MetricGauge {
+				continue
+			}
+			n = 1
+		}
+		if err := l.recordMetric(ctx, tx, d, date, n); err != nil {
+			return errors.Wrapf(err, "could not record metric %s", d.name())
+		}
+	}
+	return nil
+}
+
+func metricValue(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case float64:
+		return v, true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+func (l *LogWriter) recordMetric(ctx context.Context, tx *sqlx.Tx, d MetricDefinition, date time.Time, v float64) error {
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("metrics").
+		Cols("name", "minute", "kind", "count", "sum", "min", "max", "last").
+		Values(d.name(), date.Truncate(time.Minute).Unix(), string(d.Kind), 1, v, v, v, v).
+		SQL("ON CONFLICT (name, minute) DO UPDATE SET count = metrics.count + excluded.count, " +
+			"sum = metrics.sum + excluded.sum, " +
+			"min = CASE WHEN excluded.min < metrics.min THEN excluded.min ELSE metrics.min END, " +
+			"max = CASE WHEN excluded.max > metrics.max THEN excluded.max ELSE metrics.max END, " +
+			"last = excluded.last")
+	s, args := ib.Build()
+	_, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+	return err
+}
+
+// MetricPoint is the rollup of a metric over a time step, see GetMetrics.
+type MetricPoint struct {
+	Name string     `db:"name" json:"name"`
+	Kind MetricKind `db:"kind" json:"kind"`
+	// Time is the start of the step.
+	Time  time.Time `db:"-" json:"time"`
+	Count int64     `db:"count" json:"count"`
+	// Sum is the value of counters.
+	Sum  float64 `db:"sum" json:"sum"`
+	Min  float64 `db:"min" json:"min"`
+	Max  float64 `db:"max" json:"max"`
+	Last float64 `db:"last" json:"last"`
+	// Minute is the start of the rollup Time was computed from, in UNIX seconds.
+	Minute int64 `db:"minute" json:"-"`
+}
+
+// Avg is the average value of a gauge.
+func (p *MetricPoint) Avg() float64 {
+	if p.Count == 0 {
+		return 0
+	}
+	return p.Sum / float64(p.Count)
+}
+
+// MetricsQuery selects the rollups returned by GetMetrics.
+type MetricsQuery struct {
+	// Name selects a single metric, all metrics if empty.
+	Name string
+	From time.Time
+	To   time.Time
+	// Step merges the rollups into steps of this duration, rounded to
+	// minutes. 0 merges them all into a single point per metric.
+	Step time.Duration
+}
+
+// GetMetrics returns the rollups of the metrics matching query, ordered by
+// name and time.
+func (l *LogWriter) GetMetrics(ctx context.Context, query MetricsQuery) ([]*MetricPoint, error) {
+	sb := sqlbuilder.Select("name", "minute", "kind", "count", "sum", "min", "max", "last").
+		From("metrics").OrderBy("name ASC", "minute ASC")
+	if query.Name != "" {
+		sb.Where(sb.E("name", query.Name))
+	}
+	if !query.From.IsZero() {
+		sb.Where(sb.GE("minute", query.From.Truncate(time.Minute).Unix()))
+	}
+	if !query.To.IsZero() {
+		sb.Where(sb.LE("minute", query.To.Unix()))
+	}
+	s, args := sb.Build()
+	rows := []*MetricPoint{}
+	if err := l.db.SelectContext(ctx, &rows, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+
+	step := query.Step.Truncate(time.Minute)
+	if query.Step > 0 && step == 0 {
+		step = time.Minute
+	}
+	ret := []*MetricPoint{}
+	points := map[string]*MetricPoint{}
+	for _, row := range rows {
+		t := time.Unix(row.Minute, 0).UTC()
+		if step > 0 {
+			t = t.Truncate(step)
+		}
+		k := row.Name
+		if step > 0 {
+			k = fmt.Sprintf("%s %d", row.Name, t.Unix())
+		}
+		p, ok := points[k]
+		if !ok {
+			row.Time = t
+			points[k] = row
+			ret = append(ret, row)
+			continue
+		}
+		// rows are read by time, so the last value is the one of row
+		p.Count += row.Count
+		p.Sum += row.Sum
+		if row.Min < p.Min {
+			p.Min = row.Min
+		}
+		if row.Max > p.Max {
+			p.Max = row.Max
+		}
+		p.Last = row.Last
+	}
+	return ret, nil
+}
@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	lw := newImportLogWriter(t,
+		WithMetrics(
+			MetricDefinition{Key: "bytes", Kind: MetricCounter},
+			MetricDefinition{Key: "event", Kind: MetricCounter, Name: "events"},
+			MetricDefinition{Key: "latency", Kind: MetricGauge},
+		),
+		WithMiddleware(SampleMiddleware(WithSampleRules(SampleRule{Level: "debug", Every: 100}))),
+	)
+	ctx := context.Background()
+
+	for _, line := range []string{
+		`{"level":"info","time":"2023-05-01T10:00:05Z","bytes":100,"latency":0.5,"event":"login"}`,
+		`{"level":"info","time":"2023-05-01T10:00:50Z","bytes":50,"latency":1.5}`,
+		`{"level":"info","time":"2023-05-01T10:01:10Z","bytes":25,"latency":"n/a"}`,
+		`{"level":"debug","time":"2023-05-01T10:02:00Z","latency":0.1}`,
+		// dropped by sampling, and not counted
+		`{"level":"debug","time":"2023-05-01T10:02:30Z","latency":4}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	points, err := lw.GetMetrics(ctx, MetricsQuery{Name: "bytes", Step: time.Minute})
+	require.NoError(t, err)
+	require.Len(t, points, 2)
+	assert.Equal(t, time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC), points[0].Time)
+	assert.Equal(t, 150.0, points[0].Sum)
+	assert.Equal(t, int64(2), points[0].Count)
+	assert.Equal(t, 25.0, points[1].Sum)
+
+	points, err = lw.GetMetrics(ctx, MetricsQuery{})
+	require.NoError(t, err)
+	require.Len(t, points, 3)
+	assert.Equal(t, "bytes", points[0].Name)
+	assert.Equal(t, 175.0, points[0].Sum)
+	assert.Equal(t, "events", points[1].Name)
+	assert.Equal(t, int64(1), points[1].Count)
+	latency := points[2]
+	assert.Equal(t, MetricGauge, latency.Kind)
+	assert.Equal(t, int64(3), latency.Count)
+	assert.Equal(t, 0.1, latency.Min)
+	assert.Equal(t, 1.5, latency.Max)
+	assert.Equal(t, 0.1, latency.Last)
+	assert.InDelta(t, 0.7, latency.Avg(), 1e-9)
+
+	points, err = lw.GetMetrics(ctx, MetricsQuery{
+		Name: "latency",
+		From: time.Date(2023, 5, 1, 10, 1, 0, 0, time.UTC),
+		Step: 10 * time.Minute,
+	})
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.Equal(t, int64(1), points[0].Count)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestMetricsRolledBack(t *testing.T) {
+	lw := newImportLogWriter(t, WithMetrics(MetricDefinition{Key: "bytes", Kind: MetricCounter}))
+	ctx := context.Background()
+	_, err := lw.db.Exec(`CREATE TRIGGER reject_boom BEFORE INSERT ON log_entries WHEN NEW.message = 'boom'
+		BEGIN SELECT RAISE(ABORT, 'rejected'); END`)
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "info", "message": "boom", "bytes": 10}`))
+	require.Error(t, err)
+	// the whole batch is rolled back
+	_, err = lw.writeBatch(ctx, []map[string]interface{}{
+		{"level": "info", "message": "ok", "bytes": 20.0},
+		{"level": "info", "message": "boom", "bytes": 30.0},
+	})
+	require.Error(t, err)
+
+	points, err := lw.GetMetrics(ctx, MetricsQuery{})
+	require.NoError(t, err)
+	assert.Empty(t, points)
+
+	_, err = lw.Write([]byte(`{"level": "info", "message": "ok", "bytes": 40}`))
+	require.NoError(t, err)
+	points, err = lw.GetMetrics(ctx, MetricsQuery{})
+	require.NoError(t, err)
+	require.Len(t, points, 1)
+	assert.Equal(t, 40.0, points[0].Sum)
+}
+
+func TestParseMetricDefinition(t *testing.T) {
+	d, err := ParseMetricDefinition("http.bytes:counter:bytes_sent")
+	require.NoError(t, err)
+	assert.Equal(t, MetricDefinition{Key: "http.bytes", Kind: MetricCounter, Name: "bytes_sent"}, d)
+	_, err = ParseMetricDefinition("latency:histogram")
+	assert.Error(t, err)
+	_, err = ParseMetricDefinition("latency")
+	assert.Error(t, err)
+}
@@ -0,0 +1,26 @@
+package pkg
+
+// EntryHandler processes a log entry, as decoded from the JSON payload handed
+// over by zerolog.
+type EntryHandler func(entry map[string]interface{}) error
+
+// Middleware wraps the EntryHandler that persists entries in the LogWriter.
+//
+// A middleware can inspect and modify the entry before calling next, compute
+// derived fields, or drop the entry entirely by not calling next at all.
+type Middleware func(next EntryHandler) EntryHandler
+
+// WithMiddleware registers middlewares on the write path. The first middleware
+// is the first one to see the entry.
+func WithMiddleware(middlewares ...Middleware) LogWriterOption {
+	return func(l *LogWriter) {
+		l.middlewares = append(l.middlewares, middlewares...)
+	}
+}
+
+func chainMiddlewares(handler EntryHandler, middlewares ...Middleware) EntryHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
@@ -0,0 +1,53 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterMiddleware(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	order := []string{}
+	dropDebug := func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			order = append(order, "drop")
+			if entry["level"] == "debug" {
+				return nil
+			}
+			return next(entry)
+		}
+	}
+	addLength := func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			order = append(order, "length")
+			if msg, ok := entry["message"].(string); ok {
+				entry["length"] = float64(len(msg))
+			}
+			return next(entry)
+		}
+	}
+
+	lw := NewLogWriter(db, NewSchema(), WithMiddleware(dropDebug, addLength))
+	err := lw.Init()
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "debug", "message": "noise"}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "info", "message": "hello"}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"drop", "drop", "length"}, order)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "info", entries[0].Level)
+	assert.Equal(t, float64(5), entries[0].Meta["length"])
+}
@@ -0,0 +1,225 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// Migration is a step upgrading the database schema to Version.
+//
+// Databases created before schema_version existed have no recorded version,
+// so migrations have to be idempotent: they are all applied to such databases.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(ctx context.Context, l *LogWriter) error
+}
+
+// migrations lists the schema changes in order. Append new steps at the end,
+// never change or remove existing ones.
+var migrations = []Migration{
+	{Version: 1, Name: "create log tables", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createLogTables(ctx)
+	}},
+	{Version: 2, Name: "add message column to log_entries", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.ensureColumn(ctx, "log_entries", "message", "TEXT")
+	}},
+	{Version: 3, Name: "create level_enum table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createLevelEnumTable(ctx)
+	}},
+	{Version: 4, Name: "create sessions table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.Sessions().InitContext(ctx)
+	}},
+	{Version: 5, Name: "create alerts table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createAlertsTable(ctx)
+	}},
+	{Version: 6, Name: "create queries table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createQueriesTable(ctx)
+	}},
+	{Version: 7, Name: "add compression column to log_entries_meta", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.ensureColumn(ctx, "log_entries_meta", "compression", "VARCHAR(16)")
+	}},
+	{Version: 8, Name: "add parent_id column to sessions", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.ensureColumn(ctx, "sessions", "parent_id", "VARCHAR(255)")
+	}},
+	{Version: 9, Name: "create session_metadata and session_tags tables", Up: func(ctx context.Context, l *LogWriter) error {
+		if err := l.Sessions().createSessionMetadataTables(ctx); err != nil {
+			return err
+		}
+		return l.Sessions().migrateSessionMetadata(ctx)
+	}},
+	{Version: 10, Name: "add caller columns to log_entries", Up: func(ctx context.Context, l *LogWriter) error {
+		if err := l.ensureColumn(ctx, "log_entries", "caller_file", "TEXT"); err != nil {
+			return err
+		}
+		return l.ensureColumn(ctx, "log_entries", "caller_line", "INTEGER")
+	}},
+	{Version: 11, Name: "add error columns to log_entries", Up: func(ctx context.Context, l *LogWriter) error {
+		if err := l.ensureColumn(ctx, "log_entries", "error_message", "TEXT"); err != nil {
+			return err
+		}
+		return l.ensureColumn(ctx, "log_entries", "error_chain", "TEXT")
+	}},
+	{Version: 12, Name: "add trace columns to log_entries", Up: func(ctx context.Context, l *LogWriter) error {
+		if err := l.ensureColumn(ctx, "log_entries", "trace_id", "VARCHAR(255)"); err != nil {
+			return err
+		}
+		if err := l.ensureColumn(ctx, "log_entries", "span_id", "VARCHAR(255)"); err != nil {
+			return err
+		}
+		_, err := l.db.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS log_entries_trace_id_idx ON log_entries (trace_id)")
+		return err
+	}},
+	{Version: 13, Name: "add duration and time types", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createTypeEnumTable(ctx)
+	}},
+	{Version: 14, Name: "add bool type", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createTypeEnumTable(ctx)
+	}},
+	{Version: 15, Name: "add array_index column to log_entries_meta", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.ensureColumn(ctx, "log_entries_meta", "array_index", "INTEGER")
+	}},
+	{Version: 16, Name: "create entry_links table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createEntryLinksTable(ctx)
+	}},
+	{Version: 17, Name: "create artifacts table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createArtifactsTable(ctx)
+	}},
+	{Version: 18, Name: "create metrics table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createMetricsTable(ctx)
+	}},
+	{Version: 19, Name: "create settings table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createSettingsTable(ctx)
+	}},
+	{Version: 20, Name: "index text values of log_entries_meta by name", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createMetaTextValueIndex(ctx)
+	}},
+	{Version: 21, Name: "add run columns to sessions", Up: func(ctx context.Context, l *LogWriter) error {
+		for _, column := range [][2]string{{"started_at", "TIMESTAMP"}, {"ended_at", "TIMESTAMP"}, {"exit_code", "INTEGER"}} {
+			if err := l.ensureColumn(ctx, "sessions", column[0], column[1]); err != nil {
+				return err
+			}
+		}
+		_, err := l.db.ExecContext(ctx, "UPDATE sessions SET started_at = created_at WHERE started_at IS NULL")
+		return err
+	}},
+	{Version: 22, Name: "create spans table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createSpansTable(ctx)
+	}},
+	{Version: 23, Name: "add fingerprint column to log_entries", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.addFingerprintColumn(ctx)
+	}},
+	{Version: 24, Name: "add group_id column to log_entries", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.addGroupColumn(ctx)
+	}},
+	{Version: 25, Name: "create meta_indexes table", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.createMetaIndexesTable(ctx)
+	}},
+	{Version: 26, Name: "add sampled_dropped column to log_entries", Up: func(ctx context.Context, l *LogWriter) error {
+		return l.addSampledDroppedColumn(ctx)
+	}},
+}
+
+// LatestSchemaVersion is the schema version of databases created by this version of plunger.
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersionError is returned when the database was created by a newer
+// version of plunger.
+type SchemaVersionError struct {
+	Database  int
+	Supported int
+}
+
+func (e *SchemaVersionError) Error() string {
+	return fmt.Sprintf("database schema version %d is newer than the supported version %d", e.Database, e.Supported)
+}
+
+type migrateOptions struct {
+	dryRun bool
+}
+
+type MigrateOption func(*migrateOptions)
+
+// WithDryRun only returns the pending migrations, without applying them.
+func WithDryRun(dryRun bool) MigrateOption {
+	return func(o *migrateOptions) {
+		o.dryRun = dryRun
+	}
+}
+
+// SchemaVersion returns the version recorded in the database, 0 if none.
+func (l *LogWriter) SchemaVersion(ctx context.Context) (int, error) {
+	exists, err := l.store.HasTable("schema_version")
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var version int
+	q := sqlbuilder.Select("COALESCE(MAX(version), 0)").From("schema_version")
+	if err := l.db.QueryRowxContext(ctx, q.String()).Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// Migrate applies the migrations the database is missing, and returns them.
+// It is called by Init.
+func (l *LogWriter) Migrate(ctx context.Context, opts ...MigrateOption) ([]Migration, error) {
+	o := &migrateOptions{}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	version, err := l.SchemaVersion(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if version > LatestSchemaVersion() {
+		return nil, &SchemaVersionError{Database: version, Supported: LatestSchemaVersion()}
+	}
+
+	pending := []Migration{}
+	for _, m := range migrations {
+		if m.Version > version {
+			pending = append(pending, m)
+		}
+	}
+	if o.dryRun || len(pending) == 0 {
+		return pending, nil
+	}
+
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("schema_version").
+		IfNotExists().
+		Define("version", "INTEGER", "PRIMARY KEY").
+		Define("name", "VARCHAR(255)", "NOT NULL").
+		Define("applied_at", "TIMESTAMP", "NOT NULL")
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
+		return nil, err
+	}
+
+	for i, m := range pending {
+		if err := m.Up(ctx, l); err != nil {
+			return pending[:i], errors.Wrapf(err, "migration %d (%s) failed", m.Version, m.Name)
+		}
+
+		// another process initializing the same database may have
+		// applied the (idempotent) migration concurrently
+		ib := sqlbuilder.NewInsertBuilder()
+		ib.InsertInto("schema_version").
+			Cols("version", "name", "applied_at").
+			Values(m.Version, m.Name, time.Now().UTC()).
+			SQL("ON CONFLICT (version) DO NOTHING")
+		s, args := ib.Build()
+		if _, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...); err != nil {
+			return pending[:i], err
+		}
+	}
+
+	return pending, nil
+}
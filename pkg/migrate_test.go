@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func newMigrateTestDB(t *testing.T) *sqlx.DB {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	db.SetMaxOpenConns(1)
+	return db
+}
+
+func TestLogWriterMigrate(t *testing.T) {
+	db := newMigrateTestDB(t)
+	ctx := context.Background()
+
+	lw := NewLogWriter(db, NewSchema())
+	pending, err := lw.Migrate(ctx, WithDryRun(true))
+	require.NoError(t, err)
+	assert.Len(t, pending, len(migrations))
+	version, err := lw.SchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, version)
+
+	require.NoError(t, lw.Init())
+	version, err = lw.SchemaVersion(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, LatestSchemaVersion(), version)
+
+	pending, err = lw.Migrate(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	_, err = db.Exec("INSERT INTO schema_version (version, name, applied_at) VALUES (?, 'from the future', CURRENT_TIMESTAMP)", LatestSchemaVersion()+1)
+	require.NoError(t, err)
+	err = NewLogWriter(db, NewSchema()).Init()
+	var versionErr *SchemaVersionError
+	require.ErrorAs(t, err, &versionErr)
+	assert.Equal(t, LatestSchemaVersion()+1, versionErr.Database)
+}
+
+func TestLogWriterMigrateUnversionedDatabase(t *testing.T) {
+	db := newMigrateTestDB(t)
+
+	// log_entries as created by the first versions of plunger
+	_, err := db.Exec(`CREATE TABLE log_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		date TIMESTAMP NOT NULL,
+		level VARCHAR(255) NOT NULL,
+		session VARCHAR(255)
+	)`)
+	require.NoError(t, err)
+
+	lw := NewLogWriter(db, NewSchema())
+	require.NoError(t, lw.Init())
+
+	_, err = lw.Write([]byte(`{"level": "info", "message": "upgraded"}`))
+	require.NoError(t, err)
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "upgraded", *entries[0].Message)
+}
+
+func TestLogWriterSchemaMismatch(t *testing.T) {
+	db := newMigrateTestDB(t)
+
+	schema := NewSchema()
+	schema.MetaKeys.Add("foo")
+	schema.MetaKeys.Add("bar")
+	require.NoError(t, NewLogWriter(db, schema).Init())
+
+	// the same keys, registered in a different order
+	schema = NewSchema()
+	schema.MetaKeys.Add("bar")
+	schema.MetaKeys.Add("foo")
+	schema.MetaKeys.Add("baz")
+	err := NewLogWriter(db, schema).Init()
+	var mismatch *SchemaMismatchError
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, []MetaKeyConflict{
+		{Key: "bar", ConfiguredID: 0, DatabaseID: 1},
+		{Key: "foo", ConfiguredID: 1, DatabaseID: 0},
+	}, mismatch.Conflicts)
+
+	lw := NewLogWriter(db, schema, WithSchemaReconciliation(SchemaReconcileUseDatabase))
+	require.NoError(t, lw.Init())
+	for name, id := range map[string]int{"foo": 0, "bar": 1, "baz": 2} {
+		key, ok := lw.schema.MetaKeys.Get(name)
+		require.True(t, ok, name)
+		assert.Equal(t, id, key.ID, name)
+	}
+
+	// a key whose id is taken by another key
+	schema = NewSchema()
+	_, err = schema.MetaKeys.AddWithID("qux", 1)
+	require.NoError(t, err)
+	err = NewLogWriter(db, schema).Init()
+	require.ErrorAs(t, err, &mismatch)
+	assert.Equal(t, []MetaKeyConflict{{Key: "qux", ConfiguredID: 1, DatabaseID: -1, DatabaseKey: "bar"}}, mismatch.Conflicts)
+
+	lw = NewLogWriter(db, schema, WithSchemaReconciliation(SchemaReconcileUseDatabase))
+	require.NoError(t, lw.Init())
+	key, ok := lw.schema.MetaKeys.Get("qux")
+	require.True(t, ok)
+	assert.Equal(t, 3, key.ID)
+}
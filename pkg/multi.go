@@ -0,0 +1,131 @@
+package pkg
+
+import (
+	"context"
+	"github.com/pkg/errors"
+	"path/filepath"
+	"sort"
+)
+
+// MultiReader searches several databases as one, for example the files
+// rotated by a RotatingWriter or the databases of several services. Each
+// database is queried separately, and the entries are merged by date.
+type MultiReader struct {
+	readers []*LogWriter
+	sources []string
+}
+
+func NewMultiReader() *MultiReader {
+	return &MultiReader{}
+}
+
+// Add adds a database to the reader. Its entries are tagged with source, see LogEntry.Source.
+func (m *MultiReader) Add(source string, logWriter *LogWriter) {
+	m.readers = append(m.readers, logWriter)
+	m.sources = append(m.sources, source)
+}
+
+// OpenMultiReader opens each of dbFiles, see OpenLogWriter. Offloaded values
+// of sqlite files are read from their DefaultBlobDir.
+func OpenMultiReader(dbFiles []string, opts ...LogWriterOption) (*MultiReader, error) {
+	m := NewMultiReader()
+	for _, dbFile := range dbFiles {
+		opts_ := opts
+		if !isPostgresDSN(dbFile) {
+			opts_ = append([]LogWriterOption{WithBlobOffloading(DefaultBlobDir(dbFile), 0)}, opts...)
+		}
+		logWriter, err := OpenLogWriter(dbFile, NewSchema(), opts_...)
+		if err != nil {
+			_ = m.Close()
+			return nil, errors.Wrapf(err, "could not open %s", dbFile)
+		}
+		m.Add(dbFile, logWriter)
+	}
+	return m, nil
+}
+
+// RotationFiles returns the files rotated from dbFile according to its
+// manifest, oldest first, followed by dbFile itself.
+func RotationFiles(dbFile string) ([]string, error) {
+	rotated, err := ReadManifest(dbFile)
+	if err != nil {
+		return nil, err
+	}
+	ret := []string{}
+	for _, f := range rotated {
+		path := f.Path
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(filepath.Dir(dbFile), path)
+		}
+		ret = append(ret, path)
+	}
+	return append(ret, dbFile), nil
+}
+
+func (m *MultiReader) Close() error {
+	var ret error
+	for _, r := range m.readers {
+		if err := r.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+func (m *MultiReader) GetEntries(filter *GetEntriesFilter) ([]*LogEntry, error) {
+	return m.GetEntriesContext(context.Background(), filter)
+}
+
+// GetEntriesContext returns the entries of all databases matching filter,
+// ordered by date. Entries with the same date are ordered by database, in
+// the order they were added, then by id.
+//
+// Limit and Offset apply to the merged entries. Ids are only unique within
+// a database, so AfterID and Cursor are not supported.
+func (m *MultiReader) GetEntriesContext(ctx context.Context, filter *GetEntriesFilter) ([]*LogEntry, error) {
+	if filter == nil {
+		filter = NewGetEntriesFilter()
+	}
+	if filter.AfterID > 0 || filter.Cursor != "" {
+		return nil, errors.New("entry ids are not unique across databases, use From instead of AfterID or Cursor")
+	}
+	if len(filter.OrderBy) > 0 || filter.Last > 0 {
+		return nil, errors.New("merged entries are ordered by date, OrderBy and Last are not supported")
+	}
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+
+	// databases return their entries by id rather than date, so pagination
+	// can only be applied after merging
+	f := *filter
+	f.Offset = 0
+	f.Limit = 0
+
+	ret := []*LogEntry{}
+	for i, r := range m.readers {
+		entries, err := r.GetEntriesContext(ctx, &f)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not query %s", m.sources[i])
+		}
+		for _, entry := range entries {
+			entry.Source = m.sources[i]
+		}
+		ret = append(ret, entries...)
+	}
+
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].Date.Before(ret[j].Date)
+	})
+
+	if filter.Offset > 0 {
+		if filter.Offset >= len(ret) {
+			return []*LogEntry{}, nil
+		}
+		ret = ret[filter.Offset:]
+	}
+	if filter.Limit > 0 && len(ret) > filter.Limit {
+		ret = ret[:filter.Limit]
+	}
+	return ret, nil
+}
@@ -0,0 +1,103 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultiReader(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.db")
+	b := filepath.Join(dir, "b.db")
+
+	for dbFile, lines := range map[string][]string{
+		a: {
+			`{"level": "info", "time": "2024-05-01T10:00:00Z", "message": "a1", "service": "a"}`,
+			`{"level": "error", "time": "2024-05-01T12:00:00Z", "message": "a2", "service": "a"}`,
+		},
+		b: {
+			// b has a meta key a doesn't know about, and entries logged out of order
+			`{"level": "warn", "time": "2024-05-01T13:00:00Z", "message": "b2", "service": "b", "extra": 1}`,
+			`{"level": "error", "time": "2024-05-01T11:00:00Z", "message": "b1", "service": "b"}`,
+			`{"level": "info", "time": "2024-05-01T12:00:00Z", "message": "b3", "service": "b"}`,
+		},
+	} {
+		lw, err := OpenLogWriter(dbFile, nil)
+		require.NoError(t, err)
+		for _, line := range lines {
+			_, err := lw.Write([]byte(line))
+			require.NoError(t, err)
+		}
+		require.NoError(t, lw.Close())
+	}
+
+	m, err := OpenMultiReader([]string{a, b})
+	require.NoError(t, err)
+	defer func(m *MultiReader) {
+		_ = m.Close()
+	}(m)
+
+	messages := func(entries []*LogEntry) []string {
+		ret := []string{}
+		for _, entry := range entries {
+			ret = append(ret, *entry.Message)
+		}
+		return ret
+	}
+
+	entries, err := m.GetEntries(nil)
+	require.NoError(t, err)
+	// a2 and b3 have the same date, a was added first
+	assert.Equal(t, []string{"a1", "b1", "a2", "b3", "b2"}, messages(entries))
+	assert.Equal(t, a, entries[0].Source)
+	assert.Equal(t, b, entries[1].Source)
+	assert.Equal(t, int64(1), entries[4].Meta["extra"])
+
+	entries, err = m.GetEntries(NewGetEntriesFilter(WithMinLevel("warn"), WithOffset(1), WithLimit(1)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a2"}, messages(entries))
+
+	entries, err = m.GetEntries(NewGetEntriesFilter(WithQueryString("extra=1 OR service=a")))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "a2", "b2"}, messages(entries))
+
+	_, err = m.GetEntries(NewGetEntriesFilter(WithAfterID(1)))
+	assert.Error(t, err)
+}
+
+func TestRotationFiles(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "app.db")
+
+	files, err := RotationFiles(dbFile)
+	require.NoError(t, err)
+	assert.Equal(t, []string{dbFile}, files)
+
+	w, err := NewRotatingWriter(dbFile, nil)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(`{"level": "info", "message": "before"}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Rotate())
+	_, err = w.Write([]byte(`{"level": "info", "message": "after"}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	files, err = RotationFiles(dbFile)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, dbFile, files[1])
+
+	m, err := OpenMultiReader(files)
+	require.NoError(t, err)
+	defer func(m *MultiReader) {
+		_ = m.Close()
+	}(m)
+	entries, err := m.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "before", *entries[0].Message)
+	assert.Equal(t, files[0], entries[0].Source)
+	assert.Equal(t, "after", *entries[1].Message)
+}
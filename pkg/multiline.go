@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"bytes"
+	"github.com/rs/zerolog"
+	"regexp"
+)
+
+// ContinuationFunc tells whether an imported line continues the entry of the
+// previous lines, such as the frames of a stack trace, see WithImportMultiline.
+type ContinuationFunc func(line []byte) bool
+
+// exceptionLinePattern matches the lines naming an exception in Java and
+// Python stack traces, such as java.lang.IllegalStateException: closed or
+// ValueError: invalid literal.
+var exceptionLinePattern = regexp.MustCompile(`^(?:[\w$]+\.)*[\w$]*(?:Exception|Error)\b(?::|$)`)
+
+// IndentedContinuation is the default ContinuationFunc. Indented lines
+// continue the previous entry, as do the lines of Java and Python stack
+// traces that aren't indented: Traceback, Caused by and Suppressed headers,
+// and the lines naming the exception.
+func IndentedContinuation(line []byte) bool {
+	if line[0] == ' ' || line[0] == '\t' {
+		return true
+	}
+	for _, prefix := range []string{"Traceback (", "Caused by: ", "Suppressed: ", "During handling of the above exception"} {
+		if bytes.HasPrefix(line, []byte(prefix)) {
+			return true
+		}
+	}
+	return exceptionLinePattern.Match(line)
+}
+
+// ContinuationPattern returns a ContinuationFunc matching the lines that
+// match re, for example ^\s or ^[^\[] for logs whose entries start with a
+// bracketed timestamp.
+func ContinuationPattern(re *regexp.Regexp) ContinuationFunc {
+	return re.Match
+}
+
+// WithImportMultiline reassembles entries spanning several lines, such as
+// messages followed by a stack trace. Lines for which continuation returns
+// true are not parsed, they are appended to the stack field of the entry of
+// the previous line, as text separated by newlines. A nil continuation uses
+// IndentedContinuation.
+//
+// It has no effect with a RecordParser, which splits records itself.
+func WithImportMultiline(continuation ContinuationFunc) ImportOption {
+	return func(i *importer) {
+		if continuation == nil {
+			continuation = IndentedContinuation
+		}
+		i.continuation = continuation
+	}
+}
+
+// appendContinuation appends the continuation lines to the stack field of
+// entry, after the stack it already has if it was logged as a string.
+func appendContinuation(entry map[string]interface{}, lines []string) {
+	buf := bytes.Buffer{}
+	if s, ok := entry[zerolog.ErrorStackFieldName].(string); ok && s != "" {
+		buf.WriteString(s)
+		buf.WriteByte('\n')
+	}
+	for idx, line := range lines {
+		if idx > 0 {
+			buf.WriteByte('\n')
+		}
+		buf.WriteString(line)
+	}
+	entry[zerolog.ErrorStackFieldName] = buf.String()
+}
@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"strings"
+)
+
+// SortDirection is the direction entries are sorted in, see WithOrderBy.
+type SortDirection string
+
+const (
+	Asc  SortDirection = "ASC"
+	Desc SortDirection = "DESC"
+)
+
+// orderColumns are the keys WithOrderBy sorts on a column of log_entries,
+// other keys are meta keys.
+var orderColumns = map[string]string{
+	"id":      "id",
+	"date":    "date",
+	"level":   "level",
+	"session": "session",
+	"message": "message",
+	"caller":  "caller_file",
+	"error":   "error_message",
+}
+
+// OrderBy sorts entries on Key, either a column such as date or level, or
+// a numeric meta key.
+type OrderBy struct {
+	Key       string
+	Direction SortDirection
+}
+
+func (o OrderBy) String() string {
+	return o.Key + ":" + strings.ToLower(string(o.Direction))
+}
+
+// InvalidOrderError is returned by Validate for orders GetEntries can't apply.
+type InvalidOrderError struct {
+	Reason string
+}
+
+func (e *InvalidOrderError) Error() string {
+	return "invalid order: " + e.Reason
+}
+
+// ParseOrderBy parses key, key:asc or key:desc.
+func ParseOrderBy(s string) (OrderBy, error) {
+	key, direction := s, "asc"
+	if i := strings.LastIndex(s, ":"); i >= 0 {
+		key, direction = s[:i], s[i+1:]
+	}
+	if key == "" {
+		return OrderBy{}, &InvalidOrderError{Reason: fmt.Sprintf("missing key in %q", s)}
+	}
+	switch strings.ToLower(direction) {
+	case "asc":
+		return OrderBy{Key: key, Direction: Asc}, nil
+	case "desc":
+		return OrderBy{Key: key, Direction: Desc}, nil
+	}
+	return OrderBy{}, &InvalidOrderError{Reason: fmt.Sprintf("unknown direction %q, expected asc or desc", direction)}
+}
+
+// WithOrderBy sorts the entries on key, by default they are sorted by id.
+// Calling it again adds secondary sort keys. Meta keys are sorted by their
+// numeric value, entries without a value come last.
+func WithOrderBy(key string, direction SortDirection) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.OrderBy = append(f.OrderBy, OrderBy{Key: key, Direction: direction})
+	}
+}
+
+// WithLast only returns the last n entries written that match the filter,
+// in the order of the filter.
+func WithLast(n int) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Last = n
+	}
+}
+
+// validateOrder checks OrderBy and Last.
+func (gef *GetEntriesFilter) validateOrder() error {
+	for _, o := range gef.OrderBy {
+		if o.Direction != Asc && o.Direction != Desc {
+			return &InvalidOrderError{Reason: fmt.Sprintf("unknown direction %q for %s", o.Direction, o.Key)}
+		}
+	}
+	if gef.Last > 0 && (gef.Limit > 0 || gef.Offset > 0 || gef.Cursor != "") {
+		return &InvalidOrderError{Reason: "last can't be combined with limit, offset or cursor"}
+	}
+	return nil
+}
+
+// applyOrder sorts q, a query of log_entries, according to OrderBy. The id
+// is used as last key, so that the order is stable.
+func (gef *GetEntriesFilter) applyOrder(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder) {
+	direction := Asc
+	exprs := []string{}
+	for _, o := range gef.OrderBy {
+		direction = o.Direction
+		if column, ok := orderColumns[o.Key]; ok {
+			exprs = append(exprs, column+" "+string(o.Direction))
+			if column == "id" {
+				break
+			}
+			continue
+		}
+		value := orderValueExpression(metaKeys, q, o.Key)
+		// sqlite and postgres disagree on where NULLs go
+		exprs = append(exprs, value+" IS NULL", value+" "+string(o.Direction))
+	}
+	if len(exprs) == 0 || !strings.HasPrefix(exprs[len(exprs)-1], "id ") {
+		exprs = append(exprs, "id "+string(direction))
+	}
+	q.OrderBy(exprs...)
+}
+
+// orderValueExpression returns a scalar subquery selecting the numeric value
+// of key for the entries of q. The first element of exploded arrays is used.
+func orderValueExpression(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder, key string) string {
+	value := "COALESCE(lem.int_value, lem.real_value)"
+	sub := sqlbuilder.Select(value).From("log_entries_meta lem")
+	sub.Where("lem.log_entry_id = log_entries.id", metaKeyCondition(metaKeys, key),
+		"COALESCE(lem.array_index, 0) = 0")
+	if metaKey, ok := metaKeys.Get(key); ok && metaKey.Wide {
+		wide := sqlbuilder.Select(wideExpression(metaKey, value)).From(wideTable + " lem")
+		wide.Where("lem.log_entry_id = log_entries.id")
+		return "COALESCE((" + q.Var(sub) + "), (" + q.Var(wide) + "))"
+	}
+	return "(" + q.Var(sub) + ")"
+}
@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func entryMessages(entries []*LogEntry) []string {
+	ret := []string{}
+	for _, entry := range entries {
+		ret = append(ret, *entry.Message)
+	}
+	return ret
+}
+
+func TestGetEntriesOrder(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	for _, line := range []string{
+		`{"level":"info","time":"2023-05-01T10:00:02Z","message":"a","elapsed":30}`,
+		`{"level":"error","time":"2023-05-01T10:00:00Z","message":"b","elapsed":5.5}`,
+		`{"level":"info","time":"2023-05-01T10:00:01Z","message":"c"}`,
+		`{"level":"info","time":"2023-05-01T10:00:01Z","message":"d","elapsed":100}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	for _, tc := range []struct {
+		opts     []GetEntriesFilterOption
+		expected []string
+	}{
+		{nil, []string{"a", "b", "c", "d"}},
+		{[]GetEntriesFilterOption{WithOrderBy("date", Desc)}, []string{"a", "d", "c", "b"}},
+		{[]GetEntriesFilterOption{WithOrderBy("level", Asc), WithOrderBy("date", Asc)}, []string{"b", "c", "d", "a"}},
+		// entries without a value come last in both directions
+		{[]GetEntriesFilterOption{WithOrderBy("elapsed", Asc)}, []string{"b", "a", "d", "c"}},
+		{[]GetEntriesFilterOption{WithOrderBy("elapsed", Desc)}, []string{"d", "a", "b", "c"}},
+		{[]GetEntriesFilterOption{WithLast(2)}, []string{"c", "d"}},
+		{[]GetEntriesFilterOption{WithLast(2), WithOrderBy("id", Desc)}, []string{"d", "c"}},
+		{[]GetEntriesFilterOption{WithLast(2), WithLevel("info")}, []string{"c", "d"}},
+	} {
+		entries, err := lw.GetEntries(NewGetEntriesFilter(tc.opts...))
+		require.NoError(t, err)
+		assert.Equal(t, tc.expected, entryMessages(entries))
+	}
+
+	// ordered pages are skipped by offset
+	page, err := lw.GetEntriesPage(NewGetEntriesFilter(WithOrderBy("date", Desc), WithLimit(3)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "d", "c"}, entryMessages(page.Entries))
+	page, err = lw.GetEntriesPage(NewGetEntriesFilter(WithOrderBy("date", Desc), WithLimit(3), WithCursor(page.NextCursor)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b"}, entryMessages(page.Entries))
+	assert.Empty(t, page.NextCursor)
+	page, err = lw.GetEntriesPage(NewGetEntriesFilter(WithLast(3)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b", "c", "d"}, entryMessages(page.Entries))
+
+	_, err = lw.GetEntries(NewGetEntriesFilter(WithLast(2), WithLimit(1)))
+	var orderErr *InvalidOrderError
+	assert.ErrorAs(t, err, &orderErr)
+	_, err = lw.GetEntries(NewGetEntriesFilter(WithOrderBy("date", "sideways")))
+	assert.ErrorAs(t, err, &orderErr)
+}
+
+func TestParseOrderBy(t *testing.T) {
+	o, err := ParseOrderBy("date")
+	require.NoError(t, err)
+	assert.Equal(t, OrderBy{Key: "date", Direction: Asc}, o)
+	o, err = ParseOrderBy("http.status:DESC")
+	require.NoError(t, err)
+	assert.Equal(t, OrderBy{Key: "http.status", Direction: Desc}, o)
+	assert.Equal(t, "http.status:desc", o.String())
+	_, err = ParseOrderBy("date:up")
+	assert.Error(t, err)
+}
@@ -0,0 +1,315 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	tracecollectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type Protocol string
+
+const (
+	// ProtocolHTTP posts protobuf encoded requests to <endpoint>/v1/logs,
+	// and spans to <endpoint>/v1/traces.
+	ProtocolHTTP Protocol = "http/protobuf"
+	// ProtocolGRPC calls the LogsService and TraceService of the endpoint, as
+	// host:port.
+	ProtocolGRPC Protocol = "grpc"
+)
+
+const (
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = 5 * time.Second
+	DefaultTimeout       = 10 * time.Second
+)
+
+// ExportError is returned if the endpoint rejects an OTLP/HTTP request.
+type ExportError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *ExportError) Error() string {
+	return fmt.Sprintf("OTLP export failed with status %d: %s", e.StatusCode, e.Body)
+}
+
+// Exporter pushes entries, and spans, to an OTLP endpoint.
+type Exporter struct {
+	endpoint    string
+	protocol    Protocol
+	headers     map[string]string
+	serviceName string
+	timeout     time.Duration
+	batchSize   int
+	interval    time.Duration
+
+	httpClient *http.Client
+	conn       *grpc.ClientConn
+	client     collectorpb.LogsServiceClient
+	// spans are posted to traceURL with ProtocolHTTP, and sent with
+	// traces with ProtocolGRPC
+	traceURL string
+	traces   tracecollectorpb.TraceServiceClient
+}
+
+type ExporterOption func(*Exporter)
+
+func WithProtocol(protocol Protocol) ExporterOption {
+	return func(e *Exporter) {
+		e.protocol = protocol
+	}
+}
+
+// WithHeaders adds headers (or gRPC metadata) to each request, for example for authentication.
+func WithHeaders(headers map[string]string) ExporterOption {
+	return func(e *Exporter) {
+		for k, v := range headers {
+			e.headers[k] = v
+		}
+	}
+}
+
+// WithServiceName sets the service.name resource attribute, "plunger" by default.
+func WithServiceName(name string) ExporterOption {
+	return func(e *Exporter) {
+		e.serviceName = name
+	}
+}
+
+func WithTimeout(timeout time.Duration) ExporterOption {
+	return func(e *Exporter) {
+		e.timeout = timeout
+	}
+}
+
+// WithBatchSize sets the maximum number of entries sent per request by
+// ExportEntries and Follow.
+func WithBatchSize(n int) ExporterOption {
+	return func(e *Exporter) {
+		e.batchSize = n
+	}
+}
+
+// WithFlushInterval sets how long Follow buffers entries before sending an
+// incomplete batch.
+func WithFlushInterval(interval time.Duration) ExporterOption {
+	return func(e *Exporter) {
+		e.interval = interval
+	}
+}
+
+// NewExporter creates an exporter for endpoint, which is an URL like
+// http://localhost:4318 for ProtocolHTTP, and host:port for ProtocolGRPC.
+func NewExporter(endpoint string, opts ...ExporterOption) (*Exporter, error) {
+	e := &Exporter{
+		endpoint:    endpoint,
+		protocol:    ProtocolHTTP,
+		headers:     map[string]string{},
+		serviceName: "plunger",
+		timeout:     DefaultTimeout,
+		batchSize:   DefaultBatchSize,
+		interval:    DefaultFlushInterval,
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	if e.batchSize <= 0 {
+		e.batchSize = DefaultBatchSize
+	}
+
+	switch e.protocol {
+	case ProtocolHTTP:
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid OTLP endpoint %q", endpoint)
+		}
+		if u.Path == "" || u.Path == "/" {
+			u.Path = "/v1/logs"
+		}
+		e.endpoint = u.String()
+		// spans go to the traces path next to the logs path, or to the
+		// endpoint itself if it has a custom path
+		e.traceURL = e.endpoint
+		if strings.HasSuffix(u.Path, "/v1/logs") {
+			e.traceURL = u.JoinPath("../traces").String()
+		}
+		e.httpClient = &http.Client{Timeout: e.timeout}
+	case ProtocolGRPC:
+		conn, err := grpc.Dial(endpoint, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			return nil, err
+		}
+		e.conn = conn
+		e.client = collectorpb.NewLogsServiceClient(conn)
+		e.traces = tracecollectorpb.NewTraceServiceClient(conn)
+	default:
+		return nil, errors.Errorf("unknown OTLP protocol %q", e.protocol)
+	}
+
+	return e, nil
+}
+
+func (e *Exporter) Close() error {
+	if e.conn != nil {
+		return e.conn.Close()
+	}
+	return nil
+}
+
+// Export sends entries in a single request.
+func (e *Exporter) Export(ctx context.Context, entries []*pkg.LogEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	req := &collectorpb.ExportLogsServiceRequest{
+		ResourceLogs: ToResourceLogs(entries, e.serviceName),
+	}
+
+	if e.client != nil {
+		ctx, cancel := e.grpcContext(ctx)
+		defer cancel()
+		_, err := e.client.Export(ctx, req)
+		return err
+	}
+	return e.post(ctx, e.endpoint, req)
+}
+
+// ExportSpans sends spans, as returned by LogWriter.GetSpans, in a single
+// request. Open spans are skipped.
+func (e *Exporter) ExportSpans(ctx context.Context, spans []*pkg.SpanRecord) error {
+	resourceSpans := ToResourceSpans(spans, e.serviceName)
+	if len(resourceSpans) == 0 {
+		return nil
+	}
+	req := &tracecollectorpb.ExportTraceServiceRequest{
+		ResourceSpans: resourceSpans,
+	}
+
+	if e.traces != nil {
+		ctx, cancel := e.grpcContext(ctx)
+		defer cancel()
+		_, err := e.traces.Export(ctx, req)
+		return err
+	}
+	return e.post(ctx, e.traceURL, req)
+}
+
+func (e *Exporter) grpcContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, e.timeout)
+	if len(e.headers) > 0 {
+		ctx = metadata.NewOutgoingContext(ctx, metadata.New(e.headers))
+	}
+	return ctx, cancel
+}
+
+// post sends req to the OTLP/HTTP endpoint u.
+func (e *Exporter) post(ctx context.Context, u string, req proto.Message) error {
+	body, err := proto.Marshal(req)
+	if err != nil {
+		return err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	for k, v := range e.headers {
+		httpReq.Header.Set(k, v)
+	}
+
+	res, err := e.httpClient.Do(httpReq)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(res.Body, 4096))
+		return &ExportError{StatusCode: res.StatusCode, Body: string(b)}
+	}
+	_, _ = io.Copy(io.Discard, res.Body)
+	return nil
+}
+
+// ExportEntries exports the stored entries matching filter in batches, and
+// returns the number of exported entries.
+func (e *Exporter) ExportEntries(ctx context.Context, lw *pkg.LogWriter, filter *pkg.GetEntriesFilter) (int, error) {
+	f := pkg.NewGetEntriesFilter()
+	if filter != nil {
+		f_ := *filter
+		f = &f_
+	}
+	f.Limit = e.batchSize
+
+	exported := 0
+	for {
+		page, err := lw.GetEntriesPageContext(ctx, f)
+		if err != nil {
+			return exported, err
+		}
+		if err := e.Export(ctx, page.Entries); err != nil {
+			return exported, err
+		}
+		exported += len(page.Entries)
+		if page.NextCursor == "" {
+			return exported, nil
+		}
+		f.Cursor = page.NextCursor
+		f.Offset = 0
+	}
+}
+
+// Follow exports the entries matching filter as they get written, until ctx
+// is done. Entries are sent once a batch is full, or after the flush interval.
+func (e *Exporter) Follow(ctx context.Context, lw *pkg.LogWriter, filter *pkg.GetEntriesFilter) error {
+	entries, err := lw.Follow(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	batch := []*pkg.LogEntry{}
+	flush := func(ctx context.Context) error {
+		err := e.Export(ctx, batch)
+		batch = batch[:0]
+		return err
+	}
+
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				// ctx is done, send what was buffered
+				flushCtx, cancel := context.WithTimeout(context.Background(), e.timeout)
+				defer cancel()
+				return flush(flushCtx)
+			}
+			batch = append(batch, entry)
+			if len(batch) >= e.batchSize {
+				if err := flush(ctx); err != nil {
+					return err
+				}
+			}
+		case <-ticker.C:
+			if err := flush(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
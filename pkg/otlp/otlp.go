@@ -0,0 +1,181 @@
+// Package otlp converts plunger entries to OpenTelemetry log records and
+// pushes them to an OTLP endpoint, such as an OpenTelemetry collector.
+//
+// Entries are grouped by session: each session becomes a ResourceLogs whose
+// resource carries the session id (plunger.session) next to service.name.
+// The message becomes the body of the record, the level its severity, and
+// the meta values its attributes. The trace and span ids of the entry, as hex
+// strings, are moved to the trace context of the record.
+//
+// The timed spans of sessions are exported as OpenTelemetry spans, see
+// ToResourceSpans.
+package otlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	"sort"
+	"strings"
+)
+
+const (
+	// SessionAttribute is the resource attribute holding the plunger session.
+	SessionAttribute = "plunger.session"
+	// ScopeName is the instrumentation scope of the exported records.
+	ScopeName = "github.com/go-go-golems/plunger"
+)
+
+var severities = map[string]logspb.SeverityNumber{
+	"trace":   logspb.SeverityNumber_SEVERITY_NUMBER_TRACE,
+	"debug":   logspb.SeverityNumber_SEVERITY_NUMBER_DEBUG,
+	"info":    logspb.SeverityNumber_SEVERITY_NUMBER_INFO,
+	"warn":    logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"warning": logspb.SeverityNumber_SEVERITY_NUMBER_WARN,
+	"error":   logspb.SeverityNumber_SEVERITY_NUMBER_ERROR,
+	"fatal":   logspb.SeverityNumber_SEVERITY_NUMBER_FATAL,
+	"panic":   logspb.SeverityNumber_SEVERITY_NUMBER_FATAL4,
+}
+
+// Severity maps a zerolog level to an OTLP severity number.
+func Severity(level string) logspb.SeverityNumber {
+	return severities[strings.ToLower(level)]
+}
+
+// ToLogRecord converts a single entry.
+func ToLogRecord(entry *pkg.LogEntry) *logspb.LogRecord {
+	ts := uint64(entry.Date.UnixNano())
+	record := &logspb.LogRecord{
+		TimeUnixNano:         ts,
+		ObservedTimeUnixNano: ts,
+		SeverityNumber:       Severity(entry.Level),
+		SeverityText:         entry.Level,
+	}
+	if entry.Message != nil {
+		record.Body = stringValue(*entry.Message)
+	}
+
+	// the trace ids are stored in their own columns, older entries have them as meta
+	meta := entry.Meta
+	if entry.TraceID != nil || entry.SpanID != nil {
+		meta = map[string]interface{}{}
+		for k, v := range entry.Meta {
+			meta[k] = v
+		}
+		if entry.TraceID != nil {
+			meta["trace_id"] = *entry.TraceID
+		}
+		if entry.SpanID != nil {
+			meta["span_id"] = *entry.SpanID
+		}
+	}
+
+	keys := make([]string, 0, len(meta))
+	for k := range meta {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		v := meta[k]
+		switch k {
+		case "trace_id", "span_id":
+			if s, ok := v.(string); ok {
+				if id, err := hex.DecodeString(s); err == nil {
+					if k == "trace_id" && len(id) == 16 {
+						record.TraceId = id
+						continue
+					}
+					if k == "span_id" && len(id) == 8 {
+						record.SpanId = id
+						continue
+					}
+				}
+			}
+		}
+		record.Attributes = append(record.Attributes, &commonpb.KeyValue{Key: k, Value: ToAnyValue(v)})
+	}
+	if entry.Error != nil {
+		record.Attributes = append(record.Attributes, &commonpb.KeyValue{Key: "error", Value: stringValue(*entry.Error)})
+	}
+
+	return record
+}
+
+// ToResourceLogs converts entries, grouped by session in order of first appearance.
+func ToResourceLogs(entries []*pkg.LogEntry, serviceName string) []*logspb.ResourceLogs {
+	ret := []*logspb.ResourceLogs{}
+	scopes := map[string]*logspb.ScopeLogs{}
+
+	for _, entry := range entries {
+		session := ""
+		if entry.Session != nil {
+			session = *entry.Session
+		}
+
+		scope, ok := scopes[session]
+		if !ok {
+			attributes := []*commonpb.KeyValue{}
+			if serviceName != "" {
+				attributes = append(attributes, &commonpb.KeyValue{Key: "service.name", Value: stringValue(serviceName)})
+			}
+			if session != "" {
+				attributes = append(attributes, &commonpb.KeyValue{Key: SessionAttribute, Value: stringValue(session)})
+			}
+			scope = &logspb.ScopeLogs{Scope: &commonpb.InstrumentationScope{Name: ScopeName}}
+			scopes[session] = scope
+			ret = append(ret, &logspb.ResourceLogs{
+				Resource:  &resourcepb.Resource{Attributes: attributes},
+				ScopeLogs: []*logspb.ScopeLogs{scope},
+			})
+		}
+		scope.LogRecords = append(scope.LogRecords, ToLogRecord(entry))
+	}
+
+	return ret
+}
+
+func stringValue(s string) *commonpb.AnyValue {
+	return &commonpb.AnyValue{Value: &commonpb.AnyValue_StringValue{StringValue: s}}
+}
+
+// ToAnyValue converts a meta value, as returned by GetEntries.
+func ToAnyValue(v interface{}) *commonpb.AnyValue {
+	switch v := v.(type) {
+	case nil:
+		return &commonpb.AnyValue{}
+	case string:
+		return stringValue(v)
+	case bool:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BoolValue{BoolValue: v}}
+	case int64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: v}}
+	case int:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_IntValue{IntValue: int64(v)}}
+	case float64:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_DoubleValue{DoubleValue: v}}
+	case []byte:
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_BytesValue{BytesValue: v}}
+	case []interface{}:
+		values := []*commonpb.AnyValue{}
+		for _, item := range v {
+			values = append(values, ToAnyValue(item))
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_ArrayValue{ArrayValue: &commonpb.ArrayValue{Values: values}}}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		values := []*commonpb.KeyValue{}
+		for _, k := range keys {
+			values = append(values, &commonpb.KeyValue{Key: k, Value: ToAnyValue(v[k])})
+		}
+		return &commonpb.AnyValue{Value: &commonpb.AnyValue_KvlistValue{KvlistValue: &commonpb.KeyValueList{Values: values}}}
+	}
+	return stringValue(fmt.Sprint(v))
+}
@@ -0,0 +1,117 @@
+package otlp
+
+import (
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	collectorpb "go.opentelemetry.io/proto/otlp/collector/logs/v1"
+	logspb "go.opentelemetry.io/proto/otlp/logs/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestToLogRecord(t *testing.T) {
+	message := "hello"
+	record := ToLogRecord(&pkg.LogEntry{
+		Date:    time.Unix(10, 5).UTC(),
+		Level:   "warn",
+		Message: &message,
+		Meta: map[string]interface{}{
+			"trace_id": "0102030405060708090a0b0c0d0e0f10",
+			"span_id":  "not hex",
+			"n":        int64(3),
+			"tags":     []interface{}{"a", true},
+		},
+	})
+
+	assert.Equal(t, uint64(10_000_000_005), record.TimeUnixNano)
+	assert.Equal(t, logspb.SeverityNumber_SEVERITY_NUMBER_WARN, record.SeverityNumber)
+	assert.Equal(t, "hello", record.Body.GetStringValue())
+	assert.Len(t, record.TraceId, 16)
+	assert.Nil(t, record.SpanId)
+
+	attributes := map[string]interface{}{}
+	for _, kv := range record.Attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	require.Len(t, attributes, 3)
+	assert.Equal(t, int64(3), record.Attributes[0].Value.GetIntValue())
+	assert.Equal(t, "span_id", record.Attributes[1].Key)
+	assert.Len(t, record.Attributes[2].Value.GetArrayValue().Values, 2)
+}
+
+func TestExporterHTTP(t *testing.T) {
+	var mu sync.Mutex
+	requests := []*collectorpb.ExportLogsServiceRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/logs", r.URL.Path)
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		req := &collectorpb.ExportLogsServiceRequest{}
+		require.NoError(t, proto.Unmarshal(body, req))
+		mu.Lock()
+		requests = append(requests, req)
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	lw := pkg.NewLogWriter(db, pkg.NewSchema())
+	require.NoError(t, lw.Init())
+	for _, line := range []string{
+		`{"level": "info", "message": "a", "session": "s1"}`,
+		`{"level": "error", "message": "b", "session": "s2"}`,
+		`{"level": "info", "message": "c", "session": "s1"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	exporter, err := NewExporter(server.URL,
+		WithHeaders(map[string]string{"Authorization": "secret"}),
+		WithServiceName("test"),
+		WithBatchSize(2))
+	require.NoError(t, err)
+	defer func(exporter *Exporter) {
+		_ = exporter.Close()
+	}(exporter)
+
+	n, err := exporter.ExportEntries(context.Background(), lw, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 3, n)
+
+	require.Len(t, requests, 2)
+	first := requests[0].ResourceLogs
+	require.Len(t, first, 2)
+	assert.Equal(t, "service.name", first[0].Resource.Attributes[0].Key)
+	assert.Equal(t, "s1", first[0].Resource.Attributes[1].Value.GetStringValue())
+	assert.Equal(t, "s2", first[1].Resource.Attributes[1].Value.GetStringValue())
+	assert.Equal(t, "c", requests[1].ResourceLogs[0].ScopeLogs[0].LogRecords[0].Body.GetStringValue())
+}
+
+func TestExporterHTTPError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	exporter, err := NewExporter(server.URL)
+	require.NoError(t, err)
+	err = exporter.Export(context.Background(), []*pkg.LogEntry{{Level: "info"}})
+	var exportErr *ExportError
+	require.ErrorAs(t, err, &exportErr)
+	assert.Equal(t, http.StatusBadRequest, exportErr.StatusCode)
+}
@@ -0,0 +1,88 @@
+package otlp
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"github.com/go-go-golems/plunger/pkg"
+	commonpb "go.opentelemetry.io/proto/otlp/common/v1"
+	resourcepb "go.opentelemetry.io/proto/otlp/resource/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+)
+
+// Spans are exported as OpenTelemetry spans, the spans of each session
+// forming a trace whose id is derived from the session id, so that exporting
+// a session again updates the same trace. Span ids are derived from the ids
+// of the spans table. Open spans are not exported, as OTLP spans need an end.
+
+// SessionTraceID returns the trace id of the spans of session.
+func SessionTraceID(session string) []byte {
+	sum := sha256.Sum256([]byte("plunger.session:" + session))
+	return sum[:16]
+}
+
+func spanID(id int) []byte {
+	ret := make([]byte, 8)
+	binary.BigEndian.PutUint64(ret, uint64(id))
+	return ret
+}
+
+// ToSpan converts a single span, returning nil if it is open.
+func ToSpan(span *pkg.SpanRecord) *tracepb.Span {
+	if span.Duration == nil {
+		return nil
+	}
+	session := ""
+	if span.SessionID != nil {
+		session = *span.SessionID
+	}
+	ret := &tracepb.Span{
+		TraceId:           SessionTraceID(session),
+		SpanId:            spanID(span.ID),
+		Name:              span.Name,
+		Kind:              tracepb.Span_SPAN_KIND_INTERNAL,
+		StartTimeUnixNano: uint64(span.StartedAt.UnixNano()),
+		EndTimeUnixNano:   uint64(span.StartedAt.Add(*span.Duration).UnixNano()),
+	}
+	if span.ParentID != nil {
+		ret.ParentSpanId = spanID(*span.ParentID)
+	}
+	return ret
+}
+
+// ToResourceSpans converts spans, grouped by session in order of first
+// appearance.
+func ToResourceSpans(spans []*pkg.SpanRecord, serviceName string) []*tracepb.ResourceSpans {
+	ret := []*tracepb.ResourceSpans{}
+	scopes := map[string]*tracepb.ScopeSpans{}
+
+	for _, span := range spans {
+		s := ToSpan(span)
+		if s == nil {
+			continue
+		}
+		session := ""
+		if span.SessionID != nil {
+			session = *span.SessionID
+		}
+
+		scope, ok := scopes[session]
+		if !ok {
+			attributes := []*commonpb.KeyValue{}
+			if serviceName != "" {
+				attributes = append(attributes, &commonpb.KeyValue{Key: "service.name", Value: stringValue(serviceName)})
+			}
+			if session != "" {
+				attributes = append(attributes, &commonpb.KeyValue{Key: SessionAttribute, Value: stringValue(session)})
+			}
+			scope = &tracepb.ScopeSpans{Scope: &commonpb.InstrumentationScope{Name: ScopeName}}
+			scopes[session] = scope
+			ret = append(ret, &tracepb.ResourceSpans{
+				Resource:   &resourcepb.Resource{Attributes: attributes},
+				ScopeSpans: []*tracepb.ScopeSpans{scope},
+			})
+		}
+		scope.Spans = append(scope.Spans, s)
+	}
+
+	return ret
+}
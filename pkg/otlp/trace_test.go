@@ -0,0 +1,51 @@
+package otlp
+
+import (
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	tracecollectorpb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	"google.golang.org/protobuf/proto"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestExportSpans(t *testing.T) {
+	var path string
+	req := &tracecollectorpb.ExportTraceServiceRequest{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		require.NoError(t, proto.Unmarshal(body, req))
+	}))
+	defer server.Close()
+
+	session := "s1"
+	parent := 1
+	second := time.Second
+	spans := []*pkg.SpanRecord{
+		{ID: 1, SessionID: &session, Name: "build", StartedAt: time.Unix(10, 0), Duration: &second},
+		{ID: 2, SessionID: &session, Name: "compile", ParentID: &parent, StartedAt: time.Unix(10, 5), Duration: &second},
+		{ID: 3, SessionID: &session, Name: "open", StartedAt: time.Unix(11, 0)},
+	}
+
+	exporter, err := NewExporter(server.URL)
+	require.NoError(t, err)
+	require.NoError(t, exporter.ExportSpans(context.Background(), spans))
+
+	assert.Equal(t, "/v1/traces", path)
+	require.Len(t, req.ResourceSpans, 1)
+	exported := req.ResourceSpans[0].ScopeSpans[0].Spans
+	require.Len(t, exported, 2)
+	assert.Equal(t, SessionTraceID("s1"), exported[0].TraceId)
+	assert.Equal(t, exported[0].TraceId, exported[1].TraceId)
+	assert.Nil(t, exported[0].ParentSpanId)
+	assert.Equal(t, exported[0].SpanId, exported[1].ParentSpanId)
+	assert.Equal(t, uint64(10_000_000_005), exported[1].StartTimeUnixNano)
+	assert.Equal(t, uint64(11_000_000_005), exported[1].EndTimeUnixNano)
+}
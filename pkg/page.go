@@ -0,0 +1,202 @@
+package pkg
+
+import (
+	"context"
+	"encoding/base64"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageSize is the page size used by GetEntriesPage when the filter has no limit.
+const DefaultPageSize = 100
+
+const (
+	cursorPrefix       = "after:"
+	offsetCursorPrefix = "offset:"
+)
+
+func WithLimit(limit int) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Limit = limit
+	}
+}
+
+func WithOffset(offset int) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Offset = offset
+	}
+}
+
+// WithCursor continues a query after the last entry of a page returned by GetEntriesPage.
+func WithCursor(cursor string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Cursor = cursor
+	}
+}
+
+func (gef *GetEntriesFilter) applyPagination(q *sqlbuilder.SelectBuilder) {
+	if gef.Limit > 0 {
+		q.Limit(gef.Limit)
+	}
+	if gef.Offset > 0 {
+		// sqlite only accepts OFFSET after a LIMIT clause
+		if gef.Limit <= 0 {
+			q.Limit(math.MaxInt32)
+		}
+		q.Offset(gef.Offset)
+	}
+}
+
+// EntriesPage is a page of entries, along with the cursor to fetch the next page.
+type EntriesPage struct {
+	Entries []*LogEntry `json:"entries"`
+	// NextCursor is empty if this is the last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// EncodeCursor returns an opaque cursor pointing after the entry with the given id.
+func EncodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(cursorPrefix + strconv.Itoa(id)))
+}
+
+// DecodeCursor returns the entry id a cursor created by EncodeCursor points after.
+func DecodeCursor(cursor string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid cursor %q", cursor)
+	}
+	s := string(b)
+	if !strings.HasPrefix(s, cursorPrefix) {
+		return 0, errors.Errorf("invalid cursor %q", cursor)
+	}
+	id, err := strconv.Atoi(strings.TrimPrefix(s, cursorPrefix))
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid cursor %q", cursor)
+	}
+	return id, nil
+}
+
+// encodeOffsetCursor returns a cursor skipping the first offset entries,
+// for the pages of filters with an OrderBy, which aren't sorted by id.
+func encodeOffsetCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(offsetCursorPrefix + strconv.Itoa(offset)))
+}
+
+// resolveCursor returns the filter with its cursor replaced by the AfterID
+// or Offset it stands for.
+func (gef *GetEntriesFilter) resolveCursor() (*GetEntriesFilter, error) {
+	if gef.Cursor == "" {
+		return gef, nil
+	}
+	f := *gef
+	f.Cursor = ""
+
+	if b, err := base64.RawURLEncoding.DecodeString(gef.Cursor); err == nil && strings.HasPrefix(string(b), offsetCursorPrefix) {
+		offset, err := strconv.Atoi(strings.TrimPrefix(string(b), offsetCursorPrefix))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid cursor %q", gef.Cursor)
+		}
+		f.Offset = offset
+		return &f, nil
+	}
+
+	afterID, err := DecodeCursor(gef.Cursor)
+	if err != nil {
+		return nil, err
+	}
+	if afterID > f.AfterID {
+		f.AfterID = afterID
+	}
+	return &f, nil
+}
+
+// GetEntriesPage returns at most filter.Limit entries (DefaultPageSize if unset),
+// along with a cursor to retrieve the next page using WithCursor.
+//
+// Pages are keyed on the entry id, so that entries written while paginating
+// don't shift the pages, contrary to using WithOffset. Filters with an
+// OrderBy can't be keyed on the id, their pages are skipped by offset.
+// Filters with Last return a single page.
+func (l *LogWriter) GetEntriesPage(filter *GetEntriesFilter) (*EntriesPage, error) {
+	return l.GetEntriesPageContext(context.Background(), filter)
+}
+
+func (l *LogWriter) GetEntriesPageContext(ctx context.Context, filter *GetEntriesFilter) (*EntriesPage, error) {
+	f := NewGetEntriesFilter()
+	if filter != nil {
+		f_ := *filter
+		f = &f_
+	}
+	if f.Last > 0 {
+		// the last entries make a single page
+		entries, err := l.GetEntriesContext(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		return &EntriesPage{Entries: entries}, nil
+	}
+
+	pageSize := f.Limit
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	// fetch one more entry to know whether there is a next page
+	f.Limit = pageSize + 1
+	// pages are made of matching entries, the surrounding entries are added afterwards
+	contextFilter := *f
+	f.ContextBefore, f.ContextAfter = 0, 0
+
+	entries, err := l.GetEntriesContext(ctx, f)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &EntriesPage{Entries: entries}
+	if len(entries) > pageSize {
+		page.Entries = entries[:pageSize]
+		if len(f.OrderBy) > 0 {
+			page.NextCursor = encodeOffsetCursor(f.Offset + pageSize)
+		} else {
+			page.NextCursor = EncodeCursor(page.Entries[pageSize-1].ID)
+		}
+	}
+
+	page.Entries, err = l.addContext(ctx, &contextFilter, page.Entries)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// CollectPages returns the entries matching filter by fetching the pages
+// returned by getPage until the last one, for the clients that only get
+// entries a page at a time. If filter has a Limit, a single page is fetched.
+func CollectPages(
+	ctx context.Context,
+	filter *GetEntriesFilter,
+	getPage func(ctx context.Context, filter *GetEntriesFilter) (*EntriesPage, error),
+) ([]*LogEntry, error) {
+	f := NewGetEntriesFilter()
+	if filter != nil {
+		f_ := *filter
+		f = &f_
+	}
+
+	ret := []*LogEntry{}
+	for {
+		page, err := getPage(ctx, f)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, page.Entries...)
+		if page.NextCursor == "" || f.Limit > 0 {
+			return ret, nil
+		}
+		// the offset only applies to the first page
+		f.Cursor = page.NextCursor
+		f.Offset = 0
+	}
+}
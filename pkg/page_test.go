@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterGetEntriesPage(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err = lw.Write([]byte(fmt.Sprintf(`{"level": "info", "i": %d}`, i)))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithLimit(2), WithOffset(1)))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, int64(1), entries[0].Meta["i"])
+	assert.Equal(t, int64(2), entries[1].Meta["i"])
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithOffset(3)))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+
+	seen := []int64{}
+	f := NewGetEntriesFilter(WithLimit(2))
+	pages := 0
+	for {
+		page, err := lw.GetEntriesPage(f)
+		require.NoError(t, err)
+		pages++
+		for _, entry := range page.Entries {
+			seen = append(seen, entry.Meta["i"].(int64))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		f.Cursor = page.NextCursor
+	}
+	assert.Equal(t, 3, pages)
+	assert.Equal(t, []int64{0, 1, 2, 3, 4}, seen)
+
+	_, err = lw.GetEntries(NewGetEntriesFilter(WithCursor("garbage")))
+	assert.Error(t, err)
+}
+
+func TestCollectPages(t *testing.T) {
+	lw := newImportLogWriter(t)
+	for i := 0; i < 5; i++ {
+		_, err := lw.Write([]byte(fmt.Sprintf(`{"level": "info", "i": %d}`, i)))
+		require.NoError(t, err)
+	}
+
+	// pages of 2 entries, as a server with a small page size would return
+	calls := 0
+	getPage := func(ctx context.Context, filter *GetEntriesFilter) (*EntriesPage, error) {
+		calls++
+		f := *filter
+		if f.Limit == 0 {
+			f.Limit = 2
+		}
+		return lw.GetEntriesPageContext(ctx, &f)
+	}
+
+	entries, err := CollectPages(context.Background(), NewGetEntriesFilter(WithOffset(1)), getPage)
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+	assert.Equal(t, int64(1), entries[0].Meta["i"])
+	assert.Equal(t, 2, calls)
+
+	entries, err = CollectPages(context.Background(), NewGetEntriesFilter(WithLimit(3)), getPage)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+	assert.Equal(t, 3, calls)
+}
@@ -0,0 +1,122 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LineParser decodes a single line of log output into an entry, as handed to
+// the middleware chain.
+type LineParser interface {
+	ParseLine(line []byte) (map[string]interface{}, error)
+}
+
+// RecordParser is a LineParser for formats whose entries can span several
+// lines. Import splits its input with SplitRecord, a bufio.SplitFunc,
+// instead of by lines.
+type RecordParser interface {
+	LineParser
+	SplitRecord(data []byte, atEOF bool) (advance int, token []byte, err error)
+}
+
+// LineParserFunc adapts a function to the LineParser interface.
+type LineParserFunc func(line []byte) (map[string]interface{}, error)
+
+func (f LineParserFunc) ParseLine(line []byte) (map[string]interface{}, error) {
+	return f(line)
+}
+
+// JSONLineParser parses the JSON entries written by zerolog. It is the default parser.
+var JSONLineParser LineParser = LineParserFunc(decodeEntry)
+
+// LogfmtLineParser parses logfmt lines, see ParseLogfmt.
+var LogfmtLineParser LineParser = LineParserFunc(ParseLogfmt)
+
+// UnknownFormatError is returned when no parser exists for a format.
+type UnknownFormatError struct {
+	Format string
+}
+
+func (e *UnknownFormatError) Error() string {
+	return "unknown log format " + e.Format
+}
+
+// LineParserFactory builds the parser of a format given its argument, the
+// part after the colon in regex:<pattern>, which is empty if there is none.
+type LineParserFactory func(arg string) (LineParser, error)
+
+var (
+	lineParsersMu sync.RWMutex
+	lineParsers   = map[string]LineParserFactory{
+		"json":     staticLineParser(JSONLineParser),
+		"jsonl":    staticLineParser(JSONLineParser),
+		"logfmt":   staticLineParser(LogfmtLineParser),
+		"syslog":   staticLineParser(SyslogLineParser),
+		"journald": staticLineParser(JournaldParser),
+		"clf":      staticLineParser(CLFLineParser),
+		"regex":    NewRegexLineParser,
+	}
+)
+
+// staticLineParser is the factory of a format without argument.
+func staticLineParser(parser LineParser) LineParserFactory {
+	return func(arg string) (LineParser, error) {
+		if arg != "" {
+			return nil, errors.Errorf("unexpected argument %q", arg)
+		}
+		return parser, nil
+	}
+}
+
+// RegisterLineParser makes the format name available to LineParserForFormat,
+// and so to the import command, replacing the format with the same name.
+func RegisterLineParser(name string, factory LineParserFactory) {
+	lineParsersMu.Lock()
+	defer lineParsersMu.Unlock()
+	lineParsers[strings.ToLower(name)] = factory
+}
+
+// LineParserFormats returns the names of the registered formats, sorted.
+func LineParserFormats() []string {
+	lineParsersMu.RLock()
+	defer lineParsersMu.RUnlock()
+	ret := []string{}
+	for name := range lineParsers {
+		ret = append(ret, name)
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+// LineParserForFormat returns the parser for the given format, the name of
+// a registered format optionally followed by a colon and an argument, such
+// as logfmt or regex:<pattern>. The empty format is json.
+func LineParserForFormat(format string) (LineParser, error) {
+	name, arg, _ := strings.Cut(format, ":")
+	name = strings.ToLower(name)
+	if name == "" {
+		name = "json"
+	}
+
+	lineParsersMu.RLock()
+	factory, ok := lineParsers[name]
+	lineParsersMu.RUnlock()
+	if !ok {
+		return nil, errors.WithStack(&UnknownFormatError{Format: format})
+	}
+	parser, err := factory(arg)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid format %s", format)
+	}
+	return parser, nil
+}
+
+// WithLineParser sets the parser used by Write to decode the entries it is
+// handed, which defaults to JSONLineParser.
+func WithLineParser(parser LineParser) LogWriterOption {
+	return func(l *LogWriter) {
+		l.parser = parser
+	}
+}
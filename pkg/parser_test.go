@@ -0,0 +1,76 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLineParserForFormat(t *testing.T) {
+	assert.Subset(t, LineParserFormats(), []string{"clf", "json", "logfmt", "regex"})
+
+	_, err := LineParserForFormat("xml")
+	assert.IsType(t, &UnknownFormatError{}, errors.Cause(err))
+	_, err = LineParserForFormat("json:x")
+	assert.Error(t, err)
+	_, err = LineParserForFormat("regex")
+	assert.Error(t, err)
+	_, err = LineParserForFormat("regex:(\\w+)")
+	assert.Error(t, err)
+
+	RegisterLineParser("upper", func(arg string) (LineParser, error) {
+		return LineParserFunc(func(line []byte) (map[string]interface{}, error) {
+			return map[string]interface{}{"message": arg + string(line)}, nil
+		}), nil
+	})
+	parser, err := LineParserForFormat("upper:> ")
+	require.NoError(t, err)
+	entry, err := parser.ParseLine([]byte("hello"))
+	require.NoError(t, err)
+	assert.Equal(t, "> hello", entry["message"])
+	assert.Contains(t, LineParserFormats(), "upper")
+}
+
+func TestRegexLineParser(t *testing.T) {
+	parser, err := LineParserForFormat(`regex:^(?P<level>\w+) \[(?P<worker>\d+)\]( (?P<user>\w+))?: (?P<message>.*)$`)
+	require.NoError(t, err)
+
+	entry, err := parser.ParseLine([]byte("WARN [12]: disk almost full"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"level":   "WARN",
+		"worker":  int64(12),
+		"message": "disk almost full",
+	}, entry)
+
+	_, err = parser.ParseLine([]byte("disk almost full"))
+	assert.Error(t, err)
+}
+
+func TestParseCLF(t *testing.T) {
+	entry, err := ParseCLF([]byte(`10.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /missing HTTP/1.1" 404 - "-" "curl/8.0"`))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"time":        time.Date(2000, 10, 10, 20, 55, 36, 0, time.UTC),
+		"message":     "GET /missing HTTP/1.1",
+		"level":       "warn",
+		"remote_host": "10.0.0.1",
+		"user":        "frank",
+		"user_agent":  "curl/8.0",
+		"method":      "GET",
+		"path":        "/missing",
+		"protocol":    "HTTP/1.1",
+		"status":      int64(404),
+	}, entry)
+
+	entry, err = ParseCLF([]byte(`::1 - - [10/Oct/2000:13:55:36 +0000] "POST /api HTTP/1.0" 503 12`))
+	require.NoError(t, err)
+	assert.Equal(t, "error", entry["level"])
+	assert.Equal(t, int64(12), entry["bytes"])
+	assert.NotContains(t, entry, "user_agent")
+
+	_, err = ParseCLF([]byte("not an access log"))
+	assert.Error(t, err)
+}
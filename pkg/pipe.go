@@ -0,0 +1,190 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/rs/zerolog"
+	"io"
+	"strings"
+	"time"
+)
+
+// Keys of the metadata recorded on the session by Pipe once its input is
+// done, so that sessions can be listed by outcome with
+// WithSessionFilterMetadata(PipeMaxLevelKey, "error").
+const (
+	PipeLinesKey       = "pipe_lines"
+	PipeRawLinesKey    = "pipe_raw_lines"
+	PipeMaxLevelKey    = "pipe_max_level"
+	PipeInterruptedKey = "pipe_interrupted"
+)
+
+// PipeResult sums up the lines read by Pipe.
+type PipeResult struct {
+	// Lines is the number of non-empty lines read.
+	Lines int `json:"lines"`
+	// RawLines is the number of lines that couldn't be parsed, and were
+	// stored as messages.
+	RawLines int `json:"raw_lines"`
+	// MaxLevel is the highest level of the stored entries, empty if no entry
+	// had a known level.
+	MaxLevel string `json:"max_level,omitempty"`
+	// Interrupted is true if ctx was done before the end of the input.
+	Interrupted bool `json:"interrupted"`
+}
+
+type pipeOptions struct {
+	parser LineParser
+	stream string
+	tee    io.Writer
+}
+
+type PipeOption func(*pipeOptions)
+
+// WithPipeParser sets the parser of the piped lines, JSONLineParser by
+// default. Lines that can't be parsed are stored as messages.
+func WithPipeParser(parser LineParser) PipeOption {
+	return func(o *pipeOptions) {
+		o.parser = parser
+	}
+}
+
+// WithPipeStream sets the stream stored on the piped entries, StreamStdout
+// by default, or none if stream is empty.
+func WithPipeStream(stream string) PipeOption {
+	return func(o *pipeOptions) {
+		o.stream = stream
+	}
+}
+
+// WithPipeTee copies the piped lines to w as they are read, so that the
+// output stays visible.
+func WithPipeTee(w io.Writer) PipeOption {
+	return func(o *pipeOptions) {
+		o.tee = w
+	}
+}
+
+// Pipe stores the lines read from r until its end or until ctx is done, such
+// as the output of a program piped to plunger. Unlike Import, each line is
+// written as soon as it is read, with its stream, and lines that can't be
+// parsed are stored as messages with level info rather than aborting.
+//
+// The session entries are written to, if any, is started, and ended once the
+// input is done, with the result recorded in its metadata under the
+// Pipe*Key keys.
+func (l *LogWriter) Pipe(ctx context.Context, r io.Reader, opts ...PipeOption) (*PipeResult, error) {
+	o := &pipeOptions{
+		parser: JSONLineParser,
+		stream: StreamStdout,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	i := l.lineImporter()
+	var extra map[string]interface{}
+	if o.stream != "" {
+		extra = map[string]interface{}{StreamKey: o.stream}
+	}
+
+	if err := l.StartSession(); err != nil {
+		return nil, err
+	}
+	res := &PipeResult{}
+	maxLevel := zerolog.NoLevel
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if o.tee != nil {
+			_, _ = fmt.Fprintf(o.tee, "%s\n", line)
+		}
+		if strings.TrimSpace(string(line)) == "" {
+			continue
+		}
+		res.Lines++
+
+		entry, raw := l.storeLine(ctx, o.parser, i, line, extra)
+		if raw {
+			res.RawLines++
+		}
+		if s, ok := entry["level"].(string); ok {
+			if level, err := zerolog.ParseLevel(s); err == nil && level != zerolog.NoLevel &&
+				(maxLevel == zerolog.NoLevel || level > maxLevel) {
+				maxLevel = level
+			}
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	res.Interrupted = ctx.Err() != nil
+	if maxLevel != zerolog.NoLevel {
+		res.MaxLevel = maxLevel.String()
+	}
+	if err := scanner.Err(); err != nil && !res.Interrupted {
+		return res, err
+	}
+
+	return res, l.recordPipeResult(res)
+}
+
+// lineImporter maps the fields of parsed lines like the LogWriter logs them.
+func (l *LogWriter) lineImporter() *importer {
+	return &importer{
+		timestampField:  l.timestampFieldName,
+		timestampFormat: l.timestampFormat,
+		levelField:      "level",
+		messageField:    l.messageFieldName,
+	}
+}
+
+// storeLine parses line with parser and writes the entry, adding the fields
+// of extra. Lines that can't be parsed are stored as messages with level
+// info, in which case raw is true. Entries without timestamp are stamped with
+// the time they are stored.
+func (l *LogWriter) storeLine(ctx context.Context, parser LineParser, i *importer,
+	line []byte, extra map[string]interface{}) (entry map[string]interface{}, raw bool) {
+	entry, err := parser.ParseLine(line)
+	if err != nil || entry == nil {
+		raw = true
+		entry = map[string]interface{}{
+			"level":            "info",
+			l.messageFieldName: string(line),
+		}
+	}
+	entry = l.mapImportedFields(i, entry)
+	if _, ok := entry[l.timestampFieldName]; !ok {
+		entry[l.timestampFieldName] = time.Now()
+	}
+	for k, v := range extra {
+		entry[k] = v
+	}
+
+	if _, err := l.writeBatch(ctx, []map[string]interface{}{entry}); err != nil && ctx.Err() == nil {
+		l.handleWriteError(err, line)
+	}
+	return entry, raw
+}
+
+// recordPipeResult stores res in the metadata of the session of l, and ends
+// the session.
+func (l *LogWriter) recordPipeResult(res *PipeResult) error {
+	if l.session == "" {
+		return nil
+	}
+	sm := l.Sessions()
+	metadata := map[string]interface{}{
+		PipeLinesKey:       res.Lines,
+		PipeRawLinesKey:    res.RawLines,
+		PipeInterruptedKey: res.Interrupted,
+	}
+	if res.MaxLevel != "" {
+		metadata[PipeMaxLevelKey] = res.MaxLevel
+	}
+	if err := sm.SetMetadata(l.session, metadata); err != nil {
+		return err
+	}
+	return sm.EndSession(l.session)
+}
@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLogWriterPipe(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil, WithDefaultSession("run"))
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	input := `{"level": "warn", "message": "slow", "ms": 120}
+starting worker 3
+
+{"level": "error", "message": "failed"}
+`
+	tee := &bytes.Buffer{}
+	res, err := lw.Pipe(context.Background(), strings.NewReader(input), WithPipeTee(tee))
+	require.NoError(t, err)
+	assert.Equal(t, &PipeResult{Lines: 3, RawLines: 1, MaxLevel: "error"}, res)
+	assert.Equal(t, input, tee.String())
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithOrderBy("id", Asc)))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "warn", entries[0].Level)
+	assert.EqualValues(t, 120, entries[0].Meta["ms"])
+	assert.Equal(t, "starting worker 3", *entries[1].Message)
+	assert.Equal(t, "info", entries[1].Level)
+	assert.Equal(t, "run", *entries[2].Session)
+
+	session, err := lw.Sessions().GetSession("run")
+	require.NoError(t, err)
+	assert.EqualValues(t, 3, session.Metadata[PipeLinesKey])
+	assert.EqualValues(t, 1, session.Metadata[PipeRawLinesKey])
+	assert.Equal(t, "error", session.Metadata[PipeMaxLevelKey])
+	assert.Equal(t, false, session.Metadata[PipeInterruptedKey])
+	require.NotNil(t, session.EndedAt)
+	assert.Nil(t, session.ExitCode)
+	assert.NotNil(t, session.Duration)
+}
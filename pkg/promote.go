@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+)
+
+// Keys that aren't meta keys of the schema are stored by name with each
+// value, which takes more space and makes filtering on them slower. Keys
+// that turn out to be frequent can be promoted to meta keys after the fact.
+
+// KeySuggestion is an ad-hoc key along with the number of values stored for it.
+type KeySuggestion struct {
+	Name  string `db:"name" json:"name"`
+	Count int    `db:"count" json:"count"`
+}
+
+// SuggestMetaKeys returns the ad-hoc keys that have at least minCount values,
+// most frequent first. At most limit keys are returned, unless limit is 0.
+func (l *LogWriter) SuggestMetaKeys(ctx context.Context, limit int, minCount int) ([]KeySuggestion, error) {
+	sb := sqlbuilder.Select("name", "COUNT(*) AS count").From("log_entries_meta")
+	sb.Where(sb.IsNotNull("name")).
+		GroupBy("name").
+		Having(sb.GE("COUNT(*)", minCount)).
+		OrderBy("count DESC", "name ASC")
+	if limit > 0 {
+		sb.Limit(limit)
+	}
+	s, args := sb.Build()
+
+	ret := []KeySuggestion{}
+	if err := l.db.SelectContext(ctx, &ret, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// PromoteMetaKeys registers names as meta keys, saves them to the schema of
+// the database, and rewrites the values already stored by name to reference
+// them. It returns the number of rewritten values.
+func (l *LogWriter) PromoteMetaKeys(ctx context.Context, names ...string) (int64, error) {
+	// pick up the keys registered by other writers
+	if err := l.loadMetaKeys(ctx); err != nil {
+		return 0, err
+	}
+
+	// the ids are only added to the schema once they are committed
+	newKeys := map[string]int{}
+	nextID := l.schema.MetaKeys.maxID
+	for _, name := range names {
+		if _, ok := l.schema.MetaKeys.Get(name); ok {
+			continue
+		}
+		if _, ok := newKeys[name]; ok {
+			continue
+		}
+		newKeys[name] = nextID
+		nextID++
+	}
+
+	var rewritten int64
+	err := l.retryBusy(ctx, func() error {
+		tx, err := l.db.BeginTxx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		n, err := l.promoteMetaKeysTx(ctx, tx, names, newKeys)
+		if err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+		rewritten = n
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for name, id := range newKeys {
+		if _, err := l.schema.MetaKeys.AddWithID(name, id); err != nil {
+			return rewritten, err
+		}
+	}
+	return rewritten, nil
+}
+
+func (l *LogWriter) promoteMetaKeysTx(ctx context.Context, tx *sqlx.Tx, names []string, newKeys map[string]int) (int64, error) {
+	if len(newKeys) > 0 {
+		// fails if another writer registered the same ids in the meantime
+		q := sqlbuilder.NewInsertBuilder()
+		q.InsertInto("meta_keys").Cols("id", "key")
+		for name, id := range newKeys {
+			q.Values(id, name)
+		}
+		s, args := q.Build()
+		if _, err := tx.ExecContext(ctx, tx.Rebind(s), args...); err != nil {
+			return 0, err
+		}
+	}
+
+	var ret int64
+	for _, name := range names {
+		id, ok := newKeys[name]
+		if !ok {
+			key, _ := l.schema.MetaKeys.Get(name)
+			id = key.ID
+		}
+		ub := sqlbuilder.NewUpdateBuilder()
+		ub.Update("log_entries_meta").
+			Set(ub.Assign("meta_key_id", id), "name = NULL").
+			Where(ub.Equal("name", name))
+		s, args := ub.Build()
+		res, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+		if err != nil {
+			return 0, err
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return 0, err
+		}
+		ret += n
+	}
+	return ret, nil
+}
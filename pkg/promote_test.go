@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterPromoteMetaKeys(t *testing.T) {
+	lw := newImportLogWriter(t)
+	for _, line := range []string{
+		`{"level": "info", "user": "alice", "request_id": "r1"}`,
+		`{"level": "info", "user": "bob", "request_id": "r2"}`,
+		`{"level": "info", "user": "alice"}`,
+		`{"level": "info", "once": true}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	ctx := context.Background()
+	suggestions, err := lw.SuggestMetaKeys(ctx, 0, 2)
+	require.NoError(t, err)
+	assert.Equal(t, []KeySuggestion{{Name: "user", Count: 3}, {Name: "request_id", Count: 2}}, suggestions)
+	suggestions, err = lw.SuggestMetaKeys(ctx, 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []KeySuggestion{{Name: "user", Count: 3}}, suggestions)
+
+	n, err := lw.PromoteMetaKeys(ctx, "user", "request_id")
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), n)
+
+	suggestions, err = lw.SuggestMetaKeys(ctx, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, []KeySuggestion{{Name: "once", Count: 1}}, suggestions)
+
+	// new entries use the promoted keys, and the rewritten ones can still be filtered on
+	_, err = lw.Write([]byte(`{"level": "info", "user": "alice"}`))
+	require.NoError(t, err)
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"user": "alice"})))
+	require.NoError(t, err)
+	assert.Len(t, entries, 3)
+
+	stored, err := lw.readMetaKeys(ctx)
+	require.NoError(t, err)
+	_, ok := stored.Get("request_id")
+	assert.True(t, ok)
+}
@@ -0,0 +1,230 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+// PruneRule describes which entries to remove from the database.
+//
+// All limits are optional, and a rule with a Level only applies to entries
+// of that level.
+type PruneRule struct {
+	// Level restricts the rule to entries of this level (case-insensitive).
+	Level string
+	// MaxAge removes entries older than MaxAge.
+	MaxAge time.Duration
+	// MaxEntries keeps only the MaxEntries most recent entries.
+	MaxEntries int
+	// MaxSize removes the oldest entries until the database uses less than MaxSize bytes.
+	MaxSize int64
+}
+
+// PrunePolicy provides the rules applied by LogWriter.Prune, see the retention package.
+type PrunePolicy interface {
+	PruneRules() []PruneRule
+}
+
+type PruneResult struct {
+	DeletedEntries int64
+}
+
+// pruneSizeBatch is the number of entries removed at once when enforcing MaxSize.
+const pruneSizeBatch = 1000
+
+// Prune deletes the entries selected by the rules of policy, in order.
+func (l *LogWriter) Prune(policy PrunePolicy) (*PruneResult, error) {
+	return l.PruneContext(context.Background(), policy)
+}
+
+func (l *LogWriter) PruneContext(ctx context.Context, policy PrunePolicy) (*PruneResult, error) {
+	result := &PruneResult{}
+
+	for _, rule := range policy.PruneRules() {
+		if rule.MaxAge > 0 {
+			sb := l.pruneSelect(rule)
+			sb.Where(sb.L("date", time.Now().UTC().Add(-rule.MaxAge)))
+			n, err := l.deleteEntries(ctx, sb)
+			if err != nil {
+				return result, err
+			}
+			result.DeletedEntries += n
+		}
+
+		if rule.MaxEntries > 0 {
+			// everything older than the MaxEntries most recent entries
+			newest := l.pruneSelect(rule)
+			newest.OrderBy("id").Desc().Limit(rule.MaxEntries)
+
+			sb := l.pruneSelect(rule)
+			sb.Where(sb.NotIn("id", newest))
+			n, err := l.deleteEntries(ctx, sb)
+			if err != nil {
+				return result, err
+			}
+			result.DeletedEntries += n
+		}
+
+		if rule.MaxSize > 0 {
+			for {
+				size, err := l.store.Size()
+				if err != nil {
+					return result, err
+				}
+				if size <= rule.MaxSize {
+					break
+				}
+
+				sb := l.pruneSelect(rule)
+				sb.OrderBy("id").Asc().Limit(pruneSizeBatch)
+				n, err := l.deleteEntries(ctx, sb)
+				if err != nil {
+					return result, err
+				}
+				result.DeletedEntries += n
+				if n == 0 {
+					break
+				}
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func (l *LogWriter) pruneSelect(rule PruneRule) *sqlbuilder.SelectBuilder {
+	sb := sqlbuilder.Select("id").From("log_entries")
+	if rule.Level != "" {
+		sb.Where(sb.E("LOWER(level)", strings.ToLower(rule.Level)))
+	}
+	return sb
+}
+
+// deleteEntries deletes the entries whose ids are returned by ids, along with
+// their meta and search index rows and their offloaded values, and returns
+// the number of deleted entries.
+func (l *LogWriter) deleteEntries(ctx context.Context, ids *sqlbuilder.SelectBuilder) (int64, error) {
+	tables, err := l.entryTables()
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := l.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted, refs, err := l.deleteEntriesTx(ctx, tx, tables, ids)
+	if err != nil {
+		_ = tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return deleted, l.removeUnreferencedBlobs(ctx, refs)
+}
+
+// entryTables returns the tables holding rows of entries, mapped to their
+// entry id column, in the order they are deleted from.
+func (l *LogWriter) entryTables() ([][2]string, error) {
+	tables := [][2]string{{"log_entries_meta", "log_entry_id"}}
+	hasWide, err := l.store.HasTable(wideTable)
+	if err != nil {
+		return nil, err
+	}
+	if hasWide {
+		tables = append(tables, [2]string{wideTable, "log_entry_id"})
+	}
+	hasSearch, err := l.store.HasTable("log_entries_fts")
+	if err != nil {
+		return nil, err
+	}
+	if hasSearch {
+		tables = append(tables, [2]string{"log_entries_fts", "rowid"})
+	}
+	tables = append(tables, [2]string{"entry_links", "from_id"}, [2]string{"entry_links", "to_id"},
+		[2]string{"artifacts", "log_entry_id"})
+	return append(tables, [2]string{"log_entries", "id"}), nil
+}
+
+// deleteChunkSize is the number of ids deleted per statement, below the
+// limit sqlite puts on the number of variables of a statement.
+const deleteChunkSize = 500
+
+// deleteEntriesTx is deleteEntries as part of tx, for the tables returned by
+// entryTables. It returns the offloaded values referenced by the deleted
+// entries, to be passed to removeUnreferencedBlobs once tx is committed. The
+// caller is responsible for rolling back tx on error.
+func (l *LogWriter) deleteEntriesTx(ctx context.Context, tx *sqlx.Tx, tables [][2]string, ids *sqlbuilder.SelectBuilder) (int64, []string, error) {
+	// Materialize the ids first, so that selections relying on ordering or
+	// limits aren't reevaluated for each table.
+	s, args := ids.Build()
+	idList := []interface{}{}
+	rows, err := tx.QueryxContext(ctx, tx.Rebind(s), args...)
+	if err != nil {
+		return 0, nil, err
+	}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			_ = rows.Close()
+			return 0, nil, err
+		}
+		idList = append(idList, id)
+	}
+	_ = rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, nil, err
+	}
+
+	var deleted int64
+	refs := map[string]bool{}
+	for len(idList) > 0 {
+		chunk := idList
+		if len(chunk) > deleteChunkSize {
+			chunk = chunk[:deleteChunkSize]
+		}
+		idList = idList[len(chunk):]
+
+		chunkRefs, err := l.referencedBlobs(ctx, tx, chunk)
+		if err != nil {
+			return 0, nil, err
+		}
+		for _, ref := range chunkRefs {
+			refs[ref] = true
+		}
+
+		for _, table := range tables {
+			db := sqlbuilder.DeleteFrom(table[0])
+			db.Where(db.In(table[1], chunk...))
+			s, args := db.Build()
+			res, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+			if err != nil {
+				return 0, nil, err
+			}
+			if table[0] == "log_entries" {
+				n, err := res.RowsAffected()
+				if err != nil {
+					return 0, nil, err
+				}
+				deleted += n
+			}
+		}
+	}
+
+	ret := []string{}
+	for ref := range refs {
+		ret = append(ret, ref)
+	}
+	return deleted, ret, nil
+}
+
+// Vacuum reclaims the space freed by pruning.
+func (l *LogWriter) Vacuum() error {
+	return l.store.Vacuum()
+}
@@ -0,0 +1,128 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+type pruneRules []PruneRule
+
+func (r pruneRules) PruneRules() []PruneRule {
+	return r
+}
+
+func writePruneEntries(t *testing.T, lw *LogWriter) {
+	now := time.Now().UTC()
+	for i, e := range []struct {
+		level string
+		age   time.Duration
+	}{
+		{"debug", 72 * time.Hour},
+		{"error", 72 * time.Hour},
+		{"debug", 2 * time.Hour},
+		{"info", 2 * time.Hour},
+		{"debug", 0},
+	} {
+		_, err := lw.Write([]byte(fmt.Sprintf(
+			`{"level": %q, "time": %q, "message": "entry %d", "i": %d}`,
+			e.level, now.Add(-e.age).Format(time.RFC3339), i, i,
+		)))
+		require.NoError(t, err)
+	}
+}
+
+func messages(t *testing.T, lw *LogWriter) []string {
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	ret := []string{}
+	for _, entry := range entries {
+		ret = append(ret, *entry.Message)
+	}
+	return ret
+}
+
+func TestLogWriterPrune(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	db.SetMaxOpenConns(1)
+
+	lw := NewLogWriter(db, NewSchema())
+	require.NoError(t, lw.Init())
+	writePruneEntries(t, lw)
+
+	res, err := lw.Prune(pruneRules{{Level: "DEBUG", MaxAge: time.Hour}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.DeletedEntries)
+	assert.Equal(t, []string{"entry 1", "entry 3", "entry 4"}, messages(t, lw))
+
+	res, err = lw.Prune(pruneRules{{MaxAge: 24 * time.Hour}, {MaxEntries: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.DeletedEntries)
+	assert.Equal(t, []string{"entry 4"}, messages(t, lw))
+
+	// meta rows of the deleted entries are gone as well
+	var count int
+	require.NoError(t, db.Get(&count, "SELECT COUNT(*) FROM log_entries_meta"))
+	assert.Equal(t, 1, count)
+
+	require.NoError(t, lw.Vacuum())
+}
+
+func TestLogWriterPruneMaxSize(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	db.SetMaxOpenConns(1)
+
+	lw := NewLogWriter(db, NewSchema())
+	require.NoError(t, lw.Init())
+	writePruneEntries(t, lw)
+
+	// smaller than the empty schema, so everything gets deleted
+	res, err := lw.Prune(pruneRules{{MaxSize: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), res.DeletedEntries)
+	assert.Empty(t, messages(t, lw))
+
+	size, err := lw.store.Size()
+	require.NoError(t, err)
+	res, err = lw.Prune(pruneRules{{MaxSize: size}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.DeletedEntries)
+}
+
+// writeManyEntries imports n entries dated age ago in the session bulk, more
+// than sqlite accepts as variables of a single statement when n is large.
+func writeManyEntries(t *testing.T, lw *LogWriter, n int, age time.Duration) {
+	date := time.Now().UTC().Add(-age).Format(time.RFC3339)
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, `{"level": "debug", "time": %q, "session": "bulk", "message": "noisy", "i": %d}`+"\n", date, i)
+	}
+	progress, err := lw.Import(strings.NewReader(b.String()))
+	require.NoError(t, err)
+	require.Equal(t, n, progress.Imported)
+}
+
+func TestLogWriterPruneManyEntries(t *testing.T) {
+	lw := newImportLogWriter(t)
+	writeManyEntries(t, lw, 33000, 2*time.Hour)
+	writePruneEntries(t, lw)
+
+	res, err := lw.Prune(pruneRules{{MaxAge: time.Hour}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(33004), res.DeletedEntries)
+	assert.Equal(t, []string{"entry 4"}, messages(t, lw))
+
+	var metaRows int
+	require.NoError(t, lw.db.Get(&metaRows, "SELECT COUNT(*) FROM log_entries_meta"))
+	assert.Equal(t, 1, metaRows)
+}
@@ -0,0 +1,258 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// QuerySpec is the serializable form of a GetEntriesFilter, as stored in the
+// queries table. Times can be relative, so that a saved query such as
+// "errors of the last hour" stays relative to when it is run.
+type QuerySpec struct {
+	Levels      []string `json:"levels,omitempty"`
+	MinLevel    string   `json:"min_level,omitempty"`
+	Session     string   `json:"session,omitempty"`
+	SessionTree string   `json:"session_tree,omitempty"`
+	Group       string   `json:"group,omitempty"`
+	// From and To are RFC3339 timestamps, dates, or durations relative to
+	// the time the query is run such as -1h, see ParseTime.
+	From             string                 `json:"from,omitempty"`
+	To               string                 `json:"to,omitempty"`
+	MetaFilters      map[string]interface{} `json:"meta_filters,omitempty"`
+	SelectedMetaKeys []string               `json:"selected_meta_keys,omitempty"`
+	Search           string                 `json:"search,omitempty"`
+	Caller           string                 `json:"caller,omitempty"`
+	ErrorContains    string                 `json:"error_contains,omitempty"`
+	TraceID          string                 `json:"trace_id,omitempty"`
+	Stream           string                 `json:"stream,omitempty"`
+	// Query is an expression in the query language, see ParseQuery.
+	Query string `json:"query,omitempty"`
+}
+
+// ParseTime accepts RFC3339 timestamps, dates, and durations relative to now
+// such as -1h (one hour ago).
+func ParseTime(s string, now time.Time) (time.Time, error) {
+	if strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err == nil {
+			return now.Add(d), nil
+		}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("could not parse time %q", s)
+}
+
+// Filter resolves the spec into a filter, relative times being relative to now.
+func (q *QuerySpec) Filter(now time.Time) (*GetEntriesFilter, error) {
+	opts := []GetEntriesFilterOption{}
+	if len(q.Levels) > 0 {
+		opts = append(opts, WithLevels(q.Levels...))
+	}
+	if q.MinLevel != "" {
+		opts = append(opts, WithMinLevel(q.MinLevel))
+	}
+	if q.Session != "" {
+		opts = append(opts, WithSession(q.Session))
+	}
+	if q.SessionTree != "" {
+		opts = append(opts, WithSessionTree(q.SessionTree))
+	}
+	if q.Group != "" {
+		opts = append(opts, WithGroup(q.Group))
+	}
+	if q.From != "" {
+		t, err := ParseTime(q.From, now)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithFrom(t))
+	}
+	if q.To != "" {
+		t, err := ParseTime(q.To, now)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithTo(t))
+	}
+	if len(q.MetaFilters) > 0 {
+		opts = append(opts, WithMetaFilters(q.MetaFilters))
+	}
+	if len(q.SelectedMetaKeys) > 0 {
+		opts = append(opts, WithSelectedMetaKeys(q.SelectedMetaKeys...))
+	}
+	if q.Search != "" {
+		opts = append(opts, WithSearch(q.Search))
+	}
+	if q.Caller != "" {
+		opts = append(opts, WithCaller(q.Caller))
+	}
+	if q.ErrorContains != "" {
+		opts = append(opts, WithErrorContains(q.ErrorContains))
+	}
+	if q.TraceID != "" {
+		opts = append(opts, WithTraceID(q.TraceID))
+	}
+	if q.Stream != "" {
+		opts = append(opts, WithStream(q.Stream))
+	}
+	if q.Query != "" {
+		opts = append(opts, WithQueryString(q.Query))
+	}
+	return NewGetEntriesFilter(opts...), nil
+}
+
+// SavedQuery is a named QuerySpec stored in the database, so that it is
+// shared along with the database file.
+type SavedQuery struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Spec        *QuerySpec `json:"spec"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+type UnknownQueryError struct {
+	Name string
+}
+
+func (e *UnknownQueryError) Error() string {
+	return "unknown query " + e.Name
+}
+
+func (l *LogWriter) createQueriesTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("queries").
+		IfNotExists().
+		Define("name", "VARCHAR(255)", "PRIMARY KEY").
+		Define("description", "TEXT", "NOT NULL", "DEFAULT ''").
+		Define("spec", "TEXT", "NOT NULL").
+		Define("created_at", "TIMESTAMP", "NOT NULL").
+		Define("updated_at", "TIMESTAMP", "NOT NULL")
+	_, err := l.db.ExecContext(ctx, ctb.String())
+	return err
+}
+
+// SaveQuery stores query, replacing the query with the same name if any.
+func (l *LogWriter) SaveQuery(ctx context.Context, query *SavedQuery) error {
+	if query.Name == "" {
+		return errors.New("saved queries need a name")
+	}
+	spec := query.Spec
+	if spec == nil {
+		spec = &QuerySpec{}
+	}
+	b, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("queries").
+		Cols("name", "description", "spec", "created_at", "updated_at").
+		Values(query.Name, query.Description, string(b), now, now).
+		SQL("ON CONFLICT (name) DO UPDATE SET description = excluded.description, " +
+			"spec = excluded.spec, updated_at = excluded.updated_at")
+	s, args := ib.Build()
+	if _, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+type savedQueryRow struct {
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	Spec        string    `db:"spec"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+}
+
+func (r *savedQueryRow) toSavedQuery() (*SavedQuery, error) {
+	spec := &QuerySpec{}
+	// keep numbers as json.Number, so that integers compare exactly
+	decoder := json.NewDecoder(bytes.NewReader([]byte(r.Spec)))
+	decoder.UseNumber()
+	if err := decoder.Decode(spec); err != nil {
+		return nil, errors.Wrapf(err, "invalid spec for query %s", r.Name)
+	}
+	return &SavedQuery{
+		Name:        r.Name,
+		Description: r.Description,
+		Spec:        spec,
+		CreatedAt:   r.CreatedAt.UTC(),
+		UpdatedAt:   r.UpdatedAt.UTC(),
+	}, nil
+}
+
+func (l *LogWriter) selectSavedQueries(ctx context.Context, sb *sqlbuilder.SelectBuilder) ([]*SavedQuery, error) {
+	s, args := sb.Build()
+	rows := []savedQueryRow{}
+	if err := l.db.SelectContext(ctx, &rows, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+
+	ret := []*SavedQuery{}
+	for _, row := range rows {
+		query, err := row.toSavedQuery()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, query)
+	}
+	return ret, nil
+}
+
+// GetSavedQuery returns the query with the given name.
+func (l *LogWriter) GetSavedQuery(ctx context.Context, name string) (*SavedQuery, error) {
+	sb := sqlbuilder.Select("name", "description", "spec", "created_at", "updated_at").From("queries")
+	sb.Where(sb.E("name", name))
+	queries, err := l.selectSavedQueries(ctx, sb)
+	if err != nil {
+		return nil, err
+	}
+	if len(queries) == 0 {
+		return nil, &UnknownQueryError{Name: name}
+	}
+	return queries[0], nil
+}
+
+// ListSavedQueries returns the saved queries, ordered by name.
+func (l *LogWriter) ListSavedQueries(ctx context.Context) ([]*SavedQuery, error) {
+	sb := sqlbuilder.Select("name", "description", "spec", "created_at", "updated_at").
+		From("queries").
+		OrderBy("name ASC")
+	return l.selectSavedQueries(ctx, sb)
+}
+
+// DeleteSavedQuery removes the query with the given name.
+func (l *LogWriter) DeleteSavedQuery(ctx context.Context, name string) error {
+	db := sqlbuilder.NewDeleteBuilder()
+	db.DeleteFrom("queries").Where(db.E("name", name))
+	s, args := db.Build()
+	res, err := l.db.ExecContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &UnknownQueryError{Name: name}
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSavedQueries(t *testing.T) {
+	lw := newImportLogWriter(t)
+	ctx := context.Background()
+
+	err := lw.SaveQuery(ctx, &SavedQuery{
+		Name:        "errors-last-hour",
+		Description: "recent errors",
+		Spec: &QuerySpec{
+			MinLevel:    "error",
+			From:        "-1h",
+			MetaFilters: map[string]interface{}{"status": json.Number("500")},
+		},
+	})
+	require.NoError(t, err)
+	require.NoError(t, lw.SaveQuery(ctx, &SavedQuery{Name: "all"}))
+
+	query, err := lw.GetSavedQuery(ctx, "errors-last-hour")
+	require.NoError(t, err)
+	assert.Equal(t, "recent errors", query.Description)
+	assert.Equal(t, "-1h", query.Spec.From)
+
+	// relative times are resolved when the query is run
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	filter, err := query.Spec.Filter(now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-time.Hour), filter.From)
+	assert.Equal(t, "error", filter.MinLevel)
+
+	for _, line := range []string{
+		`{"level": "error", "status": 500}`,
+		`{"level": "error", "status": 404}`,
+		`{"level": "info", "status": 500}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	filter, err = query.Spec.Filter(time.Now())
+	require.NoError(t, err)
+	entries, err := lw.GetEntries(filter)
+	require.NoError(t, err)
+	assert.Len(t, entries, 1)
+
+	// saving again replaces the query
+	query.Spec.MinLevel = "info"
+	require.NoError(t, lw.SaveQuery(ctx, query))
+	queries, err := lw.ListSavedQueries(ctx)
+	require.NoError(t, err)
+	require.Len(t, queries, 2)
+	assert.Equal(t, "all", queries[0].Name)
+	assert.Equal(t, "info", queries[1].Spec.MinLevel)
+
+	require.NoError(t, lw.DeleteSavedQuery(ctx, "all"))
+	var unknownErr *UnknownQueryError
+	assert.ErrorAs(t, lw.DeleteSavedQuery(ctx, "all"), &unknownErr)
+	_, err = lw.GetSavedQuery(ctx, "all")
+	assert.ErrorAs(t, err, &unknownErr)
+}
+
+func TestParseTime(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	ts, err := ParseTime("-30m", now)
+	require.NoError(t, err)
+	assert.Equal(t, now.Add(-30*time.Minute), ts)
+
+	ts, err = ParseTime("2023-04-01", now)
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC), ts)
+
+	_, err = ParseTime("yesterday", now)
+	assert.Error(t, err)
+}
@@ -0,0 +1,407 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// The query language combines comparisons with AND, OR, NOT and parentheses:
+//
+//	level>=warn AND foo="bar" AND baz>10 AND msg~"timeout"
+//
+// Comparisons are key op value, where op is one of =, !=, <, <=, >, >=, ~
+// (contains) and !~ (doesn't contain). The keys level, message (or msg),
+// session, group (see WithGroupKey), caller (the file of the caller), error (the error message),
+// trace_id, span_id, fingerprint (see Fingerprint), id and date (or time) refer to the columns of the
+// entries, any other key to a meta value. Levels are compared by severity, and dates can be relative to the
+// time the query is run, as in date>=-1h.
+//
+// Values are double quoted strings, numbers, true, false, or unquoted words.
+
+// QuerySyntaxError is returned by ParseQuery for invalid queries.
+type QuerySyntaxError struct {
+	Query string
+	// Pos is the byte offset of the error in Query.
+	Pos int
+	Msg string
+}
+
+func (e *QuerySyntaxError) Error() string {
+	return fmt.Sprintf("invalid query at position %d: %s", e.Pos, e.Msg)
+}
+
+// QueryExpr is a parsed query, see ParseQuery.
+type QueryExpr interface {
+	String() string
+	condition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder) string
+}
+
+// AndExpr matches entries matching both Left and Right.
+type AndExpr struct {
+	Left, Right QueryExpr
+}
+
+func (e *AndExpr) String() string {
+	return "(" + e.Left.String() + " AND " + e.Right.String() + ")"
+}
+
+func (e *AndExpr) condition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder) string {
+	return q.And(e.Left.condition(metaKeys, q), e.Right.condition(metaKeys, q))
+}
+
+// OrExpr matches entries matching either Left or Right.
+type OrExpr struct {
+	Left, Right QueryExpr
+}
+
+func (e *OrExpr) String() string {
+	return "(" + e.Left.String() + " OR " + e.Right.String() + ")"
+}
+
+func (e *OrExpr) condition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder) string {
+	return q.Or(e.Left.condition(metaKeys, q), e.Right.condition(metaKeys, q))
+}
+
+// NotExpr matches entries not matching Expr.
+type NotExpr struct {
+	Expr QueryExpr
+}
+
+func (e *NotExpr) String() string {
+	return "NOT " + e.Expr.String()
+}
+
+func (e *NotExpr) condition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder) string {
+	return "NOT " + e.Expr.condition(metaKeys, q)
+}
+
+// Comparison compares the value of Key to Value.
+type Comparison struct {
+	Key string
+	Op  string
+	// Value is a string, a json.Number, or a bool.
+	Value interface{}
+}
+
+func (e *Comparison) String() string {
+	if s, ok := e.Value.(string); ok {
+		return e.Key + e.Op + strconv.Quote(s)
+	}
+	return fmt.Sprintf("%s%s%v", e.Key, e.Op, e.Value)
+}
+
+func (e *Comparison) condition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder) string {
+	s := fmt.Sprint(e.Value)
+	switch e.Key {
+	case "level":
+		switch e.Op {
+		case "<", "<=", ">", ">=":
+			return levelCondition(q, e.Op, s)
+		case "=", "!=":
+			return compareCondition(&q.Cond, "LOWER(level)", e.Op, strings.ToLower(s))
+		}
+		return compareCondition(&q.Cond, "level", e.Op, s)
+	case "message", "msg":
+		return compareCondition(&q.Cond, "message", e.Op, s)
+	case "session":
+		return compareCondition(&q.Cond, "session", e.Op, s)
+	case "group":
+		return compareCondition(&q.Cond, "group_id", e.Op, s)
+	case "caller":
+		return compareCondition(&q.Cond, "caller_file", e.Op, s)
+	case "error":
+		return compareCondition(&q.Cond, "error_message", e.Op, s)
+	case "trace_id", "span_id", "fingerprint":
+		return compareCondition(&q.Cond, e.Key, e.Op, s)
+	case "id":
+		v := e.Value
+		if n, ok := v.(json.Number); ok {
+			v = normalizeNumber(n)
+		}
+		return compareCondition(&q.Cond, "id", e.Op, v)
+	case "date", "time":
+		// the syntax of dates is checked by ParseQuery
+		t, _ := ParseTime(s, time.Now())
+		return compareCondition(&q.Cond, "date", e.Op, t.UTC())
+	}
+	return metaCondition(metaKeys, q, e.Key, e.Op, e.Value)
+}
+
+// compareCondition compares column to value with one of the operators of
+// the query language.
+func compareCondition(c *sqlbuilder.Cond, column string, op string, value interface{}) string {
+	switch op {
+	case "!=":
+		return c.NE(column, value)
+	case "<":
+		return c.L(column, value)
+	case "<=":
+		return c.LE(column, value)
+	case ">":
+		return c.G(column, value)
+	case ">=":
+		return c.GE(column, value)
+	case "~":
+		return c.Like(column, "%"+fmt.Sprint(value)+"%")
+	case "!~":
+		return c.NotLike(column, "%"+fmt.Sprint(value)+"%")
+	default:
+		return c.E(column, value)
+	}
+}
+
+// WithQueryString only returns entries matching the query, see ParseQuery.
+func WithQueryString(query string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Query = query
+	}
+}
+
+// Validate checks the filter's Query, JSONPaths and order. Apply doesn't
+// return errors, so an invalid query makes it match no entries.
+func (gef *GetEntriesFilter) Validate() error {
+	if err := gef.validateOrder(); err != nil {
+		return err
+	}
+	if err := gef.validateContext(); err != nil {
+		return err
+	}
+	for _, f := range gef.JSONPaths {
+		if err := f.validate(); err != nil {
+			return err
+		}
+	}
+	if gef.Query == "" {
+		return nil
+	}
+	_, err := ParseQuery(gef.Query)
+	return err
+}
+
+// ParseQuery parses an expression in the query language.
+func ParseQuery(query string) (QueryExpr, error) {
+	p := &queryParser{query: query}
+	if err := p.tokenize(); err != nil {
+		return nil, err
+	}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.errorf(t, "unexpected %q", t.text)
+	}
+	return expr, nil
+}
+
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenWord
+	tokenString
+	tokenOp
+	tokenLParen
+	tokenRParen
+)
+
+type queryToken struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+type queryParser struct {
+	query  string
+	tokens []queryToken
+	next   int
+}
+
+func (p *queryParser) errorf(t queryToken, format string, args ...interface{}) error {
+	return &QuerySyntaxError{Query: p.query, Pos: t.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || strings.ContainsRune("_.-:+", r)
+}
+
+func (p *queryParser) tokenize() error {
+	s := p.query
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '(':
+			p.tokens = append(p.tokens, queryToken{kind: tokenLParen, text: "(", pos: i})
+			i++
+		case c == ')':
+			p.tokens = append(p.tokens, queryToken{kind: tokenRParen, text: ")", pos: i})
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return &QuerySyntaxError{Query: s, Pos: i, Msg: "unterminated string"}
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return &QuerySyntaxError{Query: s, Pos: i, Msg: "invalid string"}
+			}
+			p.tokens = append(p.tokens, queryToken{kind: tokenString, text: text, pos: i})
+			i = end + 1
+		case strings.ContainsRune("=!<>~", rune(c)):
+			op := ""
+			for _, candidate := range []string{"!=", "<=", ">=", "!~", "=", "<", ">", "~"} {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return &QuerySyntaxError{Query: s, Pos: i, Msg: "unknown operator !"}
+			}
+			p.tokens = append(p.tokens, queryToken{kind: tokenOp, text: op, pos: i})
+			i += len(op)
+		default:
+			end := i
+			for end < len(s) {
+				r := rune(s[end])
+				if !isWordRune(r) && r < unicode.MaxASCII {
+					break
+				}
+				end++
+			}
+			if end == i {
+				return &QuerySyntaxError{Query: s, Pos: i, Msg: fmt.Sprintf("unexpected %q", c)}
+			}
+			p.tokens = append(p.tokens, queryToken{kind: tokenWord, text: s[i:end], pos: i})
+			i = end
+		}
+	}
+	p.tokens = append(p.tokens, queryToken{kind: tokenEOF, text: "end of query", pos: len(s)})
+	return nil
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.next]
+}
+
+func (p *queryParser) advance() queryToken {
+	t := p.tokens[p.next]
+	if t.kind != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *queryParser) isKeyword(t queryToken, keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.text, keyword)
+}
+
+func (p *queryParser) parseOr() (QueryExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(p.peek(), "OR") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &OrExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (QueryExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.isKeyword(p.peek(), "AND") {
+		p.advance()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = &AndExpr{Left: left, Right: right}
+	}
+	return left, nil
+}
+
+func (p *queryParser) parseUnary() (QueryExpr, error) {
+	t := p.peek()
+	switch {
+	case p.isKeyword(t, "NOT"):
+		p.advance()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpr{Expr: expr}, nil
+	case t.kind == tokenLParen:
+		p.advance()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.advance(); t.kind != tokenRParen {
+			return nil, p.errorf(t, "expected ), got %q", t.text)
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *queryParser) parseComparison() (QueryExpr, error) {
+	key := p.advance()
+	if key.kind != tokenWord {
+		return nil, p.errorf(key, "expected a key, got %q", key.text)
+	}
+	op := p.advance()
+	if op.kind != tokenOp {
+		return nil, p.errorf(op, "expected an operator after %s, got %q", key.text, op.text)
+	}
+	value := p.advance()
+	if value.kind != tokenWord && value.kind != tokenString {
+		return nil, p.errorf(value, "expected a value, got %q", value.text)
+	}
+
+	c := &Comparison{Key: key.text, Op: op.text, Value: value.text}
+	if value.kind == tokenWord {
+		switch {
+		case value.text == "true" || value.text == "false":
+			c.Value = value.text == "true"
+		default:
+			if _, err := strconv.ParseFloat(value.text, 64); err == nil {
+				c.Value = json.Number(value.text)
+			}
+		}
+	}
+
+	switch c.Key {
+	case "date", "time":
+		if _, err := ParseTime(value.text, time.Now()); err != nil {
+			return nil, p.errorf(value, "%s", err)
+		}
+	case "level":
+		if _, ok := c.Value.(string); !ok {
+			return nil, p.errorf(value, "invalid level %q", value.text)
+		}
+	}
+
+	return c, nil
+}
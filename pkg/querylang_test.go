@@ -0,0 +1,73 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	expr, err := ParseQuery(`level>=warn AND foo="bar" AND baz>10 AND msg~"timeout"`)
+	require.NoError(t, err)
+	assert.Equal(t, `(((level>="warn" AND foo="bar") AND baz>10) AND msg~"timeout")`, expr.String())
+
+	expr, err = ParseQuery(`a=1 OR NOT (b!=true and c!~"x y")`)
+	require.NoError(t, err)
+	assert.Equal(t, `(a=1 OR NOT (b!=true AND c!~"x y"))`, expr.String())
+
+	for query, pos := range map[string]int{
+		``:                0,
+		`level>=`:         7,
+		`level warn`:      6,
+		`(a=1`:            4,
+		`a=1 b=2`:         4,
+		`a="unterminated`: 2,
+		`date>=yesterday`: 6,
+		`a=1 AND`:         7,
+		`a=1 & b=2`:       4,
+	} {
+		_, err := ParseQuery(query)
+		var syntaxErr *QuerySyntaxError
+		if assert.ErrorAs(t, err, &syntaxErr, query) {
+			assert.Equal(t, pos, syntaxErr.Pos, query)
+		}
+	}
+}
+
+func TestGetEntriesQueryString(t *testing.T) {
+	lw := newImportLogWriter(t)
+	for _, line := range []string{
+		`{"level": "info", "message": "request timeout", "foo": "bar", "baz": 20}`,
+		`{"level": "warn", "message": "request timeout", "foo": "bar", "baz": 20}`,
+		`{"level": "error", "message": "request timeout", "foo": "bar", "baz": 5}`,
+		`{"level": "error", "message": "connection refused", "foo": "bar", "baz": 30.5}`,
+		`{"level": "ERROR", "message": "request timeout", "foo": "qux", "baz": 30}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	ids := func(query string) []int {
+		entries, err := lw.GetEntries(NewGetEntriesFilter(WithQueryString(query)))
+		require.NoError(t, err, query)
+		ret := []int{}
+		for _, entry := range entries {
+			ret = append(ret, entry.ID)
+		}
+		return ret
+	}
+
+	assert.Equal(t, []int{2}, ids(`level>=warn AND foo="bar" AND baz>10 AND msg~"timeout"`))
+	assert.Equal(t, []int{3, 4, 5}, ids(`level=error`))
+	assert.Equal(t, []int{1, 2}, ids(`level<error`))
+	assert.Equal(t, []int{4, 5}, ids(`baz>=30`))
+	assert.Equal(t, []int{4}, ids(`message!~timeout`))
+	assert.Equal(t, []int{1, 5}, ids(`level=info OR foo=qux`))
+	assert.Equal(t, []int{3, 4}, ids(`NOT (level<error OR foo!=bar)`))
+	assert.Equal(t, []int{4, 5}, ids(`id>3 AND date>=-1h`))
+	assert.Equal(t, []int{}, ids(`missing=1`))
+
+	_, err := lw.GetEntries(NewGetEntriesFilter(WithQueryString(`level>=`)))
+	var syntaxErr *QuerySyntaxError
+	assert.ErrorAs(t, err, &syntaxErr)
+}
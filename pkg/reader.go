@@ -1 +1,24 @@
 package pkg
+
+import (
+	"context"
+	"io"
+)
+
+// LogReadWriter is the surface shared by LogWriter and the remote clients of
+// pkg/client, so that tools can be written once and run either against a
+// database or against a plunger server.
+type LogReadWriter interface {
+	io.Writer
+	io.Closer
+	WriteContext(ctx context.Context, p []byte) (int, error)
+	// GetEntries returns all the entries matching filter, ordered by id.
+	GetEntries(filter *GetEntriesFilter) ([]*LogEntry, error)
+	GetEntriesContext(ctx context.Context, filter *GetEntriesFilter) ([]*LogEntry, error)
+	// GetEntriesPageContext returns a page of the entries matching filter, see GetEntriesPage.
+	GetEntriesPageContext(ctx context.Context, filter *GetEntriesFilter) (*EntriesPage, error)
+	// Follow streams the entries matching filter as they get written.
+	Follow(ctx context.Context, filter *GetEntriesFilter) (<-chan *LogEntry, error)
+}
+
+var _ LogReadWriter = (*LogWriter)(nil)
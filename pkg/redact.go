@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// RedactMode selects what the redaction middleware does with a sensitive value.
+type RedactMode string
+
+const (
+	// RedactModeRedact replaces the value with RedactedValue.
+	RedactModeRedact RedactMode = "redact"
+	// RedactModeHash replaces the value with its SHA-256 hash, which still
+	// allows to correlate entries logging the same value.
+	RedactModeHash RedactMode = "hash"
+	// RedactModeDrop removes the field from the entry.
+	RedactModeDrop RedactMode = "drop"
+)
+
+// RedactedValue replaces sensitive values in RedactModeRedact.
+const RedactedValue = "[REDACTED]"
+
+// DefaultRedactKeys are the keys redacted if no keys are configured.
+var DefaultRedactKeys = []string{"password", "passwd", "secret", "token", "authorization", "api_key", "apikey"}
+
+// creditCardRegexp matches 13 to 19 digits, optionally grouped by spaces or dashes.
+// Candidates are confirmed with the Luhn checksum.
+var creditCardRegexp = regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`)
+
+type InvalidRedactModeError struct {
+	Mode string
+}
+
+func (e *InvalidRedactModeError) Error() string {
+	return "invalid redact mode " + e.Mode + ", expected redact, hash or drop"
+}
+
+// ParseRedactMode parses the name of a RedactMode, as used on the command line.
+func ParseRedactMode(s string) (RedactMode, error) {
+	switch RedactMode(strings.ToLower(s)) {
+	case RedactModeRedact, "":
+		return RedactModeRedact, nil
+	case RedactModeHash:
+		return RedactModeHash, nil
+	case RedactModeDrop:
+		return RedactModeDrop, nil
+	}
+	return "", &InvalidRedactModeError{Mode: s}
+}
+
+// Redactor masks sensitive fields of log entries before they get persisted.
+//
+// Keys are matched case-insensitively, at any nesting level of JSON values.
+// If credit card detection is enabled, string values containing a number that
+// passes the Luhn check are redacted as well: in RedactModeRedact and
+// RedactModeHash only the number is replaced, in RedactModeDrop the whole
+// field is removed.
+type Redactor struct {
+	keys        map[string]bool
+	mode        RedactMode
+	creditCards bool
+}
+
+type RedactOption func(r *Redactor)
+
+// WithRedactKeys sets the keys to redact, replacing DefaultRedactKeys.
+func WithRedactKeys(keys ...string) RedactOption {
+	return func(r *Redactor) {
+		r.keys = map[string]bool{}
+		for _, key := range keys {
+			r.keys[strings.ToLower(key)] = true
+		}
+	}
+}
+
+func WithRedactMode(mode RedactMode) RedactOption {
+	return func(r *Redactor) {
+		r.mode = mode
+	}
+}
+
+// WithRedactCreditCards enables the detection of credit card numbers in string values.
+func WithRedactCreditCards(creditCards bool) RedactOption {
+	return func(r *Redactor) {
+		r.creditCards = creditCards
+	}
+}
+
+func NewRedactor(opts ...RedactOption) *Redactor {
+	r := &Redactor{
+		mode: RedactModeRedact,
+	}
+	WithRedactKeys(DefaultRedactKeys...)(r)
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// RedactMiddleware returns a Middleware redacting entries with a Redactor
+// configured by opts.
+func RedactMiddleware(opts ...RedactOption) Middleware {
+	return NewRedactor(opts...).Middleware
+}
+
+func (r *Redactor) Middleware(next EntryHandler) EntryHandler {
+	return func(entry map[string]interface{}) error {
+		r.Redact(entry)
+		return next(entry)
+	}
+}
+
+// Redact modifies entry in place.
+func (r *Redactor) Redact(entry map[string]interface{}) {
+	r.redactMap(entry)
+}
+
+func (r *Redactor) redactMap(m map[string]interface{}) {
+	for key, value := range m {
+		if r.keys[strings.ToLower(key)] {
+			if r.mode == RedactModeDrop {
+				delete(m, key)
+			} else {
+				m[key] = r.mask(value)
+			}
+			continue
+		}
+
+		v, keep := r.redactValue(value)
+		if !keep {
+			delete(m, key)
+			continue
+		}
+		m[key] = v
+	}
+}
+
+// redactValue returns the redacted value, and false if it should be dropped.
+func (r *Redactor) redactValue(value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		r.redactMap(v)
+	case []interface{}:
+		kept := v[:0]
+		for _, item := range v {
+			item, keep := r.redactValue(item)
+			if keep {
+				kept = append(kept, item)
+			}
+		}
+		return kept, true
+	case string:
+		if !r.creditCards {
+			return v, true
+		}
+		found := false
+		s := creditCardRegexp.ReplaceAllStringFunc(v, func(match string) string {
+			if !isLuhnValid(match) {
+				return match
+			}
+			found = true
+			return r.mask(match)
+		})
+		if found && r.mode == RedactModeDrop {
+			return nil, false
+		}
+		return s, true
+	}
+	return value, true
+}
+
+func (r *Redactor) mask(value interface{}) string {
+	if r.mode != RedactModeHash {
+		return RedactedValue
+	}
+	var s string
+	switch v := value.(type) {
+	case string:
+		s = v
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return RedactedValue
+		}
+		s = string(b)
+	}
+	sum := sha256.Sum256([]byte(s))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func isLuhnValid(s string) bool {
+	sum := 0
+	double := false
+	for i := len(s) - 1; i >= 0; i-- {
+		c := s[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+	}
+	return sum%10 == 0
+}
@@ -0,0 +1,74 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	newEntry := func() map[string]interface{} {
+		return map[string]interface{}{
+			"level":    "info",
+			"message":  "paid with 4111 1111 1111 1111",
+			"Password": "hunter2",
+			"request": map[string]interface{}{
+				"authorization": "Bearer abc",
+				"ids":           []interface{}{"1234567890123", "4111-1111-1111-1111"},
+			},
+		}
+	}
+
+	entry := newEntry()
+	NewRedactor().Redact(entry)
+	assert.Equal(t, RedactedValue, entry["Password"])
+	assert.Equal(t, RedactedValue, entry["request"].(map[string]interface{})["authorization"])
+	// credit card detection is opt-in
+	assert.Equal(t, "paid with 4111 1111 1111 1111", entry["message"])
+
+	entry = newEntry()
+	NewRedactor(WithRedactCreditCards(true)).Redact(entry)
+	assert.Equal(t, "paid with "+RedactedValue, entry["message"])
+	// 1234567890123 fails the Luhn check
+	assert.Equal(t, []interface{}{"1234567890123", RedactedValue}, entry["request"].(map[string]interface{})["ids"])
+
+	entry = newEntry()
+	NewRedactor(WithRedactMode(RedactModeHash)).Redact(entry)
+	assert.Equal(t, "sha256:f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7", entry["Password"])
+
+	entry = newEntry()
+	NewRedactor(WithRedactMode(RedactModeDrop), WithRedactKeys("request"), WithRedactCreditCards(true)).Redact(entry)
+	assert.Equal(t, map[string]interface{}{"level": "info", "Password": "hunter2"}, entry)
+}
+
+func TestParseRedactMode(t *testing.T) {
+	mode, err := ParseRedactMode("HASH")
+	require.NoError(t, err)
+	assert.Equal(t, RedactModeHash, mode)
+
+	_, err = ParseRedactMode("scramble")
+	var modeErr *InvalidRedactModeError
+	assert.ErrorAs(t, err, &modeErr)
+}
+
+func TestLogWriterRedaction(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	config := &LoggerConfig{RedactKeys: []string{"token"}}
+	lw := NewLogWriter(db, NewSchema(), config.logWriterOptions()...)
+	require.NoError(t, lw.Init())
+
+	_, err := lw.Write([]byte(`{"level": "info", "message": "login", "token": "s3cr3t", "user": "alice"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, RedactedValue, entries[0].Meta["token"])
+	assert.Equal(t, "alice", entries[0].Meta["user"])
+}
@@ -0,0 +1,49 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"regexp"
+)
+
+// RegexLineParser parses lines with a regular expression, storing the text
+// matched by each named group under the name of the group. Groups named
+// after the timestamp, level and message fields (time, level and message by
+// default) fill the columns of the entry. Values that look like integers,
+// floats or booleans are converted, see ParseLogfmt, and empty groups are
+// left out.
+type RegexLineParser struct {
+	re *regexp.Regexp
+}
+
+// NewRegexLineParser compiles pattern, which needs at least one named group,
+// such as (?P<level>\w+): (?P<message>.*). It is the factory of the regex
+// format.
+func NewRegexLineParser(pattern string) (LineParser, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	named := false
+	for _, name := range re.SubexpNames() {
+		named = named || name != ""
+	}
+	if !named {
+		return nil, errors.Errorf("pattern %q has no named group", pattern)
+	}
+	return &RegexLineParser{re: re}, nil
+}
+
+func (p *RegexLineParser) ParseLine(line []byte) (map[string]interface{}, error) {
+	match := p.re.FindSubmatch(line)
+	if match == nil {
+		return nil, errors.Errorf("line doesn't match %s", p.re)
+	}
+	entry := map[string]interface{}{}
+	for i, name := range p.re.SubexpNames() {
+		if name == "" || len(match[i]) == 0 {
+			continue
+		}
+		entry[name] = convertLogfmtValue(string(match[i]))
+	}
+	return entry, nil
+}
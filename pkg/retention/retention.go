@@ -0,0 +1,157 @@
+// Package retention provides configurable retention policies, which are
+// applied to a plunger database with pkg.LogWriter.Prune.
+package retention
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Policy limits how many entries are kept in a database.
+//
+// Zero values mean no limit.
+type Policy struct {
+	// MaxAge removes entries older than MaxAge.
+	MaxAge time.Duration
+	// MaxEntries keeps only the MaxEntries most recent entries.
+	MaxEntries int
+	// MaxSize removes the oldest entries until the database is smaller than MaxSize bytes.
+	MaxSize int64
+	// LevelMaxAge overrides MaxAge for individual levels, for example to
+	// discard debug entries sooner than errors.
+	LevelMaxAge map[string]time.Duration
+}
+
+type PolicyOption func(*Policy)
+
+func WithMaxAge(d time.Duration) PolicyOption {
+	return func(p *Policy) {
+		p.MaxAge = d
+	}
+}
+
+func WithMaxEntries(n int) PolicyOption {
+	return func(p *Policy) {
+		p.MaxEntries = n
+	}
+}
+
+func WithMaxSize(size int64) PolicyOption {
+	return func(p *Policy) {
+		p.MaxSize = size
+	}
+}
+
+func WithLevelMaxAge(level string, d time.Duration) PolicyOption {
+	return func(p *Policy) {
+		if p.LevelMaxAge == nil {
+			p.LevelMaxAge = map[string]time.Duration{}
+		}
+		p.LevelMaxAge[strings.ToLower(level)] = d
+	}
+}
+
+func NewPolicy(opts ...PolicyOption) *Policy {
+	p := &Policy{}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// IsEmpty returns true if the policy doesn't limit anything.
+func (p *Policy) IsEmpty() bool {
+	return p.MaxAge <= 0 && p.MaxEntries <= 0 && p.MaxSize <= 0 && len(p.LevelMaxAge) == 0
+}
+
+// PruneRules implements pkg.PrunePolicy.
+//
+// Per-level ages are applied first, then the global age, entry count, and
+// finally the size limit, so that the size limit only removes entries when
+// the other limits didn't free up enough space.
+func (p *Policy) PruneRules() []pkg.PruneRule {
+	rules := []pkg.PruneRule{}
+
+	levels := make([]string, 0, len(p.LevelMaxAge))
+	for level := range p.LevelMaxAge {
+		levels = append(levels, level)
+	}
+	sort.Strings(levels)
+	for _, level := range levels {
+		if d := p.LevelMaxAge[level]; d > 0 {
+			rules = append(rules, pkg.PruneRule{Level: level, MaxAge: d})
+		}
+	}
+
+	if p.MaxAge > 0 {
+		rules = append(rules, pkg.PruneRule{MaxAge: p.MaxAge})
+	}
+	if p.MaxEntries > 0 {
+		rules = append(rules, pkg.PruneRule{MaxEntries: p.MaxEntries})
+	}
+	if p.MaxSize > 0 {
+		rules = append(rules, pkg.PruneRule{MaxSize: p.MaxSize})
+	}
+
+	return rules
+}
+
+// ParseDuration parses a duration, supporting days ("30d") and weeks ("2w")
+// on top of the units of time.ParseDuration.
+func ParseDuration(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for suffix, unit := range map[string]time.Duration{
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	} {
+		if strings.HasSuffix(s, suffix) {
+			n, err := strconv.ParseFloat(strings.TrimSuffix(s, suffix), 64)
+			if err != nil {
+				return 0, errors.Errorf("invalid duration %q", s)
+			}
+			return time.Duration(n * float64(unit)), nil
+		}
+	}
+
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, errors.Errorf("invalid duration %q", s)
+	}
+	return d, nil
+}
+
+var sizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+// ParseSize parses a size in bytes, such as "512KB", "100MB" or "1G".
+func ParseSize(s string) (int64, error) {
+	s = strings.ToUpper(strings.TrimSpace(s))
+	unit := int64(1)
+	for _, u := range sizeUnits {
+		if strings.HasSuffix(s, u.suffix) {
+			s = strings.TrimSpace(strings.TrimSuffix(s, u.suffix))
+			unit = u.size
+			break
+		}
+	}
+
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil || n < 0 {
+		return 0, errors.Errorf("invalid size %q", s)
+	}
+	return int64(n * float64(unit)), nil
+}
@@ -0,0 +1,59 @@
+package retention
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestPolicyPruneRules(t *testing.T) {
+	p := NewPolicy(
+		WithMaxAge(48*time.Hour),
+		WithMaxSize(1024),
+		WithLevelMaxAge("DEBUG", time.Hour),
+		WithLevelMaxAge("info", 0),
+	)
+	assert.Equal(t, []pkg.PruneRule{
+		{Level: "debug", MaxAge: time.Hour},
+		{MaxAge: 48 * time.Hour},
+		{MaxSize: 1024},
+	}, p.PruneRules())
+
+	assert.True(t, NewPolicy().IsEmpty())
+	assert.Empty(t, NewPolicy().PruneRules())
+}
+
+func TestParseDuration(t *testing.T) {
+	for s, expected := range map[string]time.Duration{
+		"30d":  30 * 24 * time.Hour,
+		"2w":   14 * 24 * time.Hour,
+		"1.5h": 90 * time.Minute,
+		"10m":  10 * time.Minute,
+	} {
+		d, err := ParseDuration(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, d, s)
+	}
+
+	_, err := ParseDuration("xd")
+	assert.Error(t, err)
+}
+
+func TestParseSize(t *testing.T) {
+	for s, expected := range map[string]int64{
+		"100":   100,
+		"100B":  100,
+		"2KB":   2048,
+		"1.5mb": 1536 * 1024,
+		"1G":    1 << 30,
+	} {
+		n, err := ParseSize(s)
+		require.NoError(t, err, s)
+		assert.Equal(t, expected, n, s)
+	}
+
+	_, err := ParseSize("lots")
+	assert.Error(t, err)
+}
@@ -0,0 +1,226 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"strings"
+	"time"
+)
+
+// RollupCountKey is the meta key recording, on a summary entry written by
+// Rollup, the number of entries it replaces. The summary also counts them in
+// its sampled_dropped column, so that Aggregate's Total keeps counting them.
+const RollupCountKey = "rollup_count"
+
+// DefaultRollupBucket is the period summarized by a summary entry when
+// RollupRule has no Bucket.
+const DefaultRollupBucket = time.Hour
+
+// RollupRule describes which entries Rollup replaces by summary entries.
+type RollupRule struct {
+	// OlderThan selects the entries older than this. Only whole buckets are
+	// rolled up, so the most recent of them may be left for the next run.
+	OlderThan time.Duration
+	// Bucket is the period summarized by each summary entry, in whole
+	// seconds. Defaults to DefaultRollupBucket.
+	Bucket time.Duration
+	// Level restricts the rule to entries of this level (case-insensitive).
+	Level string
+}
+
+type RollupResult struct {
+	// RolledUpEntries is the number of entries replaced by summary entries.
+	RolledUpEntries int64
+	SummaryEntries  int64
+}
+
+// rollupGroup is a set of entries replaced by a single summary entry.
+type rollupGroup struct {
+	Session sql.NullString `db:"session"`
+	Group   sql.NullString `db:"group_id"`
+	Level   string         `db:"level"`
+	Message sql.NullString `db:"message"`
+	Bucket  int64          `db:"bucket"`
+	Count   float64        `db:"count"`
+	Dropped float64        `db:"dropped"`
+}
+
+// Rollup replaces the entries selected by rule with a summary entry per
+// session, group, level, message and bucket, dated at the start of the
+// bucket, to keep long-term trends while the database stays small. The other
+// columns and the meta values of the entries are lost, except for
+// RollupCountKey and the sampled_dropped column: in particular, summaries
+// can't be filtered by stream, which is a meta value (see StreamKey).
+// Summary entries are merged by later runs if needed.
+func (l *LogWriter) Rollup(rule RollupRule) (*RollupResult, error) {
+	return l.RollupContext(context.Background(), rule)
+}
+
+func (l *LogWriter) RollupContext(ctx context.Context, rule RollupRule) (*RollupResult, error) {
+	if rule.OlderThan <= 0 {
+		return nil, errors.New("rollups need a minimum age")
+	}
+	bucket := rule.Bucket
+	if bucket <= 0 {
+		bucket = DefaultRollupBucket
+	}
+	if bucket%time.Second != 0 {
+		return nil, errors.Errorf("invalid rollup bucket %s, expected whole seconds", bucket)
+	}
+	seconds := int64(bucket / time.Second)
+	cutoff := time.Unix(time.Now().Add(-rule.OlderThan).Unix()/seconds*seconds, 0).UTC()
+
+	groups, err := l.rollupGroups(ctx, rule, cutoff, seconds)
+	if err != nil {
+		return nil, err
+	}
+
+	tables, err := l.entryTables()
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &RollupResult{}
+	for _, group := range groups {
+		var deleted int64
+		var refs []string
+		err := l.retryBusy(ctx, func() error {
+			tx, err := l.db.BeginTxx(ctx, nil)
+			if err != nil {
+				return err
+			}
+			deleted, refs, err = l.rollupGroupTx(ctx, tx, tables, rule, cutoff, seconds, group)
+			if err != nil {
+				_ = tx.Rollback()
+				return err
+			}
+			return tx.Commit()
+		})
+		if err != nil {
+			return ret, err
+		}
+		if err := l.removeUnreferencedBlobs(ctx, refs); err != nil {
+			return ret, err
+		}
+		ret.RolledUpEntries += deleted
+		ret.SummaryEntries++
+	}
+	return ret, nil
+}
+
+// rollupSelect returns a query of the entries of rule older than cutoff,
+// selecting columns.
+func (l *LogWriter) rollupSelect(rule RollupRule, cutoff time.Time, columns ...string) *sqlbuilder.SelectBuilder {
+	sb := sqlbuilder.Select(columns...).From("log_entries e")
+	sb.Where(sb.L("e.date", cutoff))
+	if rule.Level != "" {
+		sb.Where(sb.E("LOWER(e.level)", strings.ToLower(rule.Level)))
+	}
+	return sb
+}
+
+func (l *LogWriter) rollupBucketExpression(seconds int64) string {
+	return fmt.Sprintf("(%s / %d) * %d", l.store.UnixTime("e.date"), seconds, seconds)
+}
+
+// rollupGroups returns the groups of entries to roll up, skipping the
+// groups made of a single summary entry.
+func (l *LogWriter) rollupGroups(ctx context.Context, rule RollupRule, cutoff time.Time, seconds int64) ([]*rollupGroup, error) {
+	sb := l.rollupSelect(rule, cutoff)
+	count := l.metaValueExpression(sb, RollupCountKey, "COALESCE(lem.int_value, lem.real_value)")
+	dropped := "e.sampled_dropped"
+	bucket := l.rollupBucketExpression(seconds)
+	sb.Select(
+		"e.session AS session", "e.group_id AS group_id", "e.level AS level", "e.message AS message", bucket+" AS bucket",
+		// the entries dropped before the summaries were counted as part of their rollup
+		fmt.Sprintf("SUM(COALESCE(%s, 1)) AS count", count),
+		fmt.Sprintf("SUM(CASE WHEN %s IS NULL THEN COALESCE(%s, 0) ELSE %s - (%s - 1) END) AS dropped",
+			count, dropped, dropped, count),
+	)
+	sb.GroupBy("e.session", "e.group_id", "e.level", "e.message", bucket)
+	sb.Having(fmt.Sprintf("COUNT(*) > 1 OR COUNT(%s) = 0", count))
+	sb.OrderBy("bucket")
+
+	s, args := sb.Build()
+	ret := []*rollupGroup{}
+	if err := l.db.SelectContext(ctx, &ret, l.db.Rebind(s), args...); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// rollupGroupTx replaces the entries of group by a summary entry as part of
+// tx, and returns the number of replaced entries and the offloaded values
+// they referenced, see deleteEntriesTx.
+func (l *LogWriter) rollupGroupTx(
+	ctx context.Context,
+	tx *sqlx.Tx,
+	tables [][2]string,
+	rule RollupRule,
+	cutoff time.Time,
+	seconds int64,
+	group *rollupGroup,
+) (int64, []string, error) {
+	ids := l.rollupSelect(rule, cutoff, "e.id")
+	ids.Where(ids.E("e.level", group.Level), ids.E(l.rollupBucketExpression(seconds), group.Bucket))
+	var session interface{}
+	if group.Session.Valid {
+		session = group.Session.String
+		ids.Where(ids.E("e.session", group.Session.String))
+	} else {
+		ids.Where(ids.IsNull("e.session"))
+	}
+	if group.Group.Valid {
+		ids.Where(ids.E("e.group_id", group.Group.String))
+	} else {
+		ids.Where(ids.IsNull("e.group_id"))
+	}
+	if group.Message.Valid {
+		ids.Where(ids.E("e.message", group.Message.String))
+	} else {
+		ids.Where(ids.IsNull("e.message"))
+	}
+
+	// the summary is dated before cutoff, it has to be inserted once the entries are gone
+	deleted, refs, err := l.deleteEntriesTx(ctx, tx, tables, ids)
+	if err != nil {
+		return 0, nil, err
+	}
+	count := int64(group.Count)
+	meta := map[string]interface{}{
+		RollupCountKey: count,
+	}
+	dropped := sql.NullInt64{Int64: count - 1 + int64(group.Dropped), Valid: true}
+	// encrypted messages get encrypted again by insertParsedEntry
+	message := group.Message
+	if err := l.decryptString(&message.String); err != nil {
+		return 0, nil, err
+	}
+	err = l.insertParsedEntry(ctx, tx, time.Unix(group.Bucket, 0).UTC(), group.Level, session, group.Group, dropped,
+		message, entryCaller{}, entryError{}, entryTrace{}, meta)
+	if err != nil {
+		return 0, nil, err
+	}
+	return deleted, refs, nil
+}
+
+// RunRollups applies rule every interval until ctx is done, reporting the
+// errors of the runs to onError if set.
+func (l *LogWriter) RunRollups(ctx context.Context, rule RollupRule, interval time.Duration, onError func(error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if _, err := l.RollupContext(ctx, rule); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
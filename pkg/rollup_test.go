@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLogWriterRollup(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	old := time.Now().UTC().Add(-72 * time.Hour).Truncate(24 * time.Hour)
+	for i, e := range []struct {
+		level   string
+		message string
+		offset  time.Duration
+	}{
+		{"info", "request", time.Minute},
+		{"info", "request", 2 * time.Minute},
+		{"info", "request", 3 * time.Minute},
+		{"error", "failed", 4 * time.Minute},
+		{"info", "request", time.Hour + time.Minute},
+	} {
+		_, err := lw.Write([]byte(fmt.Sprintf(
+			`{"level": %q, "time": %q, "message": %q, "i": %d}`,
+			e.level, old.Add(e.offset).Format(time.RFC3339), e.message, i,
+		)))
+		require.NoError(t, err)
+	}
+	_, err := lw.Write([]byte(`{"level": "info", "message": "recent"}`))
+	require.NoError(t, err)
+
+	_, err = lw.Rollup(RollupRule{})
+	require.Error(t, err)
+
+	res, err := lw.Rollup(RollupRule{OlderThan: 24 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, int64(5), res.RolledUpEntries)
+	assert.Equal(t, int64(3), res.SummaryEntries)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(
+		WithOrderBy("date", Asc), WithOrderBy("message", Asc)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"failed", "request", "request", "recent"}, entryMessages(entries))
+	assert.Equal(t, old, entries[1].Date.UTC())
+	assert.Equal(t, int64(3), entries[1].Meta[RollupCountKey])
+	require.NotNil(t, entries[1].SampledDropped)
+	assert.Equal(t, int64(2), *entries[1].SampledDropped)
+	assert.NotContains(t, entries[1].Meta, "i")
+
+	rows, err := lw.Aggregate(NewGetEntriesFilter(), GroupBy("message"), Count(), Total())
+	require.NoError(t, err)
+	totals := map[interface{}]int64{}
+	for _, row := range rows {
+		totals[row.Group["message"]] = row.Total()
+	}
+	assert.Equal(t, map[interface{}]int64{"failed": 1, "recent": 1, "request": 4}, totals)
+
+	// summaries are left alone, unless merged into larger buckets
+	res, err = lw.Rollup(RollupRule{OlderThan: 24 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), res.SummaryEntries)
+
+	res, err = lw.Rollup(RollupRule{OlderThan: 24 * time.Hour, Bucket: 24 * time.Hour, Level: "INFO"})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.RolledUpEntries)
+	assert.Equal(t, int64(1), res.SummaryEntries)
+
+	rows, err = lw.Aggregate(NewGetEntriesFilter(), GroupBy("message"), Count(), Total())
+	require.NoError(t, err)
+	for _, row := range rows {
+		if row.Group["message"] == "request" {
+			assert.Equal(t, int64(1), row.Count())
+			assert.Equal(t, int64(4), row.Total())
+		}
+	}
+}
+
+func TestLogWriterRollupGroups(t *testing.T) {
+	lw := newImportLogWriter(t, WithGroupKey("request_id"))
+
+	old := time.Now().UTC().Add(-72 * time.Hour).Truncate(24 * time.Hour)
+	for i, group := range []string{"r1", "r1", "r2"} {
+		_, err := lw.Write([]byte(fmt.Sprintf(
+			`{"level": "info", "time": %q, "message": "request", "request_id": %q}`,
+			old.Add(time.Duration(i)*time.Minute).Format(time.RFC3339), group,
+		)))
+		require.NoError(t, err)
+	}
+
+	res, err := lw.Rollup(RollupRule{OlderThan: 24 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), res.SummaryEntries)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithGroup("r1")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, int64(2), entries[0].Meta[RollupCountKey])
+}
+
+func TestLogWriterRollupManyEntries(t *testing.T) {
+	lw := newImportLogWriter(t)
+	writeManyEntries(t, lw, 33000, 72*time.Hour)
+
+	res, err := lw.Rollup(RollupRule{OlderThan: 24 * time.Hour, Bucket: 24 * time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, int64(33000), res.RolledUpEntries)
+	assert.Equal(t, int64(1), res.SummaryEntries)
+
+	var metaRows int
+	require.NoError(t, lw.db.Get(&metaRows, "SELECT COUNT(*) FROM log_entries_meta"))
+	assert.Equal(t, 1, metaRows)
+}
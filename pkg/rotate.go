@@ -0,0 +1,315 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Rotation closes a sqlite database once it gets too large or a day boundary
+// passes, renames it after the day it was started (app.db becomes
+// app-2024-05-01.db), and starts a fresh database under the original name.
+//
+// Rotated files are listed in a manifest next to the database (see
+// ManifestPath), so that tools can query across them.
+
+// RotatedFile is an entry of the rotation manifest.
+type RotatedFile struct {
+	Path string `json:"path"`
+	// From is when the file was started, To when it was rotated.
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// ManifestPath is the manifest listing the rotated files of dbFile.
+func ManifestPath(dbFile string) string {
+	return dbFile + ".manifest.json"
+}
+
+// ReadManifest returns the files rotated from dbFile, oldest first. Paths are
+// relative to the directory of dbFile.
+func ReadManifest(dbFile string) ([]*RotatedFile, error) {
+	b, err := os.ReadFile(ManifestPath(dbFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []*RotatedFile{}, nil
+		}
+		return nil, err
+	}
+	ret := []*RotatedFile{}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, errors.Wrapf(err, "invalid manifest %s", ManifestPath(dbFile))
+	}
+	sort.SliceStable(ret, func(i, j int) bool {
+		return ret[i].From.Before(ret[j].From)
+	})
+	return ret, nil
+}
+
+func writeManifest(dbFile string, files []*RotatedFile) error {
+	b, err := json.MarshalIndent(files, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := ManifestPath(dbFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// rotatedPath returns an unused path for dbFile rotated on the given day.
+func rotatedPath(dbFile string, day time.Time) string {
+	ext := filepath.Ext(dbFile)
+	base := strings.TrimSuffix(dbFile, ext)
+	path := fmt.Sprintf("%s-%s%s", base, day.Format("2006-01-02"), ext)
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return path
+		}
+		path = fmt.Sprintf("%s-%s.%d%s", base, day.Format("2006-01-02"), i, ext)
+	}
+}
+
+// RotateFile renames the closed sqlite database dbFile, along with its WAL
+// files and offloaded values, and records it in the manifest. from is when
+// the file was started, and gives its name. It returns the new path.
+func RotateFile(dbFile string, from time.Time) (string, error) {
+	now := time.Now().UTC()
+	path := rotatedPath(dbFile, from.UTC())
+
+	if err := os.Rename(dbFile, path); err != nil {
+		return "", err
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(dbFile+suffix, path+suffix); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	if err := os.Rename(DefaultBlobDir(dbFile), DefaultBlobDir(path)); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	files, err := ReadManifest(dbFile)
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(filepath.Dir(dbFile), path)
+	if err != nil {
+		return "", err
+	}
+	files = append(files, &RotatedFile{Path: rel, From: from.UTC(), To: now})
+	if err := writeManifest(dbFile, files); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// DefaultRotateCheckInterval is how often RotatingWriter checks the size of the database.
+const DefaultRotateCheckInterval = 5 * time.Second
+
+// RotatingWriter is an io.Writer for zerolog that writes to a LogWriter,
+// rotating the underlying sqlite database when needed.
+type RotatingWriter struct {
+	// dsn is opened, dbFile is the path it refers to
+	dsn           string
+	dbFile        string
+	maxSize       int64
+	daily         bool
+	checkInterval time.Duration
+	lwOpts        []LogWriterOption
+	onRotate      func(path string)
+
+	mu        sync.Mutex
+	lw        *LogWriter
+	startedAt time.Time
+	checkedAt time.Time
+}
+
+type RotateOption func(*RotatingWriter)
+
+// WithRotateSize rotates the database once it is larger than size bytes.
+func WithRotateSize(size int64) RotateOption {
+	return func(w *RotatingWriter) {
+		w.maxSize = size
+	}
+}
+
+// WithRotateDaily rotates the database when the (UTC) day changes.
+func WithRotateDaily(daily bool) RotateOption {
+	return func(w *RotatingWriter) {
+		w.daily = daily
+	}
+}
+
+// WithRotateCheckInterval sets how often the size of the database is checked.
+func WithRotateCheckInterval(interval time.Duration) RotateOption {
+	return func(w *RotatingWriter) {
+		w.checkInterval = interval
+	}
+}
+
+// WithRotateLogWriterOptions sets the options of the LogWriters opened by the RotatingWriter.
+func WithRotateLogWriterOptions(opts ...LogWriterOption) RotateOption {
+	return func(w *RotatingWriter) {
+		w.lwOpts = append(w.lwOpts, opts...)
+	}
+}
+
+// WithOnRotate registers a callback called with the path of each rotated file.
+func WithOnRotate(onRotate func(path string)) RotateOption {
+	return func(w *RotatingWriter) {
+		w.onRotate = onRotate
+	}
+}
+
+// NewRotatingWriter opens the sqlite database dbFile, which can be a DSN
+// returned by ConcurrentSQLiteDSN.
+//
+// An existing database is considered started at the date of its first entry.
+func NewRotatingWriter(dbFile string, schema *Schema, opts ...RotateOption) (*RotatingWriter, error) {
+	if isPostgresDSN(dbFile) {
+		return nil, errors.New("rotation is only supported for sqlite files")
+	}
+
+	w := &RotatingWriter{
+		dsn:           dbFile,
+		dbFile:        sqlitePath(dbFile),
+		checkInterval: DefaultRotateCheckInterval,
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	lw, err := OpenLogWriter(w.dsn, schema, w.lwOpts...)
+	if err != nil {
+		return nil, err
+	}
+	w.lw = lw
+	w.startedAt = time.Now().UTC()
+	w.checkedAt = w.startedAt
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithLimit(1)))
+	if err != nil {
+		_ = lw.Close()
+		return nil, err
+	}
+	if len(entries) > 0 {
+		w.startedAt = entries[0].Date.UTC()
+	}
+
+	return w, nil
+}
+
+// LogWriter returns the LogWriter of the current database. It is replaced on rotation.
+func (w *RotatingWriter) LogWriter() *LogWriter {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.lw
+}
+
+func (w *RotatingWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.lw == nil {
+		return 0, errors.New("rotating writer is closed")
+	}
+
+	rotate, err := w.shouldRotate()
+	if err != nil {
+		return 0, err
+	}
+	if rotate {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	return w.lw.Write(p)
+}
+
+func (w *RotatingWriter) shouldRotate() (bool, error) {
+	now := time.Now().UTC()
+	if w.daily && now.Format("2006-01-02") != w.startedAt.Format("2006-01-02") {
+		return true, nil
+	}
+	if w.maxSize > 0 && now.Sub(w.checkedAt) >= w.checkInterval {
+		w.checkedAt = now
+		size, err := w.lw.store.Size()
+		if err != nil {
+			return false, err
+		}
+		return size > w.maxSize, nil
+	}
+	return false, nil
+}
+
+// Rotate rotates the database now.
+func (w *RotatingWriter) Rotate() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.rotate()
+}
+
+func (w *RotatingWriter) rotate() error {
+	old := w.lw
+	if old == nil {
+		return errors.New("rotating writer is closed")
+	}
+	active, err := old.Sessions().GetActive()
+	if err != nil {
+		return err
+	}
+	w.lw = nil
+	if err := old.Close(); err != nil {
+		return err
+	}
+
+	// reopen the database even if it couldn't be renamed, so that logging goes on
+	path, rotateErr := RotateFile(w.dbFile, w.startedAt)
+	lw, err := OpenLogWriter(w.dsn, old.schema, w.lwOpts...)
+	if err != nil {
+		return err
+	}
+	// entries keep the session the previous database was writing
+	lw.session = old.session
+	w.lw = lw
+	if rotateErr != nil {
+		return errors.Wrapf(rotateErr, "could not rotate %s", w.dbFile)
+	}
+
+	w.startedAt = time.Now().UTC()
+	w.checkedAt = w.startedAt
+	if active != nil {
+		if err := lw.Sessions().insertSession(active); err != nil {
+			return err
+		}
+		if err := lw.Sessions().SetActive(active.ID); err != nil {
+			return err
+		}
+	}
+
+	if w.onRotate != nil {
+		w.onRotate(path)
+	}
+	return nil
+}
+
+func (w *RotatingWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.lw == nil {
+		return nil
+	}
+	err := w.lw.Close()
+	w.lw = nil
+	return err
+}
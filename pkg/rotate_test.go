@@ -0,0 +1,134 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotatingWriter(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "app.db")
+
+	rotated := []string{}
+	w, err := NewRotatingWriter(dbFile, nil,
+		WithRotateCheckInterval(0),
+		WithRotateLogWriterOptions(WithBlobOffloading(DefaultBlobDir(dbFile), 100)),
+		WithOnRotate(func(path string) {
+			rotated = append(rotated, path)
+		}),
+	)
+	require.NoError(t, err)
+	defer func(w *RotatingWriter) {
+		_ = w.Close()
+	}(w)
+
+	session, err := w.LogWriter().Sessions().NewSession("run", nil)
+	require.NoError(t, err)
+	require.NoError(t, w.LogWriter().Sessions().SetActive(session.ID))
+	w.LogWriter().session = session.ID
+
+	large := strings.Repeat("x", 200)
+	_, err = w.Write([]byte(`{"level": "info", "message": "first", "payload": {"text": "` + large + `"}}`))
+	require.NoError(t, err)
+	require.NoError(t, w.Rotate())
+	_, err = w.Write([]byte(`{"level": "info", "message": "second"}`))
+	require.NoError(t, err)
+
+	today := time.Now().UTC().Format("2006-01-02")
+	rotatedFile := filepath.Join(dir, "app-"+today+".db")
+	assert.Equal(t, []string{rotatedFile}, rotated)
+	assert.DirExists(t, DefaultBlobDir(rotatedFile))
+
+	entries, err := w.LogWriter().GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "second", *entries[0].Message)
+	require.NotNil(t, entries[0].Session)
+	assert.Equal(t, session.ID, *entries[0].Session)
+	active, err := w.LogWriter().Sessions().GetActive()
+	require.NoError(t, err)
+	require.NotNil(t, active)
+	assert.Equal(t, "run", active.Name)
+
+	old, err := OpenLogWriter(rotatedFile, nil, WithBlobOffloading(DefaultBlobDir(rotatedFile), 0))
+	require.NoError(t, err)
+	defer func(old *LogWriter) {
+		_ = old.Close()
+	}(old)
+	entries, err = old.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "first", *entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"text": large}, entries[0].Meta["payload"])
+
+	// a second rotation on the same day gets a suffix
+	require.NoError(t, w.Rotate())
+	assert.Equal(t, filepath.Join(dir, "app-"+today+".2.db"), rotated[1])
+
+	files, err := ReadManifest(dbFile)
+	require.NoError(t, err)
+	require.Len(t, files, 2)
+	assert.Equal(t, "app-"+today+".db", files[0].Path)
+	assert.Equal(t, "app-"+today+".2.db", files[1].Path)
+	assert.False(t, files[0].To.Before(files[0].From))
+}
+
+func TestRotatingWriterSize(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "app.db")
+
+	w, err := NewRotatingWriter(ConcurrentSQLiteDSN(dbFile), nil,
+		WithRotateSize(64*1024),
+		WithRotateCheckInterval(0),
+	)
+	require.NoError(t, err)
+	defer func(w *RotatingWriter) {
+		_ = w.Close()
+	}(w)
+
+	line := []byte(`{"level": "info", "message": "` + strings.Repeat("x", 1000) + `"}`)
+	for i := 0; i < 200; i++ {
+		_, err := w.Write(line)
+		require.NoError(t, err)
+	}
+
+	files, err := ReadManifest(dbFile)
+	require.NoError(t, err)
+	// about 200KB of messages
+	assert.GreaterOrEqual(t, len(files), 2)
+	for _, f := range files {
+		_, err := os.Stat(filepath.Join(dir, f.Path))
+		assert.NoError(t, err)
+	}
+}
+
+func TestRotatingWriterDaily(t *testing.T) {
+	dir := t.TempDir()
+	dbFile := filepath.Join(dir, "app.db")
+
+	w, err := NewRotatingWriter(dbFile, nil, WithRotateDaily(true))
+	require.NoError(t, err)
+	defer func(w *RotatingWriter) {
+		_ = w.Close()
+	}(w)
+
+	_, err = w.Write([]byte(`{"level": "info", "message": "today"}`))
+	require.NoError(t, err)
+	assert.NoFileExists(t, ManifestPath(dbFile))
+
+	// pretend the database was started yesterday
+	yesterday := time.Now().UTC().AddDate(0, 0, -1)
+	w.startedAt = yesterday
+	_, err = w.Write([]byte(`{"level": "info", "message": "tomorrow"}`))
+	require.NoError(t, err)
+
+	files, err := ReadManifest(dbFile)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "app-"+yesterday.Format("2006-01-02")+".db", files[0].Path)
+}
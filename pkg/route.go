@@ -0,0 +1,118 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"strings"
+)
+
+// ComponentKey is the key naming the component that logged an entry, such
+// as db or http, matched by LevelRoute.Component.
+const ComponentKey = "component"
+
+// LevelRoute sets the least severe level persisted for the entries of a
+// component, matched on its ComponentKey value or on the path of its
+// caller. A route with neither matches all entries.
+type LevelRoute struct {
+	Component string
+	// CallerPrefix matches the callers whose path starts with it, or has it
+	// after a slash: internal/http matches the absolute paths logged by
+	// zerolog, such as /home/u/proj/internal/http/server.go:12, but not
+	// /home/u/proj/xinternal/http/server.go:12.
+	CallerPrefix string
+	MinLevel     zerolog.Level
+}
+
+func (r LevelRoute) matches(component string, caller string) bool {
+	if r.Component != "" && r.Component != component {
+		return false
+	}
+	return r.CallerPrefix == "" || strings.HasPrefix(caller, r.CallerPrefix) ||
+		strings.Contains(caller, "/"+r.CallerPrefix)
+}
+
+// ParseLevelRoute parses component=level, caller:prefix=level, or *=level
+// for all entries, such as db=debug or caller:internal/http=warn.
+func ParseLevelRoute(s string) (LevelRoute, error) {
+	match, level, ok := strings.Cut(s, "=")
+	if !ok || match == "" {
+		return LevelRoute{}, errors.Errorf("invalid level route %q, expected component=level or caller:prefix=level", s)
+	}
+	minLevel, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil || minLevel == zerolog.NoLevel {
+		return LevelRoute{}, errors.Errorf("invalid level %q in level route %q", level, s)
+	}
+	ret := LevelRoute{MinLevel: minLevel}
+	switch {
+	case match == "*":
+	case strings.HasPrefix(match, "caller:"):
+		ret.CallerPrefix = strings.TrimPrefix(match, "caller:")
+	default:
+		ret.Component = match
+	}
+	return ret, nil
+}
+
+// LevelRouter drops the entries less severe than the minimum level of their
+// component before they get persisted. Each entry is routed by the first
+// route matching it, entries matching no route or with an unknown level are
+// always kept.
+type LevelRouter struct {
+	routes       []LevelRoute
+	componentKey string
+}
+
+type LevelRouteOption func(*LevelRouter)
+
+func WithLevelRoutes(routes ...LevelRoute) LevelRouteOption {
+	return func(r *LevelRouter) {
+		r.routes = append(r.routes, routes...)
+	}
+}
+
+// WithLevelRouteComponentKey sets the key naming the component of entries.
+// Defaults to ComponentKey.
+func WithLevelRouteComponentKey(key string) LevelRouteOption {
+	return func(r *LevelRouter) {
+		r.componentKey = key
+	}
+}
+
+func NewLevelRouter(opts ...LevelRouteOption) *LevelRouter {
+	r := &LevelRouter{componentKey: ComponentKey}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// LevelRouteMiddleware returns a Middleware routing entries with a
+// LevelRouter configured by opts.
+func LevelRouteMiddleware(opts ...LevelRouteOption) Middleware {
+	return NewLevelRouter(opts...).Middleware
+}
+
+func (r *LevelRouter) Middleware(next EntryHandler) EntryHandler {
+	return func(entry map[string]interface{}) error {
+		if !r.keep(entry) {
+			return nil
+		}
+		return next(entry)
+	}
+}
+
+func (r *LevelRouter) keep(entry map[string]interface{}) bool {
+	s, _ := entry["level"].(string)
+	level, err := zerolog.ParseLevel(strings.ToLower(s))
+	if err != nil || level == zerolog.NoLevel {
+		return true
+	}
+	component, _ := entry[r.componentKey].(string)
+	caller, _ := entry[zerolog.CallerFieldName].(string)
+	for _, route := range r.routes {
+		if route.matches(component, caller) {
+			return level >= route.MinLevel
+		}
+	}
+	return true
+}
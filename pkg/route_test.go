@@ -0,0 +1,109 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestParseLevelRoute(t *testing.T) {
+	route, err := ParseLevelRoute("db=debug")
+	require.NoError(t, err)
+	assert.Equal(t, LevelRoute{Component: "db", MinLevel: zerolog.DebugLevel}, route)
+
+	route, err = ParseLevelRoute("caller:internal/http=WARN")
+	require.NoError(t, err)
+	assert.Equal(t, LevelRoute{CallerPrefix: "internal/http", MinLevel: zerolog.WarnLevel}, route)
+
+	route, err = ParseLevelRoute("*=error")
+	require.NoError(t, err)
+	assert.Equal(t, LevelRoute{MinLevel: zerolog.ErrorLevel}, route)
+
+	for _, s := range []string{"db", "=info", "db=loud", "db="} {
+		_, err = ParseLevelRoute(s)
+		assert.Error(t, err, s)
+	}
+}
+
+func TestLevelRouter(t *testing.T) {
+	r := NewLevelRouter(WithLevelRoutes(
+		LevelRoute{Component: "db", MinLevel: zerolog.DebugLevel},
+		LevelRoute{Component: "http", MinLevel: zerolog.WarnLevel},
+		LevelRoute{CallerPrefix: "internal/cache/", MinLevel: zerolog.ErrorLevel},
+	))
+
+	keep := func(level string, fields map[string]interface{}) bool {
+		entry := map[string]interface{}{"level": level}
+		for k, v := range fields {
+			entry[k] = v
+		}
+		return r.keep(entry)
+	}
+	db := map[string]interface{}{ComponentKey: "db"}
+	http := map[string]interface{}{ComponentKey: "http"}
+	cache := map[string]interface{}{zerolog.CallerFieldName: "internal/cache/lru.go:12"}
+	absoluteCache := map[string]interface{}{zerolog.CallerFieldName: "/home/u/proj/internal/cache/lru.go:12"}
+	otherCache := map[string]interface{}{zerolog.CallerFieldName: "/home/u/proj/xinternal/cache/lru.go:12"}
+
+	assert.True(t, keep("debug", db))
+	assert.False(t, keep("trace", db))
+	assert.False(t, keep("info", http))
+	assert.True(t, keep("WARN", http))
+	assert.False(t, keep("warn", cache))
+	assert.True(t, keep("error", cache))
+	assert.False(t, keep("warn", absoluteCache))
+	// routes match on path segments
+	assert.True(t, keep("warn", otherCache))
+	// entries matching no route and with unknown levels are kept
+	assert.True(t, keep("trace", nil))
+	assert.True(t, keep("verbose", http))
+}
+
+func TestLogWriterLevelRoutes(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	config := &LoggerConfig{LevelRoutes: []LevelRoute{
+		{Component: "db", MinLevel: zerolog.DebugLevel},
+		{MinLevel: zerolog.WarnLevel},
+	}}
+	lw := NewLogWriter(db, NewSchema(), config.logWriterOptions()...)
+	require.NoError(t, lw.Init())
+
+	for _, line := range []string{
+		`{"level": "debug", "component": "db", "message": "query"}`,
+		`{"level": "info", "component": "http", "message": "request"}`,
+		`{"level": "warn", "component": "http", "message": "slow request"}`,
+		`{"level": "info", "message": "started"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter())
+	require.NoError(t, err)
+	messages := []string{}
+	for _, entry := range entries {
+		messages = append(messages, *entry.Message)
+	}
+	assert.Equal(t, []string{"query", "slow request"}, messages)
+}
+
+func TestLogWriterCallerLevelRoutes(t *testing.T) {
+	config := &LoggerConfig{LevelRoutes: []LevelRoute{
+		{CallerPrefix: "pkg/route_test.go", MinLevel: zerolog.ErrorLevel},
+	}}
+	lw := newImportLogWriter(t, config.logWriterOptions()...)
+
+	// zerolog logs the absolute path of the caller
+	logger := zerolog.New(lw).With().Caller().Logger()
+	logger.Warn().Msg("dropped")
+	logger.Error().Msg("kept")
+
+	assert.Equal(t, []string{"kept"}, messages(t, lw))
+}
@@ -0,0 +1,136 @@
+package rpc
+
+import (
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/rpc/plungerpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+// Client talks to a plunger gRPC server.
+//
+// It implements io.Writer, so that it can be used as zerolog output to ship
+// the logs of a process to a remote plunger database:
+//
+//	log.Logger = log.Output(client)
+type Client struct {
+	conn   *grpc.ClientConn
+	client plungerpb.LogServiceClient
+}
+
+var _ pkg.LogReadWriter = (*Client)(nil)
+
+// Dial connects to the server at target. The connection is unencrypted,
+// unless opts contain other transport credentials.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}, opts...)
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		conn:   conn,
+		client: plungerpb.NewLogServiceClient(conn),
+	}, nil
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// Write sends a single log line.
+func (c *Client) Write(p []byte) (int, error) {
+	return c.WriteContext(context.Background(), p)
+}
+
+func (c *Client) WriteContext(ctx context.Context, p []byte) (int, error) {
+	// zerolog reuses its buffers once Write returns, but the request may
+	// still be referenced by the transport
+	line := make([]byte, len(p))
+	copy(line, p)
+	if _, err := c.client.WriteEntry(ctx, &plungerpb.WriteEntryRequest{Line: line}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// WriteBatch sends several log lines, which get written in a single transaction.
+func (c *Client) WriteBatch(ctx context.Context, lines [][]byte) (int, error) {
+	res, err := c.client.WriteBatch(ctx, &plungerpb.WriteBatchRequest{Lines: lines})
+	if err != nil {
+		return 0, err
+	}
+	return int(res.Written), nil
+}
+
+func (c *Client) GetEntries(filter *pkg.GetEntriesFilter) ([]*pkg.LogEntry, error) {
+	return c.GetEntriesContext(context.Background(), filter)
+}
+
+// GetEntriesContext returns all the entries matching filter, fetching them a
+// page at a time.
+func (c *Client) GetEntriesContext(ctx context.Context, filter *pkg.GetEntriesFilter) ([]*pkg.LogEntry, error) {
+	return pkg.CollectPages(ctx, filter, c.GetEntriesPage)
+}
+
+// GetEntriesPage returns a page of the entries matching filter, see pkg.LogWriter.GetEntriesPage.
+func (c *Client) GetEntriesPage(ctx context.Context, filter *pkg.GetEntriesFilter) (*pkg.EntriesPage, error) {
+	f, err := FilterToProto(filter)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.client.QueryEntries(ctx, &plungerpb.QueryEntriesRequest{Filter: f})
+	if err != nil {
+		return nil, err
+	}
+
+	page := &pkg.EntriesPage{
+		Entries:    []*pkg.LogEntry{},
+		NextCursor: res.NextCursor,
+	}
+	for _, entry := range res.Entries {
+		page.Entries = append(page.Entries, EntryFromProto(entry))
+	}
+	return page, nil
+}
+
+func (c *Client) GetEntriesPageContext(ctx context.Context, filter *pkg.GetEntriesFilter) (*pkg.EntriesPage, error) {
+	return c.GetEntriesPage(ctx, filter)
+}
+
+// Follow streams the entries matching filter as they get written, see
+// pkg.LogWriter.Follow. The channel is closed once ctx is done or the stream
+// fails.
+func (c *Client) Follow(ctx context.Context, filter *pkg.GetEntriesFilter) (<-chan *pkg.LogEntry, error) {
+	f, err := FilterToProto(filter)
+	if err != nil {
+		return nil, err
+	}
+	stream, err := c.client.TailEntries(ctx, &plungerpb.TailEntriesRequest{Filter: f})
+	if err != nil {
+		return nil, err
+	}
+	// wait for the server to follow the database, so that the entries
+	// written once Follow returns are received, as with pkg.LogWriter.Follow
+	if _, err := stream.Header(); err != nil {
+		return nil, err
+	}
+
+	ch := make(chan *pkg.LogEntry)
+	go func() {
+		defer close(ch)
+		for {
+			entry, err := stream.Recv()
+			if err != nil {
+				return
+			}
+			select {
+			case ch <- EntryFromProto(entry):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,224 @@
+package rpc
+
+import (
+	"encoding/base64"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/rpc/plungerpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"time"
+)
+
+// Meta values are transported as google.protobuf.Struct, which only knows
+// JSON types: integers come back as float64, blobs as base64 strings,
+// durations as nanoseconds and times as RFC3339 strings.
+
+func toStructValue(v interface{}) (*structpb.Value, error) {
+	switch v_ := v.(type) {
+	case []byte:
+		v = base64.StdEncoding.EncodeToString(v_)
+	case time.Duration:
+		v = int64(v_)
+	case time.Time:
+		v = v_.Format(time.RFC3339Nano)
+	}
+	return structpb.NewValue(v)
+}
+
+// toOptionalStructValue is toStructValue, leaving nil values unset.
+func toOptionalStructValue(v interface{}) (*structpb.Value, error) {
+	if v == nil {
+		return nil, nil
+	}
+	return toStructValue(v)
+}
+
+func fromOptionalStructValue(v *structpb.Value) interface{} {
+	if v == nil {
+		return nil
+	}
+	return v.AsInterface()
+}
+
+func EntryToProto(entry *pkg.LogEntry) (*plungerpb.LogEntry, error) {
+	ret := &plungerpb.LogEntry{
+		Id:         int64(entry.ID),
+		Date:       timestamppb.New(entry.Date),
+		Level:      entry.Level,
+		Session:    entry.Session,
+		Message:    entry.Message,
+		CallerFile: entry.CallerFile,
+		Error:      entry.Error,
+		ErrorChain: entry.ErrorChain,
+		TraceId:    entry.TraceID,
+		SpanId:     entry.SpanID,
+		Context:    entry.Context,
+		Group:      entry.Group,
+	}
+	if entry.CallerLine != nil {
+		line := int32(*entry.CallerLine)
+		ret.CallerLine = &line
+	}
+	if len(entry.Meta) > 0 {
+		ret.Meta = &structpb.Struct{Fields: map[string]*structpb.Value{}}
+		for k, v := range entry.Meta {
+			value, err := toStructValue(v)
+			if err != nil {
+				return nil, err
+			}
+			ret.Meta.Fields[k] = value
+		}
+	}
+	return ret, nil
+}
+
+func EntryFromProto(entry *plungerpb.LogEntry) *pkg.LogEntry {
+	ret := &pkg.LogEntry{
+		ID:         int(entry.Id),
+		Date:       entry.Date.AsTime(),
+		Level:      entry.Level,
+		Session:    entry.Session,
+		Message:    entry.Message,
+		CallerFile: entry.CallerFile,
+		Error:      entry.Error,
+		ErrorChain: entry.ErrorChain,
+		TraceID:    entry.TraceId,
+		SpanID:     entry.SpanId,
+		Context:    entry.Context,
+		Group:      entry.Group,
+	}
+	if entry.CallerLine != nil {
+		line := int(*entry.CallerLine)
+		ret.CallerLine = &line
+	}
+	if entry.Meta != nil {
+		ret.Meta = entry.Meta.AsMap()
+	}
+	return ret
+}
+
+func FilterToProto(filter *pkg.GetEntriesFilter) (*plungerpb.Filter, error) {
+	if filter == nil {
+		return &plungerpb.Filter{}, nil
+	}
+
+	ret := &plungerpb.Filter{
+		AfterId:          int64(filter.AfterID),
+		Levels:           filter.Levels,
+		MinLevel:         filter.MinLevel,
+		Session:          filter.Session,
+		SelectedMetaKeys: filter.SelectedMetaKeys,
+		Search:           filter.Search,
+		Limit:            int32(filter.Limit),
+		Offset:           int32(filter.Offset),
+		Cursor:           filter.Cursor,
+		Query:            filter.Query,
+		SessionTree:      filter.SessionTree,
+		Caller:           filter.Caller,
+		ErrorContains:    filter.ErrorContains,
+		TraceId:          filter.TraceID,
+		Stream:           filter.Stream,
+		Group:            filter.Group,
+		Last:             int32(filter.Last),
+		ContextBefore:    int32(filter.ContextBefore),
+		ContextAfter:     int32(filter.ContextAfter),
+	}
+	if filter.Level != "" {
+		ret.Levels = append([]string{filter.Level}, ret.Levels...)
+	}
+	if !filter.From.IsZero() {
+		ret.From = timestamppb.New(filter.From)
+	}
+	if !filter.To.IsZero() {
+		ret.To = timestamppb.New(filter.To)
+	}
+	if len(filter.MetaFilters) > 0 {
+		ret.MetaFilters = map[string]*structpb.Value{}
+		for k, v := range filter.MetaFilters {
+			value, err := toStructValue(v)
+			if err != nil {
+				return nil, err
+			}
+			ret.MetaFilters[k] = value
+		}
+	}
+	for _, r := range filter.MetaRanges {
+		from, err := toOptionalStructValue(r.From)
+		if err != nil {
+			return nil, err
+		}
+		to, err := toOptionalStructValue(r.To)
+		if err != nil {
+			return nil, err
+		}
+		ret.MetaRanges = append(ret.MetaRanges, &plungerpb.MetaRange{Key: r.Key, From: from, To: to})
+	}
+	for _, f := range filter.JSONPaths {
+		value, err := toStructValue(f.Value)
+		if err != nil {
+			return nil, err
+		}
+		ret.JsonPaths = append(ret.JsonPaths, &plungerpb.JSONPathFilter{Key: f.Key, Path: f.Path, Value: value})
+	}
+	for _, o := range filter.OrderBy {
+		ret.OrderBy = append(ret.OrderBy, &plungerpb.OrderBy{Key: o.Key, Direction: string(o.Direction)})
+	}
+	return ret, nil
+}
+
+func FilterFromProto(filter *plungerpb.Filter) *pkg.GetEntriesFilter {
+	ret := pkg.NewGetEntriesFilter()
+	if filter == nil {
+		return ret
+	}
+
+	ret.AfterID = int(filter.AfterId)
+	ret.Levels = filter.Levels
+	ret.MinLevel = filter.MinLevel
+	ret.Session = filter.Session
+	ret.SelectedMetaKeys = filter.SelectedMetaKeys
+	ret.Search = filter.Search
+	ret.Limit = int(filter.Limit)
+	ret.Offset = int(filter.Offset)
+	ret.Cursor = filter.Cursor
+	ret.Query = filter.Query
+	ret.SessionTree = filter.SessionTree
+	ret.Caller = filter.Caller
+	ret.ErrorContains = filter.ErrorContains
+	ret.TraceID = filter.TraceId
+	ret.Stream = filter.Stream
+	ret.Group = filter.Group
+	ret.Last = int(filter.Last)
+	ret.ContextBefore = int(filter.ContextBefore)
+	ret.ContextAfter = int(filter.ContextAfter)
+	if filter.From != nil {
+		ret.From = filter.From.AsTime()
+	}
+	if filter.To != nil {
+		ret.To = filter.To.AsTime()
+	}
+	if len(filter.MetaFilters) > 0 {
+		ret.MetaFilters = map[string]interface{}{}
+		for k, v := range filter.MetaFilters {
+			ret.MetaFilters[k] = v.AsInterface()
+		}
+	}
+	for _, r := range filter.MetaRanges {
+		ret.MetaRanges = append(ret.MetaRanges, pkg.MetaRange{
+			Key:  r.Key,
+			From: fromOptionalStructValue(r.From),
+			To:   fromOptionalStructValue(r.To),
+		})
+	}
+	for _, f := range filter.JsonPaths {
+		ret.JSONPaths = append(ret.JSONPaths, pkg.JSONPathFilter{
+			Key:   f.Key,
+			Path:  f.Path,
+			Value: fromOptionalStructValue(f.Value),
+		})
+	}
+	for _, o := range filter.OrderBy {
+		ret.OrderBy = append(ret.OrderBy, pkg.OrderBy{Key: o.Key, Direction: pkg.SortDirection(o.Direction)})
+	}
+	return ret
+}
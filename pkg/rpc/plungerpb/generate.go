@@ -0,0 +1,4 @@
+// Package plungerpb contains the protobuf definitions of the plunger gRPC API.
+package plungerpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative plunger.proto
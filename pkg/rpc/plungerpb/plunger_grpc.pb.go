@@ -0,0 +1,256 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: plunger.proto
+
+package plungerpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	LogService_WriteEntry_FullMethodName   = "/plunger.v1.LogService/WriteEntry"
+	LogService_WriteBatch_FullMethodName   = "/plunger.v1.LogService/WriteBatch"
+	LogService_QueryEntries_FullMethodName = "/plunger.v1.LogService/QueryEntries"
+	LogService_TailEntries_FullMethodName  = "/plunger.v1.LogService/TailEntries"
+)
+
+// LogServiceClient is the client API for LogService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type LogServiceClient interface {
+	// WriteEntry stores a single log line, as zerolog would hand it to the LogWriter.
+	WriteEntry(ctx context.Context, in *WriteEntryRequest, opts ...grpc.CallOption) (*WriteEntryResponse, error)
+	// WriteBatch stores several log lines in a single transaction.
+	WriteBatch(ctx context.Context, in *WriteBatchRequest, opts ...grpc.CallOption) (*WriteBatchResponse, error)
+	// QueryEntries returns a page of the entries matching the filter.
+	QueryEntries(ctx context.Context, in *QueryEntriesRequest, opts ...grpc.CallOption) (*QueryEntriesResponse, error)
+	// TailEntries streams matching entries as they get written.
+	TailEntries(ctx context.Context, in *TailEntriesRequest, opts ...grpc.CallOption) (LogService_TailEntriesClient, error)
+}
+
+type logServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewLogServiceClient(cc grpc.ClientConnInterface) LogServiceClient {
+	return &logServiceClient{cc}
+}
+
+func (c *logServiceClient) WriteEntry(ctx context.Context, in *WriteEntryRequest, opts ...grpc.CallOption) (*WriteEntryResponse, error) {
+	out := new(WriteEntryResponse)
+	err := c.cc.Invoke(ctx, LogService_WriteEntry_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logServiceClient) WriteBatch(ctx context.Context, in *WriteBatchRequest, opts ...grpc.CallOption) (*WriteBatchResponse, error) {
+	out := new(WriteBatchResponse)
+	err := c.cc.Invoke(ctx, LogService_WriteBatch_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logServiceClient) QueryEntries(ctx context.Context, in *QueryEntriesRequest, opts ...grpc.CallOption) (*QueryEntriesResponse, error) {
+	out := new(QueryEntriesResponse)
+	err := c.cc.Invoke(ctx, LogService_QueryEntries_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *logServiceClient) TailEntries(ctx context.Context, in *TailEntriesRequest, opts ...grpc.CallOption) (LogService_TailEntriesClient, error) {
+	stream, err := c.cc.NewStream(ctx, &LogService_ServiceDesc.Streams[0], LogService_TailEntries_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &logServiceTailEntriesClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type LogService_TailEntriesClient interface {
+	Recv() (*LogEntry, error)
+	grpc.ClientStream
+}
+
+type logServiceTailEntriesClient struct {
+	grpc.ClientStream
+}
+
+func (x *logServiceTailEntriesClient) Recv() (*LogEntry, error) {
+	m := new(LogEntry)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LogServiceServer is the server API for LogService service.
+// All implementations must embed UnimplementedLogServiceServer
+// for forward compatibility
+type LogServiceServer interface {
+	// WriteEntry stores a single log line, as zerolog would hand it to the LogWriter.
+	WriteEntry(context.Context, *WriteEntryRequest) (*WriteEntryResponse, error)
+	// WriteBatch stores several log lines in a single transaction.
+	WriteBatch(context.Context, *WriteBatchRequest) (*WriteBatchResponse, error)
+	// QueryEntries returns a page of the entries matching the filter.
+	QueryEntries(context.Context, *QueryEntriesRequest) (*QueryEntriesResponse, error)
+	// TailEntries streams matching entries as they get written.
+	TailEntries(*TailEntriesRequest, LogService_TailEntriesServer) error
+	mustEmbedUnimplementedLogServiceServer()
+}
+
+// UnimplementedLogServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedLogServiceServer struct {
+}
+
+func (UnimplementedLogServiceServer) WriteEntry(context.Context, *WriteEntryRequest) (*WriteEntryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteEntry not implemented")
+}
+func (UnimplementedLogServiceServer) WriteBatch(context.Context, *WriteBatchRequest) (*WriteBatchResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method WriteBatch not implemented")
+}
+func (UnimplementedLogServiceServer) QueryEntries(context.Context, *QueryEntriesRequest) (*QueryEntriesResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method QueryEntries not implemented")
+}
+func (UnimplementedLogServiceServer) TailEntries(*TailEntriesRequest, LogService_TailEntriesServer) error {
+	return status.Errorf(codes.Unimplemented, "method TailEntries not implemented")
+}
+func (UnimplementedLogServiceServer) mustEmbedUnimplementedLogServiceServer() {}
+
+// UnsafeLogServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to LogServiceServer will
+// result in compilation errors.
+type UnsafeLogServiceServer interface {
+	mustEmbedUnimplementedLogServiceServer()
+}
+
+func RegisterLogServiceServer(s grpc.ServiceRegistrar, srv LogServiceServer) {
+	s.RegisterService(&LogService_ServiceDesc, srv)
+}
+
+func _LogService_WriteEntry_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteEntryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServiceServer).WriteEntry(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogService_WriteEntry_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServiceServer).WriteEntry(ctx, req.(*WriteEntryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogService_WriteBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(WriteBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServiceServer).WriteBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogService_WriteBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServiceServer).WriteBatch(ctx, req.(*WriteBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogService_QueryEntries_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryEntriesRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(LogServiceServer).QueryEntries(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: LogService_QueryEntries_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(LogServiceServer).QueryEntries(ctx, req.(*QueryEntriesRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _LogService_TailEntries_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TailEntriesRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(LogServiceServer).TailEntries(m, &logServiceTailEntriesServer{stream})
+}
+
+type LogService_TailEntriesServer interface {
+	Send(*LogEntry) error
+	grpc.ServerStream
+}
+
+type logServiceTailEntriesServer struct {
+	grpc.ServerStream
+}
+
+func (x *logServiceTailEntriesServer) Send(m *LogEntry) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+// LogService_ServiceDesc is the grpc.ServiceDesc for LogService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var LogService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "plunger.v1.LogService",
+	HandlerType: (*LogServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "WriteEntry",
+			Handler:    _LogService_WriteEntry_Handler,
+		},
+		{
+			MethodName: "WriteBatch",
+			Handler:    _LogService_WriteBatch_Handler,
+		},
+		{
+			MethodName: "QueryEntries",
+			Handler:    _LogService_QueryEntries_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "TailEntries",
+			Handler:       _LogService_TailEntries_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "plunger.proto",
+}
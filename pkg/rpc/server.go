@@ -0,0 +1,107 @@
+// Package rpc exposes a plunger database over gRPC, see plungerpb/plunger.proto.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/rpc/plungerpb"
+	"github.com/pkg/errors"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements plungerpb.LogServiceServer on top of a LogWriter.
+//
+// Written lines go through the parser and middlewares of the LogWriter, just
+// like lines written locally.
+type Server struct {
+	plungerpb.UnimplementedLogServiceServer
+	logWriter *pkg.LogWriter
+}
+
+func NewServer(logWriter *pkg.LogWriter) *Server {
+	return &Server{logWriter: logWriter}
+}
+
+func (s *Server) WriteEntry(ctx context.Context, req *plungerpb.WriteEntryRequest) (*plungerpb.WriteEntryResponse, error) {
+	if _, err := s.logWriter.WriteContext(ctx, req.Line); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &plungerpb.WriteEntryResponse{}, nil
+}
+
+func (s *Server) WriteBatch(ctx context.Context, req *plungerpb.WriteBatchRequest) (*plungerpb.WriteBatchResponse, error) {
+	if len(req.Lines) == 0 {
+		return &plungerpb.WriteBatchResponse{}, nil
+	}
+
+	// a single batch, so that the lines are written in one transaction
+	res, err := s.logWriter.ImportContext(ctx,
+		bytes.NewReader(bytes.Join(req.Lines, []byte("\n"))),
+		pkg.WithImportBatchSize(len(req.Lines)))
+	if err != nil {
+		var lineErr *pkg.ImportLineError
+		if errors.As(err, &lineErr) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &plungerpb.WriteBatchResponse{Written: int64(res.Imported)}, nil
+}
+
+func (s *Server) QueryEntries(ctx context.Context, req *plungerpb.QueryEntriesRequest) (*plungerpb.QueryEntriesResponse, error) {
+	filter := FilterFromProto(req.Filter)
+	if err := filter.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if filter.Cursor != "" {
+		if _, err := pkg.DecodeCursor(filter.Cursor); err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+
+	page, err := s.logWriter.GetEntriesPageContext(ctx, filter)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	ret := &plungerpb.QueryEntriesResponse{NextCursor: page.NextCursor}
+	for _, entry := range page.Entries {
+		e, err := EntryToProto(entry)
+		if err != nil {
+			return nil, status.Error(codes.Internal, err.Error())
+		}
+		ret.Entries = append(ret.Entries, e)
+	}
+	return ret, nil
+}
+
+func (s *Server) TailEntries(req *plungerpb.TailEntriesRequest, stream plungerpb.LogService_TailEntriesServer) error {
+	entries, err := s.logWriter.Follow(stream.Context(), FilterFromProto(req.Filter))
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	// the headers tell the client that the entries written from now on are followed
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for entry := range entries {
+		e, err := EntryToProto(entry)
+		if err != nil {
+			return status.Error(codes.Internal, err.Error())
+		}
+		if err := stream.Send(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RegisterServer registers s as LogService on server.
+func RegisterServer(server *grpc.Server, s *Server) {
+	plungerpb.RegisterLogServiceServer(server, s)
+}
@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"context"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestClient(t *testing.T) (*pkg.LogWriter, *Client) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	lw := pkg.NewLogWriter(db, pkg.NewSchema(),
+		pkg.WithFollowInterval(10*time.Millisecond), pkg.WithGroupKey("request_id"))
+	require.NoError(t, lw.Init())
+
+	listener := bufconn.Listen(1024 * 1024)
+	server := grpc.NewServer()
+	RegisterServer(server, NewServer(lw))
+	go func() {
+		_ = server.Serve(listener)
+	}()
+	t.Cleanup(server.Stop)
+
+	client, err := Dial("bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}))
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = client.Close()
+	})
+
+	return lw, client
+}
+
+func TestClientWriteAndQuery(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	logger := zerolog.New(client)
+	logger.Info().Str("user", "alice").Int("n", 1).Msg("first")
+
+	n, err := client.WriteBatch(ctx, [][]byte{
+		[]byte(`{"level": "error", "message": "second", "user": "bob"}`),
+		[]byte(`{"level": "debug", "message": "third"}`),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	page, err := client.GetEntriesPage(ctx, pkg.NewGetEntriesFilter(pkg.WithLimit(2)))
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 2)
+	assert.Equal(t, "first", *page.Entries[0].Message)
+	assert.Equal(t, map[string]interface{}{"user": "alice", "n": 1.0}, page.Entries[0].Meta)
+	assert.NotEmpty(t, page.NextCursor)
+
+	page, err = client.GetEntriesPage(ctx, pkg.NewGetEntriesFilter(
+		pkg.WithMetaFilters(map[string]interface{}{"user": "bob"}),
+	))
+	require.NoError(t, err)
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, "error", page.Entries[0].Level)
+
+	_, err = client.WriteBatch(ctx, [][]byte{[]byte(`not json`)})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetEntriesPage(ctx, pkg.NewGetEntriesFilter(pkg.WithCursor("bogus")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+	_, err = client.GetEntriesPage(ctx, pkg.NewGetEntriesFilter(pkg.WithOrderBy("date", "sideways")))
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+}
+
+func TestClientFollow(t *testing.T) {
+	lw, client := newTestClient(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err := lw.Write([]byte(`{"level": "info", "message": "before"}`))
+	require.NoError(t, err)
+
+	entries, err := client.Follow(ctx, pkg.NewGetEntriesFilter(pkg.WithAfterID(1), pkg.WithLevel("error")))
+	require.NoError(t, err)
+
+	_, err = client.Write([]byte(`{"level": "info", "message": "skipped"}`))
+	require.NoError(t, err)
+	_, err = client.Write([]byte(`{"level": "error", "message": "tailed"}`))
+	require.NoError(t, err)
+
+	select {
+	case entry := <-entries:
+		require.NotNil(t, entry)
+		assert.Equal(t, "tailed", *entry.Message)
+	case <-ctx.Done():
+		t.Fatal("timed out waiting for entry")
+	}
+}
+
+func TestClientFilters(t *testing.T) {
+	_, client := newTestClient(t)
+	ctx := context.Background()
+
+	_, err := client.WriteBatch(ctx, [][]byte{
+		[]byte(`{"level": "info", "message": "first", "user": "alice"}`),
+		[]byte(`{"level": "error", "message": "second", "caller": "/src/api/handler.go:42", "error": "connection refused",` +
+			` "trace_id": "t1", "span_id": "s1", "payload": {"user": {"id": 42}}, "request_id": "r1"}`),
+		[]byte(`{"level": "error", "message": "third", "error": "timeout", "trace_id": "t2", "stream": "stderr"}`),
+	})
+	require.NoError(t, err)
+
+	for _, filter := range []*pkg.GetEntriesFilter{
+		pkg.NewGetEntriesFilter(pkg.WithQueryString(`level=error AND message="second"`)),
+		pkg.NewGetEntriesFilter(pkg.WithCaller("api/handler.go")),
+		pkg.NewGetEntriesFilter(pkg.WithErrorContains("refused")),
+		pkg.NewGetEntriesFilter(pkg.WithTraceID("t1")),
+		pkg.NewGetEntriesFilter(pkg.WithJSONPath("payload", "$.user.id", 42)),
+		pkg.NewGetEntriesFilter(pkg.WithGroup("r1")),
+	} {
+		entries, err := client.GetEntries(filter)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		entry := entries[0]
+		assert.Equal(t, "second", *entry.Message)
+		require.NotNil(t, entry.CallerFile)
+		assert.Equal(t, "/src/api/handler.go", *entry.CallerFile)
+		require.NotNil(t, entry.CallerLine)
+		assert.Equal(t, 42, *entry.CallerLine)
+		require.NotNil(t, entry.Error)
+		assert.Equal(t, "connection refused", *entry.Error)
+		require.NotNil(t, entry.TraceID)
+		assert.Equal(t, "t1", *entry.TraceID)
+		require.NotNil(t, entry.SpanID)
+		assert.Equal(t, "s1", *entry.SpanID)
+		require.NotNil(t, entry.Group)
+		assert.Equal(t, "r1", *entry.Group)
+	}
+
+	entries, err := client.GetEntries(pkg.NewGetEntriesFilter(pkg.WithOrderBy("message", pkg.Desc)))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "third", *entries[0].Message)
+	entries, err = client.GetEntries(pkg.NewGetEntriesFilter(pkg.WithLast(1)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "third", *entries[0].Message)
+
+	entries, err = client.GetEntries(pkg.NewGetEntriesFilter(pkg.WithStream(pkg.StreamStderr)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "third", *entries[0].Message)
+	assert.Equal(t, pkg.StreamStderr, entries[0].Meta[pkg.StreamKey])
+
+	entries, err = client.GetEntries(pkg.NewGetEntriesFilter(pkg.WithTraceID("t1"), pkg.WithContext(1, 0)))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "first", *entries[0].Message)
+	assert.True(t, entries[0].Context)
+	assert.False(t, entries[1].Context)
+}
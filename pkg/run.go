@@ -0,0 +1,174 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"github.com/pkg/errors"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Keys of the metadata recorded by Run on the session of the command.
+const (
+	RunCommandKey = "command"
+	RunDirKey     = "dir"
+)
+
+// RunResult sums up a command run by Run.
+type RunResult struct {
+	// Session is the id of the session the output was stored in.
+	Session string `json:"session"`
+	// ExitCode is the exit code of the command, -1 if it was killed by a
+	// signal.
+	ExitCode int `json:"exit_code"`
+	// Lines is the number of non-empty lines the command wrote.
+	Lines int `json:"lines"`
+}
+
+type runOptions struct {
+	parser  LineParser
+	session string
+	stdout  io.Writer
+	stderr  io.Writer
+}
+
+type RunOption func(*runOptions)
+
+// WithRunParser sets the parser of the output lines, JSONLineParser by
+// default. Lines that can't be parsed are stored as messages.
+func WithRunParser(parser LineParser) RunOption {
+	return func(o *runOptions) {
+		o.parser = parser
+	}
+}
+
+// WithRunSession stores the output in the session id, created if it doesn't
+// exist, instead of a new session named after the command.
+func WithRunSession(id string) RunOption {
+	return func(o *runOptions) {
+		o.session = id
+	}
+}
+
+// WithRunStdout copies the stdout of the command to w.
+func WithRunStdout(w io.Writer) RunOption {
+	return func(o *runOptions) {
+		o.stdout = w
+	}
+}
+
+// WithRunStderr copies the stderr of the command to w.
+func WithRunStderr(w io.Writer) RunOption {
+	return func(o *runOptions) {
+		o.stderr = w
+	}
+}
+
+// Run runs cmd, which must not have been started and must not have its
+// Stdout and Stderr set, and stores each line it writes as it is written,
+// with the stream it was written to under StreamKey. Lines that can't be
+// parsed are stored as messages with level info.
+//
+// The output is stored in a new session, named after the command line, which
+// records the command line and working directory. The session is ended with
+// the exit code of the command once it is done. A command exiting with a
+// non-zero code isn't an error, see RunResult.ExitCode.
+func (l *LogWriter) Run(ctx context.Context, cmd *exec.Cmd, opts ...RunOption) (*RunResult, error) {
+	o := &runOptions{
+		parser: JSONLineParser,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	dir := cmd.Dir
+	if dir == "" {
+		dir, _ = os.Getwd()
+	}
+	commandLine := strings.Join(cmd.Args, " ")
+	metadata := map[string]interface{}{
+		RunCommandKey: commandLine,
+		RunDirKey:     dir,
+	}
+	sm := l.Sessions()
+	res := &RunResult{Session: o.session}
+	if o.session == "" {
+		session, err := sm.NewSession(commandLine, metadata)
+		if err != nil {
+			return nil, err
+		}
+		res.Session = session.ID
+	} else {
+		if err := sm.ensureSession(&Session{ID: o.session, CreatedAt: time.Now().UTC()}); err != nil {
+			return nil, err
+		}
+		if err := sm.SetMetadata(o.session, metadata); err != nil {
+			return nil, err
+		}
+		if err := sm.StartSession(o.session); err != nil {
+			return nil, err
+		}
+	}
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, errors.Wrapf(err, "could not run %s", commandLine)
+	}
+
+	i := l.lineImporter()
+	mu := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	capture := func(stream string, r io.Reader, tee io.Writer) {
+		defer wg.Done()
+		extra := map[string]interface{}{
+			"session": res.Session,
+			StreamKey: stream,
+		}
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Bytes()
+			if tee != nil {
+				_, _ = fmt.Fprintf(tee, "%s\n", line)
+			}
+			if strings.TrimSpace(string(line)) == "" {
+				continue
+			}
+			l.storeLine(ctx, o.parser, i, line, extra)
+			mu.Lock()
+			res.Lines++
+			mu.Unlock()
+		}
+		// keep draining the output so that the command doesn't block
+		_, _ = io.Copy(io.Discard, r)
+	}
+	wg.Add(2)
+	go capture(StreamStdout, stdout, o.stdout)
+	go capture(StreamStderr, stderr, o.stderr)
+	// the pipes are closed by Wait, which has to wait for the output to be read
+	wg.Wait()
+
+	err = cmd.Wait()
+	var exitErr *exec.ExitError
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+		res.ExitCode = exitErr.ExitCode()
+	default:
+		return res, err
+	}
+
+	return res, sm.EndSession(res.Session, WithExitCode(res.ExitCode))
+}
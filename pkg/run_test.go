@@ -0,0 +1,57 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestLogWriterRun(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("no sh")
+	}
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	stdout := &bytes.Buffer{}
+	cmd := exec.Command("sh", "-c", `echo '{"level": "warn", "message": "slow"}'; echo failed >&2; exit 3`)
+	res, err := lw.Run(context.Background(), cmd, WithRunStdout(stdout))
+	require.NoError(t, err)
+	assert.Equal(t, 3, res.ExitCode)
+	assert.Equal(t, 2, res.Lines)
+	assert.Equal(t, "{\"level\": \"warn\", \"message\": \"slow\"}\n", stdout.String())
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithSession(res.Session), WithOrderBy("id", Asc)))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	byStream := map[interface{}]*LogEntry{}
+	for _, entry := range entries {
+		byStream[entry.Meta[StreamKey]] = entry
+	}
+	assert.Equal(t, "warn", byStream["stdout"].Level)
+	assert.Equal(t, "failed", *byStream["stderr"].Message)
+
+	session, err := lw.Sessions().GetSession(res.Session)
+	require.NoError(t, err)
+	assert.Equal(t, "sh -c "+cmd.Args[2], session.Name)
+	assert.Equal(t, session.Name, session.Metadata[RunCommandKey])
+	require.NotNil(t, session.ExitCode)
+	assert.Equal(t, 3, *session.ExitCode)
+	assert.True(t, session.Failed())
+	assert.True(t, !session.EndedAt.Before(*session.StartedAt))
+
+	res, err = lw.Run(context.Background(), exec.Command("sh", "-c", "true"), WithRunSession("ci"))
+	require.NoError(t, err)
+	assert.Equal(t, "ci", res.Session)
+	assert.Equal(t, 0, res.ExitCode)
+	session, err = lw.Sessions().GetSession("ci")
+	require.NoError(t, err)
+	assert.False(t, session.Failed())
+}
@@ -0,0 +1,224 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/rs/zerolog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SampledDroppedKey is the field recording, on an entry kept by a Sampler,
+// how many entries with the same level and message were dropped since the
+// previous kept one. It is stored in the sampled_dropped column of
+// log_entries rather than as a meta value, and Aggregate's Total adds it back
+// to the counts.
+const SampledDroppedKey = "sampled_dropped"
+
+// maxSampleKeys bounds the number of (level, message) pairs a Sampler keeps
+// track of. The tracked pairs are forgotten once it is reached, losing their
+// pending drop counts.
+const maxSampleKeys = 10000
+
+// SampleRule describes which entries a Sampler drops. Entries are sampled per
+// level and message, so that a noisy message doesn't crowd out the others.
+type SampleRule struct {
+	// Level restricts the rule to entries of this level (case-insensitive).
+	Level string
+	// Every keeps one in Every entries, starting with the first one.
+	Every int
+	// PerSecond keeps at most PerSecond entries per second.
+	PerSecond float64
+}
+
+func (r SampleRule) matches(level string) bool {
+	return r.Level == "" || strings.EqualFold(r.Level, level)
+}
+
+type sampleKey struct {
+	rule    int
+	level   string
+	message string
+}
+
+type sampleState struct {
+	seen    int
+	dropped int
+	// tokens is the number of entries that can be kept right now, refilled
+	// at PerSecond entries per second.
+	tokens   float64
+	lastSeen time.Time
+}
+
+// Sampler drops entries matching its rules before they get persisted. Each
+// entry is sampled by the first rule matching its level, entries matching no
+// rule are always kept.
+type Sampler struct {
+	rules            []SampleRule
+	messageFieldName string
+	now              func() time.Time
+
+	mu     sync.Mutex
+	states map[sampleKey]*sampleState
+}
+
+type SampleOption func(*Sampler)
+
+func WithSampleRules(rules ...SampleRule) SampleOption {
+	return func(s *Sampler) {
+		s.rules = append(s.rules, rules...)
+	}
+}
+
+// WithSampleMessageFieldName sets the field holding the message, see WithMessageFieldName.
+func WithSampleMessageFieldName(name string) SampleOption {
+	return func(s *Sampler) {
+		s.messageFieldName = name
+	}
+}
+
+func NewSampler(opts ...SampleOption) *Sampler {
+	s := &Sampler{
+		messageFieldName: zerolog.MessageFieldName,
+		now:              time.Now,
+		states:           map[sampleKey]*sampleState{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// SampleMiddleware returns a Middleware sampling entries with a Sampler
+// configured by opts.
+func SampleMiddleware(opts ...SampleOption) Middleware {
+	return NewSampler(opts...).Middleware
+}
+
+func (s *Sampler) Middleware(next EntryHandler) EntryHandler {
+	return func(entry map[string]interface{}) error {
+		keep, dropped := s.sample(entry)
+		if !keep {
+			return nil
+		}
+		if dropped > 0 {
+			entry[SampledDroppedKey] = float64(dropped)
+		}
+		return next(entry)
+	}
+}
+
+// sample decides whether entry is kept, and if so returns the number of
+// entries dropped before it.
+func (s *Sampler) sample(entry map[string]interface{}) (bool, int) {
+	level, _ := entry["level"].(string)
+	ruleIdx := -1
+	for i, rule := range s.rules {
+		if rule.matches(level) {
+			ruleIdx = i
+			break
+		}
+	}
+	if ruleIdx < 0 {
+		return true, 0
+	}
+	rule := s.rules[ruleIdx]
+	message, _ := entry[s.messageFieldName].(string)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key := sampleKey{rule: ruleIdx, level: level, message: message}
+	state, ok := s.states[key]
+	if !ok {
+		if len(s.states) >= maxSampleKeys {
+			s.states = map[sampleKey]*sampleState{}
+		}
+		state = &sampleState{tokens: burst(rule.PerSecond), lastSeen: now}
+		s.states[key] = state
+	}
+
+	keep := true
+	if rule.Every > 1 && state.seen%rule.Every != 0 {
+		keep = false
+	}
+	state.seen++
+
+	if rule.PerSecond > 0 {
+		state.tokens += now.Sub(state.lastSeen).Seconds() * rule.PerSecond
+		if state.tokens > burst(rule.PerSecond) {
+			state.tokens = burst(rule.PerSecond)
+		}
+		state.lastSeen = now
+		if keep {
+			if state.tokens < 1 {
+				keep = false
+			} else {
+				state.tokens--
+			}
+		}
+	}
+
+	if !keep {
+		state.dropped++
+		return false, 0
+	}
+	dropped := state.dropped
+	state.dropped = 0
+	return true, dropped
+}
+
+// burst is the number of entries that can be kept at once at perSecond
+// entries per second.
+func burst(perSecond float64) float64 {
+	if perSecond < 1 {
+		return 1
+	}
+	return perSecond
+}
+
+// parseSampledDropped returns the SampledDroppedKey field of log, which isn't
+// stored as meta value then.
+func parseSampledDropped(log map[string]interface{}, skippedKeys map[string]bool) sql.NullInt64 {
+	n, ok := numericValue(log[SampledDroppedKey])
+	if !ok {
+		return sql.NullInt64{}
+	}
+	skippedKeys[SampledDroppedKey] = true
+	return sql.NullInt64{Int64: int64(n), Valid: true}
+}
+
+func (e *LogEntry) sampledDropped() sql.NullInt64 {
+	if e.SampledDropped == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: *e.SampledDropped, Valid: true}
+}
+
+// addSampledDroppedColumn adds the sampled_dropped column, and moves the
+// counts stored as meta values before it existed into it.
+func (l *LogWriter) addSampledDroppedColumn(ctx context.Context) error {
+	if err := l.ensureColumn(ctx, "log_entries", "sampled_dropped", "INTEGER"); err != nil {
+		return err
+	}
+
+	condition := metaKeyExpression(l.schema.MetaKeys, "lem.", SampledDroppedKey)
+	value := sqlbuilder.Select("CAST(COALESCE(lem.int_value, lem.real_value) AS INTEGER)").
+		From("log_entries_meta lem")
+	value.Where("lem.log_entry_id = log_entries.id", condition).Limit(1)
+	ids := sqlbuilder.Select("lem.log_entry_id").From("log_entries_meta lem")
+	ids.Where(condition)
+	ub := sqlbuilder.Update("log_entries")
+	ub.Set(ub.Assign("sampled_dropped", sqlbuilder.Raw("("+value.String()+")"))).
+		Where(ub.In("id", ids))
+	if err := l.exec(ctx, ub); err != nil {
+		return err
+	}
+
+	db := sqlbuilder.DeleteFrom("log_entries_meta")
+	db.Where(metaKeyExpression(l.schema.MetaKeys, "", SampledDroppedKey))
+	return l.exec(ctx, db)
+}
@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestSamplerEvery(t *testing.T) {
+	s := NewSampler(WithSampleRules(SampleRule{Level: "debug", Every: 3}))
+
+	kept := []int{}
+	for i := 1; i <= 7; i++ {
+		entry := map[string]interface{}{"level": "debug", "message": "tick", "i": i}
+		if keep, dropped := s.sample(entry); keep {
+			kept = append(kept, i)
+			if i > 1 {
+				assert.Equal(t, 2, dropped)
+			}
+		}
+	}
+	assert.Equal(t, []int{1, 4, 7}, kept)
+
+	// other messages and levels are sampled separately
+	keep, _ := s.sample(map[string]interface{}{"level": "debug", "message": "tock"})
+	assert.True(t, keep)
+	for i := 0; i < 5; i++ {
+		keep, _ = s.sample(map[string]interface{}{"level": "info", "message": "tick"})
+		assert.True(t, keep)
+	}
+}
+
+func TestSamplerPerSecond(t *testing.T) {
+	now := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	s := NewSampler(WithSampleRules(SampleRule{PerSecond: 2}))
+	s.now = func() time.Time { return now }
+
+	keep := func() (bool, int) {
+		return s.sample(map[string]interface{}{"level": "info", "message": "request"})
+	}
+	for i := 0; i < 2; i++ {
+		ok, _ := keep()
+		assert.True(t, ok)
+	}
+	for i := 0; i < 3; i++ {
+		ok, _ := keep()
+		assert.False(t, ok)
+	}
+
+	now = now.Add(500 * time.Millisecond)
+	ok, dropped := keep()
+	assert.True(t, ok)
+	assert.Equal(t, 3, dropped)
+	ok, _ = keep()
+	assert.False(t, ok)
+}
+
+func TestLogWriterSampling(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	config := &LoggerConfig{SampleRules: []SampleRule{{Level: "debug", Every: 4}}}
+	lw := NewLogWriter(db, NewSchema(), config.logWriterOptions()...)
+	require.NoError(t, lw.Init())
+
+	for i := 0; i < 10; i++ {
+		_, err := lw.Write([]byte(`{"level": "debug", "message": "tick"}`))
+		require.NoError(t, err)
+	}
+	_, err := lw.Write([]byte(`{"level": "info", "message": "done"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithLevel("debug")))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	assert.Nil(t, entries[0].SampledDropped)
+	require.NotNil(t, entries[1].SampledDropped)
+	assert.Equal(t, int64(3), *entries[1].SampledDropped)
+	assert.NotContains(t, entries[1].Meta, SampledDroppedKey)
+
+	rows, err := lw.Aggregate(nil, GroupBy("level"), Count(), Total())
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "debug", rows[0].Group["level"])
+	assert.Equal(t, int64(3), rows[0].Count())
+	// the entry dropped after the last kept one isn't recorded yet
+	assert.Equal(t, int64(9), rows[0].Total())
+	assert.Equal(t, int64(1), rows[1].Total())
+}
+
+func TestAddSampledDroppedColumnBackfills(t *testing.T) {
+	lw := newImportLogWriter(t)
+	_, err := lw.Write([]byte(`{"level": "debug", "message": "tick", "sampled_dropped": 4}`))
+	require.NoError(t, err)
+	// counts were stored as meta values before the column existed
+	_, err = lw.db.Exec("UPDATE log_entries SET sampled_dropped = NULL")
+	require.NoError(t, err)
+	_, err = lw.db.Exec("INSERT INTO log_entries_meta (log_entry_id, type, name, real_value) VALUES (1, ?, ?, 4)",
+		LogEntryTypeReal, SampledDroppedKey)
+	require.NoError(t, err)
+
+	require.NoError(t, lw.addSampledDroppedColumn(context.Background()))
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.NotNil(t, entries[0].SampledDropped)
+	assert.Equal(t, int64(4), *entries[0].SampledDropped)
+	assert.NotContains(t, entries[0].Meta, SampledDroppedKey)
+}
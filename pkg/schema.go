@@ -0,0 +1,154 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"sort"
+	"strings"
+)
+
+// SchemaReconciliation decides what Init does when the meta keys configured
+// in the schema of a LogWriter conflict with the ones stored in the database.
+type SchemaReconciliation int
+
+const (
+	// SchemaReconcileFail makes Init return a SchemaMismatchError.
+	SchemaReconcileFail SchemaReconciliation = iota
+	// SchemaReconcileUseDatabase keeps the ids stored in the database, and
+	// assigns new ids to configured keys whose id is already taken.
+	SchemaReconcileUseDatabase
+)
+
+// WithSchemaReconciliation sets how schema mismatches are handled, see SchemaReconciliation.
+func WithSchemaReconciliation(mode SchemaReconciliation) LogWriterOption {
+	return func(l *LogWriter) {
+		l.schemaReconciliation = mode
+	}
+}
+
+// MetaKeyConflict describes a configured meta key that doesn't match the database.
+type MetaKeyConflict struct {
+	Key          string
+	ConfiguredID int
+	// DatabaseID is the id of Key in the database, -1 if Key isn't stored.
+	DatabaseID int
+	// DatabaseKey is the key stored with ConfiguredID, if it differs from Key.
+	DatabaseKey string
+}
+
+func (c MetaKeyConflict) String() string {
+	if c.DatabaseID >= 0 {
+		return fmt.Sprintf("key %s has id %d, but id %d in the database", c.Key, c.ConfiguredID, c.DatabaseID)
+	}
+	return fmt.Sprintf("key %s has id %d, which is used by key %s in the database", c.Key, c.ConfiguredID, c.DatabaseKey)
+}
+
+// SchemaMismatchError is returned by Init when the configured meta keys
+// conflict with the database. Use WithSchemaReconciliation to resolve it.
+type SchemaMismatchError struct {
+	Conflicts []MetaKeyConflict
+}
+
+func (e *SchemaMismatchError) Error() string {
+	conflicts := []string{}
+	for _, c := range e.Conflicts {
+		conflicts = append(conflicts, c.String())
+	}
+	return "schema mismatch: " + strings.Join(conflicts, ", ")
+}
+
+// metaKeyConflicts compares the configured meta keys to the ones stored in the database.
+func metaKeyConflicts(configured *MetaKeys, stored *MetaKeys) []MetaKeyConflict {
+	ret := []MetaKeyConflict{}
+	for _, key := range sortedMetaKeys(configured) {
+		if storedKey, ok := stored.Get(key.Name); ok {
+			if storedKey.ID != key.ID {
+				ret = append(ret, MetaKeyConflict{Key: key.Name, ConfiguredID: key.ID, DatabaseID: storedKey.ID})
+			}
+			continue
+		}
+		if storedKey, ok := stored.GetByID(key.ID); ok {
+			ret = append(ret, MetaKeyConflict{
+				Key:          key.Name,
+				ConfiguredID: key.ID,
+				DatabaseID:   -1,
+				DatabaseKey:  storedKey.Name,
+			})
+		}
+	}
+	return ret
+}
+
+// reconcileMetaKeys returns the stored keys, along with the configured keys
+// missing from the database, which keep their id if it is still free.
+func reconcileMetaKeys(configured *MetaKeys, stored *MetaKeys) (*MetaKeys, error) {
+	ret := NewMetaKeys()
+	for _, key := range sortedMetaKeys(stored) {
+		if _, err := ret.AddWithID(key.Name, key.ID); err != nil {
+			return nil, err
+		}
+	}
+	// first add the keys whose id is free, so that they don't get taken by
+	// keys needing a new id
+	moved := []*MetaKey{}
+	for _, key := range sortedMetaKeys(configured) {
+		if _, ok := ret.Get(key.Name); ok {
+			continue
+		}
+		if _, ok := ret.GetByID(key.ID); ok {
+			moved = append(moved, key)
+			continue
+		}
+		if _, err := ret.AddWithID(key.Name, key.ID); err != nil {
+			return nil, err
+		}
+	}
+	for _, key := range moved {
+		ret.Add(key.Name)
+	}
+	for _, key := range configured.Keys {
+		reconciled, _ := ret.Get(key.Name)
+		reconciled.Type = key.Type
+		reconciled.TypeValidation = key.TypeValidation
+	}
+	return ret, nil
+}
+
+func sortedMetaKeys(keys *MetaKeys) []*MetaKey {
+	ret := []*MetaKey{}
+	for _, key := range keys.Keys {
+		ret = append(ret, key)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].ID < ret[j].ID
+	})
+	return ret
+}
+
+// readMetaKeys returns the meta keys stored in the database.
+func (l *LogWriter) readMetaKeys(ctx context.Context) (*MetaKeys, error) {
+	ret := NewMetaKeys()
+
+	s := sqlbuilder.Select("id", "key").From("meta_keys")
+	rows, err := l.db.QueryxContext(ctx, s.String())
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	for rows.Next() {
+		var id int
+		var key string
+		if err := rows.Scan(&id, &key); err != nil {
+			return nil, err
+		}
+		if _, err := ret.AddWithID(key, id); err != nil {
+			return nil, err
+		}
+	}
+
+	return ret, rows.Err()
+}
@@ -0,0 +1,302 @@
+package pkg
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A schema can be declared in a YAML (or JSON) file, listing the meta keys
+// along with their expected type, whether they are required, and what they
+// contain:
+//
+//	fields:
+//	  - name: user_id
+//	    type: int
+//	    required: true
+//	    description: ID of the authenticated user
+//	  - name: duration
+//	    type: float
+//	    type_validation: coerce
+//	    description: request duration in milliseconds
+//
+// Fields can also be derived from the other fields, see derive.go.
+//
+// The keys get ids in the order they are declared. Entries are validated
+// against the schema by SchemaValidationMiddleware, and the values of fields
+// with a type_validation are checked when they get stored, see TypeValidation.
+
+// FieldType is the expected type of a field, see FieldDefinition.
+type FieldType string
+
+const (
+	FieldTypeAny    FieldType = ""
+	FieldTypeString FieldType = "string"
+	FieldTypeInt    FieldType = "int"
+	// FieldTypeFloat accepts integers as well.
+	FieldTypeFloat  FieldType = "float"
+	FieldTypeBool   FieldType = "bool"
+	FieldTypeObject FieldType = "object"
+	FieldTypeArray  FieldType = "array"
+	// FieldTypeDuration accepts the numbers written by zerolog's Dur and
+	// duration strings such as "1.5s", see duration.go.
+	FieldTypeDuration FieldType = "duration"
+	// FieldTypeTime accepts the timestamps written by zerolog's Time.
+	FieldTypeTime FieldType = "time"
+)
+
+// FieldDefinition declares a field of the entries.
+type FieldDefinition struct {
+	Name        string    `yaml:"name" json:"name"`
+	Type        FieldType `yaml:"type,omitempty" json:"type,omitempty"`
+	Required    bool      `yaml:"required,omitempty" json:"required,omitempty"`
+	Description string    `yaml:"description,omitempty" json:"description,omitempty"`
+	// TypeValidation is set on the MetaKey of the field, see MetaKeys.AddTyped.
+	TypeValidation TypeValidation `yaml:"type_validation,omitempty" json:"type_validation,omitempty"`
+	// Derive computes the value of the field when entries are written, see
+	// DerivedFieldsMiddleware.
+	Derive []*DerivedCase `yaml:"derive,omitempty" json:"derive,omitempty"`
+}
+
+// LogEntryType returns the type the values of the field are stored as.
+func (t FieldType) LogEntryType() LogEntryType {
+	switch t {
+	case FieldTypeString:
+		return LogEntryTypeText
+	case FieldTypeInt:
+		return LogEntryTypeInt
+	case FieldTypeFloat:
+		return LogEntryTypeReal
+	case FieldTypeBool:
+		return LogEntryTypeBool
+	case FieldTypeDuration:
+		return LogEntryTypeDuration
+	case FieldTypeTime:
+		return LogEntryTypeTime
+	default:
+		return LogEntryTypeJSON
+	}
+}
+
+type schemaFile struct {
+	Fields []*FieldDefinition `yaml:"fields"`
+}
+
+// ParseSchema reads a schema declared in YAML or JSON.
+func ParseSchema(r io.Reader) (*Schema, error) {
+	file := &schemaFile{}
+	if err := yaml.NewDecoder(r).Decode(file); err != nil && err != io.EOF {
+		return nil, errors.Wrap(err, "could not parse schema")
+	}
+
+	schema := NewSchema()
+	for _, field := range file.Fields {
+		if field.Name == "" {
+			return nil, errors.New("schema field without name")
+		}
+		if _, ok := schema.MetaKeys.Get(field.Name); ok {
+			return nil, errors.Errorf("schema field %s is declared twice", field.Name)
+		}
+		switch field.Type {
+		case FieldTypeAny, FieldTypeString, FieldTypeInt, FieldTypeFloat,
+			FieldTypeBool, FieldTypeObject, FieldTypeArray, FieldTypeDuration, FieldTypeTime:
+		default:
+			return nil, errors.Errorf("schema field %s has unknown type %q", field.Name, field.Type)
+		}
+		validation, err := ParseTypeValidation(string(field.TypeValidation))
+		if err != nil {
+			return nil, errors.Wrapf(err, "schema field %s", field.Name)
+		}
+		if validation != "" && field.Type == FieldTypeAny {
+			return nil, errors.Errorf("schema field %s has a type_validation but no type", field.Name)
+		}
+		if err := field.compileDerive(); err != nil {
+			return nil, err
+		}
+		schema.MetaKeys.AddTyped(field.Name, field.Type.LogEntryType(), validation)
+		schema.Fields = append(schema.Fields, field)
+	}
+	return schema, nil
+}
+
+// LoadSchemaFromFile reads the schema declared in the YAML or JSON file at path.
+func LoadSchemaFromFile(path string) (*Schema, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = f.Close()
+	}()
+	return ParseSchema(f)
+}
+
+// Field returns the definition of the field name, if the schema declares it.
+func (s *Schema) Field(name string) (*FieldDefinition, bool) {
+	for _, field := range s.Fields {
+		if field.Name == name {
+			return field, true
+		}
+	}
+	return nil, false
+}
+
+// SchemaViolation describes a field of an entry that doesn't match its definition.
+type SchemaViolation struct {
+	Field  string
+	Reason string
+}
+
+func (v SchemaViolation) String() string {
+	return v.Field + ": " + v.Reason
+}
+
+// SchemaViolationError is returned by the validation middleware in SchemaValidationReject.
+type SchemaViolationError struct {
+	Violations []SchemaViolation
+}
+
+func (e *SchemaViolationError) Error() string {
+	violations := []string{}
+	for _, v := range e.Violations {
+		violations = append(violations, v.String())
+	}
+	return "schema violation: " + strings.Join(violations, ", ")
+}
+
+// Validate checks entry, as handed to the middlewares, against the declared
+// fields. Fields that aren't declared are accepted.
+func (s *Schema) Validate(entry map[string]interface{}) []SchemaViolation {
+	ret := []SchemaViolation{}
+	for _, field := range s.Fields {
+		v, ok := entry[field.Name]
+		if !ok || v == nil {
+			if field.Required {
+				ret = append(ret, SchemaViolation{Field: field.Name, Reason: "missing required field"})
+			}
+			continue
+		}
+		if !matchesFieldType(v, field.Type) {
+			ret = append(ret, SchemaViolation{
+				Field:  field.Name,
+				Reason: fmt.Sprintf("expected %s, got %s", field.Type, fieldTypeOf(v)),
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Field < ret[j].Field
+	})
+	return ret
+}
+
+func matchesFieldType(v interface{}, t FieldType) bool {
+	actual := fieldTypeOf(v)
+	switch t {
+	case FieldTypeAny:
+		return true
+	case FieldTypeFloat:
+		return actual == FieldTypeFloat || actual == FieldTypeInt
+	case FieldTypeDuration:
+		if s, ok := v.(string); ok {
+			_, err := time.ParseDuration(s)
+			return err == nil
+		}
+		return actual == FieldTypeDuration || actual == FieldTypeFloat || actual == FieldTypeInt
+	case FieldTypeTime:
+		return actual == FieldTypeTime || actual == FieldTypeString || actual == FieldTypeFloat || actual == FieldTypeInt
+	default:
+		return actual == t
+	}
+}
+
+func fieldTypeOf(v interface{}) FieldType {
+	switch v.(type) {
+	case string:
+		return FieldTypeString
+	case bool:
+		return FieldTypeBool
+	case map[string]interface{}:
+		return FieldTypeObject
+	case []interface{}:
+		return FieldTypeArray
+	}
+	switch ToLogEntryType(v) {
+	case LogEntryTypeInt:
+		return FieldTypeInt
+	case LogEntryTypeReal:
+		return FieldTypeFloat
+	case LogEntryTypeText:
+		return FieldTypeString
+	case LogEntryTypeDuration:
+		return FieldTypeDuration
+	case LogEntryTypeTime:
+		return FieldTypeTime
+	}
+	return FieldTypeAny
+}
+
+// SchemaValidation selects what happens to entries violating the schema.
+type SchemaValidation string
+
+const (
+	// SchemaValidationNone doesn't validate entries.
+	SchemaValidationNone SchemaValidation = "none"
+	// SchemaValidationFlag stores the violations in the SchemaViolationsKey
+	// meta key of the entry.
+	SchemaValidationFlag SchemaValidation = "flag"
+	// SchemaValidationReject fails the write with a SchemaViolationError.
+	SchemaValidationReject SchemaValidation = "reject"
+)
+
+// SchemaViolationsKey is the meta key listing the violations of an entry in SchemaValidationFlag.
+const SchemaViolationsKey = "schema_violations"
+
+type InvalidSchemaValidationError struct {
+	Mode string
+}
+
+func (e *InvalidSchemaValidationError) Error() string {
+	return "invalid schema validation " + e.Mode + ", expected none, flag or reject"
+}
+
+// ParseSchemaValidation parses the name of a SchemaValidation, as used on the command line.
+func ParseSchemaValidation(s string) (SchemaValidation, error) {
+	switch SchemaValidation(strings.ToLower(s)) {
+	case SchemaValidationNone, "":
+		return SchemaValidationNone, nil
+	case SchemaValidationFlag:
+		return SchemaValidationFlag, nil
+	case SchemaValidationReject:
+		return SchemaValidationReject, nil
+	}
+	return "", &InvalidSchemaValidationError{Mode: s}
+}
+
+// SchemaValidationMiddleware validates the entries against the fields
+// declared in schema, see Schema.Validate.
+func SchemaValidationMiddleware(schema *Schema, mode SchemaValidation) Middleware {
+	return func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			if mode == SchemaValidationNone || mode == "" {
+				return next(entry)
+			}
+			violations := schema.Validate(entry)
+			if len(violations) > 0 {
+				if mode == SchemaValidationReject {
+					return errors.WithStack(&SchemaViolationError{Violations: violations})
+				}
+				s := []string{}
+				for _, v := range violations {
+					s = append(s, v.String())
+				}
+				entry[SchemaViolationsKey] = strings.Join(s, "; ")
+			}
+			return next(entry)
+		}
+	}
+}
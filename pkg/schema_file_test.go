@@ -0,0 +1,88 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testSchemaYAML = `
+fields:
+  - name: user_id
+    type: int
+    required: true
+    description: ID of the authenticated user
+  - name: duration
+    type: float
+  - name: tags
+    type: array
+`
+
+func TestLoadSchemaFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "schema.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testSchemaYAML), 0644))
+
+	schema, err := LoadSchemaFromFile(path)
+	require.NoError(t, err)
+	require.Len(t, schema.Fields, 3)
+	key, ok := schema.MetaKeys.Get("duration")
+	require.True(t, ok)
+	assert.Equal(t, 1, key.ID)
+	field, ok := schema.Field("user_id")
+	require.True(t, ok)
+	assert.Equal(t, "ID of the authenticated user", field.Description)
+
+	// JSON is accepted as well
+	schema, err = ParseSchema(strings.NewReader(`{"fields": [{"name": "user", "type": "string"}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, FieldTypeString, schema.Fields[0].Type)
+
+	schema, err = ParseSchema(strings.NewReader(`{"fields": [{"name": "n", "type": "int", "type_validation": "coerce"}]}`))
+	require.NoError(t, err)
+	key, _ = schema.MetaKeys.Get("n")
+	assert.Equal(t, LogEntryTypeInt, key.Type)
+	assert.Equal(t, TypeValidationCoerce, key.TypeValidation)
+
+	_, err = ParseSchema(strings.NewReader(`{"fields": [{"name": "user", "type": "uuid"}]}`))
+	assert.EqualError(t, err, `schema field user has unknown type "uuid"`)
+}
+
+func TestSchemaValidate(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(testSchemaYAML))
+	require.NoError(t, err)
+
+	entry, err := decodeEntry([]byte(`{"user_id": 12, "duration": 3, "tags": ["a"], "other": true}`))
+	require.NoError(t, err)
+	assert.Empty(t, schema.Validate(entry))
+
+	entry, err = decodeEntry([]byte(`{"duration": "slow", "tags": null}`))
+	require.NoError(t, err)
+	assert.Equal(t, []SchemaViolation{
+		{Field: "duration", Reason: "expected float, got string"},
+		{Field: "user_id", Reason: "missing required field"},
+	}, schema.Validate(entry))
+}
+
+func TestLogWriterSchemaValidation(t *testing.T) {
+	schema, err := ParseSchema(strings.NewReader(testSchemaYAML))
+	require.NoError(t, err)
+
+	lw := newImportLogWriter(t, WithMiddleware(SchemaValidationMiddleware(schema, SchemaValidationFlag)))
+	_, err = lw.Write([]byte(`{"level": "info", "user_id": 1.5}`))
+	require.NoError(t, err)
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "user_id: expected int, got float", entries[0].Meta[SchemaViolationsKey])
+
+	lw = newImportLogWriter(t, WithMiddleware(SchemaValidationMiddleware(schema, SchemaValidationReject)))
+	_, err = lw.Write([]byte(`{"level": "info"}`))
+	var violationErr *SchemaViolationError
+	require.ErrorAs(t, err, &violationErr)
+	assert.Equal(t, "user_id", violationErr.Violations[0].Field)
+	_, err = lw.Write([]byte(`{"level": "info", "user_id": 1}`))
+	require.NoError(t, err)
+}
@@ -0,0 +1,308 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Scripts customize the write path and the alert rules without recompiling
+// plunger. They are Starlark programs (https://github.com/bazelbuild/starlark),
+// a dialect of Python run by the embedded go.starlark.net interpreter, and
+// loaded from files at startup. A script defines a main function, which is
+// called with the entry as a dict:
+//
+//   - ScriptMiddleware transforms entries: main returns the entry that gets
+//     stored, or None to drop the entry.
+//   - ScriptFieldMiddleware computes a field: the value returned by main is
+//     stored under a key, such as duration_ms for
+//     return (entry["end"] - entry["start"]) * 1000.
+//   - alert rules can have a script condition, see alert.Rule.Script.
+//
+// Scripts see the entry as JSON: numbers are ints or floats, and values that
+// are not JSON are converted to JSON first. The json module of Starlark is
+// predeclared.
+
+// ScriptMain is the function a script defines.
+const ScriptMain = "main"
+
+// ScriptError is returned when a script fails to load or run.
+type ScriptError struct {
+	Script string
+	Err    error
+}
+
+func (e *ScriptError) Error() string {
+	return fmt.Sprintf("script %s: %s", e.Script, e.Err)
+}
+
+func (e *ScriptError) Unwrap() error {
+	return e.Err
+}
+
+// Script is a loaded Starlark program.
+type Script struct {
+	// Name is the file the script was loaded from.
+	Name string
+	main starlark.Callable
+}
+
+// ParseScript runs the Starlark program src, which has to define the
+// ScriptMain function, name being used in errors.
+func ParseScript(name string, src string) (*Script, error) {
+	thread := &starlark.Thread{Name: name}
+	predeclared := starlark.StringDict{"json": starlarkjson.Module}
+	globals, err := starlark.ExecFile(thread, name, src, predeclared)
+	if err != nil {
+		return nil, &ScriptError{Script: name, Err: err}
+	}
+	main, ok := globals[ScriptMain].(starlark.Callable)
+	if !ok {
+		return nil, &ScriptError{Script: name, Err: errors.Errorf("no %s function", ScriptMain)}
+	}
+	// frozen globals can be shared by the concurrent calls of main
+	globals.Freeze()
+	return &Script{Name: name, main: main}, nil
+}
+
+// LoadScript loads the Starlark program of the file at path.
+func LoadScript(path string) (*Script, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not read script")
+	}
+	return ParseScript(filepath.Base(path), string(b))
+}
+
+// call calls the main function of the script with input.
+func (s *Script) call(ctx context.Context, input interface{}) (starlark.Value, error) {
+	v, err := toScriptValue(input)
+	if err != nil {
+		return nil, &ScriptError{Script: s.Name, Err: err}
+	}
+
+	thread := &starlark.Thread{Name: s.Name}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			thread.Cancel(ctx.Err().Error())
+		case <-done:
+		}
+	}()
+
+	out, err := starlark.Call(thread, s.main, starlark.Tuple{v}, nil)
+	if err != nil {
+		return nil, &ScriptError{Script: s.Name, Err: err}
+	}
+	return out, nil
+}
+
+// Eval calls the script with entry and returns its output as a JSON value,
+// false if it returned None.
+func (s *Script) Eval(ctx context.Context, entry map[string]interface{}) (interface{}, bool, error) {
+	out, err := s.call(ctx, entry)
+	if err != nil || out == starlark.None {
+		return nil, false, err
+	}
+	ret, err := fromScriptValue(out)
+	if err != nil {
+		return nil, false, &ScriptError{Script: s.Name, Err: err}
+	}
+	return ret, true, nil
+}
+
+// Test calls the script with entry and returns the truth value of its
+// output, as Starlark's bool() does: None, False, 0 and empty values are false.
+func (s *Script) Test(ctx context.Context, entry map[string]interface{}) (bool, error) {
+	out, err := s.call(ctx, entry)
+	if err != nil {
+		return false, err
+	}
+	return bool(out.Truth()), nil
+}
+
+// Transform calls the script with entry and returns its output, which has to
+// be a dict. It returns false if the script returned None.
+func (s *Script) Transform(ctx context.Context, entry map[string]interface{}) (map[string]interface{}, bool, error) {
+	v, ok, err := s.Eval(ctx, entry)
+	if err != nil || !ok {
+		return nil, false, err
+	}
+	ret, ok := v.(map[string]interface{})
+	if !ok {
+		return nil, false, &ScriptError{Script: s.Name, Err: errors.Errorf("output %s is not a dict", shortJSON(v))}
+	}
+	return ret, true, nil
+}
+
+// ScriptMiddleware replaces entries with the output of script, dropping the
+// entries for which it returns None.
+func ScriptMiddleware(script *Script) Middleware {
+	return func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			ret, ok, err := script.Transform(context.Background(), entry)
+			if err != nil || !ok {
+				return err
+			}
+			return next(ret)
+		}
+	}
+}
+
+// ScriptFieldMiddleware sets key to the output of script. The key is left
+// unset if the script returns None.
+func ScriptFieldMiddleware(key string, script *Script) Middleware {
+	return func(next EntryHandler) EntryHandler {
+		return func(entry map[string]interface{}) error {
+			v, ok, err := script.Eval(context.Background(), entry)
+			if err != nil {
+				return err
+			}
+			if ok && v != nil {
+				entry[key] = v
+			}
+			return next(entry)
+		}
+	}
+}
+
+// ParseScriptField parses a key=path pair, such as duration_ms=duration.star,
+// and loads the script.
+func ParseScriptField(pair string) (string, *Script, error) {
+	key, path, ok := strings.Cut(pair, "=")
+	if !ok || key == "" || path == "" {
+		return "", nil, errors.Errorf("invalid script field %q, expected key=path", pair)
+	}
+	script, err := LoadScript(path)
+	if err != nil {
+		return "", nil, err
+	}
+	return key, script, nil
+}
+
+// toScriptValue converts v to Starlark values, through JSON so that all the
+// values of entries are handled, leaving v untouched.
+func toScriptValue(v interface{}) (starlark.Value, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	var decoded interface{}
+	if err := decoder.Decode(&decoded); err != nil {
+		return nil, err
+	}
+	return toStarlark(decoded), nil
+}
+
+// toStarlark converts a JSON value decoded with UseNumber.
+func toStarlark(v interface{}) starlark.Value {
+	switch v_ := v.(type) {
+	case bool:
+		return starlark.Bool(v_)
+	case json.Number:
+		if i, err := v_.Int64(); err == nil {
+			return starlark.MakeInt64(i)
+		}
+		f, _ := v_.Float64()
+		return starlark.Float(f)
+	case string:
+		return starlark.String(v_)
+	case []interface{}:
+		values := make([]starlark.Value, 0, len(v_))
+		for _, e := range v_ {
+			values = append(values, toStarlark(e))
+		}
+		return starlark.NewList(values)
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v_))
+		for k := range v_ {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		ret := starlark.NewDict(len(v_))
+		for _, k := range keys {
+			_ = ret.SetKey(starlark.String(k), toStarlark(v_[k]))
+		}
+		return ret
+	}
+	return starlark.None
+}
+
+// fromScriptValue converts an output of a script to the values json.Unmarshal
+// returns, the way entries are parsed.
+func fromScriptValue(v starlark.Value) (interface{}, error) {
+	decoded, err := fromStarlark(v)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(decoded)
+	if err != nil {
+		return nil, err
+	}
+	var ret interface{}
+	if err := json.Unmarshal(b, &ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+func fromStarlark(v starlark.Value) (interface{}, error) {
+	switch v_ := v.(type) {
+	case starlark.NoneType:
+		return nil, nil
+	case starlark.Bool:
+		return bool(v_), nil
+	case starlark.Int:
+		if i, ok := v_.Int64(); ok {
+			return i, nil
+		}
+		return float64(v_.Float()), nil
+	case starlark.Float:
+		return float64(v_), nil
+	case starlark.String:
+		return string(v_), nil
+	case starlark.Indexable:
+		// lists and tuples
+		ret := make([]interface{}, 0, v_.Len())
+		for i := 0; i < v_.Len(); i++ {
+			e, err := fromStarlark(v_.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, e)
+		}
+		return ret, nil
+	case *starlark.Dict:
+		ret := map[string]interface{}{}
+		for _, item := range v_.Items() {
+			k, ok := starlark.AsString(item[0])
+			if !ok {
+				return nil, errors.Errorf("dict key %s is not a string", item[0])
+			}
+			e, err := fromStarlark(item[1])
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = e
+		}
+		return ret, nil
+	}
+	return nil, errors.Errorf("%s values can't be stored", v.Type())
+}
+
+func shortJSON(v interface{}) string {
+	b, _ := json.Marshal(v)
+	return truncateMessage(string(b))
+}
@@ -0,0 +1,90 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestScriptMiddleware(t *testing.T) {
+	transform, err := ParseScript("transform.star", `
+def main(entry):
+    if entry["level"] == "trace":
+        return None
+    entry["message"] = entry["message"].upper()
+    entry.pop("secret", None)
+    return entry
+`)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "duration.star")
+	require.NoError(t, os.WriteFile(path, []byte(`
+def main(entry):
+    if "end" in entry:
+        return (entry["end"] - entry["start"]) * 1000
+`), 0o600))
+	key, field, err := ParseScriptField("duration_ms=" + path)
+	require.NoError(t, err)
+	assert.Equal(t, "duration_ms", key)
+
+	lw := newImportLogWriter(t, WithMiddleware(ScriptMiddleware(transform), ScriptFieldMiddleware(key, field)))
+	for _, line := range []string{
+		`{"level": "trace", "message": "noise"}`,
+		`{"level": "info", "message": "done", "secret": "s3cr3t", "start": 1.5, "end": 2}`,
+		`{"level": "info", "message": "no duration"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "DONE", *entries[0].Message)
+	assert.NotContains(t, entries[0].Meta, "secret")
+	assert.EqualValues(t, 500, entries[0].Meta["duration_ms"])
+	assert.Equal(t, "NO DURATION", *entries[1].Message)
+	assert.NotContains(t, entries[1].Meta, "duration_ms")
+}
+
+func TestScriptErrors(t *testing.T) {
+	_, err := ParseScript("broken.star", "def main(entry):\n    return entry[")
+	var scriptErr *ScriptError
+	assert.ErrorAs(t, err, &scriptErr)
+	_, err = ParseScript("nomain.star", "level = 1")
+	assert.ErrorContains(t, err, "script nomain.star: no main function")
+	_, err = LoadScript(filepath.Join(t.TempDir(), "missing.star"))
+	assert.Error(t, err)
+	_, _, err = ParseScriptField("duration.star")
+	assert.Error(t, err)
+
+	script, err := ParseScript("level.star", `def main(entry): return entry["level"]`)
+	require.NoError(t, err)
+	_, _, err = script.Transform(context.Background(), map[string]interface{}{"level": "info"})
+	assert.ErrorContains(t, err, `script level.star: output "info" is not a dict`)
+
+	lw := newImportLogWriter(t, WithMiddleware(ScriptMiddleware(script)))
+	_, err = lw.Write([]byte(`{"level": "info"}`))
+	assert.ErrorAs(t, err, &scriptErr)
+
+	ok, err := script.Test(context.Background(), map[string]interface{}{"level": nil})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// runtime errors, such as missing keys, fail the script
+	_, err = script.Test(context.Background(), map[string]interface{}{})
+	assert.ErrorAs(t, err, &scriptErr)
+
+	loop, err := ParseScript("loop.star", `
+def main(entry):
+    for i in range(1000000000):
+        pass
+`)
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = loop.Test(ctx, map[string]interface{}{})
+	assert.ErrorContains(t, err, "context canceled")
+}
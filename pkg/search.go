@@ -0,0 +1,114 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// Full-text search uses an FTS5 virtual table with one row per log entry,
+// whose rowid is the id of the entry and whose content is the concatenation
+// of the message and the text, blob, and JSON values of the entry.
+//
+// FTS5 is only available if go-sqlite3 is built with the sqlite_fts5 build tag.
+
+type MissingFTS5Error struct {
+	Err error
+}
+
+func (e *MissingFTS5Error) Error() string {
+	return "full-text search requires sqlite to be built with FTS5 (use -tags sqlite_fts5): " + e.Err.Error()
+}
+
+func (e *MissingFTS5Error) Unwrap() error {
+	return e.Err
+}
+
+// WithFullTextSearch maintains a full-text index of the entries on write,
+// which can be queried with WithSearch.
+func WithFullTextSearch(enabled bool) LogWriterOption {
+	return func(l *LogWriter) {
+		l.fullTextSearch = enabled
+	}
+}
+
+// WithSearch only returns entries matching all the whitespace separated terms,
+// using the full-text index.
+func WithSearch(terms string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Search = terms
+	}
+}
+
+// searchQuery turns user provided terms into an FTS5 query matching all
+// terms, quoting them so that they are not interpreted as FTS5 syntax.
+func searchQuery(terms string) string {
+	quoted := []string{}
+	for _, term := range strings.Fields(terms) {
+		quoted = append(quoted, `"`+strings.ReplaceAll(term, `"`, `""`)+`"`)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (l *LogWriter) createSearchTable(ctx context.Context) error {
+	if !l.store.SupportsFullTextSearch() {
+		return errors.New("full-text search is only supported on sqlite")
+	}
+
+	exists, err := l.store.HasTable("log_entries_fts")
+	if err != nil {
+		return err
+	}
+	if exists {
+		return nil
+	}
+
+	_, err = l.db.ExecContext(ctx, "CREATE VIRTUAL TABLE log_entries_fts USING fts5(content)")
+	if err != nil {
+		if strings.Contains(err.Error(), "no such module") {
+			return &MissingFTS5Error{Err: err}
+		}
+		return err
+	}
+
+	// index the entries that were written before search was enabled
+	return l.RebuildSearchIndexContext(ctx)
+}
+
+// RebuildSearchIndex recomputes the full-text index for all the entries in the database.
+func (l *LogWriter) RebuildSearchIndex() error {
+	return l.RebuildSearchIndexContext(context.Background())
+}
+
+func (l *LogWriter) RebuildSearchIndexContext(ctx context.Context) error {
+	tx, err := l.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM log_entries_fts"); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+INSERT INTO log_entries_fts (rowid, content)
+SELECT e.id,
+       COALESCE(e.message, '') || ' ' || COALESCE(e.error_message, '') || ' ' || COALESCE(GROUP_CONCAT(COALESCE(lem.text_value, lem.blob_value), ' '), '')
+FROM log_entries e
+LEFT JOIN log_entries_meta lem ON lem.log_entry_id = e.id
+GROUP BY e.id`)
+	if err != nil {
+		_ = tx.Rollback()
+		return errors.Wrap(err, "could not rebuild search index")
+	}
+
+	return tx.Commit()
+}
+
+func searchCondition(q *sqlbuilder.SelectBuilder, terms string) string {
+	sb := sqlbuilder.Select("rowid").From("log_entries_fts")
+	sb.Where("log_entries_fts MATCH " + sb.Var(searchQuery(terms)))
+	return q.In("id", sb)
+}
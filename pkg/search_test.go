@@ -0,0 +1,50 @@
+//go:build sqlite_fts5
+
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterSearch(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	db.SetMaxOpenConns(1)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	// written before search is enabled, gets indexed when creating the table
+	_, err = lw.Write([]byte(`{"level": "error", "message": "dial failed", "error": "connection refused"}`))
+	require.NoError(t, err)
+
+	lw = NewLogWriter(db, NewSchema(), WithFullTextSearch(true))
+	err = lw.Init()
+	require.NoError(t, err)
+
+	_, err = lw.Write([]byte(`{"level": "info", "message": "connection established", "peer": {"host": "example.com"}}`))
+	require.NoError(t, err)
+	_, err = lw.Write([]byte(`{"level": "error", "message": "timeout", "details": {"reason": "connection refused"}}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithSearch("connection refused")))
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "dial failed", *entries[0].Message)
+	assert.Equal(t, "timeout", *entries[1].Message)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithSearch("example.com")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithSearch("connection"), WithLevel("info")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
@@ -0,0 +1,455 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Session groups the log entries written by a single run of a program.
+//
+// Entries reference their session by id through the session column of log_entries.
+type Session struct {
+	ID        string                 `db:"id" json:"id"`
+	Name      string                 `db:"name" json:"name"`
+	Metadata  map[string]interface{} `db:"-" json:"metadata,omitempty"`
+	CreatedAt time.Time              `db:"created_at" json:"created_at"`
+	Active    bool                   `db:"active" json:"active"`
+	// ParentID is the session this session is part of, for example the test
+	// suite of a test case, see NewChildSession.
+	ParentID string   `db:"parent_id" json:"parent_id,omitempty"`
+	Tags     []string `db:"-" json:"tags,omitempty"`
+
+	// StartedAt and EndedAt are the times the last run of the session
+	// started and ended, and ExitCode its exit code, if known, see End.
+	StartedAt *time.Time `db:"started_at" json:"started_at,omitempty"`
+	EndedAt   *time.Time `db:"ended_at" json:"ended_at,omitempty"`
+	ExitCode  *int       `db:"exit_code" json:"exit_code,omitempty"`
+	// Duration is the time between StartedAt and EndedAt, in nanoseconds
+	// in JSON.
+	Duration *time.Duration `db:"-" json:"duration,omitempty"`
+
+	manager *SessionManager
+}
+
+// SessionSummary is a session along with statistics about its entries.
+type SessionSummary struct {
+	*Session
+	EntryCount int        `json:"entry_count"`
+	From       *time.Time `json:"from,omitempty"`
+	To         *time.Time `json:"to,omitempty"`
+}
+
+type UnknownSessionError struct {
+	ID string
+}
+
+func (e *UnknownSessionError) Error() string {
+	return "unknown session " + e.ID
+}
+
+var sessionColumns = []string{"id", "name", "metadata", "created_at", "active", "parent_id", "started_at", "ended_at", "exit_code"}
+
+// SessionManager creates and tracks the sessions stored in a plunger database.
+type SessionManager struct {
+	db *sqlx.DB
+}
+
+func NewSessionManager(db *sqlx.DB) *SessionManager {
+	return &SessionManager{
+		db: db,
+	}
+}
+
+func (s *SessionManager) Init() error {
+	return s.InitContext(context.Background())
+}
+
+// InitContext creates the sessions tables if needed.
+func (s *SessionManager) InitContext(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("sessions").
+		IfNotExists().
+		Define("id", "VARCHAR(255)", "PRIMARY KEY").
+		Define("name", "VARCHAR(255)", "NOT NULL", "DEFAULT ''").
+		Define("metadata", "TEXT").
+		Define("created_at", "TIMESTAMP", "NOT NULL").
+		Define("active", "BOOLEAN", "NOT NULL", "DEFAULT FALSE").
+		Define("parent_id", "VARCHAR(255)").
+		Define("started_at", "TIMESTAMP").
+		Define("ended_at", "TIMESTAMP").
+		Define("exit_code", "INTEGER")
+	if _, err := s.db.ExecContext(ctx, ctb.String()); err != nil {
+		return err
+	}
+
+	return s.createSessionMetadataTables(ctx)
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewSession creates and stores a new session.
+func (s *SessionManager) NewSession(name string, metadata map[string]interface{}, opts ...SessionOption) (*Session, error) {
+	return s.newSession("", name, metadata, opts...)
+}
+
+// NewChildSession creates and stores a new session as part of the session
+// parentID, which has to exist. The entries of a session and all its
+// descendants can be queried using WithSessionTree.
+func (s *SessionManager) NewChildSession(parentID string, name string, metadata map[string]interface{}, opts ...SessionOption) (*Session, error) {
+	if _, err := s.GetSession(parentID); err != nil {
+		return nil, err
+	}
+	return s.newSession(parentID, name, metadata, opts...)
+}
+
+func (s *SessionManager) newSession(parentID string, name string, metadata map[string]interface{}, opts ...SessionOption) (*Session, error) {
+	id, err := newSessionID()
+	if err != nil {
+		return nil, err
+	}
+
+	session := &Session{
+		ID:        id,
+		Name:      name,
+		Metadata:  metadata,
+		CreatedAt: time.Now().UTC(),
+		ParentID:  parentID,
+		manager:   s,
+	}
+	for _, opt := range opts {
+		opt(session)
+	}
+	if err := s.insertSession(session); err != nil {
+		return nil, err
+	}
+
+	return session, nil
+}
+
+func (s *SessionManager) insertSession(session *Session) error {
+	var parentID sql.NullString
+	if session.ParentID != "" {
+		parentID = sql.NullString{String: session.ParentID, Valid: true}
+	}
+	if session.StartedAt == nil {
+		startedAt := session.CreatedAt
+		session.StartedAt = &startedAt
+	}
+	var endedAt sql.NullTime
+	if session.EndedAt != nil {
+		endedAt = sql.NullTime{Time: *session.EndedAt, Valid: true}
+	}
+	var exitCode sql.NullInt64
+	if session.ExitCode != nil {
+		exitCode = sql.NullInt64{Int64: int64(*session.ExitCode), Valid: true}
+	}
+
+	ctx := context.Background()
+	tx, err := s.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	q := sqlbuilder.NewInsertBuilder()
+	q.InsertInto("sessions").
+		Cols("id", "name", "created_at", "active", "parent_id", "started_at", "ended_at", "exit_code").
+		Values(session.ID, session.Name, session.CreatedAt, false, parentID, *session.StartedAt, endedAt, exitCode)
+	s_, args := q.Build()
+	if _, err := tx.ExecContext(ctx, tx.Rebind(s_), args...); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := upsertSessionMetadata(ctx, tx, session.ID, session.Metadata, "ON CONFLICT (session_id, key) DO NOTHING"); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := insertSessionTags(ctx, tx, session.ID, session.Tags); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ensureSession stores session unless a session with the same id exists.
+func (s *SessionManager) ensureSession(session *Session) error {
+	_, err := s.GetSession(session.ID)
+	var unknown *UnknownSessionError
+	if !errors.As(err, &unknown) {
+		return err
+	}
+	return s.insertSession(session)
+}
+
+// SetActive marks the session with the given id as the active session,
+// which will be continued by the next InitLogging call.
+func (s *SessionManager) SetActive(id string) error {
+	tx, err := s.db.Beginx()
+	if err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(tx.Rebind(clearActiveQuery())); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+
+	ub := sqlbuilder.Update("sessions")
+	ub.Set(ub.Assign("active", true)).Where(ub.E("id", id))
+	s_, args := ub.Build()
+	res, err := tx.Exec(tx.Rebind(s_), args...)
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if n == 0 {
+		_ = tx.Rollback()
+		return &UnknownSessionError{ID: id}
+	}
+
+	return tx.Commit()
+}
+
+// ClearActive makes sure no session is marked as active.
+func (s *SessionManager) ClearActive() error {
+	_, err := s.db.Exec(s.db.Rebind(clearActiveQuery()))
+	return err
+}
+
+func clearActiveQuery() string {
+	return "UPDATE sessions SET active = FALSE WHERE active = TRUE"
+}
+
+// GetActive returns the active session, or nil if there is none.
+func (s *SessionManager) GetActive() (*Session, error) {
+	sb := sqlbuilder.Select(sessionColumns...).From("sessions")
+	sb.Where(sb.E("active", true))
+	sessions, err := s.selectSessions(sb)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, nil
+	}
+	return sessions[0], nil
+}
+
+// GetSession returns the session with the given id.
+func (s *SessionManager) GetSession(id string) (*Session, error) {
+	sb := sqlbuilder.Select(sessionColumns...).From("sessions")
+	sb.Where(sb.E("id", id))
+	sessions, err := s.selectSessions(sb)
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, &UnknownSessionError{ID: id}
+	}
+	return sessions[0], nil
+}
+
+// GetSessionTree returns the session root followed by its descendants, see NewChildSession.
+func (s *SessionManager) GetSessionTree(root string) ([]*Session, error) {
+	sb := sqlbuilder.Select(sessionColumns...).From("sessions")
+	sb.Where(sessionTreeCondition(&sb.Cond, "id", root))
+	sessions, err := s.selectSessions(sb)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := []*Session{}
+	for _, session := range sessions {
+		if session.ID == root {
+			ret = append([]*Session{session}, ret...)
+		} else {
+			ret = append(ret, session)
+		}
+	}
+	if len(ret) == 0 || ret[0].ID != root {
+		return nil, &UnknownSessionError{ID: root}
+	}
+	return ret, nil
+}
+
+// sessionTreeCondition matches the rows whose column is the session root or
+// one of its descendants.
+func sessionTreeCondition(c *sqlbuilder.Cond, column string, root string) string {
+	// the cast lets postgres infer the type of the parameter
+	return fmt.Sprintf(
+		"%s IN (WITH RECURSIVE session_tree(id) AS ("+
+			"SELECT CAST(%s AS VARCHAR(255)) "+
+			"UNION SELECT s.id FROM sessions s JOIN session_tree t ON s.parent_id = t.id"+
+			") SELECT id FROM session_tree)",
+		column, c.Var(root))
+}
+
+func (s *SessionManager) selectSessions(sb *sqlbuilder.SelectBuilder) ([]*Session, error) {
+	s_, args := sb.Build()
+	rows, err := s.db.Queryx(s.db.Rebind(s_), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	ret := []*Session{}
+	for rows.Next() {
+		var metadata, parentID sql.NullString
+		var startedAt, endedAt sql.NullTime
+		var exitCode sql.NullInt64
+		session := &Session{manager: s}
+		if err := rows.Scan(&session.ID, &session.Name, &metadata, &session.CreatedAt, &session.Active, &parentID,
+			&startedAt, &endedAt, &exitCode); err != nil {
+			return nil, err
+		}
+		session.ParentID = parentID.String
+		session.setRun(startedAt, endedAt, exitCode)
+		if metadata.Valid {
+			if err := json.Unmarshal([]byte(metadata.String), &session.Metadata); err != nil {
+				return nil, errors.Wrapf(err, "could not parse metadata of session %s", session.ID)
+			}
+		}
+		ret = append(ret, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadSessionMetadata(ret); err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// ListSessions returns all the sessions along with their entry counts and time ranges.
+//
+// Sessions that were used in log entries without being created through the
+// SessionManager are listed as well.
+//
+// With filter options, only the matching sessions are returned.
+func (s *SessionManager) ListSessions(opts ...SessionFilterOption) ([]*SessionSummary, error) {
+	filter := &SessionFilter{}
+	for _, opt := range opts {
+		opt(filter)
+	}
+
+	ssb := sqlbuilder.Select(sessionColumns...).From("sessions")
+	if err := filter.apply(ssb); err != nil {
+		return nil, err
+	}
+	sessions, err := s.selectSessions(ssb)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := map[string]*SessionSummary{}
+	for _, session := range sessions {
+		summaries[session.ID] = &SessionSummary{Session: session}
+	}
+
+	sb := sqlbuilder.Select("session", "COUNT(*)", "MIN(date)", "MAX(date)").
+		From("log_entries").
+		GroupBy("session")
+	sb.Where(sb.IsNotNull("session"))
+	rows, err := s.db.Queryx(sb.String())
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var id string
+		var count int
+		var from, to interface{}
+		if err := rows.Scan(&id, &count, &from, &to); err != nil {
+			return nil, err
+		}
+
+		summary, ok := summaries[id]
+		if !ok {
+			if !filter.isEmpty() {
+				continue
+			}
+			summary = &SessionSummary{Session: &Session{ID: id}}
+			summaries[id] = summary
+		}
+		summary.EntryCount = count
+		if t, err := scanTime(from); err == nil {
+			summary.From = &t
+			if summary.CreatedAt.IsZero() {
+				summary.CreatedAt = t
+			}
+		}
+		if t, err := scanTime(to); err == nil {
+			summary.To = &t
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	ret := []*SessionSummary{}
+	for _, summary := range summaries {
+		ret = append(ret, summary)
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].CreatedAt.Equal(ret[j].CreatedAt) {
+			return ret[i].ID < ret[j].ID
+		}
+		return ret[i].CreatedAt.Before(ret[j].CreatedAt)
+	})
+
+	return ret, nil
+}
+
+// scanTime converts a timestamp returned by an aggregate function, which is a
+// time.Time on postgres but a string on sqlite.
+func scanTime(v interface{}) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case string:
+		return parseSQLiteTime(v)
+	case []byte:
+		return parseSQLiteTime(string(v))
+	default:
+		return time.Time{}, errors.Errorf("unsupported time value %v", v)
+	}
+}
+
+// parseSQLiteTime parses timestamps returned as strings by sqlite, for example
+// when using aggregate functions, which lose the column type.
+func parseSQLiteTime(s string) (time.Time, error) {
+	s = strings.TrimSuffix(s, "Z")
+	for _, format := range sqlite3.SQLiteTimestampFormats {
+		if t, err := time.ParseInLocation(format, s, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, errors.Errorf("could not parse time %q", s)
+}
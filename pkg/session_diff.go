@@ -0,0 +1,336 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultDiffTimings is the number of timing differences reported by
+// DiffSessions.
+const DefaultDiffTimings = 10
+
+// LevelCountDelta is the number of entries of a level in the sessions A and B
+// of a SessionDiff.
+type LevelCountDelta struct {
+	Level string `json:"level"`
+	A     int    `json:"a"`
+	B     int    `json:"b"`
+}
+
+// MessageCount is an error message along with the number of entries logging it.
+type MessageCount struct {
+	Message string `json:"message"`
+	Count   int    `json:"count"`
+}
+
+// TimingDelta compares the time a message was first logged in the sessions A
+// and B of a SessionDiff, relative to the start of each session.
+type TimingDelta struct {
+	Message string        `json:"message"`
+	A       time.Duration `json:"a"`
+	B       time.Duration `json:"b"`
+	// Delta is B - A, positive if the message was logged later in B.
+	Delta time.Duration `json:"delta"`
+}
+
+// MetadataDelta is a metadata key whose value differs between the sessions A
+// and B of a SessionDiff. A or B is nil if the session lacks the key.
+type MetadataDelta struct {
+	Key string      `json:"key"`
+	A   interface{} `json:"a"`
+	B   interface{} `json:"b"`
+}
+
+// SessionDiff compares two sessions, such as a passing and a failing CI run,
+// see DiffSessions.
+type SessionDiff struct {
+	A *Session `json:"a"`
+	B *Session `json:"b"`
+	// Levels counts the entries of each level logged in A or B, from the
+	// most to the least severe.
+	Levels []LevelCountDelta `json:"levels"`
+	// NewErrors are the messages of the entries at least at level error
+	// that were only logged in B, and ResolvedErrors those only logged in A.
+	NewErrors      []MessageCount `json:"new_errors"`
+	ResolvedErrors []MessageCount `json:"resolved_errors"`
+	// Timings are the messages logged in both sessions whose time relative
+	// to the start of the session differs the most.
+	Timings []TimingDelta `json:"timings"`
+	// Metadata lists the metadata keys whose values differ.
+	Metadata []MetadataDelta `json:"metadata"`
+}
+
+type sessionDiffOptions struct {
+	timings int
+}
+
+type SessionDiffOption func(*sessionDiffOptions)
+
+// WithDiffTimings sets the number of timing differences reported,
+// DefaultDiffTimings by default.
+func WithDiffTimings(n int) SessionDiffOption {
+	return func(o *sessionDiffOptions) {
+		o.timings = n
+	}
+}
+
+// sessionMessages holds the messages of a session along with the time they
+// were first logged.
+type sessionMessages struct {
+	session *Session
+	start   time.Time
+	first   map[string]time.Time
+	errors  map[string]int
+	levels  map[string]int
+}
+
+// DiffSessions compares the entries and metadata of the sessions a and b.
+// Sessions that only exist through their entries can be compared as well, in
+// which case they are considered started at their first entry.
+func (l *LogWriter) DiffSessions(ctx context.Context, a string, b string, opts ...SessionDiffOption) (*SessionDiff, error) {
+	o := &sessionDiffOptions{
+		timings: DefaultDiffTimings,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	ma, err := l.sessionMessages(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+	mb, err := l.sessionMessages(ctx, b)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &SessionDiff{
+		A:              ma.session,
+		B:              mb.session,
+		Levels:         []LevelCountDelta{},
+		NewErrors:      diffErrors(mb.errors, ma.errors),
+		ResolvedErrors: diffErrors(ma.errors, mb.errors),
+		Timings:        []TimingDelta{},
+		Metadata:       diffMetadata(ma.session, mb.session),
+	}
+
+	for level := range ma.levels {
+		ret.Levels = append(ret.Levels, LevelCountDelta{Level: level, A: ma.levels[level], B: mb.levels[level]})
+	}
+	for level := range mb.levels {
+		if _, ok := ma.levels[level]; !ok {
+			ret.Levels = append(ret.Levels, LevelCountDelta{Level: level, B: mb.levels[level]})
+		}
+	}
+	sort.Slice(ret.Levels, func(i, j int) bool {
+		si, sj := levelSeverity(ret.Levels[i].Level), levelSeverity(ret.Levels[j].Level)
+		if si != sj {
+			return si > sj
+		}
+		return ret.Levels[i].Level < ret.Levels[j].Level
+	})
+
+	for message, ta := range ma.first {
+		tb, ok := mb.first[message]
+		if !ok {
+			continue
+		}
+		da, db := ta.Sub(ma.start), tb.Sub(mb.start)
+		ret.Timings = append(ret.Timings, TimingDelta{Message: message, A: da, B: db, Delta: db - da})
+	}
+	sort.Slice(ret.Timings, func(i, j int) bool {
+		di, dj := abs(ret.Timings[i].Delta), abs(ret.Timings[j].Delta)
+		if di != dj {
+			return di > dj
+		}
+		return ret.Timings[i].Message < ret.Timings[j].Message
+	})
+	if o.timings >= 0 && len(ret.Timings) > o.timings {
+		ret.Timings = ret.Timings[:o.timings]
+	}
+
+	return ret, nil
+}
+
+// levelSeverity orders the zerolog levels, unknown levels being the least
+// severe.
+func levelSeverity(level string) int {
+	l, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil || l == zerolog.NoLevel {
+		return int(zerolog.TraceLevel) - 1
+	}
+	return int(l)
+}
+
+func abs(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// sessionMessages reads the level counts and messages of the session id, or
+// returns an UnknownSessionError if it has no entries and doesn't exist.
+func (l *LogWriter) sessionMessages(ctx context.Context, id string) (*sessionMessages, error) {
+	ret := &sessionMessages{
+		first:  map[string]time.Time{},
+		errors: map[string]int{},
+		levels: map[string]int{},
+	}
+
+	session, err := l.Sessions().GetSession(id)
+	var unknown *UnknownSessionError
+	switch {
+	case err == nil:
+		ret.session = session
+		if session.StartedAt != nil {
+			ret.start = *session.StartedAt
+		} else {
+			ret.start = session.CreatedAt
+		}
+	case errors.As(err, &unknown):
+		ret.session = &Session{ID: id}
+	default:
+		return nil, err
+	}
+
+	sb := sqlbuilder.Select("level", "COUNT(*)").From("log_entries").GroupBy("level")
+	sb.Where(sb.E("session", id))
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		var level string
+		var count int
+		if err := rows.Scan(&level, &count); err != nil {
+			return err
+		}
+		ret.levels[level] = count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(ret.levels) == 0 && ret.session.CreatedAt.IsZero() {
+		return nil, &UnknownSessionError{ID: id}
+	}
+
+	sb = sqlbuilder.Select("message", "MIN(date)").From("log_entries").GroupBy("message")
+	sb.Where(sb.E("session", id), sb.IsNotNull("message"))
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		var message string
+		var first interface{}
+		if err := rows.Scan(&message, &first); err != nil {
+			return err
+		}
+		t, err := scanTime(first)
+		if err != nil {
+			return err
+		}
+		ret.first[message] = t
+		if ret.session.CreatedAt.IsZero() && (ret.start.IsZero() || t.Before(ret.start)) {
+			ret.start = t
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sb = sqlbuilder.Select("message", "COUNT(*)").From("log_entries").GroupBy("message")
+	sb.Where(sb.E("session", id), sb.IsNotNull("message"), minLevelCondition(sb, "error"))
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		var message string
+		var count int
+		if err := rows.Scan(&message, &count); err != nil {
+			return err
+		}
+		ret.errors[message] = count
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// queryRows runs sb and calls fn for each row.
+func (l *LogWriter) queryRows(ctx context.Context, sb *sqlbuilder.SelectBuilder, fn func(rows *sqlx.Rows) error) error {
+	s, args := sb.Build()
+	rows, err := l.db.QueryxContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+	for rows.Next() {
+		if err := fn(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// diffErrors returns the messages of a that aren't in b, the most frequent first.
+func diffErrors(a map[string]int, b map[string]int) []MessageCount {
+	ret := []MessageCount{}
+	for message, count := range a {
+		if _, ok := b[message]; !ok {
+			ret = append(ret, MessageCount{Message: message, Count: count})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Count != ret[j].Count {
+			return ret[i].Count > ret[j].Count
+		}
+		return ret[i].Message < ret[j].Message
+	})
+	return ret
+}
+
+// diffMetadata compares the metadata and exit codes of a and b.
+func diffMetadata(a *Session, b *Session) []MetadataDelta {
+	ma, mb := sessionDiffMetadata(a), sessionDiffMetadata(b)
+	keys := map[string]bool{}
+	for k := range ma {
+		keys[k] = true
+	}
+	for k := range mb {
+		keys[k] = true
+	}
+
+	ret := []MetadataDelta{}
+	for k := range keys {
+		va, vb := ma[k], mb[k]
+		ja, _ := json.Marshal(va)
+		jb, _ := json.Marshal(vb)
+		if string(ja) != string(jb) {
+			ret = append(ret, MetadataDelta{Key: k, A: va, B: vb})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		return ret[i].Key < ret[j].Key
+	})
+	return ret
+}
+
+// sessionDiffMetadata returns the metadata of s, along with the exit code and
+// duration of its last run.
+func sessionDiffMetadata(s *Session) map[string]interface{} {
+	ret := map[string]interface{}{}
+	for k, v := range s.Metadata {
+		ret[k] = v
+	}
+	if s.ExitCode != nil {
+		ret["exit_code"] = *s.ExitCode
+	}
+	if s.Duration != nil {
+		ret["duration"] = s.Duration.Round(time.Millisecond).String()
+	}
+	return ret
+}
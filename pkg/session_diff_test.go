@@ -0,0 +1,67 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestDiffSessions(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	sm := lw.Sessions()
+
+	start := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+	for _, s := range []*Session{
+		{ID: "pass", CreatedAt: start, Metadata: map[string]interface{}{"git_sha": "abc", "host": "ci"}},
+		{ID: "fail", CreatedAt: start.Add(time.Hour), Metadata: map[string]interface{}{"git_sha": "def", "host": "ci"}},
+	} {
+		require.NoError(t, sm.insertSession(s))
+	}
+	require.NoError(t, sm.EndSession("pass", WithExitCode(0)))
+	require.NoError(t, sm.EndSession("fail", WithExitCode(1)))
+
+	write := func(session string, offset time.Duration, level string, message string) {
+		_, err := lw.Write([]byte(`{"session": "` + session + `", "time": "` + start.Add(offset).Format(time.RFC3339Nano) +
+			`", "level": "` + level + `", "message": "` + message + `"}`))
+		require.NoError(t, err)
+	}
+	write("pass", time.Second, "info", "connected")
+	write("pass", 2*time.Second, "error", "flaky")
+	write("pass", 3*time.Second, "info", "done")
+	write("fail", time.Hour+time.Second, "info", "connected")
+	write("fail", time.Hour+5*time.Second, "error", "db down")
+	write("fail", time.Hour+6*time.Second, "error", "db down")
+	write("fail", time.Hour+9*time.Second, "info", "done")
+	write("fail", time.Hour+9*time.Second, "warn", "slow")
+
+	diff, err := lw.DiffSessions(context.Background(), "pass", "fail", WithDiffTimings(1))
+	require.NoError(t, err)
+	assert.Equal(t, []LevelCountDelta{
+		{Level: "error", A: 1, B: 2},
+		{Level: "warn", A: 0, B: 1},
+		{Level: "info", A: 2, B: 2},
+	}, diff.Levels)
+	assert.Equal(t, []MessageCount{{Message: "db down", Count: 2}}, diff.NewErrors)
+	assert.Equal(t, []MessageCount{{Message: "flaky", Count: 1}}, diff.ResolvedErrors)
+	assert.Equal(t, []TimingDelta{
+		{Message: "done", A: 3 * time.Second, B: 9 * time.Second, Delta: 6 * time.Second},
+	}, diff.Timings)
+
+	keys := []string{}
+	for _, m := range diff.Metadata {
+		keys = append(keys, m.Key)
+	}
+	assert.Contains(t, keys, "git_sha")
+	assert.Contains(t, keys, "exit_code")
+	assert.NotContains(t, keys, "host")
+
+	_, err = lw.DiffSessions(context.Background(), "pass", "missing")
+	assert.IsType(t, &UnknownSessionError{}, err)
+}
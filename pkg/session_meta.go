@@ -0,0 +1,254 @@
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"sort"
+)
+
+// The metadata and tags of sessions are stored in the session_metadata and
+// session_tags tables, so that sessions can be looked up by them, for
+// example the runs of a given git commit. Metadata values are stored as JSON.
+//
+// Older databases stored the metadata as a JSON object in the metadata column
+// of sessions, which is still read.
+
+type SessionOption func(*Session)
+
+// WithSessionTags tags the session created by NewSession.
+func WithSessionTags(tags ...string) SessionOption {
+	return func(s *Session) {
+		s.Tags = append(s.Tags, tags...)
+	}
+}
+
+// SessionFilter restricts the sessions returned by ListSessions.
+type SessionFilter struct {
+	// Tags matches the sessions having all of these tags.
+	Tags []string
+	// Metadata matches the sessions having all of these metadata values.
+	Metadata map[string]interface{}
+	// Failed matches the sessions whose last run failed, see WithSessionFilterFailed.
+	Failed bool
+}
+
+type SessionFilterOption func(*SessionFilter)
+
+func WithSessionFilterTags(tags ...string) SessionFilterOption {
+	return func(f *SessionFilter) {
+		f.Tags = append(f.Tags, tags...)
+	}
+}
+
+func WithSessionFilterMetadata(key string, value interface{}) SessionFilterOption {
+	return func(f *SessionFilter) {
+		if f.Metadata == nil {
+			f.Metadata = map[string]interface{}{}
+		}
+		f.Metadata[key] = value
+	}
+}
+
+func (f *SessionFilter) isEmpty() bool {
+	return len(f.Tags) == 0 && len(f.Metadata) == 0 && !f.Failed
+}
+
+func (f *SessionFilter) apply(sb *sqlbuilder.SelectBuilder) error {
+	for _, tag := range f.Tags {
+		tsb := sqlbuilder.Select("session_id").From("session_tags")
+		tsb.Where(tsb.E("tag", tag))
+		sb.Where(sb.In("id", tsb))
+	}
+	for k, v := range f.Metadata {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		msb := sqlbuilder.Select("session_id").From("session_metadata")
+		msb.Where(msb.E("key", k), msb.E("value", string(b)))
+		sb.Where(sb.In("id", msb))
+	}
+	if f.Failed {
+		sb.Where(sb.NE("exit_code", 0))
+	}
+	return nil
+}
+
+func (s *SessionManager) createSessionMetadataTables(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("session_metadata").
+		IfNotExists().
+		Define("session_id", "VARCHAR(255)", "NOT NULL").
+		Define("key", "VARCHAR(255)", "NOT NULL").
+		Define("value", "TEXT", "NOT NULL").
+		Define("PRIMARY KEY (session_id, key)")
+	if _, err := s.db.ExecContext(ctx, ctb.String()); err != nil {
+		return err
+	}
+
+	ctb = sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("session_tags").
+		IfNotExists().
+		Define("session_id", "VARCHAR(255)", "NOT NULL").
+		Define("tag", "VARCHAR(255)", "NOT NULL").
+		Define("PRIMARY KEY (session_id, tag)")
+	_, err := s.db.ExecContext(ctx, ctb.String())
+	return err
+}
+
+// migrateSessionMetadata copies the metadata stored in the metadata column of
+// sessions to session_metadata.
+func (s *SessionManager) migrateSessionMetadata(ctx context.Context) error {
+	sb := sqlbuilder.Select("id", "metadata").From("sessions")
+	sb.Where(sb.IsNotNull("metadata"))
+	rows := []struct {
+		ID       string `db:"id"`
+		Metadata string `db:"metadata"`
+	}{}
+	if err := s.db.SelectContext(ctx, &rows, sb.String()); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		metadata := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(row.Metadata), &metadata); err != nil {
+			return errors.Wrapf(err, "could not parse metadata of session %s", row.ID)
+		}
+		if err := upsertSessionMetadata(ctx, s.db, row.ID, metadata, "ON CONFLICT (session_id, key) DO NOTHING"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func upsertSessionMetadata(ctx context.Context, db sqlx.ExtContext, id string, metadata map[string]interface{}, onConflict string) error {
+	if len(metadata) == 0 {
+		return nil
+	}
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("session_metadata").Cols("session_id", "key", "value")
+	for k, v := range metadata {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		ib.Values(id, k, string(b))
+	}
+	ib.SQL(onConflict)
+	s, args := ib.Build()
+	_, err := db.ExecContext(ctx, db.Rebind(s), args...)
+	return err
+}
+
+func insertSessionTags(ctx context.Context, db sqlx.ExtContext, id string, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("session_tags").Cols("session_id", "tag")
+	for _, tag := range tags {
+		ib.Values(id, tag)
+	}
+	ib.SQL("ON CONFLICT (session_id, tag) DO NOTHING")
+	s, args := ib.Build()
+	_, err := db.ExecContext(ctx, db.Rebind(s), args...)
+	return err
+}
+
+// SetMetadata sets metadata values of the session with the given id,
+// replacing existing values for the same keys.
+func (s *SessionManager) SetMetadata(id string, metadata map[string]interface{}) error {
+	if _, err := s.GetSession(id); err != nil {
+		return err
+	}
+	return upsertSessionMetadata(context.Background(), s.db, id, metadata,
+		"ON CONFLICT (session_id, key) DO UPDATE SET value = excluded.value")
+}
+
+// AddTags tags the session with the given id.
+func (s *SessionManager) AddTags(id string, tags ...string) error {
+	if _, err := s.GetSession(id); err != nil {
+		return err
+	}
+	return insertSessionTags(context.Background(), s.db, id, tags)
+}
+
+// RemoveTags removes tags from the session with the given id.
+func (s *SessionManager) RemoveTags(id string, tags ...string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	values := []interface{}{}
+	for _, tag := range tags {
+		values = append(values, tag)
+	}
+	db := sqlbuilder.NewDeleteBuilder()
+	db.DeleteFrom("session_tags").Where(db.E("session_id", id), db.In("tag", values...))
+	s_, args := db.Build()
+	_, err := s.db.Exec(s.db.Rebind(s_), args...)
+	return err
+}
+
+// loadSessionMetadata reads the metadata and tags of sessions from their tables.
+func (s *SessionManager) loadSessionMetadata(sessions []*Session) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+	byID := map[string]*Session{}
+	ids := []interface{}{}
+	for _, session := range sessions {
+		byID[session.ID] = session
+		ids = append(ids, session.ID)
+	}
+
+	sb := sqlbuilder.Select("session_id", "key", "value").From("session_metadata")
+	sb.Where(sb.In("session_id", ids...))
+	s_, args := sb.Build()
+	metadata := []struct {
+		SessionID string `db:"session_id"`
+		Key       string `db:"key"`
+		Value     string `db:"value"`
+	}{}
+	if err := s.db.Select(&metadata, s.db.Rebind(s_), args...); err != nil {
+		return err
+	}
+	for _, row := range metadata {
+		var v interface{}
+		if err := json.Unmarshal([]byte(row.Value), &v); err != nil {
+			return errors.Wrapf(err, "could not parse metadata %s of session %s", row.Key, row.SessionID)
+		}
+		session := byID[row.SessionID]
+		if session.Metadata == nil {
+			session.Metadata = map[string]interface{}{}
+		}
+		session.Metadata[row.Key] = v
+	}
+
+	sb = sqlbuilder.Select("session_id", "tag").From("session_tags")
+	sb.Where(sb.In("session_id", ids...))
+	s_, args = sb.Build()
+	rows, err := s.db.Queryx(s.db.Rebind(s_), args...)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+	for rows.Next() {
+		var id, tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			return err
+		}
+		byID[id].Tags = append(byID[id].Tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		sort.Strings(session.Tags)
+	}
+	return nil
+}
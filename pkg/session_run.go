@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// The last run of a session is recorded in the started_at, ended_at and
+// exit_code columns of sessions. Sessions start when they are created, and
+// are restarted by StartSession. Run and Pipe start and end the sessions they
+// write to.
+
+type sessionEnd struct {
+	exitCode *int
+}
+
+type SessionEndOption func(*sessionEnd)
+
+// WithExitCode records the exit code of the run, which is unknown otherwise.
+func WithExitCode(code int) SessionEndOption {
+	return func(e *sessionEnd) {
+		e.exitCode = &code
+	}
+}
+
+// WithSessionFilterFailed only lists the sessions whose last run ended with a
+// non-zero exit code.
+func WithSessionFilterFailed() SessionFilterOption {
+	return func(f *SessionFilter) {
+		f.Failed = true
+	}
+}
+
+// setRun sets the run fields of s from the sessions columns.
+func (s *Session) setRun(startedAt sql.NullTime, endedAt sql.NullTime, exitCode sql.NullInt64) {
+	if startedAt.Valid {
+		t := startedAt.Time.UTC()
+		s.StartedAt = &t
+	}
+	if endedAt.Valid {
+		t := endedAt.Time.UTC()
+		s.EndedAt = &t
+	}
+	if exitCode.Valid {
+		code := int(exitCode.Int64)
+		s.ExitCode = &code
+	}
+	if s.StartedAt != nil && s.EndedAt != nil {
+		d := s.EndedAt.Sub(*s.StartedAt)
+		s.Duration = &d
+	}
+}
+
+// Failed returns true if the last run of the session ended with a non-zero
+// exit code.
+func (s *Session) Failed() bool {
+	return s.ExitCode != nil && *s.ExitCode != 0
+}
+
+// End records that the run of the session ended now, see EndSession, and
+// reloads the session. The session has to be returned by the SessionManager.
+func (s *Session) End(opts ...SessionEndOption) error {
+	if s.manager == nil {
+		return errors.Errorf("session %s isn't bound to a database", s.ID)
+	}
+	if err := s.manager.EndSession(s.ID, opts...); err != nil {
+		return err
+	}
+	updated, err := s.manager.GetSession(s.ID)
+	if err != nil {
+		return err
+	}
+	*s = *updated
+	return nil
+}
+
+// StartSession records that a new run of the session id starts now, clearing
+// the end and exit code of the previous run.
+func (s *SessionManager) StartSession(id string) error {
+	ub := sqlbuilder.Update("sessions")
+	ub.Set(
+		ub.Assign("started_at", time.Now().UTC()),
+		ub.Assign("ended_at", nil),
+		ub.Assign("exit_code", nil),
+	).Where(ub.E("id", id))
+	return s.updateSession(context.Background(), id, ub)
+}
+
+// EndSession records that the run of the session id ended now, along with its
+// exit code if given with WithExitCode.
+func (s *SessionManager) EndSession(id string, opts ...SessionEndOption) error {
+	e := &sessionEnd{}
+	for _, opt := range opts {
+		opt(e)
+	}
+	var exitCode sql.NullInt64
+	if e.exitCode != nil {
+		exitCode = sql.NullInt64{Int64: int64(*e.exitCode), Valid: true}
+	}
+
+	ub := sqlbuilder.Update("sessions")
+	ub.Set(
+		ub.Assign("ended_at", time.Now().UTC()),
+		ub.Assign("exit_code", exitCode),
+	).Where(ub.E("id", id))
+	return s.updateSession(context.Background(), id, ub)
+}
+
+// updateSession runs ub, returning an UnknownSessionError if it didn't
+// update the session id.
+func (s *SessionManager) updateSession(ctx context.Context, id string, ub *sqlbuilder.UpdateBuilder) error {
+	s_, args := ub.Build()
+	res, err := s.db.ExecContext(ctx, s.db.Rebind(s_), args...)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return &UnknownSessionError{ID: id}
+	}
+	return nil
+}
+
+// StartSession starts a new run of the session entries are written to,
+// creating the session if needed, see SessionManager.StartSession. It does
+// nothing if entries aren't written to a session.
+func (l *LogWriter) StartSession() error {
+	if l.session == "" {
+		return nil
+	}
+	sm := l.Sessions()
+	if err := sm.ensureSession(&Session{ID: l.session, CreatedAt: time.Now().UTC()}); err != nil {
+		return err
+	}
+	return sm.StartSession(l.session)
+}
+
+// EndSession ends the run of the session entries are written to, see
+// SessionManager.EndSession. It does nothing if entries aren't written to a
+// session.
+func (l *LogWriter) EndSession(opts ...SessionEndOption) error {
+	if l.session == "" {
+		return nil
+	}
+	sm := l.Sessions()
+	if err := sm.ensureSession(&Session{ID: l.session, CreatedAt: time.Now().UTC()}); err != nil {
+		return err
+	}
+	return sm.EndSession(l.session, opts...)
+}
@@ -0,0 +1,144 @@
+package pkg
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"github.com/pkg/errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// SessionStrategy decides the session InitLogging stores entries under,
+// unless LoggerConfig.Session is set.
+type SessionStrategy string
+
+const (
+	// SessionStrategyActive continues the active session of the database, if any.
+	SessionStrategyActive SessionStrategy = "active"
+	// SessionStrategyULID starts a new session per process, identified by a ULID.
+	SessionStrategyULID SessionStrategy = "ulid"
+	// SessionStrategyEnv uses the session named by an environment variable,
+	// PLUNGER_SESSION by default, so that a parent process can share its
+	// session with the programs it runs. Entries have no session if the
+	// variable is not set.
+	SessionStrategyEnv SessionStrategy = "env"
+	// SessionStrategyHostPID starts a new session per process, identified by
+	// the hostname and the process id.
+	SessionStrategyHostPID SessionStrategy = "host-pid"
+	// SessionStrategyNone doesn't set a session.
+	SessionStrategyNone SessionStrategy = "none"
+)
+
+// DefaultSessionEnvVar is the environment variable read by SessionStrategyEnv.
+const DefaultSessionEnvVar = "PLUNGER_SESSION"
+
+type InvalidSessionStrategyError struct {
+	Strategy string
+}
+
+func (e *InvalidSessionStrategyError) Error() string {
+	return "invalid session strategy " + e.Strategy + " (expected active, ulid, env, host-pid or none)"
+}
+
+func ParseSessionStrategy(s string) (SessionStrategy, error) {
+	switch SessionStrategy(s) {
+	case "":
+		return SessionStrategyActive, nil
+	case SessionStrategyActive, SessionStrategyULID, SessionStrategyEnv, SessionStrategyHostPID, SessionStrategyNone:
+		return SessionStrategy(s), nil
+	}
+	return "", &InvalidSessionStrategyError{Strategy: s}
+}
+
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// NewULID returns a ULID for t: 26 characters that sort by time, followed by
+// 80 random bits.
+func NewULID(t time.Time) (string, error) {
+	var b [16]byte
+	ms := uint64(t.UnixMilli())
+	for i := 0; i < 6; i++ {
+		b[i] = byte(ms >> (40 - 8*i))
+	}
+	if _, err := rand.Read(b[6:]); err != nil {
+		return "", err
+	}
+
+	// encode the 128 bits 5 at a time, from the least significant ones
+	hi := binary.BigEndian.Uint64(b[:8])
+	lo := binary.BigEndian.Uint64(b[8:])
+	ret := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		ret[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(ret), nil
+}
+
+// processMetadata describes the current process, for the sessions it starts.
+func processMetadata() map[string]interface{} {
+	ret := map[string]interface{}{
+		"pid":          os.Getpid(),
+		"command_line": strings.Join(os.Args, " "),
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		ret["hostname"] = hostname
+	}
+	return ret
+}
+
+// resolveSession returns the session entries are stored under according to
+// the strategy, creating it in the database if needed.
+func resolveSession(sm *SessionManager, strategy SessionStrategy, envVar string) (string, error) {
+	switch strategy {
+	case SessionStrategyActive, "":
+		active, err := sm.GetActive()
+		if err != nil || active == nil {
+			return "", err
+		}
+		return active.ID, nil
+
+	case SessionStrategyNone:
+		return "", nil
+
+	case SessionStrategyEnv:
+		if envVar == "" {
+			envVar = DefaultSessionEnvVar
+		}
+		id := os.Getenv(envVar)
+		if id == "" {
+			return "", nil
+		}
+		return id, sm.ensureSession(&Session{ID: id, CreatedAt: time.Now().UTC()})
+
+	case SessionStrategyULID, SessionStrategyHostPID:
+		now := time.Now().UTC()
+		id := ""
+		if strategy == SessionStrategyULID {
+			var err error
+			id, err = NewULID(now)
+			if err != nil {
+				return "", err
+			}
+		} else {
+			hostname, err := os.Hostname()
+			if err != nil {
+				return "", errors.Wrap(err, "could not get the hostname")
+			}
+			id = fmt.Sprintf("%s-%d", hostname, os.Getpid())
+		}
+		session := &Session{
+			ID:        id,
+			Name:      filepath.Base(os.Args[0]),
+			Metadata:  processMetadata(),
+			CreatedAt: now,
+		}
+		return id, sm.ensureSession(session)
+	}
+
+	return "", &InvalidSessionStrategyError{Strategy: string(strategy)}
+}
@@ -0,0 +1,312 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSessionManager(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+	db := sqlx.MustOpen("sqlite3", dbFile)
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+
+	lw := NewLogWriter(db, NewSchema())
+	err := lw.Init()
+	require.NoError(t, err)
+
+	sm := lw.Sessions()
+
+	active, err := sm.GetActive()
+	require.NoError(t, err)
+	assert.Nil(t, active)
+
+	s1, err := sm.NewSession("first", map[string]interface{}{"host": "foo"})
+	require.NoError(t, err)
+	s2, err := sm.NewSession("second", nil)
+	require.NoError(t, err)
+	assert.NotEqual(t, s1.ID, s2.ID)
+
+	err = sm.SetActive("unknown")
+	assert.IsType(t, &UnknownSessionError{}, err)
+
+	err = sm.SetActive(s1.ID)
+	require.NoError(t, err)
+	err = sm.SetActive(s2.ID)
+	require.NoError(t, err)
+
+	active, err = sm.GetActive()
+	require.NoError(t, err)
+	require.NotNil(t, active)
+	assert.Equal(t, s2.ID, active.ID)
+	assert.Equal(t, "second", active.Name)
+
+	s, err := sm.GetSession(s1.ID)
+	require.NoError(t, err)
+	assert.False(t, s.Active)
+	assert.Equal(t, "foo", s.Metadata["host"])
+
+	lw2, _, err := InitLogging(&LoggerConfig{DBFile: dbFile, Schema: NewSchema()})
+	require.NoError(t, err)
+	defer func(lw2 *LogWriter) {
+		_ = lw2.Close()
+	}(lw2)
+
+	_, err = lw2.Write([]byte(`{"level": "info", "message": "continued"}`))
+	require.NoError(t, err)
+	_, err = lw2.Write([]byte(`{"level": "info", "session": "adhoc", "message": "adhoc"}`))
+	require.NoError(t, err)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithSession(s2.ID)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "continued", *entries[0].Message)
+
+	summaries, err := sm.ListSessions()
+	require.NoError(t, err)
+	require.Len(t, summaries, 3)
+	counts := map[string]int{}
+	for _, summary := range summaries {
+		counts[summary.ID] = summary.EntryCount
+	}
+	assert.Equal(t, 0, counts[s1.ID])
+	assert.Equal(t, 1, counts[s2.ID])
+	assert.Equal(t, 1, counts["adhoc"])
+	assert.NotNil(t, summaries[2].From)
+}
+
+func TestSessionTree(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	sm := lw.Sessions()
+
+	suite, err := sm.NewSession("suite", nil)
+	require.NoError(t, err)
+	case1, err := sm.NewChildSession(suite.ID, "case 1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, suite.ID, case1.ParentID)
+	step, err := sm.NewChildSession(case1.ID, "step", nil)
+	require.NoError(t, err)
+	other, err := sm.NewSession("other", nil)
+	require.NoError(t, err)
+
+	_, err = sm.NewChildSession("unknown", "orphan", nil)
+	assert.IsType(t, &UnknownSessionError{}, err)
+
+	tree, err := sm.GetSessionTree(suite.ID)
+	require.NoError(t, err)
+	ids := []string{}
+	for _, session := range tree {
+		ids = append(ids, session.ID)
+	}
+	assert.Equal(t, suite.ID, ids[0])
+	assert.ElementsMatch(t, []string{suite.ID, case1.ID, step.ID}, ids)
+
+	loaded, err := sm.GetSession(step.ID)
+	require.NoError(t, err)
+	assert.Equal(t, case1.ID, loaded.ParentID)
+
+	for _, session := range []*Session{suite, case1, step, other} {
+		_, err := lw.Write([]byte(`{"level": "info", "session": "` + session.ID + `", "message": "` + session.Name + `"}`))
+		require.NoError(t, err)
+	}
+
+	messages := func(filter *GetEntriesFilter) []string {
+		entries, err := lw.GetEntries(filter)
+		require.NoError(t, err)
+		ret := []string{}
+		for _, entry := range entries {
+			ret = append(ret, *entry.Message)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"suite", "case 1", "step"}, messages(NewGetEntriesFilter(WithSessionTree(suite.ID))))
+	assert.Equal(t, []string{"case 1", "step"}, messages(NewGetEntriesFilter(WithSessionTree(case1.ID))))
+	assert.Equal(t, []string{"other"}, messages(NewGetEntriesFilter(WithSessionTree(other.ID))))
+}
+
+func TestSessionMetadataAndTags(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	sm := lw.Sessions()
+
+	ci, err := sm.NewSession("ci", map[string]interface{}{"git_sha": "abc123", "attempt": 1}, WithSessionTags("ci", "nightly"))
+	require.NoError(t, err)
+	local, err := sm.NewSession("local", map[string]interface{}{"git_sha": "abc123"})
+	require.NoError(t, err)
+	_, err = sm.NewSession("other", map[string]interface{}{"git_sha": "def456"}, WithSessionTags("ci"))
+	require.NoError(t, err)
+
+	loaded, err := sm.GetSession(ci.ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ci", "nightly"}, loaded.Tags)
+	assert.Equal(t, map[string]interface{}{"git_sha": "abc123", "attempt": float64(1)}, loaded.Metadata)
+
+	names := func(opts ...SessionFilterOption) []string {
+		summaries, err := sm.ListSessions(opts...)
+		require.NoError(t, err)
+		ret := []string{}
+		for _, summary := range summaries {
+			ret = append(ret, summary.Name)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"ci", "other"}, names(WithSessionFilterTags("ci")))
+	assert.Equal(t, []string{"ci", "local"}, names(WithSessionFilterMetadata("git_sha", "abc123")))
+	assert.Equal(t, []string{"ci"}, names(WithSessionFilterTags("ci"), WithSessionFilterMetadata("git_sha", "abc123")))
+	assert.Equal(t, []string{"ci"}, names(WithSessionFilterMetadata("attempt", 1)))
+	assert.Empty(t, names(WithSessionFilterTags("unknown")))
+
+	require.NoError(t, sm.AddTags(local.ID, "ci"))
+	require.NoError(t, sm.RemoveTags(ci.ID, "ci"))
+	require.NoError(t, sm.SetMetadata(local.ID, map[string]interface{}{"git_sha": "fff000", "host": "laptop"}))
+	assert.Equal(t, []string{"local", "other"}, names(WithSessionFilterTags("ci")))
+	assert.Equal(t, []string{"local"}, names(WithSessionFilterMetadata("git_sha", "fff000")))
+
+	err = sm.AddTags("unknown", "ci")
+	assert.IsType(t, &UnknownSessionError{}, err)
+}
+
+func TestSessionMetadataMigration(t *testing.T) {
+	dbFile := filepath.Join(t.TempDir(), "test.db")
+	lw, err := OpenLogWriter(dbFile, nil)
+	require.NoError(t, err)
+
+	// sessions created by older versions kept their metadata in the sessions table
+	_, err = lw.db.Exec(`INSERT INTO sessions (id, name, metadata, created_at) VALUES ('old', 'old', '{"host": "foo"}', CURRENT_TIMESTAMP)`)
+	require.NoError(t, err)
+	_, err = lw.db.Exec(`DELETE FROM schema_version WHERE version >= 9`)
+	require.NoError(t, err)
+	require.NoError(t, lw.Close())
+
+	lw, err = OpenLogWriter(dbFile, nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	summaries, err := lw.Sessions().ListSessions(WithSessionFilterMetadata("host", "foo"))
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, map[string]interface{}{"host": "foo"}, summaries[0].Metadata)
+}
+
+func TestSessionStrategies(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	sm := lw.Sessions()
+
+	id, err := resolveSession(sm, SessionStrategyActive, "")
+	require.NoError(t, err)
+	assert.Equal(t, "", id)
+	active, err := sm.NewSession("active", nil)
+	require.NoError(t, err)
+	require.NoError(t, sm.SetActive(active.ID))
+	id, err = resolveSession(sm, SessionStrategyActive, "")
+	require.NoError(t, err)
+	assert.Equal(t, active.ID, id)
+
+	id, err = resolveSession(sm, SessionStrategyNone, "")
+	require.NoError(t, err)
+	assert.Equal(t, "", id)
+
+	first, err := resolveSession(sm, SessionStrategyULID, "")
+	require.NoError(t, err)
+	second, err := resolveSession(sm, SessionStrategyULID, "")
+	require.NoError(t, err)
+	assert.Len(t, first, 26)
+	assert.NotEqual(t, first, second)
+	session, err := sm.GetSession(first)
+	require.NoError(t, err)
+	assert.Contains(t, session.Metadata, "command_line")
+
+	id, err = resolveSession(sm, SessionStrategyHostPID, "")
+	require.NoError(t, err)
+	assert.Regexp(t, `-\d+$`, id)
+	// the same process continues its session
+	again, err := resolveSession(sm, SessionStrategyHostPID, "")
+	require.NoError(t, err)
+	assert.Equal(t, id, again)
+
+	t.Setenv("TEST_SESSION", "")
+	id, err = resolveSession(sm, SessionStrategyEnv, "TEST_SESSION")
+	require.NoError(t, err)
+	assert.Equal(t, "", id)
+	t.Setenv("TEST_SESSION", "from-env")
+	id, err = resolveSession(sm, SessionStrategyEnv, "TEST_SESSION")
+	require.NoError(t, err)
+	assert.Equal(t, "from-env", id)
+	_, err = sm.GetSession("from-env")
+	assert.NoError(t, err)
+
+	_, err = resolveSession(sm, "unknown", "")
+	assert.IsType(t, &InvalidSessionStrategyError{}, err)
+}
+
+func TestNewULID(t *testing.T) {
+	at := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	a, err := NewULID(at)
+	require.NoError(t, err)
+	b, err := NewULID(at.Add(time.Millisecond))
+	require.NoError(t, err)
+	assert.Regexp(t, `^[0-9A-HJKMNP-TV-Z]{26}$`, a)
+	// the first 10 characters encode the time
+	assert.Equal(t, "01HWRQ6W00", a[:10])
+	assert.Less(t, a[:10], b[:10])
+}
+
+func TestSessionRun(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	sm := lw.Sessions()
+
+	build, err := sm.NewSession("build", nil)
+	require.NoError(t, err)
+	require.NotNil(t, build.StartedAt)
+	assert.Nil(t, build.EndedAt)
+	require.NoError(t, build.End(WithExitCode(2)))
+	require.NotNil(t, build.ExitCode)
+	assert.Equal(t, 2, *build.ExitCode)
+	require.NotNil(t, build.Duration)
+	assert.Equal(t, build.EndedAt.Sub(*build.StartedAt), *build.Duration)
+
+	test, err := sm.NewSession("test", nil)
+	require.NoError(t, err)
+	require.NoError(t, sm.EndSession(test.ID, WithExitCode(0)))
+	_, err = sm.NewSession("running", nil)
+	require.NoError(t, err)
+
+	summaries, err := sm.ListSessions(WithSessionFilterFailed())
+	require.NoError(t, err)
+	require.Len(t, summaries, 1)
+	assert.Equal(t, "build", summaries[0].Name)
+
+	// restarting clears the end of the previous run
+	require.NoError(t, sm.StartSession(build.ID))
+	build, err = sm.GetSession(build.ID)
+	require.NoError(t, err)
+	assert.Nil(t, build.EndedAt)
+	assert.Nil(t, build.ExitCode)
+	assert.False(t, build.Failed())
+
+	assert.IsType(t, &UnknownSessionError{}, sm.EndSession("missing"))
+	assert.Error(t, (&Session{ID: "unbound"}).End())
+}
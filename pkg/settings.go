@@ -0,0 +1,137 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"strings"
+	"time"
+)
+
+// LevelSettingKey is the setting holding the global level of the loggers
+// watching the database, see SetLevel and WatchLevel.
+const LevelSettingKey = "level"
+
+// DefaultLevelPollInterval is the interval at which InitLogging reads the
+// level setting when LoggerConfig.WatchLevel is set.
+const DefaultLevelPollInterval = 5 * time.Second
+
+func (l *LogWriter) createSettingsTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("settings").
+		IfNotExists().
+		Define("key", "VARCHAR(255)", "PRIMARY KEY").
+		Define("value", "TEXT", "NOT NULL").
+		Define("updated_at", "TIMESTAMP", "NOT NULL")
+	_, err := l.db.ExecContext(ctx, ctb.String())
+	return err
+}
+
+// SetSetting stores value under key, replacing the previous value if any.
+func (l *LogWriter) SetSetting(ctx context.Context, key string, value string) error {
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("settings").
+		Cols("key", "value", "updated_at").
+		Values(key, value, time.Now().UTC()).
+		SQL("ON CONFLICT (key) DO UPDATE SET value = excluded.value, updated_at = excluded.updated_at")
+	return l.exec(ctx, ib)
+}
+
+// GetSetting returns the value stored under key, and false if there is none.
+func (l *LogWriter) GetSetting(ctx context.Context, key string) (string, bool, error) {
+	sb := sqlbuilder.Select("value").From("settings")
+	sb.Where(sb.E("key", key))
+	s, args := sb.Build()
+	var value string
+	err := l.db.GetContext(ctx, &value, l.db.Rebind(s), args...)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return value, true, nil
+}
+
+// DeleteSetting removes the value stored under key.
+func (l *LogWriter) DeleteSetting(ctx context.Context, key string) error {
+	db := sqlbuilder.NewDeleteBuilder()
+	db.DeleteFrom("settings").Where(db.E("key", key))
+	return l.exec(ctx, db)
+}
+
+type InvalidLevelError struct {
+	Level string
+}
+
+func (e *InvalidLevelError) Error() string {
+	return "invalid level " + e.Level
+}
+
+func parseGlobalLevel(level string) (zerolog.Level, error) {
+	ret, err := zerolog.ParseLevel(strings.ToLower(level))
+	if err != nil || ret == zerolog.NoLevel {
+		return zerolog.NoLevel, &InvalidLevelError{Level: level}
+	}
+	return ret, nil
+}
+
+// SetLevel changes the global level of the loggers watching the database,
+// without restarting them.
+func (l *LogWriter) SetLevel(ctx context.Context, level string) error {
+	parsed, err := parseGlobalLevel(level)
+	if err != nil {
+		return err
+	}
+	return l.SetSetting(ctx, LevelSettingKey, parsed.String())
+}
+
+// GetLevel returns the level set by SetLevel, empty if there is none.
+func (l *LogWriter) GetLevel(ctx context.Context) (string, error) {
+	level, _, err := l.GetSetting(ctx, LevelSettingKey)
+	return level, err
+}
+
+// ClearLevel removes the level set by SetLevel, so that the loggers watching
+// the database go back to the level they were started with.
+func (l *LogWriter) ClearLevel(ctx context.Context) error {
+	return l.DeleteSetting(ctx, LevelSettingKey)
+}
+
+// WatchLevel reads the level setting every interval until ctx is done, and
+// applies it with zerolog.SetGlobalLevel. The level at the time WatchLevel is
+// called is restored when the setting is cleared.
+func (l *LogWriter) WatchLevel(ctx context.Context, interval time.Duration, onError func(error)) {
+	initial := zerolog.GlobalLevel()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := l.applyLevel(ctx, initial); err != nil && onError != nil && ctx.Err() == nil {
+			onError(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (l *LogWriter) applyLevel(ctx context.Context, initial zerolog.Level) error {
+	s, ok, err := l.GetSetting(ctx, LevelSettingKey)
+	if err != nil {
+		return err
+	}
+	level := initial
+	if ok {
+		if level, err = parseGlobalLevel(s); err != nil {
+			return err
+		}
+	}
+	if zerolog.GlobalLevel() != level {
+		zerolog.SetGlobalLevel(level)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package pkg
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSettings(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	ctx := context.Background()
+
+	_, ok, err := lw.GetSetting(ctx, "theme")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, lw.SetSetting(ctx, "theme", "dark"))
+	require.NoError(t, lw.SetSetting(ctx, "theme", "light"))
+	value, ok, err := lw.GetSetting(ctx, "theme")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "light", value)
+
+	require.NoError(t, lw.DeleteSetting(ctx, "theme"))
+	_, ok, err = lw.GetSetting(ctx, "theme")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	err = lw.SetLevel(ctx, "loud")
+	assert.IsType(t, &InvalidLevelError{}, err)
+	require.NoError(t, lw.SetLevel(ctx, "WARN"))
+	level, err := lw.GetLevel(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, "warn", level)
+}
+
+func TestWatchLevel(t *testing.T) {
+	defer zerolog.SetGlobalLevel(zerolog.GlobalLevel())
+	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+
+	lw, _, err := InitLogging(&LoggerConfig{
+		DBFile:            filepath.Join(t.TempDir(), "test.db"),
+		WatchLevel:        true,
+		LevelPollInterval: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+	ctx := context.Background()
+
+	require.NoError(t, lw.SetLevel(ctx, "debug"))
+	assert.Eventually(t, func() bool {
+		return zerolog.GlobalLevel() == zerolog.DebugLevel
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, lw.ClearLevel(ctx))
+	assert.Eventually(t, func() bool {
+		return zerolog.GlobalLevel() == zerolog.InfoLevel
+	}, time.Second, 10*time.Millisecond)
+}
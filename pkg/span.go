@@ -0,0 +1,387 @@
+package pkg
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/rs/zerolog"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Spans are timed sections of a program, such as loading its configuration,
+// recorded in the spans table from the entries that start and end them. An
+// entry with a span_start field starts the span it names, and an entry with a
+// span_end field ends the last open span of that name in its session. The
+// span_ref field ties the start and end of a span together when spans of the
+// same name overlap, and span_parent nests a span in the span it references.
+// Spans started without span_ref are nested in the last open span of their
+// session.
+//
+// The duration of a span is the span_duration field of its end entry, in
+// zerolog.DurationFieldUnit, or else the time between its start and end
+// entries. StartSpan logs these fields. As zerolog only logs seconds by
+// default, set zerolog.TimeFieldFormat to zerolog.TimeFormatUnixMicro or
+// time.RFC3339Nano for precise start times.
+
+// Keys of the fields starting and ending spans.
+const (
+	SpanStartKey    = "span_start"
+	SpanEndKey      = "span_end"
+	SpanRefKey      = "span_ref"
+	SpanParentKey   = "span_parent"
+	SpanDurationKey = "span_duration"
+)
+
+// Span is a span logged by StartSpan.
+type Span struct {
+	logger zerolog.Logger
+	name   string
+	ref    string
+	start  time.Time
+	once   sync.Once
+}
+
+// StartSpan logs the start of the span name to logger, and returns the Span
+// to end once the timed work is done:
+//
+//	span := pkg.StartSpan(log.Logger, "load-config")
+//	defer span.End()
+func StartSpan(logger zerolog.Logger, name string) *Span {
+	return startSpan(logger, name, "")
+}
+
+func startSpan(logger zerolog.Logger, name string, parent string) *Span {
+	s := &Span{
+		logger: logger,
+		name:   name,
+		ref:    newSpanRef(),
+		start:  time.Now(),
+	}
+	e := logger.Info().Str(SpanStartKey, name).Str(SpanRefKey, s.ref)
+	if parent != "" {
+		e = e.Str(SpanParentKey, parent)
+	}
+	e.Msgf("%s started", name)
+	return s
+}
+
+// Child starts the span name nested in s.
+func (s *Span) Child(name string) *Span {
+	return startSpan(s.logger, name, s.ref)
+}
+
+// End logs the end of the span along with its duration, which it returns.
+// Only the first call logs the end of the span.
+func (s *Span) End() time.Duration {
+	d := time.Since(s.start)
+	s.once.Do(func() {
+		s.logger.Info().
+			Str(SpanEndKey, s.name).
+			Str(SpanRefKey, s.ref).
+			Dur(SpanDurationKey, d).
+			Msgf("%s ended", s.name)
+	})
+	return d
+}
+
+func newSpanRef() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// SpanRecord is a span recorded in the spans table.
+type SpanRecord struct {
+	ID        int     `json:"id"`
+	SessionID *string `json:"session_id,omitempty"`
+	Name      string  `json:"name"`
+	// ParentID is the id of the span this span is nested in.
+	ParentID  *int       `json:"parent_id,omitempty"`
+	StartedAt time.Time  `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at,omitempty"`
+	// Duration is nil while the span is open.
+	Duration *time.Duration `json:"duration,omitempty"`
+}
+
+// SpanStats sums up the durations of the spans of a name.
+type SpanStats struct {
+	Name string `json:"name"`
+	// Count is the number of ended spans, Open the number of spans that
+	// haven't ended.
+	Count int           `json:"count"`
+	Open  int           `json:"open"`
+	Total time.Duration `json:"total"`
+	Min   time.Duration `json:"min"`
+	Max   time.Duration `json:"max"`
+}
+
+// Avg returns the average duration of the ended spans.
+func (s *SpanStats) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+type SpanFilter struct {
+	Session string
+	Name    string
+}
+
+type SpanFilterOption func(*SpanFilter)
+
+// WithSpanSession only returns the spans of the session id.
+func WithSpanSession(id string) SpanFilterOption {
+	return func(f *SpanFilter) {
+		f.Session = id
+	}
+}
+
+// WithSpanName only returns the spans named name.
+func WithSpanName(name string) SpanFilterOption {
+	return func(f *SpanFilter) {
+		f.Name = name
+	}
+}
+
+func (f *SpanFilter) apply(sb *sqlbuilder.SelectBuilder) {
+	if f.Session != "" {
+		sb.Where(sb.E("session_id", f.Session))
+	}
+	if f.Name != "" {
+		sb.Where(sb.E("name", f.Name))
+	}
+}
+
+func (l *LogWriter) createSpansTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable("spans").
+		IfNotExists().
+		Define(l.columnDefinition("id", ColumnKindPrimaryKey)...).
+		Define("session_id", "VARCHAR(255)").
+		Define("name", "TEXT", "NOT NULL").
+		Define("ref", "VARCHAR(255)").
+		Define(l.columnDefinition("parent_id", ColumnKindInteger)...).
+		Define("started_at", "TIMESTAMP", "NOT NULL").
+		Define("ended_at", "TIMESTAMP").
+		// duration is in nanoseconds
+		Define(l.columnDefinition("duration", ColumnKindInteger)...)
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
+		return err
+	}
+	for _, col := range []string{"session_id", "ref"} {
+		query := fmt.Sprintf("CREATE INDEX IF NOT EXISTS spans_%s_idx ON spans (%s)", col, col)
+		if _, err := l.db.ExecContext(ctx, query); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordSpan starts or ends the span named by the span_start or span_end
+// field of the entry logged at date in session.
+func (l *LogWriter) recordSpan(ctx context.Context, tx *sqlx.Tx, log map[string]interface{}, date time.Time, session interface{}) error {
+	ref, _ := log[SpanRefKey].(string)
+	if name, ok := log[SpanStartKey].(string); ok && name != "" {
+		parent, _ := log[SpanParentKey].(string)
+		if err := l.startSpan(ctx, tx, name, ref, parent, date, session); err != nil {
+			return err
+		}
+	}
+	if name, ok := log[SpanEndKey].(string); ok && name != "" {
+		var duration *time.Duration
+		if v, ok := l.parseTimeValue(LogEntryTypeDuration, log[SpanDurationKey]); ok {
+			d := v.(time.Duration)
+			duration = &d
+		}
+		if err := l.endSpan(ctx, tx, name, ref, duration, date, session); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (l *LogWriter) startSpan(ctx context.Context, tx *sqlx.Tx,
+	name string, ref string, parent string, date time.Time, session interface{}) error {
+	var parentID sql.NullInt64
+	var err error
+	switch {
+	case parent != "":
+		sb := sqlbuilder.Select("MAX(id)").From("spans")
+		sb.Where(sb.E("ref", parent))
+		parentID, err = querySpanID(ctx, tx, sb)
+	case ref == "":
+		sb := sqlbuilder.Select("MAX(id)").From("spans")
+		sb.Where(spanSessionCondition(sb, session), sb.IsNull("ended_at"))
+		parentID, err = querySpanID(ctx, tx, sb)
+	}
+	if err != nil {
+		return err
+	}
+
+	var refValue sql.NullString
+	if ref != "" {
+		refValue = sql.NullString{String: ref, Valid: true}
+	}
+	ib := sqlbuilder.NewInsertBuilder()
+	ib.InsertInto("spans").
+		Cols("session_id", "name", "ref", "parent_id", "started_at").
+		Values(session, name, refValue, parentID, date.UTC())
+	s, args := ib.Build()
+	_, err = tx.ExecContext(ctx, tx.Rebind(s), args...)
+	return err
+}
+
+// endSpan ends the open span ref, or the last open span name of session if
+// ref is empty. An end without matching start is recorded as a span of its
+// own if its duration is known, and else ignored.
+func (l *LogWriter) endSpan(ctx context.Context, tx *sqlx.Tx,
+	name string, ref string, duration *time.Duration, date time.Time, session interface{}) error {
+	sb := sqlbuilder.Select("id", "started_at").From("spans")
+	if ref != "" {
+		sb.Where(sb.E("ref", ref))
+	} else {
+		sb.Where(sb.E("name", name), spanSessionCondition(sb, session))
+	}
+	sb.Where(sb.IsNull("ended_at")).OrderBy("id").Desc().Limit(1)
+	s, args := sb.Build()
+
+	var id int64
+	var startedAt time.Time
+	err := tx.QueryRowxContext(ctx, tx.Rebind(s), args...).Scan(&id, &startedAt)
+	if err == sql.ErrNoRows {
+		if duration == nil {
+			return nil
+		}
+		ib := sqlbuilder.NewInsertBuilder()
+		ib.InsertInto("spans").
+			Cols("session_id", "name", "started_at", "ended_at", "duration").
+			Values(session, name, date.Add(-*duration).UTC(), date.UTC(), int64(*duration))
+		s, args := ib.Build()
+		_, err = tx.ExecContext(ctx, tx.Rebind(s), args...)
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	if duration == nil {
+		d := date.Sub(startedAt)
+		if d < 0 {
+			d = 0
+		}
+		duration = &d
+	}
+	ub := sqlbuilder.Update("spans")
+	ub.Set(
+		ub.Assign("ended_at", date.UTC()),
+		ub.Assign("duration", int64(*duration)),
+	).Where(ub.E("id", id))
+	s, args = ub.Build()
+	_, err = tx.ExecContext(ctx, tx.Rebind(s), args...)
+	return err
+}
+
+func spanSessionCondition(sb *sqlbuilder.SelectBuilder, session interface{}) string {
+	if session == nil {
+		return sb.IsNull("session_id")
+	}
+	return sb.E("session_id", session)
+}
+
+func querySpanID(ctx context.Context, tx *sqlx.Tx, sb *sqlbuilder.SelectBuilder) (sql.NullInt64, error) {
+	var id sql.NullInt64
+	s, args := sb.Build()
+	err := tx.QueryRowxContext(ctx, tx.Rebind(s), args...).Scan(&id)
+	return id, err
+}
+
+// GetSpans returns the spans matching the filter options, in the order they
+// started.
+func (l *LogWriter) GetSpans(ctx context.Context, opts ...SpanFilterOption) ([]*SpanRecord, error) {
+	f := &SpanFilter{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	sb := sqlbuilder.Select("id", "session_id", "name", "parent_id", "started_at", "ended_at", "duration").
+		From("spans").
+		OrderBy("started_at", "id")
+	f.apply(sb)
+
+	ret := []*SpanRecord{}
+	err := l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		span := &SpanRecord{}
+		var sessionID sql.NullString
+		var parentID, duration sql.NullInt64
+		var endedAt sql.NullTime
+		if err := rows.Scan(&span.ID, &sessionID, &span.Name, &parentID, &span.StartedAt, &endedAt, &duration); err != nil {
+			return err
+		}
+		span.StartedAt = span.StartedAt.UTC()
+		if sessionID.Valid {
+			span.SessionID = &sessionID.String
+		}
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			span.ParentID = &id
+		}
+		if endedAt.Valid {
+			t := endedAt.Time.UTC()
+			span.EndedAt = &t
+		}
+		if duration.Valid {
+			d := time.Duration(duration.Int64)
+			span.Duration = &d
+		}
+		ret = append(ret, span)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// GetSpanStats sums up the durations of the spans matching the filter
+// options per name, the longest total first.
+func (l *LogWriter) GetSpanStats(ctx context.Context, opts ...SpanFilterOption) ([]*SpanStats, error) {
+	f := &SpanFilter{}
+	for _, opt := range opts {
+		opt(f)
+	}
+	sb := sqlbuilder.Select("name", "COUNT(*)", "COUNT(duration)",
+		"COALESCE(SUM(duration), 0)", "COALESCE(MIN(duration), 0)", "COALESCE(MAX(duration), 0)").
+		From("spans").
+		GroupBy("name")
+	f.apply(sb)
+
+	ret := []*SpanStats{}
+	err := l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		stats := &SpanStats{}
+		var count int
+		var total, shortest, longest int64
+		if err := rows.Scan(&stats.Name, &count, &stats.Count, &total, &shortest, &longest); err != nil {
+			return err
+		}
+		stats.Open = count - stats.Count
+		stats.Total, stats.Min, stats.Max = time.Duration(total), time.Duration(shortest), time.Duration(longest)
+		ret = append(ret, stats)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Total != ret[j].Total {
+			return ret[i].Total > ret[j].Total
+		}
+		return ret[i].Name < ret[j].Name
+	})
+	return ret, nil
+}
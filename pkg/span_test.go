@@ -0,0 +1,92 @@
+package pkg
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStartSpan(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil, WithDefaultSession("build"))
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	logger := zerolog.New(lw)
+	span := StartSpan(logger, "build")
+	child := span.Child("load-config")
+	time.Sleep(10 * time.Millisecond)
+	d := child.End()
+	child.End()
+	span.End()
+
+	spans, err := lw.GetSpans(context.Background(), WithSpanSession("build"))
+	require.NoError(t, err)
+	require.Len(t, spans, 2)
+	assert.Equal(t, "build", spans[0].Name)
+	assert.Nil(t, spans[0].ParentID)
+	assert.Equal(t, "load-config", spans[1].Name)
+	require.NotNil(t, spans[1].ParentID)
+	assert.Equal(t, spans[0].ID, *spans[1].ParentID)
+	require.NotNil(t, spans[1].Duration)
+	assert.InDelta(t, d, *spans[1].Duration, float64(time.Millisecond))
+	assert.GreaterOrEqual(t, *spans[0].Duration, *spans[1].Duration)
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithSession("build")))
+	require.NoError(t, err)
+	assert.Len(t, entries, 4)
+}
+
+func TestSpanFields(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	for _, line := range []string{
+		`{"level": "info", "time": "2023-05-01T12:00:00Z", "session": "a", "span_start": "test"}`,
+		`{"level": "info", "time": "2023-05-01T12:00:01Z", "session": "a", "span_start": "compile"}`,
+		`{"level": "info", "time": "2023-05-01T12:00:03Z", "session": "a", "span_end": "compile"}`,
+		`{"level": "info", "time": "2023-05-01T12:00:04Z", "session": "a", "span_start": "compile"}`,
+		`{"level": "info", "time": "2023-05-01T12:00:08Z", "session": "a", "span_end": "compile"}`,
+		// ends without start are only recorded with their duration
+		`{"level": "info", "time": "2023-05-01T12:00:09Z", "session": "a", "span_end": "lint", "span_duration": 500}`,
+		`{"level": "info", "time": "2023-05-01T12:00:09Z", "session": "a", "span_end": "vet"}`,
+		`{"level": "info", "time": "2023-05-01T12:00:10Z", "session": "b", "span_start": "compile"}`,
+	} {
+		_, err = lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	spans, err := lw.GetSpans(context.Background(), WithSpanSession("a"), WithSpanName("compile"))
+	require.NoError(t, err)
+	require.Len(t, spans, 2)
+	for _, span := range spans {
+		require.NotNil(t, span.ParentID)
+	}
+
+	stats, err := lw.GetSpanStats(context.Background(), WithSpanSession("a"))
+	require.NoError(t, err)
+	require.Len(t, stats, 3)
+	assert.Equal(t, SpanStats{Name: "compile", Count: 2, Total: 6 * time.Second, Min: 2 * time.Second, Max: 4 * time.Second}, *stats[0])
+	assert.Equal(t, 3*time.Second, stats[0].Avg())
+	assert.Equal(t, SpanStats{Name: "lint", Count: 1, Total: 500 * time.Millisecond, Min: 500 * time.Millisecond, Max: 500 * time.Millisecond}, *stats[1])
+	assert.Equal(t, SpanStats{Name: "test", Open: 1}, *stats[2])
+
+	stats, err = lw.GetSpanStats(context.Background(), WithSpanSession("b"))
+	require.NoError(t, err)
+	require.Len(t, stats, 1)
+	assert.Equal(t, 1, stats[0].Open)
+
+	_, err = lw.DeleteSession("a")
+	require.NoError(t, err)
+	spans, err = lw.GetSpans(context.Background(), WithSpanSession("a"))
+	require.NoError(t, err)
+	assert.Empty(t, spans)
+}
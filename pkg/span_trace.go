@@ -0,0 +1,115 @@
+package pkg
+
+import (
+	"encoding/json"
+	"io"
+	"time"
+)
+
+// ChromeTraceEvent is an event of the Chrome trace event format, which
+// Perfetto and chrome://tracing load.
+type ChromeTraceEvent struct {
+	Name  string `json:"name"`
+	Cat   string `json:"cat,omitempty"`
+	Phase string `json:"ph"`
+	// Timestamp and Duration are in microseconds.
+	Timestamp float64                `json:"ts"`
+	Duration  *float64               `json:"dur,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// ChromeTrace is a trace in the Chrome trace event format.
+type ChromeTrace struct {
+	TraceEvents     []ChromeTraceEvent `json:"traceEvents"`
+	DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+// ToChromeTrace converts spans, as returned by GetSpans, to a Chrome trace.
+// Each session is shown as a process, and nested spans are drawn below their
+// parent. Spans that overlap without being nested, such as spans running
+// concurrently, are drawn on separate threads. Open spans are drawn until the
+// end of the trace.
+func ToChromeTrace(spans []*SpanRecord) *ChromeTrace {
+	ret := &ChromeTrace{
+		TraceEvents:     []ChromeTraceEvent{},
+		DisplayTimeUnit: "ms",
+	}
+
+	pids := map[string]int{}
+	// lanes holds the end of the last root span of each thread of a process
+	lanes := map[int][]time.Time{}
+	tids := map[int]int{}
+	for _, s := range spans {
+		session := ""
+		if s.SessionID != nil {
+			session = *s.SessionID
+		}
+		pid, ok := pids[session]
+		if !ok {
+			pid = len(pids) + 1
+			pids[session] = pid
+			name := session
+			if name == "" {
+				name = "no session"
+			}
+			ret.TraceEvents = append(ret.TraceEvents, ChromeTraceEvent{
+				Name:  "process_name",
+				Phase: "M",
+				PID:   pid,
+				Args:  map[string]interface{}{"name": name},
+			})
+		}
+
+		end := time.Time{}
+		if s.Duration != nil {
+			end = s.StartedAt.Add(*s.Duration)
+		}
+		tid, nested := 0, false
+		if s.ParentID != nil {
+			tid, nested = tids[*s.ParentID]
+		}
+		if !nested {
+			for i, laneEnd := range lanes[pid] {
+				if !laneEnd.IsZero() && !laneEnd.After(s.StartedAt) {
+					tid = i + 1
+					lanes[pid][i] = end
+					break
+				}
+			}
+			if tid == 0 {
+				lanes[pid] = append(lanes[pid], end)
+				tid = len(lanes[pid])
+			}
+		}
+		tids[s.ID] = tid
+
+		event := ChromeTraceEvent{
+			Name:      s.Name,
+			Cat:       "span",
+			Phase:     "B",
+			Timestamp: microseconds(s.StartedAt.Sub(time.Unix(0, 0))),
+			PID:       pid,
+			TID:       tid,
+			Args:      map[string]interface{}{"id": s.ID},
+		}
+		if s.Duration != nil {
+			d := microseconds(*s.Duration)
+			event.Phase = "X"
+			event.Duration = &d
+		}
+		ret.TraceEvents = append(ret.TraceEvents, event)
+	}
+
+	return ret
+}
+
+func microseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Microsecond)
+}
+
+// WriteChromeTrace writes spans to w as a Chrome trace, see ToChromeTrace.
+func WriteChromeTrace(w io.Writer, spans []*SpanRecord) error {
+	return json.NewEncoder(w).Encode(ToChromeTrace(spans))
+}
@@ -0,0 +1,55 @@
+package pkg
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestToChromeTrace(t *testing.T) {
+	session := "s1"
+	build, lint := 1, 3
+	d := func(s int) *time.Duration {
+		d := time.Duration(s) * time.Second
+		return &d
+	}
+	start := time.Unix(100, 0)
+	spans := []*SpanRecord{
+		{ID: 1, SessionID: &session, Name: "build", StartedAt: start, Duration: d(10)},
+		{ID: 2, SessionID: &session, Name: "compile", ParentID: &build, StartedAt: start.Add(time.Second), Duration: d(2)},
+		// runs concurrently with build
+		{ID: 3, SessionID: &session, Name: "lint", StartedAt: start.Add(2 * time.Second), Duration: d(1)},
+		{ID: 4, SessionID: &session, Name: "vet", ParentID: &lint, StartedAt: start.Add(2 * time.Second)},
+		{ID: 5, SessionID: &session, Name: "test", StartedAt: start.Add(20 * time.Second), Duration: d(1)},
+		{ID: 6, Name: "other", StartedAt: start},
+	}
+
+	trace := ToChromeTrace(spans)
+	require.Len(t, trace.TraceEvents, 8)
+	assert.Equal(t, ChromeTraceEvent{Name: "process_name", Phase: "M", PID: 1, Args: map[string]interface{}{"name": "s1"}}, trace.TraceEvents[0])
+
+	tids := map[string]int{}
+	for _, e := range trace.TraceEvents[1:] {
+		if e.Phase != "M" {
+			tids[e.Name] = e.TID
+		}
+	}
+	assert.Equal(t, map[string]int{"build": 1, "compile": 1, "lint": 2, "vet": 2, "test": 1, "other": 1}, tids)
+
+	compile := trace.TraceEvents[2]
+	assert.Equal(t, "X", compile.Phase)
+	assert.Equal(t, 101e6, compile.Timestamp)
+	require.NotNil(t, compile.Duration)
+	assert.Equal(t, 2e6, *compile.Duration)
+	assert.Equal(t, "B", trace.TraceEvents[4].Phase)
+	assert.Equal(t, 2, trace.TraceEvents[7].PID)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteChromeTrace(buf, spans))
+	decoded := map[string]interface{}{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Len(t, decoded["traceEvents"], 8)
+}
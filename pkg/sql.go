@@ -0,0 +1,142 @@
+package pkg
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// SQLResult holds the rows returned by QuerySQL.
+type SQLResult struct {
+	Columns []string        `json:"columns"`
+	Rows    [][]interface{} `json:"rows"`
+}
+
+// MissingIDColumnError is returned by QueryEntriesSQL for queries that don't
+// return the id column of log_entries.
+type MissingIDColumnError struct {
+	Columns []string
+}
+
+func (e *MissingIDColumnError) Error() string {
+	return "the query has to return the id column of log_entries"
+}
+
+// readOnly runs f in a transaction that is always rolled back, so that the
+// raw SQL escape hatches can't modify the database.
+func (l *LogWriter) readOnly(ctx context.Context, f func(tx *sqlx.Tx) error) error {
+	tx, err := l.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer func(tx *sqlx.Tx) {
+		_ = tx.Rollback()
+	}(tx)
+	return f(tx)
+}
+
+// QuerySQL runs an arbitrary query against the database, for example to
+// compute statistics the filter API doesn't support. Changes made by the
+// query are rolled back.
+//
+// Text and blob values are returned as strings.
+func (l *LogWriter) QuerySQL(ctx context.Context, query string, args ...interface{}) (*SQLResult, error) {
+	ret := &SQLResult{Rows: [][]interface{}{}}
+	err := l.readOnly(ctx, func(tx *sqlx.Tx) error {
+		rows, err := tx.QueryxContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+		defer func(rows *sqlx.Rows) {
+			_ = rows.Close()
+		}(rows)
+
+		ret.Columns, err = rows.Columns()
+		if err != nil {
+			return err
+		}
+		for rows.Next() {
+			row, err := rows.SliceScan()
+			if err != nil {
+				return err
+			}
+			for i, v := range row {
+				if b, ok := v.([]byte); ok {
+					row[i] = string(b)
+				}
+			}
+			ret.Rows = append(ret.Rows, row)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ret, nil
+}
+
+// QueryEntriesSQL runs a query returning rows of log_entries, such as
+//
+//	SELECT * FROM log_entries WHERE message LIKE ? ORDER BY date DESC LIMIT 10
+//
+// and returns them along with their meta values, in the order of the query.
+// The query has to return the id column; other columns that are not part of
+// log_entries are ignored. Changes made by the query are rolled back.
+func (l *LogWriter) QueryEntriesSQL(query string, args ...interface{}) ([]*LogEntry, error) {
+	return l.QueryEntriesSQLContext(context.Background(), query, args...)
+}
+
+func (l *LogWriter) QueryEntriesSQLContext(ctx context.Context, query string, args ...interface{}) ([]*LogEntry, error) {
+	ret := []*LogEntry{}
+	entries := map[int]*LogEntry{}
+	ids := []interface{}{}
+
+	err := l.readOnly(ctx, func(tx *sqlx.Tx) error {
+		rows, err := tx.Unsafe().QueryxContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return err
+		}
+		defer func(rows *sqlx.Rows) {
+			_ = rows.Close()
+		}(rows)
+
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		hasID := false
+		for _, column := range columns {
+			hasID = hasID || column == "id"
+		}
+		if !hasID {
+			return &MissingIDColumnError{Columns: columns}
+		}
+
+		for rows.Next() {
+			entry := &LogEntry{}
+			if err := rows.StructScan(entry); err != nil {
+				return err
+			}
+			// the same entry can be returned several times, by joins for example
+			if existing, ok := entries[entry.ID]; ok {
+				ret = append(ret, existing)
+				continue
+			}
+			entries[entry.ID] = entry
+			ids = append(ids, entry.ID)
+			ret = append(ret, entry)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return ret, nil
+	}
+	if err := l.loadMeta(ctx, NewGetEntriesFilter(), entries, ids); err != nil {
+		return nil, errors.Wrap(err, "could not load meta values")
+	}
+	return ret, nil
+}
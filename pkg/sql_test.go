@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestQueryEntriesSQL(t *testing.T) {
+	lw := newImportLogWriter(t)
+	for _, line := range []string{
+		`{"level": "info", "message": "first", "n": 1}`,
+		`{"level": "error", "message": "second", "n": 2}`,
+		`{"level": "error", "message": "third", "n": 3}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.QueryEntriesSQL(
+		"SELECT *, LENGTH(message) AS length FROM log_entries WHERE level = ? ORDER BY id DESC", "error")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "third", *entries[0].Message)
+	assert.Equal(t, int64(3), entries[0].Meta["n"])
+	assert.Equal(t, int64(2), entries[1].Meta["n"])
+
+	_, err = lw.QueryEntriesSQL("SELECT level FROM log_entries")
+	var missingErr *MissingIDColumnError
+	assert.ErrorAs(t, err, &missingErr)
+
+	res, err := lw.QuerySQL(context.Background(),
+		"SELECT level, COUNT(*) AS n FROM log_entries GROUP BY level ORDER BY level")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"level", "n"}, res.Columns)
+	assert.Equal(t, [][]interface{}{{"error", int64(2)}, {"info", int64(1)}}, res.Rows)
+
+	// changes are rolled back
+	_, err = lw.QuerySQL(context.Background(), "DELETE FROM log_entries RETURNING id")
+	require.NoError(t, err)
+	all, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	assert.Len(t, all, 3)
+}
@@ -0,0 +1,49 @@
+package pkg
+
+import "context"
+
+// StatsSection is a table of the overview computed by Stats.
+type StatsSection struct {
+	Title string          `json:"title"`
+	Keys  []string        `json:"keys"`
+	Rows  []*AggregateRow `json:"rows"`
+}
+
+func (l *LogWriter) Stats(filter *GetEntriesFilter, valueKeys ...string) ([]*StatsSection, error) {
+	return l.StatsContext(context.Background(), filter, valueKeys...)
+}
+
+// StatsContext counts the entries matching filter per level, session and
+// hour. If valueKeys are given, a last section without keys holds the min,
+// max, average and sum of these numeric meta keys.
+func (l *LogWriter) StatsContext(ctx context.Context, filter *GetEntriesFilter, valueKeys ...string) ([]*StatsSection, error) {
+	sections := []*StatsSection{}
+	for _, s := range []struct {
+		title string
+		group string
+	}{
+		{"Entries per level", "level"},
+		{"Entries per session", "session"},
+		{"Entries per hour", GroupByHour},
+	} {
+		rows, err := l.AggregateContext(ctx, filter, GroupBy(s.group), Count(), Total())
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, &StatsSection{Title: s.title, Keys: []string{s.group}, Rows: rows})
+	}
+
+	if len(valueKeys) > 0 {
+		opts := []AggregateOption{Count()}
+		for _, key := range valueKeys {
+			opts = append(opts, Min(key), Max(key), Avg(key), Sum(key))
+		}
+		rows, err := l.AggregateContext(ctx, filter, opts...)
+		if err != nil {
+			return nil, err
+		}
+		sections = append(sections, &StatsSection{Title: "Values", Rows: rows})
+	}
+
+	return sections, nil
+}
@@ -0,0 +1,249 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"github.com/mattn/go-sqlite3"
+	"github.com/pkg/errors"
+	"os"
+	"strings"
+)
+
+// ColumnKind is a backend independent column type, which each Store maps to
+// the corresponding type of its database.
+type ColumnKind int
+
+const (
+	// ColumnKindPrimaryKey is an auto-incrementing integer primary key.
+	ColumnKindPrimaryKey ColumnKind = iota
+	// ColumnKindInteger is a 64 bit integer.
+	ColumnKindInteger
+	// ColumnKindReal is a double precision floating point number.
+	ColumnKindReal
+	// ColumnKindBlob stores blob and JSON values.
+	ColumnKindBlob
+)
+
+// Store abstracts the database backend a LogWriter persists entries to.
+//
+// Queries are built with go-sqlbuilder using '?' placeholders, and rebound to
+// the placeholder style of the backend using DB().Rebind before execution.
+// Everything that can't be expressed in common SQL goes through the Store.
+type Store interface {
+	// DB returns the connection pool of the backend.
+	DB() *sqlx.DB
+	// ColumnType returns the type (and constraints) used to define a column of the given kind.
+	ColumnType(kind ColumnKind) []string
+	// HasTable returns true if a table (or view) with the given name exists.
+	HasTable(name string) (bool, error)
+	// HasColumn returns true if table has a column with the given name.
+	HasColumn(table string, column string) (bool, error)
+	// SupportsFullTextSearch returns true if the backend supports the FTS5 index, see search.go.
+	SupportsFullTextSearch() bool
+	// UnixTime returns an SQL expression converting the timestamp column to UNIX seconds.
+	UnixTime(column string) string
+	// Size returns the number of bytes used by the plunger tables.
+	Size() (int64, error)
+	// Vacuum reclaims the space freed by deleted entries.
+	Vacuum() error
+	// Backup writes a consistent copy of the database to path, while it keeps
+	// being written to.
+	Backup(ctx context.Context, path string) error
+	// IntegrityCheck returns the corruptions found by the database, if it can check itself.
+	IntegrityCheck(ctx context.Context) ([]string, error)
+}
+
+// NewStore returns the Store matching the driver db was opened with.
+func NewStore(db *sqlx.DB) Store {
+	switch db.DriverName() {
+	case "postgres", "pgx":
+		return NewPostgresStore(db)
+	default:
+		return NewSQLiteStore(db)
+	}
+}
+
+func isPostgresDSN(dsn string) bool {
+	return strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://")
+}
+
+// OpenStore opens the database described by dsn, which is either a postgres://
+// URL, or the path of a sqlite file.
+func OpenStore(dsn string) (Store, error) {
+	if isPostgresDSN(dsn) {
+		db, err := sqlx.Open("postgres", dsn)
+		if err != nil {
+			return nil, err
+		}
+		return NewPostgresStore(db), nil
+	}
+
+	db, err := sqlx.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	return NewSQLiteStore(db), nil
+}
+
+// SQLiteStore is the default Store, writing to a local sqlite file.
+type SQLiteStore struct {
+	db *sqlx.DB
+}
+
+func NewSQLiteStore(db *sqlx.DB) *SQLiteStore {
+	return &SQLiteStore{db: db}
+}
+
+func (s *SQLiteStore) DB() *sqlx.DB {
+	return s.db
+}
+
+func (s *SQLiteStore) ColumnType(kind ColumnKind) []string {
+	switch kind {
+	case ColumnKindPrimaryKey:
+		return []string{"INTEGER", "PRIMARY KEY", "AUTOINCREMENT"}
+	case ColumnKindInteger:
+		return []string{"INTEGER"}
+	case ColumnKindReal:
+		return []string{"REAL"}
+	case ColumnKindBlob:
+		return []string{"BLOB"}
+	}
+	return []string{"BLOB"}
+}
+
+func (s *SQLiteStore) HasTable(name string) (bool, error) {
+	var count int
+	err := s.db.QueryRowx("SELECT COUNT(*) FROM sqlite_master WHERE name = ?", name).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *SQLiteStore) HasColumn(table string, column string) (bool, error) {
+	rows, err := s.db.Queryx(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		row := map[string]interface{}{}
+		if err := rows.MapScan(row); err != nil {
+			return false, err
+		}
+		if fmt.Sprintf("%s", row["name"]) == column {
+			return true, nil
+		}
+	}
+
+	return false, rows.Err()
+}
+
+func (s *SQLiteStore) SupportsFullTextSearch() bool {
+	return true
+}
+
+func (s *SQLiteStore) UnixTime(column string) string {
+	return fmt.Sprintf("CAST(strftime('%%s', %s) AS INTEGER)", column)
+}
+
+func (s *SQLiteStore) Size() (int64, error) {
+	// pages on the freelist are unused, but only get released by VACUUM
+	var pageCount, freelistCount, pageSize int64
+	if err := s.db.QueryRowx("PRAGMA page_count").Scan(&pageCount); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRowx("PRAGMA freelist_count").Scan(&freelistCount); err != nil {
+		return 0, err
+	}
+	if err := s.db.QueryRowx("PRAGMA page_size").Scan(&pageSize); err != nil {
+		return 0, err
+	}
+	return (pageCount - freelistCount) * pageSize, nil
+}
+
+func (s *SQLiteStore) Vacuum() error {
+	_, err := s.db.Exec("VACUUM")
+	return err
+}
+
+func (s *SQLiteStore) IntegrityCheck(ctx context.Context) ([]string, error) {
+	ret := []string{}
+	if err := s.db.SelectContext(ctx, &ret, "PRAGMA integrity_check"); err != nil {
+		return nil, err
+	}
+	if len(ret) == 1 && ret[0] == "ok" {
+		return []string{}, nil
+	}
+	return ret, nil
+}
+
+// Backup copies the database with the online backup API of sqlite, into a
+// temporary file renamed to path once complete.
+func (s *SQLiteStore) Backup(ctx context.Context, path string) error {
+	tmp := path + ".tmp"
+	_ = os.Remove(tmp)
+	if err := s.backup(ctx, tmp); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *SQLiteStore) backup(ctx context.Context, path string) error {
+	dest, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return err
+	}
+	defer func(dest *sql.DB) {
+		_ = dest.Close()
+	}(dest)
+	destConn, err := dest.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func(conn *sql.Conn) {
+		_ = conn.Close()
+	}(destConn)
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func(conn *sql.Conn) {
+		_ = conn.Close()
+	}(srcConn)
+
+	return destConn.Raw(func(destDriverConn interface{}) error {
+		return srcConn.Raw(func(srcDriverConn interface{}) error {
+			destSQLite, ok := destDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.Errorf("unexpected driver connection %T", destDriverConn)
+			}
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.Errorf("unexpected driver connection %T", srcDriverConn)
+			}
+			backup, err := destSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			// copying all pages in one step reads a single snapshot of the source
+			done, err := backup.Step(-1)
+			if err != nil {
+				_ = backup.Finish()
+				return err
+			}
+			if !done {
+				_ = backup.Finish()
+				return errors.New("backup did not complete")
+			}
+			return backup.Finish()
+		})
+	})
+}
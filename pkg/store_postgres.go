@@ -0,0 +1,98 @@
+package pkg
+
+import (
+	"context"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/lib/pq"
+	"github.com/pkg/errors"
+)
+
+// PostgresStore writes to a Postgres database, for example to collect the
+// logs of several machines in a central place.
+//
+// Blob values are stored as TEXT, since plunger stores them as strings.
+type PostgresStore struct {
+	db *sqlx.DB
+}
+
+func NewPostgresStore(db *sqlx.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) DB() *sqlx.DB {
+	return s.db
+}
+
+func (s *PostgresStore) ColumnType(kind ColumnKind) []string {
+	switch kind {
+	case ColumnKindPrimaryKey:
+		return []string{"BIGSERIAL", "PRIMARY KEY"}
+	case ColumnKindInteger:
+		return []string{"BIGINT"}
+	case ColumnKindReal:
+		return []string{"DOUBLE PRECISION"}
+	case ColumnKindBlob:
+		return []string{"TEXT"}
+	}
+	return []string{"TEXT"}
+}
+
+func (s *PostgresStore) HasTable(name string) (bool, error) {
+	var count int
+	err := s.db.QueryRowx(
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = $1",
+		name,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *PostgresStore) HasColumn(table string, column string) (bool, error) {
+	var count int
+	err := s.db.QueryRowx(
+		"SELECT COUNT(*) FROM information_schema.columns WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2",
+		table, column,
+	).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (s *PostgresStore) SupportsFullTextSearch() bool {
+	return false
+}
+
+func (s *PostgresStore) UnixTime(column string) string {
+	return "CAST(EXTRACT(EPOCH FROM " + column + ") AS BIGINT)"
+}
+
+func (s *PostgresStore) Size() (int64, error) {
+	var size int64
+	err := s.db.QueryRowx(`
+SELECT COALESCE(SUM(pg_total_relation_size(quote_ident(table_name))), 0)
+FROM information_schema.tables
+WHERE table_schema = current_schema()
+  AND table_name IN ('log_entries', 'log_entries_meta', 'meta_keys', 'sessions')`).Scan(&size)
+	if err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+func (s *PostgresStore) Vacuum() error {
+	_, err := s.db.Exec("VACUUM log_entries, log_entries_meta")
+	return err
+}
+
+// IntegrityCheck returns no corruptions, postgres has no equivalent of the
+// integrity check of sqlite.
+func (s *PostgresStore) IntegrityCheck(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+func (s *PostgresStore) Backup(ctx context.Context, path string) error {
+	return errors.New("postgres databases can't be backed up by plunger, use pg_dump")
+}
@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestNewStore(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	assert.IsType(t, &SQLiteStore{}, NewStore(db))
+
+	pg, err := sqlx.Open("postgres", "postgres://localhost/plunger")
+	require.NoError(t, err)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(pg)
+	store := NewStore(pg)
+	assert.IsType(t, &PostgresStore{}, store)
+	assert.Equal(t, []string{"BIGSERIAL", "PRIMARY KEY"}, store.ColumnType(ColumnKindPrimaryKey))
+	assert.Equal(t, "SELECT * FROM log_entries WHERE id > $1 AND level = $2",
+		pg.Rebind("SELECT * FROM log_entries WHERE id > ? AND level = ?"))
+}
+
+func TestSQLiteStoreSchema(t *testing.T) {
+	store, err := OpenStore(filepath.Join(t.TempDir(), "test.db"))
+	require.NoError(t, err)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(store.DB())
+
+	lw := NewLogWriterWithStore(store, NewSchema())
+	err = lw.Init()
+	require.NoError(t, err)
+
+	ok, err := store.HasTable("log_entries")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.HasTable("missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	ok, err = store.HasColumn("log_entries", "message")
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = store.HasColumn("log_entries", "missing")
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
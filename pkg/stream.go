@@ -0,0 +1,46 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+)
+
+// The stream of the entries captured from the output of a program, by Run,
+// Pipe and CollectDocker, is stored as the meta value StreamKey. Entries
+// logged through the LogWriter have no stream, and are matched by
+// WithStream(StreamLog).
+
+const StreamKey = "stream"
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	// StreamLog matches the entries that have no stream.
+	StreamLog = "log"
+)
+
+// WithStream matches the entries captured from stream, StreamStdout or
+// StreamStderr, or the entries logged through the LogWriter for StreamLog.
+func WithStream(stream string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.Stream = stream
+	}
+}
+
+// streamCondition matches the entries of stream, see WithStream.
+func streamCondition(metaKeys *MetaKeys, q *sqlbuilder.SelectBuilder, stream string) string {
+	if stream != StreamLog {
+		return metaCondition(metaKeys, q, StreamKey, "=", stream)
+	}
+	sb := sqlbuilder.Select("lem.log_entry_id").From("log_entries_meta lem")
+	sb.Where(metaKeyCondition(metaKeys, StreamKey))
+	return q.NotIn("id", sb)
+}
+
+// createMetaTextValueIndex indexes the text values of log_entries_meta by
+// name, so that filtering on a meta string such as the stream of the entries
+// doesn't scan all the values of the key.
+func (l *LogWriter) createMetaTextValueIndex(ctx context.Context) error {
+	_, err := l.db.ExecContext(ctx, "CREATE INDEX IF NOT EXISTS log_entries_meta_name_text_value_idx ON log_entries_meta (name, text_value)")
+	return err
+}
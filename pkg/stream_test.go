@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithStream(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	_, err = lw.Write([]byte(`{"level": "info", "message": "logged"}`))
+	require.NoError(t, err)
+	_, err = lw.Pipe(context.Background(), strings.NewReader("out\n"))
+	require.NoError(t, err)
+	_, err = lw.Pipe(context.Background(), strings.NewReader("err\n"), WithPipeStream(StreamStderr), WithPipeTee(&bytes.Buffer{}))
+	require.NoError(t, err)
+
+	messages := func(stream string) []string {
+		entries, err := lw.GetEntries(NewGetEntriesFilter(WithStream(stream)))
+		require.NoError(t, err)
+		ret := []string{}
+		for _, entry := range entries {
+			ret = append(ret, *entry.Message)
+		}
+		return ret
+	}
+	assert.Equal(t, []string{"out"}, messages(StreamStdout))
+	assert.Equal(t, []string{"err"}, messages(StreamStderr))
+	assert.Equal(t, []string{"logged"}, messages(StreamLog))
+
+	spec := &QuerySpec{Stream: StreamStderr}
+	filter, err := spec.Filter(time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, StreamStderr, filter.Stream)
+}
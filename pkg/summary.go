@@ -0,0 +1,288 @@
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultSummaryErrors is the number of error messages listed by Summarize.
+const DefaultSummaryErrors = 5
+
+// maxSummaryMessageLength is the length messages are truncated to in the
+// markdown summary.
+const maxSummaryMessageLength = 120
+
+// LevelCount is the number of entries of a level.
+type LevelCount struct {
+	Level string `json:"level"`
+	Count int    `json:"count"`
+}
+
+// FailingSpan is a span that didn't end, or during which errors were logged
+// in its session.
+type FailingSpan struct {
+	Span *SpanRecord `json:"span"`
+	// Path is the name of the span prefixed by the names of its parents.
+	Path   []string `json:"path"`
+	Errors int      `json:"errors"`
+}
+
+// Summary is a compact overview of entries, such as the entries of a CI job,
+// see Summarize.
+type Summary struct {
+	// Session is set if the summary was filtered by session.
+	Session  *Session `json:"session,omitempty"`
+	Entries  int      `json:"entries"`
+	Errors   int      `json:"errors"`
+	Warnings int      `json:"warnings"`
+	// Levels counts the entries per level, the most severe first.
+	Levels []LevelCount `json:"levels"`
+	// TopErrors are the most frequent messages of the entries at least at
+	// level error.
+	TopErrors    []MessageCount `json:"top_errors"`
+	FailingSpans []*FailingSpan `json:"failing_spans"`
+}
+
+type summaryOptions struct {
+	errors int
+}
+
+type SummaryOption func(*summaryOptions)
+
+// WithSummaryErrors sets the number of error messages listed,
+// DefaultSummaryErrors by default.
+func WithSummaryErrors(n int) SummaryOption {
+	return func(o *summaryOptions) {
+		o.errors = n
+	}
+}
+
+// Summarize sums up the entries matching filter: their count per level, the
+// most frequent error messages, and the spans that failed. Spans are only
+// considered if the filter matches a session.
+func (l *LogWriter) Summarize(ctx context.Context, filter *GetEntriesFilter, opts ...SummaryOption) (*Summary, error) {
+	o := &summaryOptions{
+		errors: DefaultSummaryErrors,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	if filter == nil {
+		filter = NewGetEntriesFilter()
+	}
+
+	ret := &Summary{
+		Levels:       []LevelCount{},
+		TopErrors:    []MessageCount{},
+		FailingSpans: []*FailingSpan{},
+	}
+	if filter.Session != "" {
+		session, err := l.Sessions().GetSession(filter.Session)
+		var unknown *UnknownSessionError
+		switch {
+		case err == nil:
+			ret.Session = session
+		case !errors.As(err, &unknown):
+			return nil, err
+		}
+	}
+
+	ids, err := l.filteredIDs(filter)
+	if err != nil {
+		return nil, err
+	}
+	sb := sqlbuilder.Select("level", "COUNT(*)").From("log_entries").GroupBy("level")
+	sb.Where(sb.In("id", ids))
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		c := LevelCount{}
+		if err := rows.Scan(&c.Level, &c.Count); err != nil {
+			return err
+		}
+		ret.Entries += c.Count
+		switch severity := levelSeverity(c.Level); {
+		case severity >= levelSeverity("error"):
+			ret.Errors += c.Count
+		case severity == levelSeverity("warn"):
+			ret.Warnings += c.Count
+		}
+		ret.Levels = append(ret.Levels, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(ret.Levels, func(i, j int) bool {
+		si, sj := levelSeverity(ret.Levels[i].Level), levelSeverity(ret.Levels[j].Level)
+		if si != sj {
+			return si > sj
+		}
+		return ret.Levels[i].Level < ret.Levels[j].Level
+	})
+
+	sb = sqlbuilder.Select("message", "COUNT(*) AS n").From("log_entries").GroupBy("message").
+		OrderBy("n DESC", "message").Limit(o.errors)
+	sb.Where(sb.In("id", ids), sb.IsNotNull("message"), minLevelCondition(sb, "error"))
+	err = l.queryRows(ctx, sb, func(rows *sqlx.Rows) error {
+		c := MessageCount{}
+		if err := rows.Scan(&c.Message, &c.Count); err != nil {
+			return err
+		}
+		ret.TopErrors = append(ret.TopErrors, c)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Session != "" {
+		ret.FailingSpans, err = l.failingSpans(ctx, filter.Session)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// failingSpans returns the spans of session that didn't end, or during which
+// entries at least at level error were logged.
+func (l *LogWriter) failingSpans(ctx context.Context, session string) ([]*FailingSpan, error) {
+	spans, err := l.GetSpans(ctx, WithSpanSession(session))
+	if err != nil {
+		return nil, err
+	}
+	byID := map[int]*SpanRecord{}
+	for _, s := range spans {
+		byID[s.ID] = s
+	}
+
+	ret := []*FailingSpan{}
+	for _, s := range spans {
+		sb := sqlbuilder.Select("COUNT(*)").From("log_entries")
+		sb.Where(sb.E("session", session), sb.GE("date", s.StartedAt), minLevelCondition(sb, "error"))
+		if s.Duration != nil {
+			sb.Where(sb.LE("date", s.StartedAt.Add(*s.Duration)))
+		}
+		var n int
+		q, args := sb.Build()
+		if err := l.db.QueryRowxContext(ctx, l.db.Rebind(q), args...).Scan(&n); err != nil {
+			return nil, err
+		}
+		if n == 0 && s.Duration != nil {
+			continue
+		}
+
+		path := []string{s.Name}
+		for p := s.ParentID; p != nil; {
+			parent, ok := byID[*p]
+			if !ok {
+				break
+			}
+			path = append([]string{parent.Name}, path...)
+			p = parent.ParentID
+		}
+		ret = append(ret, &FailingSpan{Span: s, Path: path, Errors: n})
+	}
+	return ret, nil
+}
+
+// WriteMarkdown writes the summary as markdown, to be posted as a pull
+// request comment or a CI job summary.
+func (s *Summary) WriteMarkdown(w io.Writer) error {
+	b := &strings.Builder{}
+	if s.Session != nil {
+		name := s.Session.ID
+		if s.Session.Name != "" && s.Session.Name != s.Session.ID {
+			name = s.Session.Name + " (" + s.Session.ID + ")"
+		}
+		fmt.Fprintf(b, "### Log summary of %s\n\n", markdownCode(name))
+	} else {
+		b.WriteString("### Log summary\n\n")
+	}
+
+	status := "✅"
+	if s.Errors > 0 || len(s.FailingSpans) > 0 || (s.Session != nil && s.Session.Failed()) {
+		status = "❌"
+	}
+	fmt.Fprintf(b, "%s **%d %s, %d %s** in %d %s", status,
+		s.Errors, plural(s.Errors, "error"), s.Warnings, plural(s.Warnings, "warning"),
+		s.Entries, plural(s.Entries, "entry"))
+	if s.Session != nil {
+		if s.Session.ExitCode != nil {
+			fmt.Fprintf(b, ", exit code %d", *s.Session.ExitCode)
+		}
+		if s.Session.Duration != nil {
+			fmt.Fprintf(b, ", ran for %s", s.Session.Duration.Round(time.Millisecond))
+		}
+	}
+	b.WriteString(".\n")
+
+	if len(s.Levels) > 0 {
+		b.WriteString("\n| Level | Entries |\n|---|---:|\n")
+		for _, c := range s.Levels {
+			fmt.Fprintf(b, "| %s | %d |\n", markdownCell(c.Level), c.Count)
+		}
+	}
+
+	if len(s.TopErrors) > 0 {
+		b.WriteString("\n#### Top errors\n\n| Count | Message |\n|---:|---|\n")
+		for _, c := range s.TopErrors {
+			fmt.Fprintf(b, "| %d | %s |\n", c.Count, markdownCode(truncateMessage(c.Message)))
+		}
+	}
+
+	if len(s.FailingSpans) > 0 {
+		b.WriteString("\n#### Failing spans\n\n| Span | Duration | Errors |\n|---|---:|---:|\n")
+		for _, f := range s.FailingSpans {
+			duration := "did not end"
+			if f.Span.Duration != nil {
+				duration = f.Span.Duration.Round(time.Millisecond).String()
+			}
+			fmt.Fprintf(b, "| %s | %s | %d |\n", markdownCell(strings.Join(f.Path, " › ")), duration, f.Errors)
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return word
+	}
+	if strings.HasSuffix(word, "y") {
+		return strings.TrimSuffix(word, "y") + "ies"
+	}
+	return word + "s"
+}
+
+func truncateMessage(s string) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if r := []rune(s); len(r) > maxSummaryMessageLength {
+		return string(r[:maxSummaryMessageLength-1]) + "…"
+	}
+	return s
+}
+
+// markdownCell escapes the pipes of s, which would end a table cell.
+func markdownCell(s string) string {
+	return strings.ReplaceAll(s, "|", `\|`)
+}
+
+// markdownCode formats s as inline code.
+func markdownCode(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + markdownCell(s) + fence
+}
@@ -0,0 +1,65 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"testing"
+)
+
+func TestSummarize(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	for _, line := range []string{
+		`{"level": "info", "session": "ci", "time": "2023-05-01T12:00:00Z", "span_start": "build"}`,
+		`{"level": "info", "session": "ci", "time": "2023-05-01T12:00:01Z", "span_start": "compile"}`,
+		`{"level": "error", "session": "ci", "time": "2023-05-01T12:00:02Z", "message": "undefined: foo"}`,
+		`{"level": "error", "session": "ci", "time": "2023-05-01T12:00:02Z", "message": "undefined: foo"}`,
+		`{"level": "info", "session": "ci", "time": "2023-05-01T12:00:03Z", "span_end": "compile"}`,
+		`{"level": "info", "session": "ci", "time": "2023-05-01T12:00:04Z", "span_end": "build"}`,
+		`{"level": "info", "session": "ci", "time": "2023-05-01T12:00:05Z", "span_start": "lint"}`,
+		`{"level": "info", "session": "ci", "time": "2023-05-01T12:00:06Z", "span_end": "lint"}`,
+		`{"level": "warn", "session": "ci", "time": "2023-05-01T12:00:07Z", "message": "slow"}`,
+		`{"level": "fatal", "session": "ci", "time": "2023-05-01T12:00:08Z", "message": "a | b"}`,
+		`{"level": "info", "session": "ci", "time": "2023-05-01T12:00:09Z", "span_start": "deploy"}`,
+		`{"level": "error", "session": "other", "message": "elsewhere"}`,
+	} {
+		_, err = lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	summary, err := lw.Summarize(context.Background(), NewGetEntriesFilter(WithSession("ci")))
+	require.NoError(t, err)
+	assert.Equal(t, 11, summary.Entries)
+	assert.Equal(t, 3, summary.Errors)
+	assert.Equal(t, 1, summary.Warnings)
+	assert.Equal(t, []LevelCount{{"fatal", 1}, {"error", 2}, {"warn", 1}, {"info", 7}}, summary.Levels)
+	assert.Equal(t, []MessageCount{{"undefined: foo", 2}, {"a | b", 1}}, summary.TopErrors)
+
+	paths := [][]string{}
+	for _, f := range summary.FailingSpans {
+		paths = append(paths, f.Path)
+	}
+	assert.Equal(t, [][]string{{"build"}, {"build", "compile"}, {"deploy"}}, paths)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, summary.WriteMarkdown(buf))
+	assert.Equal(t, "### Log summary\n\n"+
+		"❌ **3 errors, 1 warning** in 11 entries.\n\n"+
+		"| Level | Entries |\n|---|---:|\n| fatal | 1 |\n| error | 2 |\n| warn | 1 |\n| info | 7 |\n\n"+
+		"#### Top errors\n\n| Count | Message |\n|---:|---|\n| 2 | `undefined: foo` |\n| 1 | `a \\| b` |\n\n"+
+		"#### Failing spans\n\n| Span | Duration | Errors |\n|---|---:|---:|\n"+
+		"| build | 4s | 2 |\n| build › compile | 2s | 2 |\n| deploy | did not end | 0 |\n", buf.String())
+
+	summary, err = lw.Summarize(context.Background(), nil, WithSummaryErrors(1))
+	require.NoError(t, err)
+	assert.Equal(t, 12, summary.Entries)
+	assert.Len(t, summary.TopErrors, 1)
+	assert.Empty(t, summary.FailingSpans)
+}
@@ -0,0 +1,145 @@
+package pkg
+
+import (
+	"context"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"github.com/pkg/errors"
+)
+
+// WithContext also returns up to before entries written before each matching
+// entry and up to after entries written after it in the same session, like
+// grep -C. The surrounding entries have Context set and don't count towards
+// the limit of the filter, even the ones matching it beyond the limit.
+func WithContext(before, after int) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.ContextBefore = before
+		f.ContextAfter = after
+	}
+}
+
+func (gef *GetEntriesFilter) validateContext() error {
+	if gef.ContextBefore < 0 || gef.ContextAfter < 0 {
+		return errors.Errorf("invalid context %d/%d, expected positive numbers of entries", gef.ContextBefore, gef.ContextAfter)
+	}
+	return nil
+}
+
+// addContext inserts the entries surrounding each of the matching entries,
+// which are kept in their order. Entries surrounding several matches are only
+// returned once.
+func (l *LogWriter) addContext(ctx context.Context, filter *GetEntriesFilter, matches []*LogEntry) ([]*LogEntry, error) {
+	if filter.ContextBefore <= 0 && filter.ContextAfter <= 0 {
+		return matches, nil
+	}
+
+	seen := map[int]bool{}
+	for _, entry := range matches {
+		seen[entry.ID] = true
+	}
+
+	surrounding := map[int]*LogEntry{}
+	ids := []interface{}{}
+	// surround returns the entries around a match that don't match themselves
+	surround := func(match *LogEntry, before bool, n int) ([]*LogEntry, error) {
+		ret := []*LogEntry{}
+		if n <= 0 {
+			return ret, nil
+		}
+		entries, err := l.sessionNeighbours(ctx, match, before, n)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			if seen[entry.ID] {
+				continue
+			}
+			if e, ok := surrounding[entry.ID]; ok {
+				entry = e
+			} else {
+				entry.Context = true
+				surrounding[entry.ID] = entry
+				ids = append(ids, entry.ID)
+			}
+			ret = append(ret, entry)
+		}
+		return ret, nil
+	}
+
+	before := map[int][]*LogEntry{}
+	after := map[int][]*LogEntry{}
+	for _, match := range matches {
+		var err error
+		before[match.ID], err = surround(match, true, filter.ContextBefore)
+		if err != nil {
+			return nil, err
+		}
+		after[match.ID], err = surround(match, false, filter.ContextAfter)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(ids) > 0 {
+		if err := l.loadMeta(ctx, filter, surrounding, ids); err != nil {
+			return nil, err
+		}
+	}
+
+	ret := []*LogEntry{}
+	added := map[int]bool{}
+	add := func(entry *LogEntry) {
+		if !added[entry.ID] {
+			added[entry.ID] = true
+			ret = append(ret, entry)
+		}
+	}
+	for _, match := range matches {
+		// the entries before were read backwards
+		b := before[match.ID]
+		for i := len(b) - 1; i >= 0; i-- {
+			add(b[i])
+		}
+		add(match)
+		for _, entry := range after[match.ID] {
+			add(entry)
+		}
+	}
+	return ret, nil
+}
+
+// sessionNeighbours returns the n entries of the session of entry closest to
+// it, written before or after it. The entries before are returned backwards.
+func (l *LogWriter) sessionNeighbours(ctx context.Context, entry *LogEntry, before bool, n int) ([]*LogEntry, error) {
+	q := sqlbuilder.Select("*").From("log_entries")
+	if before {
+		q.Where(q.L("id", entry.ID)).OrderBy("id DESC")
+	} else {
+		q.Where(q.G("id", entry.ID)).OrderBy("id ASC")
+	}
+	if entry.Session != nil {
+		q.Where(q.E("session", *entry.Session))
+	} else {
+		q.Where(q.IsNull("session"))
+	}
+	q.Limit(n)
+
+	s, args := q.Build()
+	rows, err := l.db.QueryxContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	ret := []*LogEntry{}
+	for rows.Next() {
+		entry := &LogEntry{}
+		if err := rows.StructScan(entry); err != nil {
+			return nil, err
+		}
+		ret = append(ret, entry)
+	}
+	return ret, rows.Err()
+}
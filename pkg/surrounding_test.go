@@ -0,0 +1,59 @@
+package pkg
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGetEntriesContext(t *testing.T) {
+	lw := newImportLogWriter(t)
+
+	for _, line := range []string{
+		`{"level":"info","session":"a","message":"a1"}`,
+		`{"level":"info","session":"b","message":"b1"}`,
+		`{"level":"info","session":"a","message":"a2"}`,
+		`{"level":"error","session":"a","message":"a3"}`,
+		`{"level":"info","session":"a","message":"a4"}`,
+		`{"level":"error","session":"a","message":"a5"}`,
+		`{"level":"info","session":"b","message":"b2"}`,
+		`{"level":"info","session":"a","message":"a6"}`,
+		`{"level":"info","session":"a","message":"a7"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	contextMessages := func(entries []*LogEntry) []string {
+		ret := []string{}
+		for _, entry := range entries {
+			if entry.Context {
+				ret = append(ret, *entry.Message)
+			}
+		}
+		return ret
+	}
+
+	entries, err := lw.GetEntries(NewGetEntriesFilter(WithLevel("error"), WithContext(2, 1)))
+	require.NoError(t, err)
+	// the entries of other sessions are skipped, the entries around both
+	// errors are only returned once
+	assert.Equal(t, []string{"a1", "a2", "a3", "a4", "a5", "a6"}, entryMessages(entries))
+	assert.Equal(t, []string{"a1", "a2", "a4", "a6"}, contextMessages(entries))
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithLevel("error"), WithContext(0, 2), WithLimit(1)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a3", "a4", "a5"}, entryMessages(entries))
+	assert.Equal(t, []string{"a4", "a5"}, contextMessages(entries))
+
+	page, err := lw.GetEntriesPage(NewGetEntriesFilter(WithLevel("error"), WithContext(1, 0), WithLimit(1)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a2", "a3"}, entryMessages(page.Entries))
+	page, err = lw.GetEntriesPage(NewGetEntriesFilter(WithLevel("error"), WithContext(1, 0), WithLimit(1), WithCursor(page.NextCursor)))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a4", "a5"}, entryMessages(page.Entries))
+	assert.Empty(t, page.NextCursor)
+
+	_, err = lw.GetEntries(NewGetEntriesFilter(WithContext(-1, 0)))
+	assert.Error(t, err)
+}
@@ -0,0 +1,218 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Keys of the syslog header fields stored by ParseSyslog. The hostname is
+// stored under HostnameKey, the severity as the level of the entry.
+const (
+	SyslogFacilityKey = "facility"
+	SyslogSeverityKey = "severity"
+	SyslogAppNameKey  = "app_name"
+	SyslogProcIDKey   = "proc_id"
+	SyslogMsgIDKey    = "msg_id"
+)
+
+// syslogFacilities are the names of the syslog facilities, by code.
+var syslogFacilities = []string{
+	"kern", "user", "mail", "daemon", "auth", "syslog", "lpr", "news",
+	"uucp", "cron", "authpriv", "ftp", "ntp", "security", "console", "solaris-cron",
+	"local0", "local1", "local2", "local3", "local4", "local5", "local6", "local7",
+}
+
+// syslogNil is the value of missing RFC5424 header fields.
+const syslogNil = "-"
+
+// SyslogLineParser parses syslog messages, see ParseSyslog.
+var SyslogLineParser LineParser = LineParserFunc(ParseSyslog)
+
+// ParseSyslog parses an RFC5424 message such as
+//
+//	<165>1 2023-05-01T10:00:00.003Z host app 1234 ID47 [origin ip="10.0.0.1"] started
+//
+// or an RFC3164 message such as
+//
+//	<34>Oct 11 22:14:15 host su[1234]: 'su root' failed
+//
+// The severity is stored as the level, mapped with DefaultLevelMapping, and
+// the facility, hostname, app name, process id and message id as meta
+// values. The parameters of RFC5424 structured data are stored as
+// sd-id.name keys. RFC3164 timestamps, which have no year nor time zone, are
+// read in the local time zone of the current year.
+func ParseSyslog(line []byte) (map[string]interface{}, error) {
+	s := strings.TrimRight(string(line), "\r\n\x00")
+	priority, rest, err := parseSyslogPriority(s)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := map[string]interface{}{
+		"level":           DefaultLevelMapping[strconv.Itoa(priority%8)],
+		SyslogSeverityKey: int64(priority % 8),
+	}
+	if facility := priority / 8; facility < len(syslogFacilities) {
+		entry[SyslogFacilityKey] = syslogFacilities[facility]
+	}
+
+	if version, after, ok := strings.Cut(rest, " "); ok && version == "1" {
+		err = parseRFC5424(after, entry)
+	} else {
+		parseRFC3164(rest, entry, time.Now())
+	}
+	if err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+func parseSyslogPriority(s string) (int, string, error) {
+	end := strings.IndexByte(s, '>')
+	if !strings.HasPrefix(s, "<") || end < 2 || end > 4 {
+		return 0, "", errors.New("missing syslog priority")
+	}
+	priority, err := strconv.Atoi(s[1:end])
+	if err != nil || priority < 0 || priority > 191 {
+		return 0, "", errors.Errorf("invalid syslog priority %q", s[1:end])
+	}
+	return priority, s[end+1:], nil
+}
+
+func parseRFC5424(s string, entry map[string]interface{}) error {
+	fields := strings.SplitN(s, " ", 6)
+	if len(fields) < 6 {
+		return errors.New("truncated RFC5424 header")
+	}
+	timestamp, hostname, appName, procID, msgID := fields[0], fields[1], fields[2], fields[3], fields[4]
+	if timestamp != syslogNil {
+		t, err := time.Parse(time.RFC3339Nano, timestamp)
+		if err != nil {
+			return errors.Wrapf(err, "invalid RFC5424 timestamp %q", timestamp)
+		}
+		entry[zerolog.TimestampFieldName] = t.UTC()
+	}
+	for k, v := range map[string]string{
+		HostnameKey:      hostname,
+		SyslogAppNameKey: appName,
+		SyslogProcIDKey:  procID,
+		SyslogMsgIDKey:   msgID,
+	} {
+		if v != syslogNil {
+			entry[k] = v
+		}
+	}
+
+	message, err := parseStructuredData(fields[5], entry)
+	if err != nil {
+		return err
+	}
+	message = strings.TrimPrefix(message, "\xef\xbb\xbf")
+	if message != "" {
+		entry[zerolog.MessageFieldName] = message
+	}
+	return nil
+}
+
+// parseStructuredData stores the parameters of the structured data s starts
+// with into entry, and returns the message following it.
+func parseStructuredData(s string, entry map[string]interface{}) (string, error) {
+	if s == syslogNil || strings.HasPrefix(s, syslogNil+" ") {
+		return strings.TrimPrefix(strings.TrimPrefix(s, syslogNil), " "), nil
+	}
+	if !strings.HasPrefix(s, "[") {
+		return "", errors.New("invalid RFC5424 structured data")
+	}
+	for strings.HasPrefix(s, "[") {
+		end := strings.IndexAny(s, " ]")
+		if end < 0 {
+			return "", errors.New("unterminated RFC5424 structured data")
+		}
+		id := s[1:end]
+		s = s[end:]
+		for strings.HasPrefix(s, " ") {
+			eq := strings.Index(s, "=\"")
+			if eq < 0 {
+				return "", errors.Errorf("invalid parameter in structured data %s", id)
+			}
+			name := s[1:eq]
+			value, n, err := unquoteSDParam(s[eq+1:])
+			if err != nil {
+				return "", errors.Wrapf(err, "invalid parameter %s in structured data %s", name, id)
+			}
+			entry[id+"."+name] = value
+			s = s[eq+1+n:]
+		}
+		if !strings.HasPrefix(s, "]") {
+			return "", errors.Errorf("unterminated structured data %s", id)
+		}
+		s = s[1:]
+	}
+	return strings.TrimPrefix(s, " "), nil
+}
+
+// unquoteSDParam unquotes the parameter value s starts with, in which ", \
+// and ] are escaped with a backslash, returning the value and the number of
+// bytes consumed.
+func unquoteSDParam(s string) (string, int, error) {
+	b := &strings.Builder{}
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '"':
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) && strings.IndexByte(`"\]`, s[i+1]) >= 0 {
+				i++
+				c = s[i]
+			}
+			b.WriteByte(c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, errors.New("unterminated quoted value")
+}
+
+// parseRFC3164 parses the BSD syslog format, whose header is loosely
+// followed by devices: the timestamp and hostname are only stored if found.
+func parseRFC3164(s string, entry map[string]interface{}, now time.Time) {
+	if len(s) >= len(time.Stamp) {
+		if t, err := time.ParseInLocation(time.Stamp, s[:len(time.Stamp)], time.Local); err == nil {
+			t = t.AddDate(now.Year(), 0, 0)
+			// messages from the end of December received in January
+			if t.After(now.Add(24 * time.Hour)) {
+				t = t.AddDate(-1, 0, 0)
+			}
+			entry[zerolog.TimestampFieldName] = t.UTC()
+			s = strings.TrimPrefix(s[len(time.Stamp):], " ")
+
+			if hostname, rest, ok := strings.Cut(s, " "); ok && !strings.ContainsAny(hostname, ":[") {
+				entry[HostnameKey] = hostname
+				s = rest
+			}
+		}
+	}
+
+	// the tag is the app name, optionally followed by the pid in brackets
+	if end := strings.IndexAny(s, ":[ "); end > 0 {
+		tag, rest, pid := s[:end], s[end:], ""
+		if strings.HasPrefix(rest, "[") {
+			if p, after, ok := strings.Cut(rest[1:], "]"); ok {
+				pid, rest = p, after
+			}
+		}
+		if strings.HasPrefix(rest, ":") {
+			entry[SyslogAppNameKey] = tag
+			if pid != "" {
+				entry[SyslogProcIDKey] = pid
+			}
+			s = strings.TrimPrefix(rest[1:], " ")
+		}
+	}
+	if s != "" {
+		entry[zerolog.MessageFieldName] = s
+	}
+}
@@ -0,0 +1,156 @@
+package pkg
+
+import (
+	"bufio"
+	"context"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxSyslogMessageSize bounds the size of the messages read by the syslog
+// listeners, which is the largest UDP datagram.
+const maxSyslogMessageSize = 64 * 1024
+
+// syslogImporter maps the fields of parsed syslog messages to the fields of
+// the LogWriter, see mapImportedFields.
+var syslogImporter = &importer{
+	timestampField:  zerolog.TimestampFieldName,
+	timestampFormat: time.RFC3339Nano,
+	levelField:      "level",
+	messageField:    zerolog.MessageFieldName,
+}
+
+// writeSyslog parses and stores a syslog message. Failures are reported like
+// those of Write, see WithOnError.
+func (l *LogWriter) writeSyslog(ctx context.Context, message []byte) {
+	entry, err := ParseSyslog(message)
+	if err == nil {
+		_, err = l.writeBatch(ctx, []map[string]interface{}{l.mapImportedFields(syslogImporter, entry)})
+	} else {
+		err = &InvalidEntryError{Err: err}
+	}
+	if err != nil && ctx.Err() == nil {
+		l.handleWriteError(err, message)
+	}
+}
+
+// ServeSyslogUDP stores the syslog messages received on conn, one per
+// datagram, until ctx is done, which closes conn.
+func (l *LogWriter) ServeSyslogUDP(ctx context.Context, conn net.PacketConn) error {
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	buf := make([]byte, maxSyslogMessageSize)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		l.writeSyslog(ctx, buf[:n])
+	}
+}
+
+// ServeSyslogTCP stores the syslog messages received on the connections
+// accepted by listener until ctx is done, which closes listener. Messages
+// are either prefixed with their length, or terminated by a newline (RFC6587).
+func (l *LogWriter) ServeSyslogTCP(ctx context.Context, listener net.Listener) error {
+	stop := closeOnDone(ctx, listener)
+	defer stop()
+
+	wg := sync.WaitGroup{}
+	defer wg.Wait()
+	// the connections are closed as well when accepting fails
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			l.serveSyslogConn(connCtx, conn)
+		}()
+	}
+}
+
+func (l *LogWriter) serveSyslogConn(ctx context.Context, conn net.Conn) {
+	defer func(conn net.Conn) {
+		_ = conn.Close()
+	}(conn)
+	stop := closeOnDone(ctx, conn)
+	defer stop()
+
+	r := bufio.NewReaderSize(conn, maxSyslogMessageSize)
+	for {
+		message, err := readSyslogFrame(r)
+		if len(message) > 0 {
+			l.writeSyslog(ctx, message)
+		}
+		if err != nil {
+			if err != io.EOF && ctx.Err() == nil {
+				l.handleWriteError(errors.Wrap(err, "could not read syslog message"), message)
+			}
+			return
+		}
+	}
+}
+
+// readSyslogFrame reads a message prefixed with its length in octets, or
+// else terminated by a newline.
+func readSyslogFrame(r *bufio.Reader) ([]byte, error) {
+	b, err := r.Peek(1)
+	if err != nil {
+		return nil, err
+	}
+	if b[0] < '0' || b[0] > '9' {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) > 0 {
+			err = nil
+		}
+		return []byte(strings.TrimRight(string(line), "\r\n")), err
+	}
+
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil || n <= 0 || n > maxSyslogMessageSize {
+		return nil, errors.Errorf("invalid syslog frame length %q", prefix)
+	}
+	message := make([]byte, n)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, err
+	}
+	return message, nil
+}
+
+// closeOnDone closes c once ctx is done, unless the returned function is
+// called first.
+func closeOnDone(ctx context.Context, c io.Closer) func() {
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = c.Close()
+		case <-done:
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
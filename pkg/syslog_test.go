@@ -0,0 +1,136 @@
+package pkg
+
+import (
+	"context"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseSyslogRFC5424(t *testing.T) {
+	entry, err := ParseSyslog([]byte(`<165>1 2023-05-01T10:00:00.003Z host.example app 1234 ID47 [origin ip="10.0.0.1" note="a \"b\" \] c"][meta] started` + "\n"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		zerolog.TimestampFieldName: time.Date(2023, 5, 1, 10, 0, 0, 3000000, time.UTC),
+		"level":                    "info",
+		SyslogSeverityKey:          int64(5),
+		SyslogFacilityKey:          "local4",
+		HostnameKey:                "host.example",
+		SyslogAppNameKey:           "app",
+		SyslogProcIDKey:            "1234",
+		SyslogMsgIDKey:             "ID47",
+		"origin.ip":                "10.0.0.1",
+		"origin.note":              `a "b" ] c`,
+		zerolog.MessageFieldName:   "started",
+	}, entry)
+
+	entry, err = ParseSyslog([]byte("<11>1 - - - - - -"))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"level":           "error",
+		SyslogSeverityKey: int64(3),
+		SyslogFacilityKey: "user",
+	}, entry)
+
+	for _, line := range []string{
+		"no priority",
+		"<192>1 - - - - - -",
+		"<11>1 yesterday - - - - -",
+		"<11>1 - - - - [origin ip=\"1] oops",
+	} {
+		_, err = ParseSyslog([]byte(line))
+		assert.Error(t, err, line)
+	}
+}
+
+func TestParseSyslogRFC3164(t *testing.T) {
+	now := time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local)
+
+	entry := map[string]interface{}{}
+	parseRFC3164("Oct 11 22:14:15 mymachine su[42]: 'su root' failed", entry, now)
+	assert.Equal(t, map[string]interface{}{
+		// dates after the current day are from the previous year
+		zerolog.TimestampFieldName: time.Date(2023, 10, 11, 22, 14, 15, 0, time.Local).UTC(),
+		HostnameKey:                "mymachine",
+		SyslogAppNameKey:           "su",
+		SyslogProcIDKey:            "42",
+		zerolog.MessageFieldName:   "'su root' failed",
+	}, entry)
+
+	entry = map[string]interface{}{}
+	parseRFC3164("Jan  1 08:00:00 cron: job done", entry, now)
+	assert.Equal(t, map[string]interface{}{
+		zerolog.TimestampFieldName: time.Date(2024, 1, 1, 8, 0, 0, 0, time.Local).UTC(),
+		SyslogAppNameKey:           "cron",
+		zerolog.MessageFieldName:   "job done",
+	}, entry)
+
+	entry = map[string]interface{}{}
+	parseRFC3164("link down on port 3", entry, now)
+	assert.Equal(t, map[string]interface{}{zerolog.MessageFieldName: "link down on port 3"}, entry)
+
+	entry, err := ParseSyslog([]byte("<34>Oct 11 22:14:15 mymachine su: failed"))
+	require.NoError(t, err)
+	assert.Equal(t, "fatal", entry["level"])
+	assert.Equal(t, "auth", entry[SyslogFacilityKey])
+}
+
+func TestServeSyslog(t *testing.T) {
+	lw, err := OpenLogWriter(filepath.Join(t.TempDir(), "test.db"), nil)
+	require.NoError(t, err)
+	defer func(lw *LogWriter) {
+		_ = lw.Close()
+	}(lw)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	errs := make(chan error, 2)
+	go func() {
+		errs <- lw.ServeSyslogUDP(ctx, conn)
+	}()
+	go func() {
+		errs <- lw.ServeSyslogTCP(ctx, listener)
+	}()
+
+	udp, err := net.Dial("udp", conn.LocalAddr().String())
+	require.NoError(t, err)
+	_, err = udp.Write([]byte("<13>1 2023-05-01T10:00:00Z router - - - - over udp"))
+	require.NoError(t, err)
+	_ = udp.Close()
+
+	tcp, err := net.Dial("tcp", listener.Addr().String())
+	require.NoError(t, err)
+	framed := "<12>1 2023-05-01T10:00:01Z router - - - - framed"
+	_, err = tcp.Write([]byte("<11>1 2023-05-01T10:00:02Z router - - - - newline\n" +
+		strconv.Itoa(len(framed)) + " " + framed))
+	require.NoError(t, err)
+	_ = tcp.Close()
+
+	var entries []*LogEntry
+	assert.Eventually(t, func() bool {
+		entries, err = lw.GetEntries(NewGetEntriesFilter(WithOrderBy("date", Asc)))
+		return err == nil && len(entries) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Len(t, entries, 3)
+	assert.Equal(t, "over udp", *entries[0].Message)
+	assert.Equal(t, "info", entries[0].Level)
+	assert.Equal(t, "router", entries[0].Meta[HostnameKey])
+	assert.Equal(t, "framed", *entries[1].Message)
+	assert.Equal(t, "warn", entries[1].Level)
+	assert.Equal(t, "newline", *entries[2].Message)
+	assert.Equal(t, "error", entries[2].Level)
+
+	cancel()
+	assert.NoError(t, <-errs)
+	assert.NoError(t, <-errs)
+}
@@ -0,0 +1,75 @@
+package pkg
+
+import (
+	"github.com/rs/zerolog"
+	"io"
+)
+
+// LoggerConfig.AdditionalWriters receive the entries along with the database,
+// for example a zerolog.ConsoleWriter on stdout and a JSON file. Wrap them
+// with MinLevelWriter to only route some levels to them:
+//
+//	config.AdditionalWriters = []io.Writer{
+//		zerolog.ConsoleWriter{Out: os.Stdout},
+//		pkg.MinLevelWriter(errorFile, zerolog.ErrorLevel),
+//	}
+
+// MinLevelWriter returns a writer passing the entries of at least level min
+// to w, and dropping the others.
+func MinLevelWriter(w io.Writer, min zerolog.Level) zerolog.LevelWriter {
+	return &minLevelWriter{w: w, min: min}
+}
+
+type minLevelWriter struct {
+	w   io.Writer
+	min zerolog.Level
+}
+
+func (m *minLevelWriter) Write(p []byte) (int, error) {
+	return m.w.Write(p)
+}
+
+func (m *minLevelWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	// entries logged with Log() have no level, and are always written
+	if level < m.min && level != zerolog.NoLevel {
+		return len(p), nil
+	}
+	if lw, ok := m.w.(zerolog.LevelWriter); ok {
+		return lw.WriteLevel(level, p)
+	}
+	return m.w.Write(p)
+}
+
+// teeWriter writes each entry to all its writers. Contrary to
+// zerolog.MultiLevelWriter, a failing writer doesn't keep the entry from the
+// following ones.
+type teeWriter struct {
+	writers []io.Writer
+}
+
+func newTeeWriter(writers ...io.Writer) *teeWriter {
+	return &teeWriter{writers: writers}
+}
+
+func (t *teeWriter) Write(p []byte) (int, error) {
+	return t.WriteLevel(zerolog.NoLevel, p)
+}
+
+func (t *teeWriter) WriteLevel(level zerolog.Level, p []byte) (int, error) {
+	var firstErr error
+	for _, w := range t.writers {
+		var err error
+		if lw, ok := w.(zerolog.LevelWriter); ok {
+			_, err = lw.WriteLevel(level, p)
+		} else {
+			_, err = w.Write(p)
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr != nil {
+		return 0, firstErr
+	}
+	return len(p), nil
+}
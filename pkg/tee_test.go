@@ -0,0 +1,36 @@
+package pkg
+
+import (
+	"bytes"
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type failingWriter struct{}
+
+func (f failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestTeeWriter(t *testing.T) {
+	lw := newImportLogWriter(t)
+	all := &bytes.Buffer{}
+	errorsOnly := &bytes.Buffer{}
+	tee := newTeeWriter(failingWriter{}, lw, all, MinLevelWriter(errorsOnly, zerolog.ErrorLevel))
+
+	// the failing writer doesn't keep the entries from the other writers
+	_, err := tee.WriteLevel(zerolog.InfoLevel, []byte(`{"level":"info","message":"started"}`+"\n"))
+	assert.EqualError(t, err, "disk full")
+	_, err = tee.WriteLevel(zerolog.ErrorLevel, []byte(`{"level":"error","message":"failed"}`+"\n"))
+	assert.EqualError(t, err, "disk full")
+
+	entries, err := lw.GetEntries(nil)
+	require.NoError(t, err)
+	assert.Len(t, entries, 2)
+	assert.Equal(t, `{"level":"info","message":"started"}`+"\n"+
+		`{"level":"error","message":"failed"}`+"\n", all.String())
+	assert.Equal(t, `{"level":"error","message":"failed"}`+"\n", errorsOnly.String())
+}
@@ -0,0 +1,72 @@
+package pkg
+
+import (
+	"github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"time"
+)
+
+// TimestampFormatUnix can be used as a timestamp format to indicate that
+// timestamps are stored as UNIX seconds.
+//
+// zerolog uses the empty string for this (zerolog.TimeFormatUnix), which we
+// use to mean "use the zerolog default" in LoggerConfig.
+const TimestampFormatUnix = "UNIX"
+
+// parseTimestamp converts the value zerolog wrote for the timestamp field
+// into a time.Time, according to format.
+//
+// format is either a time layout, or one of zerolog's UNIX formats.
+// Numeric values are always interpreted as UNIX timestamps, and time.Time
+// values, as set by middlewares or the importer, are used as is.
+func parseTimestamp(v interface{}, format string) (time.Time, error) {
+	switch v := v.(type) {
+	case time.Time:
+		return v.UTC(), nil
+	case int64:
+		return parseUnixIntTimestamp(v, format), nil
+	case float64:
+		return parseUnixTimestamp(v, format), nil
+	case string:
+		switch format {
+		case zerolog.TimeFormatUnix, TimestampFormatUnix,
+			zerolog.TimeFormatUnixMs, zerolog.TimeFormatUnixMicro, zerolog.TimeFormatUnixNano:
+			return time.Time{}, errors.Errorf("expected numeric timestamp for format %q, got %q", format, v)
+		}
+		t, err := time.Parse(format, v)
+		if err != nil {
+			return time.Time{}, errors.Wrapf(err, "could not parse timestamp %q", v)
+		}
+		return t.UTC(), nil
+	default:
+		return time.Time{}, errors.Errorf("unsupported timestamp value %v", v)
+	}
+}
+
+func parseUnixIntTimestamp(v int64, format string) time.Time {
+	switch format {
+	case zerolog.TimeFormatUnixMs:
+		return time.UnixMilli(v).UTC()
+	case zerolog.TimeFormatUnixMicro:
+		return time.UnixMicro(v).UTC()
+	case zerolog.TimeFormatUnixNano:
+		return time.Unix(0, v).UTC()
+	default:
+		return time.Unix(v, 0).UTC()
+	}
+}
+
+func parseUnixTimestamp(v float64, format string) time.Time {
+	switch format {
+	case zerolog.TimeFormatUnixMs:
+		return time.UnixMilli(int64(v)).UTC()
+	case zerolog.TimeFormatUnixMicro:
+		return time.UnixMicro(int64(v)).UTC()
+	case zerolog.TimeFormatUnixNano:
+		return time.Unix(0, int64(v)).UTC()
+	default:
+		sec := int64(v)
+		nsec := int64((v - float64(sec)) * float64(time.Second))
+		return time.Unix(sec, nsec).UTC()
+	}
+}
@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"sort"
+)
+
+// The trace and span ids of an entry are stored in the trace_id and span_id
+// columns of log_entries rather than as meta, so that the entries of a trace
+// can be found across sessions, see GetTrace.
+
+const (
+	DefaultTraceIDFieldName = "trace_id"
+	DefaultSpanIDFieldName  = "span_id"
+)
+
+// WithTraceFieldNames sets the fields stored in the trace_id and span_id
+// columns, DefaultTraceIDFieldName and DefaultSpanIDFieldName by default.
+func WithTraceFieldNames(traceID string, spanID string) LogWriterOption {
+	return func(l *LogWriter) {
+		l.traceIDFieldName = traceID
+		l.spanIDFieldName = spanID
+	}
+}
+
+// entryTrace holds the trace columns of a log entry.
+type entryTrace struct {
+	TraceID sql.NullString
+	SpanID  sql.NullString
+}
+
+// parseTrace extracts the trace columns from log, and marks the fields it
+// used in skippedKeys. Ids that aren't strings are kept as meta.
+func (l *LogWriter) parseTrace(log map[string]interface{}, skippedKeys map[string]bool) entryTrace {
+	ret := entryTrace{}
+	if v, ok := log[l.traceIDFieldName].(string); ok && v != "" {
+		ret.TraceID = sql.NullString{String: v, Valid: true}
+		skippedKeys[l.traceIDFieldName] = true
+	}
+	if v, ok := log[l.spanIDFieldName].(string); ok && v != "" {
+		ret.SpanID = sql.NullString{String: v, Valid: true}
+		skippedKeys[l.spanIDFieldName] = true
+	}
+	return ret
+}
+
+func (e *LogEntry) trace() entryTrace {
+	ret := entryTrace{}
+	if e.TraceID != nil {
+		ret.TraceID = sql.NullString{String: *e.TraceID, Valid: true}
+	}
+	if e.SpanID != nil {
+		ret.SpanID = sql.NullString{String: *e.SpanID, Valid: true}
+	}
+	return ret
+}
+
+// WithTraceID matches the entries of a trace.
+func WithTraceID(traceID string) GetEntriesFilterOption {
+	return func(f *GetEntriesFilter) {
+		f.TraceID = traceID
+	}
+}
+
+// GetTrace returns the entries of a trace across all sessions, ordered by
+// date, see WithTraceID.
+func (l *LogWriter) GetTrace(ctx context.Context, traceID string) ([]*LogEntry, error) {
+	entries, err := l.GetEntriesContext(ctx, NewGetEntriesFilter(WithTraceID(traceID)))
+	if err != nil {
+		return nil, err
+	}
+	// entries are ordered by id, which only follows the dates within a session
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Date.Before(entries[j].Date)
+	})
+	return entries, nil
+}
@@ -0,0 +1,42 @@
+package pkg
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestGetTrace(t *testing.T) {
+	lw := newImportLogWriter(t, WithTraceFieldNames("traceId", "spanId"))
+
+	for _, line := range []string{
+		`{"level":"info","time":"2023-05-01T10:00:02Z","session":"api","message":"response","traceId":"t1","spanId":"s1"}`,
+		`{"level":"info","time":"2023-05-01T10:00:00Z","session":"worker","message":"job","traceId":"t1","spanId":"s2"}`,
+		`{"level":"info","time":"2023-05-01T10:00:01Z","session":"api","message":"other","traceId":"t2"}`,
+		`{"level":"info","time":"2023-05-01T10:00:01Z","session":"api","message":"numeric","traceId":42}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	entries, err := lw.GetTrace(context.Background(), "t1")
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "job", *entries[0].Message)
+	assert.Equal(t, "s2", *entries[0].SpanID)
+	assert.Equal(t, "response", *entries[1].Message)
+	assert.NotContains(t, entries[1].Meta, "traceId")
+	assert.NotContains(t, entries[1].Meta, "spanId")
+
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithQueryString(`span_id="s1"`)))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "response", *entries[0].Message)
+
+	// ids that aren't strings are kept as meta
+	entries, err = lw.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"traceId": 42})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Nil(t, entries[0].TraceID)
+}
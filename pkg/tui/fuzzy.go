@@ -0,0 +1,60 @@
+package tui
+
+import (
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// fuzzyMatch returns true if all the characters of pattern appear in s, in
+// order, ignoring case. Spaces in pattern separate terms which all have to match.
+func fuzzyMatch(pattern string, s string) bool {
+	s = strings.ToLower(s)
+	for _, term := range strings.Fields(strings.ToLower(pattern)) {
+		if !subsequence(term, s) {
+			return false
+		}
+	}
+	return true
+}
+
+func subsequence(pattern string, s string) bool {
+	rs := []rune(s)
+	i := 0
+	for _, p := range pattern {
+		for i < len(rs) && rs[i] != p && !(unicode.IsSpace(p) && unicode.IsSpace(rs[i])) {
+			i++
+		}
+		if i == len(rs) {
+			return false
+		}
+		i++
+	}
+	return true
+}
+
+// searchText is the text of an entry matched against the fuzzy search.
+func searchText(entry *pkg.LogEntry) string {
+	parts := []string{entry.Level}
+	if entry.Session != nil {
+		parts = append(parts, *entry.Session)
+	}
+	if entry.Message != nil {
+		parts = append(parts, *entry.Message)
+	}
+	for _, k := range sortedKeys(entry.Meta) {
+		parts = append(parts, k+"="+export.FormatValue(entry.Meta[k]))
+	}
+	return strings.Join(parts, " ")
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,423 @@
+// Package tui implements an interactive terminal browser for plunger databases.
+package tui
+
+import (
+	"context"
+	"fmt"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/go-go-golems/plunger/pkg/export"
+	"strings"
+	"time"
+)
+
+// DefaultMaxEntries is the number of most recent entries loaded by the browser.
+const DefaultMaxEntries = 1000
+
+const detailHeight = 10
+
+var (
+	levelStyles = map[string]lipgloss.Style{
+		"trace": lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		"debug": lipgloss.NewStyle().Foreground(lipgloss.Color("8")),
+		"info":  lipgloss.NewStyle().Foreground(lipgloss.Color("4")),
+		"warn":  lipgloss.NewStyle().Foreground(lipgloss.Color("3")),
+		"error": lipgloss.NewStyle().Foreground(lipgloss.Color("1")),
+		"fatal": lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true),
+		"panic": lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true),
+	}
+	selectedStyle = lipgloss.NewStyle().Reverse(true)
+	headerStyle   = lipgloss.NewStyle().Bold(true)
+	helpStyle     = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
+	errorStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+)
+
+type ModelOption func(*Model)
+
+// WithFilter sets the filter the browser starts with. The session and meta
+// filters toggled interactively are added on top of it.
+func WithFilter(filter *pkg.GetEntriesFilter) ModelOption {
+	return func(m *Model) {
+		m.filter = filter
+	}
+}
+
+// WithMaxEntries sets how many of the most recent matching entries are loaded.
+func WithMaxEntries(n int) ModelOption {
+	return func(m *Model) {
+		m.maxEntries = n
+	}
+}
+
+// Model is the bubbletea model of the log browser.
+//
+// The list shows the most recent entries matching the filter, and the pane
+// below it the meta values of the selected entry. Keybindings:
+//
+//	up/down, pgup/pgdown, home/end  move the selection
+//	/                               fuzzy search the loaded entries
+//	tab                             select the next meta key of the entry
+//	s                               only show the session of the entry
+//	f                               only show entries with the selected meta value
+//	c                               clear the session and meta filters
+//	r                               reload
+//	q                               quit
+type Model struct {
+	logWriter  *pkg.LogWriter
+	filter     *pkg.GetEntriesFilter
+	maxEntries int
+
+	session     string
+	metaFilters map[string]interface{}
+
+	entries []*pkg.LogEntry
+	visible []*pkg.LogEntry
+
+	selected int
+	offset   int
+	keyIndex int
+
+	search    string
+	searching bool
+
+	width  int
+	height int
+	err    error
+}
+
+type entriesLoadedMsg struct {
+	entries []*pkg.LogEntry
+	err     error
+}
+
+func NewModel(logWriter *pkg.LogWriter, opts ...ModelOption) *Model {
+	m := &Model{
+		logWriter:   logWriter,
+		filter:      pkg.NewGetEntriesFilter(),
+		maxEntries:  DefaultMaxEntries,
+		metaFilters: map[string]interface{}{},
+		width:       80,
+		height:      24,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+func (m *Model) Init() tea.Cmd {
+	return m.load()
+}
+
+// load fetches the most recent entries matching the current filters.
+func (m *Model) load() tea.Cmd {
+	f := *m.filter
+	if m.session != "" {
+		f.Session = m.session
+	}
+	if len(m.metaFilters) > 0 {
+		metaFilters := map[string]interface{}{}
+		for k, v := range f.MetaFilters {
+			metaFilters[k] = v
+		}
+		for k, v := range m.metaFilters {
+			metaFilters[k] = v
+		}
+		f.MetaFilters = metaFilters
+	}
+	maxEntries := m.maxEntries
+
+	return func() tea.Msg {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		it, err := m.logWriter.IterEntries(ctx, &f)
+		if err != nil {
+			return entriesLoadedMsg{err: err}
+		}
+		defer func(it pkg.EntryIterator) {
+			_ = it.Close()
+		}(it)
+
+		// only keep the most recent entries
+		entries := []*pkg.LogEntry{}
+		for it.Next() {
+			entries = append(entries, it.Entry())
+			if maxEntries > 0 && len(entries) > 2*maxEntries {
+				entries = append([]*pkg.LogEntry{}, entries[len(entries)-maxEntries:]...)
+			}
+		}
+		if maxEntries > 0 && len(entries) > maxEntries {
+			entries = entries[len(entries)-maxEntries:]
+		}
+		return entriesLoadedMsg{entries: entries, err: it.Err()}
+	}
+}
+
+func (m *Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.scroll()
+
+	case entriesLoadedMsg:
+		m.err = msg.err
+		if msg.err == nil {
+			m.entries = msg.entries
+			m.applySearch()
+			m.selected = len(m.visible) - 1
+			m.keyIndex = 0
+			m.scroll()
+		}
+
+	case tea.KeyMsg:
+		if m.searching {
+			return m, m.updateSearch(msg)
+		}
+		return m, m.updateBrowse(msg)
+	}
+
+	return m, nil
+}
+
+func (m *Model) updateSearch(msg tea.KeyMsg) tea.Cmd {
+	switch msg.Type {
+	case tea.KeyEnter:
+		m.searching = false
+	case tea.KeyEsc:
+		m.searching = false
+		m.search = ""
+	case tea.KeyBackspace:
+		if len(m.search) > 0 {
+			r := []rune(m.search)
+			m.search = string(r[:len(r)-1])
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		m.search += string(msg.Runes)
+	case tea.KeyCtrlC:
+		return tea.Quit
+	}
+
+	m.applySearch()
+	m.selected = len(m.visible) - 1
+	m.scroll()
+	return nil
+}
+
+func (m *Model) updateBrowse(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "q", "ctrl+c":
+		return tea.Quit
+	case "up", "k":
+		m.move(-1)
+	case "down", "j":
+		m.move(1)
+	case "pgup":
+		m.move(-m.listHeight())
+	case "pgdown":
+		m.move(m.listHeight())
+	case "home", "g":
+		m.move(-len(m.visible))
+	case "end", "G":
+		m.move(len(m.visible))
+	case "/":
+		m.searching = true
+	case "esc":
+		m.search = ""
+		m.applySearch()
+		m.scroll()
+	case "tab":
+		if entry := m.selectedEntry(); entry != nil && len(entry.Meta) > 0 {
+			m.keyIndex = (m.keyIndex + 1) % len(entry.Meta)
+		}
+	case "s":
+		if entry := m.selectedEntry(); entry != nil && entry.Session != nil {
+			m.session = *entry.Session
+			return m.load()
+		}
+	case "f":
+		if entry := m.selectedEntry(); entry != nil && len(entry.Meta) > 0 {
+			key := sortedKeys(entry.Meta)[m.keyIndex%len(entry.Meta)]
+			m.metaFilters[key] = entry.Meta[key]
+			return m.load()
+		}
+	case "c":
+		m.session = ""
+		m.metaFilters = map[string]interface{}{}
+		return m.load()
+	case "r":
+		return m.load()
+	}
+	return nil
+}
+
+func (m *Model) applySearch() {
+	if m.search == "" {
+		m.visible = m.entries
+		return
+	}
+	m.visible = []*pkg.LogEntry{}
+	for _, entry := range m.entries {
+		if fuzzyMatch(m.search, searchText(entry)) {
+			m.visible = append(m.visible, entry)
+		}
+	}
+}
+
+func (m *Model) move(delta int) {
+	m.selected += delta
+	m.keyIndex = 0
+	m.scroll()
+}
+
+// scroll clamps the selection and makes sure it is visible.
+func (m *Model) scroll() {
+	if m.selected >= len(m.visible) {
+		m.selected = len(m.visible) - 1
+	}
+	if m.selected < 0 {
+		m.selected = 0
+	}
+
+	height := m.listHeight()
+	if m.selected < m.offset {
+		m.offset = m.selected
+	}
+	if m.selected >= m.offset+height {
+		m.offset = m.selected - height + 1
+	}
+	if m.offset < 0 {
+		m.offset = 0
+	}
+}
+
+func (m *Model) listHeight() int {
+	// header, separator, status and help lines
+	h := m.height - detailHeight - 4
+	if h < 1 {
+		return 1
+	}
+	return h
+}
+
+func (m *Model) selectedEntry() *pkg.LogEntry {
+	if m.selected < 0 || m.selected >= len(m.visible) {
+		return nil
+	}
+	return m.visible[m.selected]
+}
+
+func (m *Model) View() string {
+	b := &strings.Builder{}
+
+	b.WriteString(headerStyle.Render(m.describeFilters()))
+	b.WriteString("\n")
+
+	height := m.listHeight()
+	for i := m.offset; i < m.offset+height; i++ {
+		if i < len(m.visible) {
+			line := m.formatLine(m.visible[i])
+			if i == m.selected {
+				line = selectedStyle.Render(line)
+			}
+			b.WriteString(line)
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString(strings.Repeat("─", m.width))
+	b.WriteString("\n")
+	m.writeDetail(b)
+
+	if m.err != nil {
+		b.WriteString(errorStyle.Render(truncate("error: "+m.err.Error(), m.width)))
+	} else if m.searching {
+		b.WriteString("/" + m.search)
+	} else {
+		b.WriteString(fmt.Sprintf("%d/%d entries", len(m.visible), len(m.entries)))
+	}
+	b.WriteString("\n")
+	b.WriteString(helpStyle.Render(truncate("/ search  tab next key  s session  f filter key  c clear  r reload  q quit", m.width)))
+
+	return b.String()
+}
+
+func (m *Model) describeFilters() string {
+	parts := []string{"plunger"}
+	if m.session != "" {
+		parts = append(parts, "session="+m.session)
+	}
+	for _, k := range sortedKeys(m.metaFilters) {
+		parts = append(parts, k+"="+export.FormatValue(m.metaFilters[k]))
+	}
+	if m.search != "" {
+		parts = append(parts, "search="+m.search)
+	}
+	return truncate(strings.Join(parts, "  "), m.width)
+}
+
+func (m *Model) formatLine(entry *pkg.LogEntry) string {
+	level := fmt.Sprintf("%-5s", strings.ToUpper(entry.Level))
+	if style, ok := levelStyles[strings.ToLower(entry.Level)]; ok {
+		level = style.Render(level)
+	}
+	message := ""
+	if entry.Message != nil {
+		message = *entry.Message
+	}
+	prefix := entry.Date.Local().Format("2006-01-02 15:04:05") + " "
+	// the level is 5 characters wide, plus a space
+	return prefix + level + " " + truncate(message, m.width-len(prefix)-6)
+}
+
+func (m *Model) writeDetail(b *strings.Builder) {
+	entry := m.selectedEntry()
+	lines := []string{}
+	if entry != nil {
+		header := fmt.Sprintf("#%d %s %s", entry.ID, entry.Date.Format(time.RFC3339Nano), entry.Level)
+		if entry.Session != nil {
+			header += " session=" + *entry.Session
+		}
+		if entry.TraceID != nil {
+			header += " trace=" + *entry.TraceID
+		}
+		lines = append(lines, truncate(header, m.width))
+		if entry.Error != nil {
+			lines = append(lines, truncate("error: "+*entry.Error, m.width))
+		}
+
+		keys := sortedKeys(entry.Meta)
+		// scroll the keys so that the selected one is visible
+		start := 0
+		if len(keys) > 0 && m.keyIndex%len(keys) >= detailHeight-1 {
+			start = m.keyIndex%len(keys) - detailHeight + 2
+		}
+		for i := start; i < len(keys); i++ {
+			line := truncate(keys[i]+": "+export.FormatValue(entry.Meta[keys[i]]), m.width)
+			if i == m.keyIndex%len(keys) {
+				line = selectedStyle.Render(line)
+			}
+			lines = append(lines, line)
+		}
+	}
+
+	for i := 0; i < detailHeight; i++ {
+		if i < len(lines) {
+			b.WriteString(lines[i])
+		}
+		b.WriteString("\n")
+	}
+}
+
+func truncate(s string, width int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	r := []rune(s)
+	if width <= 0 {
+		return ""
+	}
+	if len(r) > width {
+		return string(r[:width-1]) + "…"
+	}
+	return s
+}
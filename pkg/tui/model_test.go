@@ -0,0 +1,109 @@
+package tui
+
+import (
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	assert.True(t, fuzzyMatch("cnfail", "Connection failed"))
+	assert.True(t, fuzzyMatch("conn user=bob", "connection closed user=bob"))
+	assert.False(t, fuzzyMatch("conn user=alice", "connection closed user=bob"))
+	assert.False(t, fuzzyMatch("failc", "Connection failed"))
+	assert.True(t, fuzzyMatch("", "anything"))
+}
+
+func newTestModel(t *testing.T, opts ...ModelOption) *Model {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+	db.SetMaxOpenConns(1)
+
+	lw := pkg.NewLogWriter(db, pkg.NewSchema())
+	require.NoError(t, lw.Init())
+	for _, line := range []string{
+		`{"level": "info", "message": "starting", "session": "s1", "user": "alice"}`,
+		`{"level": "error", "message": "connection failed", "session": "s1", "user": "bob"}`,
+		`{"level": "info", "message": "starting", "session": "s2", "user": "bob"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	return NewModel(lw, opts...)
+}
+
+// run executes cmd and feeds the resulting message back into the model.
+func run(t *testing.T, m *Model, cmd tea.Cmd) {
+	require.NotNil(t, cmd)
+	_, next := m.Update(cmd())
+	assert.Nil(t, next)
+}
+
+func key(s string) tea.KeyMsg {
+	switch s {
+	case "tab":
+		return tea.KeyMsg{Type: tea.KeyTab}
+	case "enter":
+		return tea.KeyMsg{Type: tea.KeyEnter}
+	case "up":
+		return tea.KeyMsg{Type: tea.KeyUp}
+	}
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func messagesOf(entries []*pkg.LogEntry) []string {
+	ret := []string{}
+	for _, entry := range entries {
+		ret = append(ret, *entry.Message)
+	}
+	return ret
+}
+
+func TestModelLoadAndFilter(t *testing.T) {
+	m := newTestModel(t)
+	run(t, m, m.Init())
+	require.NoError(t, m.err)
+	require.Len(t, m.visible, 3)
+	// the most recent entry is selected
+	assert.Equal(t, 2, m.selected)
+
+	// filter by the session of the selected entry
+	m.Update(key("up"))
+	_, cmd := m.Update(key("s"))
+	run(t, m, cmd)
+	assert.Equal(t, "s1", m.session)
+	assert.Equal(t, []string{"starting", "connection failed"}, messagesOf(m.visible))
+
+	// filter by the second meta key (user) of the selected entry
+	_, cmd = m.Update(key("c"))
+	run(t, m, cmd)
+	m.Update(key("tab"))
+	_, cmd = m.Update(key("f"))
+	run(t, m, cmd)
+	assert.Equal(t, map[string]interface{}{"user": "bob"}, m.metaFilters)
+	assert.Len(t, m.visible, 2)
+
+	assert.Contains(t, m.View(), "user=bob")
+}
+
+func TestModelSearch(t *testing.T) {
+	m := newTestModel(t, WithMaxEntries(2))
+	run(t, m, m.Init())
+	assert.Equal(t, []string{"connection failed", "starting"}, messagesOf(m.entries))
+
+	m.Update(key("/"))
+	for _, r := range "cnfail" {
+		m.Update(key(string(r)))
+	}
+	m.Update(key("enter"))
+	assert.False(t, m.searching)
+	assert.Equal(t, []string{"connection failed"}, messagesOf(m.visible))
+	assert.Equal(t, 0, m.selected)
+}
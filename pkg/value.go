@@ -0,0 +1,126 @@
+package pkg
+
+import (
+	"database/sql"
+	"encoding/json"
+	"math"
+	"strings"
+	"time"
+)
+
+// metaValue holds the typed columns of log_entries_meta a value gets decomposed into.
+type metaValue struct {
+	Type LogEntryType
+	Int  sql.NullInt64
+	Real sql.NullFloat64
+	Text sql.NullString
+	Blob sql.NullString
+	// Compression is set if Blob is compressed, see compressBlob.
+	Compression sql.NullString
+}
+
+// blobArg is the value bound to the blob_value column. Compressed values are
+// binary, which postgres doesn't accept as a string.
+func (v *metaValue) blobArg() interface{} {
+	if v.Compression.Valid {
+		return []byte(v.Blob.String)
+	}
+	return v.Blob
+}
+
+func toMetaValue(v interface{}) (*metaValue, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return toMetaValue(normalizeNumber(v))
+	case int64:
+		return &metaValue{Type: LogEntryTypeInt, Int: sql.NullInt64{Int64: v, Valid: true}}, nil
+	case int:
+		return toMetaValue(int64(v))
+	case int8:
+		return toMetaValue(int64(v))
+	case int16:
+		return toMetaValue(int64(v))
+	case int32:
+		return toMetaValue(int64(v))
+	case uint:
+		return toMetaValue(uint64(v))
+	case uint8:
+		return toMetaValue(int64(v))
+	case uint16:
+		return toMetaValue(int64(v))
+	case uint32:
+		return toMetaValue(int64(v))
+	case uint64:
+		if v > math.MaxInt64 {
+			return toMetaValue(float64(v))
+		}
+		return toMetaValue(int64(v))
+	case float32:
+		return toMetaValue(float64(v))
+	case float64:
+		return &metaValue{Type: LogEntryTypeReal, Real: sql.NullFloat64{Float64: v, Valid: true}}, nil
+	case bool:
+		return &metaValue{Type: LogEntryTypeBool, Int: sql.NullInt64{Int64: boolToInt(v), Valid: true}}, nil
+	case time.Duration:
+		return &metaValue{Type: LogEntryTypeDuration, Int: sql.NullInt64{Int64: int64(v), Valid: true}}, nil
+	case time.Time:
+		return &metaValue{Type: LogEntryTypeTime, Int: sql.NullInt64{Int64: v.UnixNano(), Valid: true}}, nil
+	case []byte:
+		return &metaValue{Type: LogEntryTypeBlob, Blob: sql.NullString{String: string(v), Valid: true}}, nil
+	case string:
+		return &metaValue{Type: LogEntryTypeText, Text: sql.NullString{String: v, Valid: true}}, nil
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return &metaValue{Type: LogEntryTypeJSON, Blob: sql.NullString{String: string(b), Valid: true}}, nil
+	}
+}
+
+// boolToInt returns the int_value booleans are stored as.
+func boolToInt(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// normalizeNumber converts a JSON number to an int64 if it is written without
+// fractional part or exponent and fits, and to a float64 otherwise.
+func normalizeNumber(n json.Number) interface{} {
+	s := n.String()
+	if !strings.ContainsAny(s, ".eE") {
+		if i, err := n.Int64(); err == nil {
+			return i
+		}
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return s
+	}
+	return f
+}
+
+// decodeEntry decodes a JSON log entry, keeping integers as int64 and
+// other numbers as float64.
+//
+// Nested values keep their json.Number representation, which gets marshalled
+// back unchanged.
+func decodeEntry(p []byte) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(string(p)))
+	decoder.UseNumber()
+
+	var entry map[string]interface{}
+	if err := decoder.Decode(&entry); err != nil {
+		return nil, err
+	}
+
+	for k, v := range entry {
+		if n, ok := v.(json.Number); ok {
+			entry[k] = normalizeNumber(n)
+		}
+	}
+
+	return entry, nil
+}
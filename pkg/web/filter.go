@@ -0,0 +1,282 @@
+package web
+
+import (
+	"encoding/json"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/pkg/errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FilterFromQuery builds the entries filter from the query parameters of an API request.
+//
+// The parameters mirror the flags of plunger query: level (repeatable),
+// min_level, session, session_tree, from, to, where (repeatable key=value),
+// between (repeatable key=[from,to], null leaving a bound open), json_path
+// (repeatable key:path=value, such as payload:$.user.id=42), select
+// (repeatable), caller, error_contains, trace_id, stream, q (an expression in
+// the query language), search, order_by (repeatable key:asc or key:desc),
+// last, context_before, context_after, limit, offset, after_id and cursor.
+func FilterFromQuery(q url.Values) (*pkg.GetEntriesFilter, error) {
+	opts := []pkg.GetEntriesFilterOption{}
+
+	if levels := nonEmpty(q["level"]); len(levels) > 0 {
+		opts = append(opts, pkg.WithLevels(levels...))
+	}
+	if minLevel := q.Get("min_level"); minLevel != "" {
+		opts = append(opts, pkg.WithMinLevel(minLevel))
+	}
+	if session := q.Get("session"); session != "" {
+		opts = append(opts, pkg.WithSession(session))
+	}
+	if sessionTree := q.Get("session_tree"); sessionTree != "" {
+		opts = append(opts, pkg.WithSessionTree(sessionTree))
+	}
+	if group := q.Get("group"); group != "" {
+		opts = append(opts, pkg.WithGroup(group))
+	}
+
+	if from := q.Get("from"); from != "" {
+		t, err := parseTime(from)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pkg.WithFrom(t))
+	}
+	if to := q.Get("to"); to != "" {
+		t, err := parseTime(to)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pkg.WithTo(t))
+	}
+
+	if wheres := nonEmpty(q["where"]); len(wheres) > 0 {
+		metaFilters := map[string]interface{}{}
+		for _, where := range wheres {
+			k, v, ok := strings.Cut(where, "=")
+			if !ok {
+				return nil, errors.Errorf("invalid where %q, expected key=value", where)
+			}
+			metaFilters[k] = parseValue(v)
+		}
+		opts = append(opts, pkg.WithMetaFilters(metaFilters))
+	}
+
+	for _, between := range nonEmpty(q["between"]) {
+		k, v, ok := strings.Cut(between, "=")
+		bounds := []interface{}{}
+		if ok {
+			decoder := json.NewDecoder(strings.NewReader(v))
+			decoder.UseNumber()
+			ok = decoder.Decode(&bounds) == nil && len(bounds) == 2
+		}
+		if !ok {
+			return nil, errors.Errorf("invalid between %q, expected key=[from,to]", between)
+		}
+		opts = append(opts, pkg.WithMetaBetween(k, bounds[0], bounds[1]))
+	}
+
+	for _, jsonPath := range nonEmpty(q["json_path"]) {
+		k, rest, ok := strings.Cut(jsonPath, ":")
+		path, v, ok_ := strings.Cut(rest, "=")
+		if !ok || !ok_ {
+			return nil, errors.Errorf("invalid json_path %q, expected key:path=value", jsonPath)
+		}
+		opts = append(opts, pkg.WithJSONPath(k, path, parseValue(v)))
+	}
+
+	if selected := nonEmpty(q["select"]); len(selected) > 0 {
+		opts = append(opts, pkg.WithSelectedMetaKeys(selected...))
+	}
+
+	for name, opt := range map[string]func(string) pkg.GetEntriesFilterOption{
+		"caller":         pkg.WithCaller,
+		"error_contains": pkg.WithErrorContains,
+		"trace_id":       pkg.WithTraceID,
+		"stream":         pkg.WithStream,
+		"q":              pkg.WithQueryString,
+	} {
+		if s := q.Get(name); s != "" {
+			opts = append(opts, opt(s))
+		}
+	}
+
+	for name, opt := range map[string]func(int) pkg.GetEntriesFilterOption{
+		"limit":    pkg.WithLimit,
+		"offset":   pkg.WithOffset,
+		"after_id": pkg.WithAfterID,
+		"last":     pkg.WithLast,
+	} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, errors.Errorf("invalid %s %q", name, s)
+			}
+			opts = append(opts, opt(n))
+		}
+	}
+	contextLines := [2]int{}
+	for i, name := range []string{"context_before", "context_after"} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil {
+				return nil, errors.Errorf("invalid %s %q", name, s)
+			}
+			contextLines[i] = n
+		}
+	}
+	if contextLines[0] != 0 || contextLines[1] != 0 {
+		opts = append(opts, pkg.WithContext(contextLines[0], contextLines[1]))
+	}
+	if cursor := q.Get("cursor"); cursor != "" {
+		opts = append(opts, pkg.WithCursor(cursor))
+	}
+	for _, s := range nonEmpty(q["order_by"]) {
+		o, err := pkg.ParseOrderBy(s)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, pkg.WithOrderBy(o.Key, o.Direction))
+	}
+	if search := q.Get("search"); search != "" {
+		opts = append(opts, pkg.WithSearch(search))
+	}
+
+	filter := pkg.NewGetEntriesFilter(opts...)
+	if err := filter.Validate(); err != nil {
+		return nil, err
+	}
+	return filter, nil
+}
+
+// FilterToQuery encodes filter as the query parameters parsed by FilterFromQuery.
+func FilterToQuery(filter *pkg.GetEntriesFilter) (url.Values, error) {
+	q := url.Values{}
+	if filter == nil {
+		return q, nil
+	}
+
+	if filter.Level != "" {
+		q.Add("level", filter.Level)
+	}
+	for _, level := range filter.Levels {
+		q.Add("level", level)
+	}
+	for _, column := range []struct {
+		name  string
+		value string
+	}{
+		{"min_level", filter.MinLevel},
+		{"session", filter.Session},
+		{"session_tree", filter.SessionTree},
+		{"group", filter.Group},
+		{"caller", filter.Caller},
+		{"error_contains", filter.ErrorContains},
+		{"trace_id", filter.TraceID},
+		{"stream", filter.Stream},
+		{"q", filter.Query},
+		{"search", filter.Search},
+		{"cursor", filter.Cursor},
+	} {
+		if column.value != "" {
+			q.Set(column.name, column.value)
+		}
+	}
+	if !filter.From.IsZero() {
+		q.Set("from", filter.From.Format(time.RFC3339Nano))
+	}
+	if !filter.To.IsZero() {
+		q.Set("to", filter.To.Format(time.RFC3339Nano))
+	}
+
+	for k, v := range filter.MetaFilters {
+		// values are JSON, so that the string "1" doesn't become a number
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not encode the value of %s", k)
+		}
+		q.Add("where", k+"="+string(b))
+	}
+	for _, r := range filter.MetaRanges {
+		b, err := json.Marshal([]interface{}{r.From, r.To})
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not encode the range of %s", r.Key)
+		}
+		q.Add("between", r.Key+"="+string(b))
+	}
+	for _, f := range filter.JSONPaths {
+		b, err := json.Marshal(f.Value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not encode the value of %s", f.Path)
+		}
+		q.Add("json_path", f.Key+":"+f.Path+"="+string(b))
+	}
+	for _, key := range filter.SelectedMetaKeys {
+		q.Add("select", key)
+	}
+	for _, o := range filter.OrderBy {
+		q.Add("order_by", o.String())
+	}
+
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"limit", filter.Limit},
+		{"offset", filter.Offset},
+		{"after_id", filter.AfterID},
+		{"last", filter.Last},
+		{"context_before", filter.ContextBefore},
+		{"context_after", filter.ContextAfter},
+	} {
+		if n.value > 0 {
+			q.Set(n.name, strconv.Itoa(n.value))
+		}
+	}
+
+	return q, nil
+}
+
+func nonEmpty(values []string) []string {
+	ret := []string{}
+	for _, v := range values {
+		if v != "" {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+// parseTime accepts RFC3339 timestamps, the values of datetime-local inputs,
+// dates, and relative durations such as -1h (one hour ago).
+func parseTime(s string) (time.Time, error) {
+	if strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err == nil {
+			return time.Now().Add(d), nil
+		}
+	}
+
+	for _, layout := range []string{time.RFC3339, "2006-01-02T15:04", "2006-01-02 15:04:05", "2006-01-02"} {
+		t, err := time.Parse(layout, s)
+		if err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, errors.Errorf("could not parse time %q", s)
+}
+
+// parseValue interprets value as JSON if possible, falling back to a string.
+func parseValue(value string) interface{} {
+	decoder := json.NewDecoder(strings.NewReader(value))
+	decoder.UseNumber()
+	var v interface{}
+	if err := decoder.Decode(&v); err == nil && !decoder.More() {
+		return v
+	}
+	return value
+}
@@ -0,0 +1,289 @@
+// Package web serves a browser UI and a small JSON API on top of a plunger database.
+package web
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/rs/zerolog/log"
+	"io/fs"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed static
+var staticFiles embed.FS
+
+// Server serves the single page UI along with the API it uses:
+//
+//   - GET /api/sessions lists the sessions
+//   - GET /api/entries returns a page of entries matching the query parameters
+//   - GET /api/entries/{id} returns a single entry with all its meta values
+//   - GET /api/stats returns the entry counts per level, session and hour of
+//     the entries matching the query parameters, and the min, max, average
+//     and sum of the numeric meta keys given as key parameters
+//   - GET /api/stats/heartbeats returns the last heartbeat of the sessions of
+//     the entries matching the query parameters, with the heartbeat keys
+//     given as heartbeat_key parameters, flagging the sessions stalled for
+//     the stall_after duration, see pkg.LogWriter.Heartbeats
+//   - GET /api/tail streams new matching entries as server-sent events. Each
+//     event carries the id of its entry, so that clients reconnecting with a
+//     Last-Event-ID header resume after the last entry they received
+//   - POST /api/ingest writes the log lines of the request body, in the format
+//     given by the format query parameter, see pkg.LineParserForFormat
+type Server struct {
+	logWriter *pkg.LogWriter
+	mux       *http.ServeMux
+	// keepAliveInterval is how often idle tail streams get a comment, so that
+	// proxies don't close them.
+	keepAliveInterval time.Duration
+}
+
+// DefaultKeepAliveInterval is how often idle tail streams get a keep-alive comment.
+const DefaultKeepAliveInterval = 15 * time.Second
+
+type ServerOption func(*Server)
+
+func WithKeepAliveInterval(interval time.Duration) ServerOption {
+	return func(s *Server) {
+		s.keepAliveInterval = interval
+	}
+}
+
+func NewServer(logWriter *pkg.LogWriter, opts ...ServerOption) *Server {
+	s := &Server{
+		logWriter:         logWriter,
+		mux:               http.NewServeMux(),
+		keepAliveInterval: DefaultKeepAliveInterval,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	static, err := fs.Sub(staticFiles, "static")
+	if err != nil {
+		// the embedded directory is always present
+		panic(err)
+	}
+	s.mux.Handle("/", http.FileServer(http.FS(static)))
+	s.mux.HandleFunc("/api/sessions", s.handleSessions)
+	s.mux.HandleFunc("/api/entries", s.handleEntries)
+	s.mux.HandleFunc("/api/entries/", s.handleEntry)
+	s.mux.HandleFunc("/api/stats", s.handleStats)
+	s.mux.HandleFunc("/api/stats/heartbeats", s.handleHeartbeats)
+	s.mux.HandleFunc("/api/tail", s.handleTail)
+	s.mux.HandleFunc("/api/ingest", s.handleIngest)
+
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	sessions, err := s.logWriter.Sessions().ListSessions()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, sessions)
+}
+
+func (s *Server) handleEntries(w http.ResponseWriter, r *http.Request) {
+	filter, err := FilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := s.logWriter.GetEntriesPageContext(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, page)
+}
+
+// handleEntry serves /api/entries/<id>, and /api/entries/<id>/graph for the
+// entries linked to it up to the depth query parameter, see pkg.LogWriter.GetEntryGraph.
+func (s *Server) handleEntry(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/api/entries/")
+	graph := strings.HasSuffix(path, "/graph")
+	path = strings.TrimSuffix(path, "/graph")
+	id, err := strconv.Atoi(path)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid entry id %q", path))
+		return
+	}
+
+	var entry interface{}
+	if graph {
+		depth := 0
+		if d := r.URL.Query().Get("depth"); d != "" {
+			if depth, err = strconv.Atoi(d); err != nil {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("invalid depth %q", d))
+				return
+			}
+		}
+		entry, err = s.logWriter.GetEntryGraph(r.Context(), id, depth)
+	} else {
+		entry, err = s.logWriter.GetEntryContext(r.Context(), id)
+	}
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(*pkg.UnknownEntryError); ok {
+			status = http.StatusNotFound
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, entry)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	filter, err := FilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	sections, err := s.logWriter.StatsContext(r.Context(), filter, nonEmpty(r.URL.Query()["key"])...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, sections)
+}
+
+func (s *Server) handleHeartbeats(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter, err := FilterFromQuery(query)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	opts := []pkg.HeartbeatOption{}
+	if keys := nonEmpty(query["heartbeat_key"]); len(keys) > 0 {
+		opts = append(opts, pkg.WithHeartbeatKeys(keys...))
+	}
+	if v := query.Get("stall_after"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid stall_after %q", v))
+			return
+		}
+		opts = append(opts, pkg.WithStallAfter(d))
+	}
+
+	heartbeats, err := s.logWriter.HeartbeatsContext(r.Context(), filter, opts...)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, heartbeats)
+}
+
+func (s *Server) handleTail(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	filter, err := FilterFromQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	// set by EventSource when it reconnects
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		id, err := strconv.Atoi(lastEventID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid Last-Event-ID %q", lastEventID))
+			return
+		}
+		if id > filter.AfterID {
+			filter.AfterID = id
+		}
+	}
+
+	entries, err := s.logWriter.Follow(r.Context(), filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(s.keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case entry, ok := <-entries:
+			if !ok {
+				return
+			}
+			b, err := json.Marshal(entry)
+			if err != nil {
+				log.Warn().Err(err).Int("id", entry.ID).Msg("could not serialize entry")
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\ndata: %s\n\n", entry.ID, b); err != nil {
+				// the client went away, Follow stops once the request context is done
+				return
+			}
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func (s *Server) handleIngest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("method %s not allowed", r.Method))
+		return
+	}
+
+	parser, err := pkg.LineParserForFormat(r.URL.Query().Get("format"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	progress, err := s.logWriter.ImportContext(r.Context(), r.Body, pkg.WithImportParser(parser))
+	if err != nil {
+		status := http.StatusInternalServerError
+		if _, ok := err.(*pkg.ImportLineError); ok {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+	writeJSON(w, progress)
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Warn().Err(err).Msg("could not write response")
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
@@ -0,0 +1,273 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"github.com/go-go-golems/plunger/pkg"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestServer(t *testing.T) (*pkg.LogWriter, *httptest.Server) {
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	t.Cleanup(func() {
+		_ = db.Close()
+	})
+
+	lw := pkg.NewLogWriter(db, pkg.NewSchema(), pkg.WithFollowInterval(10*time.Millisecond))
+	require.NoError(t, lw.Init())
+
+	for _, line := range []string{
+		`{"level": "info", "message": "first", "session": "s1", "user": "alice"}`,
+		`{"level": "error", "message": "second", "session": "s1", "user": "bob"}`,
+		`{"level": "debug", "message": "third", "session": "s2"}`,
+	} {
+		_, err := lw.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	server := httptest.NewServer(NewServer(lw))
+	t.Cleanup(server.Close)
+	return lw, server
+}
+
+func TestServerEntries(t *testing.T) {
+	_, server := newTestServer(t)
+
+	q := url.Values{}
+	q.Set("session", "s1")
+	q.Add("where", "user=bob")
+	res, err := http.Get(server.URL + "/api/entries?" + q.Encode())
+	require.NoError(t, err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+
+	page := &pkg.EntriesPage{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(page))
+	require.Len(t, page.Entries, 1)
+	assert.Equal(t, "second", *page.Entries[0].Message)
+	assert.Empty(t, page.NextCursor)
+
+	res2, err := http.Get(server.URL + "/api/entries?from=yesterday")
+	require.NoError(t, err)
+	defer func() {
+		_ = res2.Body.Close()
+	}()
+	assert.Equal(t, http.StatusBadRequest, res2.StatusCode)
+}
+
+func TestServerSessionsAndIndex(t *testing.T) {
+	_, server := newTestServer(t)
+
+	res, err := http.Get(server.URL + "/api/sessions")
+	require.NoError(t, err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	sessions := []*pkg.SessionSummary{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(&sessions))
+	require.Len(t, sessions, 2)
+
+	res2, err := http.Get(server.URL + "/")
+	require.NoError(t, err)
+	defer func() {
+		_ = res2.Body.Close()
+	}()
+	assert.Equal(t, http.StatusOK, res2.StatusCode)
+	assert.Contains(t, res2.Header.Get("Content-Type"), "text/html")
+}
+
+func TestServerEntryAndStats(t *testing.T) {
+	lw, server := newTestServer(t)
+
+	get := func(path string, v interface{}) int {
+		res, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer func() {
+			_ = res.Body.Close()
+		}()
+		if v != nil && res.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(res.Body).Decode(v))
+		}
+		return res.StatusCode
+	}
+
+	entry := &pkg.LogEntry{}
+	require.Equal(t, http.StatusOK, get("/api/entries/2", entry))
+	assert.Equal(t, "second", *entry.Message)
+	assert.Equal(t, "bob", entry.Meta["user"])
+	assert.Equal(t, http.StatusNotFound, get("/api/entries/10", nil))
+	assert.Equal(t, http.StatusBadRequest, get("/api/entries/second", nil))
+
+	require.NoError(t, lw.Link(1, 2, pkg.LinkCauses))
+	graph := &pkg.EntryGraph{}
+	require.Equal(t, http.StatusOK, get("/api/entries/2/graph?depth=1", graph))
+	assert.Len(t, graph.Entries, 2)
+	require.Len(t, graph.Links, 1)
+	assert.Equal(t, pkg.LinkCauses, graph.Links[0].Kind)
+	assert.Equal(t, http.StatusNotFound, get("/api/entries/10/graph", nil))
+
+	sections := []*pkg.StatsSection{}
+	require.Equal(t, http.StatusOK, get("/api/stats?session=s1", &sections))
+	require.Len(t, sections, 3)
+	assert.Equal(t, []string{"level"}, sections[0].Keys)
+	assert.Len(t, sections[0].Rows, 2)
+	assert.Equal(t, http.StatusBadRequest, get("/api/stats?q=level%3D", nil))
+}
+
+func TestServerTail(t *testing.T) {
+	lw, server := newTestServer(t)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/tail?level=error&after_id=1", nil)
+	require.NoError(t, err)
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	assert.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+
+	_, err = lw.Write([]byte(`{"level": "error", "message": "fourth"}`))
+	require.NoError(t, err)
+
+	messages := []string{}
+	scanner := bufio.NewScanner(res.Body)
+	for len(messages) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		entry := &pkg.LogEntry{}
+		require.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), entry))
+		messages = append(messages, *entry.Message)
+	}
+	assert.Equal(t, []string{"second", "fourth"}, messages)
+}
+
+func TestServerTailResume(t *testing.T) {
+	lw, _ := newTestServer(t)
+	server := httptest.NewServer(NewServer(lw, WithKeepAliveInterval(10*time.Millisecond)))
+	t.Cleanup(server.Close)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	// the reconnecting client already received the second entry
+	req, err := http.NewRequestWithContext(ctx, "GET", server.URL+"/api/tail?after_id=1", nil)
+	require.NoError(t, err)
+	req.Header.Set("Last-Event-ID", "2")
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+
+	lines := []string{}
+	scanner := bufio.NewScanner(res.Body)
+	for len(lines) < 2 && scanner.Scan() {
+		if line := scanner.Text(); line != "" && !strings.HasPrefix(line, ":") {
+			lines = append(lines, line)
+		}
+	}
+	assert.Equal(t, []string{"id: 3", `data: {"id":3`}, []string{lines[0], lines[1][:len(`data: {"id":3`)]})
+
+	// idle streams get keep-alive comments
+	for scanner.Scan() {
+		if scanner.Text() == ": keep-alive" {
+			return
+		}
+	}
+	t.Fatal("no keep-alive received")
+}
+
+func TestFilterFromQuery(t *testing.T) {
+	q := url.Values{}
+	q.Add("level", "info")
+	q.Add("level", "")
+	q.Add("level", "warn")
+	q.Set("limit", "10")
+	q.Add("where", "count=3")
+	filter, err := FilterFromQuery(q)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"info", "warn"}, filter.Levels)
+	assert.Equal(t, 10, filter.Limit)
+	assert.Equal(t, json.Number("3"), filter.MetaFilters["count"])
+
+	// FilterToQuery encodes what FilterFromQuery parses
+	from := time.Date(2023, 5, 1, 10, 0, 0, 500, time.UTC)
+	filter = pkg.NewGetEntriesFilter(
+		pkg.WithLevel("error"), pkg.WithSession("s1"), pkg.WithFrom(from),
+		pkg.WithMetaFilters(map[string]interface{}{"code": "1", "n": json.Number("2")}),
+		pkg.WithTraceID("t1"), pkg.WithQueryString(`user="bob"`), pkg.WithLimit(5),
+		pkg.WithOrderBy("date", pkg.Desc), pkg.WithOrderBy("elapsed", pkg.Asc), pkg.WithContext(2, 0),
+		pkg.WithMetaBetween("elapsed", 100*time.Millisecond, nil), pkg.WithJSONPath("payload", "$.user.id", 42),
+	)
+	q, err = FilterToQuery(filter)
+	require.NoError(t, err)
+	decoded, err := FilterFromQuery(q)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"error"}, decoded.Levels)
+	assert.Equal(t, "s1", decoded.Session)
+	assert.True(t, from.Equal(decoded.From))
+	assert.Equal(t, map[string]interface{}{"code": "1", "n": json.Number("2")}, decoded.MetaFilters)
+	assert.Equal(t, "t1", decoded.TraceID)
+	assert.Equal(t, `user="bob"`, decoded.Query)
+	assert.Equal(t, 5, decoded.Limit)
+	assert.Equal(t, []pkg.OrderBy{{Key: "date", Direction: pkg.Desc}, {Key: "elapsed", Direction: pkg.Asc}}, decoded.OrderBy)
+	assert.Equal(t, 2, decoded.ContextBefore)
+	assert.Equal(t, 0, decoded.ContextAfter)
+	// durations are sent as nanoseconds, the way they are stored
+	assert.Equal(t, []pkg.MetaRange{{Key: "elapsed", From: json.Number("100000000")}}, decoded.MetaRanges)
+	assert.Equal(t, []pkg.JSONPathFilter{{Key: "payload", Path: "$.user.id", Value: json.Number("42")}}, decoded.JSONPaths)
+
+	_, err = FilterFromQuery(url.Values{"limit": {"ten"}})
+	assert.Error(t, err)
+	_, err = FilterFromQuery(url.Values{"where": {"nokey"}})
+	assert.Error(t, err)
+	_, err = FilterFromQuery(url.Values{"order_by": {"date:sideways"}})
+	assert.Error(t, err)
+	_, err = FilterFromQuery(url.Values{"between": {"n=[1]"}})
+	assert.Error(t, err)
+	_, err = FilterFromQuery(url.Values{"json_path": {"payload=42"}})
+	assert.Error(t, err)
+}
+
+func TestServerIngest(t *testing.T) {
+	lw, server := newTestServer(t)
+
+	res, err := http.Post(server.URL+"/api/ingest?format=logfmt", "text/plain",
+		strings.NewReader("level=warn message=ingested\nlevel=info message=again\n"))
+	require.NoError(t, err)
+	defer func() {
+		_ = res.Body.Close()
+	}()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	progress := &pkg.ImportProgress{}
+	require.NoError(t, json.NewDecoder(res.Body).Decode(progress))
+	assert.Equal(t, 2, progress.Imported)
+
+	entries, err := lw.GetEntries(pkg.NewGetEntriesFilter(pkg.WithLevel("warn")))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "ingested", *entries[0].Message)
+
+	res2, err := http.Post(server.URL+"/api/ingest", "application/json", strings.NewReader("not json\n"))
+	require.NoError(t, err)
+	defer func() {
+		_ = res2.Body.Close()
+	}()
+	assert.Equal(t, http.StatusBadRequest, res2.StatusCode)
+}
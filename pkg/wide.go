@@ -0,0 +1,194 @@
+package pkg
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/huandu/go-sqlbuilder"
+	"github.com/jmoiron/sqlx"
+	"strings"
+)
+
+// The wide table stores the values of the schema's meta keys as columns of
+// log_entries_wide, with one row per log entry, instead of one
+// log_entries_meta row per value. This is much faster to query for
+// high-volume logs with a fixed schema.
+//
+// Each meta key gets the typed value columns of log_entries_meta, prefixed by
+// key_<id>_, so that values keep their type:
+//
+//	key_<id>_type, key_<id>_int_value, key_<id>_real_value, key_<id>_text_value, key_<id>_blob_value
+//
+// Keys that are not part of the schema are still stored in log_entries_meta,
+// and GetEntries reads both layouts, so that a database can switch to the
+// wide table without rewriting older entries.
+
+const wideTable = "log_entries_wide"
+
+// WithWideTable stores the values of the schema's meta keys in
+// log_entries_wide. Init creates the table and adds the columns of new keys.
+func WithWideTable(enabled bool) LogWriterOption {
+	return func(l *LogWriter) {
+		l.wideTable = enabled
+	}
+}
+
+// wideColumn returns the column of log_entries_wide storing column of key.
+func wideColumn(key *MetaKey, column string) string {
+	return fmt.Sprintf("key_%d_%s", key.ID, column)
+}
+
+// wideExpression rewrites an expression over the lem.* columns of
+// log_entries_meta to the columns of key in log_entries_wide, aliased lem.
+func wideExpression(key *MetaKey, expr string) string {
+	return strings.ReplaceAll(expr, "lem.", "lem."+wideColumn(key, ""))
+}
+
+var wideValueColumns = []string{"int_value", "real_value", "text_value", "blob_value"}
+
+// wideColumns returns the type column of key, followed by its value columns
+// in the order of wideValueColumns.
+func wideColumns(key *MetaKey) []string {
+	ret := []string{wideColumn(key, "type")}
+	for _, column := range wideValueColumns {
+		ret = append(ret, wideColumn(key, column))
+	}
+	return ret
+}
+
+// createWideTable creates log_entries_wide and the columns of the schema's meta keys.
+func (l *LogWriter) createWideTable(ctx context.Context) error {
+	ctb := sqlbuilder.NewCreateTableBuilder()
+	ctb.CreateTable(wideTable).
+		IfNotExists().
+		Define(l.columnDefinition("log_entry_id", ColumnKindInteger, "PRIMARY KEY")...)
+	if _, err := l.db.ExecContext(ctx, ctb.String()); err != nil {
+		return err
+	}
+
+	kinds := map[string]ColumnKind{
+		"int_value":  ColumnKindInteger,
+		"real_value": ColumnKindReal,
+		"blob_value": ColumnKindBlob,
+	}
+	for _, key := range sortedMetaKeys(l.schema.MetaKeys) {
+		if err := l.ensureColumn(ctx, wideTable, wideColumn(key, "type"), "INTEGER"); err != nil {
+			return err
+		}
+		for _, column := range wideValueColumns {
+			definition := "TEXT"
+			if kind, ok := kinds[column]; ok {
+				definition = strings.Join(l.store.ColumnType(kind), " ")
+			}
+			if err := l.ensureColumn(ctx, wideTable, wideColumn(key, column), definition); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// loadWideColumns marks the meta keys that have columns in log_entries_wide.
+func (l *LogWriter) loadWideColumns(ctx context.Context) error {
+	exists, err := l.store.HasTable(wideTable)
+	if err != nil || !exists {
+		return err
+	}
+
+	for _, key := range l.schema.MetaKeys.Keys {
+		key.Wide, err = l.store.HasColumn(wideTable, wideColumn(key, "type"))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertWideValues stores the values of the wide meta keys of an entry as part of tx.
+func (l *LogWriter) insertWideValues(ctx context.Context, tx *sqlx.Tx, logEntryID int, values map[*MetaKey]*metaValue) error {
+	if len(values) == 0 {
+		return nil
+	}
+
+	q := sqlbuilder.NewInsertBuilder()
+	cols := []string{"log_entry_id"}
+	row := []interface{}{logEntryID}
+	for key, value := range values {
+		cols = append(cols, wideColumns(key)...)
+		row = append(row, value.Type, value.Int, value.Real, value.Text, value.Blob)
+	}
+	q.InsertInto(wideTable).Cols(cols...).Values(row...)
+	s, args := q.Build()
+	_, err := tx.ExecContext(ctx, tx.Rebind(s), args...)
+	return err
+}
+
+// readWideMeta adds the values stored in log_entries_wide to the meta of entries.
+func (l *LogWriter) readWideMeta(ctx context.Context, filter *GetEntriesFilter, entries map[int]*LogEntry, ids []interface{}) error {
+	selected := map[string]bool{}
+	for _, k := range filter.SelectedMetaKeys {
+		selected[k] = true
+	}
+
+	keys := []*MetaKey{}
+	cols := []string{"log_entry_id"}
+	for _, key := range sortedMetaKeys(l.schema.MetaKeys) {
+		if !key.Wide || (len(selected) > 0 && !selected[key.Name]) {
+			continue
+		}
+		keys = append(keys, key)
+		cols = append(cols, wideColumns(key)...)
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	sb := sqlbuilder.Select(cols...).From(wideTable)
+	sb.Where(sb.In("log_entry_id", ids...))
+	s, args := sb.Build()
+	rows, err := l.db.QueryxContext(ctx, l.db.Rebind(s), args...)
+	if err != nil {
+		return err
+	}
+	defer func(rows *sqlx.Rows) {
+		_ = rows.Close()
+	}(rows)
+
+	for rows.Next() {
+		var logEntryID int
+		types := make([]sql.NullInt64, len(keys))
+		metas := make([]LogEntryMeta, len(keys))
+		dest := []interface{}{&logEntryID}
+		for i := range keys {
+			dest = append(dest, &types[i], &metas[i].IntValue, &metas[i].RealValue, &metas[i].TextValue, &metas[i].BlobValue)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		entry, ok := entries[logEntryID]
+		if !ok {
+			continue
+		}
+		for i, key := range keys {
+			if !types[i].Valid {
+				continue
+			}
+			metas[i].Type = LogEntryType(types[i].Int64)
+			metas[i].BlobDir = l.blobDir
+			metas[i].Cipher = l.cipher
+			metas[i].FieldCipher = l.fieldCipher
+			v, err := metas[i].Value()
+			if err != nil {
+				return err
+			}
+			if entry.Meta == nil {
+				entry.Meta = map[string]interface{}{}
+			}
+			entry.Meta[key.Name] = v
+		}
+	}
+
+	return rows.Err()
+}
@@ -0,0 +1,78 @@
+package pkg
+
+import (
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestLogWriterWideTable(t *testing.T) {
+	db := sqlx.MustOpen("sqlite3", ":memory:")
+	require.NotNil(t, db)
+	defer func(db *sqlx.DB) {
+		_ = db.Close()
+	}(db)
+	db.SetMaxOpenConns(1)
+
+	newSchema := func(keys ...string) *Schema {
+		schema := NewSchema()
+		for _, key := range keys {
+			schema.MetaKeys.Add(key)
+		}
+		return schema
+	}
+
+	// an entry written before switching to the wide table
+	lw := NewLogWriter(db, newSchema("user", "count"))
+	require.NoError(t, lw.Init())
+	_, err := lw.Write([]byte(`{"level": "info", "user": "alice", "count": 1}`))
+	require.NoError(t, err)
+
+	lw = NewLogWriter(db, newSchema("user", "count", "tags"), WithWideTable(true))
+	require.NoError(t, lw.Init())
+	_, err = lw.Write([]byte(`{"level": "info", "user": "bob", "count": 2, "tags": ["a"], "other": 1.5}`))
+	require.NoError(t, err)
+
+	var metaRows int
+	require.NoError(t, db.Get(&metaRows, "SELECT COUNT(*) FROM log_entries_meta WHERE log_entry_id = 2"))
+	assert.Equal(t, 1, metaRows, "only the key outside the schema is stored as meta row")
+
+	// a reader without WithWideTable reads both layouts
+	reader := NewLogWriter(db, NewSchema())
+	require.NoError(t, reader.Init())
+	entries, err := reader.GetEntries(nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, map[string]interface{}{"user": "alice", "count": int64(1)}, entries[0].Meta)
+	assert.Equal(t, map[string]interface{}{
+		"user": "bob", "count": int64(2), "tags": []interface{}{"a"}, "other": 1.5,
+	}, entries[1].Meta)
+
+	entries, err = reader.GetEntries(NewGetEntriesFilter(
+		WithMetaFilters(map[string]interface{}{"count": 2}),
+		WithSelectedMetaKeys("user"),
+	))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, map[string]interface{}{"user": "bob"}, entries[0].Meta)
+
+	entries, err = reader.GetEntries(NewGetEntriesFilter(WithMetaFilters(map[string]interface{}{"user": "alice"})))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, 1, entries[0].ID)
+
+	rows, err := reader.Aggregate(NewGetEntriesFilter(), GroupBy("user"), Sum("count"))
+	require.NoError(t, err)
+	require.Len(t, rows, 2)
+	assert.Equal(t, "alice", rows[0].Group["user"])
+	assert.Equal(t, "bob", rows[1].Group["user"])
+	assert.Equal(t, 2.0, rows[1].Values["sum(count)"])
+
+	res, err := reader.Prune(pruneRules{{MaxEntries: 1}})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), res.DeletedEntries)
+	var wideRows int
+	require.NoError(t, db.Get(&wideRows, "SELECT COUNT(*) FROM log_entries_wide"))
+	assert.Equal(t, 1, wideRows)
+}